@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleAbout shows how the active server is configured: its invocation
+// semantics, version, uptime and limits.
+func (c *ClientState) handleAbout(reader *bufio.Reader) {
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:    common.OpGetServerInfo,
+		RequestID: c.GetNextRequestID(),
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Println(reply.Data)
+		return
+	}
+	info, err := common.ParseServerInfo(reply.Data)
+	if err != nil {
+		fmt.Printf("Error: malformed server info: %v\n", err)
+		return
+	}
+
+	allowed := "none"
+	if len(info.AllowedSemantics) > 0 {
+		allowed = strings.Join(info.AllowedSemantics, ", ")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Server\t%s\n", c.ActiveServer())
+	fmt.Fprintf(w, "Semantics\t%s (others allowed per request: %s)\n", info.Semantics, allowed)
+	fmt.Fprintf(w, "Role\t%s\n", info.Role)
+	fmt.Fprintf(w, "Version\t%s, protocol %d\n", info.ServerVersion, info.ProtocolVersion)
+	fmt.Fprintf(w, "Started\t%s (up %v)\n", info.Started.Local().Format(time.DateTime), info.Uptime)
+	fmt.Fprintf(w, "Facilities\t%d\n", info.Facilities)
+	if info.Namespaces > 1 {
+		fmt.Fprintf(w, "Namespaces\t%d\n", info.Namespaces)
+	}
+	fmt.Fprintf(w, "History TTL\t%s\n", limitDuration(info.HistoryTTL, "forever"))
+	fmt.Fprintf(w, "Max request size\t%d bytes\n", info.MaxRequestSize)
+	fmt.Fprintf(w, "Max monitor period\t%v\n", info.MaxMonitorPeriod)
+	fmt.Fprintf(w, "Timestamp window\t%s\n", limitDuration(info.MaxSkew, "off"))
+	fmt.Fprintf(w, "Max in flight\t%s\n", limitCount(info.MaxInFlight))
+	fmt.Fprintf(w, "Max lock queue\t%s\n", limitCount(info.MaxLockQueue))
+	fmt.Fprintf(w, "Busy retry after\t%v\n", info.BusyRetryAfter)
+	if info.AbuseThreshold > 0 {
+		fmt.Fprintf(w, "Abuse blocking\tafter %d malformed packets in %v\n", info.AbuseThreshold, info.AbuseWindow)
+	} else {
+		fmt.Fprintln(w, "Abuse blocking\toff")
+	}
+	fmt.Fprintf(w, "Session idle\t%s\n", limitDuration(info.SessionIdle, "never expires"))
+	w.Flush()
+}
+
+// limitDuration shows a duration limit, or what 0 means for it.
+func limitDuration(d time.Duration, zero string) string {
+	if d == 0 {
+		return zero
+	}
+	return d.String()
+}
+
+// limitCount shows a count limit, where 0 means unlimited.
+func limitCount(n int) string {
+	if n == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(n)
+}
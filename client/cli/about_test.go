@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestAbout(t *testing.T) {
+	info := common.ServerInfo{
+		Semantics:        "at-least-once",
+		AllowedSemantics: []string{"at-most-once"},
+		Role:             "primary",
+		Started:          time.Now().Add(-time.Hour),
+		Uptime:           time.Hour,
+		ProtocolVersion:  common.ProtocolVersion,
+		ServerVersion:    "v1.2",
+		Facilities:       5,
+		Namespaces:       1,
+		MaxRequestSize:   2048,
+		MaxMonitorPeriod: time.Hour,
+		MaxInFlight:      64,
+		BusyRetryAfter:   time.Second,
+		AbuseThreshold:   5,
+		AbuseWindow:      time.Minute,
+	}
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return okReply(req, common.FormatServerInfo(info))
+	})
+	c := newTestClient(t, srv.Addr())
+
+	out := runLine(t, c, "about", "")
+	for _, want := range []string{
+		"at-least-once (others allowed per request: at-most-once)",
+		"v1.2, protocol 1",
+		"(up 1h0m0s)",
+		"History TTL         forever",
+		"Timestamp window    off",
+		"Max in flight       64",
+		"Max lock queue      unlimited",
+		"after 5 malformed packets in 1m0s",
+		"Session idle        never expires",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("about lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Namespaces") {
+		t.Errorf("a single namespace is listed:\n%s", out)
+	}
+	if got := srv.received(); len(got) != 1 || got[0].OpCode != common.OpGetServerInfo {
+		t.Errorf("server saw %+v", got)
+	}
+}
+
+func TestAboutMalformed(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return okReply(req, "semantics")
+	})
+	c := newTestClient(t, srv.Addr())
+	if out := runLine(t, c, "about", ""); !strings.Contains(out, "Error: malformed server info") {
+		t.Errorf("about printed:\n%s", out)
+	}
+}
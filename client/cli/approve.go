@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleApproveBooking decides on a booking pending approval: approving it
+// makes it an ordinary booking, rejecting it frees its time. The server
+// only accepts either from the admin.
+func (c *ClientState) handleApproveBooking(reader *bufio.Reader) {
+	fmt.Print("Enter confirmation ID: ")
+	confID, _ := reader.ReadString('\n')
+	confID = strings.TrimSpace(confID)
+
+	fmt.Print("Approve or reject it? (approve/reject): ")
+	action, _ := reader.ReadString('\n')
+	action = strings.ToLower(strings.TrimSpace(action))
+
+	req := common.RequestMessage{
+		RequestID:      c.GetNextRequestID(),
+		ConfirmationID: confID,
+	}
+	switch action {
+	case "approve":
+		req.OpCode = common.OpApproveBooking
+	case "reject":
+		fmt.Print("Reason (optional): ")
+		reason, _ := reader.ReadString('\n')
+		req.OpCode = common.OpRejectBooking
+		req.Reason = strings.TrimSpace(reason)
+	default:
+		fmt.Printf("Error: %q is not approve or reject\n", action)
+		return
+	}
+
+	reply, err := c.SendRequest(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Printf("\nFailed to %s the booking!\n", action)
+	}
+	fmt.Println(reply.Data)
+}
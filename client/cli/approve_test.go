@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestApproveCommand(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.ConfirmationID == "BKG-1" {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusInvalidArgument,
+				Data: "Booking BKG-1 is not pending approval"}
+		}
+		return okReply(req, "done")
+	})
+	c := newTestClient(t, srv.Addr())
+
+	runLine(t, c, "approve", "BKG-7\nApprove\n")
+	runLine(t, c, "approve", "BKG-8\nreject\n exam week \n")
+	got := srv.received()
+	if len(got) != 2 || got[0].OpCode != common.OpApproveBooking || got[0].ConfirmationID != "BKG-7" {
+		t.Fatalf("approve sent %+v", got)
+	}
+	if got[1].OpCode != common.OpRejectBooking || got[1].ConfirmationID != "BKG-8" || got[1].Reason != "exam week" {
+		t.Errorf("reject sent %+v", got[1])
+	}
+
+	if out := runLine(t, c, "approve", "BKG-9\nmaybe\n"); !strings.Contains(out, `"maybe" is not approve or reject`) || len(srv.received()) != 2 {
+		t.Errorf("unknown action printed:\n%s", out)
+	}
+	if out := runLine(t, c, "approve", "BKG-1\napprove\n"); !strings.Contains(out, "Failed to approve the booking!") {
+		t.Errorf("refused approval printed:\n%s", out)
+	}
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func withSecurity(sec common.PacketSecurity) func(*fakeServer) {
+	return func(f *fakeServer) { f.security = sec }
+}
+
+func withMangle(mangle func([]byte) []byte) func(*fakeServer) {
+	return func(f *fakeServer) { f.mangle = mangle }
+}
+
+// stripMAC turns a signed packet back into an unauthenticated one.
+func stripMAC(p []byte) []byte {
+	p = common.StripMAC(p)
+	p[common.MagicSize+9] &^= common.FlagAuthenticated // the flags byte
+	return p
+}
+
+func TestAuthenticatedExchange(t *testing.T) {
+	sec := common.PacketSecurity{Key: []byte("shared-secret")}
+	srv := newFakeServer(t, echoHandler, withSecurity(sec))
+	c := newTestClient(t, srv.Addr())
+	c.Security = sec
+
+	rep, err := query(c, "RoomA")
+	if err != nil || rep.Status != common.StatusOK {
+		t.Fatalf("query: %v, %+v", err, rep)
+	}
+	if len(srv.received()) != 1 {
+		t.Errorf("server accepted %d requests, want 1", len(srv.received()))
+	}
+}
+
+func TestRequestsWithoutTheKeyAreDropped(t *testing.T) {
+	srv := newFakeServer(t, echoHandler, withSecurity(common.PacketSecurity{Key: []byte("shared-secret")}))
+	c := newTestClient(t, srv.Addr())
+	c.Security = common.PacketSecurity{Key: []byte("guess")}
+
+	if _, err := query(c, "RoomA"); !errors.Is(err, errNoReply) {
+		t.Fatalf("err = %v, want errNoReply", err)
+	}
+	if len(srv.received()) != 0 {
+		t.Errorf("server accepted %d requests signed with the wrong key", len(srv.received()))
+	}
+}
+
+func TestTamperedReplyIsDropped(t *testing.T) {
+	sec := common.PacketSecurity{Key: []byte("shared-secret")}
+	srv := newFakeServer(t, echoHandler, withSecurity(sec), withMangle(func(p []byte) []byte {
+		p[len(p)-common.MACSize-1] ^= 0x01
+		return p
+	}))
+	c := newTestClient(t, srv.Addr())
+	c.Security = sec
+
+	if _, err := query(c, "RoomA"); !errors.Is(err, errNoReply) {
+		t.Fatalf("err = %v, want errNoReply", err)
+	}
+	// Every attempt was answered, and every answer dropped
+	if n := len(srv.received()); n != c.Retries {
+		t.Errorf("server saw %d attempts, want %d", n, c.Retries)
+	}
+}
+
+func TestReplyWithoutMAC(t *testing.T) {
+	sec := common.PacketSecurity{Key: []byte("shared-secret")}
+	srv := newFakeServer(t, echoHandler, withSecurity(sec), withMangle(stripMAC))
+	c := newTestClient(t, srv.Addr())
+	c.Security = sec
+
+	if _, err := query(c, "RoomA"); !errors.Is(err, common.ErrMissingMAC) {
+		t.Fatalf("err = %v, want ErrMissingMAC", err)
+	}
+}
+
+func TestAuthRequiredReplyIsShown(t *testing.T) {
+	sec := common.PacketSecurity{Key: []byte("shared-secret")}
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return &common.ReplyMessage{
+			RequestID: req.RequestID,
+			OpCode:    req.OpCode,
+			Status:    common.StatusAuthRequired,
+			Data:      "Server requires encryption; start the client with -encrypt",
+		}
+	}, withSecurity(sec), withMangle(stripMAC))
+	c := newTestClient(t, srv.Addr())
+	c.Security = sec
+
+	rep, err := query(c, "RoomA")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if rep.Status != common.StatusAuthRequired || !strings.Contains(rep.Data, "-encrypt") {
+		t.Errorf("got status %d %q, want the server's plaintext explanation", rep.Status, rep.Data)
+	}
+}
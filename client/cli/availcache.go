@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// availabilityTTL is how long a cached query result is trusted for the
+// conflict pre-check. Callbacks and this client's own changes invalidate
+// entries sooner; the limit covers changes by clients nobody monitors.
+const availabilityTTL = 5 * time.Minute
+
+// cachedAvailability is what the last query of one facility showed.
+type cachedAvailability struct {
+	fetched  time.Time
+	days     []uint8 // days the query covered; others are unknown
+	occupied []common.Occupied
+}
+
+// availabilityCache keeps the last query result per facility, so a booking
+// that visibly conflicts can be flagged before it is sent. The menu
+// goroutine fills it; the monitor goroutine invalidates it on callbacks.
+// Entries are keyed by validate.FacilityKey, as the server matches names.
+type availabilityCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAvailability
+}
+
+// store records the bookings and closures a query returned for days.
+func (a *availabilityCache) store(facility string, days []uint8, occupied []common.Occupied, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.entries == nil {
+		a.entries = make(map[string]cachedAvailability)
+	}
+	a.entries[validate.FacilityKey(facility)] = cachedAvailability{fetched: now, days: days, occupied: occupied}
+}
+
+// forget drops the entry of facility, or every entry if facility is empty.
+func (a *availabilityCache) forget(facility string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if facility == "" {
+		a.entries = nil
+		return
+	}
+	delete(a.entries, validate.FacilityKey(facility))
+}
+
+// conflict returns the first cached entry that overlaps window, and how old
+// the data is. It finds nothing unless every day the window touches was
+// queried, and drops entries older than availabilityTTL.
+func (a *availabilityCache) conflict(facility string, window schedule.Interval, now time.Time) (common.Occupied, time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := validate.FacilityKey(facility)
+	entry, ok := a.entries[key]
+	if !ok {
+		return common.Occupied{}, 0, false
+	}
+	age := now.Sub(entry.fetched)
+	if age > availabilityTTL {
+		delete(a.entries, key)
+		return common.Occupied{}, 0, false
+	}
+	for d := uint8(0); d < 7; d++ {
+		if window.Overlaps(schedule.Day(d)) && !containsDay(entry.days, d) {
+			return common.Occupied{}, 0, false
+		}
+	}
+	for _, o := range entry.occupied {
+		if o.Interval.Overlaps(window) {
+			return o, age, true
+		}
+	}
+	return common.Occupied{}, 0, false
+}
+
+func containsDay(days []uint8, d uint8) bool {
+	for _, x := range days {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheQueryResult remembers the bookings a single-facility query reply
+// listed. Replies from servers that do not list them leave the cache alone.
+func (c *ClientState) cacheQueryResult(req common.RequestMessage, reply *common.ReplyMessage) {
+	if reply.Status != common.StatusOK || len(req.MoreFacilities) > 0 {
+		return
+	}
+	occupied, ok, err := common.OccupiedOf(*reply)
+	if !ok || err != nil {
+		return
+	}
+	c.availability.store(req.FacilityName, req.DaysList, occupied, time.Now())
+}
+
+// confirmDespiteCache warns when the cached availability of facility shows
+// a conflict with window and asks whether to send anyway. The cache may be
+// stale, so the answer defaults to sending and only the server decides.
+func (c *ClientState) confirmDespiteCache(reader *bufio.Reader, facility string, window schedule.Interval) bool {
+	o, age, ok := c.availability.conflict(facility, window, time.Now())
+	if !ok {
+		return true
+	}
+	with := common.EscapeText(o.ID)
+	if with == "" {
+		with = "a closed or fully booked period"
+	}
+	fmt.Printf("Cached data from %v ago shows a conflict with %s - send anyway? (Y/n): ",
+		age.Round(time.Second), with)
+	answer, _ := reader.ReadString('\n')
+	return !strings.EqualFold(strings.TrimSpace(answer), "n")
+}
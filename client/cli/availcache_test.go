@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// availServer lists BKG-123, Monday 09:00-10:00, in every query reply and
+// accepts every booking.
+func availServer(t *testing.T) *fakeServer {
+	return newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.OpCode != common.OpQueryAvailability {
+			return okReply(req, "Booked. ID=BKG-9")
+		}
+		rep := okReply(req, "Facility RoomA availability:\n")
+		raw, _ := common.AppendOccupied(nil, []common.Occupied{{ID: "BKG-123", Interval: schedule.Span(0, 9, 0, 0, 10, 0)}})
+		rep.Extensions.Put(common.ExtOccupied, raw)
+		return rep
+	})
+}
+
+// books returns the booking requests srv received.
+func books(srv *fakeServer) []common.RequestMessage {
+	var got []common.RequestMessage
+	for _, req := range srv.received() {
+		if req.OpCode == common.OpBookFacility {
+			got = append(got, req)
+		}
+	}
+	return got
+}
+
+func TestConflictWarning(t *testing.T) {
+	srv := availServer(t)
+	c := newTestClient(t, srv.Addr())
+	runLine(t, c, "query", "RoomA\n1\nMon\n\n")
+
+	out := runLine(t, c, "book", "rooma\nMon 09:30-10:30\nn\n")
+	if !strings.Contains(out, "shows a conflict with BKG-123 - send anyway?") || !strings.Contains(out, "Not sent.") {
+		t.Errorf("declined conflict printed:\n%s", out)
+	}
+	if n := len(books(srv)); n != 0 {
+		t.Fatalf("declined booking sent %d requests", n)
+	}
+
+	// No warning where the cache shows no conflict, or does not know
+	for _, window := range []string{"Mon 10:00-11:00", "Tue 09:30-10:30"} {
+		if out := runLine(t, c, "book", "RoomA\n"+window+"\n"); strings.Contains(out, "conflict") {
+			t.Errorf("%s warned:\n%s", window, out)
+		}
+	}
+	if n := len(books(srv)); n != 2 {
+		t.Fatalf("%d bookings sent, want 2", n)
+	}
+
+	// The warning never blocks: the default answer sends, and the
+	// successful booking makes the cached view stale
+	runLine(t, c, "query", "RoomA\n1\nMon\n\n")
+	out = runLine(t, c, "book", "RoomA\nMon 09:30-10:30\n\n")
+	if !strings.Contains(out, "conflict") || len(books(srv)) != 3 {
+		t.Errorf("accepted conflict: %d bookings sent, printed:\n%s", len(books(srv)), out)
+	}
+	if out := runLine(t, c, "book", "RoomA\nMon 09:30-10:30\n"); strings.Contains(out, "conflict") {
+		t.Errorf("warned from data older than the last booking:\n%s", out)
+	}
+}
+
+func TestConflictCacheStaleness(t *testing.T) {
+	var a availabilityCache
+	now := time.Now()
+	a.store("RoomA", []uint8{0}, []common.Occupied{{ID: "BKG-1", Interval: schedule.Span(0, 9, 0, 0, 10, 0)}}, now)
+	window := schedule.Span(0, 9, 30, 0, 10, 30)
+
+	if o, age, ok := a.conflict("ROOMA", window, now.Add(40*time.Second)); !ok || o.ID != "BKG-1" || age != 40*time.Second {
+		t.Errorf("conflict 40s later = %+v, %v, %v", o, age, ok)
+	}
+	if _, _, ok := a.conflict("RoomA", window, now.Add(availabilityTTL+time.Second)); ok {
+		t.Error("conflict found in data older than the TTL")
+	}
+	if len(a.entries) != 0 {
+		t.Error("expired entry kept")
+	}
+}
+
+// TestCallbackInvalidatesCache: a callback for a facility drops what its
+// last query showed, whatever the case of its name.
+func TestCallbackInvalidatesCache(t *testing.T) {
+	c := &ClientState{}
+	window := schedule.Span(0, 9, 30, 0, 10, 30)
+	for _, facility := range []string{"RoomA", "Lab1"} {
+		c.availability.store(facility, []uint8{0}, []common.Occupied{{ID: "BKG-1", Interval: schedule.Span(0, 9, 0, 0, 10, 0)}}, time.Now())
+	}
+	captureStdout(t, func() { c.handleMonitorPacket(seqCallback("rooma", 1)) })
+	if _, _, ok := c.availability.conflict("RoomA", window, time.Now()); ok {
+		t.Error("RoomA still cached after its callback")
+	}
+	if _, _, ok := c.availability.conflict("Lab1", window, time.Now()); !ok {
+		t.Error("a callback for RoomA dropped Lab1")
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// SendBatch sends several requests in one OpBatch datagram and returns one
+// reply per request, in order. Requests without a RequestID get the next
+// one. The envelope is retried, stale-timestamp corrected and re-logged-in
+// like any single request; the server deduplicates each entry by its own
+// RequestID, so a retransmitted batch does not repeat at-most-once work.
+// Entries fail individually: check each reply's Status. Servers that did
+// not advertise CapBatch in the handshake get the requests one by one.
+func (c *ClientState) SendBatch(reqs []common.RequestMessage) ([]common.ReplyMessage, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	if len(reqs) > common.MaxBatchEntries {
+		return nil, fmt.Errorf("batch of %d requests exceeds the limit of %d", len(reqs), common.MaxBatchEntries)
+	}
+	batch := make([]common.RequestMessage, len(reqs))
+	for i, r := range reqs {
+		if r.RequestID == 0 {
+			r.RequestID = c.GetNextRequestID()
+		}
+		if r.Namespace == "" {
+			r.Namespace = c.Namespace
+		}
+		batch[i] = r
+	}
+
+	// Servers without OpBatch get the entries one at a time
+	if c.negotiate(); !c.serverSupports(common.CapBatch) {
+		replies := make([]common.ReplyMessage, 0, len(batch))
+		for _, r := range batch {
+			reply, err := c.SendRequest(r)
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, *reply)
+		}
+		return replies, nil
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:    common.OpBatch,
+		RequestID: c.GetNextRequestID(),
+		Batch:     batch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Status != common.StatusOK {
+		return nil, fmt.Errorf("batch rejected: %s", reply.Data)
+	}
+	if len(reply.Replies) != len(batch) {
+		return nil, fmt.Errorf("batch reply has %d entries, expected %d", len(reply.Replies), len(batch))
+	}
+	return reply.Replies, nil
+}
+
+// addParticipants adds a comma-separated list of participants to a booking
+// in one batch.
+func (c *ClientState) addParticipants(confirmationID, list string) {
+	var names []string
+	reqs := make([]common.RequestMessage, 0)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		names = append(names, name)
+		reqs = append(reqs, common.RequestMessage{
+			OpCode:          common.OpAddParticipant,
+			ConfirmationID:  confirmationID,
+			ParticipantName: name,
+		})
+	}
+	replies, err := c.SendBatch(reqs)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println()
+	for i, reply := range replies {
+		if reply.Status == common.StatusOK {
+			fmt.Printf("%s: added\n", names[i])
+		} else {
+			fmt.Printf("%s: failed: %s\n", names[i], reply.Data)
+		}
+	}
+}
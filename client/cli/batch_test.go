@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// batchHandler answers an OpBatch with one reply per entry, failing the
+// entries for BKG-0, and any other request on its own.
+func batchHandler(req common.RequestMessage) *common.ReplyMessage {
+	answer := func(r common.RequestMessage) common.ReplyMessage {
+		if r.ConfirmationID == "BKG-0" {
+			return common.ReplyMessage{RequestID: r.RequestID, OpCode: r.OpCode, Status: common.StatusError, Data: "not found"}
+		}
+		return *okReply(r, r.ParticipantName)
+	}
+	if req.OpCode != common.OpBatch {
+		rep := answer(req)
+		return &rep
+	}
+	rep := okReply(req, "")
+	for _, e := range req.Batch {
+		rep.Replies = append(rep.Replies, answer(e))
+	}
+	return rep
+}
+
+func participantReqs(names ...string) []common.RequestMessage {
+	reqs := make([]common.RequestMessage, len(names))
+	for i, name := range names {
+		reqs[i] = common.RequestMessage{OpCode: common.OpAddParticipant, ConfirmationID: "BKG-1", ParticipantName: name}
+	}
+	return reqs
+}
+
+func TestSendBatch(t *testing.T) {
+	srv := newFakeServer(t, batchHandler)
+	c := newTestClient(t, srv.Addr())
+
+	reqs := participantReqs("Ada", "Bob", "Grace")
+	reqs[1].ConfirmationID = "BKG-0"
+	replies, err := c.SendBatch(reqs)
+	if err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+	got := srv.received()
+	if len(got) != 1 || got[0].OpCode != common.OpBatch || len(got[0].Batch) != 3 {
+		t.Fatalf("server saw %+v, want one batch of 3", got)
+	}
+	ids := make(map[uint64]bool)
+	for i, e := range got[0].Batch {
+		if e.RequestID == 0 || ids[e.RequestID] || e.RequestID == got[0].RequestID {
+			t.Errorf("entry %d has RequestID %d, want a fresh one", i, e.RequestID)
+		}
+		ids[e.RequestID] = true
+	}
+	if len(replies) != 3 {
+		t.Fatalf("%d replies, want 3", len(replies))
+	}
+	for i, want := range []int32{common.StatusOK, common.StatusError, common.StatusOK} {
+		if replies[i].Status != want || replies[i].RequestID != got[0].Batch[i].RequestID {
+			t.Errorf("reply %d = %+v, want status %d for entry %d", i, replies[i], want, got[0].Batch[i].RequestID)
+		}
+	}
+}
+
+func TestSendBatchRetriesKeepIDs(t *testing.T) {
+	var dropped atomic.Bool
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if dropped.CompareAndSwap(false, true) {
+			return nil
+		}
+		return batchHandler(req)
+	})
+	c := newTestClient(t, srv.Addr())
+	if _, err := c.SendBatch(participantReqs("Ada", "Grace")); err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+	got := srv.received()
+	if len(got) != 2 {
+		t.Fatalf("server saw %d envelopes, want the lost one and its retry", len(got))
+	}
+	for i := range got[0].Batch {
+		if got[1].Batch[i].RequestID != got[0].Batch[i].RequestID {
+			t.Errorf("entry %d resent with RequestID %d, want %d", i, got[1].Batch[i].RequestID, got[0].Batch[i].RequestID)
+		}
+	}
+}
+
+// TestSendBatchWithoutCapability checks a server that doesn't advertise
+// batches gets the entries one by one.
+func TestSendBatchWithoutCapability(t *testing.T) {
+	srv := newFakeServer(t, batchHandler, func(f *fakeServer) { f.hello.Capabilities &^= common.CapBatch })
+	c := newTestClient(t, srv.Addr())
+	replies, err := c.SendBatch(participantReqs("Ada", "Grace"))
+	if err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+	got := srv.received()
+	if len(got) != 2 || got[0].OpCode != common.OpAddParticipant || got[1].OpCode != common.OpAddParticipant {
+		t.Fatalf("server saw %+v, want two single requests", got)
+	}
+	if len(replies) != 2 || replies[0].Data != "Ada" || replies[1].Data != "Grace" {
+		t.Errorf("replies = %+v", replies)
+	}
+}
+
+func TestSendBatchLimits(t *testing.T) {
+	srv := newFakeServer(t, batchHandler)
+	c := newTestClient(t, srv.Addr())
+	if replies, err := c.SendBatch(nil); err != nil || replies != nil {
+		t.Errorf("empty batch = %v, %v", replies, err)
+	}
+	if _, err := c.SendBatch(make([]common.RequestMessage, common.MaxBatchEntries+1)); err == nil {
+		t.Error("oversized batch sent")
+	}
+	if n := len(srv.received()); n != 0 {
+		t.Errorf("server saw %d requests", n)
+	}
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// handleAddBlackout closes a facility for a period. The server only accepts
+// it from the admin.
+func (c *ClientState) handleAddBlackout(reader *bufio.Reader) {
+	fmt.Print("Enter facility name: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+	if err := validate.ValidateFacilityName(facilityName); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Print("Enter the closed period, e.g. \"Sat 08:00-12:00\" or \"Fri 18:00 - Sun 20:00\": ")
+	period, _ := reader.ReadString('\n')
+	startDay, startHour, startMin, endDay, endHour, endMin, err := utils.ParseTimeRange(strings.TrimSpace(period))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Print("Enter the reason (empty for maintenance): ")
+	reason, _ := reader.ReadString('\n')
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:       common.OpAddBlackout,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facilityName,
+		StartDay:     startDay,
+		StartHour:    startHour,
+		StartMinute:  startMin,
+		EndDay:       endDay,
+		EndHour:      endHour,
+		EndMinute:    endMin,
+		Reason:       strings.TrimSpace(reason),
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status == common.StatusOK {
+		fmt.Println("\nFacility closed.")
+	} else {
+		fmt.Println("\nFailed to close facility!")
+	}
+	fmt.Println(reply.Data)
+}
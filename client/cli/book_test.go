@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestBookWithDuration checks a booking given a duration builds the same
+// request as one given the equivalent end time.
+func TestBookWithDuration(t *testing.T) {
+	tests := []struct {
+		duration, explicit string
+	}{
+		{"RoomA\nMon 09:00 for 1h30m\n", "RoomA\nMon 09:00-10:30\n"},
+		{"RoomA\nMon 09:00 90m\n", "RoomA\n0 09:00 - 0 10:30\n"},
+		{"RoomA\nTue 23:00 for 2h\n", "RoomA\nTue 23:00 - Wed 01:00\n"},
+		// Step by step, the duration takes the place of the end day
+		{"RoomA\n\nFri\n16\n45\n45m\n", "RoomA\n\nFri\n16\n45\nFri\n17\n30\n"},
+	}
+	for _, tt := range tests {
+		c := &ClientState{NextReqID: 1}
+		got, ok := c.readBookRequest(bufio.NewReader(strings.NewReader(tt.duration)))
+		if !ok {
+			t.Errorf("%q not accepted", tt.duration)
+			continue
+		}
+		want, ok := c.readBookRequest(bufio.NewReader(strings.NewReader(tt.explicit)))
+		if !ok {
+			t.Fatalf("%q not accepted", tt.explicit)
+		}
+		want.RequestID = got.RequestID
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q built %+v, want %+v", tt.duration, got, want)
+		}
+	}
+}
+
+func TestBookWithDurationPastTheWeek(t *testing.T) {
+	c := &ClientState{NextReqID: 1}
+	if req, ok := c.readBookRequest(bufio.NewReader(strings.NewReader("RoomA\n\nSun\n23\n0\n2h\n"))); ok {
+		t.Errorf("booking past Sunday 24:00 built %+v", req)
+	}
+}
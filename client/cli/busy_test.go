@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestBusyRetryAfter: the client resends a refused request only after the
+// wait the server asked for.
+func TestBusyRetryAfter(t *testing.T) {
+	srv := newFakeServer(t, busyOnce())
+	c := newTestClient(t, srv.Addr())
+
+	start := time.Now()
+	rep, err := query(c, "RoomA")
+	if err != nil || rep.Status != common.StatusOK {
+		t.Fatalf("query: %+v, %v", rep, err)
+	}
+	if took := time.Since(start); took < time.Second || took > 2*time.Second {
+		t.Errorf("served after %v, want the 1s retry-after", took)
+	}
+	if got := srv.received(); len(got) != 2 || got[0].RequestID != got[1].RequestID {
+		t.Errorf("server saw %+v, want one resend", got)
+	}
+}
+
+// TestBusyGivesUp: a server that stays busy gets as many attempts as the
+// operation allows, and its last reply is returned.
+func TestBusyGivesUp(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusBusy,
+			Data: common.BusyData(0, "1 requests in flight")}
+	})
+	c := newTestClient(t, srv.Addr())
+	rep, err := query(c, "RoomA")
+	if err != nil || rep.Status != common.StatusBusy {
+		t.Fatalf("query: %+v, %v; want the busy reply", rep, err)
+	}
+	if n := len(srv.received()); n != c.Retries {
+		t.Errorf("%d attempts, want %d", n, c.Retries)
+	}
+}
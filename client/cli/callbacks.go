@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// maxTrackedGap bounds how many lost sequence numbers are remembered per
+// gap; anything older is covered by the availability re-query instead.
+const maxTrackedGap = 64
+
+// callbackTracker follows the callback sequence of each monitored facility
+// so that lost callbacks are noticed. The menu goroutine resets a facility
+// when it registers; the monitor goroutine observes callbacks. Facilities
+// are keyed by validate.FacilityKey, since callbacks carry the server's
+// spelling of the name the user typed.
+type callbackTracker struct {
+	mu      sync.Mutex
+	last    map[string]uint64          // facility key -> highest sequence seen
+	missing map[string]map[uint64]bool // facility key -> sequences known to be lost
+	pending map[uint64]string          // RequestID of a resend or re-query -> facility
+}
+
+// init allocates the maps; the caller holds mu.
+func (t *callbackTracker) init() {
+	if t.last == nil {
+		t.last = make(map[string]uint64)
+		t.missing = make(map[string]map[uint64]bool)
+		t.pending = make(map[uint64]string)
+	}
+}
+
+// reset starts tracking a fresh subscription, whose sequence starts at 1.
+func (t *callbackTracker) reset(facility string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	facility = validate.FacilityKey(facility)
+	t.last[facility] = 0
+	delete(t.missing, facility)
+}
+
+// observe records a callback. show is false for duplicates; gap is set when
+// the callback reveals lost ones, with since the last sequence seen before.
+func (t *callbackTracker) observe(facility string, seq uint64) (show bool, since uint64, gap bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	facility = validate.FacilityKey(facility)
+	if t.missing[facility][seq] {
+		delete(t.missing[facility], seq)
+		return true, 0, false
+	}
+	last := t.last[facility]
+	if seq <= last {
+		return false, 0, false
+	}
+	if seq > last+1 {
+		lost := t.missing[facility]
+		if lost == nil {
+			lost = make(map[uint64]bool)
+			t.missing[facility] = lost
+		}
+		for s := last + 1; s < seq && len(lost) < maxTrackedGap; s++ {
+			lost[s] = true
+		}
+		since, gap = last, true
+	}
+	t.last[facility] = seq
+	return true, since, gap
+}
+
+// rename moves a facility's sequence to its new name, which continues it.
+func (t *callbackTracker) rename(oldName, newName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	oldKey, newKey := validate.FacilityKey(oldName), validate.FacilityKey(newName)
+	last, ok := t.last[oldKey]
+	if !ok {
+		return
+	}
+	delete(t.last, oldKey)
+	t.last[newKey] = last
+	if lost, ok := t.missing[oldKey]; ok {
+		delete(t.missing, oldKey)
+		t.missing[newKey] = lost
+	}
+	for id, facility := range t.pending {
+		if strings.EqualFold(facility, oldName) {
+			t.pending[id] = newName
+		}
+	}
+}
+
+func (t *callbackTracker) expect(requestID uint64, facility string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	t.pending[requestID] = facility
+}
+
+func (t *callbackTracker) done(requestID uint64) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	facility, ok := t.pending[requestID]
+	delete(t.pending, requestID)
+	return facility, ok
+}
+
+// packetKind tells server-initiated callbacks apart from replies.
+type packetKind int
+
+const (
+	packetReply    packetKind = iota // answer to a request, possibly a late one
+	packetCallback                   // monitor callback
+)
+
+// classifyPacket decides by OpCode, never by the reply text.
+func classifyPacket(rep common.ReplyMessage) packetKind {
+	if rep.OpCode == common.OpCallback {
+		return packetCallback
+	}
+	return packetReply
+}
+
+// handleMonitorPacket processes a packet that arrived outside a request: a
+// callback, the answer to a resend or re-query sent after a gap, or a stray
+// reply, which is dropped.
+func (c *ClientState) handleMonitorPacket(rep common.ReplyMessage) {
+	if classifyPacket(rep) == packetReply {
+		facility, ok := c.callbacks.done(rep.RequestID)
+		switch {
+		case !ok:
+			log.Printf("Dropping stray reply %d (%s)", rep.RequestID, common.OpName(rep.OpCode))
+		case rep.OpCode == common.OpResendCallbacks && rep.Status != common.StatusOK:
+			fmt.Printf("\nWarning: %s; fetching current availability of %s.\n", rep.Data, facility)
+			c.requeryFacility(facility)
+		case rep.OpCode == common.OpQueryAvailability:
+			fmt.Printf("\nCurrent availability after missed updates:\n%s\n", rep.Data)
+		}
+		return
+	}
+
+	if common.IsKeepalive(rep) {
+		c.stats.keepalives.Add(1)
+		if c.AnswerKeepalives {
+			c.sendOnce(common.RequestMessage{OpCode: common.OpKeepalive, RequestID: c.GetNextRequestID()})
+		}
+		return
+	}
+
+	// A renamed facility continues its sequence under the new name
+	if oldName, ok := rep.Extensions.String(common.ExtRenamedFrom); ok {
+		if newName, _ := rep.Extensions.String(common.ExtCallbackFacility); newName != "" {
+			c.renameFacility(oldName, newName)
+		}
+	}
+
+	if seq, facility, ok := common.CallbackSeq(rep); ok {
+		show, since, gap := c.callbacks.observe(facility, seq)
+		if gap {
+			fmt.Printf("\nWarning: missed callbacks %d..%d for %s; asking the server to resend.\n",
+				since+1, seq-1, facility)
+			c.requestResend(facility, since)
+		}
+		if !show {
+			return
+		}
+	}
+	c.stats.callbacks.Add(1)
+	// The facility changed, so its cached query result no longer holds
+	facility, _ := rep.Extensions.String(common.ExtCallbackFacility)
+	c.availability.forget(facility)
+	fmt.Printf("\n%s\n", rep.Data)
+	if avail, ok := common.CallbackAvailability(rep); ok {
+		fmt.Println(indent(strings.TrimRight(avail, "\n"), "  "))
+	}
+}
+
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// requestResend asks the server to replay the callbacks after since. It is
+// sent once: if it is lost, the next gap asks again.
+func (c *ClientState) requestResend(facility string, since uint64) {
+	req := common.RequestMessage{
+		OpCode:       common.OpResendCallbacks,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facility,
+		SinceSeq:     since,
+	}
+	c.callbacks.expect(req.RequestID, facility)
+	if err := c.sendOnce(req); err != nil {
+		fmt.Printf("Could not request resend: %v\n", err)
+	}
+}
+
+// requeryFacility fetches the whole week's availability when missed
+// callbacks cannot be resent.
+func (c *ClientState) requeryFacility(facility string) {
+	req := common.RequestMessage{
+		OpCode:       common.OpQueryAvailability,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facility,
+		DaysList:     []uint8{0, 1, 2, 3, 4, 5, 6},
+	}
+	c.callbacks.expect(req.RequestID, facility)
+	if err := c.sendOnce(req); err != nil {
+		fmt.Printf("Could not query availability: %v\n", err)
+	}
+}
+
+// sendOnce writes a request without waiting for its reply; the monitor
+// loop picks the reply up with the callbacks.
+func (c *ClientState) sendOnce(req common.RequestMessage) error {
+	req.Timestamp = time.Now().Add(c.clockOffset).UnixMilli()
+	req.SessionToken = c.SessionToken
+	data, err := c.encodeRequest(req)
+	if err != nil {
+		return err
+	}
+	return c.writePacket(data)
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// seqCallback is callback number seq of a subscription to facility.
+func seqCallback(facility string, seq uint64) common.ReplyMessage {
+	cb := common.ReplyMessage{OpCode: common.OpCallback, Status: common.StatusOK, Data: "update"}
+	cb.Extensions.PutUint64(common.ExtCallbackSeq, seq)
+	cb.Extensions.PutString(common.ExtCallbackFacility, facility)
+	return cb
+}
+
+func TestCallbackTracker(t *testing.T) {
+	type step struct {
+		facility string
+		seq      uint64
+		show     bool
+		gap      bool
+		since    uint64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{{"RoomA", 1, true, false, 0}, {"RoomA", 2, true, false, 0}, {"RoomA", 3, true, false, 0}}},
+		{"gap", []step{{"RoomA", 1, true, false, 0}, {"RoomA", 4, true, true, 1}, {"RoomA", 5, true, false, 0}}},
+		{"gap at the start", []step{{"RoomA", 3, true, true, 0}}},
+		{"duplicate", []step{{"RoomA", 1, true, false, 0}, {"RoomA", 1, false, false, 0}}},
+		{"missing one arrives late", []step{{"RoomA", 1, true, false, 0}, {"RoomA", 3, true, true, 1}, {"RoomA", 2, true, false, 0}, {"RoomA", 2, false, false, 0}}},
+		{"facilities apart", []step{{"RoomA", 1, true, false, 0}, {"Lab1", 1, true, false, 0}, {"RoomA", 2, true, false, 0}}},
+		{"case of the name", []step{{"RoomA", 1, true, false, 0}, {"rooma", 2, true, false, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tr callbackTracker
+			for i, s := range tt.steps {
+				show, since, gap := tr.observe(s.facility, s.seq)
+				if show != s.show || gap != s.gap || since != s.since {
+					t.Errorf("step %d: observe(%s, %d) = %v, %d, %v; want %v, %d, %v",
+						i, s.facility, s.seq, show, since, gap, s.show, s.since, s.gap)
+				}
+			}
+		})
+	}
+}
+
+func TestCallbackTrackerReset(t *testing.T) {
+	var tr callbackTracker
+	tr.observe("RoomA", 5)
+	tr.reset("RoomA")
+	if show, _, gap := tr.observe("RoomA", 1); !show || gap {
+		t.Errorf("first callback of a new subscription: show %v, gap %v", show, gap)
+	}
+}
+
+// TestGapTriggersResend feeds the client a callback after a gap: it asks
+// for a resend since the last one it saw, and re-queries the facility when
+// the server can no longer resend.
+func TestGapTriggersResend(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.OpCode == common.OpResendCallbacks {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusError, Data: "no longer buffered"}
+		}
+		return okReply(req, "availability")
+	})
+	c := newTestClient(t, srv.Addr())
+	c.callbacks.reset("RoomA")
+
+	c.handleMonitorPacket(seqCallback("RoomA", 1))
+	c.handleMonitorPacket(seqCallback("RoomA", 2))
+	if n := len(srv.received()); n != 0 {
+		t.Fatalf("server saw %d requests without a gap", n)
+	}
+
+	c.handleMonitorPacket(seqCallback("RoomA", 5))
+	got := waitForRequests(t, srv, 1)
+	if got[0].OpCode != common.OpResendCallbacks || got[0].SinceSeq != 2 || got[0].FacilityName != "RoomA" {
+		t.Fatalf("after the gap the client sent %+v, want a resend since 2", got[0])
+	}
+
+	// The error reply arrives through the monitor loop
+	raw, err := c.readPacket(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("no reply to the resend: %v", err)
+	}
+	rep, err := c.decodeReply(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handleMonitorPacket(rep)
+	got = waitForRequests(t, srv, 2)
+	if got[1].OpCode != common.OpQueryAvailability || got[1].FacilityName != "RoomA" || len(got[1].DaysList) != 7 {
+		t.Errorf("after a failed resend the client sent %+v, want a week query", got[1])
+	}
+}
+
+// waitForRequests waits until the fake server has seen n requests.
+func waitForRequests(t *testing.T, srv *fakeServer, n int) []common.RequestMessage {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := srv.received()
+		if len(got) >= n {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server saw %d requests, want %d", len(got), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestDuplicateCallbacksShownOnce plays a server started with
+// -dupCallbackRate=1: every callback arrives twice, yet each change is
+// shown once and no resend is asked for.
+func TestDuplicateCallbacksShownOnce(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	reader, _ := monitorInput(t)
+	if _, err := query(c, "RoomA"); err != nil { // the server learns where the client is
+		t.Fatalf("query: %v", err)
+	}
+
+	c.startMonitor("RoomA", 200*time.Millisecond)
+	for seq := uint64(1); seq <= 3; seq++ {
+		srv.callback(seqCallback("RoomA", seq))
+		srv.callback(seqCallback("RoomA", seq))
+	}
+	select {
+	case <-runMonitor(c, reader):
+	case <-time.After(2 * time.Second):
+		t.Fatal("monitor mode did not end at expiry")
+	}
+	if n := c.stats.callbacks.Load(); n != 3 {
+		t.Errorf("%d callbacks shown, want one per change", n)
+	}
+	if n := len(srv.received()); n != 1 {
+		t.Errorf("server saw %d requests, want only the query", n)
+	}
+}
+
+// TestCallbackAvailabilityShown: embedded availability is printed indented
+// beneath the event line.
+func TestCallbackAvailabilityShown(t *testing.T) {
+	c := &ClientState{}
+	cb := seqCallback("RoomA", 1)
+	cb.Data = "Facility=RoomA updated: New booking created: BKG-1"
+	cb.Extensions.PutString(common.ExtCallbackAvail, "Facility RoomA availability:\nThursday:\n\n")
+	out := captureStdout(t, func() { c.handleMonitorPacket(cb) })
+	want := "\nFacility=RoomA updated: New booking created: BKG-1\n  Facility RoomA availability:\n  Thursday:\n"
+	if out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+
+	plain := seqCallback("RoomA", 2)
+	if out := captureStdout(t, func() { c.handleMonitorPacket(plain) }); out != "\nupdate\n" {
+		t.Errorf("callback without availability printed %q", out)
+	}
+}
+
+// TestKeepaliveCallbacks: keepalives are counted apart from callbacks,
+// never shown, and answered only when asked to.
+func TestKeepaliveCallbacks(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	keepalive := common.ReplyMessage{OpCode: common.OpCallback, Status: common.StatusOK}
+	keepalive.Extensions.Put(common.ExtCallbackEvent, []byte{common.EventKeepalive})
+
+	if out := captureStdout(t, func() { c.handleMonitorPacket(keepalive) }); out != "" {
+		t.Errorf("keepalive printed %q", out)
+	}
+	c.AnswerKeepalives = true
+	c.handleMonitorPacket(keepalive)
+	if got := waitForRequests(t, srv, 1); got[0].OpCode != common.OpKeepalive {
+		t.Errorf("answered with %s", common.OpName(got[0].OpCode))
+	}
+	if n := c.stats.keepalives.Load(); n != 2 {
+		t.Errorf("%d keepalives counted, want 2", n)
+	}
+	if n := c.stats.callbacks.Load(); n != 0 {
+		t.Errorf("keepalives counted as %d callbacks", n)
+	}
+	if n := len(srv.received()); n != 1 {
+		t.Errorf("server saw %d requests, want one answer", n)
+	}
+}
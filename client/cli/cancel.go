@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// cancelAllMine selects every booking made in this session for cancelBookings.
+const cancelAllMine = "mine"
+
+// lastBooking is the undo slot: the most recent successful booking.
+type lastBooking struct {
+	ID      string
+	Details string // the server's reply when it was booked or last changed
+}
+
+// rememberBooking records a booking made in this session so that it can be
+// cancelled with "mine", and makes it the one undo cancels.
+func (c *ClientState) rememberBooking(confirmationID, details string) {
+	if confirmationID == "" {
+		return
+	}
+	if c.myBookings == nil {
+		c.myBookings = make(map[string]bool)
+	}
+	c.myBookings[confirmationID] = true
+	c.lastBooking = lastBooking{ID: confirmationID, Details: details}
+}
+
+// forgetBooking drops a cancelled booking from this session's bookings and
+// empties the undo slot if it held it.
+func (c *ClientState) forgetBooking(confirmationID string) {
+	delete(c.myBookings, confirmationID)
+	if c.lastBooking.ID == confirmationID {
+		c.lastBooking = lastBooking{}
+	}
+}
+
+// cancelSelection turns the cancel prompt's answer into confirmation IDs: a
+// comma-separated list, or "mine" for this session's bookings.
+func (c *ClientState) cancelSelection(input string) []string {
+	ids := make([]string, 0)
+	if strings.EqualFold(strings.TrimSpace(input), cancelAllMine) {
+		for id := range c.myBookings {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	for _, id := range strings.Split(input, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// cancelOutcome is the result of cancelling one booking.
+type cancelOutcome int
+
+const (
+	cancelDone     cancelOutcome = iota
+	cancelNotFound               // already cancelled, or never existed
+	cancelFailed
+)
+
+// classifyCancel reads a cancel reply. The server answers StatusOK for an
+// unknown ID so that a retransmitted cancel is harmless; its text tells the
+// two cases apart.
+func classifyCancel(reply common.ReplyMessage) cancelOutcome {
+	switch {
+	case reply.Status != common.StatusOK:
+		return cancelFailed
+	case strings.Contains(reply.Data, "not found"):
+		return cancelNotFound
+	default:
+		return cancelDone
+	}
+}
+
+// cancelBookings cancels bookings one after another. Unknown IDs and
+// failures do not stop the run; a summary is printed at the end.
+func (c *ClientState) cancelBookings(ids []string) {
+	var done, notFound, failed []string
+	for _, id := range ids {
+		reply, err := c.SendRequest(common.RequestMessage{
+			OpCode:         common.OpCancelBooking,
+			RequestID:      c.GetNextRequestID(),
+			ConfirmationID: id,
+		})
+		if err != nil {
+			fmt.Printf("%s: %v\n", id, err)
+			failed = append(failed, id)
+			continue
+		}
+		switch classifyCancel(*reply) {
+		case cancelDone:
+			done = append(done, id)
+			c.forgetBooking(id)
+		case cancelNotFound:
+			notFound = append(notFound, id)
+			c.forgetBooking(id)
+		default:
+			fmt.Printf("%s: %s\n", id, reply.Data)
+			failed = append(failed, id)
+		}
+	}
+
+	fmt.Printf("\nCanceled %d of %d bookings.\n", len(done), len(ids))
+	if len(notFound) > 0 {
+		fmt.Printf("Not found (already canceled?): %s\n", strings.Join(notFound, ", "))
+	}
+	if len(failed) > 0 {
+		fmt.Printf("Failed: %s\n", strings.Join(failed, ", "))
+	}
+}
+
+// handleUndo cancels the last booking made in this session after asking for
+// confirmation. The undo slot is emptied whether the booking was cancelled
+// now or was already gone from the server.
+func (c *ClientState) handleUndo(reader *bufio.Reader) {
+	last := c.lastBooking
+	if last.ID == "" {
+		fmt.Println("Nothing to undo.")
+		return
+	}
+	fmt.Printf("Last booking: %s\n", last.Details)
+	fmt.Printf("Cancel booking %s? (y/N): ", last.ID)
+	answer, _ := reader.ReadString('\n')
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		fmt.Println("Kept.")
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:         common.OpCancelBooking,
+		RequestID:      c.GetNextRequestID(),
+		ConfirmationID: last.ID,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	switch classifyCancel(*reply) {
+	case cancelDone:
+		c.forgetBooking(last.ID)
+		fmt.Printf("\nUndone: %s\n", reply.Data)
+	case cancelNotFound:
+		c.forgetBooking(last.ID)
+		fmt.Printf("\nBooking %s no longer exists on the server; nothing to undo.\n", last.ID)
+	default:
+		fmt.Printf("\nCould not undo: %s\n", reply.Data)
+	}
+}
+
+// retryForced handles a cancel or change refused because the booking has
+// already started: if the user agrees, it sends the request again with the
+// force flag, which the server honours only for the admin. It returns the
+// reply to display.
+func (c *ClientState) retryForced(reader *bufio.Reader, req common.RequestMessage, reply *common.ReplyMessage) (*common.ReplyMessage, error) {
+	if reply.Status != common.StatusInProgress && reply.Status != common.StatusBookingOver {
+		return reply, nil
+	}
+	fmt.Print("The booking has already started. Force it anyway? Only the admin may (y/N): ")
+	answer, _ := reader.ReadString('\n')
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		return reply, nil
+	}
+	req.RequestID = c.GetNextRequestID()
+	req.Force = true
+	return c.SendRequest(req)
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = saved }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// cancelServer answers cancels like the server does: StatusOK both for a
+// booking it removes and for an unknown one, and StatusInProgress for
+// BKG-STARTED.
+func cancelServer(t *testing.T, bookings ...string) *fakeServer {
+	var mu sync.Mutex
+	live := make(map[string]bool)
+	for _, id := range bookings {
+		live[id] = true
+	}
+	return newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case req.ConfirmationID == "BKG-STARTED":
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusInProgress,
+				Data: "Booking BKG-STARTED is in progress"}
+		case live[req.ConfirmationID]:
+			delete(live, req.ConfirmationID)
+			return okReply(req, "Booking "+req.ConfirmationID+" canceled.")
+		default:
+			return okReply(req, "Booking "+req.ConfirmationID+" not found (already canceled?)")
+		}
+	})
+}
+
+func TestCancelSelection(t *testing.T) {
+	c := &ClientState{}
+	c.rememberBooking("BKG-2", "")
+	c.rememberBooking("BKG-1", "")
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"BKG-1", []string{"BKG-1"}},
+		{" BKG-1 , ,BKG-9 ", []string{"BKG-1", "BKG-9"}},
+		{"Mine", []string{"BKG-1", "BKG-2"}},
+	}
+	for _, tt := range tests {
+		if got := c.cancelSelection(tt.in); strings.Join(got, ",") != strings.Join(tt.want, ",") || got == nil {
+			t.Errorf("cancelSelection(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCancelBookingsMixed(t *testing.T) {
+	srv := cancelServer(t, "BKG-1", "BKG-3")
+	c := newTestClient(t, srv.Addr())
+	for _, id := range []string{"BKG-1", "BKG-2", "BKG-3"} {
+		c.rememberBooking(id, "")
+	}
+	c.rememberBooking("BKG-STARTED", "")
+
+	out := captureStdout(t, func() {
+		c.cancelBookings(c.cancelSelection("BKG-1, BKG-2, BKG-STARTED, BKG-3"))
+	})
+	if n := len(srv.received()); n != 4 {
+		t.Errorf("server saw %d cancels, want all 4 despite the failures", n)
+	}
+	for _, want := range []string{
+		"Canceled 2 of 4 bookings.",
+		"Not found (already canceled?): BKG-2\n",
+		"Failed: BKG-STARTED\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary lacks %q:\n%s", want, out)
+		}
+	}
+	// Cancelled and vanished bookings leave the session's list; the one
+	// that could not be cancelled stays
+	if got := c.cancelSelection(cancelAllMine); len(got) != 1 || got[0] != "BKG-STARTED" {
+		t.Errorf("remaining bookings %q, want only BKG-STARTED", got)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	srv := cancelServer(t, "BKG-7")
+	c := newTestClient(t, srv.Addr())
+	c.rememberBooking("BKG-6", "Booked RoomA. ID=BKG-6")
+	c.rememberBooking("BKG-7", "Booked Lab1. ID=BKG-7")
+
+	out := captureStdout(t, func() { c.handleUndo(bufio.NewReader(strings.NewReader("n\n"))) })
+	if !strings.Contains(out, "Booked Lab1. ID=BKG-7") || !strings.Contains(out, "Kept.") {
+		t.Errorf("declined undo printed:\n%s", out)
+	}
+	if n := len(srv.received()); n != 0 || c.lastBooking.ID != "BKG-7" {
+		t.Fatalf("declined undo sent %d requests, slot %q", n, c.lastBooking.ID)
+	}
+
+	out = captureStdout(t, func() { c.handleUndo(bufio.NewReader(strings.NewReader("y\n"))) })
+	got := srv.received()
+	if len(got) != 1 || got[0].OpCode != common.OpCancelBooking || got[0].ConfirmationID != "BKG-7" {
+		t.Fatalf("server saw %+v, want a cancel of BKG-7", got)
+	}
+	if !strings.Contains(out, "Undone") || c.lastBooking.ID != "" || c.myBookings["BKG-7"] {
+		t.Errorf("after undo: slot %q, printed:\n%s", c.lastBooking.ID, out)
+	}
+
+	// Only one step back: the earlier booking is not undone next
+	out = captureStdout(t, func() { c.handleUndo(bufio.NewReader(strings.NewReader("y\n"))) })
+	if !strings.Contains(out, "Nothing to undo.") || len(srv.received()) != 1 {
+		t.Errorf("second undo printed:\n%s", out)
+	}
+}
+
+func TestUndoAlreadyGone(t *testing.T) {
+	srv := cancelServer(t)
+	c := newTestClient(t, srv.Addr())
+	c.rememberBooking("BKG-8", "Booked RoomA. ID=BKG-8")
+
+	out := captureStdout(t, func() { c.handleUndo(bufio.NewReader(strings.NewReader("y\n"))) })
+	if !strings.Contains(out, "BKG-8 no longer exists on the server") {
+		t.Errorf("undo of a vanished booking printed:\n%s", out)
+	}
+	if c.lastBooking.ID != "" || c.myBookings["BKG-8"] {
+		t.Errorf("vanished booking still remembered: slot %q", c.lastBooking.ID)
+	}
+}
+
+// TestCancelClearsUndo: cancelling the last booking by other means empties
+// the undo slot.
+func TestCancelClearsUndo(t *testing.T) {
+	srv := cancelServer(t, "BKG-1", "BKG-2")
+	c := newTestClient(t, srv.Addr())
+	c.rememberBooking("BKG-1", "")
+	c.rememberBooking("BKG-2", "")
+	captureStdout(t, func() { c.cancelBookings([]string{"BKG-1"}) })
+	if c.lastBooking.ID != "BKG-2" {
+		t.Errorf("cancelling another booking emptied the slot")
+	}
+	captureStdout(t, func() { c.cancelBookings([]string{"BKG-2"}) })
+	if c.lastBooking.ID != "" {
+		t.Errorf("slot still holds %q after its cancellation", c.lastBooking.ID)
+	}
+}
+
+// TestRetryForced: a refusal because the booking started is sent again
+// with the force flag only if the user agrees.
+func TestRetryForced(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.Force {
+			return okReply(req, "Canceled booking BKG-1")
+		}
+		return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusInProgress,
+			Data: "Booking BKG-1 is in progress (now Mon 09:30)"}
+	})
+	c := newTestClient(t, srv.Addr())
+	req := common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: c.GetNextRequestID(), ConfirmationID: "BKG-1"}
+	refused, err := c.SendRequest(req)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	for _, answer := range []string{"n\n", "\n"} {
+		var rep *common.ReplyMessage
+		captureStdout(t, func() { rep, err = c.retryForced(bufio.NewReader(strings.NewReader(answer)), req, refused) })
+		if err != nil || rep != refused {
+			t.Errorf("answer %q: reply %+v, %v; want the refusal", answer, rep, err)
+		}
+	}
+	if n := len(srv.received()); n != 1 {
+		t.Fatalf("declined force sent %d requests", n-1)
+	}
+
+	var rep *common.ReplyMessage
+	captureStdout(t, func() { rep, err = c.retryForced(bufio.NewReader(strings.NewReader("y\n")), req, refused) })
+	if err != nil || rep.Status != common.StatusOK {
+		t.Fatalf("forced cancel: %+v, %v", rep, err)
+	}
+	got := srv.received()
+	if len(got) != 2 || !got[1].Force || got[1].RequestID == req.RequestID {
+		t.Errorf("forced resend %+v, want Force under a new RequestID", got[len(got)-1])
+	}
+
+	// Other statuses are passed through without asking
+	ok := okReply(req, "done")
+	if rep, _ := c.retryForced(bufio.NewReader(strings.NewReader("y\n")), req, ok); rep != ok || len(srv.received()) != 2 {
+		t.Error("a successful reply was retried")
+	}
+}
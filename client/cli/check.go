@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleCheck asks the server whether a booking or a change would succeed,
+// without making it. The server runs every check of the real request and
+// names what is in the way, but books and changes nothing.
+func (c *ClientState) handleCheck(reader *bufio.Reader) {
+	fmt.Print("Check a new booking or a change? (book/change) [book]: ")
+	kind, _ := reader.ReadString('\n')
+	kind = strings.ToLower(strings.TrimSpace(kind))
+
+	var read func(*bufio.Reader) (common.RequestMessage, bool)
+	switch kind {
+	case "", "book":
+		read = c.readBookRequest
+	case "change":
+		read = c.readChangeRequest
+	default:
+		fmt.Printf("Error: unknown kind %q. Choose 'book' or 'change'.\n", kind)
+		return
+	}
+	req, ok := read(reader)
+	if !ok {
+		return
+	}
+	req.DryRun = true
+
+	reply, err := c.SendRequest(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status == common.StatusOK {
+		fmt.Println("\nWould succeed:")
+	} else {
+		fmt.Println("\nWould fail:")
+	}
+	fmt.Println(reply.Data)
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestCheck(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.OpCode == common.OpChangeBooking {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusConflict,
+				Data: "Time conflict.\nConflicts with BKG-10001 from Tuesday 14:00 to Tuesday 15:30."}
+		}
+		return okReply(req, "Dry run: booking 'RoomA' from Monday 11:00 to Monday 12:00 would succeed. Nothing was booked.")
+	})
+	c := newTestClient(t, srv.Addr())
+
+	out := runLine(t, c, "check", "\nRoomA\nMon 11:00-12:00\n")
+	if !strings.Contains(out, "Would succeed:\nDry run: booking 'RoomA'") {
+		t.Errorf("book check printed:\n%s", out)
+	}
+	out = runLine(t, c, "check", "change\nBKG-10000\n+1d5h\n")
+	if !strings.Contains(out, "Would fail:\nTime conflict.\nConflicts with BKG-10001") {
+		t.Errorf("change check printed:\n%s", out)
+	}
+	got := srv.received()
+	if len(got) != 2 {
+		t.Fatalf("server saw %d requests, want 2", len(got))
+	}
+	for _, r := range got {
+		if !r.DryRun {
+			t.Errorf("%s sent without the dry-run flag", common.OpName(r.OpCode))
+		}
+	}
+	if got[0].FacilityName != "RoomA" || got[0].StartHour != 11 || got[1].ConfirmationID != "BKG-10000" || got[1].OffsetMinutes != 1440+300 {
+		t.Errorf("server saw %+v", got)
+	}
+	if c.lastBooking.ID != "" {
+		t.Errorf("a check filled the undo slot with %q", c.lastBooking.ID)
+	}
+
+	out = runLine(t, c, "check", "cancel\n")
+	if !strings.Contains(out, `unknown kind "cancel"`) || len(srv.received()) != 2 {
+		t.Errorf("unknown kind printed:\n%s", out)
+	}
+}
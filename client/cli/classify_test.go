@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestClassifyPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		rep  common.ReplyMessage
+		want packetKind
+	}{
+		{"callback", seqCallback("RoomA", 1), packetCallback},
+		{"callback without a sequence", common.ReplyMessage{OpCode: common.OpCallback, Data: "update"}, packetCallback},
+		{"reply", common.ReplyMessage{RequestID: 5, OpCode: common.OpQueryAvailability, Data: "free"}, packetReply},
+		// The text used to decide; it no longer does
+		{"reply that reads like a callback", common.ReplyMessage{RequestID: 5, OpCode: common.OpAddParticipant, Data: "Callback: RoomA updated"}, packetReply},
+		{"error reply", common.ReplyMessage{RequestID: 5, OpCode: common.OpBookFacility, Status: common.StatusError}, packetReply},
+	}
+	for _, tt := range tests {
+		if got := classifyPacket(tt.rep); got != tt.want {
+			t.Errorf("%s: classifyPacket = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestStrayReplyDropped feeds the monitor path a reply nothing is waiting
+// for: it is dropped, not shown as a callback.
+func TestStrayReplyDropped(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	c.handleMonitorPacket(common.ReplyMessage{RequestID: 99, OpCode: common.OpAddParticipant, Data: "Callback: looks like one"})
+	if n := c.stats.callbacks.Load(); n != 0 {
+		t.Errorf("%d callbacks counted for a stray reply", n)
+	}
+	c.handleMonitorPacket(seqCallback("RoomA", 1))
+	if n := c.stats.callbacks.Load(); n != 1 {
+		t.Errorf("%d callbacks counted, want 1", n)
+	}
+}
+
+// TestCallbackDuringRequest delivers a callback while the client waits for
+// a reply: the callback is handled and the reply still returned.
+func TestCallbackDuringRequest(t *testing.T) {
+	var self *fakeServer // set before the server starts serving
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		self.callback(seqCallback("RoomA", 1))
+		return okReply(req, "the reply")
+	}, func(f *fakeServer) { self = f })
+	c := newTestClient(t, srv.Addr())
+	rep, err := query(c, "RoomA")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if rep.Data != "the reply" {
+		t.Errorf("reply %q", rep.Data)
+	}
+	if n := c.stats.callbacks.Load(); n != 1 {
+		t.Errorf("%d callbacks counted, want 1", n)
+	}
+}
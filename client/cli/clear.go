@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleClearBookings removes all bookings of a facility, or those on some
+// days, after the user confirms. The server only accepts it from the admin.
+func (c *ClientState) handleClearBookings(reader *bufio.Reader) {
+	fmt.Print("Enter facility name: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+
+	fmt.Print("Enter days to clear, e.g. \"Fri\" or \"0,4\" (empty for all days): ")
+	daysStr, _ := reader.ReadString('\n')
+	days, err := utils.ParseDays(daysStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	scope := "all days"
+	if len(days) > 0 {
+		scope = "days " + strings.TrimSpace(daysStr)
+	}
+	fmt.Printf("Remove every booking of %s on %s? (y/N): ", facilityName, scope)
+	answer, _ := reader.ReadString('\n')
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		fmt.Println("Nothing removed.")
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:       common.OpClearBookings,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facilityName,
+		DaysList:     days,
+		Confirm:      true,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Println("\nFailed to clear bookings!")
+	}
+	fmt.Println(reply.Data)
+}
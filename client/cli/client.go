@@ -2,75 +2,173 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"math/rand"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Iyzyman/distributed-go/client/utils"
 	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
 )
 
 // ClientState represents the global client state
 type ClientState struct {
 	Conn        *net.UDPConn
-	ServerAddr  *net.UDPAddr
-	Timeout     time.Duration
+	Timeout     time.Duration // static per-attempt timeout
+	Retries     int // attempts per server before failing over (0 = unlimited)
 	NextReqID   uint64
 	MonitorMode bool
 	PacketDemo  bool
+	Debug       bool                  // log a hex dump of every packet sent and received
+	Security    common.PacketSecurity // optional HMAC authentication / encryption
+
+	// Requests larger than this are refused locally (0 = no limit)
+	MaxRequestSize int
+
+	// Adaptive timeout: per-attempt deadline derived from measured RTTs,
+	// clamped to [MinTimeout, MaxTimeout]
+	AdaptiveTimeout bool
+	MinTimeout      time.Duration
+	MaxTimeout      time.Duration
+	rtt             rttEstimator
+	latency         latencySplit // RTT split into network and server time
+
+	// Per-OpCode overrides of Timeout (fixed, not adaptive) and Retries
+	OpTimeouts map[uint8]time.Duration
+	OpRetries  map[uint8]int
+
+	// Keep retrying when the server's port refuses packets (see unreachable)
+	RetryRefused bool
+
+	// Answer keepalive callbacks so the NAT mapping stays open both ways
+	AnswerKeepalives bool
+
+	// Most pages the list command fetches before stopping (0 = no limit)
+	MaxPages int
+
+	// Failover: candidate servers and the index of the one in use
+	ServerAddrs []string
+	current     int
+
+	// Transport is "udp" (default) or "tcp"; TCP uses a persistent stream
+	Transport string
+	IPFamily  string // FamilyAuto, FamilyIPv4 or FamilyIPv6
+	tcpConn   net.Conn
+	tcpBuf    []byte
+
+	// Active monitor registrations: facility -> expiry
+	monitors map[string]time.Time
+	// Days and events each monitor is limited to (absent for everything)
+	monitorFilters map[string]monitorFilter
+	// Registration token of each monitor, for OpRebindMonitor
+	monitorTokens map[string]string
+	// Set while monitors are re-bound, so a failure does not re-dial again
+	rebinding bool
+
+	// Estimated server clock minus local clock, measured from the server
+	// clock in Ping and Hello replies or learned from stale-request replies
+	clockOffset time.Duration
+	// Set once a Ping or Hello reply has measured clockOffset
+	clockMeasured bool
+
+	// Session from the last successful register/login (empty = anonymous)
+	Username     string
+	Password     string
+	SessionToken string
+	// Random ID for this run, sent with every login (see newInstanceID)
+	instance string
+
+	// Facility namespace sent with every request ("" = the server's default)
+	Namespace string
+
+	// Semantics hint sent with every request (common.HintServerDefault = none)
+	SemanticsHint uint8
+	// Capability bits advertised with every request (e.g. common.CapGzip)
+	Capabilities uint8
+
+	// What the current server reported in the hello handshake
+	server     common.HelloInfo
+	negotiated bool
+
+	// Counters shown by the status command
+	stats clientStats
+
+	// Callback sequence numbers per monitored facility
+	callbacks callbackTracker
+
+	// Current monitor session (see startMonitor)
+	monitorFacility string
+	monitorUntil    time.Time
+	monitorStop     chan struct{}
+	monitorDone     chan struct{}
+	// Line read started while monitoring, still owed to the menu
+	pendingInput chan string
+
+	// Bookings made in this session, for "cancel mine", and the last one,
+	// for undo
+	myBookings  map[string]bool
+	lastBooking lastBooking
+
+	// Last query result per facility, for the conflict pre-check
+	availability availabilityCache
+
+	// Commands run from the menu, and how the latest request ended
+	history     []historyEntry
+	lastOutcome string
 }
 
-// RunCLI presents a menu and handles user input
+// RunCLI presents the menu once and then handles commands until exit
 func (c *ClientState) RunCLI() {
 	reader := bufio.NewReader(os.Stdin)
 
+	printMenu()
 	for {
 		if c.MonitorMode {
-			fmt.Println("\nMonitoring for updates. Press Enter to return to menu.")
-			reader.ReadString('\n')
-			c.MonitorMode = false
+			c.waitMonitor(reader)
 			continue
 		}
 
-		fmt.Println("\nAvailable commands:")
-		fmt.Println("1. query - Query facility availability")
-		fmt.Println("2. book - Book a facility")
-		fmt.Println("3. change - Change an existing booking")
-		fmt.Println("4. monitor - Monitor facility availability")
-		fmt.Println("5. cancel - Cancel a booking")
-		fmt.Println("6. add-participant - Add participant to a booking")
-		fmt.Println("7. exit - Exit the client")
-		fmt.Print("\nEnter command: ")
-
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-
-		switch input {
-		case "1", "query":
-			c.handleQueryAvailability(reader)
-		case "2", "book":
-			c.handleBookFacility(reader)
-		case "3", "change":
-			c.handleChangeBooking(reader)
-		case "4", "monitor":
-			c.handleMonitorAvailability(reader)
-		case "5", "cancel":
-			c.handleCancelBooking(reader)
-		case "6", "add-participant":
-			c.handleAddParticipant(reader)
-		case "7", "exit":
+		fmt.Print("\nEnter command (help for the list): ")
+		input := strings.TrimSpace(c.readLine(reader))
+		name, arg, _ := strings.Cut(input, " ")
+
+		if strings.HasPrefix(name, "!") {
+			c.rerun(reader, name[1:])
+			continue
+		}
+		cmd, ok := lookupCommand(name)
+		switch {
+		case !ok:
+			fmt.Println("Unknown command. Type \"help\" for the list.")
+		case cmd.name == cmdExit:
 			fmt.Println("Exiting client.")
 			return
+		case cmd.name == cmdHelp:
+			handleHelp(arg)
+		case cmd.name == cmdHistory:
+			c.printHistory()
 		default:
-			fmt.Println("Unknown command. Please try again.")
+			c.runCommand(reader, cmd, nil)
 		}
 	}
 }
 
+// InitialRequestID returns the first RequestID for a new client run. The
+// start time in milliseconds fills the high bits and the low 20 bits count
+// requests, so IDs keep increasing across restarts (unless a run issued
+// more than a million requests per millisecond it lasted), as the server's
+// sliding dedup window requires.
+func InitialRequestID() uint64 {
+	return uint64(time.Now().UnixMilli()) << 20
+}
+
 // GetNextRequestID generates a unique request ID
 func (c *ClientState) GetNextRequestID() uint64 {
 	id := c.NextReqID
@@ -78,67 +176,296 @@ func (c *ClientState) GetNextRequestID() uint64 {
 	return id
 }
 
-// SendRequest sends a request to the server and waits for a reply
+// SendRequest sends a request to the server and waits for a reply.
+// If the current server stays silent for all retries, the next configured
+// server is tried until every address has been attempted once.
+//
+// Each request carries the client's (offset-corrected) clock. Retransmissions
+// reuse the same bytes and therefore the same timestamp; if the server rejects
+// it as stale, the offset is resynchronised from the server time in the reply
+// and the request is sent once more with a fresh timestamp.
+//
+// Likewise, when the server no longer knows the session token (it expired or
+// the client failed over), the client logs in again with the stored
+// credentials and resends once.
 func (c *ClientState) SendRequest(req common.RequestMessage) (*common.ReplyMessage, error) {
-    // Marshal the request
-    data, err := common.MarshalRequest(req)
-    if err != nil {
-        return nil, fmt.Errorf("error marshalling: %w", err)
-    }
+	c.negotiate()
+	c.stats.requests++
+	reply, err := c.sendRequest(req)
+	c.recordOutcome(reply, err)
+	if err != nil {
+		c.stats.failures++
+	} else {
+		c.stats.lastSuccess = time.Now()
+		if reply.Status == common.StatusOK && (req.IsMutating() || req.OpCode == common.OpBatch) {
+			// A cancel or change names no facility, and a transfer names
+			// only its target; forget them all
+			facility := req.FacilityName
+			if req.OpCode == common.OpTransferBooking {
+				facility = ""
+			}
+			c.availability.forget(facility)
+		}
+		showErrorEcho(reply)
+		for i := range reply.Replies {
+			showErrorEcho(&reply.Replies[i])
+		}
+	}
+	return reply, err
+}
 
-    attempts := 0 // Counter for the number of attempts
+// showErrorEcho appends the request fields a server echoes in an error
+// reply to its Data, so every place that prints the error also shows which
+// request and field it was about.
+func showErrorEcho(reply *common.ReplyMessage) {
+	if reply.Status == common.StatusOK {
+		return
+	}
+	echo, ok, err := common.ErrorEchoOf(*reply)
+	if !ok || err != nil {
+		return
+	}
+	reply.Data = strings.TrimRight(reply.Data, "\n") + "\n  Request: " + echo.String()
+}
 
-    for {
-        attempts++ // Increment attempt counter
+// sendRequest implements SendRequest without the statistics.
+func (c *ClientState) sendRequest(req common.RequestMessage) (*common.ReplyMessage, error) {
+	for retried := false; ; retried = true {
+		req.Timestamp = time.Now().Add(c.clockOffset).UnixMilli()
+		if req.OpCode != common.OpRegisterUser {
+			req.SessionToken = c.SessionToken
+		}
+		req.Semantics = c.SemanticsHint
+		if c.server.ProtocolVersion >= 1 {
+			req.Capabilities = c.Capabilities
+		}
 
-        // Send the request
-        _, err = c.Conn.Write(data)
-        if err != nil {
-            return nil, fmt.Errorf("error sending request: %w", err)
-        }
+		// Marshal the request
+		data, err := c.encodeRequest(req)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling: %w", err)
+		}
+		if c.MaxRequestSize > 0 && len(data) > c.MaxRequestSize {
+			return nil, fmt.Errorf("request of %d bytes exceeds the limit of %d bytes; not sent", len(data), c.MaxRequestSize)
+		}
 
-        // Set deadline for reading the reply
-        c.Conn.SetReadDeadline(time.Now().Add(c.Timeout))
+		reply, err := c.sendToServers(req, data)
+		reply, err = c.waitOutBusy(req, data, reply, err)
+		if err != nil || retried {
+			return reply, err
+		}
+		switch reply.Status {
+		case common.StatusStaleRequest:
+			serverNow, ok := common.ParseServerTime(reply.Data)
+			if !ok {
+				return reply, nil
+			}
+			c.clockOffset = time.Until(serverNow)
+			fmt.Printf("Server rejected a stale timestamp; clock offset adjusted to %v, resending.\n",
+				c.clockOffset.Round(time.Millisecond))
+		case common.StatusBadSession:
+			c.SessionToken = ""
+			if c.Username == "" {
+				return reply, nil
+			}
+			if lerr := c.Login(c.Username, c.Password); lerr != nil {
+				return reply, nil
+			}
+			fmt.Printf("Session expired; logged in again as %s, resending.\n", c.Username)
+		default:
+			return reply, nil
+		}
+	}
+}
 
-        // Wait for reply
-        buffer := make([]byte, 2048)
-        n, _, err := c.Conn.ReadFromUDP(buffer)
+// waitOutBusy resends a request the server refused as busy, waiting the
+// retry-after it suggested before each resend instead of retrying at once,
+// for as many attempts as the operation allows. It returns the first reply
+// that is not busy, or the last busy one.
+func (c *ClientState) waitOutBusy(req common.RequestMessage, data []byte, reply *common.ReplyMessage, err error) (*common.ReplyMessage, error) {
+	retries := c.retriesFor(req.OpCode)
+	for attempt := 1; err == nil && reply.Status == common.StatusBusy; attempt++ {
+		if retries > 0 && attempt >= retries {
+			break
+		}
+		wait, ok := common.ParseRetryAfter(reply.Data)
+		if !ok {
+			wait = c.Timeout
+		}
+		c.stats.busy++
+		fmt.Printf("Server busy; retrying in %v.\n", wait)
+		time.Sleep(wait)
+		reply, err = c.sendToServers(req, data)
+	}
+	return reply, err
+}
 
-        if err == nil {
-            // Simulate packet loss if enabled
-            if c.PacketDemo && rand.Float32() < 0.5 {
-                fmt.Printf("Packet Loss on attempt %d.\n", attempts)
-                continue // Retry due to simulated packet loss
-            }
+// sendToServers runs one exchange, failing over to the next configured
+// server when the current one does not answer.
+func (c *ClientState) sendToServers(req common.RequestMessage, data []byte) (*common.ReplyMessage, error) {
+	servers := len(c.ServerAddrs)
+	if servers == 0 {
+		servers = 1
+	}
+	for tried := 1; ; tried++ {
+		reply, err := c.exchange(req, data)
+		unreachable := errors.Is(err, errUnreachable)
+		if !(unreachable || errors.Is(err, errNoReply)) || tried >= servers {
+			return reply, err
+		}
+		if !unreachable {
+			fmt.Printf("Server %s is not responding.\n", c.ActiveServer())
+		}
+		if ferr := c.failover(); ferr != nil {
+			return nil, ferr
+		}
+	}
+}
 
-            // Unmarshal the reply if no simulated packet loss
-            reply, umErr := common.UnmarshalReply(buffer[:n])
-            if umErr != nil {
-                return nil, fmt.Errorf("error unmarshalling reply: %w", umErr)
-            }
+// errNoReply means every attempt against the current server timed out.
+var errNoReply = errors.New("no reply from server")
 
-            fmt.Printf("Reply received on attempt %d.\n", attempts)
-            return &reply, nil
-        }
+// errUnreachable means the server's host reported that nothing is listening
+// on the port, as opposed to a server that stays silent.
+var errUnreachable = errors.New("server unreachable")
 
-        // Handle timeout errors specifically
-        if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-            fmt.Printf("Timeout on attempt %d, retrying...\n", attempts)
-            continue
-        }
+// isRefused reports whether err is a "connection refused", which UDP
+// sockets surface when an ICMP port-unreachable comes back.
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
 
-        // For all other errors, return immediately
-        return nil, fmt.Errorf("non-timeout error: %w", err)
-    }
+// unreachable reports a refused attempt. Unless RetryRefused is set the
+// request ends at once, so failover can move on to the next server;
+// otherwise the attempt's deadline is waited out like a lost reply, so
+// retries do not spin.
+func (c *ClientState) unreachable(deadline time.Time) error {
+	fmt.Printf("Server unreachable at %s - is it running?\n", c.ActiveServer())
+	if !c.RetryRefused {
+		return fmt.Errorf("%w at %s (connection refused)", errUnreachable, c.ActiveServer())
+	}
+	time.Sleep(time.Until(deadline))
+	return nil
 }
 
+// sendWithRetries sends data to the current server, retrying on timeout.
+// The timeout and number of attempts depend on the request's OpCode.
+func (c *ClientState) sendWithRetries(data []byte, op uint8) (*common.ReplyMessage, error) {
+	attempts := 0 // Counter for the number of attempts
+	retries := c.retriesFor(op)
+	redialed := false
 
+	for {
+		if retries > 0 && attempts >= retries {
+			return nil, fmt.Errorf("%w after %d attempts", errNoReply, attempts)
+		}
+		attempts++ // Increment attempt counter
+
+		// Send the request. A connected UDP socket reports an earlier ICMP
+		// "port unreachable" on the next write or read.
+		err := c.writePacket(data)
+		if isRefused(err) {
+			if err := c.unreachable(time.Now().Add(c.timeoutFor(op, attempts))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			// The socket itself failed (e.g. the local address went away):
+			// re-dial once, which re-binds the monitors, and try again
+			if !redialed && !c.rebinding && c.redial() == nil {
+				redialed = true
+				continue
+			}
+			return nil, fmt.Errorf("error sending request: %w", err)
+		}
+		c.stats.packetsSent++
+		if attempts > 1 {
+			c.stats.retries++
+		}
+
+		// Wait for reply until the deadline. Callbacks that arrive in the
+		// meantime go to the monitor logic and do not end the attempt.
+		sent := time.Now()
+		deadline := sent.Add(c.timeoutFor(op, attempts))
+		raw, err := c.readPacket(deadline)
+		for err == nil {
+			// Simulate packet loss if enabled
+			if c.PacketDemo && rand.Float32() < 0.5 {
+				fmt.Printf("Packet Loss on attempt %d.\n", attempts)
+				break // Retry due to simulated packet loss
+			}
+
+			// Verify and unmarshal the reply if no simulated packet loss
+			reply, umErr := c.decodeReply(raw)
+			if errors.Is(umErr, common.ErrBadMAC) || errors.Is(umErr, common.ErrDecrypt) {
+				fmt.Printf("Reply on attempt %d failed authentication, dropping.\n", attempts)
+				break
+			}
+			if errors.Is(umErr, common.ErrBadMagic) {
+				fmt.Printf("Ignoring stray packet on attempt %d.\n", attempts)
+				break
+			}
+			if umErr != nil {
+				return nil, fmt.Errorf("error decoding reply: %w", umErr)
+			}
+			if classifyPacket(reply) == packetCallback {
+				c.handleMonitorPacket(reply)
+				raw, err = c.readPacket(deadline)
+				continue
+			}
+
+			fmt.Printf("Reply received on attempt %d.\n", attempts)
+			c.stats.replies++
+			if attempts == 1 {
+				c.observeRTT(time.Since(sent), reply.ServerMicros)
+			}
+			return &reply, nil
+		}
+		if err == nil {
+			continue
+		}
+
+		// Handle timeout errors specifically
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			fmt.Printf("Timeout on attempt %d, retrying...\n", attempts)
+			continue
+		}
+		if isRefused(err) {
+			if err := c.unreachable(deadline); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// For all other errors, re-dial once as above, then give up
+		if !redialed && !c.rebinding && c.redial() == nil {
+			redialed = true
+			continue
+		}
+		return nil, fmt.Errorf("non-timeout error: %w", err)
+	}
+}
 
 // handleQueryAvailability implements the Query operation
 func (c *ClientState) handleQueryAvailability(reader *bufio.Reader) {
-	fmt.Print("Enter facility name: ")
-	facilityName, _ := reader.ReadString('\n')
-	facilityName = strings.TrimSpace(facilityName)
+	fmt.Print("Enter facility name (comma-separated for several): ")
+	input, _ := reader.ReadString('\n')
+	var names []string
+	for _, name := range strings.Split(input, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	for _, name := range names {
+		if err := validate.ValidateFacilityName(name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
 
 	days, err := utils.ReadDaysList(reader)
 	if err != nil {
@@ -146,12 +473,13 @@ func (c *ClientState) handleQueryAvailability(reader *bufio.Reader) {
 		return
 	}
 
-	// Create request
+	// Create request; facilities after the first travel in an extension
 	req := common.RequestMessage{
-		OpCode:       common.OpQueryAvailability,
-		RequestID:    c.GetNextRequestID(),
-		FacilityName: facilityName,
-		DaysList:     days,
+		OpCode:         common.OpQueryAvailability,
+		RequestID:      c.GetNextRequestID(),
+		FacilityName:   names[0],
+		MoreFacilities: names[1:],
+		DaysList:       days,
 	}
 
 	// Send request and get reply
@@ -161,10 +489,13 @@ func (c *ClientState) handleQueryAvailability(reader *bufio.Reader) {
 		return
 	}
 
+	c.cacheQueryResult(req, reply)
+
 	// Display result
 	fmt.Println("\nQuery Result:")
 	if reply.Status == 0 {
 		fmt.Println(reply.Data)
+		offerSave(reader, reply.Data+"\n")
 	} else {
 		fmt.Printf("Error: %s\n", reply.Data)
 	}
@@ -172,27 +503,15 @@ func (c *ClientState) handleQueryAvailability(reader *bufio.Reader) {
 
 // handleBookFacility implements the Book operation
 func (c *ClientState) handleBookFacility(reader *bufio.Reader) {
-	fmt.Print("Enter facility name: ")
-	facilityName, _ := reader.ReadString('\n')
-	facilityName = strings.TrimSpace(facilityName)
-
-	startDay, startHour, startMin, endDay, endHour, endMin, err := utils.ReadBookingTimes(reader)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+	req, ok := c.readBookRequest(reader)
+	if !ok {
 		return
 	}
-
-	// Create request
-	req := common.RequestMessage{
-		OpCode:       common.OpBookFacility,
-		RequestID:    c.GetNextRequestID(),
-		FacilityName: facilityName,
-		StartDay:     startDay,
-		StartHour:    startHour,
-		StartMinute:  startMin,
-		EndDay:       endDay,
-		EndHour:      endHour,
-		EndMinute:    endMin,
+	req.IdempotencyKey = newIdempotencyKey()
+	window := schedule.Span(req.StartDay, req.StartHour, req.StartMinute, req.EndDay, req.EndHour, req.EndMinute)
+	if !c.confirmDespiteCache(reader, req.FacilityName, window) {
+		fmt.Println("Not sent.")
+		return
 	}
 
 	// Send request and get reply
@@ -204,6 +523,7 @@ func (c *ClientState) handleBookFacility(reader *bufio.Reader) {
 
 	// Display result
 	if reply.Status == 0 {
+		c.rememberBooking(confirmationIDFromReply(reply.Data), reply.Data)
 		fmt.Println("\nBooking successful!")
 		fmt.Println(reply.Data)
 	} else {
@@ -212,33 +532,48 @@ func (c *ClientState) handleBookFacility(reader *bufio.Reader) {
 	}
 }
 
+// readBookRequest prompts for a facility and a time range and builds the
+// BookFacility request, or prints the input error and returns false.
+func (c *ClientState) readBookRequest(reader *bufio.Reader) (common.RequestMessage, bool) {
+	fmt.Print("Enter facility name: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+	if err := validate.ValidateFacilityName(facilityName); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return common.RequestMessage{}, false
+	}
+
+	startDay, startHour, startMin, endDay, endHour, endMin, err := utils.ReadBookingRange(reader)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return common.RequestMessage{}, false
+	}
+
+	return common.RequestMessage{
+		OpCode:       common.OpBookFacility,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facilityName,
+		StartDay:     startDay,
+		StartHour:    startHour,
+		StartMinute:  startMin,
+		EndDay:       endDay,
+		EndHour:      endHour,
+		EndMinute:    endMin,
+	}, true
+}
+
 // handleChangeBooking implements the Change operation using an offset.
 func (c *ClientState) handleChangeBooking(reader *bufio.Reader) {
-    // Prompt for the booking confirmation ID.
-    fmt.Print("Enter Confirmation ID: ")
-    confirmationID, _ := reader.ReadString('\n')
-    confirmationID = strings.TrimSpace(confirmationID)
-
-    // Prompt for the offset (in minutes).
-    fmt.Print("Enter offset in minutes (positive to advance, negative to postpone): ")
-    offsetStr, _ := reader.ReadString('\n')
-    offsetStr = strings.TrimSpace(offsetStr)
-    offset, err := strconv.Atoi(offsetStr)
-    if err != nil {
-        fmt.Printf("Error parsing offset: %v\n", err)
+    req, ok := c.readChangeRequest(reader)
+    if !ok {
         return
     }
 
-    // Create the request with the offset.
-    req := common.RequestMessage{
-        OpCode:         common.OpChangeBooking,
-        RequestID:      c.GetNextRequestID(),
-        ConfirmationID: confirmationID,
-        OffsetMinutes:  int32(offset),
-    }
-
     // Send request and get reply.
     reply, err := c.SendRequest(req)
+    if err == nil {
+        reply, err = c.retryForced(reader, req, reply)
+    }
     if err != nil {
         fmt.Printf("Error sending request: %v\n", err)
         return
@@ -246,6 +581,9 @@ func (c *ClientState) handleChangeBooking(reader *bufio.Reader) {
 
     // Display result.
     if reply.Status == 0 {
+        if c.lastBooking.ID == req.ConfirmationID {
+            c.lastBooking.Details = reply.Data
+        }
         fmt.Println("\nBooking changed successfully!")
     } else {
         fmt.Println("\nFailed to change booking!")
@@ -253,19 +591,78 @@ func (c *ClientState) handleChangeBooking(reader *bufio.Reader) {
     fmt.Println(reply.Data)
 }
 
+// readChangeRequest prompts for a confirmation ID and an offset and builds
+// the ChangeBooking request, or prints the input error and returns false.
+func (c *ClientState) readChangeRequest(reader *bufio.Reader) (common.RequestMessage, bool) {
+    // Prompt for the booking confirmation ID.
+    fmt.Print("Enter Confirmation ID: ")
+    confirmationID, _ := reader.ReadString('\n')
+    confirmationID = strings.TrimSpace(confirmationID)
+
+    // Prompt for the offset: minutes, or day/hour/minute terms like +1d-2h.
+    // A leading "end" moves only the end, e.g. to extend a running booking.
+    fmt.Print("Enter offset (minutes, or e.g. +1d, -2h, 1d-2h+30m; positive moves later; \"end +30m\" moves only the end): ")
+    offsetStr, _ := reader.ReadString('\n')
+    offsetStr = strings.TrimSpace(offsetStr)
+    endOnly := len(offsetStr) >= 3 && strings.EqualFold(offsetStr[:3], "end")
+    if endOnly {
+        offsetStr = offsetStr[3:]
+    }
+    offset, wholeDays, err := utils.ParseOffset(offsetStr)
+    if err != nil {
+        fmt.Printf("Error parsing offset: %v\n", err)
+        return common.RequestMessage{}, false
+    }
+
+    // A shift given in days only asks the server to keep the time of day.
+    return common.RequestMessage{
+        OpCode:         common.OpChangeBooking,
+        RequestID:      c.GetNextRequestID(),
+        ConfirmationID: confirmationID,
+        OffsetMinutes:  offset,
+        WholeDays:      wholeDays,
+        EndOnly:        endOnly,
+    }, true
+}
+
 // handleMonitorAvailability implements the Monitor operation
 func (c *ClientState) handleMonitorAvailability(reader *bufio.Reader) {
 	fmt.Print("Enter facility name: ")
 	facilityName, _ := reader.ReadString('\n')
 	facilityName = strings.TrimSpace(facilityName)
+	if err := validate.ValidateFacilityName(facilityName); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
 	fmt.Print("Enter duration in seconds: ")
 	durationStr, _ := reader.ReadString('\n')
-	duration, err := strconv.Atoi(strings.TrimSpace(durationStr))
-	if err != nil || duration <= 0 {
+	duration, err := strconv.ParseUint(strings.TrimSpace(durationStr), 10, 32)
+	if err != nil {
 		fmt.Println("Error: Invalid duration")
 		return
 	}
+	if err := validate.ValidateMonitorPeriod(uint32(duration)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Print("Enter days to monitor (e.g. Fri or 0,4; empty for all days): ")
+	daysStr, _ := reader.ReadString('\n')
+	days, err := utils.ParseDays(daysStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Enter events to receive (%s; empty for all): ", common.EventMaskString(common.AllEvents))
+	eventsStr, _ := reader.ReadString('\n')
+	events, err := common.ParseEventMask(eventsStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	filter := monitorFilter{Days: days, Events: events}
 
 	// Create request
 	req := common.RequestMessage{
@@ -273,6 +670,8 @@ func (c *ClientState) handleMonitorAvailability(reader *bufio.Reader) {
 		RequestID:     c.GetNextRequestID(),
 		FacilityName:  facilityName,
 		MonitorPeriod: uint32(duration),
+		DaysList:      days,
+		EventMask:     events,
 	}
 
 	// Send request and get reply
@@ -288,51 +687,37 @@ func (c *ClientState) handleMonitorAvailability(reader *bufio.Reader) {
 		return
 	}
 
+	// The same token means the server extended the running subscription,
+	// whose sequence numbers carry on
+	token := monitorTokenFromReply(reply.Data)
+	if token == "" || token != c.monitorTokens[facilityName] {
+		c.callbacks.reset(facilityName)
+	}
+	period := c.grantedPeriod(reply.Data, time.Duration(duration)*time.Second)
+	c.trackMonitor(facilityName, period, filter, token)
+
 	fmt.Println("\nMonitoring started successfully!")
 	fmt.Println(reply.Data)
 	fmt.Println("\nWaiting for updates (press Enter to stop)...")
 
-	// Set up for monitoring callbacks
-	c.MonitorMode = true
-
-	// Start a goroutine to listen for callbacks
-	go func() {
-		buffer := make([]byte, 2048)
-		for c.MonitorMode {
-			// Set a short timeout so we can check if monitoring mode is still active
-			c.Conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
-			n, _, err := c.Conn.ReadFromUDP(buffer)
-			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					// Just a timeout, continue
-					continue
-				}
-				if c.MonitorMode {
-					fmt.Printf("Error reading callback: %v\n", err)
-				}
-				return
-			}
-
-			// Process the callback
-			callback, err := common.UnmarshalReply(buffer[:n])
-			if err != nil {
-				fmt.Printf("Error unmarshalling callback: %v\n", err)
-				continue
-			}
-
-			// Only print if it's a monitoring callback
-			if strings.Contains(callback.Data, "Facility=") {
-				fmt.Printf("\n%s\n", callback.Data)
-			}
-		}
-	}()
+	// Listen for callbacks until the period ends or the user presses Enter
+	c.startMonitor(facilityName, period)
 }
 
 // handleCancelBooking implements the Cancel operation
 func (c *ClientState) handleCancelBooking(reader *bufio.Reader) {
-	fmt.Print("Enter Confirmation ID: ")
-	confirmationID, _ := reader.ReadString('\n')
-	confirmationID = strings.TrimSpace(confirmationID)
+	fmt.Printf("Enter Confirmation ID (comma-separated for several, or %q for this session's bookings): ", cancelAllMine)
+	input, _ := reader.ReadString('\n')
+	ids := c.cancelSelection(input)
+	switch {
+	case len(ids) == 0:
+		fmt.Println("No bookings selected")
+		return
+	case len(ids) > 1 || strings.EqualFold(strings.TrimSpace(input), cancelAllMine):
+		c.cancelBookings(ids)
+		return
+	}
+	confirmationID := ids[0]
 
 	// Create request
 	req := common.RequestMessage{
@@ -343,6 +728,9 @@ func (c *ClientState) handleCancelBooking(reader *bufio.Reader) {
 
 	// Send request and get reply
 	reply, err := c.SendRequest(req)
+	if err == nil {
+		reply, err = c.retryForced(reader, req, reply)
+	}
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
@@ -350,6 +738,7 @@ func (c *ClientState) handleCancelBooking(reader *bufio.Reader) {
 
 	// Display result
 	if reply.Status == 0 {
+		c.forgetBooking(confirmationID)
 		fmt.Println("\nBooking canceled successfully!")
 	} else {
 		fmt.Println("\nFailed to cancel booking!")
@@ -363,10 +752,16 @@ func (c *ClientState) handleAddParticipant(reader *bufio.Reader) {
 	confirmationID, _ := reader.ReadString('\n')
 	confirmationID = strings.TrimSpace(confirmationID)
 
-	fmt.Print("Enter Participant Name: ")
+	fmt.Print("Enter Participant Name (comma-separated for several): ")
 	participantName, _ := reader.ReadString('\n')
 	participantName = strings.TrimSpace(participantName)
 
+	// Several names go out as one batch
+	if strings.Contains(participantName, ",") {
+		c.addParticipants(confirmationID, participantName)
+		return
+	}
+
 	// Create request
 	req := common.RequestMessage{
 		OpCode:          common.OpAddParticipant,
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestRequestIDsIncreaseAcrossRuns: the server's dedup window relies on a
+// restarted client never reusing or going below the IDs of an earlier run.
+func TestRequestIDsIncreaseAcrossRuns(t *testing.T) {
+	first := &ClientState{NextReqID: InitialRequestID()}
+	var last uint64
+	for i := 0; i < 1000; i++ {
+		last = first.GetNextRequestID()
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	second := &ClientState{NextReqID: InitialRequestID()}
+	if next := second.GetNextRequestID(); next <= last {
+		t.Errorf("restarted client's first ID %d is not above the earlier run's last %d", next, last)
+	}
+}
+
+// TestErrorEchoShown: the fields a server echoes in an error reply are
+// appended to the error text, and nothing is added to other replies.
+func TestErrorEchoShown(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.FacilityName == "RoomA" {
+			return okReply(req, "ok")
+		}
+		rep := &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusInvalidArgument,
+			Data: "Error: StartHour 25 is out of range (0-23).\n"}
+		if req.FacilityName == "Lab1" {
+			rep.Extensions.PutErrorEcho(common.ErrorEcho{Op: "BookFacility", Facility: "Lab1", Field: "StartHour", Value: "25"})
+		}
+		return rep
+	})
+	c := newTestClient(t, srv.Addr())
+
+	tests := []struct{ facility, want string }{
+		{"Lab1", "Error: StartHour 25 is out of range (0-23).\n  Request: op=BookFacility facility=Lab1 field=StartHour value=25"},
+		{"Gym", "Error: StartHour 25 is out of range (0-23).\n"},
+		{"RoomA", "ok"},
+	}
+	for _, tt := range tests {
+		rep, err := c.SendRequest(common.RequestMessage{OpCode: common.OpBookFacility, RequestID: c.GetNextRequestID(), FacilityName: tt.facility})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.facility, err)
+		}
+		if rep.Data != tt.want {
+			t.Errorf("%s: reply %q, want %q", tt.facility, rep.Data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleCopyBooking books the time and participants of an existing booking
+// again on another day. The copy is this session's booking, whoever made
+// the original.
+func (c *ClientState) handleCopyBooking(reader *bufio.Reader) {
+	fmt.Print("Enter Booking Confirmation ID: ")
+	confirmationID, _ := reader.ReadString('\n')
+	confirmationID = strings.TrimSpace(confirmationID)
+
+	fmt.Print("Enter the day to copy it to (Mon..Sun or 0-6): ")
+	line, _ := reader.ReadString('\n')
+	day, err := common.ParseDay(line)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:         common.OpCopyBooking,
+		RequestID:      c.GetNextRequestID(),
+		ConfirmationID: confirmationID,
+		StartDay:       day,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if reply.Status == common.StatusOK {
+		c.rememberBooking(confirmationIDFromReply(reply.Data), reply.Data)
+		fmt.Println("\nBooking copied successfully!")
+		fmt.Println(reply.Data)
+	} else {
+		fmt.Println("\nFailed to copy booking!")
+		fmt.Printf("Error: %s\n", reply.Data)
+	}
+}
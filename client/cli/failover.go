@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// ParseServerList splits a comma-separated -serverAddr value.
+func ParseServerList(list string) []string {
+	addrs := make([]string, 0)
+	for _, a := range strings.Split(list, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// Connect dials the configured server at index i, replacing any existing
+// connection.
+func (c *ClientState) Connect(i int) error {
+	if err := c.dial(c.ServerAddrs[i]); err != nil {
+		return err
+	}
+	c.current = i
+	c.negotiated = false // the next request repeats the handshake
+	return nil
+}
+
+// ActiveServer returns the address of the server currently in use.
+func (c *ClientState) ActiveServer() string {
+	if len(c.ServerAddrs) == 0 {
+		return "(not connected)"
+	}
+	return c.Transport + "://" + c.ServerAddrs[c.current]
+}
+
+// failover rotates to the next configured server and re-establishes any
+// monitor registrations that are still running.
+func (c *ClientState) failover() error {
+	if len(c.ServerAddrs) < 2 {
+		return fmt.Errorf("no other server to fail over to")
+	}
+	next := (c.current + 1) % len(c.ServerAddrs)
+	if err := c.Connect(next); err != nil {
+		return err
+	}
+	fmt.Printf("Failing over to server %s\n", c.ActiveServer())
+	c.reregisterMonitors()
+	return nil
+}
+
+// monitorFilter limits a monitor to some days and event types.
+type monitorFilter struct {
+	Days   []uint8 // empty for all days
+	Events uint8   // common.Event* bits; 0 or common.AllEvents for all
+}
+
+// all reports whether the filter lets every callback through.
+func (f monitorFilter) all() bool {
+	return len(f.Days) == 0 && (f.Events == 0 || f.Events == common.AllEvents)
+}
+
+// String describes a limited filter for status output.
+func (f monitorFilter) String() string {
+	var parts []string
+	if len(f.Days) > 0 {
+		parts = append(parts, fmt.Sprintf("days %v", f.Days))
+	}
+	if f.Events != 0 && f.Events != common.AllEvents {
+		parts = append(parts, "events "+common.EventMaskString(f.Events))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// trackMonitor remembers a registration so it can be renewed after failover
+// and re-bound after a re-dial. token comes from the registration's reply.
+func (c *ClientState) trackMonitor(facility string, d time.Duration, filter monitorFilter, token string) {
+	if c.monitors == nil {
+		c.monitors = make(map[string]time.Time)
+		c.monitorFilters = make(map[string]monitorFilter)
+		c.monitorTokens = make(map[string]string)
+	}
+	c.monitors[facility] = time.Now().Add(d)
+	if filter.all() {
+		delete(c.monitorFilters, facility)
+	} else {
+		c.monitorFilters[facility] = filter
+	}
+	c.monitorTokens[facility] = token
+}
+
+// grantedPeriod returns how long the server will send callbacks, from the
+// "Expires=" field of a MonitorAvailability reply, which may be shorter than
+// requested. Servers that do not send it grant the full request.
+func (c *ClientState) grantedPeriod(data string, requested time.Duration) time.Duration {
+	i := strings.LastIndex(data, "Expires=")
+	if i < 0 {
+		return requested
+	}
+	field, _, _ := strings.Cut(data[i+len("Expires="):], " ")
+	expiry, err := time.Parse(time.RFC3339, field)
+	if err != nil {
+		return requested
+	}
+	// The expiry is in server time
+	return time.Until(expiry.Add(-c.clockOffset)).Round(time.Second)
+}
+
+// forgetMonitor drops a registration that has ended.
+func (c *ClientState) forgetMonitor(facility string) {
+	delete(c.monitors, facility)
+	delete(c.monitorFilters, facility)
+	delete(c.monitorTokens, facility)
+}
+
+// reregisterMonitors repeats each live registration against the current
+// server for its remaining duration.
+func (c *ClientState) reregisterMonitors() {
+	for facility := range c.monitors {
+		c.reregisterMonitor(facility)
+	}
+}
+
+// reregisterMonitor registers a monitor again for its remaining duration.
+func (c *ClientState) reregisterMonitor(facility string) {
+	remaining := time.Until(c.monitors[facility])
+	if remaining < time.Second {
+		c.forgetMonitor(facility)
+		return
+	}
+	req := common.RequestMessage{
+		OpCode:        common.OpMonitorAvailability,
+		RequestID:     c.GetNextRequestID(),
+		FacilityName:  facility,
+		MonitorPeriod: uint32(remaining / time.Second),
+		DaysList:      c.monitorFilters[facility].Days,
+		EventMask:     c.monitorFilters[facility].Events,
+		Timestamp:     time.Now().Add(c.clockOffset).UnixMilli(),
+	}
+	data, err := c.encodeRequest(req)
+	if err != nil {
+		return
+	}
+	reply, err := c.exchange(req, data)
+	if err != nil || reply.Status != common.StatusOK {
+		fmt.Printf("Could not re-register monitor for %s on %s\n", facility, c.ActiveServer())
+		return
+	}
+	token := monitorTokenFromReply(reply.Data)
+	if token == "" || token != c.monitorTokens[facility] {
+		c.callbacks.reset(facility)
+	}
+	c.monitorTokens[facility] = token
+	c.monitors[facility] = time.Now().Add(c.grantedPeriod(reply.Data, remaining))
+	fmt.Printf("Re-registered monitor for %s on %s (%ds left)\n", facility, c.ActiveServer(), req.MonitorPeriod)
+}
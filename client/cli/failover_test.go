@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestParseServerList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"a:1", []string{"a:1"}},
+		{" a:1 , b:2,,c:3 ", []string{"a:1", "b:2", "c:3"}},
+	}
+	for _, tt := range tests {
+		if got := ParseServerList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseServerList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFailoverWhenFirstServerGoesSilent(t *testing.T) {
+	first := newFakeServer(t, echoHandler)
+	second := newFakeServer(t, echoHandler)
+	c := newTestClient(t, first.Addr(), second.Addr())
+
+	for i := 0; i < 3; i++ {
+		if _, err := query(c, "RoomA"); err != nil {
+			t.Fatalf("query %d before the outage: %v", i, err)
+		}
+	}
+	first.silent.Store(true)
+
+	for i := 0; i < 3; i++ {
+		rep, err := query(c, "RoomA")
+		if err != nil {
+			t.Fatalf("query %d after the outage: %v", i, err)
+		}
+		if rep.Status != common.StatusOK {
+			t.Fatalf("query %d after the outage: status %d", i, rep.Status)
+		}
+	}
+
+	if got, want := c.ActiveServer(), "udp://"+second.Addr(); got != want {
+		t.Errorf("ActiveServer() = %s, want %s", got, want)
+	}
+	if n := len(first.received()); n != 3+c.Retries {
+		t.Errorf("first server saw %d requests, want 3 answered plus %d unanswered attempts", n, c.Retries)
+	}
+	// The request that timed out on the first server is resent with the
+	// same RequestID, so a server that did get it can deduplicate it
+	got := second.received()
+	if len(got) != 3 {
+		t.Fatalf("second server saw %d requests, want 3", len(got))
+	}
+	if lost := first.received()[3]; got[0].RequestID != lost.RequestID {
+		t.Errorf("failed-over request has ID %d, want the original %d", got[0].RequestID, lost.RequestID)
+	}
+}
+
+func TestFailoverWrapsAround(t *testing.T) {
+	first := newFakeServer(t, echoHandler)
+	second := newFakeServer(t, echoHandler)
+	c := newTestClient(t, first.Addr(), second.Addr())
+
+	first.silent.Store(true)
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatalf("query with the first server down: %v", err)
+	}
+	first.silent.Store(false)
+	second.silent.Store(true)
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatalf("query with the second server down: %v", err)
+	}
+	if got, want := c.ActiveServer(), "udp://"+first.Addr(); got != want {
+		t.Errorf("ActiveServer() = %s, want %s", got, want)
+	}
+}
+
+func TestAllServersSilent(t *testing.T) {
+	first := newFakeServer(t, echoHandler)
+	second := newFakeServer(t, echoHandler)
+	first.silent.Store(true)
+	second.silent.Store(true)
+	c := newTestClient(t, first.Addr(), second.Addr())
+
+	_, err := query(c, "RoomA")
+	if !errors.Is(err, errNoReply) {
+		t.Fatalf("err = %v, want errNoReply", err)
+	}
+	// Each server gets its attempts once, not in an endless loop
+	for i, srv := range []*fakeServer{first, second} {
+		if n := len(srv.received()); n != c.Retries {
+			t.Errorf("server %d saw %d attempts, want %d", i, n, c.Retries)
+		}
+	}
+}
+
+func TestFailoverNeedsAnotherServer(t *testing.T) {
+	only := newFakeServer(t, echoHandler)
+	c := newTestClient(t, only.Addr())
+	if err := c.failover(); err == nil {
+		t.Error("failover with a single server succeeded")
+	}
+}
+
+func TestGrantedPeriod(t *testing.T) {
+	c := &ClientState{}
+	expires := func(d time.Duration) string {
+		return "Monitoring RoomA for 3600 seconds. Expires=" + time.Now().Add(d).UTC().Format(time.RFC3339) + " Token=abc"
+	}
+	tests := []struct {
+		name string
+		data string
+		want time.Duration
+	}{
+		{"granted in full", expires(10 * time.Minute), 10 * time.Minute},
+		{"capped", expires(time.Hour), time.Hour},
+		{"old server", "Monitoring RoomA for 99999 seconds.", 99999 * time.Second},
+		{"garbled expiry", "Monitoring RoomA. Expires=soon Token=abc", 99999 * time.Second},
+	}
+	for _, tt := range tests {
+		got := c.grantedPeriod(tt.data, 99999*time.Second)
+		if got < tt.want-time.Second || got > tt.want {
+			t.Errorf("%s: grantedPeriod = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The expiry is read in server time
+	c.clockOffset = time.Hour
+	if got := c.grantedPeriod(expires(2*time.Hour), 0); got < time.Hour-time.Second || got > time.Hour {
+		t.Errorf("with the server an hour ahead: %v, want 1h", got)
+	}
+}
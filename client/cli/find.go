@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// handleFindParticipant lists the bookings a participant is in, across all
+// facilities or in one.
+func (c *ClientState) handleFindParticipant(reader *bufio.Reader) {
+	fmt.Print("Enter participant name: ")
+	name, _ := reader.ReadString('\n')
+	name = strings.TrimSpace(name)
+	if name == "" {
+		fmt.Println("Error: participant name is empty")
+		return
+	}
+
+	fmt.Print("Enter facility name (empty for all): ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+	if facilityName != "" {
+		if err := validate.ValidateFacilityName(facilityName); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	fmt.Print("Match part of the name? (y/N): ")
+	answer, _ := reader.ReadString('\n')
+	mode := uint8(common.MatchExact)
+	if strings.EqualFold(strings.TrimSpace(answer), "y") {
+		mode = common.MatchSubstring
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:          common.OpFindParticipant,
+		RequestID:       c.GetNextRequestID(),
+		ParticipantName: name,
+		FacilityName:    facilityName,
+		MatchMode:       mode,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Printf("Error: %s\n", reply.Data)
+		return
+	}
+	fmt.Println(strings.TrimRight(reply.Data, "\n"))
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleFreeBusy shows which facilities are free over one window, next to
+// the busy ones and what blocks each.
+func (c *ClientState) handleFreeBusy(reader *bufio.Reader) {
+	fmt.Print("Enter the window, e.g. \"Tue 14:00-16:00\": ")
+	line, _ := reader.ReadString('\n')
+	sd, sh, sm, ed, eh, em, err := utils.ParseTimeRange(strings.TrimSpace(line))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:      common.OpFreeBusy,
+		RequestID:   c.GetNextRequestID(),
+		StartDay:    sd,
+		StartHour:   sh,
+		StartMinute: sm,
+		EndDay:      ed,
+		EndHour:     eh,
+		EndMinute:   em,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Printf("Error: %s\n", reply.Data)
+		return
+	}
+	entries, ok, err := common.FreeBusyOf(*reply)
+	if !ok || err != nil {
+		fmt.Println(strings.TrimRight(reply.Data, "\n"))
+		return
+	}
+	fmt.Println(freeBusyColumns(entries))
+}
+
+// freeBusyColumns lays the facilities out as a Free and a Busy column, in
+// the order the server sent them.
+func freeBusyColumns(entries []common.FreeBusy) string {
+	var free, busy []string
+	for _, e := range entries {
+		name := common.EscapeText(e.Facility)
+		switch e.State {
+		case common.FreeBusyFree:
+			free = append(free, name)
+		case common.FreeBusyBooked:
+			busy = append(busy, fmt.Sprintf("%s (%s)", name, common.EscapeText(e.Detail)))
+		default:
+			reason := common.EscapeText(e.Detail)
+			if reason == "" {
+				reason = "maintenance"
+			}
+			busy = append(busy, fmt.Sprintf("%s (closed: %s)", name, reason))
+		}
+	}
+	width := len("Free")
+	for _, name := range free {
+		width = max(width, len(name))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-*s   %s\n", width, "Free", "Busy")
+	fmt.Fprintf(&b, "%-*s   %s\n", width, strings.Repeat("-", width), strings.Repeat("-", 4))
+	for i := 0; i < max(len(free), len(busy)); i++ {
+		var l, r string
+		if i < len(free) {
+			l = free[i]
+		}
+		if i < len(busy) {
+			r = busy[i]
+		}
+		b.WriteString(strings.TrimRight(fmt.Sprintf("%-*s   %s", width, l, r), " ") + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleGrid asks for a facility's free/busy bitmaps and draws them as a
+// week grid, one row per day and one character per 15-minute slot.
+func (c *ClientState) handleGrid(reader *bufio.Reader) {
+	fmt.Print("Enter facility name: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+
+	fmt.Print("Enter days to show, e.g. \"Mon,Fri\" or \"0,4\" (empty for the whole week): ")
+	daysStr, _ := reader.ReadString('\n')
+	days, err := utils.ParseDays(daysStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:       common.OpQueryAvailability,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facilityName,
+		DaysList:     days,
+		Bitmap:       true,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Println(reply.Data)
+		return
+	}
+	busy, ok, err := common.BusyBitmaps(*reply)
+	switch {
+	case err != nil:
+		fmt.Printf("Error: malformed bitmap: %v\n", err)
+	case !ok:
+		// A server without bitmap support answered with the interval text
+		fmt.Println(reply.Data)
+	default:
+		fmt.Printf("\n%s (%d-minute slots, # busy, . free)\n", facilityName, common.SlotMinutes)
+		renderGrid(os.Stdout, busy)
+	}
+}
+
+// renderGrid draws one row per day with an hour scale above it.
+func renderGrid(w io.Writer, days []common.DayBusy) {
+	perHour := 60 / common.SlotMinutes
+	var scale strings.Builder
+	scale.WriteString("    ")
+	for h := 0; h < 24; h++ {
+		fmt.Fprintf(&scale, "%-*s", perHour, fmt.Sprintf("%02d", h))
+	}
+	fmt.Fprintln(w, strings.TrimRight(scale.String(), " "))
+	for _, d := range days {
+		name := common.ShortDayName(d.Day)
+		row := make([]byte, common.SlotsPerDay)
+		for slot := range row {
+			row[slot] = '.'
+			if d.Slots.Busy(slot) {
+				row[slot] = '#'
+			}
+		}
+		fmt.Fprintf(w, "%-4s%s\n", name, row)
+	}
+}
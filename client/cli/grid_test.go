@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestRenderGrid(t *testing.T) {
+	var mon common.DayBitmap
+	mon.MarkBusy(0, 30)
+	mon.MarkBusy(1425, 1440)
+	var out bytes.Buffer
+	renderGrid(&out, []common.DayBusy{{Day: 0, Slots: mon}, {Day: 4}})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%d lines:\n%s", len(lines), out.String())
+	}
+	if !strings.HasPrefix(lines[0], "    00  01  02") || !strings.HasSuffix(lines[0], "23") {
+		t.Errorf("scale %q", lines[0])
+	}
+	if want := "Mon ##" + strings.Repeat(".", 93) + "#"; lines[1] != want {
+		t.Errorf("Monday row\n%q, want\n%q", lines[1], want)
+	}
+	if want := "Fri " + strings.Repeat(".", 96); lines[2] != want {
+		t.Errorf("Friday row %q", lines[2])
+	}
+	// Each hour label sits above its first slot
+	if i := strings.Index(lines[0], "09"); i != 4+9*4 {
+		t.Errorf("09 at column %d", i)
+	}
+}
+
+// TestGridFallsBack: a server without bitmap support answers with text,
+// which is shown as it is.
+func TestGridFallsBack(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return okReply(req, "Facility RoomA availability:\nFriday:\nAvailable timings: 00:00-24:00")
+	})
+	c := newTestClient(t, srv.Addr())
+	out := runLine(t, c, "grid", "RoomA\nFri\n")
+	if !strings.Contains(out, "Available timings: 00:00-24:00") || strings.Contains(out, "# busy") {
+		t.Errorf("printed:\n%s", out)
+	}
+	if got := srv.received(); len(got) != 1 || !got[0].Bitmap || len(got[0].DaysList) != 1 || got[0].DaysList[0] != 4 {
+		t.Errorf("sent %+v", got)
+	}
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// heatShades draw a cell by booked minutes: 0, then up to 15, 30, 45, 60.
+var heatShades = []byte{'.', ':', '+', '*', '#'}
+
+// handleHeatmap shows booked minutes per hour of the week for one facility
+// or all, as a shaded grid or as JSON with the raw matrix.
+func (c *ClientState) handleHeatmap(reader *bufio.Reader) {
+	fmt.Print("Enter facility name (empty for all): ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+	if facilityName != "" {
+		if err := validate.ValidateFacilityName(facilityName); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	fmt.Print("Output as text or json? (text): ")
+	format, _ := reader.ReadString('\n')
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != "" && format != "text" && format != "json" {
+		fmt.Printf("Error: unknown output %q (use text or json)\n", format)
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:       common.OpHeatmap,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facilityName,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Printf("Error: %s\n", reply.Data)
+		return
+	}
+	h, ok, err := common.HeatmapOf(*reply)
+	switch {
+	case err != nil:
+		fmt.Printf("Error: malformed heatmap: %v\n", err)
+	case !ok:
+		fmt.Println(reply.Data)
+	case format == "json":
+		days := make([]string, len(h))
+		for d := range days {
+			days[d] = common.ShortDayName(uint8(d))
+		}
+		out, _ := json.Marshal(struct {
+			Facility string         `json:"facility,omitempty"`
+			Days     []string       `json:"days"`
+			Minutes  common.Heatmap `json:"minutes"`
+		}{facilityName, days, h})
+		fmt.Println(string(out))
+	default:
+		fmt.Printf("\n%s\n(booked minutes per hour: . none, : up to 15, + up to 30, * up to 45, # up to 60)\n", reply.Data)
+		renderHeatmap(os.Stdout, h)
+	}
+}
+
+// renderHeatmap draws one row per day with an hour scale above it, each
+// cell as wide as its hour label.
+func renderHeatmap(w io.Writer, h common.Heatmap) {
+	var scale strings.Builder
+	scale.WriteString("   ")
+	for hour := 0; hour < 24; hour++ {
+		fmt.Fprintf(&scale, " %02d", hour)
+	}
+	fmt.Fprintln(w, scale.String())
+	for d, day := range h {
+		row := []byte(common.ShortDayName(uint8(d)))
+		for _, minutes := range day {
+			shade := heatShades[(int(minutes)+14)/15]
+			row = append(row, ' ', shade, shade)
+		}
+		fmt.Fprintln(w, string(row))
+	}
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestRenderHeatmap(t *testing.T) {
+	var h common.Heatmap
+	h[0][0], h[0][1], h[0][2], h[0][3], h[0][4] = 1, 15, 16, 45, 60
+	var out bytes.Buffer
+	renderHeatmap(&out, h)
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 9 || !strings.HasPrefix(lines[0], "    00 01 02") || !strings.HasSuffix(lines[0], " 23") {
+		t.Fatalf("grid:\n%s", out.String())
+	}
+	if want := "Mon :: :: ++ ** ## .."; !strings.HasPrefix(lines[1], want) {
+		t.Errorf("Monday row %q, want it to start %q", lines[1], want)
+	}
+	if want := "Sun" + strings.Repeat(" ..", 24); lines[7] != want {
+		t.Errorf("Sunday row %q, want %q", lines[7], want)
+	}
+}
+
+// TestHeatmapJSON: the JSON output carries the raw minutes, not shades.
+func TestHeatmapJSON(t *testing.T) {
+	var h common.Heatmap
+	h[2][10] = 45
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		rep := okReply(req, "Booked minutes per hour for 'Lab1'; busiest hour Wed 10:00 with 45 minutes.")
+		rep.Extensions.Put(common.ExtHeatmap, common.AppendHeatmap(nil, h))
+		return rep
+	})
+	c := newTestClient(t, srv.Addr())
+	out := runLine(t, c, "heatmap", "Lab1\njson\n")
+	var got struct {
+		Facility string
+		Days     []string
+		Minutes  [7][24]int
+	}
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if got.Facility != "Lab1" || len(got.Days) != 7 || got.Days[2] != "Wed" || got.Minutes[2][10] != 45 || got.Minutes[2][11] != 0 {
+		t.Errorf("JSON output %+v", got)
+	}
+	if r := srv.received(); len(r) != 1 || r[0].OpCode != common.OpHeatmap || r[0].FacilityName != "Lab1" {
+		t.Errorf("server saw %+v", r)
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Hello performs the OpHello handshake with the current server and returns
+// what it reported. Like Ping it makes a single attempt, so a server that
+// predates OpHello (and silently drops it) costs one attempt timeout.
+func (c *ClientState) Hello() (common.HelloInfo, error) {
+	req := common.RequestMessage{
+		OpCode:            common.OpHello,
+		RequestID:         c.GetNextRequestID(),
+		HelloVersion:      common.ProtocolVersion,
+		HelloCapabilities: c.Capabilities,
+	}
+	data, err := c.encodeRequest(req)
+	if err != nil {
+		return common.HelloInfo{}, fmt.Errorf("error marshalling: %w", err)
+	}
+	sent := time.Now()
+	if err := c.writePacket(data); err != nil {
+		return common.HelloInfo{}, fmt.Errorf("error sending hello: %w", err)
+	}
+
+	deadline := sent.Add(c.attemptTimeout(1))
+	for {
+		raw, err := c.readPacket(deadline)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return common.HelloInfo{}, errNoReply
+			}
+			return common.HelloInfo{}, err
+		}
+		reply, err := c.decodeReply(raw)
+		if err == nil && classifyPacket(reply) == packetCallback {
+			c.handleMonitorPacket(reply)
+			continue
+		}
+		if err != nil || reply.RequestID != req.RequestID {
+			continue // a late reply
+		}
+		c.measureSkew(reply, sent, time.Since(sent))
+		return common.ParseHello(reply)
+	}
+}
+
+// negotiate runs the handshake once per server connection and records the
+// server's features. A server that does not answer is treated as protocol
+// version 0: optional features the client would otherwise use are skipped.
+func (c *ClientState) negotiate() {
+	if c.negotiated {
+		return
+	}
+	c.negotiated = true
+	info, err := c.Hello()
+	if err != nil {
+		c.server = common.HelloInfo{}
+		fmt.Printf("Server %s did not complete the hello handshake (%v); assuming a server without optional features.\n",
+			c.ActiveServer(), err)
+		return
+	}
+	c.server = info
+	if c.clockMeasured && (c.clockOffset >= time.Second || c.clockOffset <= -time.Second) {
+		fmt.Printf("Server %s clock is %s; request timestamps are corrected.\n", c.ActiveServer(), describeSkew(c.clockOffset))
+	}
+	if c.SemanticsHint != common.HintServerDefault && info.Capabilities&common.CapSemanticsHint == 0 {
+		fmt.Printf("Warning: server %s runs %s only; the semantics hint will be rejected.\n",
+			c.ActiveServer(), info.Semantics)
+	}
+}
+
+// serverSupports reports whether the negotiated server advertised cap.
+// Before the handshake it optimistically returns true.
+func (c *ClientState) serverSupports(cap uint8) bool {
+	return !c.negotiated || c.server.Capabilities&cap != 0
+}
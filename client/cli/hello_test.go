@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestNegotiation(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	c.Capabilities = common.CapGzip
+
+	for i := 0; i < 3; i++ {
+		if _, err := query(c, "RoomA"); err != nil {
+			t.Fatalf("query: %v", err)
+		}
+	}
+	if n := srv.hellos.Load(); n != 1 {
+		t.Errorf("%d handshakes, want 1 per connection", n)
+	}
+	if c.server != srv.hello {
+		t.Errorf("negotiated %+v, want %+v", c.server, srv.hello)
+	}
+	if got := srv.received()[0].Capabilities; got != common.CapGzip {
+		t.Errorf("request advertised %#x, want gzip", got)
+	}
+}
+
+// TestNewerServer talks to a server of a later protocol version with
+// features this client doesn't know.
+func TestNewerServer(t *testing.T) {
+	srv := newFakeServer(t, batchHandler, func(f *fakeServer) {
+		f.hello.ProtocolVersion = common.ProtocolVersion + 5
+		f.hello.Capabilities = 0xFF
+	})
+	c := newTestClient(t, srv.Addr())
+	if _, err := c.SendBatch(participantReqs("Ada", "Grace")); err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+	if c.server.ProtocolVersion != common.ProtocolVersion+5 {
+		t.Errorf("negotiated protocol %d", c.server.ProtocolVersion)
+	}
+	if got := srv.received(); len(got) != 1 || got[0].OpCode != common.OpBatch {
+		t.Errorf("server saw %d requests, want one batch", len(got))
+	}
+}
+
+// TestOlderServer talks to a server that predates OpHello: the handshake
+// times out once, then requests go without optional features.
+func TestOlderServer(t *testing.T) {
+	srv := newFakeServer(t, batchHandler, func(f *fakeServer) { f.oldServer = true })
+	c := newTestClient(t, srv.Addr())
+	c.Capabilities = common.CapGzip
+
+	replies, err := c.SendBatch(participantReqs("Ada", "Grace"))
+	if err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("%d replies, want 2", len(replies))
+	}
+	if c.server.ProtocolVersion != 0 || c.serverSupports(common.CapBatch) {
+		t.Errorf("negotiated %+v, want version 0 without features", c.server)
+	}
+	got := srv.received()
+	if len(got) != 2 || got[0].OpCode != common.OpAddParticipant {
+		t.Fatalf("server saw %+v, want the entries one by one", got)
+	}
+	for _, req := range got {
+		if req.Capabilities != 0 {
+			t.Errorf("request to an old server advertised %#x", req.Capabilities)
+		}
+	}
+	if n := srv.hellos.Load(); n != 1 {
+		t.Errorf("%d handshakes, want 1", n)
+	}
+}
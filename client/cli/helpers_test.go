@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// fakeServer is a UDP server on loopback that speaks the booking protocol.
+// It answers OpHello itself and passes every other request to handle; a nil
+// reply is dropped, as a lost packet would be.
+type fakeServer struct {
+	t        *testing.T
+	conn     *net.UDPConn
+	ip       net.IP // loopback address to listen on
+	handle   func(common.RequestMessage) *common.ReplyMessage
+	security common.PacketSecurity
+	hello    common.HelloInfo
+	mangle   func([]byte) []byte // applied to every sealed packet sent
+	clock    time.Duration       // how far the server clock is ahead
+
+	silent    atomic.Bool  // record requests but answer nothing, hello included
+	oldServer bool         // predates OpHello and drops it unanswered
+	hellos    atomic.Int32 // OpHello requests received
+
+	mu       sync.Mutex
+	requests []common.RequestMessage
+	client   *net.UDPAddr // sender of the last request
+}
+
+// newFakeServer starts a fake server that stops when the test ends. The
+// options adjust it before it starts serving.
+func newFakeServer(t *testing.T, handle func(common.RequestMessage) *common.ReplyMessage, opts ...func(*fakeServer)) *fakeServer {
+	t.Helper()
+	f := &fakeServer{
+		t:      t,
+		ip:     net.IPv4(127, 0, 0, 1),
+		handle: handle,
+		hello: common.HelloInfo{
+			ProtocolVersion: common.ProtocolVersion,
+			Capabilities:    common.CapBatch | common.CapSessions | common.CapSemanticsHint,
+			Semantics:       "at-most-once",
+			ServerVersion:   "fake",
+		},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: f.ip})
+	if err != nil && f.ip.To4() == nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f.conn = conn
+	t.Cleanup(func() { conn.Close() })
+	go f.serve()
+	return f
+}
+
+// Addr returns the "host:port" clients dial.
+func (f *fakeServer) Addr() string {
+	return f.conn.LocalAddr().String()
+}
+
+func (f *fakeServer) serve() {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := f.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		payload, _, err := common.SplitLength(buf[:n])
+		if err != nil {
+			continue
+		}
+		body, err := f.security.Open(payload)
+		if err != nil {
+			continue
+		}
+		req, err := common.UnmarshalRequest(body)
+		if err != nil {
+			continue
+		}
+
+		var rep *common.ReplyMessage
+		if req.OpCode == common.OpHello {
+			f.hellos.Add(1)
+		} else {
+			f.mu.Lock()
+			f.requests = append(f.requests, req)
+			f.client = from
+			f.mu.Unlock()
+		}
+		switch {
+		case f.silent.Load():
+		case req.OpCode == common.OpHello && f.oldServer:
+		case req.OpCode == common.OpHello:
+			hello := common.HelloReply(req.RequestID, f.hello)
+			hello.ServerClock = f.now().UnixMilli()
+			rep = &hello
+		case f.handle != nil:
+			rep = f.handle(req)
+		}
+		if rep != nil {
+			f.sendTo(from, *rep)
+		}
+	}
+}
+
+// now is the fake server's clock.
+func (f *fakeServer) now() time.Time {
+	return time.Now().Add(f.clock)
+}
+
+// sendTo marshals rep and sends it to addr, as a reply or a callback.
+func (f *fakeServer) sendTo(addr *net.UDPAddr, rep common.ReplyMessage) {
+	data, err := common.MarshalReply(rep)
+	if err != nil {
+		f.t.Errorf("marshal reply: %v", err)
+		return
+	}
+	if data, err = f.security.Seal(data); err != nil {
+		f.t.Errorf("seal reply: %v", err)
+		return
+	}
+	if f.mangle != nil {
+		data = f.mangle(data)
+	}
+	f.conn.WriteToUDP(common.PrefixLength(data), addr)
+}
+
+// callback sends an unsolicited packet to the client that sent the last
+// request.
+func (f *fakeServer) callback(rep common.ReplyMessage) {
+	f.mu.Lock()
+	addr := f.client
+	f.mu.Unlock()
+	if addr == nil {
+		f.t.Fatal("callback before any request")
+	}
+	f.sendTo(addr, rep)
+}
+
+// received returns the requests other than OpHello seen so far.
+func (f *fakeServer) received() []common.RequestMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]common.RequestMessage(nil), f.requests...)
+}
+
+// okReply answers req with StatusOK and data.
+func okReply(req common.RequestMessage, data string) *common.ReplyMessage {
+	return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusOK, Data: data}
+}
+
+// echoHandler answers every request with StatusOK.
+func echoHandler(req common.RequestMessage) *common.ReplyMessage {
+	return okReply(req, "ok")
+}
+
+// newTestClient returns a client with short timeouts connected to the first
+// of addrs.
+func newTestClient(t *testing.T, addrs ...string) *ClientState {
+	t.Helper()
+	c := &ClientState{
+		ServerAddrs: addrs,
+		Timeout:     50 * time.Millisecond,
+		Retries:     2,
+		NextReqID:   InitialRequestID(),
+		Transport:   TransportUDP,
+		IPFamily:    FamilyAuto,
+	}
+	if err := c.Connect(0); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// query sends a QueryAvailability of facility through c.
+func query(c *ClientState, facility string) (*common.ReplyMessage, error) {
+	return c.SendRequest(common.RequestMessage{
+		OpCode:       common.OpQueryAvailability,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facility,
+		DaysList:     []uint8{0},
+	})
+}
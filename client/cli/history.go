@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// historyEntry records one command run from the menu.
+type historyEntry struct {
+	At      time.Time
+	Command string
+	Inputs  []string // answers to the command's prompts, in order
+	Outcome string
+}
+
+// lineSource hands a command its input one line per Read, so a
+// bufio.Reader on top of it never reads ahead of the prompts. It records
+// every answer and, when re-running a history entry, shows the previous
+// answer to each prompt and uses it when the user just presses Enter.
+type lineSource struct {
+	in       *bufio.Reader
+	defaults []string
+	recorded []string
+	pending  []byte
+}
+
+func (s *lineSource) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		i := len(s.recorded)
+		if i < len(s.defaults) && s.defaults[i] != "" {
+			fmt.Printf("[%s] ", s.defaults[i])
+		}
+		line, err := s.in.ReadString('\n')
+		if line == "" && err != nil {
+			return 0, err
+		}
+		answer := strings.TrimRight(line, "\r\n")
+		if answer == "" && i < len(s.defaults) {
+			answer = s.defaults[i]
+		}
+		s.recorded = append(s.recorded, answer)
+		s.pending = []byte(answer + "\n")
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// recordOutcome remembers how the latest request ended, for the history.
+func (c *ClientState) recordOutcome(reply *common.ReplyMessage, err error) {
+	switch {
+	case err != nil:
+		c.lastOutcome = "failed: " + err.Error()
+	case reply.Status == common.StatusOK:
+		c.lastOutcome = "ok"
+	default:
+		msg, _, _ := strings.Cut(reply.Data, "\n")
+		c.lastOutcome = "error: " + msg
+	}
+}
+
+// runCommand runs a menu command on recorded input and adds it to the
+// history. defaults are the answers of an earlier run being repeated.
+func (c *ClientState) runCommand(reader *bufio.Reader, cmd menuCommand, defaults []string) {
+	src := &lineSource{in: reader, defaults: defaults}
+	c.lastOutcome = ""
+	cmd.run(c, bufio.NewReader(src))
+
+	entry := historyEntry{At: time.Now(), Command: cmd.name, Inputs: src.recorded, Outcome: c.lastOutcome}
+	if cmd.secret {
+		entry.Inputs = nil
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = "done"
+	}
+	c.history = append(c.history, entry)
+}
+
+// printHistory lists this session's commands.
+func (c *ClientState) printHistory() {
+	if len(c.history) == 0 {
+		fmt.Println("No commands run yet.")
+		return
+	}
+	fmt.Println("\nHistory (run an entry again with !N):")
+	for i, e := range c.history {
+		inputs := ""
+		if len(e.Inputs) > 0 {
+			inputs = " [" + strings.Join(e.Inputs, " | ") + "]"
+		}
+		fmt.Printf("%d. %s %s%s -> %s\n", i+1, e.At.Format("15:04:05"), e.Command, inputs, e.Outcome)
+	}
+}
+
+// rerun runs history entry n (as typed after "!") again, offering the
+// previous answers as defaults.
+func (c *ClientState) rerun(reader *bufio.Reader, n string) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(c.history) {
+		fmt.Printf("No history entry %q.\n", n)
+		return
+	}
+	entry := c.history[i-1]
+	cmd, _ := lookupCommand(entry.Command)
+	fmt.Printf("Running %s again; press Enter to keep the answer in brackets.\n", cmd.name)
+	c.runCommand(reader, cmd, entry.Inputs)
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// runLine runs the menu command name on the given input lines.
+func runLine(t *testing.T, c *ClientState, name, input string) string {
+	t.Helper()
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		t.Fatalf("no command %q", name)
+	}
+	return captureStdout(t, func() { c.runCommand(bufio.NewReader(strings.NewReader(input)), cmd, nil) })
+}
+
+func TestHistoryRecordsCommands(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.FacilityName == "Nowhere" {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusError,
+				Data: "Facility 'Nowhere' not found\nKnown facilities: RoomA"}
+		}
+		return okReply(req, "Booked. ID=BKG-1")
+	})
+	c := newTestClient(t, srv.Addr())
+
+	runLine(t, c, "book", "RoomA\nMon 09:00-10:00\n")
+	runLine(t, c, "2", "Nowhere\nMon 09:00-10:00\n")
+	runLine(t, c, "book", "RoomA\nMon 10:00-09:00\n\n")
+	runLine(t, c, "login", "alice\nsecret\n")
+
+	want := []historyEntry{
+		{Command: "book", Inputs: []string{"RoomA", "Mon 09:00-10:00"}, Outcome: "ok"},
+		{Command: "book", Inputs: []string{"Nowhere", "Mon 09:00-10:00"}, Outcome: "error: Facility 'Nowhere' not found"},
+		{Command: "book", Inputs: []string{"RoomA", "Mon 10:00-09:00", ""}, Outcome: "done"},
+		{Command: "register", Inputs: nil},
+	}
+	if len(c.history) != len(want) {
+		t.Fatalf("%d history entries, want %d: %+v", len(c.history), len(want), c.history)
+	}
+	for i, w := range want {
+		got := c.history[i]
+		if got.At.IsZero() || got.Command != w.Command || !reflect.DeepEqual(got.Inputs, w.Inputs) {
+			t.Errorf("entry %d = %+v, want %+v", i+1, got, w)
+		}
+		if w.Outcome != "" && got.Outcome != w.Outcome {
+			t.Errorf("entry %d outcome %q, want %q", i+1, got.Outcome, w.Outcome)
+		}
+	}
+
+	out := captureStdout(t, c.printHistory)
+	if !strings.Contains(out, "1. ") || !strings.Contains(out, "book [RoomA | Mon 09:00-10:00] -> ok") {
+		t.Errorf("history listing:\n%s", out)
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("history shows a password:\n%s", out)
+	}
+}
+
+func TestRerunPrefillsAnswers(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return okReply(req, "Booked. ID=BKG-1")
+	})
+	c := newTestClient(t, srv.Addr())
+	runLine(t, c, "book", "RoomA\nMon 09:00-10:00\n")
+
+	// Enter keeps the facility; only the time is typed again
+	out := captureStdout(t, func() { c.rerun(bufio.NewReader(strings.NewReader("\nTue 14:00-15:00\n")), "1") })
+	if !strings.Contains(out, "[RoomA]") || !strings.Contains(out, "[Mon 09:00-10:00]") {
+		t.Errorf("previous answers not shown:\n%s", out)
+	}
+	got := srv.received()
+	if len(got) != 2 {
+		t.Fatalf("server saw %d requests, want 2", len(got))
+	}
+	if r := got[1]; r.FacilityName != "RoomA" || r.StartDay != 1 || r.StartHour != 14 || r.EndHour != 15 {
+		t.Errorf("re-run sent %+v, want RoomA on Tuesday 14:00-15:00", r)
+	}
+	if e := c.history[1]; e.Command != "book" || !reflect.DeepEqual(e.Inputs, []string{"RoomA", "Tue 14:00-15:00"}) {
+		t.Errorf("re-run recorded as %+v", e)
+	}
+
+	// Enter throughout repeats the command as it was
+	captureStdout(t, func() { c.rerun(bufio.NewReader(strings.NewReader("\n\n")), "2") })
+	if got := srv.received(); len(got) != 3 || got[2].StartDay != 1 || got[2].StartHour != 14 {
+		t.Errorf("second re-run sent %+v", got[len(got)-1])
+	}
+
+	for _, n := range []string{"0", "4", "x"} {
+		out := captureStdout(t, func() { c.rerun(bufio.NewReader(strings.NewReader("")), n) })
+		if !strings.Contains(out, "No history entry") {
+			t.Errorf("rerun %q printed:\n%s", n, out)
+		}
+	}
+}
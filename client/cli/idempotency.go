@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// newIdempotencyKey returns a random key for one logical booking. The
+// request carrying it is resent unchanged on every retry and failover, so
+// the server can tell a retry of a booking that already succeeded from a
+// new one.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Still unique enough within one client
+		return fmt.Sprintf("t%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestIdempotencyKeyRetried: every retry of one booking carries the same
+// key, and the next booking a new one.
+func TestIdempotencyKeyRetried(t *testing.T) {
+	var books atomic.Int32
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if books.Add(1) == 1 {
+			return nil // the first attempt's reply is lost
+		}
+		return okReply(req, "Booked. ID=BKG-1")
+	})
+	c := newTestClient(t, srv.Addr())
+	runLine(t, c, "book", "RoomA\nMon 09:00-10:00\n")
+	runLine(t, c, "book", "RoomA\nTue 09:00-10:00\n")
+
+	got := srv.received()
+	if len(got) != 3 {
+		t.Fatalf("server saw %d requests, want a retried booking and another", len(got))
+	}
+	if got[0].IdempotencyKey == "" || got[1].IdempotencyKey != got[0].IdempotencyKey {
+		t.Errorf("retry sent key %q after %q", got[1].IdempotencyKey, got[0].IdempotencyKey)
+	}
+	if got[2].IdempotencyKey == got[0].IdempotencyKey {
+		t.Errorf("second booking reused key %q", got[0].IdempotencyKey)
+	}
+}
@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// BookingRow is one line of a booking import file:
+// facility,startDay,startTime,endDay,endTime,title with days as names or
+// 0-6 and times as HH:MM, an end also as 24:00. The title is not part of
+// the protocol; it is only copied to the results file.
+type BookingRow struct {
+	Line     int
+	Facility string
+	Title    string
+	Start    [3]uint8 // day, hour, minute
+	End      [3]uint8
+	Err      error // set when the row failed local validation
+}
+
+// ImportResult counts the rows of one import run.
+type ImportResult struct {
+	Booked, Failed, Skipped int
+}
+
+var errImportAborted = errors.New("aborted by -failFast")
+
+// ParseBookingCSV reads an import file. Malformed rows are returned with Err
+// set rather than stopping the parse; only an unreadable file is an error.
+// A first record starting with "facility" is taken as a header and skipped.
+func ParseBookingCSV(r io.Reader) ([]BookingRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	rows := make([]BookingRow, 0)
+	for first := true; ; first = false {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, BookingRow{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(strings.TrimSpace(fields[0]), "facility") {
+			continue
+		}
+		row := parseBookingRow(fields)
+		row.Line, _ = cr.FieldPos(0)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseBookingRow validates one record with the checks the interactive book
+// command and the server make.
+func parseBookingRow(fields []string) BookingRow {
+	var row BookingRow
+	if len(fields) < 5 || len(fields) > 6 {
+		row.Err = fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
+		return row
+	}
+	row.Facility = strings.TrimSpace(fields[0])
+	if err := validate.ValidateFacilityName(row.Facility); err != nil {
+		row.Err = err
+		return row
+	}
+	if len(fields) == 6 {
+		row.Title = strings.TrimSpace(fields[5])
+	}
+
+	var err error
+	if row.Start, err = parseDayTime(fields[1], fields[2], false); err != nil {
+		row.Err = fmt.Errorf("start: %w", err)
+		return row
+	}
+	if row.End, err = parseDayTime(fields[3], fields[4], true); err != nil {
+		row.Err = fmt.Errorf("end: %w", err)
+		return row
+	}
+	row.Err = validate.ValidateBookingTimes(row.Start[0], row.Start[1], row.Start[2], row.End[0], row.End[1], row.End[2])
+	return row
+}
+
+// parseDayTime parses a day (a name, or 0=Monday..6=Sunday) and an HH:MM
+// time. An end may be 24:00, which becomes 00:00 of the next day.
+func parseDayTime(dayStr, timeStr string, end bool) ([3]uint8, error) {
+	day, err := common.ParseDay(dayStr)
+	if err != nil {
+		return [3]uint8{}, err
+	}
+	if end && strings.TrimSpace(timeStr) == "24:00" {
+		return [3]uint8{day + 1, 0, 0}, nil
+	}
+	hh, mm, ok := strings.Cut(strings.TrimSpace(timeStr), ":")
+	hour, errH := strconv.Atoi(hh)
+	minute, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || hour < 0 || hour > validate.MaxHour || minute < 0 || minute > validate.MaxMinute {
+		return [3]uint8{}, fmt.Errorf("invalid time %q, expected HH:MM", timeStr)
+	}
+	return [3]uint8{day, uint8(hour), uint8(minute)}, nil
+}
+
+// bookingRequest builds the OpBookFacility request for a valid row, with
+// its own idempotency key.
+func (r BookingRow) bookingRequest() common.RequestMessage {
+	return common.RequestMessage{
+		OpCode:         common.OpBookFacility,
+		FacilityName:   r.Facility,
+		StartDay:       r.Start[0],
+		StartHour:      r.Start[1],
+		StartMinute:    r.Start[2],
+		EndDay:         r.End[0],
+		EndHour:        r.End[1],
+		EndMinute:      r.End[2],
+		IdempotencyKey: newIdempotencyKey(),
+	}
+}
+
+// confirmationIDFromReply extracts the ID from a successful book reply,
+// which ends with "ID=<confirmation ID>".
+func confirmationIDFromReply(data string) string {
+	if i := strings.LastIndex(data, "ID="); i >= 0 {
+		return strings.TrimSpace(data[i+len("ID="):])
+	}
+	return ""
+}
+
+// ImportBookings books every valid row of an import file and writes one
+// results line per row: line, facility, title, status, confirmation ID and
+// error. Rows are sent in batches (one by one to servers without batching).
+// A failed row does not stop the run unless failFast is set; then nothing is
+// sent if any row is malformed, and sending stops at the first rejected
+// booking. Rows that were never sent, including those after a request that
+// got no reply, are reported as skipped.
+func (c *ClientState) ImportBookings(in io.Reader, out io.Writer, failFast bool) (ImportResult, error) {
+	var res ImportResult
+	rows, err := ParseBookingCSV(in)
+	if err != nil {
+		return res, err
+	}
+
+	// Results are collected per row and written in file order at the end
+	results := make([][]string, len(rows))
+	record := func(i int, status, id string, rowErr error) {
+		msg := ""
+		if rowErr != nil {
+			msg = rowErr.Error()
+		}
+		r := rows[i]
+		results[i] = []string{strconv.Itoa(r.Line), r.Facility, r.Title, status, id, msg}
+	}
+
+	aborted := false
+	if failFast {
+		for _, r := range rows {
+			if r.Err != nil {
+				aborted = true
+				break
+			}
+		}
+	}
+
+	chunk := common.MaxBatchEntries
+	if failFast {
+		chunk = 1
+	}
+	pending := make([]int, 0, chunk)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		reqs := make([]common.RequestMessage, len(pending))
+		for j, i := range pending {
+			reqs[j] = rows[i].bookingRequest()
+		}
+		replies, err := c.SendBatch(reqs)
+		if err != nil {
+			return err
+		}
+		for j, reply := range replies {
+			if reply.Status == common.StatusOK {
+				id := confirmationIDFromReply(reply.Data)
+				c.rememberBooking(id, reply.Data)
+				record(pending[j], "booked", id, nil)
+				res.Booked++
+				continue
+			}
+			record(pending[j], "failed", "", errors.New(reply.Data))
+			res.Failed++
+			if failFast {
+				aborted = true
+			}
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	var sendErr error
+	for i, r := range rows {
+		switch {
+		case r.Err != nil:
+			record(i, "invalid", "", r.Err)
+			res.Failed++
+		case aborted || sendErr != nil:
+			reason := errImportAborted
+			if sendErr != nil {
+				reason = sendErr
+			}
+			record(i, "skipped", "", reason)
+			res.Skipped++
+		default:
+			pending = append(pending, i)
+			if len(pending) == chunk {
+				sendErr = flush()
+			}
+		}
+	}
+	if sendErr == nil {
+		sendErr = flush()
+	}
+	for _, i := range pending {
+		record(i, "skipped", "", sendErr)
+		res.Skipped++
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"line", "facility", "title", "status", "confirmationId", "error"})
+	w.WriteAll(results)
+	if err := w.Error(); err != nil {
+		return res, err
+	}
+	return res, sendErr
+}
+
+// ImportBookingsFile runs ImportBookings from one file into another. An
+// empty results path writes next to the input as <input>.results.csv.
+func (c *ClientState) ImportBookingsFile(inPath, outPath string, failFast bool) (ImportResult, error) {
+	if outPath == "" {
+		outPath = strings.TrimSuffix(inPath, ".csv") + ".results.csv"
+	}
+	in, err := os.Open(inPath)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer in.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	res, err := c.ImportBookings(in, out, failFast)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		fmt.Printf("Booked %d, failed %d, skipped %d. Results written to %s\n",
+			res.Booked, res.Failed, res.Skipped, outPath)
+	}
+	return res, err
+}
+
+// handleImport implements the import command.
+func (c *ClientState) handleImport(reader *bufio.Reader) {
+	fmt.Print("Enter CSV file (facility,startDay,startTime,endDay,endTime,title): ")
+	inPath, _ := reader.ReadString('\n')
+	inPath = strings.TrimSpace(inPath)
+	if inPath == "" {
+		fmt.Println("No file given")
+		return
+	}
+	fmt.Print("Enter results file (default <file>.results.csv): ")
+	outPath, _ := reader.ReadString('\n')
+	fmt.Print("Stop at the first failure? (y/N): ")
+	answer, _ := reader.ReadString('\n')
+	failFast := strings.EqualFold(strings.TrimSpace(answer), "y")
+
+	if _, err := c.ImportBookingsFile(inPath, strings.TrimSpace(outPath), failFast); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
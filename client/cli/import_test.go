@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestParseBookingCSV(t *testing.T) {
+	in := `facility,startDay,startTime,endDay,endTime,title
+RoomA,Mon,09:00,Mon,10:30,Standup
+# a comment
+RoomB,2,23:00,Wed,24:00
+RoomA,Mon,09:00
+RoomA,Funday,09:00,Mon,10:00
+RoomA,Mon,9h,Mon,10:00
+RoomA,Mon,10:00,Mon,25:00
+RoomA,Mon,11:00,Mon,10:00
+,Mon,09:00,Mon,10:00
+RoomA,Sun,22:00,Sun,24:00,"Late, long"
+`
+	rows, err := ParseBookingCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBookingCSV: %v", err)
+	}
+	tests := []struct {
+		line       int
+		facility   string
+		title      string
+		start, end [3]uint8
+		wantErr    string
+	}{
+		{line: 2, facility: "RoomA", title: "Standup", start: [3]uint8{0, 9, 0}, end: [3]uint8{0, 10, 30}},
+		{line: 4, facility: "RoomB", start: [3]uint8{2, 23, 0}, end: [3]uint8{3, 0, 0}},
+		{line: 5, wantErr: "expected 5 or 6 fields"},
+		{line: 6, facility: "RoomA", wantErr: "start: unknown day"},
+		{line: 7, facility: "RoomA", wantErr: "start: invalid time"},
+		{line: 8, facility: "RoomA", wantErr: "end: invalid time"},
+		{line: 9, facility: "RoomA", wantErr: "is not after the start"},
+		{line: 10, wantErr: "FacilityName is empty"},
+		{line: 11, facility: "RoomA", title: "Late, long", start: [3]uint8{6, 22, 0}, end: [3]uint8{7, 0, 0}},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("%d rows, want %d: %+v", len(rows), len(tests), rows)
+	}
+	for i, tt := range tests {
+		r := rows[i]
+		if r.Line != tt.line {
+			t.Errorf("row %d: line %d, want %d", i, r.Line, tt.line)
+		}
+		if tt.wantErr != "" {
+			if r.Err == nil || !strings.Contains(r.Err.Error(), tt.wantErr) {
+				t.Errorf("line %d: err = %v, want %q", tt.line, r.Err, tt.wantErr)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("line %d: %v", tt.line, r.Err)
+			continue
+		}
+		if r.Facility != tt.facility || r.Title != tt.title || r.Start != tt.start || r.End != tt.end {
+			t.Errorf("line %d = %+v, want %s %q %v-%v", tt.line, r, tt.facility, tt.title, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseBookingCSVBadQuoting(t *testing.T) {
+	rows, err := ParseBookingCSV(strings.NewReader("RoomA,Mon,09:00,Mon,10:00,\"open\n"))
+	if err != nil {
+		t.Fatalf("ParseBookingCSV: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Err == nil {
+		t.Fatalf("rows = %+v, want one row with a quoting error", rows)
+	}
+}
+
+// bookingHandler books every batch entry except those of facility Busy,
+// numbering the confirmations in the order it sees them.
+func bookingHandler() func(common.RequestMessage) *common.ReplyMessage {
+	var next atomic.Int32
+	answer := func(r common.RequestMessage) common.ReplyMessage {
+		if r.FacilityName == "Busy" {
+			return common.ReplyMessage{RequestID: r.RequestID, OpCode: r.OpCode, Status: common.StatusError, Data: "Error: time slot unavailable"}
+		}
+		return *okReply(r, fmt.Sprintf("Booked %s. ID=BKG-%d", r.FacilityName, next.Add(1)))
+	}
+	return func(req common.RequestMessage) *common.ReplyMessage {
+		if req.OpCode != common.OpBatch {
+			rep := answer(req)
+			return &rep
+		}
+		rep := okReply(req, "")
+		for _, e := range req.Batch {
+			rep.Replies = append(rep.Replies, answer(e))
+		}
+		return rep
+	}
+}
+
+const importFile = `RoomA,Mon,09:00,Mon,10:00,First
+RoomA,Funday,09:00,Mon,10:00,Broken
+Busy,Tue,09:00,Tue,10:00,Taken
+RoomB,Wed,09:00,Wed,10:00,Last
+`
+
+// results parses the results file, without its header.
+func results(t *testing.T, out *bytes.Buffer) [][]string {
+	t.Helper()
+	recs, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatalf("results file: %v", err)
+	}
+	if len(recs) == 0 || recs[0][0] != "line" {
+		t.Fatalf("results file has no header: %q", recs)
+	}
+	return recs[1:]
+}
+
+func TestImportBookings(t *testing.T) {
+	srv := newFakeServer(t, bookingHandler())
+	c := newTestClient(t, srv.Addr())
+
+	var out bytes.Buffer
+	res, err := c.ImportBookings(strings.NewReader(importFile), &out, false)
+	if err != nil {
+		t.Fatalf("ImportBookings: %v", err)
+	}
+	if want := (ImportResult{Booked: 2, Failed: 2}); res != want {
+		t.Errorf("result = %+v, want %+v", res, want)
+	}
+	got := srv.received()
+	if len(got) != 1 || got[0].OpCode != common.OpBatch || len(got[0].Batch) != 3 {
+		t.Fatalf("server saw %+v, want one batch of the 3 valid rows", got)
+	}
+	keys := make(map[string]bool)
+	for _, e := range got[0].Batch {
+		if e.OpCode != common.OpBookFacility || e.IdempotencyKey == "" || keys[e.IdempotencyKey] {
+			t.Errorf("entry %+v, want a booking with its own idempotency key", e)
+		}
+		keys[e.IdempotencyKey] = true
+	}
+
+	recs := results(t, &out)
+	var status, ids []string
+	for _, r := range recs {
+		status = append(status, r[3])
+		ids = append(ids, r[4])
+	}
+	if want := []string{"booked", "invalid", "failed", "booked"}; !reflect.DeepEqual(status, want) {
+		t.Errorf("statuses = %q, want %q", status, want)
+	}
+	if want := []string{"BKG-1", "", "", "BKG-2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("confirmation IDs = %q, want %q", ids, want)
+	}
+	if recs[0][2] != "First" || recs[2][5] != "Error: time slot unavailable" {
+		t.Errorf("results = %q", recs)
+	}
+	if !c.myBookings["BKG-1"] || !c.myBookings["BKG-2"] {
+		t.Errorf("booked rows not remembered: %v", c.myBookings)
+	}
+}
+
+func TestImportBookingsFailFast(t *testing.T) {
+	t.Run("malformed row", func(t *testing.T) {
+		srv := newFakeServer(t, bookingHandler())
+		c := newTestClient(t, srv.Addr())
+		var out bytes.Buffer
+		res, err := c.ImportBookings(strings.NewReader(importFile), &out, true)
+		if err != nil {
+			t.Fatalf("ImportBookings: %v", err)
+		}
+		if want := (ImportResult{Failed: 1, Skipped: 3}); res != want {
+			t.Errorf("result = %+v, want %+v", res, want)
+		}
+		if n := len(srv.received()); n != 0 {
+			t.Errorf("server saw %d requests, want none", n)
+		}
+	})
+	t.Run("rejected booking", func(t *testing.T) {
+		srv := newFakeServer(t, bookingHandler())
+		c := newTestClient(t, srv.Addr())
+		file := strings.Replace(importFile, "RoomA,Funday,09:00,Mon,10:00,Broken\n", "", 1)
+		var out bytes.Buffer
+		res, err := c.ImportBookings(strings.NewReader(file), &out, true)
+		if err != nil {
+			t.Fatalf("ImportBookings: %v", err)
+		}
+		if want := (ImportResult{Booked: 1, Failed: 1, Skipped: 1}); res != want {
+			t.Errorf("result = %+v, want %+v", res, want)
+		}
+		if n := len(srv.received()); n != 2 {
+			t.Errorf("server saw %d requests, want the rows up to the rejected one", n)
+		}
+		if recs := results(t, &out); recs[2][3] != "skipped" || recs[2][5] != errImportAborted.Error() {
+			t.Errorf("last row = %q, want skipped", recs[2])
+		}
+	})
+}
+
+func TestImportBookingsNoReply(t *testing.T) {
+	srv := newFakeServer(t, bookingHandler())
+	srv.silent.Store(true)
+	c := newTestClient(t, srv.Addr())
+	var out bytes.Buffer
+	res, err := c.ImportBookings(strings.NewReader(importFile), &out, false)
+	if err == nil {
+		t.Fatal("import against a silent server succeeded")
+	}
+	if want := (ImportResult{Failed: 1, Skipped: 3}); res != want {
+		t.Errorf("result = %+v, want %+v", res, want)
+	}
+}
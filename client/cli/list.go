@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// nextPage reads the "Next=<offset>" line that ends a ListBookings reply
+// with more bookings to come, and returns the reply without it.
+func nextPage(data string) (string, uint32, bool) {
+	body := strings.TrimRight(data, "\n")
+	i := strings.LastIndex(body, "\n")
+	last := body[i+1:]
+	if !strings.HasPrefix(last, "Next=") {
+		return data, 0, false
+	}
+	next, err := strconv.ParseUint(strings.TrimPrefix(last, "Next="), 10, 32)
+	if err != nil {
+		return data, 0, false
+	}
+	if i < 0 {
+		return "", uint32(next), true
+	}
+	return body[:i+1], uint32(next), true
+}
+
+// handleListBookings prints every booking of a facility in start order,
+// fetching one page per request until the server sends no Next= field or
+// -maxPages is reached.
+func (c *ClientState) handleListBookings(reader *bufio.Reader) {
+	fmt.Print("Enter facility name: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+
+	var offset uint32
+	for page := 1; ; page++ {
+		reply, err := c.SendRequest(common.RequestMessage{
+			OpCode:       common.OpListBookings,
+			RequestID:    c.GetNextRequestID(),
+			FacilityName: facilityName,
+			PageOffset:   offset,
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		body, next, more := nextPage(reply.Data)
+		fmt.Print(body)
+		if !strings.HasSuffix(body, "\n") {
+			fmt.Println()
+		}
+		if reply.Status != common.StatusOK || !more {
+			return
+		}
+		if c.MaxPages > 0 && page >= c.MaxPages {
+			fmt.Printf("Stopped after %d pages (-maxPages); more bookings follow from %d.\n", page, next)
+			return
+		}
+		offset = next
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		data string
+		body string
+		next uint32
+		more bool
+	}{
+		{"Facility=RoomA, bookings 1-2 of 3:\n  - BKG-1: a\n  - BKG-2: b\nNext=2\n", "Facility=RoomA, bookings 1-2 of 3:\n  - BKG-1: a\n  - BKG-2: b\n", 2, true},
+		{"Facility=RoomA, bookings 3-3 of 3:\n  - BKG-3: c\n", "Facility=RoomA, bookings 3-3 of 3:\n  - BKG-3: c\n", 0, false},
+		{"Next=7", "", 7, true},
+		{"Facility=RoomA has no bookings.", "Facility=RoomA has no bookings.", 0, false},
+		{"  - BKG-1: a\nNext=soon\n", "  - BKG-1: a\nNext=soon\n", 0, false},
+	}
+	for _, tt := range tests {
+		body, next, more := nextPage(tt.data)
+		if body != tt.body || next != tt.next || more != tt.more {
+			t.Errorf("nextPage(%q) = %q, %d, %v; want %q, %d, %v", tt.data, body, next, more, tt.body, tt.next, tt.more)
+		}
+	}
+}
+
+// pagingServer lists n bookings, pageSize a page, like the server does.
+func pagingServer(t *testing.T, n, pageSize int) *fakeServer {
+	return newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		var b strings.Builder
+		end := int(req.PageOffset) + pageSize
+		if end > n {
+			end = n
+		}
+		for i := int(req.PageOffset); i < end; i++ {
+			fmt.Fprintf(&b, "  - BKG-%d: somewhen\n", i)
+		}
+		if end < n {
+			fmt.Fprintf(&b, "Next=%d\n", end)
+		}
+		return okReply(req, b.String())
+	})
+}
+
+func TestListBookingsAllPages(t *testing.T) {
+	srv := pagingServer(t, 120, 50)
+	c := newTestClient(t, srv.Addr())
+	out := runLine(t, c, "list", "RoomA\n")
+	for i := 0; i < 120; i++ {
+		if n := strings.Count(out, fmt.Sprintf("BKG-%d:", i)); n != 1 {
+			t.Errorf("BKG-%d shown %d times", i, n)
+		}
+	}
+	if strings.Contains(out, "Next=") {
+		t.Errorf("continuation shown:\n%s", out)
+	}
+	got := srv.received()
+	if len(got) != 3 {
+		t.Fatalf("%d requests, want 3 pages", len(got))
+	}
+	for i, want := range []uint32{0, 50, 100} {
+		if got[i].PageOffset != want || got[i].FacilityName != "RoomA" {
+			t.Errorf("page %d asked from %d for %q, want %d", i+1, got[i].PageOffset, got[i].FacilityName, want)
+		}
+	}
+}
+
+func TestListBookingsMaxPages(t *testing.T) {
+	srv := pagingServer(t, 120, 50)
+	c := newTestClient(t, srv.Addr())
+	c.MaxPages = 2
+	out := runLine(t, c, "list", "RoomA\n")
+	if n := len(srv.received()); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+	if !strings.Contains(out, "Stopped after 2 pages (-maxPages); more bookings follow from 100.") {
+		t.Errorf("no -maxPages notice:\n%s", out)
+	}
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// menuCommand is one entry of the interactive menu. Its number is its
+// position in menuCommands, starting at 1.
+type menuCommand struct {
+	name    string
+	aliases []string
+	summary string
+	help    string // inputs and typical errors, for "help <command>"
+	run     func(c *ClientState, reader *bufio.Reader)
+	// secret commands are listed in history without their inputs
+	secret bool
+}
+
+// Commands handled by RunCLI itself rather than through run.
+const (
+	cmdHistory = "history"
+	cmdHelp    = "help"
+	cmdExit    = "exit"
+)
+
+var menuCommands = []menuCommand{
+	{name: "query", summary: "Query facility availability",
+		help: "Asks for a facility, or several separated by commas (\"RoomA, Lab1\"), and a list of days (Mon..Sun or\n" +
+			"0=Monday..6=Sunday) and shows the bookings and free times on each day. Errors: unknown facility (listed inline when\n" +
+			"querying several), unknown or ambiguous day.",
+		run: (*ClientState).handleQueryAvailability},
+	{name: "book", summary: "Book a facility",
+		help: "Asks for a facility and the booking time, either on one line (\"Mon 09:00-10:30\", \"Mon 09:00 for 1h30m\") or step by step.\n" +
+			"Prints the confirmation ID. Errors: unknown facility, end not after start, time conflict with an existing booking.",
+		run: (*ClientState).handleBookFacility},
+	{name: "change", summary: "Change an existing booking",
+		help: "Asks for a confirmation ID and an offset, either in minutes or as day/hour/minute terms (\"+1d\", \"-2h\", \"1d-2h+30m\"),\n" +
+			"and moves the booking; positive offsets move it later. \"end +30m\" moves only the end, e.g. to extend a running booking.\n" +
+			"Errors: unknown confirmation ID, time conflict at the new time, booking already started (only the admin can force it).",
+		run: (*ClientState).handleChangeBooking},
+	{name: "monitor", summary: "Monitor facility availability",
+		help: "Asks for a facility, a duration in seconds and optionally the days to watch (\"Fri\", \"0,4\") and the events\n" +
+			"to receive (created, changed, canceled, participant); empty means all. Then prints every matching change to the\n" +
+			"facility until the period ends or Enter is pressed. Errors: unknown facility, unknown day or event.",
+		run: (*ClientState).handleMonitorAvailability},
+	{name: "cancel", summary: "Cancel a booking",
+		help: "Asks for one or more confirmation IDs (comma-separated) or \"mine\" for this session's bookings and cancels them.\n" +
+			"IDs the server does not know are reported as not found and skipped. Bookings that have started need the admin to force them.",
+		run: (*ClientState).handleCancelBooking},
+	{name: "add-participant", summary: "Add participant to a booking",
+		help: "Asks for a confirmation ID and one or more participant names (comma-separated).\n" +
+			"Errors: unknown confirmation ID.",
+		run: (*ClientState).handleAddParticipant},
+	{name: "register", aliases: []string{"login"}, summary: "Register or log in to start a session",
+		help: "Asks for a username and an optional password. A new name is registered; an existing one needs its password.\n" +
+			"Errors: empty username, wrong password. Inputs are not kept in history.",
+		run: (*ClientState).handleRegister, secret: true},
+	{name: "ping", summary: "Measure round-trip time to the server",
+		help: "Asks for a number of pings (default 4), sends them one second apart and prints loss and round-trip times.",
+		run:  (*ClientState).handlePing},
+	{name: "status", summary: "Show connection health and statistics",
+		help: "Shows the server in use, timeouts, counters and active monitors, and offers to save them to a file.",
+		run:  (*ClientState).handleStatus},
+	{name: "semantics", summary: "Choose invocation semantics for the next requests",
+		help: "Asks for 0 (server default), 1 (at-least-once) or 2 (at-most-once).\n" +
+			"Errors: the server rejects semantics it does not allow.",
+		run: (*ClientState).handleSemantics},
+	{name: "watch", summary: "Re-query availability periodically until Enter",
+		help: "Asks for a facility, days and a refresh interval in seconds (default 5) and redraws the availability, highlighting changes.",
+		run:  (*ClientState).handleWatch},
+	{name: "import", summary: "Book from a CSV file and write a results CSV",
+		help: "Asks for a CSV file (facility,startDay,startTime,endDay,endTime,title), a results file and whether to stop at the first failure.\n" +
+			"Malformed rows and rejected bookings are listed in the results file.",
+		run: (*ClientState).handleImport},
+	{name: "undo", summary: "Cancel the last booking made in this session",
+		help: "Shows the last booking made in this session and cancels it after confirmation.",
+		run:  (*ClientState).handleUndo},
+	{name: "subs", summary: "List the server's active monitor subscriptions (admin only)",
+		help: "Shows each active subscription with its subscriber, time left, day and event filters and failed callbacks.\n" +
+			"Errors: permission denied unless logged in as the admin user.",
+		run: (*ClientState).handleListMonitors},
+	{name: "close", summary: "Close a facility for a period, e.g. maintenance (admin only)",
+		help: "Asks for a facility, the closed period (\"Sat 08:00-12:00\") and a reason. The period cannot be booked and\n" +
+			"shows as CLOSED in queries. Bookings already in it are kept but listed in a warning.\n" +
+			"Errors: permission denied unless logged in as the admin user, unknown facility, end not after start.",
+		run: (*ClientState).handleAddBlackout},
+	{name: "clear", summary: "Remove all bookings of a facility (admin only)",
+		help: "Asks for a facility and optionally the days to clear (\"Fri\", \"0,4\"; empty for all), asks for confirmation and\n" +
+			"removes the matching bookings in one go. Errors: permission denied unless logged in as the admin user, unknown facility.",
+		run: (*ClientState).handleClearBookings},
+	{name: "list", summary: "List all bookings of a facility",
+		help: "Asks for a facility and prints its bookings in start order, fetching them page by page (at most -maxPages pages).\n" +
+			"Errors: unknown facility.",
+		run: (*ClientState).handleListBookings},
+	{name: "grid", summary: "Show a facility's week as a free/busy grid",
+		help: "Asks for a facility and optionally the days to show (empty for the whole week) and draws one row per day,\n" +
+			"one character per 15-minute slot: # busy (booked or closed), . free. Errors: unknown facility, unknown day.",
+		run: (*ClientState).handleGrid},
+	{name: "find-person", summary: "Find the bookings a participant is in",
+		help: "Asks for a participant name, optionally a facility (empty for all) and whether to match part of the name,\n" +
+			"and lists the matching bookings with facility, times and confirmation ID. Case is ignored. Errors: unknown facility.",
+		run: (*ClientState).handleFindParticipant},
+	{name: "transfer", summary: "Move a booking to another facility",
+		help: "Asks for a confirmation ID and the facility to move the booking to. It keeps its ID, time and participants.\n" +
+			"Errors: unknown confirmation ID or facility, time conflict or closure in the target, booking already started.",
+		run: (*ClientState).handleTransferBooking},
+	{name: "split", summary: "Give up part of a booking, or split it in two",
+		help: "Asks for a confirmation ID and either the part to give up (\"Mon 10:00-11:00\") or a time to split at (\"Mon 10:00\").\n" +
+			"The time before the cut keeps the ID and the time after it gets a new one; a cut at the start or end just shortens\n" +
+			"the booking. Errors: unknown confirmation ID, cut not within the booking or covering all of it, booking already started.",
+		run: (*ClientState).handleSplitBooking},
+	{name: "copy", summary: "Book the same time and participants on another day",
+		help: "Asks for a confirmation ID and the day to copy the booking to (\"Thu\" or \"3\"). The copy keeps the time of day,\n" +
+			"length, facility and participants and gets its own ID. Errors: unknown confirmation ID, same day, copy running\n" +
+			"past Sunday 24:00 or into the past, time conflict or closure on the target day.",
+		run: (*ClientState).handleCopyBooking},
+	{name: "free-busy", summary: "Show which facilities are free over a time window",
+		help: "Asks for a window such as \"Tue 14:00-16:00\" and checks every facility over it. Free facilities are listed on\n" +
+			"the left; busy ones on the right with the booking in the way, or the closure. Errors: end not after start.",
+		run: (*ClientState).handleFreeBusy},
+	{name: "heatmap", summary: "Show booked minutes per hour of the week",
+		help: "Asks for a facility (empty for the mean over all) and text or json. Text shades each hour of the week by the\n" +
+			"minutes booked; json prints the raw 7x24 matrix. In a pool the minutes are a share of its places.\n" +
+			"Errors: unknown facility.",
+		run: (*ClientState).handleHeatmap},
+	{name: "check", summary: "See whether a booking or change would succeed, without making it",
+		help: "Asks whether to check a new booking or a change, then for the same inputs as \"book\" or \"change\". The server\n" +
+			"runs every check and answers as it would, naming the bookings in the way and the next time the same length fits,\n" +
+			"but books and changes nothing. Errors: as for book and change.",
+		run: (*ClientState).handleCheck},
+	{name: "rename", summary: "Give a facility a new name (admin only)",
+		help: "Asks for a facility and its new name. Bookings keep their IDs and monitors move to the new name; for a while,\n" +
+			"requests using the old name are told the new one. Errors: not the admin, unknown facility, name already taken.",
+		run: (*ClientState).handleRenameFacility},
+	{name: "about", summary: "Show how the server is configured",
+		help: "Asks the active server for its invocation semantics, role, version, uptime, facility count and limits:\n" +
+			"history TTL, request size, monitor period, timestamp window, overload and abuse limits, and session idle time.\n" +
+			"A limit of 0 on the server shows as off or unlimited. Errors: server too old to support it.",
+		run: (*ClientState).handleAbout},
+	{name: "namespace", summary: "Create or delete a facility namespace (admin only)",
+		help: "Asks whether to create or delete, then for the namespace name: lowercase letters, digits and '-'. Creating\n" +
+			"asks for its facilities, which start without bookings; deleting asks for confirmation and removes its bookings\n" +
+			"and monitors. Start the client with -namespace to work in one. Errors: not the admin, namespace already exists\n" +
+			"or not found, the default namespace cannot be deleted.",
+		run: (*ClientState).handleNamespace},
+	{name: "approve", summary: "Approve or reject a booking pending approval (admin only)",
+		help: "Asks for a confirmation ID, then whether to approve or reject it, and for a rejection an optional reason.\n" +
+			"Bookings of facilities that require approval stay pending until then, and are removed if nobody decides within\n" +
+			"the server's -approvalTTL. Errors: not the admin, booking not found or not pending.",
+		run: (*ClientState).handleApproveBooking},
+	{name: cmdHistory, summary: "List the commands run in this session; !N runs entry N again",
+		help: "Lists this session's commands with their inputs and outcomes. \"!N\" runs entry N again,\n" +
+			"showing each previous answer in brackets: press Enter to keep it or type a new value."},
+	{name: cmdHelp, summary: "Show this list, or \"help <command>\" for details",
+		help: "\"help\" lists the commands; \"help <command>\" describes the inputs and typical errors of one command."},
+	{name: cmdExit, summary: "Exit the client"},
+}
+
+// lookupCommand finds a menu command by number, name or alias.
+func lookupCommand(input string) (menuCommand, bool) {
+	if n, err := strconv.Atoi(input); err == nil {
+		if n >= 1 && n <= len(menuCommands) {
+			return menuCommands[n-1], true
+		}
+		return menuCommand{}, false
+	}
+	for _, cmd := range menuCommands {
+		if strings.EqualFold(cmd.name, input) {
+			return cmd, true
+		}
+		for _, alias := range cmd.aliases {
+			if strings.EqualFold(alias, input) {
+				return cmd, true
+			}
+		}
+	}
+	return menuCommand{}, false
+}
+
+// printMenu lists the commands.
+func printMenu() {
+	fmt.Println("\nAvailable commands:")
+	for i, cmd := range menuCommands {
+		fmt.Printf("%d. %s - %s\n", i+1, cmd.name, cmd.summary)
+	}
+}
+
+// handleHelp prints the menu, or the details of one command.
+func handleHelp(topic string) {
+	if topic = strings.TrimSpace(topic); topic == "" {
+		printMenu()
+		return
+	}
+	cmd, ok := lookupCommand(topic)
+	if !ok {
+		fmt.Printf("No command %q. Type \"help\" for the list.\n", topic)
+		return
+	}
+	fmt.Printf("\n%s - %s\n", cmd.name, cmd.summary)
+	if cmd.help != "" {
+		fmt.Println(cmd.help)
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// monitorTick is how often the remaining monitor time is printed.
+const monitorTick = 10 * time.Second
+
+// startMonitor enters monitor mode for a registration of duration d and
+// starts the callback listener.
+func (c *ClientState) startMonitor(facility string, d time.Duration) {
+	c.MonitorMode = true
+	c.monitorFacility = facility
+	c.monitorUntil = time.Now().Add(d)
+	c.monitorStop = make(chan struct{})
+	c.monitorDone = make(chan struct{})
+	go c.listenCallbacks(c.monitorStop, c.monitorDone)
+}
+
+// listenCallbacks reads callbacks until stop is closed, then closes done.
+func (c *ClientState) listenCallbacks(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// Use a short timeout so the stop signal is noticed promptly
+		raw, err := c.readPacket(time.Now().Add(500 * time.Millisecond))
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			select {
+			case <-stop:
+			default:
+				fmt.Printf("Error reading callback: %v\n", err)
+			}
+			return
+		}
+
+		// Process the callback
+		callback, err := c.decodeReply(raw)
+		if err != nil {
+			fmt.Printf("Error decoding callback: %v\n", err)
+			continue
+		}
+		c.handleMonitorPacket(callback)
+	}
+}
+
+// stopMonitor leaves monitor mode and waits for the listener to exit, so
+// the next request owns the connection again.
+func (c *ClientState) stopMonitor() {
+	if c.monitorStop != nil {
+		close(c.monitorStop)
+		<-c.monitorDone
+		c.monitorStop, c.monitorDone = nil, nil
+	}
+	c.MonitorMode = false
+}
+
+// waitMonitor blocks while monitoring, printing the remaining time, until
+// the user presses Enter or the registration expires.
+func (c *ClientState) waitMonitor(reader *bufio.Reader) {
+	fmt.Printf("\nMonitoring %s until %s. Press Enter to return to menu.\n",
+		c.monitorFacility, c.monitorUntil.Format("15:04:05"))
+
+	// If the period ends first, the line typed next is handed to the menu
+	// by readLine
+	c.startInput(reader)
+
+	ticker := time.NewTicker(monitorTick)
+	defer ticker.Stop()
+	expiry := time.NewTimer(time.Until(c.monitorUntil))
+	defer expiry.Stop()
+	for {
+		select {
+		case <-c.pendingInput:
+			c.pendingInput = nil
+			c.stopMonitor()
+			fmt.Println("Stopped monitoring.")
+			return
+		case <-expiry.C:
+			c.stopMonitor()
+			fmt.Printf("\nMonitoring period for %s has ended.\n", c.monitorFacility)
+			return
+		case <-ticker.C:
+			fmt.Printf("[%v remaining]\n", time.Until(c.monitorUntil).Round(time.Second))
+		}
+	}
+}
+
+// startInput starts reading the next line in the background, unless a read
+// is already pending, and returns the channel it will arrive on. The read
+// cannot be interrupted, so the line stays owed to readLine until taken.
+func (c *ClientState) startInput(reader *bufio.Reader) <-chan string {
+	if c.pendingInput == nil {
+		ch := make(chan string, 1)
+		go func() {
+			line, _ := reader.ReadString('\n')
+			ch <- line
+		}()
+		c.pendingInput = ch
+	}
+	return c.pendingInput
+}
+
+// readLine reads the next line of input. A read started while monitoring
+// is collected first, so the bufio.Reader is never used concurrently.
+func (c *ClientState) readLine(reader *bufio.Reader) string {
+	if c.pendingInput != nil {
+		line := <-c.pendingInput
+		c.pendingInput = nil
+		return line
+	}
+	line, _ := reader.ReadString('\n')
+	return line
+}
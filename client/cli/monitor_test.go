@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+)
+
+// monitorInput is a reader for waitMonitor whose lines the test types.
+func monitorInput(t *testing.T) (*bufio.Reader, *io.PipeWriter) {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	return bufio.NewReader(r), w
+}
+
+// runMonitor runs waitMonitor in the background and returns a channel
+// closed when it returns.
+func runMonitor(c *ClientState, reader *bufio.Reader) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		c.waitMonitor(reader)
+		close(done)
+	}()
+	return done
+}
+
+// TestMonitorEndsAtExpiry checks monitor mode ends by itself when the
+// period runs out, with the callback listener stopped.
+func TestMonitorEndsAtExpiry(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	reader, input := monitorInput(t)
+	if _, err := query(c, "RoomA"); err != nil { // the server learns where the client is
+		t.Fatalf("query: %v", err)
+	}
+
+	c.startMonitor("RoomA", 100*time.Millisecond)
+	listener := c.monitorDone
+	// A callback during the period is shown
+	srv.callback(seqCallback("RoomA", 1))
+
+	select {
+	case <-runMonitor(c, reader):
+	case <-time.After(2 * time.Second):
+		t.Fatal("monitor mode did not end at expiry")
+	}
+	if c.MonitorMode || c.monitorStop != nil {
+		t.Error("still in monitor mode")
+	}
+	select {
+	case <-listener:
+	default:
+		t.Error("callback listener still running")
+	}
+	if n := c.stats.callbacks.Load(); n != 1 {
+		t.Errorf("%d callbacks shown, want 1", n)
+	}
+
+	// The line typed after expiry goes to the menu, not to the monitor
+	go input.Write([]byte("3\n"))
+	if line := c.readLine(reader); line != "3\n" {
+		t.Errorf("readLine = %q", line)
+	}
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Errorf("request after monitoring: %v", err)
+	}
+}
+
+func TestMonitorStoppedByEnter(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	reader, input := monitorInput(t)
+
+	c.startMonitor("RoomA", time.Hour)
+	listener := c.monitorDone
+	done := runMonitor(c, reader)
+	input.Write([]byte("\n"))
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Enter did not stop monitoring")
+	}
+	select {
+	case <-listener:
+	default:
+		t.Error("callback listener still running")
+	}
+	if c.MonitorMode || c.pendingInput != nil {
+		t.Errorf("MonitorMode %v, input pending %v", c.MonitorMode, c.pendingInput != nil)
+	}
+}
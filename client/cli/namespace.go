@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// handleNamespace creates a namespace with a list of facilities, or deletes
+// one with all its bookings after the user confirms. The server only
+// accepts either from the admin.
+func (c *ClientState) handleNamespace(reader *bufio.Reader) {
+	fmt.Print("Create or delete a namespace? (create/delete): ")
+	action, _ := reader.ReadString('\n')
+	action = strings.ToLower(strings.TrimSpace(action))
+	if action != "create" && action != "delete" {
+		fmt.Printf("Error: %q is not create or delete\n", action)
+		return
+	}
+
+	fmt.Print("Enter namespace name: ")
+	ns, _ := reader.ReadString('\n')
+	ns = strings.TrimSpace(ns)
+	if err := validate.ValidateNamespace(ns); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	req := common.RequestMessage{
+		RequestID:       c.GetNextRequestID(),
+		TargetNamespace: ns,
+	}
+	if action == "create" {
+		fmt.Print("Enter its facilities, comma-separated: ")
+		line, _ := reader.ReadString('\n')
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				req.MoreFacilities = append(req.MoreFacilities, name)
+			}
+		}
+		req.OpCode = common.OpCreateNamespace
+	} else {
+		fmt.Printf("Delete namespace %s with all its facilities and bookings? (y/N): ", ns)
+		answer, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			fmt.Println("Nothing deleted.")
+			return
+		}
+		req.OpCode = common.OpDeleteNamespace
+		req.Confirm = true
+	}
+
+	reply, err := c.SendRequest(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Printf("\nFailed to %s the namespace!\n", action)
+	}
+	fmt.Println(reply.Data)
+}
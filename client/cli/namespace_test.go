@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestNamespaceSent: every request of a client started in a namespace
+// names it, and one without a namespace names none.
+func TestNamespaceSent(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	c.Namespace = "physics"
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	got := srv.received()
+	if len(got) != 2 || got[0].Namespace != "" || got[1].Namespace != "physics" {
+		t.Errorf("server saw namespaces %q and %q, want none and physics", got[0].Namespace, got[1].Namespace)
+	}
+}
+
+func TestNamespaceCommand(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.TargetNamespace == "default" {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusInvalidArgument,
+				Data: "Error: the default namespace cannot be deleted"}
+		}
+		return okReply(req, "done")
+	})
+	c := newTestClient(t, srv.Addr())
+
+	runLine(t, c, "namespace", "create\nphysics\nRoomA, Cryo Lab ,,\n")
+	got := srv.received()
+	if len(got) != 1 || got[0].OpCode != common.OpCreateNamespace || got[0].TargetNamespace != "physics" ||
+		!reflect.DeepEqual(got[0].MoreFacilities, []string{"RoomA", "Cryo Lab"}) {
+		t.Fatalf("create sent %+v", got)
+	}
+
+	for _, input := range []string{"rename\n", "create\nPhysics\n", "delete\nphysics\nn\n", "delete\nphysics\n\n"} {
+		out := runLine(t, c, "namespace", input)
+		if n := len(srv.received()); n != 1 {
+			t.Fatalf("input %q sent a request:\n%s", input, out)
+		}
+	}
+
+	runLine(t, c, "namespace", "DELETE\nphysics\ny\n")
+	if got := srv.received(); len(got) != 2 || got[1].OpCode != common.OpDeleteNamespace || !got[1].Confirm {
+		t.Errorf("delete sent %+v", got[len(got)-1])
+	}
+	if out := runLine(t, c, "namespace", "delete\ndefault\ny\n"); !strings.Contains(out, "Failed to delete the namespace!") {
+		t.Errorf("refused delete printed:\n%s", out)
+	}
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// opNames are the operation names accepted in -timeout.<op> and
+// -retries.<op> overrides.
+var opNames = map[string]uint8{
+	"query":           common.OpQueryAvailability,
+	"book":            common.OpBookFacility,
+	"change":          common.OpChangeBooking,
+	"monitor":         common.OpMonitorAvailability,
+	"cancel":          common.OpCancelBooking,
+	"add-participant": common.OpAddParticipant,
+	"register":        common.OpRegisterUser,
+	"ping":            common.OpPing,
+	"batch":           common.OpBatch,
+	"list":            common.OpListBookings,
+	"find-person":     common.OpFindParticipant,
+	"transfer":        common.OpTransferBooking,
+	"split":           common.OpSplitBooking,
+	"copy":            common.OpCopyBooking,
+	"free-busy":       common.OpFreeBusy,
+	"heatmap":         common.OpHeatmap,
+	"about":           common.OpGetServerInfo,
+}
+
+// OpNames returns the operation names that take overrides, sorted.
+func OpNames() []string {
+	names := make([]string, 0, len(opNames))
+	for name := range opNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpCodeByName resolves an override key to its OpCode.
+func OpCodeByName(name string) (uint8, bool) {
+	op, ok := opNames[name]
+	return op, ok
+}
+
+// timeoutFor returns how long attempt n of a request with this OpCode
+// waits. An override is a fixed per-attempt timeout and takes the place of
+// both -timeout and the adaptive estimate.
+func (c *ClientState) timeoutFor(op uint8, attempt int) time.Duration {
+	if d, ok := c.OpTimeouts[op]; ok {
+		return d
+	}
+	return c.attemptTimeout(attempt)
+}
+
+// staticTimeoutFor is the single-attempt deadline used for pings and over
+// TCP: the override if there is one, otherwise -timeout.
+func (c *ClientState) staticTimeoutFor(op uint8) time.Duration {
+	if d, ok := c.OpTimeouts[op]; ok {
+		return d
+	}
+	return c.Timeout
+}
+
+// retriesFor returns the attempts per server for a request with this OpCode.
+func (c *ClientState) retriesFor(op uint8) int {
+	if n, ok := c.OpRetries[op]; ok {
+		return n
+	}
+	return c.Retries
+}
+
+// writeOpTable renders the effective timeout and attempts per operation for
+// the status command.
+func (c *ClientState) writeOpTable(w io.Writer) {
+	if len(c.OpTimeouts) == 0 && len(c.OpRetries) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  Per-operation overrides (timeout, attempts per server):")
+	for _, name := range OpNames() {
+		op := opNames[name]
+		d, hasTimeout := c.OpTimeouts[op]
+		_, hasRetries := c.OpRetries[op]
+		if !hasTimeout && !hasRetries {
+			continue
+		}
+		timeout := "default"
+		if hasTimeout {
+			timeout = d.String()
+		}
+		retries := "unlimited"
+		if n := c.retriesFor(op); n > 0 {
+			retries = fmt.Sprintf("%d", n)
+		}
+		fmt.Fprintf(w, "    - %s: %s, %s\n", name, timeout, retries)
+	}
+}
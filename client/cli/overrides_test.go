@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestTimeoutFor(t *testing.T) {
+	c := &ClientState{
+		Timeout:    time.Second,
+		Retries:    4,
+		OpTimeouts: map[uint8]time.Duration{common.OpMonitorAvailability: 10 * time.Second},
+		OpRetries:  map[uint8]int{common.OpBookFacility: 6, common.OpPing: 0},
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		if got := c.timeoutFor(common.OpMonitorAvailability, attempt); got != 10*time.Second {
+			t.Errorf("monitor attempt %d: %v, want the override", attempt, got)
+		}
+		if got, want := c.timeoutFor(common.OpQueryAvailability, attempt), c.attemptTimeout(attempt); got != want {
+			t.Errorf("query attempt %d: %v, want the default %v", attempt, got, want)
+		}
+	}
+	if got := c.staticTimeoutFor(common.OpMonitorAvailability); got != 10*time.Second {
+		t.Errorf("static monitor timeout %v", got)
+	}
+	if got := c.staticTimeoutFor(common.OpPing); got != time.Second {
+		t.Errorf("static ping timeout %v, want -timeout", got)
+	}
+	for op, want := range map[uint8]int{common.OpBookFacility: 6, common.OpPing: 0, common.OpQueryAvailability: 4} {
+		if got := c.retriesFor(op); got != want {
+			t.Errorf("retriesFor(%s) = %d, want %d", common.OpName(op), got, want)
+		}
+	}
+
+	var table bytes.Buffer
+	c.writeOpTable(&table)
+	for _, want := range []string{"- book: default, 6\n", "- monitor: 10s, 4\n", "- ping: default, unlimited\n"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table lacks %q:\n%s", want, table.String())
+		}
+	}
+	if strings.Contains(table.String(), "query") {
+		t.Errorf("table lists an operation without overrides:\n%s", table.String())
+	}
+}
+
+// TestOverridesApplied sends to a silent server and checks how many
+// attempts each operation makes and how long it waits for them.
+func TestOverridesApplied(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	srv.silent.Store(true)
+	c := newTestClient(t, srv.Addr())
+	c.OpTimeouts = map[uint8]time.Duration{common.OpQueryAvailability: 300 * time.Millisecond}
+	c.OpRetries = map[uint8]int{common.OpQueryAvailability: 1, common.OpCancelBooking: 3}
+
+	start := time.Now()
+	if _, err := query(c, "RoomA"); !errors.Is(err, errNoReply) {
+		t.Fatalf("query: %v, want errNoReply", err)
+	}
+	if took := time.Since(start); took < 300*time.Millisecond || took > 550*time.Millisecond {
+		t.Errorf("query gave up after %v, want one 300ms attempt", took)
+	}
+	if n := len(srv.received()); n != 1 {
+		t.Errorf("query made %d attempts, want 1", n)
+	}
+
+	if _, err := c.SendRequest(common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: c.GetNextRequestID(), ConfirmationID: "BKG-1"}); err == nil {
+		t.Fatal("cancel to a silent server succeeded")
+	}
+	if n := len(srv.received()) - 1; n != 3 {
+		t.Errorf("cancel made %d attempts, want 3", n)
+	}
+	before := len(srv.received())
+	c.SendRequest(common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: c.GetNextRequestID(), ConfirmationID: "BKG-1", ParticipantName: "Ada"})
+	if n := len(srv.received()) - before; n != c.Retries {
+		t.Errorf("add-participant made %d attempts, want the default %d", n, c.Retries)
+	}
+}
+
+func TestOpCodeByName(t *testing.T) {
+	for _, name := range OpNames() {
+		if _, ok := OpCodeByName(name); !ok {
+			t.Errorf("listed name %q does not resolve", name)
+		}
+	}
+	if op, ok := OpCodeByName("query"); !ok || op != common.OpQueryAvailability {
+		t.Errorf("query = %d, %v", op, ok)
+	}
+	for _, name := range []string{"", "Query", "teleport"} {
+		if _, ok := OpCodeByName(name); ok {
+			t.Errorf("%q resolved", name)
+		}
+	}
+}
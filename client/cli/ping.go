@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Ping sends one OpPing to the current server and returns the round-trip
+// time. There are no retries: a lost ping is reported as errNoReply.
+func (c *ClientState) Ping() (time.Duration, error) {
+	sent := time.Now()
+	req := common.RequestMessage{
+		OpCode:    common.OpPing,
+		RequestID: c.GetNextRequestID(),
+		PingTime:  sent.UnixNano(),
+	}
+	data, err := c.encodeRequest(req)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling: %w", err)
+	}
+	if err := c.writePacket(data); err != nil {
+		return 0, fmt.Errorf("error sending ping: %w", err)
+	}
+
+	deadline := sent.Add(c.staticTimeoutFor(common.OpPing))
+	for {
+		raw, err := c.readPacket(deadline)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return 0, errNoReply
+			}
+			return 0, err
+		}
+		reply, err := c.decodeReply(raw)
+		if err == nil && classifyPacket(reply) == packetCallback {
+			c.handleMonitorPacket(reply)
+			continue
+		}
+		if err != nil || reply.RequestID != req.RequestID {
+			continue // late reply to an earlier ping
+		}
+		if reply.Status != common.StatusOK {
+			return 0, fmt.Errorf("%s", reply.Data)
+		}
+		if echoed, _ := strconv.ParseInt(reply.Data, 10, 64); echoed != req.PingTime {
+			return 0, fmt.Errorf("ping reply does not echo the request")
+		}
+		rtt := time.Since(sent)
+		c.observeRTT(rtt, 0) // pings are answered without processing
+		c.measureSkew(reply, sent, rtt)
+		return rtt, nil
+	}
+}
+
+// handlePing implements the ping command: a number of pings one second
+// apart, followed by loss and RTT statistics.
+func (c *ClientState) handlePing(reader *bufio.Reader) {
+	fmt.Print("Enter number of pings (default 4): ")
+	countStr, _ := reader.ReadString('\n')
+	count := 4
+	if countStr = strings.TrimSpace(countStr); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n <= 0 {
+			fmt.Println("Invalid count")
+			return
+		}
+		count = n
+	}
+
+	fmt.Printf("\nPinging %s:\n", c.ActiveServer())
+	var received int
+	var minRTT, maxRTT, total time.Duration
+	for i := 1; i <= count; i++ {
+		if i > 1 {
+			time.Sleep(time.Second)
+		}
+		rtt, err := c.Ping()
+		if err != nil {
+			fmt.Printf("  seq=%d: %v\n", i, err)
+			continue
+		}
+		fmt.Printf("  seq=%d: time=%v\n", i, rtt.Round(time.Microsecond))
+		if received == 0 || rtt < minRTT {
+			minRTT = rtt
+		}
+		if rtt > maxRTT {
+			maxRTT = rtt
+		}
+		total += rtt
+		received++
+	}
+
+	loss := float64(count-received) * 100 / float64(count)
+	fmt.Printf("\n%d sent, %d received, %.0f%% loss\n", count, received, loss)
+	if received > 0 {
+		avg := total / time.Duration(received)
+		fmt.Printf("RTT min/avg/max = %v/%v/%v\n",
+			minRTT.Round(time.Microsecond), avg.Round(time.Microsecond), maxRTT.Round(time.Microsecond))
+		if c.clockMeasured {
+			fmt.Printf("Server clock is %s\n", describeSkew(c.clockOffset))
+		}
+	}
+}
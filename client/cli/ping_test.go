@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// pingServer answers pings after the delay returned for the n-th ping
+// (starting at 1), with its clock ahead of the client's by ahead.
+func pingServer(t *testing.T, ahead time.Duration, delay func(n int) time.Duration) *fakeServer {
+	var n atomic.Int32
+	return newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		time.Sleep(delay(int(n.Add(1))))
+		rep := okReply(req, strconv.FormatInt(req.PingTime, 10))
+		rep.ServerClock = time.Now().Add(ahead).UnixMilli()
+		return rep
+	})
+}
+
+func TestPingMeasuresRTT(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	srv := pingServer(t, 0, func(int) time.Duration { return delay })
+	c := newTestClient(t, srv.Addr())
+
+	start := time.Now()
+	rtt, err := c.Ping()
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if rtt < delay || rtt > elapsed {
+		t.Errorf("rtt = %v, want between the server delay %v and the call's %v", rtt, delay, elapsed)
+	}
+	if c.rtt.samples != 1 || c.rtt.srtt != rtt || c.rtt.rttvar != rtt/2 {
+		t.Errorf("estimator = %+v after one sample of %v, want srtt = rtt and rttvar = rtt/2", c.rtt, rtt)
+	}
+	// Pings report no server time, so they do not feed the latency split
+	if c.latency.server.samples != 0 {
+		t.Errorf("latency split has %d samples", c.latency.server.samples)
+	}
+	if len(srv.received()) != 1 || srv.received()[0].OpCode != common.OpPing {
+		t.Errorf("server saw %+v, want one ping", srv.received())
+	}
+}
+
+func TestPingMeasuresSkew(t *testing.T) {
+	srv := pingServer(t, time.Hour, func(int) time.Duration { return 0 })
+	c := newTestClient(t, srv.Addr())
+	if _, err := c.Ping(); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if !c.clockMeasured {
+		t.Fatal("clock not measured")
+	}
+	if d := c.clockOffset - time.Hour; d < -50*time.Millisecond || d > 50*time.Millisecond {
+		t.Errorf("clock offset = %v, want about 1h", c.clockOffset)
+	}
+}
+
+func TestPingIgnoresLateReply(t *testing.T) {
+	// The first reply comes after the client gave up on it and arrives
+	// while the second ping waits
+	srv := pingServer(t, 0, func(n int) time.Duration {
+		if n == 1 {
+			return 80 * time.Millisecond
+		}
+		return 0
+	})
+	c := newTestClient(t, srv.Addr())
+
+	if _, err := c.Ping(); !errors.Is(err, errNoReply) {
+		t.Fatalf("first ping: err = %v, want errNoReply", err)
+	}
+	if _, err := c.Ping(); err != nil {
+		t.Fatalf("second ping: %v", err)
+	}
+	if c.rtt.samples != 1 {
+		t.Errorf("%d RTT samples, want only the second ping's", c.rtt.samples)
+	}
+}
+
+func TestPingRejectsWrongEcho(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		return okReply(req, "12345")
+	})
+	c := newTestClient(t, srv.Addr())
+	if _, err := c.Ping(); err == nil {
+		t.Fatal("ping with a wrong echo succeeded")
+	}
+	if c.rtt.samples != 0 {
+		t.Errorf("a bad reply was sampled")
+	}
+}
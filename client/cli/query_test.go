@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestQuerySeveralFacilities: the query prompt takes a comma-separated
+// list, the first name in FacilityName and the rest in MoreFacilities.
+func TestQuerySeveralFacilities(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	for _, tt := range []struct {
+		input string
+		first string
+		more  []string
+	}{
+		{"RoomA\n", "RoomA", nil},
+		{" RoomA , Lab1,,Hall B \n", "RoomA", []string{"Lab1", "Hall B"}},
+	} {
+		runLine(t, c, "query", tt.input+"1\nFri\n\n")
+		got := srv.received()
+		req := got[len(got)-1]
+		if req.FacilityName != tt.first || !reflect.DeepEqual(req.MoreFacilities, tt.more) || !reflect.DeepEqual(req.DaysList, []uint8{4}) {
+			t.Errorf("%q sent %q + %q on %v", tt.input, req.FacilityName, req.MoreFacilities, req.DaysList)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// monitorTokenFromReply extracts the token from a "... Token=<token>"
+// MonitorAvailability reply. Servers without rebind support send none.
+func monitorTokenFromReply(data string) string {
+	i := strings.LastIndex(data, "Token=")
+	if i < 0 {
+		return ""
+	}
+	token, _, _ := strings.Cut(data[i+len("Token="):], " ")
+	return strings.TrimSpace(token)
+}
+
+// redial opens a fresh connection to the server in use, after the old one
+// failed, and moves the live monitor registrations to the new source
+// address.
+func (c *ClientState) redial() error {
+	if err := c.dial(c.ServerAddrs[c.current]); err != nil {
+		return err
+	}
+	fmt.Printf("Reconnected to %s\n", c.ActiveServer())
+	c.rebindMonitors()
+	return nil
+}
+
+// rebindMonitors asks the server to send each live monitor's callbacks to
+// this client's current address. A registration the server no longer
+// knows, or one made without a token, is registered again instead.
+func (c *ClientState) rebindMonitors() {
+	if c.rebinding {
+		return
+	}
+	c.rebinding = true
+	defer func() { c.rebinding = false }()
+
+	for facility, expiry := range c.monitors {
+		if time.Until(expiry) < time.Second {
+			c.forgetMonitor(facility)
+			continue
+		}
+		token := c.monitorTokens[facility]
+		if token == "" {
+			c.reregisterMonitor(facility)
+			continue
+		}
+		req := common.RequestMessage{
+			OpCode:       common.OpRebindMonitor,
+			RequestID:    c.GetNextRequestID(),
+			MonitorToken: token,
+			SessionToken: c.SessionToken,
+			Timestamp:    time.Now().Add(c.clockOffset).UnixMilli(),
+		}
+		data, err := c.encodeRequest(req)
+		if err != nil {
+			continue
+		}
+		reply, err := c.exchange(req, data)
+		if err != nil {
+			fmt.Printf("Could not re-bind monitor for %s: %v\n", facility, err)
+			continue
+		}
+		if reply.Status != common.StatusOK {
+			fmt.Printf("Could not re-bind monitor for %s (%s); registering again.\n", facility, reply.Data)
+			c.reregisterMonitor(facility)
+			continue
+		}
+		fmt.Printf("Re-bound monitor for %s\n", facility)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestMonitorTokenFromReply(t *testing.T) {
+	tests := map[string]string{
+		"Monitoring RoomA for 60 seconds. Expires=2026-01-01T00:00:00Z Token=abc123": "abc123",
+		"Monitoring RoomA for 60 seconds. Token=abc123 ":                             "abc123",
+		"Monitoring RoomA for 60 seconds.":                                           "",
+	}
+	for data, want := range tests {
+		if got := monitorTokenFromReply(data); got != want {
+			t.Errorf("monitorTokenFromReply(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+// TestRedialRebindsMonitors: after a re-dial each live monitor is re-bound
+// with its token; one the server no longer knows is registered again.
+func TestRedialRebindsMonitors(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		switch {
+		case req.OpCode == common.OpRebindMonitor && req.MonitorToken == "good":
+			return okReply(req, "Monitor for RoomA now sends callbacks to you.")
+		case req.OpCode == common.OpRebindMonitor:
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusError,
+				Data: "Unknown or expired monitor token; register again"}
+		case req.OpCode == common.OpMonitorAvailability:
+			return okReply(req, "Monitoring "+req.FacilityName+" for 60 seconds. Token=fresh")
+		}
+		return okReply(req, "ok")
+	})
+	c := newTestClient(t, srv.Addr())
+	c.trackMonitor("RoomA", time.Minute, monitorFilter{}, "good")
+	c.trackMonitor("Lab1", time.Minute, monitorFilter{}, "stale")
+	c.trackMonitor("Hall", 500*time.Millisecond, monitorFilter{}, "good") // about to expire
+
+	captureStdout(t, func() {
+		if err := c.redial(); err != nil {
+			t.Fatalf("redial: %v", err)
+		}
+	})
+	rebinds := make(map[string]bool)
+	registered := make(map[string]bool)
+	for _, req := range srv.received() {
+		switch req.OpCode {
+		case common.OpRebindMonitor:
+			rebinds[req.MonitorToken] = true
+		case common.OpMonitorAvailability:
+			registered[req.FacilityName] = true
+		}
+	}
+	if !rebinds["good"] || !rebinds["stale"] || len(rebinds) != 2 {
+		t.Errorf("rebinds sent for tokens %v, want good and stale", rebinds)
+	}
+	if !registered["Lab1"] || len(registered) != 1 {
+		t.Errorf("registered again %v, want only Lab1", registered)
+	}
+	if c.monitorTokens["Lab1"] != "fresh" || c.monitorTokens["RoomA"] != "good" {
+		t.Errorf("tokens after redial: %v", c.monitorTokens)
+	}
+	if _, ok := c.monitors["Hall"]; ok {
+		t.Error("an expiring monitor was kept")
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleRenameFacility gives a facility a new name. Its bookings keep their
+// IDs and its subscribers are told the new name. The server only accepts it
+// from the admin.
+func (c *ClientState) handleRenameFacility(reader *bufio.Reader) {
+	fmt.Print("Enter facility name: ")
+	oldName, _ := reader.ReadString('\n')
+	oldName = strings.TrimSpace(oldName)
+
+	fmt.Print("Enter the new name: ")
+	newName, _ := reader.ReadString('\n')
+	newName = strings.TrimSpace(newName)
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:          common.OpRenameFacility,
+		RequestID:       c.GetNextRequestID(),
+		FacilityName:    oldName,
+		NewFacilityName: newName,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Println("\nFailed to rename the facility!")
+	} else {
+		c.renameFacility(oldName, newName)
+	}
+	fmt.Println(reply.Data)
+}
+
+// renameFacility moves what the client keeps per facility to its new name:
+// monitor registrations, which may be keyed by the name in another case,
+// and their callback sequence. The cached availability of the old name is
+// dropped.
+func (c *ClientState) renameFacility(oldName, newName string) {
+	c.callbacks.rename(oldName, newName)
+	c.availability.forget(oldName)
+	var moved []string
+	for facility := range c.monitors {
+		if strings.EqualFold(facility, oldName) {
+			moved = append(moved, facility)
+		}
+	}
+	for _, facility := range moved {
+		expiry := c.monitors[facility]
+		delete(c.monitors, facility)
+		c.monitors[newName] = expiry
+		if filter, ok := c.monitorFilters[facility]; ok {
+			delete(c.monitorFilters, facility)
+			c.monitorFilters[newName] = filter
+		}
+		if token, ok := c.monitorTokens[facility]; ok {
+			delete(c.monitorTokens, facility)
+			c.monitorTokens[newName] = token
+		}
+	}
+	if strings.EqualFold(c.monitorFacility, oldName) {
+		c.monitorFacility = newName
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestRenameCallback: a rename callback moves the monitor, its filter and
+// token to the new name, and the sequence continues under it without a
+// resend.
+func TestRenameCallback(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+	c.trackMonitor("rooma", time.Minute, monitorFilter{Days: []uint8{4}}, "tok")
+	c.monitorFacility = "RoomA"
+	c.callbacks.reset("RoomA")
+
+	c.handleMonitorPacket(seqCallback("RoomA", 1))
+	renamed := seqCallback("Hall", 2)
+	renamed.Data = "Facility=Hall updated: Facility RoomA renamed to Hall"
+	renamed.Extensions.PutString(common.ExtRenamedFrom, "RoomA")
+	out := captureStdout(t, func() { c.handleMonitorPacket(renamed) })
+	if !strings.Contains(out, "renamed to Hall") {
+		t.Errorf("rename callback printed %q", out)
+	}
+	c.handleMonitorPacket(seqCallback("Hall", 3))
+
+	if n := len(srv.received()); n != 0 {
+		t.Errorf("server saw %d requests, want no resend", n)
+	}
+	if _, ok := c.monitors["rooma"]; ok || c.monitors["Hall"].IsZero() {
+		t.Errorf("monitors %v, want only Hall", c.monitors)
+	}
+	if c.monitorTokens["Hall"] != "tok" || len(c.monitorFilters["Hall"].Days) != 1 || c.monitorFacility != "Hall" {
+		t.Errorf("token %q, filter %+v, watching %q", c.monitorTokens["Hall"], c.monitorFilters["Hall"], c.monitorFacility)
+	}
+	if show, _, gap := c.callbacks.observe("Hall", 4); !show || gap {
+		t.Errorf("next callback: show %v, gap %v", show, gap)
+	}
+}
+
+func TestRenameCommand(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.NewFacilityName == "Lab1" {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusConflict,
+				Data: "A facility named 'Lab1' already exists"}
+		}
+		return okReply(req, "Renamed 'RoomA' to 'Hall'. Its 2 bookings keep their IDs.")
+	})
+	c := newTestClient(t, srv.Addr())
+	c.trackMonitor("RoomA", time.Minute, monitorFilter{}, "tok")
+
+	out := runLine(t, c, "rename", "RoomA\nLab1\n")
+	if !strings.Contains(out, "Failed to rename") || c.monitors["RoomA"].IsZero() {
+		t.Errorf("refused rename printed:\n%s", out)
+	}
+	out = runLine(t, c, "rename", "RoomA\nHall\n")
+	if !strings.Contains(out, "Renamed 'RoomA' to 'Hall'") || c.monitors["Hall"].IsZero() {
+		t.Errorf("rename printed:\n%s\nmonitors %v", out, c.monitors)
+	}
+	got := srv.received()
+	if len(got) != 2 || got[1].OpCode != common.OpRenameFacility || got[1].FacilityName != "RoomA" || got[1].NewFacilityName != "Hall" {
+		t.Errorf("server saw %+v", got)
+	}
+}
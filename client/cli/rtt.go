@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+// minRTTSamples is how many round trips are measured before the adaptive
+// timeout replaces the static -timeout.
+const minRTTSamples = 3
+
+// rttEstimator keeps a smoothed round-trip time and its mean deviation the
+// way TCP does (RFC 6298, alpha = 1/8, beta = 1/4).
+type rttEstimator struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	samples int
+}
+
+// observe folds one measured round trip into the estimate.
+func (e *rttEstimator) observe(r time.Duration) {
+	if e.samples == 0 {
+		e.srtt = r
+		e.rttvar = r / 2
+	} else {
+		diff := e.srtt - r
+		if diff < 0 {
+			diff = -diff
+		}
+		e.rttvar = (3*e.rttvar + diff) / 4
+		e.srtt = (7*e.srtt + r) / 8
+	}
+	e.samples++
+}
+
+// rto is srtt + 4*rttvar clamped to [floor, ceiling].
+func (e *rttEstimator) rto(floor, ceiling time.Duration) time.Duration {
+	d := e.srtt + 4*e.rttvar
+	if d < floor {
+		d = floor
+	}
+	if ceiling > 0 && d > ceiling {
+		d = ceiling
+	}
+	return d
+}
+
+// observeRTT records a round trip measured on a first attempt. Replies to
+// retransmissions are ambiguous and never sampled (Karn's algorithm).
+// serverMicros is the processing time the reply reports, 0 if none.
+func (c *ClientState) observeRTT(r time.Duration, serverMicros uint64) {
+	c.rtt.observe(r)
+	if serverMicros > 0 {
+		c.latency.observe(r, time.Duration(serverMicros)*time.Microsecond)
+	}
+}
+
+// networkTime is the part of a round trip not spent in the server. Clock
+// granularity can make the reported server time exceed a very short round
+// trip, so it never goes below zero.
+func networkTime(rtt, server time.Duration) time.Duration {
+	if server >= rtt {
+		return 0
+	}
+	return rtt - server
+}
+
+// latencySplit divides round trips into the time the server reports
+// spending on the request and the rest, the network's, each smoothed like
+// the RTT itself.
+type latencySplit struct {
+	server  rttEstimator
+	network rttEstimator
+}
+
+// observe folds one round trip and its reported server time into the
+// estimates.
+func (l *latencySplit) observe(rtt, server time.Duration) {
+	l.server.observe(server)
+	l.network.observe(networkTime(rtt, server))
+}
+
+// summary describes the split for the status command.
+func (l *latencySplit) summary() string {
+	if l.server.samples == 0 {
+		return "no replies with server time yet"
+	}
+	return fmt.Sprintf("network ~%v, server ~%v (%d samples)",
+		l.network.srtt.Round(time.Microsecond), l.server.srtt.Round(time.Microsecond), l.server.samples)
+}
+
+// attemptTimeout returns how long attempt n (1-based) waits for a reply.
+// Until enough samples exist, or with -adaptiveTimeout=false, this is the
+// static -timeout. Otherwise it is the RTO, doubled for every retry up to
+// the ceiling.
+func (c *ClientState) attemptTimeout(attempt int) time.Duration {
+	if !c.AdaptiveTimeout || c.rtt.samples < minRTTSamples {
+		return c.Timeout
+	}
+	d := c.rtt.rto(c.MinTimeout, c.MaxTimeout)
+	for i := 1; i < attempt && (c.MaxTimeout <= 0 || d < c.MaxTimeout); i++ {
+		d *= 2
+	}
+	if c.MaxTimeout > 0 && d > c.MaxTimeout {
+		d = c.MaxTimeout
+	}
+	return d
+}
+
+// rttSummary describes the estimate for the status command.
+func (c *ClientState) rttSummary() string {
+	switch {
+	case !c.AdaptiveTimeout:
+		return "adaptive timeout disabled"
+	case c.rtt.samples < minRTTSamples:
+		return fmt.Sprintf("collecting samples (%d/%d), using static timeout", c.rtt.samples, minRTTSamples)
+	}
+	return fmt.Sprintf("srtt=%v rttvar=%v timeout=%v (%d samples, bounds %v..%v)",
+		c.rtt.srtt.Round(time.Microsecond), c.rtt.rttvar.Round(time.Microsecond),
+		c.attemptTimeout(1).Round(time.Microsecond), c.rtt.samples, c.MinTimeout, c.MaxTimeout)
+}
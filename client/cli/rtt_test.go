@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func ms(f float64) time.Duration {
+	return time.Duration(f * float64(time.Millisecond))
+}
+
+func TestRTTEstimator(t *testing.T) {
+	tests := []struct {
+		name         string
+		samples      []time.Duration
+		srtt, rttvar time.Duration
+	}{
+		{"first sample", []time.Duration{ms(100)}, ms(100), ms(50)},
+		{"steady", []time.Duration{ms(100), ms(100), ms(100)}, ms(100), ms(28.125)},
+		{"spike", []time.Duration{ms(100), ms(100), ms(100), ms(500)}, ms(150), ms(121.09375)},
+		{"drop", []time.Duration{ms(100), ms(20)}, ms(90), ms(57.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e rttEstimator
+			for _, r := range tt.samples {
+				e.observe(r)
+			}
+			if e.srtt != tt.srtt || e.rttvar != tt.rttvar || e.samples != len(tt.samples) {
+				t.Errorf("srtt=%v rttvar=%v samples=%d, want %v, %v, %d", e.srtt, e.rttvar, e.samples, tt.srtt, tt.rttvar, len(tt.samples))
+			}
+		})
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	steady := []time.Duration{ms(100), ms(100), ms(100)} // rto = 212.5ms
+	tests := []struct {
+		name     string
+		adaptive bool
+		samples  []time.Duration
+		min, max time.Duration
+		want     []time.Duration // for attempts 1, 2, ...
+	}{
+		{"disabled", false, steady, ms(50), 2 * time.Second,
+			[]time.Duration{time.Second, time.Second}},
+		{"too few samples", true, steady[:2], ms(50), 2 * time.Second,
+			[]time.Duration{time.Second, time.Second}},
+		{"backs off to the ceiling", true, steady, ms(50), 2 * time.Second,
+			[]time.Duration{ms(212.5), ms(425), ms(850), ms(1700), 2 * time.Second, 2 * time.Second}},
+		{"no ceiling", true, steady, ms(50), 0,
+			[]time.Duration{ms(212.5), ms(425), ms(850), ms(1700), ms(3400)}},
+		{"spike", true, []time.Duration{ms(100), ms(100), ms(100), ms(500)}, ms(50), 2 * time.Second,
+			[]time.Duration{ms(634.375), ms(1268.75), 2 * time.Second}},
+		{"floor", true, []time.Duration{ms(1), ms(1), ms(1)}, ms(50), 2 * time.Second,
+			[]time.Duration{ms(50), ms(100), ms(200)}},
+		{"ceiling below the rto", true, []time.Duration{ms(900), ms(900), ms(900)}, ms(50), time.Second,
+			[]time.Duration{time.Second, time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClientState{Timeout: time.Second, AdaptiveTimeout: tt.adaptive, MinTimeout: tt.min, MaxTimeout: tt.max}
+			for _, r := range tt.samples {
+				c.observeRTT(r, 0)
+			}
+			for i, want := range tt.want {
+				if got := c.attemptTimeout(i + 1); got != want {
+					t.Errorf("attempt %d: timeout %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpTimeoutOverridesAdaptive(t *testing.T) {
+	c := &ClientState{
+		Timeout:         time.Second,
+		AdaptiveTimeout: true,
+		MinTimeout:      ms(50),
+		MaxTimeout:      2 * time.Second,
+		OpTimeouts:      map[uint8]time.Duration{common.OpBookFacility: 5 * time.Second},
+	}
+	for i := 0; i < 3; i++ {
+		c.observeRTT(ms(100), 0)
+	}
+	if got := c.timeoutFor(common.OpBookFacility, 3); got != 5*time.Second {
+		t.Errorf("overridden op: %v, want 5s on every attempt", got)
+	}
+	if got := c.timeoutFor(common.OpQueryAvailability, 2); got != ms(425) {
+		t.Errorf("other op: %v, want the adaptive 425ms", got)
+	}
+}
+
+// TestRetransmissionsAreNotSampled checks Karn's rule end to end: only
+// replies to a first attempt feed the estimator.
+func TestRetransmissionsAreNotSampled(t *testing.T) {
+	srv := newFakeServer(t, dropFirst())
+	c := newTestClient(t, srv.Addr())
+	c.AdaptiveTimeout = true
+
+	for i := 0; i < 3; i++ {
+		if _, err := query(c, "RoomA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.rtt.samples != 0 {
+		t.Errorf("%d samples from replies to retransmissions", c.rtt.samples)
+	}
+
+	srv = newFakeServer(t, echoHandler)
+	c = newTestClient(t, srv.Addr())
+	c.AdaptiveTimeout = true
+	for i := 0; i < 3; i++ {
+		if _, err := query(c, "RoomA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.rtt.samples != 3 {
+		t.Errorf("%d samples from three first-attempt replies, want 3", c.rtt.samples)
+	}
+}
+
+func TestLatencySplit(t *testing.T) {
+	tests := []struct{ rtt, server, network time.Duration }{
+		{ms(10), ms(2), ms(8)},
+		{ms(10), 0, ms(10)},
+		{ms(1), ms(3), 0}, // clock granularity: never negative
+	}
+	for _, tt := range tests {
+		if got := networkTime(tt.rtt, tt.server); got != tt.network {
+			t.Errorf("networkTime(%v, %v) = %v, want %v", tt.rtt, tt.server, got, tt.network)
+		}
+	}
+
+	c := &ClientState{}
+	c.observeRTT(ms(100), 0) // e.g. a ping or an older server: no split
+	if got := c.latency.summary(); got != "no replies with server time yet" {
+		t.Errorf("summary without server time: %q", got)
+	}
+	c.observeRTT(ms(100), 20000)
+	c.observeRTT(ms(100), 20000)
+	if c.rtt.samples != 3 || c.latency.server.samples != 2 {
+		t.Errorf("%d RTT and %d split samples, want 3 and 2", c.rtt.samples, c.latency.server.samples)
+	}
+	if got, want := c.latency.summary(), "network ~80ms, server ~20ms (2 samples)"; got != want {
+		t.Errorf("summary %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// saveOutputFile writes rendered output to path, creating missing
+// directories. An existing file is only replaced when overwrite is set;
+// otherwise the error wraps fs.ErrExist.
+func saveOutputFile(path, output string, overwrite bool) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(output); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// offerSave asks whether to save output that has already been printed. An
+// existing file is only replaced after confirmation. Failures are reported
+// but leave the printed output as it is.
+func offerSave(reader *bufio.Reader, output string) {
+	fmt.Print("Save to file? Enter a path (empty to skip): ")
+	path, _ := reader.ReadString('\n')
+	if path = strings.TrimSpace(path); path == "" {
+		return
+	}
+
+	err := saveOutputFile(path, output, false)
+	if errors.Is(err, fs.ErrExist) {
+		fmt.Printf("%s already exists. Overwrite? (y/N): ", path)
+		answer, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			fmt.Println("Not saved.")
+			return
+		}
+		err = saveOutputFile(path, output, true)
+	}
+	if err != nil {
+		fmt.Printf("Could not save output: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved to %s\n", path)
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readFile returns the content of path, or fails the test.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSaveOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "week", "query.txt")
+	if err := saveOutputFile(path, "first\n", false); err != nil {
+		t.Fatalf("saveOutputFile into missing directories: %v", err)
+	}
+	if got := readFile(t, path); got != "first\n" {
+		t.Errorf("file holds %q", got)
+	}
+
+	if err := saveOutputFile(path, "second\n", false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("second save without overwrite: %v, want fs.ErrExist", err)
+	}
+	if got := readFile(t, path); got != "first\n" {
+		t.Errorf("refused save changed the file to %q", got)
+	}
+
+	if err := saveOutputFile(path, "2nd\n", true); err != nil {
+		t.Fatalf("save with overwrite: %v", err)
+	}
+	if got := readFile(t, path); got != "2nd\n" {
+		t.Errorf("overwritten file holds %q, want the shorter output only", got)
+	}
+}
+
+func TestOfferSave(t *testing.T) {
+	outputs := map[string]string{
+		"query":  "Availability for RoomA:\nMonday:\n  - BKG-10000: 09:00 to 10:00\n",
+		"status": "Server: udp://127.0.0.1:2222\nRequests sent: 3\n",
+	}
+	for name, output := range outputs {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "out", name+".txt")
+
+			offerSave(bufio.NewReader(strings.NewReader("\n")), output)
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("empty answer wrote %v", entries)
+			}
+
+			offerSave(bufio.NewReader(strings.NewReader(path+"\n")), output)
+			if got := readFile(t, path); got != output {
+				t.Errorf("saved %q, want %q", got, output)
+			}
+
+			offerSave(bufio.NewReader(strings.NewReader(path+"\nn\n")), "other")
+			if got := readFile(t, path); got != output {
+				t.Errorf("declined overwrite changed the file to %q", got)
+			}
+			offerSave(bufio.NewReader(strings.NewReader(path+"\n")), "other")
+			if got := readFile(t, path); got != output {
+				t.Errorf("unanswered overwrite changed the file to %q", got)
+			}
+
+			offerSave(bufio.NewReader(strings.NewReader(path+"\ny\n")), "other")
+			if got := readFile(t, path); got != "other" {
+				t.Errorf("confirmed overwrite left %q", got)
+			}
+		})
+	}
+}
+
+// TestOfferSaveFailure: a path that cannot be written is reported without
+// creating anything.
+func TestOfferSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(blocker, "out.txt")
+	offerSave(bufio.NewReader(strings.NewReader(path+"\n")), "output")
+	if _, err := os.Stat(path); err == nil {
+		t.Error("output written under a file")
+	}
+}
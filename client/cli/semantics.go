@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// ParseSemanticsHint maps a -semantics value to a header hint.
+func ParseSemanticsHint(name string) (uint8, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "0", "default":
+		return common.HintServerDefault, nil
+	case "1", "at-least-once":
+		return common.HintAtLeastOnce, nil
+	case "2", "at-most-once":
+		return common.HintAtMostOnce, nil
+	}
+	return 0, fmt.Errorf("unknown semantics %q", name)
+}
+
+// semanticsName describes a hint for display.
+func semanticsName(hint uint8) string {
+	switch hint {
+	case common.HintAtLeastOnce:
+		return "at-least-once"
+	case common.HintAtMostOnce:
+		return "at-most-once"
+	}
+	return "server default"
+}
+
+// handleSemantics chooses the semantics hint sent with the following requests
+func (c *ClientState) handleSemantics(reader *bufio.Reader) {
+	fmt.Printf("Current semantics: %s\n", semanticsName(c.SemanticsHint))
+	fmt.Print("Enter semantics (0=server default, 1=at-least-once, 2=at-most-once): ")
+	input, _ := reader.ReadString('\n')
+	hint, err := ParseSemanticsHint(input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	c.SemanticsHint = hint
+	fmt.Printf("Following requests use %s semantics.\n", semanticsName(hint))
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestParseSemanticsHint(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint8
+		wantErr bool
+	}{
+		{"", common.HintServerDefault, false},
+		{"default", common.HintServerDefault, false},
+		{"0", common.HintServerDefault, false},
+		{"1", common.HintAtLeastOnce, false},
+		{" At-Least-Once\n", common.HintAtLeastOnce, false},
+		{"2", common.HintAtMostOnce, false},
+		{"at-most-once", common.HintAtMostOnce, false},
+		{"3", 0, true},
+		{"exactly-once", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSemanticsHint(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSemanticsHint(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestSemanticsHintIsSent: every request, retransmissions included,
+// carries the chosen hint.
+func TestSemanticsHintIsSent(t *testing.T) {
+	srv := newFakeServer(t, dropFirst())
+	c := newTestClient(t, srv.Addr())
+	c.SemanticsHint = common.HintAtMostOnce
+
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatal(err)
+	}
+	got := srv.received()
+	if len(got) != 2 {
+		t.Fatalf("server saw %d attempts, want 2", len(got))
+	}
+	for i, req := range got {
+		if req.Semantics != common.HintAtMostOnce {
+			t.Errorf("attempt %d carried hint %d", i+1, req.Semantics)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Login registers (or logs in) the user and stores the returned session
+// token, which is then attached to every request. The credentials are kept
+// so an expired session can be renewed transparently.
+func (c *ClientState) Login(username, password string) error {
+	if c.instance == "" {
+		c.instance = newInstanceID()
+	}
+	req := common.RequestMessage{
+		OpCode:         common.OpRegisterUser,
+		RequestID:      c.GetNextRequestID(),
+		Username:       username,
+		Password:       password,
+		ClientInstance: c.instance,
+	}
+	reply, err := c.SendRequest(req)
+	if err != nil {
+		return err
+	}
+	if reply.Status != common.StatusOK {
+		return fmt.Errorf("%s", reply.Data)
+	}
+	c.Username = username
+	c.Password = password
+	c.SessionToken = reply.Data
+	return nil
+}
+
+// newInstanceID returns a random ID for this run of the client. The server
+// keys the duplicate history of logged-in requests by user and this ID.
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// handleRegister implements the RegisterUser operation
+func (c *ClientState) handleRegister(reader *bufio.Reader) {
+	fmt.Print("Enter Username: ")
+	username, _ := reader.ReadString('\n')
+	username = strings.TrimSpace(username)
+
+	fmt.Print("Enter Password (optional): ")
+	password, _ := reader.ReadString('\n')
+	password = strings.TrimSpace(password)
+
+	if err := c.Login(username, password); err != nil {
+		fmt.Println("\nFailed to register!")
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("\nLogged in as %s.\n", username)
+}
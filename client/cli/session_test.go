@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// sessionServer hands out tokens on OpRegisterUser and refuses other
+// requests whose token it does not know.
+type sessionServer struct {
+	*fakeServer
+	mu     sync.Mutex
+	tokens map[string]string // token -> user
+	issued int
+}
+
+func newSessionServer(t *testing.T) *sessionServer {
+	s := &sessionServer{tokens: make(map[string]string)}
+	s.fakeServer = newFakeServer(t, s.handle)
+	return s
+}
+
+func (s *sessionServer) handle(req common.RequestMessage) *common.ReplyMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.OpCode == common.OpRegisterUser {
+		s.issued++
+		token := fmt.Sprintf("token-%d", s.issued)
+		s.tokens[token] = req.Username
+		return okReply(req, token)
+	}
+	if req.SessionToken != "" && s.tokens[req.SessionToken] == "" {
+		return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusBadSession, Data: "Session expired or unknown; register again"}
+	}
+	return okReply(req, "ok")
+}
+
+// forget drops every session, as a restarted server would.
+func (s *sessionServer) forget() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]string)
+}
+
+func TestLoginAttachesToken(t *testing.T) {
+	srv := newSessionServer(t)
+	c := newTestClient(t, srv.Addr())
+
+	if err := c.Login("alice", "pw"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if c.SessionToken != "token-1" {
+		t.Fatalf("SessionToken = %q, want token-1", c.SessionToken)
+	}
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatal(err)
+	}
+	got := srv.received()
+	if got[0].SessionToken != "" {
+		t.Errorf("RegisterUser carried token %q", got[0].SessionToken)
+	}
+	if got[0].ClientInstance == "" {
+		t.Error("RegisterUser carried no client instance")
+	}
+	if got[1].SessionToken != "token-1" {
+		t.Errorf("query carried token %q, want token-1", got[1].SessionToken)
+	}
+}
+
+func TestExpiredSessionLogsInAgain(t *testing.T) {
+	srv := newSessionServer(t)
+	c := newTestClient(t, srv.Addr())
+	if err := c.Login("alice", "pw"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	instance := srv.received()[0].ClientInstance
+	srv.forget()
+
+	rep, err := query(c, "RoomA")
+	if err != nil || rep.Status != common.StatusOK {
+		t.Fatalf("query after the server forgot the session: %v, %+v", err, rep)
+	}
+	if c.SessionToken != "token-2" {
+		t.Errorf("SessionToken = %q, want the new token-2", c.SessionToken)
+	}
+	got := srv.received()
+	// login, refused query, login again, resent query
+	if len(got) != 4 {
+		t.Fatalf("server saw %d requests, want 4", len(got))
+	}
+	if got[2].OpCode != common.OpRegisterUser || got[2].Username != "alice" || got[2].Password != "pw" {
+		t.Errorf("third request is %+v, want a login with the stored credentials", got[2])
+	}
+	if got[2].ClientInstance != instance {
+		t.Errorf("login again sent instance %q, want the run's %q", got[2].ClientInstance, instance)
+	}
+	if got[3].RequestID != got[1].RequestID || got[3].SessionToken != "token-2" {
+		t.Errorf("resend is ID %d with token %q, want ID %d with token-2", got[3].RequestID, got[3].SessionToken, got[1].RequestID)
+	}
+}
+
+func TestBadSessionWithoutCredentials(t *testing.T) {
+	srv := newSessionServer(t)
+	c := newTestClient(t, srv.Addr())
+	c.SessionToken = "stale"
+
+	rep, err := query(c, "RoomA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Status != common.StatusBadSession {
+		t.Errorf("status %d, want %d", rep.Status, common.StatusBadSession)
+	}
+	if c.SessionToken != "" {
+		t.Errorf("SessionToken = %q, want it cleared", c.SessionToken)
+	}
+	if n := len(srv.received()); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
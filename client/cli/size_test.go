@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestMaxRequestSizeIsCheckedLocally: a request over -maxRequestSize is
+// refused before it is sent; one at the limit goes out.
+func TestMaxRequestSizeIsCheckedLocally(t *testing.T) {
+	srv := newFakeServer(t, echoHandler)
+	c := newTestClient(t, srv.Addr())
+
+	req := common.RequestMessage{OpCode: common.OpBookFacility, FacilityName: "RoomA", StartHour: 9, EndHour: 10, IdempotencyKey: strings.Repeat("k", 100)}
+	// SendRequest adds a timestamp, which is of fixed size
+	stamped := req
+	stamped.Timestamp = 1
+	data, err := c.encodeRequest(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(data)
+
+	tests := []struct {
+		limit  int
+		wantOK bool
+	}{
+		{size + 1, true},
+		{size, true},
+		{size - 1, false},
+		{0, true}, // no limit
+	}
+	for _, tt := range tests {
+		c.MaxRequestSize = tt.limit
+		before := len(srv.received())
+		req.RequestID = c.GetNextRequestID()
+		_, err := c.SendRequest(req)
+		sent := len(srv.received()) > before
+		if (err == nil) != tt.wantOK || sent != tt.wantOK {
+			t.Errorf("limit %d for a %d-byte request: err = %v, sent = %v", tt.limit, size, err, sent)
+		}
+		if !tt.wantOK && !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("limit %d: error %q does not explain the refusal", tt.limit, err)
+		}
+	}
+}
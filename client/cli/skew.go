@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// measureSkew sets the clock offset from the server clock in a Ping or
+// Hello reply, taking it as read halfway through the round trip that began
+// at sent. Every later request is stamped with the corrected clock, so a
+// server with -maxSkew accepts it without first refusing one as stale, and
+// monitor expiries are read in server time. Replies from servers that do
+// not send their clock change nothing.
+func (c *ClientState) measureSkew(reply common.ReplyMessage, sent time.Time, rtt time.Duration) {
+	if reply.ServerClock == 0 {
+		return
+	}
+	c.clockOffset = time.UnixMilli(reply.ServerClock).Sub(sent.Add(rtt / 2))
+	c.clockMeasured = true
+}
+
+// describeSkew says how a clock offset puts the server relative to this
+// client. The server clock has millisecond resolution, so an offset of a
+// millisecond or less counts as none.
+func describeSkew(offset time.Duration) string {
+	offset = offset.Round(time.Millisecond)
+	switch {
+	case offset > time.Millisecond:
+		return fmt.Sprintf("%v ahead of this client", offset)
+	case offset < -time.Millisecond:
+		return fmt.Sprintf("%v behind this client", -offset)
+	}
+	return "in step with this client"
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestMeasureSkew takes the server clock as read halfway through the round
+// trip, with the server ahead and behind.
+func TestMeasureSkew(t *testing.T) {
+	sent := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	const rtt = 40 * time.Millisecond
+	for _, skew := range []time.Duration{90 * time.Second, -90 * time.Second, 0} {
+		c := &ClientState{}
+		c.measureSkew(common.ReplyMessage{ServerClock: sent.Add(rtt / 2).Add(skew).UnixMilli()}, sent, rtt)
+		if !c.clockMeasured || c.clockOffset != skew {
+			t.Errorf("skew %v measured as %v", skew, c.clockOffset)
+		}
+	}
+
+	// A server that does not send its clock leaves the offset alone
+	c := &ClientState{clockOffset: time.Minute}
+	c.measureSkew(common.ReplyMessage{}, sent, rtt)
+	if c.clockMeasured || c.clockOffset != time.Minute {
+		t.Errorf("reply without a clock changed the offset to %v", c.clockOffset)
+	}
+}
+
+func TestDescribeSkew(t *testing.T) {
+	tests := map[time.Duration]string{
+		90 * time.Second:        "1m30s ahead of this client",
+		-90 * time.Second:       "1m30s behind this client",
+		time.Millisecond:        "in step with this client",
+		-400 * time.Microsecond: "in step with this client",
+		0:                       "in step with this client",
+	}
+	for offset, want := range tests {
+		if got := describeSkew(offset); got != want {
+			t.Errorf("describeSkew(%v) = %q, want %q", offset, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleSplitBooking gives up part of a booking, or splits it in two at a
+// point in time. A new piece made from one of this session's bookings
+// counts as this session's too.
+func (c *ClientState) handleSplitBooking(reader *bufio.Reader) {
+	fmt.Print("Enter Booking Confirmation ID: ")
+	confirmationID, _ := reader.ReadString('\n')
+	confirmationID = strings.TrimSpace(confirmationID)
+
+	fmt.Print("Enter the part to give up, e.g. \"Mon 10:00-11:00\", or a time to split at, e.g. \"Mon 10:00\": ")
+	line, _ := reader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	var sd, sh, sm, ed, eh, em uint8
+	var err error
+	if len(strings.Fields(line)) == 2 && !strings.Contains(line, "-") {
+		sd, sh, sm, err = utils.ParseWeekTime(line)
+		ed, eh, em = sd, sh, sm
+	} else {
+		sd, sh, sm, ed, eh, em, err = utils.ParseTimeRange(line)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:         common.OpSplitBooking,
+		RequestID:      c.GetNextRequestID(),
+		ConfirmationID: confirmationID,
+		StartDay:       sd,
+		StartHour:      sh,
+		StartMinute:    sm,
+		EndDay:         ed,
+		EndHour:        eh,
+		EndMinute:      em,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if reply.Status == common.StatusOK {
+		if newID := confirmationIDFromReply(reply.Data); newID != "" && c.myBookings[confirmationID] {
+			c.myBookings[newID] = true
+		}
+		fmt.Println("\nBooking split successfully!")
+		fmt.Println(reply.Data)
+	} else {
+		fmt.Println("\nFailed to split booking!")
+		fmt.Printf("Error: %s\n", reply.Data)
+	}
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// clientStats counts this session's traffic for the status command.
+// callbacks and keepalives are atomic because the monitor goroutine updates
+// them.
+type clientStats struct {
+	requests    uint64 // SendRequest calls
+	failures    uint64 // requests that ended without a reply
+	packetsSent uint64 // every transmission, including retries
+	retries     uint64 // retransmissions after a timeout
+	busy        uint64 // resends after a busy reply's retry-after
+	replies     uint64 // replies matched to a request
+	callbacks   atomic.Uint64
+	keepalives  atomic.Uint64 // keepalive callbacks, not counted in callbacks
+	lastSuccess time.Time
+}
+
+// handleStatus prints connection health and session statistics and offers
+// to save them.
+func (c *ClientState) handleStatus(reader *bufio.Reader) {
+	var out strings.Builder
+	c.writeStatus(&out)
+	fmt.Print("\n" + out.String())
+	offerSave(reader, out.String())
+}
+
+// writeStatus renders the status report.
+func (c *ClientState) writeStatus(w io.Writer) {
+	fmt.Fprintln(w, "Client status:")
+	fmt.Fprintf(w, "  Active server: %s\n", c.ActiveServer())
+	switch {
+	case c.negotiated && c.server.ProtocolVersion == 0:
+		fmt.Fprintln(w, "  Server info: legacy server (no hello handshake)")
+	case c.negotiated:
+		fmt.Fprintf(w, "  Server info: %s\n", c.server)
+	}
+	if len(c.ServerAddrs) > 1 {
+		fmt.Fprintf(w, "  Configured servers: %v\n", c.ServerAddrs)
+	}
+	if c.Username != "" {
+		fmt.Fprintf(w, "  Logged in as: %s\n", c.Username)
+	}
+	if c.Namespace != "" {
+		fmt.Fprintf(w, "  Namespace: %s\n", c.Namespace)
+	}
+
+	retries := "unlimited"
+	if c.Retries > 0 {
+		retries = fmt.Sprintf("%d", c.Retries)
+	}
+	fmt.Fprintf(w, "  Timeout: %v, attempts per server: %s\n", c.Timeout, retries)
+	c.writeOpTable(w)
+	fmt.Fprintf(w, "  RTT estimate: %s\n", c.rttSummary())
+	fmt.Fprintf(w, "  Latency split: %s\n", c.latency.summary())
+	fmt.Fprintf(w, "  Semantics: %s\n", semanticsName(c.SemanticsHint))
+	if c.clockMeasured {
+		fmt.Fprintf(w, "  Clock offset: %v (server clock %s)\n", c.clockOffset.Round(time.Millisecond), describeSkew(c.clockOffset))
+	} else if c.clockOffset != 0 {
+		fmt.Fprintf(w, "  Clock offset: %v\n", c.clockOffset.Round(time.Millisecond))
+	}
+
+	if c.stats.lastSuccess.IsZero() {
+		fmt.Fprintln(w, "  Last successful request: never")
+	} else {
+		fmt.Fprintf(w, "  Last successful request: %s (%v ago)\n",
+			c.stats.lastSuccess.Format("15:04:05"), time.Since(c.stats.lastSuccess).Round(time.Second))
+	}
+	fmt.Fprintf(w, "  Requests: %d (%d failed)\n", c.stats.requests, c.stats.failures)
+	fmt.Fprintf(w, "  Packets sent: %d (%d retries, %d after busy replies), replies received: %d\n",
+		c.stats.packetsSent, c.stats.retries, c.stats.busy, c.stats.replies)
+	fmt.Fprintf(w, "  Monitor callbacks received: %d (plus %d keepalives)\n", c.stats.callbacks.Load(), c.stats.keepalives.Load())
+
+	now := time.Now()
+	facilities := make([]string, 0, len(c.monitors))
+	for facility, expiry := range c.monitors {
+		if expiry.After(now) {
+			facilities = append(facilities, facility)
+		}
+	}
+	if len(facilities) == 0 {
+		fmt.Fprintln(w, "  Active monitors: none")
+		return
+	}
+	sort.Strings(facilities)
+	fmt.Fprintln(w, "  Active monitors:")
+	for _, facility := range facilities {
+		limits := ""
+		if f, ok := c.monitorFilters[facility]; ok {
+			limits = fmt.Sprintf(" (%s)", f)
+		}
+		fmt.Fprintf(w, "    - %s%s: %v left\n", facility, limits, c.monitors[facility].Sub(now).Round(time.Second))
+	}
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// dropFirst returns a handler that drops the first attempt of every
+// request and answers the retransmission.
+func dropFirst() func(common.RequestMessage) *common.ReplyMessage {
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	return func(req common.RequestMessage) *common.ReplyMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		if !seen[req.RequestID] {
+			seen[req.RequestID] = true
+			return nil
+		}
+		return okReply(req, "ok")
+	}
+}
+
+func TestStatusCounters(t *testing.T) {
+	type counts struct{ requests, failures, packetsSent, retries, busy, replies uint64 }
+	tests := []struct {
+		name    string
+		handler func(common.RequestMessage) *common.ReplyMessage
+		silent  bool
+		want    counts
+	}{
+		{"success", echoHandler, false, counts{1, 0, 1, 0, 0, 1}},
+		{"success after a retry", dropFirst(), false, counts{1, 0, 2, 1, 0, 1}},
+		{"failure", echoHandler, true, counts{1, 1, 2, 1, 0, 0}},
+		{"busy, then served", busyOnce(), false, counts{1, 0, 2, 0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t, tt.handler)
+			srv.silent.Store(tt.silent)
+			c := newTestClient(t, srv.Addr())
+
+			_, err := query(c, "RoomA")
+			if (err != nil) != tt.silent {
+				t.Fatalf("query: %v", err)
+			}
+			s := &c.stats
+			got := counts{s.requests, s.failures, s.packetsSent, s.retries, s.busy, s.replies}
+			if got != tt.want {
+				t.Errorf("counters = %+v, want %+v", got, tt.want)
+			}
+			if s.lastSuccess.IsZero() != tt.silent {
+				t.Errorf("lastSuccess = %v", s.lastSuccess)
+			}
+		})
+	}
+}
+
+// busyOnce refuses the first attempt of every request as busy; the client
+// waits the shortest retry-after, a second, before resending.
+func busyOnce() func(common.RequestMessage) *common.ReplyMessage {
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	return func(req common.RequestMessage) *common.ReplyMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		if !seen[req.RequestID] {
+			seen[req.RequestID] = true
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusBusy, Data: common.BusyData(5*time.Millisecond, "queue full")}
+		}
+		return okReply(req, "ok")
+	}
+}
+
+// TestStatusAccumulates runs a mix of outcomes through one client and
+// checks the totals in the report.
+func TestStatusAccumulates(t *testing.T) {
+	srv := newFakeServer(t, dropFirst())
+	c := newTestClient(t, srv.Addr())
+
+	for i := 0; i < 3; i++ {
+		if _, err := query(c, "RoomA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.silent.Store(true)
+	if _, err := query(c, "RoomA"); err == nil {
+		t.Fatal("query to a silent server succeeded")
+	}
+	c.stats.callbacks.Add(2)
+
+	var out strings.Builder
+	c.writeStatus(&out)
+	for _, want := range []string{
+		"Active server: udp://" + srv.Addr(),
+		"Requests: 4 (1 failed)",
+		"Packets sent: 8 (4 retries, 0 after busy replies), replies received: 3",
+		"Monitor callbacks received: 2 (plus 0 keepalives)",
+		"Server info: ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Last successful request: never") {
+		t.Errorf("status claims no success:\n%s", out.String())
+	}
+}
+
+func TestStatusBeforeAnyRequest(t *testing.T) {
+	c := newTestClient(t, newFakeServer(t, echoHandler).Addr())
+	var out strings.Builder
+	c.writeStatus(&out)
+	for _, want := range []string{"Last successful request: never", "Requests: 0 (0 failed)", "Active monitors: none"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status lacks %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleListMonitors shows the server's active monitor subscriptions as a
+// table. The server only answers the admin.
+func (c *ClientState) handleListMonitors(reader *bufio.Reader) {
+	req := common.RequestMessage{
+		OpCode:    common.OpListMonitors,
+		RequestID: c.GetNextRequestID(),
+	}
+	reply, err := c.SendRequest(req)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if reply.Status != common.StatusOK {
+		fmt.Println(reply.Data)
+		return
+	}
+	monitors, err := common.ParseMonitorList(reply.Data)
+	if err != nil {
+		fmt.Printf("Error: malformed subscription list: %v\n", err)
+		return
+	}
+	if len(monitors) == 0 {
+		fmt.Println("No active monitor subscriptions.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FACILITY\tSUBSCRIBER\tLEFT\tDAYS\tEVENTS\tFAILURES")
+	for _, m := range monitors {
+		days := "all"
+		if len(m.Days) > 0 {
+			ds := make([]string, len(m.Days))
+			for i, d := range m.Days {
+				ds[i] = strconv.Itoa(int(d))
+			}
+			days = strings.Join(ds, ",")
+		}
+		events := "all"
+		if m.Events != 0 && m.Events != common.AllEvents {
+			events = common.EventMaskString(m.Events)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%d\n", m.Facility, m.Subscriber, m.Remaining.Round(time.Second), days, events, m.Failures)
+	}
+	w.Flush()
+}
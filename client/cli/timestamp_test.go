@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// skewedServer answers requests whose timestamp is within maxSkew of its
+// clock, which runs ahead of the client's by ahead, and refuses the rest as
+// stale, like a server started with -maxSkew. Its handshake reports a clock
+// helloAhead of the client's.
+func skewedServer(t *testing.T, ahead, maxSkew, helloAhead time.Duration) *fakeServer {
+	return newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		now := time.Now().Add(ahead)
+		skew := now.Sub(time.UnixMilli(req.Timestamp))
+		if skew < -maxSkew || skew > maxSkew {
+			return &common.ReplyMessage{
+				RequestID: req.RequestID,
+				OpCode:    req.OpCode,
+				Status:    common.StatusStaleRequest,
+				Data:      common.StaleRequestData(now, "Request timestamp is off."),
+			}
+		}
+		return okReply(req, "ok")
+	}, func(f *fakeServer) { f.clock = helloAhead })
+}
+
+// TestHelloCorrectsTimestamps: a server 10 minutes ahead reports its clock
+// in the handshake, and the very first request already carries a corrected
+// timestamp.
+func TestHelloCorrectsTimestamps(t *testing.T) {
+	srv := skewedServer(t, 10*time.Minute, 5*time.Second, 10*time.Minute)
+	c := newTestClient(t, srv.Addr())
+
+	rep, err := query(c, "RoomA")
+	if err != nil || rep.Status != common.StatusOK {
+		t.Fatalf("query: %v, %+v", err, rep)
+	}
+	if got := len(srv.received()); got != 1 {
+		t.Errorf("server saw %d requests, want 1 (no stale round trip)", got)
+	}
+	if d := c.clockOffset - 10*time.Minute; d < -time.Second || d > time.Second {
+		t.Errorf("clock offset = %v, want about 10m", c.clockOffset)
+	}
+}
+
+// TestStaleReplyResynchronises: the server's clock jumps after the
+// handshake; the first request is refused as stale and resent once with a
+// timestamp corrected from the server time in the refusal.
+func TestStaleReplyResynchronises(t *testing.T) {
+	for _, ahead := range []time.Duration{10 * time.Minute, -10 * time.Minute} {
+		t.Run(ahead.String(), func(t *testing.T) {
+			srv := skewedServer(t, ahead, 5*time.Second, 0)
+			c := newTestClient(t, srv.Addr())
+
+			rep, err := query(c, "RoomA")
+			if err != nil || rep.Status != common.StatusOK {
+				t.Fatalf("query: %v, %+v", err, rep)
+			}
+			got := srv.received()
+			if len(got) != 2 {
+				t.Fatalf("server saw %d requests, want the refused one and the resend", len(got))
+			}
+			if got[0].RequestID != got[1].RequestID {
+				t.Errorf("resend has RequestID %d, want %d", got[1].RequestID, got[0].RequestID)
+			}
+			if d := time.Duration(got[1].Timestamp-got[0].Timestamp) * time.Millisecond; d < ahead-time.Second || d > ahead+time.Second {
+				t.Errorf("resend timestamp moved by %v, want about %v", d, ahead)
+			}
+
+			// Later requests use the corrected clock straight away
+			if _, err := query(c, "RoomA"); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(srv.received()); n != 3 {
+				t.Errorf("server saw %d requests after a second query, want 3", n)
+			}
+		})
+	}
+}
+
+// TestStaleResendIsNotRepeated: a server whose window nothing satisfies
+// gets exactly one resend, not a loop.
+func TestStaleResendIsNotRepeated(t *testing.T) {
+	srv := skewedServer(t, 0, -time.Second, 0)
+	c := newTestClient(t, srv.Addr())
+
+	rep, err := query(c, "RoomA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Status != common.StatusStaleRequest {
+		t.Errorf("status %d, want stale", rep.Status)
+	}
+	if n := len(srv.received()); n != 2 {
+		t.Errorf("server saw %d requests, want 2", n)
+	}
+}
+
+// TestRetriesReuseTimestamp drops the first attempt; the retransmission
+// must carry the same timestamp, since it is the same packet.
+func TestRetriesReuseTimestamp(t *testing.T) {
+	var mu sync.Mutex
+	dropped := false
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		if !dropped {
+			dropped = true
+			return nil
+		}
+		return okReply(req, "ok")
+	})
+	c := newTestClient(t, srv.Addr())
+
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatal(err)
+	}
+	got := srv.received()
+	if len(got) != 2 {
+		t.Fatalf("server saw %d attempts, want 2", len(got))
+	}
+	if got[0].Timestamp == 0 || got[0].Timestamp != got[1].Timestamp {
+		t.Errorf("timestamps %d and %d, want the same non-zero value", got[0].Timestamp, got[1].Timestamp)
+	}
+}
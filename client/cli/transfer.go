@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// handleTransferBooking moves a booking to another facility at the same
+// time, keeping its confirmation ID.
+func (c *ClientState) handleTransferBooking(reader *bufio.Reader) {
+	fmt.Print("Enter Booking Confirmation ID: ")
+	confirmationID, _ := reader.ReadString('\n')
+	confirmationID = strings.TrimSpace(confirmationID)
+
+	fmt.Print("Enter facility to move it to: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+	if err := validate.ValidateFacilityName(facilityName); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:         common.OpTransferBooking,
+		RequestID:      c.GetNextRequestID(),
+		ConfirmationID: confirmationID,
+		FacilityName:   facilityName,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if reply.Status == common.StatusOK {
+		fmt.Println("\nBooking transferred successfully!")
+		fmt.Println(reply.Data)
+	} else {
+		fmt.Println("\nFailed to transfer booking!")
+		fmt.Printf("Error: %s\n", reply.Data)
+	}
+}
@@ -0,0 +1,277 @@
+package cli
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Transports selectable with -transport
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+)
+
+// IP families selectable with -ipFamily
+const (
+	FamilyAuto = "auto" // prefer IPv6 when the name has an AAAA record
+	FamilyIPv4 = "4"
+	FamilyIPv6 = "6"
+)
+
+// resolveServer resolves addr ("host:port", IPv6 literals in brackets, with
+// an optional %zone) to one IP according to IPFamily.
+func (c *ClientState) resolveServer(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return "", err
+	}
+	var v4, v6 *net.IPAddr
+	for i := range ips {
+		if ips[i].IP.To4() != nil {
+			if v4 == nil {
+				v4 = &ips[i]
+			}
+		} else if v6 == nil {
+			v6 = &ips[i]
+		}
+	}
+	chosen := v6
+	switch {
+	case c.IPFamily == FamilyIPv4:
+		chosen = v4
+	case c.IPFamily == FamilyIPv6:
+	case chosen == nil:
+		chosen = v4
+	}
+	if chosen == nil {
+		return "", fmt.Errorf("%s has no IPv%s address", host, c.IPFamily)
+	}
+	return net.JoinHostPort(chosen.String(), port), nil
+}
+
+// dial opens a connection to addr using the configured transport.
+func (c *ClientState) dial(addr string) error {
+	resolved, err := c.resolveServer(addr)
+	if err != nil {
+		return fmt.Errorf("invalid server address %s: %w", addr, err)
+	}
+
+	if c.Transport == TransportTCP {
+		conn, err := net.DialTimeout("tcp", resolved, c.Timeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", addr, err)
+		}
+		c.closeConn()
+		c.tcpConn = conn
+		c.tcpBuf = nil
+		return nil
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", resolved)
+	if err != nil {
+		return fmt.Errorf("invalid server address %s: %w", addr, err)
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", udpAddr, err)
+	}
+	c.closeConn()
+	c.Conn = conn
+	return nil
+}
+
+// closeConn closes whichever connection is open.
+func (c *ClientState) closeConn() {
+	if c.Conn != nil {
+		c.Conn.Close()
+		c.Conn = nil
+	}
+	if c.tcpConn != nil {
+		c.tcpConn.Close()
+		c.tcpConn = nil
+	}
+}
+
+// Close releases the client's connection.
+func (c *ClientState) Close() {
+	c.closeConn()
+}
+
+// writePacket sends one marshaled message to the server.
+func (c *ClientState) writePacket(data []byte) error {
+	if c.Debug {
+		log.Print(common.DumpPacket(common.DumpSent, data))
+	}
+	if c.Transport == TransportTCP {
+		if c.tcpConn == nil {
+			return fmt.Errorf("not connected")
+		}
+		return common.WriteFrame(c.tcpConn, data)
+	}
+	_, err := c.Conn.Write(common.PrefixLength(data))
+	return err
+}
+
+// readPacket waits until deadline for one message from the server.
+func (c *ClientState) readPacket(deadline time.Time) ([]byte, error) {
+	payload, err := c.readMessage(deadline)
+	if err == nil && c.Debug {
+		log.Print(common.DumpPacket(common.DumpReceived, payload))
+	}
+	return payload, err
+}
+
+func (c *ClientState) readMessage(deadline time.Time) ([]byte, error) {
+	if c.Transport == TransportTCP {
+		return c.readTCPFrame(deadline)
+	}
+	c.Conn.SetReadDeadline(deadline)
+	buffer := make([]byte, 65536) // largest possible datagram
+	n, _, err := c.Conn.ReadFromUDP(buffer)
+	if err != nil {
+		return nil, err
+	}
+	payload, _, err := common.SplitLength(buffer[:n])
+	if err != nil {
+		return nil, fmt.Errorf("bad reply: %w", err)
+	}
+	return payload, nil
+}
+
+// readTCPFrame reassembles one length-prefixed frame. Partial data read
+// before a deadline expires is kept in tcpBuf for the next call, so the
+// monitor loop's short polling deadlines never desynchronise the stream.
+func (c *ClientState) readTCPFrame(deadline time.Time) ([]byte, error) {
+	if c.tcpConn == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	c.tcpConn.SetReadDeadline(deadline)
+	chunk := make([]byte, 4096)
+	for {
+		if len(c.tcpBuf) >= 4 {
+			n := binary.BigEndian.Uint32(c.tcpBuf[:4])
+			if n > common.MaxFrameSize {
+				return nil, fmt.Errorf("frame of %d bytes exceeds limit", n)
+			}
+			if len(c.tcpBuf) >= 4+int(n) {
+				frame := make([]byte, n)
+				copy(frame, c.tcpBuf[4:4+n])
+				c.tcpBuf = c.tcpBuf[4+n:]
+				return frame, nil
+			}
+		}
+		k, err := c.tcpConn.Read(chunk)
+		c.tcpBuf = append(c.tcpBuf, chunk[:k]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// encodeRequest marshals a request in the configured namespace and applies
+// the configured authentication/encryption.
+func (c *ClientState) encodeRequest(req common.RequestMessage) ([]byte, error) {
+	if req.Namespace == "" {
+		req.Namespace = c.Namespace
+	}
+	data, err := common.MarshalRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Security.Seal(data)
+}
+
+// decodeReply verifies, decrypts and unmarshals a reply or callback. A
+// plaintext StatusAuthRequired reply is passed through so the server's
+// explanation of a configuration mismatch reaches the user.
+func (c *ClientState) decodeReply(raw []byte) (common.ReplyMessage, error) {
+	if !common.HasMagic(raw) {
+		return common.ReplyMessage{}, common.ErrBadMagic
+	}
+	body, err := c.Security.Open(raw)
+	if err != nil {
+		if errors.Is(err, common.ErrMissingMAC) || errors.Is(err, common.ErrNotEncrypted) {
+			if rep, uerr := common.UnmarshalReply(raw); uerr == nil && rep.Status == common.StatusAuthRequired {
+				return rep, nil
+			}
+		}
+		return common.ReplyMessage{}, err
+	}
+	return common.UnmarshalReply(body)
+}
+
+// exchange sends data to the current server over the configured transport
+// and returns the matching reply.
+func (c *ClientState) exchange(req common.RequestMessage, data []byte) (*common.ReplyMessage, error) {
+	if c.Transport == TransportTCP {
+		return c.sendTCP(req, data)
+	}
+	return c.sendWithRetries(data, req.OpCode)
+}
+
+// sendTCP performs one exchange over the persistent TCP connection. TCP
+// already retransmits, so there is a single attempt bounded by Timeout;
+// callbacks that arrive while waiting are printed and skipped.
+func (c *ClientState) sendTCP(req common.RequestMessage, data []byte) (*common.ReplyMessage, error) {
+	if c.tcpConn == nil {
+		// The connection broke on an earlier request: the new one has a new
+		// source port, so monitors are re-bound to it
+		if err := c.redial(); err != nil {
+			if isRefused(err) {
+				fmt.Printf("Server unreachable at %s - is it running?\n", c.ActiveServer())
+				return nil, fmt.Errorf("%w: %v", errUnreachable, err)
+			}
+			return nil, err
+		}
+	}
+	if err := c.writePacket(data); err != nil {
+		c.closeConn() // re-dial on the next request
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	c.stats.packetsSent++
+
+	sent := time.Now()
+	timeout := c.staticTimeoutFor(req.OpCode)
+	deadline := sent.Add(timeout)
+	for {
+		raw, err := c.readPacket(deadline)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, fmt.Errorf("%w within %v", errNoReply, timeout)
+			}
+			c.closeConn()
+			return nil, fmt.Errorf("connection error: %w", err)
+		}
+		reply, err := c.decodeReply(raw)
+		if errors.Is(err, common.ErrBadMAC) || errors.Is(err, common.ErrDecrypt) {
+			fmt.Println("Dropping reply that failed authentication.")
+			continue
+		}
+		if errors.Is(err, common.ErrBadMagic) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding reply: %w", err)
+		}
+		if reply.RequestID != req.RequestID {
+			if classifyPacket(reply) == packetCallback {
+				c.handleMonitorPacket(reply)
+			}
+			continue
+		}
+		c.stats.replies++
+		c.observeRTT(time.Since(sent), reply.ServerMicros)
+		return &reply, nil
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// onIPv6 makes a fake server listen on the IPv6 loopback.
+func onIPv6(f *fakeServer) { f.ip = net.IPv6loopback }
+
+func TestResolveServer(t *testing.T) {
+	tests := []struct {
+		addr, family string
+		want         string // "" when resolving fails
+	}{
+		{"127.0.0.1:9000", FamilyAuto, "127.0.0.1:9000"},
+		{"127.0.0.1:9000", FamilyIPv4, "127.0.0.1:9000"},
+		{"127.0.0.1:9000", FamilyIPv6, ""},
+		{"[::1]:9000", FamilyAuto, "[::1]:9000"},
+		{"[::1]:9000", FamilyIPv6, "[::1]:9000"},
+		{"[::1]:9000", FamilyIPv4, ""},
+		{"[fe80::1%lo]:9000", FamilyAuto, "[fe80::1%lo]:9000"},
+		{"no-port", FamilyAuto, ""},
+	}
+	for _, tt := range tests {
+		c := &ClientState{IPFamily: tt.family}
+		got, err := c.resolveServer(tt.addr)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolveServer(%q) with family %s = %q, want an error", tt.addr, tt.family, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveServer(%q) with family %s = %q, %v; want %q", tt.addr, tt.family, got, err, tt.want)
+		}
+	}
+}
+
+func TestClientOverIPv6(t *testing.T) {
+	srv := newFakeServer(t, echoHandler, onIPv6)
+	if !strings.HasPrefix(srv.Addr(), "[::1]:") {
+		t.Fatalf("fake server on %s", srv.Addr())
+	}
+	c := newTestClient(t, srv.Addr())
+	if _, err := query(c, "RoomA"); err != nil {
+		t.Fatalf("query over IPv6: %v", err)
+	}
+	srv.mu.Lock()
+	from := srv.client
+	srv.mu.Unlock()
+	if from == nil || !from.IP.Equal(net.IPv6loopback) {
+		t.Errorf("request came from %v, want ::1", from)
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closedPort returns a local UDP address nothing is listening on.
+func closedPort(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func TestUnreachableServer(t *testing.T) {
+	addr := closedPort(t)
+	c := newTestClient(t, addr)
+
+	var err error
+	start := time.Now()
+	out := captureStdout(t, func() { _, err = query(c, "RoomA") })
+	if !errors.Is(err, errUnreachable) {
+		t.Fatalf("query to a closed port: %v, want errUnreachable", err)
+	}
+	if !strings.Contains(out, "Server unreachable at udp://"+addr+" - is it running?") {
+		t.Errorf("printed:\n%s", out)
+	}
+	if strings.Contains(out, "Timeout on attempt") {
+		t.Errorf("refusal reported as a timeout:\n%s", out)
+	}
+	if took := time.Since(start); took >= c.Timeout {
+		t.Errorf("gave up after %v, want at once", took)
+	}
+}
+
+// TestUnreachableRetried: with RetryRefused the client waits each attempt
+// out like a lost reply and ends with errNoReply.
+func TestUnreachableRetried(t *testing.T) {
+	c := newTestClient(t, closedPort(t))
+	c.RetryRefused = true
+
+	var err error
+	start := time.Now()
+	out := captureStdout(t, func() { _, err = query(c, "RoomA") })
+	if !errors.Is(err, errNoReply) {
+		t.Fatalf("query: %v, want errNoReply", err)
+	}
+	if took := time.Since(start); took < c.Timeout {
+		t.Errorf("retries spun for only %v", took)
+	}
+	if !strings.Contains(out, "Server unreachable at") {
+		t.Errorf("refusal not reported:\n%s", out)
+	}
+}
+
+// TestUnreachableFailsOver: a refusal moves on to the next server without
+// waiting out the retries.
+func TestUnreachableFailsOver(t *testing.T) {
+	second := newFakeServer(t, echoHandler)
+	c := newTestClient(t, closedPort(t), second.Addr())
+
+	var err error
+	out := captureStdout(t, func() { _, err = query(c, "RoomA") })
+	if err != nil {
+		t.Fatalf("query: %v\n%s", err, out)
+	}
+	if got, want := c.ActiveServer(), "udp://"+second.Addr(); got != want {
+		t.Errorf("ActiveServer() = %s, want %s", got, want)
+	}
+	if strings.Contains(out, "is not responding") {
+		t.Errorf("refusal treated as silence:\n%s", out)
+	}
+	if n := len(second.received()); n != 1 {
+		t.Errorf("second server saw %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// defaultWatchInterval is used when the watch command is given no interval.
+const defaultWatchInterval = 5 * time.Second
+
+// ANSI sequences used to redraw the watch view.
+const (
+	clearScreen    = "\033[H\033[2J"
+	highlightStart = "\033[1;33m"
+	highlightEnd   = "\033[0m"
+)
+
+// highlightChanges marks the lines of cur that differ from the line at the
+// same position in prev. Nothing is marked when there is no previous result.
+func highlightChanges(prev, cur string) string {
+	if prev == "" {
+		return cur
+	}
+	old := strings.Split(prev, "\n")
+	lines := strings.Split(cur, "\n")
+	for i, line := range lines {
+		if i < len(old) && old[i] == line {
+			continue
+		}
+		lines[i] = highlightStart + line + highlightEnd
+	}
+	return strings.Join(lines, "\n")
+}
+
+// changeSeq reads the "Seq=<number>" line that ends query and delta query
+// replies and returns the reply without it.
+func changeSeq(data string) (string, uint64, bool) {
+	body := strings.TrimRight(data, "\n")
+	i := strings.LastIndex(body, "\n")
+	seq, err := strconv.ParseUint(strings.TrimPrefix(body[i+1:], "Seq="), 10, 64)
+	if !strings.HasPrefix(body[i+1:], "Seq=") || err != nil {
+		return data, 0, false
+	}
+	if i < 0 {
+		return "", seq, true
+	}
+	return body[:i], seq, true
+}
+
+// queryChanges asks the server what changed at a facility since seq. If
+// nothing did, it returns the new number and unchanged is set. Otherwise
+// the caller should query in full; changes holds the server's list of
+// changes, if it sent one.
+func (c *ClientState) queryChanges(facility string, seq uint64) (next uint64, unchanged bool, changes string) {
+	reply, err := c.SendRequest(common.RequestMessage{
+		OpCode:       common.OpQueryChanges,
+		RequestID:    c.GetNextRequestID(),
+		FacilityName: facility,
+		SinceSeq:     seq,
+	})
+	if err != nil || reply.Status != common.StatusOK {
+		return 0, false, ""
+	}
+	body, next, ok := changeSeq(reply.Data)
+	if !ok {
+		return 0, false, ""
+	}
+	if body == "Unchanged." {
+		return next, true, ""
+	}
+	return next, false, body
+}
+
+// handleWatch implements the watch command: the query is repeated every
+// interval and redrawn, with changes since the previous result highlighted,
+// until the user presses Enter. Between full queries it only asks the
+// server what changed since the last one, and redraws nothing if the
+// facility did not change. Queries go through SendRequest on this
+// goroutine, so retries and the connection are handled as for any request.
+func (c *ClientState) handleWatch(reader *bufio.Reader) {
+	fmt.Print("Enter facility name: ")
+	facilityName, _ := reader.ReadString('\n')
+	facilityName = strings.TrimSpace(facilityName)
+
+	days, err := utils.ReadDaysList(reader)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Enter refresh interval in seconds (default %d): ", int(defaultWatchInterval/time.Second))
+	intervalStr, _ := reader.ReadString('\n')
+	interval := defaultWatchInterval
+	if intervalStr = strings.TrimSpace(intervalStr); intervalStr != "" {
+		n, err := strconv.Atoi(intervalStr)
+		if err != nil || n <= 0 {
+			fmt.Println("Invalid interval")
+			return
+		}
+		interval = time.Duration(n) * time.Second
+	}
+
+	input := c.startInput(reader)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var prev string
+	var seq uint64 // Seq= of the last full query; 0 until one succeeds
+	for {
+		select {
+		case <-input:
+			c.pendingInput = nil
+			fmt.Println("Stopped watching.")
+			return
+		case <-timer.C:
+		}
+
+		var changes string
+		if seq != 0 {
+			next, unchanged, delta := c.queryChanges(facilityName, seq)
+			if unchanged {
+				seq = next
+				timer.Reset(interval)
+				continue
+			}
+			changes = delta
+		}
+
+		req := common.RequestMessage{
+			OpCode:       common.OpQueryAvailability,
+			RequestID:    c.GetNextRequestID(),
+			FacilityName: facilityName,
+			DaysList:     days,
+		}
+		reply, err := c.SendRequest(req)
+
+		fmt.Print(clearScreen)
+		fmt.Printf("Watching %s every %v (updated %s). Press Enter to stop.\n\n",
+			facilityName, interval, time.Now().Format("15:04:05"))
+		switch {
+		case err != nil:
+			fmt.Printf("Error: %v\n", err)
+		case reply.Status != common.StatusOK:
+			fmt.Printf("Error: %s\n", reply.Data)
+		default:
+			// A server without delta queries sends no Seq=; keep
+			// querying it in full
+			body, next, ok := changeSeq(reply.Data)
+			seq = 0
+			if ok {
+				seq = next
+			}
+			fmt.Println(highlightChanges(prev, body))
+			if changes != "" {
+				fmt.Printf("\n%s\n", changes)
+			}
+			prev = body
+		}
+		timer.Reset(interval)
+	}
+}
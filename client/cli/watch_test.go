@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// hl marks a line the way highlightChanges does.
+func hl(line string) string {
+	return highlightStart + line + highlightEnd
+}
+
+func TestHighlightChanges(t *testing.T) {
+	week := []string{
+		"Monday: 09:00-10:00 booked",
+		"Monday: 09:00-10:00 booked\nTuesday: free",
+		"Monday: free\nTuesday: free",
+		"Monday: free\nTuesday: free\nWednesday: 10:00-12:00 booked",
+		"Monday: free",
+	}
+	tests := []struct {
+		name, prev, cur, want string
+	}{
+		{"first result", "", week[0], week[0]},
+		{"unchanged", week[1], week[1], week[1]},
+		{"line added", week[0], week[1], "Monday: 09:00-10:00 booked\n" + hl("Tuesday: free")},
+		{"line changed", week[1], week[2], hl("Monday: free") + "\nTuesday: free"},
+		{"line appended", week[2], week[3], "Monday: free\nTuesday: free\n" + hl("Wednesday: 10:00-12:00 booked")},
+		{"lines removed", week[3], week[4], "Monday: free"},
+	}
+	for _, tt := range tests {
+		if got := highlightChanges(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChangeSeq(t *testing.T) {
+	tests := []struct {
+		data, body string
+		seq        uint64
+		ok         bool
+	}{
+		{"Monday: free\nSeq=12\n", "Monday: free", 12, true},
+		{"Unchanged.\nSeq=3", "Unchanged.", 3, true},
+		{"Seq=7", "", 7, true},
+		{"Monday: free\n", "Monday: free\n", 0, false},
+		{"Monday: free\nSeq=abc", "Monday: free\nSeq=abc", 0, false},
+	}
+	for _, tt := range tests {
+		body, seq, ok := changeSeq(tt.data)
+		if body != tt.body || seq != tt.seq || ok != tt.ok {
+			t.Errorf("changeSeq(%q) = %q, %d, %v; want %q, %d, %v", tt.data, body, seq, ok, tt.body, tt.seq, tt.ok)
+		}
+	}
+}
+
+// TestWatchQueriesUntilEnter runs the watch command against a server whose
+// availability changes on every query, then stops it with Enter.
+func TestWatchQueriesUntilEnter(t *testing.T) {
+	var queries atomic.Int32
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		if req.OpCode != common.OpQueryAvailability {
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusError, Data: "unknown op"}
+		}
+		n := queries.Add(1)
+		return okReply(req, strings.Repeat("booked\n", int(n)))
+	})
+	c := newTestClient(t, srv.Addr())
+
+	reader, input := monitorInput(t)
+	done := make(chan struct{})
+	go func() {
+		c.handleWatch(reader)
+		close(done)
+	}()
+	input.Write([]byte("RoomA\n\n1\n")) // facility, whole week, every second
+	time.Sleep(1500 * time.Millisecond)
+	input.Write([]byte("\n"))
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watch did not stop on Enter")
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("%d queries in 1.5s at 1s intervals, want 2", n)
+	}
+	if c.pendingInput != nil {
+		t.Error("input still pending after watch")
+	}
+}
+
+// TestQueryChanges: an unchanged facility yields the new number, a list of
+// changes or an expired number asks for a full query.
+func TestQueryChanges(t *testing.T) {
+	srv := newFakeServer(t, func(req common.RequestMessage) *common.ReplyMessage {
+		switch req.SinceSeq {
+		case 10:
+			return okReply(req, "Unchanged.\nSeq=11")
+		case 11:
+			return okReply(req, "Facility=RoomA, 1 changes since 11:\n  #12 created: BKG-1\nSeq=12")
+		default:
+			return &common.ReplyMessage{RequestID: req.RequestID, OpCode: req.OpCode, Status: common.StatusChangesExpired,
+				Data: "Changes since 1 are no longer kept; query the full schedule.\nSeq=12"}
+		}
+	})
+	c := newTestClient(t, srv.Addr())
+
+	if next, unchanged, changes := c.queryChanges("RoomA", 10); next != 11 || !unchanged || changes != "" {
+		t.Errorf("unchanged: %d, %v, %q", next, unchanged, changes)
+	}
+	if next, unchanged, changes := c.queryChanges("RoomA", 11); next != 12 || unchanged ||
+		changes != "Facility=RoomA, 1 changes since 11:\n  #12 created: BKG-1" {
+		t.Errorf("delta: %d, %v, %q", next, unchanged, changes)
+	}
+	if next, unchanged, changes := c.queryChanges("RoomA", 1); next != 0 || unchanged || changes != "" {
+		t.Errorf("expired: %d, %v, %q", next, unchanged, changes)
+	}
+	if got := srv.received(); len(got) != 3 || got[0].OpCode != common.OpQueryChanges || got[0].FacilityName != "RoomA" {
+		t.Errorf("server saw %+v", got)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/client/cli"
+)
+
+// defaultConfigName is looked up in the home directory when -config is not
+// given.
+const defaultConfigName = ".bookingclient.json"
+
+// ClientProfile is one named set of settings in the client config file.
+// Fields left out keep the flag's default; flags given on the command line
+// override them.
+type ClientProfile struct {
+	ServerAddr string `json:"serverAddr,omitempty"`
+	Transport  string `json:"transport,omitempty"`
+	Timeout    *int   `json:"timeout,omitempty"` // seconds, like -timeout
+	Retries    *int   `json:"retries,omitempty"`
+	AuthKey    string `json:"authKey,omitempty"`
+	Encrypt    *bool  `json:"encrypt,omitempty"`
+	User       string `json:"user,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// Per-operation overrides keyed by operation name, like -timeout.query
+	OpTimeouts map[string]string `json:"opTimeouts,omitempty"`
+	OpRetries  map[string]int    `json:"opRetries,omitempty"`
+}
+
+// ClientConfig is the layout of the client config file.
+type ClientConfig struct {
+	// Profile used when -profile is not given (optional)
+	DefaultProfile string                   `json:"defaultProfile,omitempty"`
+	Profiles       map[string]ClientProfile `json:"profiles"`
+}
+
+// sampleConfig is written by -initConfig.
+var sampleConfig = ClientConfig{
+	DefaultProfile: "local",
+	Profiles: map[string]ClientProfile{
+		"local": {ServerAddr: "localhost:2222"},
+		"lab": {
+			ServerAddr: "lab-server:2222,lab-backup:2222",
+			Timeout:    intPtr(3),
+			Retries:    intPtr(5),
+			AuthKey:    "change-me",
+			User:       "alice",
+			OpTimeouts: map[string]string{"monitor": "10s", "query": "5s"},
+			OpRetries:  map[string]int{"book": 6},
+		},
+	},
+}
+
+func intPtr(v int) *int { return &v }
+
+// flagValues returns the profile's settings keyed by flag name.
+func (p ClientProfile) flagValues() map[string]string {
+	values := make(map[string]string)
+	if p.ServerAddr != "" {
+		values["serverAddr"] = p.ServerAddr
+	}
+	if p.Transport != "" {
+		values["transport"] = p.Transport
+	}
+	if p.Timeout != nil {
+		values["timeout"] = strconv.Itoa(*p.Timeout)
+	}
+	if p.Retries != nil {
+		values["retries"] = strconv.Itoa(*p.Retries)
+	}
+	if p.AuthKey != "" {
+		values["authKey"] = p.AuthKey
+	}
+	if p.Encrypt != nil {
+		values["encrypt"] = strconv.FormatBool(*p.Encrypt)
+	}
+	if p.User != "" {
+		values["user"] = p.User
+	}
+	if p.Namespace != "" {
+		values["namespace"] = p.Namespace
+	}
+	for name, d := range p.OpTimeouts {
+		values["timeout."+name] = d
+	}
+	for name, n := range p.OpRetries {
+		values["retries."+name] = strconv.Itoa(n)
+	}
+	return values
+}
+
+// checkOpNames rejects override keys that are not operation names.
+func (p ClientProfile) checkOpNames() error {
+	names := make([]string, 0, len(p.OpTimeouts)+len(p.OpRetries))
+	for name := range p.OpTimeouts {
+		names = append(names, name)
+	}
+	for name := range p.OpRetries {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, ok := cli.OpCodeByName(name); !ok {
+			return fmt.Errorf("unknown operation %q in overrides (valid: %s)", name, strings.Join(cli.OpNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// LoadClientConfig reads and parses the config file at path. Syntax errors
+// and unknown fields are reported with their line and column.
+func LoadClientConfig(path string) (*ClientConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var cfg ClientConfig
+	if err := dec.Decode(&cfg); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("parsing config %s:%s: %w", path, position(raw, syntaxErr.Offset), err)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("parsing config %s:%s: %w", path, position(raw, typeErr.Offset), err)
+		default:
+			return nil, fmt.Errorf("parsing config %s:%s: %w", path, position(raw, unknownFieldOffset(raw, err, dec.InputOffset())), err)
+		}
+	}
+	return &cfg, nil
+}
+
+// jsonKey matches a quoted JSON key and its colon; the key, quotes
+// included, is the first group.
+var jsonKey = regexp.MustCompile(`("(?:[^"\\]|\\.)*")\s*:`)
+
+// unknownFieldOffset finds the key an unknown-field error is about. The
+// error carries no offset and the decoder has already read the whole value
+// by then, so the first use of the key as a key is taken, falling back to
+// where the decoder stopped.
+func unknownFieldOffset(raw []byte, err error, stopped int64) int64 {
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return stopped
+	}
+	name, uerr := strconv.Unquote(quoted)
+	if uerr != nil {
+		return stopped
+	}
+	for _, m := range jsonKey.FindAllSubmatchIndex(raw, -1) {
+		// Decode the key, so one written with escapes is found too
+		var key string
+		if json.Unmarshal(raw[m[2]:m[3]], &key) == nil && key == name {
+			return int64(m[0])
+		}
+	}
+	return stopped
+}
+
+// position turns a byte offset into "line:column".
+func position(raw []byte, offset int64) string {
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+	before := raw[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+// applyConfig loads the profile selected by -profile (or the file's default
+// profile) and sets every flag the profile defines that was not given on the
+// command line. Without -config, a missing ~/.bookingclient.json is not an
+// error unless a profile was asked for.
+func applyConfig(path, profile string) error {
+	explicitPath := path != ""
+	if !explicitPath {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, defaultConfigName)
+	}
+	cfg, err := LoadClientConfig(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicitPath && profile == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if profile == "" {
+		profile = cfg.DefaultProfile
+	}
+	if profile == "" {
+		return nil
+	}
+	p, ok := cfg.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("config %s has no profile %q (available: %s)", path, profile, strings.Join(names, ", "))
+	}
+
+	if err := p.checkOpNames(); err != nil {
+		return fmt.Errorf("config %s, profile %q: %w", path, profile, err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, value := range p.flagValues() {
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("config %s, profile %q: %s: %w", path, profile, name, err)
+		}
+	}
+	return nil
+}
+
+// writeSampleConfig writes an example config file for -initConfig. An
+// existing file is never replaced.
+func writeSampleConfig(path string) error {
+	raw, err := json.MarshalIndent(sampleConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
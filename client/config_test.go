@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/client/cli"
+)
+
+// testFlags are the flags a config profile can set, on a fresh flag set
+// that stands in for the command line during a test.
+type testFlags struct {
+	serverAddr, user, transport *string
+	timeout, retries            *int
+}
+
+// parseFlags replaces the command line with args for the rest of the test.
+func parseFlags(t *testing.T, args ...string) testFlags {
+	t.Helper()
+	saved, savedTimeouts, savedRetries := flag.CommandLine, opTimeouts, opRetries
+	t.Cleanup(func() { flag.CommandLine, opTimeouts, opRetries = saved, savedTimeouts, savedRetries })
+
+	flag.CommandLine = flag.NewFlagSet("client", flag.ContinueOnError)
+	opTimeouts = make(map[uint8]time.Duration)
+	opRetries = make(map[uint8]int)
+	f := testFlags{
+		serverAddr: flag.String("serverAddr", "localhost:2222", ""),
+		user:       flag.String("user", "", ""),
+		transport:  flag.String("transport", cli.TransportUDP, ""),
+		timeout:    flag.Int("timeout", 5, ""),
+		retries:    flag.Int("retries", 4, ""),
+	}
+	flag.Bool("encrypt", false, "")
+	flag.String("authKey", "", "")
+	registerOverrideFlags()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	return f
+}
+
+// writeConfig writes a config file into a temporary directory.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "client.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfig = `{
+  "defaultProfile": "local",
+  "profiles": {
+    "local": {"serverAddr": "127.0.0.1:3333"},
+    "lab": {
+      "serverAddr": "lab:2222,backup:2222",
+      "timeout": 2,
+      "retries": 7,
+      "user": "alice",
+      "opTimeouts": {"query": "9s"},
+      "opRetries": {"book": 6}
+    }
+  }
+}
+`
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	type want struct {
+		serverAddr, user string
+		timeout, retries int
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		profile string
+		want    want
+	}{
+		{"default profile", nil, "", want{"127.0.0.1:3333", "", 5, 4}},
+		{"file over defaults", nil, "lab", want{"lab:2222,backup:2222", "alice", 2, 7}},
+		{"flags over file", []string{"-retries", "1", "-user", "bob"}, "lab", want{"lab:2222,backup:2222", "bob", 2, 1}},
+		{"flag set to its default", []string{"-timeout", "5"}, "lab", want{"lab:2222,backup:2222", "alice", 5, 7}},
+		{"flags without a profile value", []string{"-serverAddr", "other:1"}, "", want{"other:1", "", 5, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parseFlags(t, tt.args...)
+			if err := applyConfig(path, tt.profile); err != nil {
+				t.Fatalf("applyConfig: %v", err)
+			}
+			got := want{*f.serverAddr, *f.user, *f.timeout, *f.retries}
+			if got != tt.want {
+				t.Errorf("settings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	parseFlags(t, "-timeout.query", "3s")
+	if err := applyConfig(path, "lab"); err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+	query, _ := cli.OpCodeByName("query")
+	book, _ := cli.OpCodeByName("book")
+	if opTimeouts[query] != 3*time.Second {
+		t.Errorf("query timeout = %v, want the flag's 3s", opTimeouts[query])
+	}
+	if opRetries[book] != 6 {
+		t.Errorf("book retries = %d, want the file's 6", opRetries[book])
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		profile string
+		want    string
+	}{
+		{"syntax", "{\n  \"profiles\": {\n    \"lab\": {\"serverAddr\": \"lab:1\",}\n  }\n}\n", "lab", ":3:"},
+		{"unknown field", "{\n  \"profiles\": {\n    \"lab\": {\n      \"server\": \"lab:1\"\n    }\n  }\n}\n", "lab", `:4:`},
+		{"unknown field with escapes", "{\n  \"profiles\": {\n    \"lab\": {\"timeout\": 2,\n      \"serv\\u0065r\": \"lab:1\"\n    }\n  }\n}\n", "lab", `:4:7:`},
+		{"wrong type", "{\n  \"profiles\": {\"lab\": {\"timeout\": \"3s\"}}\n}\n", "lab", ":2:"},
+		{"unknown profile", testConfig, "home", `no profile "home" (available: lab, local)`},
+		{"unknown operation", `{"profiles": {"lab": {"opRetries": {"teleport": 1}}}}`, "lab", `unknown operation "teleport"`},
+		{"bad value", `{"profiles": {"lab": {"opTimeouts": {"query": "soon"}}}}`, "lab", "timeout.query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parseFlags(t)
+			path := writeConfig(t, tt.content)
+			err := applyConfig(path, tt.profile)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), path) {
+				t.Errorf("applyConfig error = %v, want %q naming the file", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := parseFlags(t)
+	if err := applyConfig("", ""); err != nil {
+		t.Errorf("no default config file: %v", err)
+	}
+	if *f.serverAddr != "localhost:2222" {
+		t.Errorf("serverAddr = %s, want the default", *f.serverAddr)
+	}
+	if err := applyConfig("", "lab"); err == nil {
+		t.Error("-profile without a config file accepted")
+	}
+	if err := applyConfig(filepath.Join(t.TempDir(), "missing.json"), ""); err == nil {
+		t.Error("missing -config file accepted")
+	}
+}
+
+func TestWriteSampleConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.json")
+	if err := writeSampleConfig(path); err != nil {
+		t.Fatalf("writeSampleConfig: %v", err)
+	}
+	cfg, err := LoadClientConfig(path)
+	if err != nil {
+		t.Fatalf("loading the sample: %v", err)
+	}
+	if !reflect.DeepEqual(*cfg, sampleConfig) {
+		t.Errorf("sample reads back as %+v, want %+v", *cfg, sampleConfig)
+	}
+	for name := range cfg.Profiles {
+		parseFlags(t)
+		if err := applyConfig(path, name); err != nil {
+			t.Errorf("sample profile %s: %v", name, err)
+		}
+	}
+	if err := writeSampleConfig(path); err == nil {
+		t.Error("existing config file replaced")
+	}
+}
@@ -4,52 +4,152 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net"
+	"os"
 	"time"
-	"math/rand"
 
 	"github.com/Iyzyman/distributed-go/client/cli"
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
 )
 
 // Command-line flags for client
 var (
-    serverAddrFlag = flag.String("serverAddr", "localhost:2222", "Server address in host:port format")
+    configFlag     = flag.String("config", "", "Client config file with named profiles (default ~/.bookingclient.json if it exists)")
+    profileFlag    = flag.String("profile", "", "Profile from the config file to use; flags given on the command line override it")
+    initConfigFlag = flag.String("initConfig", "", "Write a sample config file to this path and exit")
+    serverAddrFlag = flag.String("serverAddr", "localhost:2222", "Server address(es) in host:port format, comma-separated for failover")
     timeoutFlag    = flag.Int("timeout", 5, "Timeout in seconds for waiting for server replies")
+    adaptiveFlag   = flag.Bool("adaptiveTimeout", true, "Derive the timeout from measured round-trip times once enough samples exist")
+    minTimeoutFlag = flag.Duration("minTimeout", 200*time.Millisecond, "Lower bound for the adaptive timeout")
+    maxTimeoutFlag = flag.Duration("maxTimeout", 10*time.Second, "Upper bound for the adaptive timeout, including retry backoff")
+    retriesFlag    = flag.Int("retries", 4, "Attempts per server before failing over (0 = retry forever)")
+    retryRefusedFlag = flag.Bool("retryRefused", false, "Keep retrying when the server port refuses packets instead of failing over at once")
+    answerKeepalivesFlag = flag.Bool("answerKeepalives", true, "Answer the server's keepalive callbacks while monitoring so the NAT mapping stays open in both directions")
+    maxPagesFlag   = flag.Int("maxPages", 20, "Most pages the list command fetches for one facility (0 = no limit)")
     packetDemoFlag = flag.Bool("packetDemo", false, "If true, simulate packet loss or other network issues")
+    debugFlag      = flag.Bool("debug", false, "Log a hex dump of every packet sent and received (to stderr)")
+    authKeyFlag    = flag.String("authKey", "", "Shared secret for HMAC authentication (must match the server)")
+    encryptFlag    = flag.Bool("encrypt", false, "Encrypt payloads with AES-GCM (requires -authKey; must match the server)")
+    maxRequestFlag = flag.Int("maxRequestSize", common.DefaultMaxRequestSize, "Refuse to send requests larger than this many bytes (should match the server)")
+    compressFlag   = flag.Bool("compress", true, "Accept gzip-compressed reply payloads from the server")
+    semanticsFlag  = flag.String("semantics", "", "Per-request semantics hint: at-least-once or at-most-once (empty = server default)")
+    ipFamilyFlag   = flag.String("ipFamily", cli.FamilyAuto, "Address family for server names: auto (prefer IPv6), 4 or 6")
+    transportFlag  = flag.String("transport", cli.TransportUDP, "Transport to use: udp or tcp")
+    userFlag       = flag.String("user", "", "Register/log in as this user at startup (empty = anonymous)")
+    passwordFlag   = flag.String("password", "", "Password for -user (optional)")
+    namespaceFlag  = flag.String("namespace", "", "Facility namespace to work in (empty = the server's default namespace)")
+    importFlag     = flag.String("importCSV", "", "Book every row of this CSV file (facility,startDay,startTime,endDay,endTime,title) and exit")
+    resultsFlag    = flag.String("importResults", "", "Results CSV for -importCSV (empty = <file>.results.csv)")
+    failFastFlag   = flag.Bool("failFast", false, "Stop -importCSV at the first invalid or rejected row")
 )
 
 func main() {
+	registerOverrideFlags()
 	flag.Parse()
 
-	// Parse server address
-	serverAddr, err := net.ResolveUDPAddr("udp", *serverAddrFlag)
-	if err != nil {
-		log.Fatalf("Invalid server address %s: %v", *serverAddrFlag, err)
+	if *initConfigFlag != "" {
+		if err := writeSampleConfig(*initConfigFlag); err != nil {
+			log.Fatalf("Writing sample config: %v", err)
+		}
+		fmt.Printf("Sample config written to %s\n", *initConfigFlag)
+		return
+	}
+	if err := applyConfig(*configFlag, *profileFlag); err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	// Create UDP socket
-	conn, err := net.DialUDP("udp", nil, serverAddr)
-	if err != nil {
-		log.Fatalf("Failed to connect to server: %v", err)
+	if *transportFlag != cli.TransportUDP && *transportFlag != cli.TransportTCP {
+		log.Fatalf("Unknown transport %s. Choose '%s' or '%s'.", *transportFlag, cli.TransportUDP, cli.TransportTCP)
+	}
+
+	switch *ipFamilyFlag {
+	case cli.FamilyAuto, cli.FamilyIPv4, cli.FamilyIPv6:
+	default:
+		log.Fatalf("Unknown -ipFamily %s. Choose '%s', '%s' or '%s'.", *ipFamilyFlag, cli.FamilyAuto, cli.FamilyIPv4, cli.FamilyIPv6)
+	}
+
+	serverAddrs := cli.ParseServerList(*serverAddrFlag)
+	if len(serverAddrs) == 0 {
+		log.Fatalf("No server address given")
 	}
-	defer conn.Close()
 
 	// Initialize client state
 	client := &cli.ClientState{
-		Conn:        conn,
-		ServerAddr:  serverAddr,
-		Timeout:     time.Duration(*timeoutFlag) * time.Second,
-		NextReqID:   uint64(rand.Int63()),
-		MonitorMode: false,
-		PacketDemo:  *packetDemoFlag,
+		ServerAddrs:      serverAddrs,
+		Timeout:          time.Duration(*timeoutFlag) * time.Second,
+		Retries:          *retriesFlag,
+		RetryRefused:     *retryRefusedFlag,
+		AnswerKeepalives: *answerKeepalivesFlag,
+		MaxPages:         *maxPagesFlag,
+		NextReqID:        cli.InitialRequestID(),
+		MonitorMode:      false,
+		PacketDemo:       *packetDemoFlag,
+		Debug:            *debugFlag,
+		Transport:        *transportFlag,
+		IPFamily:         *ipFamilyFlag,
+		MaxRequestSize:   *maxRequestFlag,
+		AdaptiveTimeout:  *adaptiveFlag,
+		MinTimeout:       *minTimeoutFlag,
+		MaxTimeout:       *maxTimeoutFlag,
+		OpTimeouts:       opTimeouts,
+		OpRetries:        opRetries,
+	}
+	hint, err := cli.ParseSemanticsHint(*semanticsFlag)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	client.SemanticsHint = hint
+	if *namespaceFlag != "" {
+		if err := validate.ValidateNamespace(*namespaceFlag); err != nil {
+			log.Fatalf("-namespace: %v", err)
+		}
+	}
+	client.Namespace = *namespaceFlag
+	if *compressFlag {
+		client.Capabilities |= common.CapGzip
+	}
+	client.Security = common.PacketSecurity{Key: []byte(*authKeyFlag), Encrypt: *encryptFlag}
+	if err := client.Security.Validate(); err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	fmt.Printf("Connected to server at %s\n", serverAddr)
+	// Connect to the first server that accepts the connection (with TCP a
+	// refused connection moves on to the next one)
+	err = client.Connect(0)
+	for i := 1; err != nil && i < len(serverAddrs); i++ {
+		log.Printf("%v; trying %s", err, serverAddrs[i])
+		err = client.Connect(i)
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer client.Close()
+
+	fmt.Printf("Connected to server at %s\n", client.ActiveServer())
+	if len(serverAddrs) > 1 {
+		fmt.Printf("Failover servers: %v\n", serverAddrs[1:])
+	}
 	if client.PacketDemo {
         fmt.Println("Packet loss simulation is ENABLED (packetDemo=true)")
     } else {
         fmt.Println("Packet loss simulation is DISABLED (packetDemo=false)")
     }
+	if *userFlag != "" {
+		if err := client.Login(*userFlag, *passwordFlag); err != nil {
+			log.Fatalf("Login as %s failed: %v", *userFlag, err)
+		}
+		fmt.Printf("Logged in as %s\n", *userFlag)
+	}
+	if *importFlag != "" {
+		res, err := client.ImportBookingsFile(*importFlag, *resultsFlag, *failFastFlag)
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		if res.Failed > 0 || res.Skipped > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 	fmt.Println("Facility Booking System Client")
 	fmt.Println("==============================")
 
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/client/cli"
+)
+
+// Per-operation overrides collected from -timeout.<op> and -retries.<op>
+var (
+	opTimeouts = make(map[uint8]time.Duration)
+	opRetries  = make(map[uint8]int)
+)
+
+// parseOpTimeout validates a -timeout.<op> value.
+func parseOpTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%q is not a positive duration like 10s", v)
+	}
+	return d, nil
+}
+
+// parseOpRetries validates a -retries.<op> value.
+func parseOpRetries(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a number of attempts (0 = retry forever)", v)
+	}
+	return n, nil
+}
+
+// registerOverrideFlags adds -timeout.<op> and -retries.<op> for every
+// operation that takes overrides. Unknown operations are rejected by the
+// flag package like any other unknown flag.
+func registerOverrideFlags() {
+	for _, name := range cli.OpNames() {
+		op, _ := cli.OpCodeByName(name)
+		flag.Func("timeout."+name, fmt.Sprintf("Per-attempt timeout for %s requests, e.g. 10s (overrides -timeout and the adaptive timeout)", name),
+			func(v string) error {
+				d, err := parseOpTimeout(v)
+				if err != nil {
+					return err
+				}
+				opTimeouts[op] = d
+				return nil
+			})
+		flag.Func("retries."+name, fmt.Sprintf("Attempts per server for %s requests (overrides -retries)", name),
+			func(v string) error {
+				n, err := parseOpRetries(v)
+				if err != nil {
+					return err
+				}
+				opRetries[op] = n
+				return nil
+			})
+	}
+}
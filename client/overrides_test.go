@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/client/cli"
+)
+
+func TestOverrideFlags(t *testing.T) {
+	parseFlags(t, "-timeout.monitor", "10s", "-retries.book=6", "-retries.ping", "0")
+	monitor, _ := cli.OpCodeByName("monitor")
+	book, _ := cli.OpCodeByName("book")
+	ping, _ := cli.OpCodeByName("ping")
+	if opTimeouts[monitor] != 10*time.Second || len(opTimeouts) != 1 {
+		t.Errorf("timeouts = %v", opTimeouts)
+	}
+	if opRetries[book] != 6 || opRetries[ping] != 0 || len(opRetries) != 2 {
+		t.Errorf("retries = %v", opRetries)
+	}
+}
+
+func TestOverrideFlagsRejected(t *testing.T) {
+	for _, args := range [][]string{
+		{"-timeout.teleport=5s"},
+		{"-retries.Query=2"},
+		{"-timeout.query=soon"},
+		{"-timeout.query=0s"},
+		{"-timeout.query=-1s"},
+		{"-retries.book=-1"},
+		{"-retries.book=many"},
+	} {
+		parseFlags(t)
+		flag.CommandLine.SetOutput(io.Discard)
+		if err := flag.CommandLine.Parse(args); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
@@ -5,77 +5,114 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
 )
 
-// ReadDaysList prompts the user for a list of days
+// ReadDaysList prompts the user for a list of days. An empty answer or
+// "all" returns the whole week. It is sent as the explicit list rather
+// than the empty shorthand, which servers before it was defined answer
+// with no days at all.
 func ReadDaysList(reader *bufio.Reader) ([]uint8, error) {
-	fmt.Print("Enter number of days to check: ")
+	fmt.Print("Enter number of days to check (empty or \"all\" for the whole week): ")
 	numDaysStr, _ := reader.ReadString('\n')
 	numDaysStr = strings.TrimSpace(numDaysStr)
+	if numDaysStr == "" || strings.EqualFold(numDaysStr, "all") {
+		return validate.AllDays(), nil
+	}
 	numDays, err := strconv.Atoi(numDaysStr)
 	if err != nil || numDays <= 0 {
 		return nil, fmt.Errorf("invalid number of days")
 	}
+	if numDays > validate.MaxDaysListLen {
+		return nil, fmt.Errorf("at most %d days", validate.MaxDaysListLen)
+	}
 
-	fmt.Println("Enter day indices (0=Monday, 1=Tuesday, ..., 6=Sunday):")
+	fmt.Println("Enter days by name (Mon, Tuesday) or index (0=Monday..6=Sunday):")
 	days := make([]uint8, 0, numDays)
 	for i := 0; i < numDays; i++ {
-		fmt.Printf("Day %d: ", i+1)
+		fmt.Printf("Day %d of %d: ", i+1, numDays)
 		dayStr, _ := reader.ReadString('\n')
-		dayStr = strings.TrimSpace(dayStr)
-		day, err := strconv.Atoi(dayStr)
-		if err != nil || day < 0 || day > 6 {
-			return nil, fmt.Errorf("invalid day index (must be 0-6)")
+		day, err := common.ParseDay(dayStr)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+		if err := validate.ValidateDaysList(days); err != nil {
+			return nil, err
 		}
-		days = append(days, uint8(day))
 	}
-	return days, nil
+	return validate.NormalizeDaysList(days)
 }
 
 // ReadBookingTimes prompts the user for booking start/end times
 func ReadBookingTimes(reader *bufio.Reader) (uint8, uint8, uint8, uint8, uint8, uint8, error) {
-	fmt.Print("Enter start day (0=Monday..6=Sunday): ")
+	fmt.Print("Enter start day (Mon..Sun or 0=Monday..6=Sunday): ")
 	startDayStr, _ := reader.ReadString('\n')
-	startDay, err := strconv.Atoi(strings.TrimSpace(startDayStr))
-	if err != nil || startDay < 0 || startDay > 6 {
-		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid start day")
+	startDay, err := common.ParseDay(startDayStr)
+	if err != nil {
+		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid start day: %v", err)
 	}
 
 	fmt.Print("Enter start hour (0-23): ")
 	startHourStr, _ := reader.ReadString('\n')
 	startHour, err := strconv.Atoi(strings.TrimSpace(startHourStr))
-	if err != nil || startHour < 0 || startHour > 23 {
+	if err != nil || startHour < 0 || startHour > validate.MaxHour {
 		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid start hour")
 	}
 
 	fmt.Print("Enter start minute (0-59): ")
 	startMinStr, _ := reader.ReadString('\n')
 	startMin, err := strconv.Atoi(strings.TrimSpace(startMinStr))
-	if err != nil || startMin < 0 || startMin > 59 {
+	if err != nil || startMin < 0 || startMin > validate.MaxMinute {
 		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid start minute")
 	}
 
-	fmt.Print("Enter end day (0=Monday..6=Sunday): ")
+	fmt.Print("Enter end day (Mon..Sun or 0=Monday..6=Sunday) or a duration such as 1h30m: ")
 	endDayStr, _ := reader.ReadString('\n')
-	endDay, err := strconv.Atoi(strings.TrimSpace(endDayStr))
-	if err != nil || endDay < 0 || endDay > 6 {
-		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid end day")
+	// Day names such as "Thu" contain duration units, so try a day first
+	endDay, err := common.ParseDay(endDayStr)
+	if endDayStr = strings.TrimSpace(endDayStr); err != nil && strings.ContainsAny(endDayStr, "hms") {
+		d, err := ParseBookingDuration(endDayStr)
+		if err != nil {
+			return 0, 0, 0, 0, 0, 0, err
+		}
+		endDay, endHour, endMin, err := AddBookingDuration(startDay, uint8(startHour), uint8(startMin), d)
+		if err != nil {
+			return 0, 0, 0, 0, 0, 0, err
+		}
+		return startDay, uint8(startHour), uint8(startMin), endDay, endHour, endMin, nil
+	}
+	if err != nil {
+		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid end day: %v", err)
 	}
 
-	fmt.Print("Enter end hour (0-23): ")
+	fmt.Print("Enter end hour (0-24, 24 for the end of the day): ")
 	endHourStr, _ := reader.ReadString('\n')
 	endHour, err := strconv.Atoi(strings.TrimSpace(endHourStr))
-	if err != nil || endHour < 0 || endHour > 23 {
+	if err != nil || endHour < 0 || endHour > validate.MaxHour+1 {
 		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid end hour")
 	}
 
 	fmt.Print("Enter end minute (0-59): ")
 	endMinStr, _ := reader.ReadString('\n')
 	endMin, err := strconv.Atoi(strings.TrimSpace(endMinStr))
-	if err != nil || endMin < 0 || endMin > 59 {
+	if err != nil || endMin < 0 || endMin > validate.MaxMinute {
 		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid end minute")
 	}
+	if endHour == validate.MaxHour+1 {
+		// 24:00 is sent as 00:00 of the next day
+		if endMin != 0 {
+			return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid end time 24:%02d", endMin)
+		}
+		endDay, endHour = endDay+1, 0
+	}
 
-	return uint8(startDay), uint8(startHour), uint8(startMin),
-		uint8(endDay), uint8(endHour), uint8(endMin), nil
+	if err := validate.ValidateBookingTimes(startDay, uint8(startHour), uint8(startMin),
+		endDay, uint8(endHour), uint8(endMin)); err != nil {
+		return 0, 0, 0, 0, 0, 0, err
+	}
+	return startDay, uint8(startHour), uint8(startMin),
+		endDay, uint8(endHour), uint8(endMin), nil
 }
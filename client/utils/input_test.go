@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDaysListNames(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []uint8
+		wantErr string
+	}{
+		{"3\nMon\nwednesday\n6\n", []uint8{0, 2, 6}, ""},
+		{"2\nDi\njeu\n", []uint8{1, 3}, ""},
+		{"\n", []uint8{0, 1, 2, 3, 4, 5, 6}, ""},
+		{"all\n", []uint8{0, 1, 2, 3, 4, 5, 6}, ""},
+		{" ALL \n", []uint8{0, 1, 2, 3, 4, 5, 6}, ""},
+		{"4\nWed\nMon\nwed\n2\n", []uint8{0, 2}, ""},
+		{"8\n", nil, "at most 7 days"},
+		{"1\nT\n", nil, "ambiguous day"},
+		{"1\nfunday\n", nil, "unknown day"},
+	}
+	for _, tt := range tests {
+		got, err := ReadDaysList(bufio.NewReader(strings.NewReader(tt.input)))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("input %q: error %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("input %q: %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+// TestReadBookingTimesDayNames: day names are read at both day prompts,
+// and an end day such as "Thu" is a day although it contains "h".
+func TestReadBookingTimesDayNames(t *testing.T) {
+	tests := []struct {
+		input string
+		want  window
+	}{
+		{"Mon\n9\n0\nThu\n10\n0\n", window{0, 9, 0, 3, 10, 0}},
+		{"Sat\n22\n30\nsun\n1\n0\n", window{5, 22, 30, 6, 1, 0}},
+		{"Tue\n9\n0\n1h30m\n", window{1, 9, 0, 1, 10, 30}},
+		{"Mon\n9\n0\nMon\n24\n0\n", window{0, 9, 0, 1, 0, 0}},
+		{"Sun\n22\n0\nSun\n24\n0\n", window{6, 22, 0, 7, 0, 0}},
+	}
+	for _, tt := range tests {
+		sd, sh, sm, ed, eh, em, err := ReadBookingTimes(bufio.NewReader(strings.NewReader(tt.input)))
+		if err != nil {
+			t.Errorf("input %q: %v", tt.input, err)
+			continue
+		}
+		if got := (window{sd, sh, sm, ed, eh, em}); got != tt.want {
+			t.Errorf("input %q: %v, want %v", tt.input, got, tt.want)
+		}
+	}
+	if _, _, _, _, _, _, err := ReadBookingTimes(bufio.NewReader(strings.NewReader("Mon\n9\n0\nMon\n24\n30\n"))); err == nil || !strings.Contains(err.Error(), "24:30") {
+		t.Errorf("end 24:30: %v", err)
+	}
+	if _, _, _, _, _, _, err := ReadBookingTimes(bufio.NewReader(strings.NewReader("S\n"))); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("ambiguous start day: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// ParseTimeRange parses a booking written on one line, such as
+// "Mon 09:00 - Tue 14:30" or "0 09:00-10:30". The end day may be left out
+// when it is the start day, and the end may be given as a duration instead:
+// "Mon 09:00 for 1h30m". Days are names (case-insensitive) or 0-6. The end
+// may be 24:00, which is sent as 00:00 of the next day.
+// Errors name the token that could not be read.
+func ParseTimeRange(s string) (uint8, uint8, uint8, uint8, uint8, uint8, error) {
+	tokens := strings.Fields(strings.ReplaceAll(s, "-", " - "))
+
+	var startDay, startHour, startMin, endDay, endHour, endMin uint8
+	var err error
+	fail := func(format string, args ...any) (uint8, uint8, uint8, uint8, uint8, uint8, error) {
+		return 0, 0, 0, 0, 0, 0, fmt.Errorf(format, args...)
+	}
+	switch {
+	case len(tokens) == 0:
+		return fail("empty booking time")
+	case len(tokens) < 3:
+		return fail("incomplete booking time %q: expected DAY HH:MM - [DAY] HH:MM or DAY HH:MM for DURATION", s)
+	case len(tokens) > 5:
+		return fail("unexpected %q after the end time", tokens[5])
+	}
+
+	if startDay, err = common.ParseDay(tokens[0]); err != nil {
+		return fail("start day: %v", err)
+	}
+	if startHour, startMin, err = parseClock(tokens[1]); err != nil {
+		return fail("start time: %v", err)
+	}
+
+	// "DAY HH:MM for 1h30m" or "DAY HH:MM 1h30m"
+	if tokens[2] == "for" || len(tokens) == 3 {
+		durTok := tokens[len(tokens)-1]
+		if len(tokens) > 4 || (tokens[2] == "for") != (len(tokens) == 4) {
+			return fail("expected a single duration after the start time, got %q", strings.Join(tokens[2:], " "))
+		}
+		d, err := ParseBookingDuration(durTok)
+		if err != nil {
+			return fail("duration: %v", err)
+		}
+		if endDay, endHour, endMin, err = AddBookingDuration(startDay, startHour, startMin, d); err != nil {
+			return fail("duration %s: %v", durTok, err)
+		}
+		return startDay, startHour, startMin, endDay, endHour, endMin, nil
+	}
+	if len(tokens) < 4 {
+		return fail("incomplete booking time %q: expected DAY HH:MM - [DAY] HH:MM", s)
+	}
+	if tokens[2] != "-" {
+		return fail("expected \"-\" after the start time, got %q", tokens[2])
+	}
+	endDay = startDay
+	next := 3
+	if len(tokens) == 5 {
+		if endDay, err = common.ParseDay(tokens[3]); err != nil {
+			return fail("end day: %v", err)
+		}
+		next = 4
+	}
+	if endDay, endHour, endMin, err = parseEndClock(endDay, tokens[next]); err != nil {
+		return fail("end time: %v", err)
+	}
+
+	if err := validate.ValidateBookingTimes(startDay, startHour, startMin, endDay, endHour, endMin); err != nil {
+		return fail("%v", err)
+	}
+	return startDay, startHour, startMin, endDay, endHour, endMin, nil
+}
+
+// ParseWeekTime parses a single day and time such as "Mon 10:00" or
+// "0 10:00".
+func ParseWeekTime(s string) (day, hour, minute uint8, err error) {
+	tokens := strings.Fields(s)
+	if len(tokens) != 2 {
+		return 0, 0, 0, fmt.Errorf("expected DAY HH:MM, got %q", s)
+	}
+	if day, err = common.ParseDay(tokens[0]); err != nil {
+		return 0, 0, 0, err
+	}
+	if hour, minute, err = parseClock(tokens[1]); err != nil {
+		return 0, 0, 0, err
+	}
+	return day, hour, minute, nil
+}
+
+// ParseBookingDuration parses a Go-style duration such as "90m" or "1h30m"
+// for a booking: positive and in whole minutes.
+func ParseBookingDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration like 1h30m", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q must be positive", s)
+	}
+	if d%time.Minute != 0 {
+		return 0, fmt.Errorf("%q is not a whole number of minutes", s)
+	}
+	return d, nil
+}
+
+// AddBookingDuration computes the end of a booking that starts at the given
+// day and time and lasts d. The end must fall within the same week.
+func AddBookingDuration(day, hour, minute uint8, d time.Duration) (uint8, uint8, uint8, error) {
+	end := int64(schedule.ToMinutes(day, hour, minute)) + int64(d/time.Minute)
+	if end > schedule.WeekMinutes {
+		return 0, 0, 0, fmt.Errorf("booking would run past Sunday 24:00")
+	}
+	endDay, endHour, endMinute := schedule.FromMinutes(int32(end))
+	return endDay, endHour, endMinute, nil
+}
+
+// ParseDays reads a list of day names or indices separated by commas or
+// spaces, such as "Fri" or "0,4". Repeated days are dropped. An empty
+// string gives an empty list.
+func ParseDays(s string) ([]uint8, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	days := make([]uint8, 0, len(fields))
+	var seen [7]bool
+	for _, tok := range fields {
+		day, err := common.ParseDay(tok)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// parseClock reads an HH:MM time.
+func parseClock(tok string) (uint8, uint8, error) {
+	hh, mm, ok := strings.Cut(tok, ":")
+	hour, errH := strconv.Atoi(hh)
+	minute, errM := strconv.Atoi(mm)
+	if !ok || len(mm) != 2 || errH != nil || errM != nil {
+		return 0, 0, fmt.Errorf("%q is not HH:MM", tok)
+	}
+	if hour < 0 || hour > validate.MaxHour || minute < 0 || minute > validate.MaxMinute {
+		return 0, 0, fmt.Errorf("%q is out of range (00:00-23:59)", tok)
+	}
+	return uint8(hour), uint8(minute), nil
+}
+
+// parseEndClock reads the end time of a booking on day. It also takes
+// "24:00", the end of the day, which it returns as 00:00 of the next day;
+// after Sunday that is day 7, the end of the week.
+func parseEndClock(day uint8, tok string) (uint8, uint8, uint8, error) {
+	if tok == "24:00" {
+		return day + 1, 0, 0, nil
+	}
+	hour, minute, err := parseClock(tok)
+	return day, hour, minute, err
+}
+
+// ReadBookingRange asks for the booking time on one line and falls back to
+// the step-by-step prompts of ReadBookingTimes when it is left empty or
+// cannot be parsed.
+func ReadBookingRange(reader *bufio.Reader) (uint8, uint8, uint8, uint8, uint8, uint8, error) {
+	fmt.Print("Enter booking time, e.g. \"Mon 09:00-10:30\", \"Mon 22:00 - Tue 01:00\" or \"Mon 09:00 for 1h30m\" (empty for step-by-step): ")
+	line, _ := reader.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		sd, sh, sm, ed, eh, em, err := ParseTimeRange(line)
+		if err == nil {
+			return sd, sh, sm, ed, eh, em, nil
+		}
+		fmt.Printf("Could not read booking time: %v\n", err)
+	}
+	return ReadBookingTimes(reader)
+}
+
+// ParseOffset reads a ChangeBooking shift in minutes. Besides a plain number
+// of minutes it accepts day, hour and minute terms such as "+1d", "-2h",
+// "1d-2h+30m" or "1h30m"; a term without a sign takes the sign of the one
+// before it, so "-1h30m" is 90 minutes earlier. wholeDays reports whether
+// only day terms were given.
+func ParseOffset(s string) (minutes int32, wholeDays bool, err error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	if s == "" {
+		return 0, false, fmt.Errorf("empty offset")
+	}
+	if n, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return checkShift(s, int32(n), false)
+	}
+
+	var total int64
+	sign := int64(1)
+	wholeDays = true
+	for rest := s; rest != ""; {
+		switch rest[0] {
+		case '+':
+			sign, rest = 1, rest[1:]
+		case '-':
+			sign, rest = -1, rest[1:]
+		}
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(rest) {
+			return 0, false, fmt.Errorf("%q is not an offset like +1d, -2h, 1d-2h+30m or a number of minutes", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 32)
+		if err != nil {
+			return 0, false, fmt.Errorf("%q: %s is too large", s, rest[:i])
+		}
+		switch rest[i] {
+		case 'd':
+			n *= schedule.DayMinutes
+		case 'h':
+			n *= 60
+			wholeDays = false
+		case 'm':
+			wholeDays = false
+		default:
+			return 0, false, fmt.Errorf("%q: unknown unit %q (use d, h or m)", s, rest[i])
+		}
+		total += sign * n
+		if total > math.MaxInt32 || total < math.MinInt32 {
+			return 0, false, fmt.Errorf("%q is too large", s)
+		}
+		rest = rest[i+1:]
+	}
+	return checkShift(s, int32(total), wholeDays)
+}
+
+// checkShift refuses shifts of a week or more, which move any booking out
+// of the week. The server refuses shorter shifts that do so for the booking
+// at hand, such as "+1d" on Sunday.
+func checkShift(s string, minutes int32, wholeDays bool) (int32, bool, error) {
+	if minutes <= -validate.WeekMinutes || minutes >= validate.WeekMinutes {
+		return 0, false, fmt.Errorf("%q moves any booking out of the week; shift by less than 7d", s)
+	}
+	return minutes, wholeDays, nil
+}
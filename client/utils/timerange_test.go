@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+// window is a booking time as the six request fields.
+type window [6]uint8
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want window
+	}{
+		{"Mon 09:00 - Tue 14:30", window{0, 9, 0, 1, 14, 30}},
+		{"Mon 09:00-Tue 14:30", window{0, 9, 0, 1, 14, 30}},
+		{"0 09:00-10:30", window{0, 9, 0, 0, 10, 30}},
+		{"  wed   9:05 -   17:45 ", window{2, 9, 5, 2, 17, 45}},
+		{"FRIDAY 08:00-08:01", window{4, 8, 0, 4, 8, 1}},
+		{"tues 10:00-11:00", window{1, 10, 0, 1, 11, 0}},
+		{"Th 10:00-11:00", window{3, 10, 0, 3, 11, 0}},
+		{"Mo 10:00-11:00", window{0, 10, 0, 0, 11, 0}},
+		{"Di 10:00-11:00", window{1, 10, 0, 1, 11, 0}},
+		{"mer 10:00-11:00", window{2, 10, 0, 2, 11, 0}},
+		{"Dim 10:00-11:00", window{6, 10, 0, 6, 11, 0}},
+		{"Sat 22:00 - Sun 01:00", window{5, 22, 0, 6, 1, 0}},
+		{"Mon 09:00-24:00", window{0, 9, 0, 1, 0, 0}},
+		{"Mon 00:00 - Mon 24:00", window{0, 0, 0, 1, 0, 0}},
+		{"Sat 22:00 - Sun 24:00", window{5, 22, 0, 7, 0, 0}},
+		{"Sun 22:00-24:00", window{6, 22, 0, 7, 0, 0}},
+	}
+	for _, tt := range tests {
+		sd, sh, sm, ed, eh, em, err := ParseTimeRange(tt.in)
+		if err != nil {
+			t.Errorf("ParseTimeRange(%q): %v", tt.in, err)
+			continue
+		}
+		if got := (window{sd, sh, sm, ed, eh, em}); got != tt.want {
+			t.Errorf("ParseTimeRange(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRangeErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // part of the error, naming the bad token
+	}{
+		{"", "empty booking time"},
+		{"   ", "empty booking time"},
+		{"Mon", "incomplete booking time"},
+		{"Mon 09:00 -", `"-"`},
+		{"Mon 09:00 - Tue 10:00 extra", `unexpected "extra"`},
+		{"Funday 09:00-10:00", `start day: unknown day "Funday"`},
+		{"T 09:00-10:00", "start day"},
+		{"S 09:00-10:00", "start day"},
+		{"7 09:00-10:00", "start day: day 7 is out of range"},
+		{"-1 09:00-10:00", "start day"},
+		{"Mon 9-10:00", `start time: "9" is not HH:MM`},
+		{"Mon 09:0-10:00", `start time: "09:0" is not HH:MM`},
+		{"Mon 24:00-10:00", `start time: "24:00" is out of range`},
+		{"Mon 09:60-10:00", `start time: "09:60" is out of range`},
+		{"Mon 09:00-24:01", `end time: "24:01" is out of range`},
+		{"Mon 09:00-24:30", `end time: "24:30" is out of range`},
+		{"Mon 09:00 to 10:00", `expected "-" after the start time, got "to"`},
+		{"Mon 09:00 - Xday 10:00", `end day: unknown day "Xday"`},
+		{"Mon 09:00-10h", `end time: "10h" is not HH:MM`},
+		{"Mon 10:00-09:00", "is not after the start"},
+		{"Mon 10:00-10:00", "is not after the start"},
+		{"Tue 10:00 - Mon 11:00", "is not after the start"},
+	}
+	for _, tt := range tests {
+		_, _, _, _, _, _, err := ParseTimeRange(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseTimeRange(%q) error = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestParseWeekTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    [3]uint8
+		wantErr bool
+	}{
+		{in: "Mon 10:00", want: [3]uint8{0, 10, 0}},
+		{in: "6 23:59", want: [3]uint8{6, 23, 59}},
+		{in: "Mon", wantErr: true},
+		{in: "Mon 10:00 extra", wantErr: true},
+		{in: "Mon 24:00", wantErr: true},
+		{in: "Funday 10:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		d, h, m, err := ParseWeekTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWeekTime(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && [3]uint8{d, h, m} != tt.want {
+			t.Errorf("ParseWeekTime(%q) = %v, want %v", tt.in, [3]uint8{d, h, m}, tt.want)
+		}
+	}
+}
+
+func TestReadBookingRangeFallsBack(t *testing.T) {
+	tests := []struct {
+		name, input string
+		want        window
+	}{
+		{"one line", "Tue 09:00-10:30\n", window{1, 9, 0, 1, 10, 30}},
+		{"empty line", "\nTue\n9\n0\nTue\n10\n30\n", window{1, 9, 0, 1, 10, 30}},
+		{"unparsable line", "Tue 9h\nTue\n9\n0\nWed\n11\n0\n", window{1, 9, 0, 2, 11, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, sh, sm, ed, eh, em, err := ReadBookingRange(bufio.NewReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatalf("ReadBookingRange: %v", err)
+			}
+			if got := (window{sd, sh, sm, ed, eh, em}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBookingDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr string
+	}{
+		{in: "90m", want: 90 * time.Minute},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: " 2h ", want: 2 * time.Hour},
+		{in: "24h", want: 24 * time.Hour},
+		{in: "90", wantErr: "is not a duration"},
+		{in: "1d", wantErr: "is not a duration"},
+		{in: "", wantErr: "is not a duration"},
+		{in: "0m", wantErr: "must be positive"},
+		{in: "-30m", wantErr: "must be positive"},
+		{in: "90s", wantErr: "whole number of minutes"},
+		{in: "1m30s", wantErr: "whole number of minutes"},
+	}
+	for _, tt := range tests {
+		got, err := ParseBookingDuration(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseBookingDuration(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBookingDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRangeDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want window
+	}{
+		{"Mon 09:00 for 1h30m", window{0, 9, 0, 0, 10, 30}},
+		{"Mon 09:00 1h30m", window{0, 9, 0, 0, 10, 30}},
+		{"Thu 10:00 for 30m", window{3, 10, 0, 3, 10, 30}},
+		{"Mon 23:00 for 2h", window{0, 23, 0, 1, 1, 0}},
+		{"Sun 23:00 for 59m", window{6, 23, 0, 6, 23, 59}},
+		{"Sun 23:00 for 1h", window{6, 23, 0, 7, 0, 0}},
+		{"Mon 00:00 for 24h", window{0, 0, 0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		sd, sh, sm, ed, eh, em, err := ParseTimeRange(tt.in)
+		if err != nil {
+			t.Errorf("ParseTimeRange(%q): %v", tt.in, err)
+			continue
+		}
+		if got := (window{sd, sh, sm, ed, eh, em}); got != tt.want {
+			t.Errorf("ParseTimeRange(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	errs := []struct{ in, want string }{
+		{"Fri 09:00 for 72h", "past Sunday 24:00"},
+		{"Sun 23:00 for 2h", "past Sunday 24:00"},
+		{"Mon 09:00 for", "expected a single duration"},
+		{"Mon 09:00 for 1h 2h", "expected a single duration"},
+		{"Mon 09:00 for 90", "duration"},
+		{"Mon 09:00 for 90s", "whole number of minutes"},
+		{"Mon 09:00 for -1h", "duration"},
+	}
+	for _, tt := range errs {
+		_, _, _, _, _, _, err := ParseTimeRange(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseTimeRange(%q) error = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		in        string
+		minutes   int32
+		wholeDays bool
+		wantErr   string
+	}{
+		{in: "90", minutes: 90},
+		{in: "-30", minutes: -30},
+		{in: "+1d", minutes: 1440, wholeDays: true},
+		{in: "1d", minutes: 1440, wholeDays: true},
+		{in: "-2d", minutes: -2880, wholeDays: true},
+		{in: "+1d-1d", minutes: 0, wholeDays: true},
+		{in: "-2h", minutes: -120},
+		{in: "+30m", minutes: 30},
+		{in: "1h30m", minutes: 90},
+		{in: "-1h30m", minutes: -90},
+		{in: "1d-2h+30m", minutes: 1440 - 120 + 30},
+		{in: " + 1 D ", minutes: 1440, wholeDays: true},
+		{in: "6d23h59m", minutes: 7*1440 - 1},
+		{in: "1440", minutes: 1440},
+		{in: "", wantErr: "empty offset"},
+		{in: "+", wantErr: "is not an offset"},
+		{in: "1", minutes: 1},
+		{in: "d", wantErr: "is not an offset"},
+		{in: "1d2", wantErr: "is not an offset"},
+		{in: "2w", wantErr: "unknown unit 'w'"},
+		{in: "7d", wantErr: "out of the week"},
+		{in: "-7d", wantErr: "out of the week"},
+		{in: "10080", wantErr: "out of the week"},
+		{in: "99999999999d", wantErr: "too large"},
+	}
+	for _, tt := range tests {
+		minutes, wholeDays, err := ParseOffset(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseOffset(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || minutes != tt.minutes || wholeDays != tt.wholeDays {
+			t.Errorf("ParseOffset(%q) = %d, %v, %v, want %d, %v", tt.in, minutes, wholeDays, err, tt.minutes, tt.wholeDays)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Message kinds the decoder can walk a packet as.
+const (
+	asRequest = "request"
+	asReply   = "reply"
+)
+
+// walker prints the fields of one message, one line each, with the offset
+// and length of the bytes they came from. An error means decoding stopped
+// at w.off; the walker has printed everything before it.
+type walker struct {
+	out    io.Writer
+	data   []byte
+	off    int
+	base   int    // offset of data in the outer packet, for batch entries
+	indent string // nesting of batch entries
+}
+
+func (w *walker) line(start int, name, value string) {
+	fmt.Fprintf(w.out, "%s%5d %5d  %-18s %s\n", w.indent, w.base+start, w.off-start, name, value)
+}
+
+// take consumes n bytes for the named field.
+func (w *walker) take(n int, name string) ([]byte, error) {
+	if left := len(w.data) - w.off; n > left {
+		return nil, fmt.Errorf("%s needs %d bytes, %d left", name, n, left)
+	}
+	b := w.data[w.off : w.off+n]
+	w.off += n
+	return b, nil
+}
+
+// field consumes and prints one field of the given kind, returning its raw
+// bytes (for a string, the content without its length).
+func (w *walker) field(f field) ([]byte, error) {
+	start := w.off
+	switch f.kind {
+	case kindByte, kindBool:
+		b, err := w.take(1, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprint(b[0]))
+		return b, nil
+	case kindDay:
+		b, err := w.take(1, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprintf("%d (%s)", b[0], common.DayName(b[0])))
+		return b, nil
+	case kindUint16:
+		b, err := w.take(2, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprint(binary.BigEndian.Uint16(b)))
+		return b, nil
+	case kindUint32:
+		b, err := w.take(4, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprint(binary.BigEndian.Uint32(b)))
+		return b, nil
+	case kindInt32:
+		b, err := w.take(4, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprint(int32(binary.BigEndian.Uint32(b))))
+		return b, nil
+	case kindUint64:
+		b, err := w.take(8, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprint(binary.BigEndian.Uint64(b)))
+		return b, nil
+	case kindInt64:
+		b, err := w.take(8, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprint(int64(binary.BigEndian.Uint64(b))))
+		return b, nil
+	case kindString:
+		s, err := w.str(f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprintf("%q (length %d)", s, len(s)))
+		return s, nil
+	case kindDays:
+		n, err := w.take(1, f.name+" count")
+		if err != nil {
+			return nil, err
+		}
+		days, err := w.take(int(n[0]), f.name)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(days))
+		for i, d := range days {
+			names[i] = common.ShortDayName(d)
+		}
+		w.line(start, f.name, fmt.Sprintf("%d days [%s]", len(days), strings.Join(names, " ")))
+		return days, nil
+	case kindWeekTime:
+		b, err := w.take(3, f.name)
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprintf("%s %02d:%02d (bytes %d %d %d)", common.ShortDayName(b[0]), b[1], b[2], b[0], b[1], b[2]))
+		return b, nil
+	case kindStrings:
+		n, err := w.take(1, f.name+" count")
+		if err != nil {
+			return nil, err
+		}
+		w.line(start, f.name, fmt.Sprintf("count %d", n[0]))
+		for i := 0; i < int(n[0]); i++ {
+			if _, err := w.field(field{fmt.Sprintf("%s[%d]", f.name, i), kindString}); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case kindBatch:
+		return nil, w.batch(f.name)
+	}
+	return nil, fmt.Errorf("%s: no layout for kind %d", f.name, f.kind)
+}
+
+// str reads a 2-byte length and that many bytes.
+func (w *walker) str(name string) ([]byte, error) {
+	n, err := w.take(2, name+" length")
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(n))
+	if left := len(w.data) - w.off; length > left {
+		w.off -= len(n) // report the field where it starts
+		return nil, fmt.Errorf("%s has length %d, %d bytes left", name, length, left)
+	}
+	return w.take(length, name)
+}
+
+// header walks Magic, OpCode, RequestID and Flags, which requests and
+// replies share, and returns the OpCode and flags.
+func (w *walker) header() (op, flags uint8, err error) {
+	start := w.off
+	magic, err := w.take(common.MagicSize, "Magic")
+	if err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(magic, common.Magic[:]) {
+		w.line(start, "Magic", hex.EncodeToString(magic))
+		w.off = start
+		return 0, 0, fmt.Errorf("magic is %x, want %x: not a booking packet", magic, common.Magic)
+	}
+	w.line(start, "Magic", hex.EncodeToString(magic))
+
+	start = w.off
+	b, err := w.take(1, "OpCode")
+	if err != nil {
+		return 0, 0, err
+	}
+	op = b[0]
+	w.line(start, "OpCode", fmt.Sprintf("%d (%s)", op, common.OpName(op)))
+
+	if _, err := w.field(field{"RequestID", kindUint64}); err != nil {
+		return 0, 0, err
+	}
+
+	start = w.off
+	if b, err = w.take(1, "Flags"); err != nil {
+		return 0, 0, err
+	}
+	flags = b[0]
+	w.line(start, "Flags", describeFlags(flags))
+	return op, flags, nil
+}
+
+func (w *walker) walk(kind string) error {
+	if kind == asReply {
+		return w.reply()
+	}
+	return w.request()
+}
+
+// request walks a plaintext request.
+func (w *walker) request() error {
+	op, flags, err := w.header()
+	if err != nil {
+		return err
+	}
+	if flags&common.FlagSession != 0 {
+		if _, err := w.field(field{"SessionToken", kindString}); err != nil {
+			return err
+		}
+	}
+	if flags&common.FlagSemantics != 0 {
+		if _, err := w.field(field{"Semantics", kindByte}); err != nil {
+			return err
+		}
+	}
+	if flags&common.FlagCapabilities != 0 {
+		if _, err := w.field(field{"Capabilities", kindByte}); err != nil {
+			return err
+		}
+	}
+	body, ok := requestBodies[op]
+	if !ok {
+		return fmt.Errorf("no request layout for OpCode %s", common.OpName(op))
+	}
+	for _, f := range body {
+		if _, err := w.field(f); err != nil {
+			return err
+		}
+	}
+	return w.extensions()
+}
+
+// reply walks a plaintext reply or callback.
+func (w *walker) reply() error {
+	op, flags, err := w.header()
+	if err != nil {
+		return err
+	}
+	start := w.off
+	b, err := w.take(4, "Status")
+	if err != nil {
+		return err
+	}
+	status := int32(binary.BigEndian.Uint32(b))
+	name, ok := statusNames[status]
+	if !ok {
+		name = "unknown"
+	}
+	w.line(start, "Status", fmt.Sprintf("%d (%s)", status, name))
+
+	start = w.off
+	data, err := w.str("Data")
+	if err != nil {
+		return err
+	}
+	if flags&common.FlagCompressed != 0 {
+		text, err := gunzip(data)
+		if err != nil {
+			w.line(start, "Data", fmt.Sprintf("%d gzip bytes", len(data)))
+			return fmt.Errorf("Data: %v", err)
+		}
+		w.line(start, "Data", fmt.Sprintf("%q (%d gzip bytes, %d unpacked)", text, len(data), len(text)))
+	} else {
+		w.line(start, "Data", fmt.Sprintf("%q (length %d)", data, len(data)))
+	}
+
+	// Like UnmarshalReply: a rejected envelope has no batch section
+	if op == common.OpBatch && w.off < len(w.data) {
+		if err := w.batch("Replies"); err != nil {
+			return err
+		}
+	}
+	return w.extensions()
+}
+
+// batch walks the count and length-prefixed entries of an OpBatch request
+// or reply, each entry as a nested message.
+func (w *walker) batch(name string) error {
+	start := w.off
+	n, err := w.take(1, name+" count")
+	if err != nil {
+		return err
+	}
+	w.line(start, name, fmt.Sprintf("count %d", n[0]))
+	for i := 0; i < int(n[0]); i++ {
+		start := w.off
+		entry, err := w.str(fmt.Sprintf("entry %d", i))
+		if err != nil {
+			return err
+		}
+		w.line(start, fmt.Sprintf("entry %d", i), fmt.Sprintf("%d bytes", len(entry)))
+		sub := &walker{out: w.out, data: entry, base: w.base + w.off - len(entry), indent: w.indent + "    "}
+		walk := sub.request
+		if name == "Replies" {
+			walk = sub.reply
+		}
+		if err := walk(); err != nil {
+			return fmt.Errorf("%s entry %d at offset %d: %v", name, i, sub.base+sub.off, err)
+		}
+		if sub.off < len(entry) {
+			return fmt.Errorf("%s entry %d has %d bytes after its end", name, i, len(entry)-sub.off)
+		}
+	}
+	return nil
+}
+
+// extensions walks the TLV section, if any bytes remain.
+func (w *walker) extensions() error {
+	if w.off >= len(w.data) {
+		return nil
+	}
+	start := w.off
+	n, _ := w.take(1, "Extensions count")
+	w.line(start, "Extensions", fmt.Sprintf("count %d", n[0]))
+	for i := 0; i < int(n[0]); i++ {
+		start := w.off
+		tag, err := w.take(1, "extension tag")
+		if err != nil {
+			return err
+		}
+		name, ok := extNames[tag[0]]
+		if !ok {
+			name = fmt.Sprintf("unknown(%d)", tag[0])
+		}
+		value, err := w.str(fmt.Sprintf("extension %s", name))
+		if err != nil {
+			return err
+		}
+		w.line(start, fmt.Sprintf("  tag %d", tag[0]), fmt.Sprintf("%s: %s", name, describeExtension(tag[0], value)))
+	}
+	return nil
+}
+
+// describeExtension renders an extension value by its tag.
+func describeExtension(tag uint8, value []byte) string {
+	k, ok := extKinds[tag]
+	switch {
+	case len(value) == 0:
+		return "(no value)"
+	case !ok:
+		return fmt.Sprintf("%d bytes %s", len(value), shortHex(value))
+	case k == kindString:
+		return fmt.Sprintf("%q", value)
+	case k == kindByte && len(value) == 1:
+		return fmt.Sprintf("%d (0x%02x)", value[0], value[0])
+	case k == kindUint64 && len(value) == 8:
+		v := binary.BigEndian.Uint64(value)
+		if tag == common.ExtTimestamp || tag == common.ExtServerClock {
+			return fmt.Sprintf("%d (%s)", v, time.UnixMilli(int64(v)).UTC().Format(time.RFC3339Nano))
+		}
+		return fmt.Sprint(v)
+	case k == kindDays && len(value) >= 1 && int(value[0]) == len(value)-1:
+		names := make([]string, 0, len(value)-1)
+		for _, d := range value[1:] {
+			names = append(names, common.ShortDayName(d))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(names, " "))
+	}
+	return fmt.Sprintf("%d bytes %s (malformed)", len(value), shortHex(value))
+}
+
+func describeFlags(flags uint8) string {
+	var set []string
+	rest := flags
+	for _, f := range flagNames {
+		if flags&f.bit != 0 {
+			set = append(set, f.name)
+			rest &^= f.bit
+		}
+	}
+	if rest != 0 {
+		set = append(set, fmt.Sprintf("unknown 0x%02x", rest))
+	}
+	if len(set) == 0 {
+		return "0x00"
+	}
+	return fmt.Sprintf("0x%02x (%s)", flags, strings.Join(set, ", "))
+}
+
+// shortHex shows up to 32 bytes in hex.
+func shortHex(b []byte) string {
+	if len(b) > 32 {
+		return hex.EncodeToString(b[:32]) + "..."
+	}
+	return hex.EncodeToString(b)
+}
+
+func gunzip(data []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	out, err := io.ReadAll(zr)
+	return string(out), err
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// sampleRequest is a request of op with every field its body could carry
+// filled in, so each operation shows its whole layout.
+func sampleRequest(op uint8) common.RequestMessage {
+	req := common.RequestMessage{
+		OpCode: op, RequestID: 7,
+		FacilityName: "RoomA", DaysList: []uint8{0, 2},
+		StartDay: 0, StartHour: 9, EndDay: 0, EndHour: 10, EndMinute: 30,
+		ConfirmationID: "BKG-10000", OffsetMinutes: 30, MonitorPeriod: 60,
+		ParticipantName: "Ada", MatchMode: common.MatchSubstring,
+		Reason: "cleaning", PageLimit: 10, Confirm: true,
+		NewFacilityName: "RoomB", TargetNamespace: "east",
+		Username: "ada", Password: "secret", PingTime: 1700000000000,
+		MonitorToken: "tok", SinceSeq: 42, HelloVersion: 1, HelloCapabilities: 3,
+	}
+	if op == common.OpBatch {
+		req.Batch = []common.RequestMessage{
+			{OpCode: common.OpQueryAvailability, RequestID: 8, FacilityName: "RoomA", DaysList: []uint8{4}},
+			{OpCode: common.OpCancelBooking, RequestID: 9, ConfirmationID: "BKG-10001"},
+		}
+	}
+	return req
+}
+
+func marshalRequest(t *testing.T, req common.RequestMessage) []byte {
+	t.Helper()
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest(%s): %v", common.OpName(req.OpCode), err)
+	}
+	return raw
+}
+
+func marshalReply(t *testing.T, rep common.ReplyMessage) []byte {
+	t.Helper()
+	raw, err := common.MarshalReply(rep)
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	return raw
+}
+
+// checkGolden decodes packet and compares the breakdown, followed by the
+// returned error if any, with testdata/name.golden.
+func checkGolden(t *testing.T, name string, packet, key []byte, as string) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := decodePacket(&out, packet, key, as); err != nil {
+		out.WriteString("error: " + err.Error() + "\n")
+	}
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if out.String() != string(want) {
+		t.Errorf("%s: decoded as\n%s\nwant\n%s", name, out.String(), want)
+	}
+}
+
+// TestDecodeRequests decodes one request of each operation.
+func TestDecodeRequests(t *testing.T) {
+	for op := 0; op < 256; op++ {
+		name := common.OpName(uint8(op))
+		if strings.HasPrefix(name, "unknown") || op == common.OpCallback {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			checkGolden(t, "request-"+name, marshalRequest(t, sampleRequest(uint8(op))), nil, "")
+		})
+	}
+}
+
+func TestDecodeReplies(t *testing.T) {
+	booked := common.ReplyMessage{RequestID: 7, OpCode: common.OpBookFacility, Data: "Booked. ID=BKG-1", ServerMicros: 250}
+	conflict := common.ReplyMessage{RequestID: 7, OpCode: common.OpBookFacility, Status: common.StatusConflict,
+		Data: "Time conflict with an existing booking."}
+	callback := common.ReplyMessage{OpCode: common.OpCallback, Data: "Facility=RoomA updated"}
+	callback.Extensions.PutUint64(common.ExtCallbackSeq, 3)
+	callback.Extensions.Put(common.ExtCallbackFacility, []byte("RoomA"))
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"reply-BookFacility", marshalReply(t, booked)},
+		{"reply-conflict", marshalReply(t, conflict)},
+		{"reply-Callback", marshalReply(t, callback)},
+		{"reply-length-prefixed", common.PrefixLength(marshalReply(t, booked))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkGolden(t, tt.name, tt.packet, nil, "") })
+	}
+}
+
+// TestDecodeSigned: the MAC is shown last, checked only with the key.
+func TestDecodeSigned(t *testing.T) {
+	key := []byte("decode-key")
+	packet, err := common.PacketSecurity{Key: key}.Seal(marshalRequest(t, sampleRequest(common.OpCancelBooking)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "signed-no-key", packet, nil, "")
+	checkGolden(t, "signed-key", packet, key, "")
+	checkGolden(t, "signed-wrong-key", packet, []byte("other"), "")
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	book := marshalRequest(t, sampleRequest(common.OpBookFacility))
+	reply := marshalReply(t, common.ReplyMessage{RequestID: 7, OpCode: common.OpBookFacility, Data: "Booked"})
+	badLength := common.PrefixLength(book)
+	badLength[3]++
+	tests := []struct {
+		name   string
+		packet []byte
+		as     string
+	}{
+		{"malformed-no-magic", []byte("hello, server"), ""},
+		{"malformed-short-header", book[:6], ""},
+		{"malformed-cut-string", book[:16], ""},
+		{"malformed-cut-times", book[:len(book)-2], ""},
+		{"malformed-trailing", append(append([]byte(nil), book...), 0xAB, 0xCD), ""},
+		{"malformed-unknown-op", append(append([]byte(nil), book[:common.MagicSize]...), append([]byte{99}, book[common.MagicSize+1:]...)...), ""},
+		{"malformed-length-prefix", badLength, ""},
+		{"malformed-reply-as-request", reply, asRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkGolden(t, tt.name, tt.packet, nil, tt.as) })
+	}
+}
+
+// TestDecodeEncrypted: without the key only the header, nonce and
+// ciphertext are shown; with it the plaintext is decoded. The nonce is
+// random, so this is checked without a golden file.
+func TestDecodeEncrypted(t *testing.T) {
+	key := []byte("decode-key")
+	packet, err := common.PacketSecurity{Key: key, Encrypt: true}.Seal(marshalRequest(t, sampleRequest(common.OpAddParticipant)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = decodePacket(&out, packet, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "pass -authKey") || !strings.Contains(out.String(), "Nonce") ||
+		!strings.Contains(out.String(), "Ciphertext") || strings.Contains(out.String(), "Ada") {
+		t.Errorf("without the key: %v\n%s", err, out.String())
+	}
+	out.Reset()
+	if err := decodePacket(&out, packet, key, ""); err != nil || !strings.Contains(out.String(), `"Ada"`) ||
+		!strings.Contains(out.String(), "decrypted with -authKey") {
+		t.Errorf("with the key: %v\n%s", err, out.String())
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	packet := marshalRequest(t, sampleRequest(common.OpPing))
+	plain := hex.EncodeToString(packet)
+	spaced := strings.TrimSpace(spaceHex(plain))
+	tests := []struct {
+		name, in, format string
+	}{
+		{"hex", plain, "auto"},
+		{"upper hex", strings.ToUpper(plain), "hex"},
+		{"spaced hex", spaced, "auto"},
+		{"colons", strings.ReplaceAll(spaced, " ", ":"), "auto"},
+		{"hex.Dump", "client -> server\n" + hex.Dump(packet), "auto"},
+		{"base64", base64.StdEncoding.EncodeToString(packet), "auto"},
+		{"raw url base64", base64.RawURLEncoding.EncodeToString(packet), "base64"},
+	}
+	for _, tt := range tests {
+		got, err := parseInput(tt.in, tt.format)
+		if err != nil || !bytes.Equal(got, packet) {
+			t.Errorf("%s: % x, %v", tt.name, got, err)
+		}
+	}
+	for in, format := range map[string]string{"": "auto", "zz top": "auto", "abc": "hex", "!!!": "base64", "00": "octal"} {
+		if _, err := parseInput(in, format); err == nil {
+			t.Errorf("parseInput(%q, %s) accepted", in, format)
+		}
+	}
+}
+
+// spaceHex puts a space between the bytes of a hex string.
+func spaceHex(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i += 2 {
+		b.WriteString(s[i:i+2] + " ")
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package main
+
+import "github.com/Iyzyman/distributed-go/common"
+
+// kind is how a field is laid out on the wire.
+type kind int
+
+const (
+	kindByte     kind = iota // 1 byte, shown as a number
+	kindBool                 // 1 byte, 0 or 1
+	kindDay                  // 1 byte day of the week
+	kindUint16               // 2 bytes big-endian
+	kindUint32               // 4 bytes big-endian
+	kindInt32                // 4 bytes big-endian, signed
+	kindUint64               // 8 bytes big-endian
+	kindInt64                // 8 bytes big-endian, signed
+	kindString               // 2-byte length + bytes
+	kindDays                 // 1-byte count + one byte per day
+	kindWeekTime             // day, hour, minute: 3 bytes
+	kindBatch                // 1-byte count + length-prefixed messages
+	kindStrings              // 1-byte count + strings
+)
+
+type field struct {
+	name string
+	kind kind
+}
+
+// requestBodies are the fields MarshalRequest writes after the header and
+// the optional session, semantics and capability fields, by OpCode. They
+// must change with MarshalRequest; the decoder checks itself against
+// UnmarshalRequest and reports any disagreement.
+var requestBodies = map[uint8][]field{
+	common.OpQueryAvailability:   {{"FacilityName", kindString}, {"DaysList", kindDays}},
+	common.OpBookFacility:        {{"FacilityName", kindString}, {"Start", kindWeekTime}, {"End", kindWeekTime}},
+	common.OpChangeBooking:       {{"ConfirmationID", kindString}, {"OffsetMinutes", kindInt32}},
+	common.OpMonitorAvailability: {{"FacilityName", kindString}, {"MonitorPeriod", kindUint32}},
+	common.OpCancelBooking:       {{"ConfirmationID", kindString}},
+	common.OpAddParticipant:      {{"ConfirmationID", kindString}, {"ParticipantName", kindString}},
+	common.OpRegisterUser:        {{"Username", kindString}, {"Password", kindString}},
+	common.OpPing:                {{"PingTime", kindInt64}},
+	common.OpBatch:               {{"Batch", kindBatch}},
+	common.OpHello:               {{"HelloVersion", kindByte}, {"HelloCapabilities", kindByte}},
+	common.OpResendCallbacks:     {{"FacilityName", kindString}, {"SinceSeq", kindUint64}},
+	common.OpKeepalive:           {},
+	common.OpRebindMonitor:       {{"MonitorToken", kindString}},
+	common.OpListMonitors:        {},
+	common.OpAddBlackout:         {{"FacilityName", kindString}, {"Start", kindWeekTime}, {"End", kindWeekTime}, {"Reason", kindString}},
+	common.OpClearBookings:       {{"FacilityName", kindString}, {"DaysList", kindDays}, {"Confirm", kindBool}},
+	common.OpListBookings:        {{"FacilityName", kindString}, {"PageOffset", kindUint32}, {"PageLimit", kindUint16}},
+	common.OpQueryChanges:        {{"FacilityName", kindString}, {"SinceSeq", kindUint64}},
+	common.OpFindParticipant:     {{"ParticipantName", kindString}, {"FacilityName", kindString}, {"MatchMode", kindByte}},
+	common.OpTransferBooking:     {{"ConfirmationID", kindString}, {"FacilityName", kindString}},
+	common.OpSplitBooking:        {{"ConfirmationID", kindString}, {"Start", kindWeekTime}, {"End", kindWeekTime}},
+	common.OpCopyBooking:         {{"ConfirmationID", kindString}, {"StartDay", kindDay}},
+	common.OpFreeBusy:            {{"Start", kindWeekTime}, {"End", kindWeekTime}},
+	common.OpHeatmap:             {{"FacilityName", kindString}},
+	common.OpRenameFacility:      {{"FacilityName", kindString}, {"NewFacilityName", kindString}},
+	common.OpGetServerInfo:       {},
+	common.OpCreateNamespace:     {{"TargetNamespace", kindString}, {"Facilities", kindStrings}},
+	common.OpDeleteNamespace:     {{"TargetNamespace", kindString}, {"Confirm", kindBool}},
+	common.OpApproveBooking:      {{"ConfirmationID", kindString}},
+	common.OpRejectBooking:       {{"ConfirmationID", kindString}, {"Reason", kindString}},
+}
+
+// extNames name the extension tags of common/tlv.go.
+var extNames = map[uint8]string{
+	common.ExtTimestamp:        "Timestamp",
+	common.ExtProtocolVersion:  "ProtocolVersion",
+	common.ExtCapabilities:     "Capabilities",
+	common.ExtSemantics:        "Semantics",
+	common.ExtServerVersion:    "ServerVersion",
+	common.ExtCallbackSeq:      "CallbackSeq",
+	common.ExtCallbackFacility: "CallbackFacility",
+	common.ExtCallbackAvail:    "CallbackAvail",
+	common.ExtMonitorDays:      "MonitorDays",
+	common.ExtCallbackEvent:    "CallbackEvent",
+	common.ExtMonitorEvents:    "MonitorEvents",
+	common.ExtWholeDays:        "WholeDays",
+	common.ExtEndOnly:          "EndOnly",
+	common.ExtForce:            "Force",
+	common.ExtMoreFacilities:   "MoreFacilities",
+	common.ExtQueryBitmap:      "QueryBitmap",
+	common.ExtBusyBitmap:       "BusyBitmap",
+	common.ExtIdempotencyKey:   "IdempotencyKey",
+	common.ExtErrorEcho:        "ErrorEcho",
+	common.ExtServerTime:       "ServerTime",
+	common.ExtOccupied:         "Occupied",
+	common.ExtFreeBusy:         "FreeBusy",
+	common.ExtHeatmap:          "Heatmap",
+	common.ExtDryRun:           "DryRun",
+	common.ExtServerClock:      "ServerClock",
+	common.ExtRenamedFrom:      "RenamedFrom",
+	common.ExtNamespace:        "Namespace",
+	common.ExtClientInstance:   "ClientInstance",
+}
+
+// extKinds say how to show the value of an extension; tags not listed are
+// shown in hex.
+var extKinds = map[uint8]kind{
+	common.ExtTimestamp:        kindUint64,
+	common.ExtProtocolVersion:  kindByte,
+	common.ExtCapabilities:     kindByte,
+	common.ExtSemantics:        kindString,
+	common.ExtServerVersion:    kindString,
+	common.ExtCallbackSeq:      kindUint64,
+	common.ExtCallbackFacility: kindString,
+	common.ExtCallbackAvail:    kindString,
+	common.ExtMonitorDays:      kindDays,
+	common.ExtCallbackEvent:    kindByte,
+	common.ExtMonitorEvents:    kindByte,
+	common.ExtIdempotencyKey:   kindString,
+	common.ExtServerTime:       kindUint64,
+	common.ExtServerClock:      kindUint64,
+	common.ExtRenamedFrom:      kindString,
+	common.ExtNamespace:        kindString,
+	common.ExtClientInstance:   kindString,
+}
+
+var statusNames = map[int32]string{
+	common.StatusOK:               "OK",
+	common.StatusError:            "Error",
+	common.StatusConflict:         "Conflict",
+	common.StatusNotPrimary:       "NotPrimary",
+	common.StatusAuthRequired:     "AuthRequired",
+	common.StatusStaleRequest:     "StaleRequest",
+	common.StatusBadSession:       "BadSession",
+	common.StatusPermissionDenied: "PermissionDenied",
+	common.StatusTooLarge:         "TooLarge",
+	common.StatusOutsideWindow:    "OutsideWindow",
+	common.StatusInvalidArgument:  "InvalidArgument",
+	common.StatusInProgress:       "InProgress",
+	common.StatusBookingOver:      "BookingOver",
+	common.StatusChangesExpired:   "ChangesExpired",
+	common.StatusBusy:             "Busy",
+	common.StatusInternal:         "Internal",
+}
+
+// flagNames name the bits of the flags byte, lowest first.
+var flagNames = []struct {
+	bit  uint8
+	name string
+}{
+	{common.FlagAuthenticated, "authenticated"},
+	{common.FlagEncrypted, "encrypted"},
+	{common.FlagSession, "session"},
+	{common.FlagSemantics, "semantics"},
+	{common.FlagCapabilities, "capabilities"},
+	{common.FlagCompressed, "compressed"},
+}
@@ -0,0 +1,240 @@
+// Command bookingdecode explains a packet of the booking protocol field by
+// field, for hex dumps pasted from a log or a chat.
+//
+//	bookingdecode b00c0200000000000000070000...
+//	bookingdecode < dump.txt
+//
+// It reads hex (plain, with spaces or colons, or the dumps printed by
+// -debug) or base64 from its arguments or stdin, tries the packet as a
+// request and then as a reply, and prints each field with its offset and
+// length. On a malformed packet it prints what it could read and where and
+// why decoding stopped.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// flagsOffset is the position of the flags byte: Magic, OpCode, RequestID.
+const flagsOffset = common.MagicSize + 1 + 8
+
+// nonceSize is the AES-GCM nonce after the header of an encrypted packet.
+const nonceSize = 12
+
+var (
+	formatFlag  = flag.String("format", "auto", "Input encoding: auto, hex or base64")
+	asFlag      = flag.String("as", "", "Decode as request or reply (empty = try request, then reply)")
+	authKeyFlag = flag.String("authKey", "", "Shared secret, to check the MAC and decrypt encrypted packets")
+)
+
+func main() {
+	flag.Parse()
+	if *asFlag != "" && *asFlag != asRequest && *asFlag != asReply {
+		log.Fatalf("Unknown -as %s. Choose '%s' or '%s'.", *asFlag, asRequest, asReply)
+	}
+
+	input := strings.Join(flag.Args(), " ")
+	if input == "" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Reading stdin: %v", err)
+		}
+		input = string(b)
+	}
+	packet, err := parseInput(input, *formatFlag)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := decodePacket(os.Stdout, packet, []byte(*authKeyFlag), *asFlag); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// dumpLine matches a line of hex.Dump output, as printed by -debug: an
+// 8-digit offset, the bytes, and the ASCII column.
+var dumpLine = regexp.MustCompile(`^[0-9a-fA-F]{8}  ((?:[0-9a-fA-F]{2} {1,2})*[0-9a-fA-F]{2})\s*(\|.*\|)?$`)
+
+// parseInput turns pasted text into bytes. Lines from hex.Dump keep only
+// their hex column, and other lines that are not hex (such as the
+// direction line of a -debug dump) are skipped.
+func parseInput(text, format string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if format == "auto" || format == "hex" {
+		var digits strings.Builder
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if m := dumpLine.FindStringSubmatch(line); m != nil {
+				line = m[1]
+			}
+			line = strings.NewReplacer("0x", "", ":", " ", ",", " ").Replace(line)
+			clean := strings.Join(strings.Fields(line), "")
+			if _, err := hex.DecodeString(clean); err == nil || format == "hex" {
+				digits.WriteString(clean)
+			}
+		}
+		b, err := hex.DecodeString(digits.String())
+		if err == nil && len(b) > 0 {
+			return b, nil
+		}
+		if format == "hex" {
+			return nil, fmt.Errorf("input is not hex: %v", err)
+		}
+	}
+	if format == "auto" || format == "base64" {
+		compact := strings.Join(strings.Fields(text), "")
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(compact); err == nil && len(b) > 0 {
+				return b, nil
+			}
+		}
+		if format == "base64" {
+			return nil, errors.New("input is not base64")
+		}
+	}
+	if format != "auto" {
+		return nil, fmt.Errorf("unknown -format %s", format)
+	}
+	return nil, errors.New("input is neither hex nor base64")
+}
+
+// decodePacket prints the breakdown of one packet: the optional length
+// prefix of a datagram, the message, and the MAC trailer. It returns an
+// error if the packet could not be decoded completely.
+func decodePacket(out io.Writer, packet, key []byte, as string) error {
+	fmt.Fprintf(out, "%d bytes\n", len(packet))
+	fmt.Fprintf(out, "%5s %5s  %-18s %s\n", "off", "len", "field", "value")
+
+	data, base := packet, 0
+	if !common.HasMagic(data) && len(data) > common.LengthPrefixSize && common.HasMagic(data[common.LengthPrefixSize:]) {
+		w := &walker{out: out, data: data}
+		b, _ := w.take(common.LengthPrefixSize, "LengthPrefix")
+		declared := int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+		note := ""
+		if rest := len(data) - common.LengthPrefixSize; declared != rest {
+			note = fmt.Sprintf(" (but %d bytes follow)", rest)
+		}
+		w.line(0, "LengthPrefix", fmt.Sprintf("%d%s", declared, note))
+		data, base = data[common.LengthPrefixSize:], common.LengthPrefixSize
+	}
+
+	var flags uint8
+	if len(data) > flagsOffset && common.HasMagic(data) {
+		flags = data[flagsOffset]
+	}
+
+	// The MAC covers everything before it and is shown last
+	var mac []byte
+	if flags&common.FlagAuthenticated != 0 && len(data) > flagsOffset+common.MACSize {
+		mac = data[len(data)-common.MACSize:]
+	}
+	body := data[:len(data)-len(mac)]
+	macOffset := base + len(body)
+	printMAC := func() {
+		if mac == nil {
+			return
+		}
+		verdict := "not checked; pass -authKey"
+		if len(key) > 0 {
+			verdict = "verified"
+			if _, err := common.VerifyPacket(key, data); err != nil {
+				verdict = err.Error()
+			}
+		}
+		fmt.Fprintf(out, "%5d %5d  %-18s %s (%s)\n", macOffset, len(mac), "HMAC", shortHex(mac), verdict)
+	}
+
+	if flags&common.FlagEncrypted != 0 {
+		if len(key) == 0 {
+			w := &walker{out: out, data: body, base: base}
+			w.header()
+			if nonce, err := w.take(nonceSize, "Nonce"); err == nil {
+				w.line(w.off-nonceSize, "Nonce", hex.EncodeToString(nonce))
+				start := w.off
+				w.off = len(body)
+				w.line(start, "Ciphertext", fmt.Sprintf("%d bytes", len(body)-start))
+			}
+			printMAC()
+			return errors.New("encrypted: pass -authKey to decode the rest")
+		}
+		plain, err := common.PacketSecurity{Key: key, Encrypt: true}.Open(data)
+		if err != nil {
+			printMAC()
+			return fmt.Errorf("cannot open the packet: %v", err)
+		}
+		fmt.Fprintf(out, "decrypted with -authKey; the offsets below count in the %d plaintext bytes\n", len(plain))
+		body, base = plain, 0
+	}
+
+	kinds := []string{as}
+	if as == "" {
+		kinds = guessKinds(body)
+	}
+
+	var failed error
+	for _, kind := range kinds {
+		if len(kinds) > 1 {
+			fmt.Fprintf(out, "-- as a %s:\n", kind)
+		}
+		w := &walker{out: out, data: body, base: base}
+		if err := w.walk(kind); err != nil {
+			fmt.Fprintf(out, "stopped at offset %d: %v\n", base+w.off, err)
+			failed = errors.New("the packet could not be decoded completely")
+		} else if w.off < len(body) {
+			fmt.Fprintf(out, "%d bytes after the message at offset %d are ignored: %s\n", len(body)-w.off, base+w.off, shortHex(body[w.off:]))
+		}
+		if err := unmarshal(kind, body); err != nil {
+			fmt.Fprintf(out, "Unmarshal%s%s: %v\n", strings.ToUpper(kind[:1]), kind[1:], err)
+		} else {
+			fmt.Fprintf(out, "Unmarshal%s%s: ok\n", strings.ToUpper(kind[:1]), kind[1:])
+		}
+	}
+	printMAC()
+	return failed
+}
+
+// guessKinds picks how to read a message the user did not label: as a
+// request if UnmarshalRequest accepts it, then as a reply. A reply can
+// happen to parse as a request with bytes left over, so a reading that
+// uses every byte wins. If neither is accepted, both are shown, unless
+// the magic is wrong and both would stop at once.
+func guessKinds(body []byte) []string {
+	if !common.HasMagic(body) {
+		return []string{asRequest}
+	}
+	var accepted []string
+	for _, kind := range []string{asRequest, asReply} {
+		if unmarshal(kind, body) != nil {
+			continue
+		}
+		w := &walker{out: io.Discard, data: body}
+		if w.walk(kind) == nil && w.off == len(body) {
+			return []string{kind}
+		}
+		accepted = append(accepted, kind)
+	}
+	if len(accepted) > 0 {
+		return accepted[:1]
+	}
+	return []string{asRequest, asReply}
+}
+
+func unmarshal(kind string, body []byte) error {
+	if kind == asReply {
+		_, err := common.UnmarshalReply(body)
+		return err
+	}
+	_, err := common.UnmarshalRequest(body)
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Directions of a captured packet.
+const (
+	DirClient = "client" // sent by the client towards the server
+	DirServer = "server" // sent by the server: a reply or a callback
+)
+
+// maxRecordLine bounds one line of a capture file: a 64 KiB datagram in
+// base64 plus its annotation.
+const maxRecordLine = 1 << 20
+
+// Record is one captured datagram. A capture file holds one Record as a
+// JSON object per line, in the order the relay saw the packets. Packet is
+// the datagram exactly as it crossed the wire, length prefix and any MAC
+// included; the other fields are annotations for a human reader, filled in
+// by annotate as far as the packet can be read.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Dir       string    `json:"dir"`
+	Client    string    `json:"client"` // client address the relay saw
+	Op        string    `json:"op,omitempty"`
+	RequestID uint64    `json:"requestId,omitempty"`
+	Status    *int32    `json:"status,omitempty"` // replies only
+	Data      string    `json:"data,omitempty"`   // reply text
+	Note      string    `json:"note,omitempty"`   // why the packet could not be read
+	Packet    []byte    `json:"packet"`
+}
+
+// annotate fills in what the packet says. Without the key an HMAC is
+// stripped unchecked, so only encrypted packets stay unread.
+func annotate(rec *Record, key []byte) {
+	payload, _, err := common.SplitLength(rec.Packet)
+	if err != nil {
+		rec.Note = err.Error()
+		return
+	}
+	op, id, ok := common.PeekHeader(payload)
+	if !ok {
+		rec.Note = "header not readable"
+		return
+	}
+	rec.Op, rec.RequestID = common.OpName(op), id
+
+	var body []byte
+	switch {
+	case len(key) > 0:
+		sec := common.PacketSecurity{Key: key, Encrypt: common.IsEncrypted(payload)}
+		if body, err = sec.Open(payload); err != nil {
+			rec.Note = err.Error()
+			return
+		}
+	case common.IsEncrypted(payload):
+		rec.Note = "encrypted; pass -authKey to read it"
+		return
+	default:
+		body = common.StripMAC(payload)
+	}
+	if rec.Dir == DirClient {
+		if _, err := common.UnmarshalRequest(body); err != nil {
+			rec.Note = err.Error()
+		}
+		return
+	}
+	rep, err := common.UnmarshalReply(body)
+	if err != nil {
+		rec.Note = err.Error()
+		return
+	}
+	rec.Status, rec.Data = &rep.Status, rep.Data
+}
+
+// tapWriter appends records to a capture file; the relay's goroutines
+// share one.
+type tapWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newTapWriter(w io.Writer) *tapWriter {
+	return &tapWriter{enc: json.NewEncoder(w)}
+}
+
+// Write stores one record. Each record is a single write, so a capture cut
+// short by Ctrl-C still ends in a whole line.
+func (t *tapWriter) Write(rec Record) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.enc.Encode(rec)
+}
+
+// ReadCapture reads a capture file written by the relay. Blank lines are
+// skipped; anything else that is not a record is an error naming its line.
+func ReadCapture(r io.Reader) ([]Record, error) {
+	var recs []Record
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxRecordLine)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if rec.Dir != DirClient && rec.Dir != DirServer {
+			return nil, fmt.Errorf("line %d: unknown direction %q", line, rec.Dir)
+		}
+		if len(rec.Packet) == 0 {
+			return nil, fmt.Errorf("line %d: no packet", line)
+		}
+		recs = append(recs, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+var testKey = []byte("tap-test-key")
+
+// requestPacket is req as a client sends it, sealed with sec.
+func requestPacket(t *testing.T, req common.RequestMessage, sec common.PacketSecurity) []byte {
+	t.Helper()
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = sec.Seal(raw); err != nil {
+		t.Fatal(err)
+	}
+	return common.PrefixLength(raw)
+}
+
+// replyPacket is rep as a server sends it, sealed with sec.
+func replyPacket(t *testing.T, rep common.ReplyMessage, sec common.PacketSecurity) []byte {
+	t.Helper()
+	raw, err := common.MarshalReply(rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = sec.Seal(raw); err != nil {
+		t.Fatal(err)
+	}
+	return common.PrefixLength(raw)
+}
+
+func bookRequest(id uint64) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpBookFacility, RequestID: id, FacilityName: "RoomA",
+		StartDay: 0, StartHour: 9, EndDay: 0, EndHour: 10}
+}
+
+func bookReply(id uint64, status int32, data string) common.ReplyMessage {
+	return common.ReplyMessage{RequestID: id, OpCode: common.OpBookFacility, Status: status, Data: data}
+}
+
+func TestAnnotate(t *testing.T) {
+	plain := common.PacketSecurity{}
+	signed := common.PacketSecurity{Key: testKey}
+	sealed := common.PacketSecurity{Key: testKey, Encrypt: true}
+	tests := []struct {
+		name   string
+		dir    string
+		packet []byte
+		key    []byte
+		status int32 // -1 for no status
+		data   string
+		note   string
+	}{
+		{"request", DirClient, requestPacket(t, bookRequest(7), plain), nil, -1, "", ""},
+		{"reply", DirServer, replyPacket(t, bookReply(7, 0, "Booked"), plain), nil, 0, "Booked", ""},
+		{"signed, no key", DirServer, replyPacket(t, bookReply(7, 1, "Time conflict"), signed), nil, 1, "Time conflict", ""},
+		{"signed, key", DirServer, replyPacket(t, bookReply(7, 1, "Time conflict"), signed), testKey, 1, "Time conflict", ""},
+		{"encrypted, no key", DirServer, replyPacket(t, bookReply(7, 0, "Booked"), sealed), nil, -1, "", "encrypted; pass -authKey"},
+		{"encrypted, key", DirServer, replyPacket(t, bookReply(7, 0, "Booked"), sealed), testKey, 0, "Booked", ""},
+		{"encrypted, wrong key", DirClient, requestPacket(t, bookRequest(7), sealed), []byte("other"), -1, "", "MAC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := Record{Dir: tt.dir, Packet: tt.packet}
+			annotate(&rec, tt.key)
+			if rec.Op != "BookFacility" || rec.RequestID != 7 {
+				t.Errorf("header read as %s %d", rec.Op, rec.RequestID)
+			}
+			if tt.status < 0 {
+				if rec.Status != nil {
+					t.Errorf("status %d for an unread packet", *rec.Status)
+				}
+			} else if rec.Status == nil || *rec.Status != tt.status || rec.Data != tt.data {
+				t.Errorf("annotated %+v, want status %d %q", rec, tt.status, tt.data)
+			}
+			if tt.note == "" && rec.Note != "" || !strings.Contains(rec.Note, tt.note) {
+				t.Errorf("note %q, want %q", rec.Note, tt.note)
+			}
+		})
+	}
+}
+
+func TestAnnotateUnreadable(t *testing.T) {
+	whole := requestPacket(t, bookRequest(7), common.PacketSecurity{})
+	raw, _ := common.MarshalRequest(bookRequest(7))
+	tests := []struct {
+		name   string
+		packet []byte
+		note   string
+	}{
+		{"no prefix", []byte{0, 1}, "no length prefix"},
+		{"truncated", whole[:len(whole)-3], "truncated"},
+		{"no magic", common.PrefixLength([]byte("hello, server")), "header not readable"},
+		{"short body", common.PrefixLength(raw[:len(raw)-3]), "not enough bytes for booking times"},
+	}
+	for _, tt := range tests {
+		rec := Record{Dir: DirClient, Packet: tt.packet}
+		annotate(&rec, nil)
+		if !strings.Contains(rec.Note, tt.note) {
+			t.Errorf("%s: note %q, want %q", tt.name, rec.Note, tt.note)
+		}
+	}
+}
+
+// TestCaptureFileRoundTrip writes records as the relay does and reads them
+// back: one JSON object per line, packets intact.
+func TestCaptureFileRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 123456789, time.UTC)
+	ok := int32(0)
+	recs := []Record{
+		{Time: at, Dir: DirClient, Client: "127.0.0.1:5000", Op: "BookFacility", RequestID: 7,
+			Packet: requestPacket(t, bookRequest(7), common.PacketSecurity{})},
+		{Time: at.Add(time.Millisecond), Dir: DirServer, Client: "127.0.0.1:5000", Op: "BookFacility", RequestID: 7,
+			Status: &ok, Data: "Booked.\nID=BKG-1", Packet: replyPacket(t, bookReply(7, 0, "Booked.\nID=BKG-1"), common.PacketSecurity{})},
+		{Time: at.Add(2 * time.Millisecond), Dir: DirClient, Client: "[::1]:6000", Note: "header not readable", Packet: []byte{0, 0, 0, 1, 0xFF}},
+	}
+	var buf bytes.Buffer
+	w := newTapWriter(&buf)
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), "\n"); n != len(recs) {
+		t.Errorf("%d lines for %d records:\n%s", n, len(recs), buf.String())
+	}
+
+	got, err := ReadCapture(strings.NewReader("\n" + strings.ReplaceAll(buf.String(), "\n", "\n\n")))
+	if err != nil {
+		t.Fatalf("ReadCapture: %v", err)
+	}
+	if !reflect.DeepEqual(got, recs) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, recs)
+	}
+}
+
+func TestReadCaptureErrors(t *testing.T) {
+	good := `{"time":"2026-03-02T09:00:00Z","dir":"client","client":"c","packet":"AAAAAQ=="}`
+	tests := []struct {
+		in, err string
+	}{
+		{good + "\nnot json\n", "line 2:"},
+		{`{"dir":"sideways","packet":"AA=="}`, `line 1: unknown direction "sideways"`},
+		{`{"dir":"server"}`, "line 1: no packet"},
+		{good + "\n\n" + `{"dir":"client","packet":"!!"}`, "line 3:"},
+		{strings.Repeat("x", maxRecordLine+1), "too long"},
+	}
+	for _, tt := range tests {
+		_, err := ReadCapture(strings.NewReader(tt.in))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ReadCapture(%.40q...) error %v, want %q", tt.in, err, tt.err)
+		}
+	}
+	if recs, err := ReadCapture(strings.NewReader("")); err != nil || len(recs) != 0 {
+		t.Errorf("empty capture: %v, %v", recs, err)
+	}
+}
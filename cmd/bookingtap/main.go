@@ -0,0 +1,129 @@
+// Command bookingtap records a client's session with a booking server and
+// plays it back, to chase interoperability problems between versions.
+//
+//	bookingtap capture -listen :2224 -target localhost:2222 -out session.tap
+//	bookingtap replay -in session.tap -target localhost:2222 -speed 0
+//
+// In capture mode it is a transparent UDP relay: point the client at
+// -listen and every datagram in either direction is written to -out. In
+// replay mode it sends the recorded client packets to -target and reports
+// every reply that differs from the recording.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "capture":
+		capture(os.Args[2:])
+	case "replay":
+		replayCapture(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bookingtap capture|replay [flags]; bookingtap <mode> -h lists the flags")
+	os.Exit(2)
+}
+
+func capture(args []string) {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	listen := fs.String("listen", ":2224", "UDP address clients send to")
+	target := fs.String("target", "localhost:2222", "Server address packets are relayed to")
+	out := fs.String("out", "session.tap", "Capture file to write, one JSON record per line")
+	authKey := fs.String("authKey", "", "The session's -authKey, to annotate authenticated and encrypted packets (optional)")
+	fs.Parse(args)
+
+	targetAddr, err := net.ResolveUDPAddr("udp", *target)
+	if err != nil {
+		log.Fatalf("Resolving -target: %v", err)
+	}
+	listenAddr, err := net.ResolveUDPAddr("udp", *listen)
+	if err != nil {
+		log.Fatalf("Resolving -listen: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", listenAddr)
+	if err != nil {
+		log.Fatalf("Listening on %s: %v", *listen, err)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Creating capture: %v", err)
+	}
+	defer f.Close()
+
+	log.Printf("Relaying %s to %s, capturing into %s", conn.LocalAddr(), targetAddr, *out)
+	r := &relay{
+		conn:     conn,
+		target:   targetAddr,
+		out:      newTapWriter(f),
+		key:      []byte(*authKey),
+		upstream: make(map[string]*net.UDPConn),
+	}
+	log.Fatalf("Relay stopped: %v", r.run())
+}
+
+func replayCapture(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	in := fs.String("in", "session.tap", "Capture file to replay")
+	target := fs.String("target", "localhost:2222", "Server to send the client packets to")
+	speed := fs.Float64("speed", 1, "Timing: 1 = as recorded, 10 = ten times faster, 0 = back to back")
+	wait := fs.Duration("wait", 2*time.Second, "How long to wait for replies after the last packet")
+	ignoreFlag := fs.String("ignore", "", "Regular expression for reply text that may differ, e.g. 'BKG-[0-9]+|Seq=[0-9]+'")
+	authKey := fs.String("authKey", "", "The session's -authKey, to compare encrypted replies (optional)")
+	fs.Parse(args)
+	if *speed < 0 {
+		log.Fatalf("-speed must not be negative")
+	}
+	var ignore *regexp.Regexp
+	if *ignoreFlag != "" {
+		var err error
+		if ignore, err = regexp.Compile(*ignoreFlag); err != nil {
+			log.Fatalf("-ignore: %v", err)
+		}
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	recorded, err := ReadCapture(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Reading %s: %v", *in, err)
+	}
+
+	sent := 0
+	for _, rec := range recorded {
+		if rec.Dir == DirClient {
+			sent++
+		}
+	}
+	log.Printf("Replaying %d client packets from %s to %s", sent, *in, *target)
+	replayed, err := replay(recorded, *target, *speed, *wait, []byte(*authKey))
+	if err != nil {
+		log.Fatalf("Replay: %v", err)
+	}
+
+	diffs := Compare(recorded, replayed, ignore)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	fmt.Printf("%d packets sent, %d replies received, %d differences\n", sent, len(replayed), len(diffs))
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
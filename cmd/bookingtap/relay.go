@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxDatagram is the largest UDP payload the relay forwards.
+const maxDatagram = 65535
+
+// relay forwards datagrams between clients and one server, recording each
+// in both directions. Every client gets its own socket towards the server,
+// so replies and callbacks find their way back to the client that caused
+// them and the server sees one peer per client, as without the relay.
+type relay struct {
+	conn   *net.UDPConn // clients talk to this socket
+	target *net.UDPAddr
+	out    *tapWriter
+	key    []byte // -authKey, only to annotate packets
+
+	mu       sync.Mutex
+	upstream map[string]*net.UDPConn // client address -> socket to the server
+}
+
+// run forwards client packets until the listening socket fails.
+func (r *relay) run() error {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, client, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		r.record(DirClient, client, packet)
+
+		up, err := r.upstreamFor(client)
+		if err != nil {
+			log.Printf("Opening a socket to %s for %s: %v", r.target, client, err)
+			continue
+		}
+		if _, err := up.Write(packet); err != nil {
+			log.Printf("Forwarding %d bytes from %s: %v", n, client, err)
+		}
+	}
+}
+
+// upstreamFor returns the client's socket towards the server, opening it
+// and starting its reader on the client's first packet.
+func (r *relay) upstreamFor(client *net.UDPAddr) (*net.UDPConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if up, ok := r.upstream[client.String()]; ok {
+		return up, nil
+	}
+	up, err := net.DialUDP("udp", nil, r.target)
+	if err != nil {
+		return nil, err
+	}
+	r.upstream[client.String()] = up
+	log.Printf("New client %s, relayed from %s", client, up.LocalAddr())
+	go r.fromServer(client, up)
+	return up, nil
+}
+
+// fromServer forwards everything the server sends on up to client.
+func (r *relay) fromServer(client *net.UDPAddr, up *net.UDPConn) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := up.Read(buf)
+		if err != nil {
+			// A refused port shows up as a read error on a connected
+			// socket; the server may come back.
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				continue
+			}
+			log.Printf("Reading from the server for %s: %v", client, err)
+			return
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		r.record(DirServer, client, packet)
+		if _, err := r.conn.WriteToUDP(packet, client); err != nil {
+			log.Printf("Forwarding %d bytes to %s: %v", n, client, err)
+		}
+	}
+}
+
+func (r *relay) record(dir string, client *net.UDPAddr, packet []byte) {
+	rec := Record{Time: time.Now(), Dir: dir, Client: client.String(), Packet: packet}
+	annotate(&rec, r.key)
+	if err := r.out.Write(rec); err != nil {
+		log.Printf("Writing capture: %v", err)
+	}
+}
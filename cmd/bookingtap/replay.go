@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// replay sends the client packets of a capture to target, each original
+// client from a socket of its own, and returns what the server sent back,
+// recorded under the original client addresses. speed scales the gaps
+// between packets: 1 keeps the original timing, 10 plays ten times faster,
+// 0 sends back to back. After the last packet it waits for late replies.
+func replay(recs []Record, target string, speed float64, wait time.Duration, key []byte) ([]Record, error) {
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		replayed []Record
+		readers  sync.WaitGroup
+	)
+	sockets := make(map[string]*net.UDPConn)
+	defer func() {
+		for _, c := range sockets {
+			c.Close()
+		}
+		readers.Wait()
+	}()
+
+	var t0 time.Time
+	start := time.Now()
+	for _, rec := range recs {
+		if rec.Dir != DirClient {
+			continue
+		}
+		if t0.IsZero() {
+			t0 = rec.Time
+		}
+		if speed > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(rec.Time.Sub(t0)) / speed))))
+		}
+
+		c, ok := sockets[rec.Client]
+		if !ok {
+			if c, err = net.DialUDP("udp", nil, addr); err != nil {
+				return nil, err
+			}
+			sockets[rec.Client] = c
+			readers.Add(1)
+			go func(client string, c *net.UDPConn) {
+				defer readers.Done()
+				buf := make([]byte, maxDatagram)
+				for {
+					n, err := c.Read(buf)
+					if errors.Is(err, syscall.ECONNREFUSED) {
+						continue
+					}
+					if err != nil {
+						return
+					}
+					got := Record{Time: time.Now(), Dir: DirServer, Client: client, Packet: append([]byte(nil), buf[:n]...)}
+					annotate(&got, key)
+					mu.Lock()
+					replayed = append(replayed, got)
+					mu.Unlock()
+				}
+			}(rec.Client, c)
+		}
+		if _, err := c.Write(rec.Packet); err != nil {
+			log.Printf("Sending RequestID %d of %s: %v", rec.RequestID, rec.Client, err)
+		}
+	}
+	time.Sleep(wait)
+
+	for client, c := range sockets {
+		c.Close()
+		delete(sockets, client)
+	}
+	readers.Wait()
+	return replayed, nil
+}
+
+// Difference is a reply that did not come back the way it was recorded.
+type Difference struct {
+	Client    string
+	RequestID uint64
+	Op        string
+	Recorded  string
+	Replayed  string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s RequestID %d (%s): recorded %s, replayed %s",
+		d.Client, d.RequestID, d.Op, d.Recorded, d.Replayed)
+}
+
+// replyKey matches replies across captures: a RequestID is only unique
+// for one client.
+type replyKey struct {
+	client string
+	id     uint64
+}
+
+// Compare matches the replies of two captures by client and RequestID, in
+// the order they arrived, and returns those that differ, are missing or
+// are new, in the order of the recorded capture. Readable replies are
+// compared by status and text, with text matching ignore (if not nil)
+// masked in both, such as generated IDs; others are compared byte for byte.
+// Callbacks depend on what other clients did and when, so they are left
+// out.
+func Compare(recorded, replayed []Record, ignore *regexp.Regexp) []Difference {
+	want, order := groupReplies(recorded)
+	got, extra := groupReplies(replayed)
+	for _, k := range extra {
+		if _, ok := want[k]; !ok {
+			order = append(order, k)
+		}
+	}
+
+	var diffs []Difference
+	for _, k := range order {
+		w, g := want[k], got[k]
+		for i := 0; i < max(len(w), len(g)); i++ {
+			d := Difference{Client: k.client, RequestID: k.id, Recorded: "no reply", Replayed: "no reply"}
+			if i < len(w) {
+				d.Op, d.Recorded = w[i].Op, describeReply(w[i])
+			}
+			if i < len(g) {
+				d.Op, d.Replayed = g[i].Op, describeReply(g[i])
+			}
+			if i < len(w) && i < len(g) && sameReply(w[i], g[i], ignore) {
+				continue
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+// groupReplies collects the server's replies by client and RequestID,
+// returning the keys in the order they first appear.
+func groupReplies(recs []Record) (map[replyKey][]Record, []replyKey) {
+	groups := make(map[replyKey][]Record)
+	var order []replyKey
+	for _, rec := range recs {
+		if rec.Dir != DirServer || rec.Op == common.OpName(common.OpCallback) {
+			continue
+		}
+		k := replyKey{rec.Client, rec.RequestID}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], rec)
+	}
+	return groups, order
+}
+
+func sameReply(a, b Record, ignore *regexp.Regexp) bool {
+	if a.Status != nil && b.Status != nil {
+		if ignore != nil {
+			return *a.Status == *b.Status && ignore.ReplaceAllString(a.Data, "") == ignore.ReplaceAllString(b.Data, "")
+		}
+		return *a.Status == *b.Status && a.Data == b.Data
+	}
+	return bytes.Equal(a.Packet, b.Packet)
+}
+
+func describeReply(rec Record) string {
+	switch {
+	case rec.Status != nil:
+		return fmt.Sprintf("status %d %q", *rec.Status, rec.Data)
+	case rec.Note != "":
+		return fmt.Sprintf("%d unreadable bytes (%s)", len(rec.Packet), rec.Note)
+	default:
+		return fmt.Sprintf("%d bytes", len(rec.Packet))
+	}
+}
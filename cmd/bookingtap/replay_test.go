@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// reply is a readable server record for client.
+func reply(client string, id uint64, status int32, data string) Record {
+	return Record{Dir: DirServer, Client: client, Op: "BookFacility", RequestID: id, Status: &status, Data: data}
+}
+
+func TestCompare(t *testing.T) {
+	callback := Record{Dir: DirServer, Client: "a", Op: common.OpName(common.OpCallback), Packet: []byte{1}}
+	ids := regexp.MustCompile(`BKG-\d+`)
+	tests := []struct {
+		name               string
+		recorded, replayed []Record
+		ignore             *regexp.Regexp
+		want               []string
+	}{
+		{"same", []Record{reply("a", 1, 0, "ok")}, []Record{reply("a", 1, 0, "ok")}, nil, nil},
+		{"status", []Record{reply("a", 1, 0, "ok")}, []Record{reply("a", 1, 1, "ok")},
+			nil, []string{`a RequestID 1 (BookFacility): recorded status 0 "ok", replayed status 1 "ok"`}},
+		{"text", []Record{reply("a", 1, 0, "ID=BKG-1")}, []Record{reply("a", 1, 0, "ID=BKG-2")},
+			nil, []string{`recorded status 0 "ID=BKG-1", replayed status 0 "ID=BKG-2"`}},
+		{"masked text", []Record{reply("a", 1, 0, "ID=BKG-1")}, []Record{reply("a", 1, 0, "ID=BKG-2")}, ids, nil},
+		{"masked text still differs", []Record{reply("a", 1, 0, "Booked ID=BKG-1")}, []Record{reply("a", 1, 0, "Moved ID=BKG-2")},
+			ids, []string{`recorded status 0 "Booked ID=BKG-1"`}},
+		{"missing", []Record{reply("a", 1, 0, "ok"), reply("a", 2, 0, "ok")}, []Record{reply("a", 1, 0, "ok")},
+			nil, []string{`a RequestID 2 (BookFacility): recorded status 0 "ok", replayed no reply`}},
+		{"new", []Record{reply("a", 1, 0, "ok")}, []Record{reply("a", 1, 0, "ok"), reply("a", 3, 0, "ok")},
+			nil, []string{`a RequestID 3 (BookFacility): recorded no reply, replayed status 0 "ok"`}},
+		{"second reply missing", []Record{reply("a", 1, 0, "ok"), reply("a", 1, 0, "ok")}, []Record{reply("a", 1, 0, "ok")},
+			nil, []string{"recorded status 0 \"ok\", replayed no reply"}},
+		{"clients kept apart", []Record{reply("a", 1, 0, "ok"), reply("b", 1, 1, "no")}, []Record{reply("b", 1, 1, "no"), reply("a", 1, 0, "ok")}, nil, nil},
+		{"swapped between clients", []Record{reply("a", 1, 0, "ok"), reply("b", 1, 1, "no")}, []Record{reply("a", 1, 1, "no"), reply("b", 1, 0, "ok")},
+			nil, []string{"a RequestID 1", "b RequestID 1"}},
+		{"callbacks ignored", []Record{callback, reply("a", 1, 0, "ok")}, []Record{reply("a", 1, 0, "ok")}, nil, nil},
+		{"client packets ignored", []Record{{Dir: DirClient, Client: "a", RequestID: 1}, reply("a", 1, 0, "ok")}, []Record{reply("a", 1, 0, "ok")}, nil, nil},
+		{"unreadable same bytes", []Record{{Dir: DirServer, Client: "a", RequestID: 1, Note: "encrypted", Packet: []byte{1, 2}}},
+			[]Record{{Dir: DirServer, Client: "a", RequestID: 1, Note: "encrypted", Packet: []byte{1, 2}}}, nil, nil},
+		{"unreadable other bytes", []Record{{Dir: DirServer, Client: "a", RequestID: 1, Note: "encrypted", Packet: []byte{1, 2}}},
+			[]Record{{Dir: DirServer, Client: "a", RequestID: 1, Note: "encrypted", Packet: []byte{1, 3}}},
+			nil, []string{"recorded 2 unreadable bytes (encrypted), replayed 2 unreadable bytes (encrypted)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := Compare(tt.recorded, tt.replayed, tt.ignore)
+			if len(diffs) != len(tt.want) {
+				t.Fatalf("differences %v, want %d", diffs, len(tt.want))
+			}
+			for i, d := range diffs {
+				if !strings.Contains(d.String(), tt.want[i]) {
+					t.Errorf("difference %q, want %q", d, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// startServer answers every request on a local UDP socket with answer's
+// reply to it.
+func startServer(t *testing.T, answer func(common.RequestMessage) common.ReplyMessage) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			payload, _, err := common.SplitLength(buf[:n])
+			if err != nil {
+				continue
+			}
+			req, err := common.UnmarshalRequest(payload)
+			if err != nil {
+				continue
+			}
+			raw, _ := common.MarshalReply(answer(req))
+			conn.WriteToUDP(common.PrefixLength(raw), from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// TestReplay plays a synthetic capture of two clients with the same
+// RequestIDs to a server that answers as recorded, then to one that does
+// not.
+func TestReplay(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	var recs []Record
+	for i, client := range []string{"10.0.0.1:4000", "10.0.0.2:4000"} {
+		for id := uint64(1); id <= 2; id++ {
+			recs = append(recs,
+				Record{Time: at.Add(time.Duration(i*10+int(id)) * time.Millisecond), Dir: DirClient, Client: client, RequestID: id,
+					Packet: requestPacket(t, bookRequest(id), common.PacketSecurity{})},
+				reply(client, id, 0, "Booked"))
+		}
+	}
+
+	booked := startServer(t, func(req common.RequestMessage) common.ReplyMessage {
+		return bookReply(req.RequestID, 0, "Booked")
+	})
+	start := time.Now()
+	replayed, err := replay(recs, booked, 1, 100*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if took := time.Since(start); took < 110*time.Millisecond {
+		t.Errorf("replay at the original timing took %v", took)
+	}
+	if len(replayed) != 4 {
+		t.Fatalf("%d replies, want 4: %+v", len(replayed), replayed)
+	}
+	if diffs := Compare(recs, replayed, nil); len(diffs) != 0 {
+		t.Errorf("differences against a server answering as recorded: %v", diffs)
+	}
+
+	conflict := startServer(t, func(req common.RequestMessage) common.ReplyMessage {
+		if req.RequestID == 2 {
+			return bookReply(2, 1, "Time conflict")
+		}
+		return bookReply(req.RequestID, 0, "Booked")
+	})
+	replayed, err = replay(recs, conflict, 0, 100*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	diffs := Compare(recs, replayed, nil)
+	if len(diffs) != 2 || diffs[0].Client != "10.0.0.1:4000" || diffs[1].Client != "10.0.0.2:4000" {
+		t.Fatalf("differences %v, want RequestID 2 of each client", diffs)
+	}
+	for _, d := range diffs {
+		if d.RequestID != 2 || d.Replayed != `status 1 "Time conflict"` {
+			t.Errorf("difference %v", d)
+		}
+	}
+}
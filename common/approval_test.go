@@ -0,0 +1,29 @@
+package common
+
+import "testing"
+
+func TestApprovalRoundTrip(t *testing.T) {
+	for _, req := range []RequestMessage{
+		{OpCode: OpApproveBooking, RequestID: 7, ConfirmationID: "BKG-10000"},
+		{OpCode: OpRejectBooking, RequestID: 8, ConfirmationID: "BKG-10000", Reason: "exam week"},
+		{OpCode: OpRejectBooking, RequestID: 9, ConfirmationID: "BKG-10000"},
+	} {
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest %s: %v", OpName(req.OpCode), err)
+		}
+		got, err := UnmarshalRequest(raw)
+		if err != nil {
+			t.Fatalf("UnmarshalRequest %s: %v", OpName(req.OpCode), err)
+		}
+		if got.ConfirmationID != req.ConfirmationID || got.Reason != req.Reason {
+			t.Errorf("%s read back as %+v", OpName(req.OpCode), got)
+		}
+		if _, err := UnmarshalRequest(raw[:len(raw)-1]); err == nil {
+			t.Errorf("cut %s accepted", OpName(req.OpCode))
+		}
+	}
+	if !IsPrivileged(OpApproveBooking) || !IsPrivileged(OpRejectBooking) {
+		t.Error("approval decisions are not admin-only")
+	}
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// Header flag bits, stored in the byte that follows the RequestID.
+const (
+	FlagAuthenticated = 1 << 0 // packet ends with an HMAC-SHA256 trailer
+	FlagSession       = 1 << 3 // a session token string follows the flags byte
+)
+
+// flagsOffset is the position of the flags byte: Magic(2) + OpCode(1) +
+// RequestID(8).
+const flagsOffset = MagicSize + 9
+
+// MACSize is the length of the HMAC-SHA256 trailer.
+const MACSize = sha256.Size
+
+var (
+	// ErrMissingMAC: a key is configured but the packet carries no MAC.
+	ErrMissingMAC = errors.New("packet is not authenticated; the peer is not using -authKey")
+	// ErrUnexpectedMAC: the packet carries a MAC but no key is configured.
+	ErrUnexpectedMAC = errors.New("packet is authenticated but no -authKey is configured")
+	// ErrBadMAC: the MAC does not match (wrong key or tampered packet).
+	ErrBadMAC = errors.New("packet failed HMAC verification")
+)
+
+// SignPacket marks a marshaled request or reply as authenticated and appends
+// an HMAC-SHA256 over the whole packet, including the OpCode and RequestID,
+// so a MAC cannot be spliced onto a different request. With an empty key the
+// packet is returned unchanged.
+func SignPacket(key, packet []byte) []byte {
+	if len(key) == 0 || len(packet) <= flagsOffset {
+		return packet
+	}
+	out := make([]byte, len(packet), len(packet)+MACSize)
+	copy(out, packet)
+	out[flagsOffset] |= FlagAuthenticated
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(out)
+	return mac.Sum(out)
+}
+
+// VerifyPacket checks and strips the MAC trailer. With an empty key it only
+// confirms that the packet is not authenticated.
+func VerifyPacket(key, packet []byte) ([]byte, error) {
+	if len(packet) <= flagsOffset {
+		// Too short to carry flags; let unmarshalling report it.
+		return packet, nil
+	}
+	authed := packet[flagsOffset]&FlagAuthenticated != 0
+	switch {
+	case len(key) == 0 && authed:
+		return nil, ErrUnexpectedMAC
+	case len(key) == 0:
+		return packet, nil
+	case !authed:
+		return nil, ErrMissingMAC
+	case len(packet) < flagsOffset+1+MACSize:
+		return nil, ErrBadMAC
+	}
+
+	body := packet[:len(packet)-MACSize]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), packet[len(packet)-MACSize:]) {
+		return nil, ErrBadMAC
+	}
+	return body, nil
+}
+
+// StripMAC removes an HMAC trailer without checking it, so that a peer
+// without the key can still read the header to report the mismatch.
+func StripMAC(packet []byte) []byte {
+	if len(packet) > flagsOffset+MACSize && packet[flagsOffset]&FlagAuthenticated != 0 {
+		return packet[:len(packet)-MACSize]
+	}
+	return packet
+}
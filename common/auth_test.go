@@ -0,0 +1,97 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func marshaledBooking(t *testing.T) []byte {
+	t.Helper()
+	raw, err := MarshalRequest(RequestMessage{
+		OpCode:       OpBookFacility,
+		RequestID:    42,
+		FacilityName: "RoomA",
+		StartHour:    9,
+		EndHour:      10,
+	})
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	return raw
+}
+
+func TestVerifyPacket(t *testing.T) {
+	key := []byte("secret")
+	raw := marshaledBooking(t)
+	signed := SignPacket(key, raw)
+
+	tampered := append([]byte(nil), signed...)
+	tampered[flagsOffset+3] ^= 0x01 // a body byte, covered by the MAC
+
+	badTrailer := append([]byte(nil), signed...)
+	badTrailer[len(badTrailer)-1] ^= 0x80
+
+	tests := []struct {
+		name    string
+		key     []byte
+		packet  []byte
+		wantErr error
+	}{
+		{"valid", key, signed, nil},
+		{"plaintext without a key", nil, raw, nil},
+		{"tampered body", key, tampered, ErrBadMAC},
+		{"tampered MAC", key, badTrailer, ErrBadMAC},
+		{"wrong key", []byte("other"), signed, ErrBadMAC},
+		{"missing MAC", key, raw, ErrMissingMAC},
+		{"unexpected MAC", nil, signed, ErrUnexpectedMAC},
+		{"truncated MAC", key, signed[:flagsOffset+4], ErrBadMAC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := VerifyPacket(tt.key, tt.packet)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			req, err := UnmarshalRequest(body)
+			if err != nil {
+				t.Fatalf("UnmarshalRequest: %v", err)
+			}
+			if req.RequestID != 42 || req.FacilityName != "RoomA" {
+				t.Errorf("verified packet decodes to %+v", req)
+			}
+		})
+	}
+}
+
+func TestSignPacketCoversHeader(t *testing.T) {
+	key := []byte("secret")
+	signed := SignPacket(key, marshaledBooking(t))
+	if signed[flagsOffset]&FlagAuthenticated == 0 {
+		t.Fatal("signed packet does not set FlagAuthenticated")
+	}
+
+	// A MAC cannot be moved to another RequestID
+	spliced := append([]byte(nil), signed...)
+	spliced[flagsOffset-1]++
+	if _, err := VerifyPacket(key, spliced); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("changed RequestID: err = %v, want ErrBadMAC", err)
+	}
+}
+
+func TestStripMAC(t *testing.T) {
+	raw := marshaledBooking(t)
+	signed := SignPacket([]byte("secret"), raw)
+	stripped := StripMAC(signed)
+	if len(stripped) != len(raw) {
+		t.Fatalf("StripMAC left %d bytes, want %d", len(stripped), len(raw))
+	}
+	if op, id, ok := PeekHeader(stripped); !ok || op != OpBookFacility || id != 42 {
+		t.Errorf("PeekHeader after StripMAC = %d, %d, %v", op, id, ok)
+	}
+	if got := StripMAC(raw); len(got) != len(raw) {
+		t.Errorf("StripMAC changed an unsigned packet")
+	}
+}
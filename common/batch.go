@@ -0,0 +1,112 @@
+package common
+
+import "fmt"
+
+// MaxBatchEntries is the largest number of requests one OpBatch may carry.
+// The envelope is also subject to the server's -maxRequestSize.
+const MaxBatchEntries = 64
+
+// appendBatch encodes the entries of an OpBatch request or reply: a 1-byte
+// count followed by each marshaled message as a 2-byte length + bytes.
+func appendBatch(buf []byte, entries [][]byte) ([]byte, error) {
+	if len(entries) > MaxBatchEntries {
+		return nil, fmt.Errorf("too many batch entries (max %d)", MaxBatchEntries)
+	}
+	buf = append(buf, byte(len(entries)))
+	for _, e := range entries {
+		if len(e) > 0xFFFF {
+			return nil, fmt.Errorf("batch entry of %d bytes is too large", len(e))
+		}
+		buf = writeString(buf, string(e))
+	}
+	return buf, nil
+}
+
+// readBatch decodes the entries written by appendBatch.
+func readBatch(data []byte, offset int) ([][]byte, int, error) {
+	if offset+1 > len(data) {
+		return nil, offset, fmt.Errorf("not enough bytes for batch count")
+	}
+	n := int(data[offset])
+	offset++
+	if n > MaxBatchEntries {
+		return nil, offset, fmt.Errorf("too many batch entries (%d, max %d)", n, MaxBatchEntries)
+	}
+	entries := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		e, newOffset, err := readString(data, offset)
+		if err != nil {
+			return nil, offset, fmt.Errorf("batch entry %d: %w", i, err)
+		}
+		entries = append(entries, []byte(e))
+		offset = newOffset
+	}
+	return entries, offset, nil
+}
+
+// marshalBatchRequests encodes the sub-requests of an OpBatch. Entries carry
+// no timestamp, session, semantics hint, capabilities or other extensions of
+// their own: the envelope's applies to all of them.
+func marshalBatchRequests(buf []byte, reqs []RequestMessage) ([]byte, error) {
+	entries := make([][]byte, 0, len(reqs))
+	for i, r := range reqs {
+		if r.OpCode == OpBatch || r.OpCode == OpPing || r.OpCode == OpHello {
+			return nil, fmt.Errorf("batch entry %d: %s cannot be batched", i, OpName(r.OpCode))
+		}
+		r.Flags, r.Timestamp, r.SessionToken, r.Semantics, r.Capabilities = 0, 0, "", HintServerDefault, 0
+		r.Extensions = nil
+		e, err := MarshalRequest(r)
+		if err != nil {
+			return nil, fmt.Errorf("batch entry %d: %w", i, err)
+		}
+		entries = append(entries, e)
+	}
+	return appendBatch(buf, entries)
+}
+
+func unmarshalBatchRequests(data []byte, offset int) ([]RequestMessage, int, error) {
+	entries, offset, err := readBatch(data, offset)
+	if err != nil {
+		return nil, offset, err
+	}
+	reqs := make([]RequestMessage, 0, len(entries))
+	for i, e := range entries {
+		r, err := UnmarshalRequest(e)
+		if err != nil {
+			return nil, offset, fmt.Errorf("batch entry %d: %w", i, err)
+		}
+		if r.OpCode == OpBatch || r.OpCode == OpPing || r.OpCode == OpHello || r.Flags != 0 || r.Timestamp != 0 {
+			return nil, offset, fmt.Errorf("batch entry %d: %s with flags %#x cannot be batched", i, OpName(r.OpCode), r.Flags)
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, offset, nil
+}
+
+func marshalBatchReplies(buf []byte, reps []ReplyMessage) ([]byte, error) {
+	entries := make([][]byte, 0, len(reps))
+	for _, r := range reps {
+		e, err := MarshalReply(r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return appendBatch(buf, entries)
+}
+
+func unmarshalBatchReplies(data []byte, offset int) ([]ReplyMessage, int, error) {
+	entries, offset, err := readBatch(data, offset)
+	if err != nil {
+		return nil, offset, err
+	}
+	reps := make([]ReplyMessage, 0, len(entries))
+	for i, e := range entries {
+		r, err := UnmarshalReply(e)
+		if err != nil {
+			return nil, offset, fmt.Errorf("batch reply %d: %w", i, err)
+		}
+		reps = append(reps, r)
+	}
+	return reps, offset, nil
+}
@@ -0,0 +1,167 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchRoundTrip(t *testing.T) {
+	req := RequestMessage{
+		OpCode:    OpBatch,
+		RequestID: 100,
+		Batch: []RequestMessage{
+			{OpCode: OpAddParticipant, RequestID: 101, ConfirmationID: "BKG-10000", ParticipantName: "Ada"},
+			{OpCode: OpQueryAvailability, RequestID: 102, FacilityName: "RoomA", DaysList: []uint8{0, 2}},
+			{OpCode: OpCancelBooking, RequestID: 103, ConfirmationID: "BKG-10001"},
+		},
+	}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if len(got.Batch) != len(req.Batch) {
+		t.Fatalf("%d entries, want %d", len(got.Batch), len(req.Batch))
+	}
+	for i, want := range req.Batch {
+		e := got.Batch[i]
+		if e.OpCode != want.OpCode || e.RequestID != want.RequestID || e.ConfirmationID != want.ConfirmationID ||
+			e.ParticipantName != want.ParticipantName || e.FacilityName != want.FacilityName || !reflect.DeepEqual(e.DaysList, want.DaysList) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want)
+		}
+	}
+
+	rep := ReplyMessage{
+		RequestID: 100,
+		OpCode:    OpBatch,
+		Replies: []ReplyMessage{
+			{RequestID: 101, OpCode: OpAddParticipant, Data: "added"},
+			{RequestID: 102, OpCode: OpQueryAvailability, Data: "free"},
+			{RequestID: 103, OpCode: OpCancelBooking, Status: StatusError, Data: "not found"},
+		},
+	}
+	rawRep, err := MarshalReply(rep)
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	gotRep, err := UnmarshalReply(rawRep)
+	if err != nil {
+		t.Fatalf("UnmarshalReply: %v", err)
+	}
+	if len(gotRep.Replies) != 3 {
+		t.Fatalf("%d replies, want 3", len(gotRep.Replies))
+	}
+	for i, want := range rep.Replies {
+		if e := gotRep.Replies[i]; e.RequestID != want.RequestID || e.Status != want.Status || e.Data != want.Data {
+			t.Errorf("reply %d = %+v, want %+v", i, e, want)
+		}
+	}
+}
+
+// TestBatchEntriesShareTheEnvelope checks per-entry headers are not sent:
+// the envelope's timestamp, session and hint apply to every entry.
+func TestBatchEntriesShareTheEnvelope(t *testing.T) {
+	req := RequestMessage{
+		OpCode:       OpBatch,
+		RequestID:    1,
+		Timestamp:    12345,
+		SessionToken: "token",
+		Batch: []RequestMessage{
+			{OpCode: OpAddParticipant, RequestID: 2, ConfirmationID: "BKG-1", ParticipantName: "Ada", Timestamp: 999, SessionToken: "other", Semantics: HintAtLeastOnce},
+		},
+	}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if e := got.Batch[0]; e.Timestamp != 0 || e.SessionToken != "" || e.Semantics != HintServerDefault {
+		t.Errorf("entry kept its own headers: %+v", e)
+	}
+	if got.Timestamp != 12345 || got.SessionToken != "token" {
+		t.Errorf("envelope headers lost: %+v", got)
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	entry := RequestMessage{OpCode: OpCancelBooking, RequestID: 1, ConfirmationID: "BKG-1"}
+	tooMany := make([]RequestMessage, MaxBatchEntries+1)
+	for i := range tooMany {
+		tooMany[i] = entry
+	}
+	tests := []struct {
+		name  string
+		batch []RequestMessage
+		want  string
+	}{
+		{"too many entries", tooMany, "too many"},
+		{"nested batch", []RequestMessage{{OpCode: OpBatch, RequestID: 2}}, "cannot be batched"},
+		{"ping", []RequestMessage{{OpCode: OpPing, RequestID: 2}}, "cannot be batched"},
+		{"hello", []RequestMessage{{OpCode: OpHello, RequestID: 2}}, "cannot be batched"},
+	}
+	for _, tt := range tests {
+		_, err := MarshalRequest(RequestMessage{OpCode: OpBatch, RequestID: 1, Batch: tt.batch})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	full := make([]RequestMessage, MaxBatchEntries)
+	for i := range full {
+		full[i] = entry
+	}
+	if _, err := MarshalRequest(RequestMessage{OpCode: OpBatch, RequestID: 1, Batch: full}); err != nil {
+		t.Errorf("batch of %d: %v", MaxBatchEntries, err)
+	}
+}
+
+// TestBatchDecodeRejects feeds hand-built envelopes a well-behaved client
+// would never send.
+func TestBatchDecodeRejects(t *testing.T) {
+	envelope := func(entries ...[]byte) []byte {
+		raw, err := MarshalRequest(RequestMessage{OpCode: OpBatch, RequestID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Replace the empty entry list with the given entries
+		raw = raw[:len(raw)-1]
+		raw, err = appendBatch(raw, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	marshal := func(req RequestMessage) []byte {
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	valid := marshal(RequestMessage{OpCode: OpCancelBooking, RequestID: 2, ConfirmationID: "BKG-1"})
+	if _, err := UnmarshalRequest(envelope(valid)); err != nil {
+		t.Fatalf("valid envelope: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"nested batch", envelope(marshal(RequestMessage{OpCode: OpBatch, RequestID: 2}))},
+		{"entry with a timestamp", envelope(marshal(RequestMessage{OpCode: OpCancelBooking, RequestID: 2, ConfirmationID: "BKG-1", Timestamp: 5}))},
+		{"garbage entry", envelope([]byte{0xFF, 0x01})},
+		{"truncated", envelope(valid)[:len(envelope(valid))-3]},
+		{"count past the limit", append(envelope()[:len(envelope())-1], MaxBatchEntries+1)},
+	}
+	for _, tt := range tests {
+		if _, err := UnmarshalRequest(tt.raw); err == nil {
+			t.Errorf("%s: decoded without error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package common
+
+import "fmt"
+
+// Free/busy bitmaps divide each day into 15-minute slots. Slot i covers
+// minutes [15i, 15i+15) after midnight and is bit 7-i%8 of byte i/8, so the
+// first slot of the day is the top bit of the first byte.
+const (
+	SlotMinutes = 15
+	SlotsPerDay = 1440 / SlotMinutes
+)
+
+// DayBitmap holds one bit per slot of a day; a set bit means busy.
+type DayBitmap [SlotsPerDay / 8]byte
+
+// MarkBusy sets every slot that overlaps the minutes [from, to) after
+// midnight, so a slot is busy if any minute of it is booked.
+func (b *DayBitmap) MarkBusy(from, to int) {
+	if from < 0 {
+		from = 0
+	}
+	if to > 1440 {
+		to = 1440
+	}
+	for slot := from / SlotMinutes; slot*SlotMinutes < to; slot++ {
+		b[slot/8] |= 0x80 >> (slot % 8)
+	}
+}
+
+// Busy reports whether slot i is busy.
+func (b DayBitmap) Busy(slot int) bool {
+	return b[slot/8]&(0x80>>(slot%8)) != 0
+}
+
+// DayBusy is the bitmap of one day of the week (0=Monday..6=Sunday).
+type DayBusy struct {
+	Day   uint8
+	Slots DayBitmap
+}
+
+// AppendBusyBitmaps encodes bitmaps for ExtBusyBitmap: a 1-byte count, then
+// per day the day index and its slot bytes.
+func AppendBusyBitmaps(buf []byte, days []DayBusy) ([]byte, error) {
+	if len(days) > 255 {
+		return nil, fmt.Errorf("too many days in bitmap (max 255)")
+	}
+	buf = append(buf, byte(len(days)))
+	for _, d := range days {
+		buf = append(buf, d.Day)
+		buf = append(buf, d.Slots[:]...)
+	}
+	return buf, nil
+}
+
+// ParseBusyBitmaps decodes an ExtBusyBitmap value.
+func ParseBusyBitmaps(raw []byte) ([]DayBusy, error) {
+	if len(raw) < 1 {
+		return nil, fmt.Errorf("empty bitmap")
+	}
+	n := int(raw[0])
+	size := 1 + len(DayBitmap{})
+	if len(raw) != 1+n*size {
+		return nil, fmt.Errorf("bitmap of %d days has %d bytes, want %d", n, len(raw), 1+n*size)
+	}
+	days := make([]DayBusy, n)
+	for i := range days {
+		entry := raw[1+i*size:]
+		days[i].Day = entry[0]
+		copy(days[i].Slots[:], entry[1:size])
+	}
+	return days, nil
+}
+
+// BusyBitmaps returns the bitmaps of a bitmap-mode query reply; ok is false
+// if the reply has none, e.g. from a server without bitmap support.
+func BusyBitmaps(rep ReplyMessage) (days []DayBusy, ok bool, err error) {
+	raw, ok := rep.Extensions.Get(ExtBusyBitmap)
+	if !ok {
+		return nil, false, nil
+	}
+	days, err = ParseBusyBitmaps(raw)
+	return days, true, err
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkBusy(t *testing.T) {
+	tests := []struct {
+		from, to int
+		busy     []int // slots
+	}{
+		{0, 15, []int{0}},
+		{0, 16, []int{0, 1}},
+		{14, 16, []int{0, 1}},
+		{15, 30, []int{1}},
+		{600, 660, []int{40, 41, 42, 43}},
+		{1435, 1440, []int{95}},
+		{-30, 10, []int{0}},
+		{1430, 2000, []int{95}},
+		{60, 60, nil},
+	}
+	for _, tt := range tests {
+		var b DayBitmap
+		b.MarkBusy(tt.from, tt.to)
+		var got []int
+		for slot := 0; slot < SlotsPerDay; slot++ {
+			if b.Busy(slot) {
+				got = append(got, slot)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.busy) {
+			t.Errorf("MarkBusy(%d, %d) set slots %v, want %v", tt.from, tt.to, got, tt.busy)
+		}
+	}
+}
+
+func TestBusyBitmapsRoundTrip(t *testing.T) {
+	var mon, sun DayBitmap
+	mon.MarkBusy(540, 600)
+	sun.MarkBusy(0, 1440)
+	days := []DayBusy{{Day: 0, Slots: mon}, {Day: 6, Slots: sun}}
+	raw, err := AppendBusyBitmaps(nil, days)
+	if err != nil {
+		t.Fatalf("AppendBusyBitmaps: %v", err)
+	}
+	if len(raw) != 1+2*(1+SlotsPerDay/8) {
+		t.Errorf("%d bytes for two days", len(raw))
+	}
+	var rep ReplyMessage
+	rep.Extensions.Put(ExtBusyBitmap, raw)
+	got, ok, err := BusyBitmaps(rep)
+	if !ok || err != nil || !reflect.DeepEqual(got, days) {
+		t.Errorf("round trip gave %+v, %v, %v", got, ok, err)
+	}
+
+	if _, ok, _ := BusyBitmaps(ReplyMessage{}); ok {
+		t.Error("a reply without bitmaps has some")
+	}
+	for _, bad := range [][]byte{{}, {1}, raw[:len(raw)-1], append(raw, 0)} {
+		if _, err := ParseBusyBitmaps(bad); err == nil {
+			t.Errorf("ParseBusyBitmaps accepted %d bytes", len(bad))
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const retryAfterKey = "retry-after="
+
+// BusyData builds the Data of a StatusBusy reply, ending with the number
+// of whole seconds the client should wait before resending.
+func BusyData(after time.Duration, reason string) string {
+	secs := int64((after + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return fmt.Sprintf("Server busy (%s); retry later. %s%d", reason, retryAfterKey, secs)
+}
+
+// ParseRetryAfter extracts the wait from a StatusBusy reply.
+func ParseRetryAfter(data string) (time.Duration, bool) {
+	i := strings.Index(data, retryAfterKey)
+	if i < 0 {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(strings.TrimSpace(data[i+len(retryAfterKey):]))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
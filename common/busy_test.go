@@ -0,0 +1,30 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusyData(t *testing.T) {
+	tests := []struct {
+		after time.Duration
+		want  time.Duration
+	}{
+		{0, time.Second},
+		{time.Second, time.Second},
+		{1500 * time.Millisecond, 2 * time.Second},
+		{10 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		data := BusyData(tt.after, "3 requests in flight")
+		got, ok := ParseRetryAfter(data)
+		if !ok || got != tt.want {
+			t.Errorf("BusyData(%v) = %q, read back as %v, %v; want %v", tt.after, data, got, ok, tt.want)
+		}
+	}
+	for _, data := range []string{"Server busy", "retry-after=soon", "retry-after=-1"} {
+		if got, ok := ParseRetryAfter(data); ok {
+			t.Errorf("ParseRetryAfter(%q) = %v", data, got)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Monitor event types. A callback names its event in ExtCallbackEvent, and
+// a MonitorAvailability request may pass a mask of them in ExtMonitorEvents
+// to receive only those events.
+const (
+	EventCreated     = 1 << 0 // a booking was made
+	EventChanged     = 1 << 1 // a booking was moved
+	EventCanceled    = 1 << 2 // a booking was canceled
+	EventParticipant = 1 << 3 // a participant was added to a booking
+	EventReset       = 1 << 4 // the weekly rollover cleared the schedule
+	EventClosed      = 1 << 5 // the facility was closed for a period
+	EventRenamed     = 1 << 6 // the facility got a new name; sent whatever the mask
+
+	AllEvents = EventCreated | EventChanged | EventCanceled | EventParticipant | EventReset | EventClosed | EventRenamed
+
+	// EventKeepalive marks the empty callbacks the server sends so NAT
+	// mappings stay open. They carry no sequence number, are never filtered
+	// and are not shown.
+	EventKeepalive = 1 << 7
+)
+
+// eventNames are the names ParseEventMask accepts, in mask order.
+var eventNames = []struct {
+	name string
+	bit  uint8
+}{
+	{"created", EventCreated},
+	{"changed", EventChanged},
+	{"canceled", EventCanceled},
+	{"participant", EventParticipant},
+	{"reset", EventReset},
+	{"closed", EventClosed},
+	{"renamed", EventRenamed},
+}
+
+// ParseEventMask reads event names separated by commas or spaces, such as
+// "canceled" or "created,changed". An empty string means all events.
+func ParseEventMask(s string) (uint8, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	if len(fields) == 0 {
+		return AllEvents, nil
+	}
+	var mask uint8
+	for _, f := range fields {
+		bit, ok := uint8(0), false
+		for _, e := range eventNames {
+			if strings.EqualFold(f, e.name) {
+				bit, ok = e.bit, true
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("unknown event %q (use %s)", f, EventMaskString(AllEvents))
+		}
+		mask |= bit
+	}
+	return mask, nil
+}
+
+// EventMaskString lists the events in a mask, comma-separated.
+func EventMaskString(mask uint8) string {
+	names := make([]string, 0, len(eventNames))
+	for _, e := range eventNames {
+		if mask&e.bit != 0 {
+			names = append(names, e.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// CallbackSeq returns the sequence number and facility of a monitor
+// callback. Callbacks from servers that predate sequence numbers have none.
+func CallbackSeq(rep ReplyMessage) (seq uint64, facility string, ok bool) {
+	if seq, ok = rep.Extensions.Uint64(ExtCallbackSeq); !ok {
+		return 0, "", false
+	}
+	facility, ok = rep.Extensions.String(ExtCallbackFacility)
+	return seq, facility, ok
+}
+
+// CallbackAvailability returns the refreshed availability a callback carries
+// for the days its event touched, formatted like a query reply.
+func CallbackAvailability(rep ReplyMessage) (string, bool) {
+	return rep.Extensions.String(ExtCallbackAvail)
+}
+
+// CallbackEvent returns the event type of a callback. Callbacks from servers
+// that predate typed events have none.
+func CallbackEvent(rep ReplyMessage) (uint8, bool) {
+	v, ok := rep.Extensions.Get(ExtCallbackEvent)
+	if !ok || len(v) != 1 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+// IsKeepalive reports whether a callback is a keepalive.
+func IsKeepalive(rep ReplyMessage) bool {
+	event, ok := CallbackEvent(rep)
+	return ok && event == EventKeepalive
+}
@@ -0,0 +1,39 @@
+package common
+
+import "testing"
+
+func TestParseEventMask(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint8
+		wantErr bool
+	}{
+		{in: "", want: AllEvents},
+		{in: " , ", want: AllEvents},
+		{in: "canceled", want: EventCanceled},
+		{in: "Created, CHANGED", want: EventCreated | EventChanged},
+		{in: "canceled canceled", want: EventCanceled},
+		{in: "participant,reset closed", want: EventParticipant | EventReset | EventClosed},
+		{in: "cancelled", wantErr: true},
+		{in: "created,booked", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEventMask(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEventMask(%q) = %#x, %v, want %#x", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestEventMaskString(t *testing.T) {
+	if got := EventMaskString(EventCanceled | EventCreated); got != "created,canceled" {
+		t.Errorf("EventMaskString = %q", got)
+	}
+	if got := EventMaskString(0); got != "" {
+		t.Errorf("EventMaskString(0) = %q", got)
+	}
+	mask, err := ParseEventMask(EventMaskString(AllEvents))
+	if err != nil || mask != AllEvents {
+		t.Errorf("all events read back as %#x, %v", mask, err)
+	}
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression of reply payloads. A client advertises what it can decode in
+// the request's capability byte; the server only compresses replies to
+// clients that advertised CapGzip, so older clients never see FlagCompressed.
+const (
+	FlagCapabilities = 1 << 5 // request: a capability byte follows the semantics hint
+	FlagCompressed   = 1 << 6 // reply: Data is gzip-compressed on the wire
+
+	CapGzip = 1 << 0 // client accepts gzip-compressed reply Data
+)
+
+// DefaultCompressThreshold is the smallest reply Data the server compresses.
+const DefaultCompressThreshold = 512
+
+// maxDecompressedSize bounds decompressed Data so a corrupt or malicious
+// reply cannot exhaust memory.
+const maxDecompressedSize = 1 << 20
+
+// ErrBadCompression is returned for compressed Data that does not decode.
+var ErrBadCompression = errors.New("reply payload failed decompression")
+
+// CompressReply marks rep (and batch sub-replies) for compression when the
+// request advertised CapGzip and Data is at least threshold bytes. The
+// payload itself is compressed by MarshalReply. A threshold <= 0 disables
+// compression.
+func CompressReply(req RequestMessage, rep ReplyMessage, threshold int) ReplyMessage {
+	if threshold <= 0 || req.Capabilities&CapGzip == 0 {
+		return rep
+	}
+	if len(rep.Data) >= threshold {
+		rep.Flags |= FlagCompressed
+	}
+	if len(rep.Replies) > 0 {
+		subs := make([]ReplyMessage, len(rep.Replies))
+		for i, r := range rep.Replies {
+			subs[i] = CompressReply(req, r, threshold)
+		}
+		rep.Replies = subs
+	}
+	return rep
+}
+
+func compressData(data string) (string, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := io.WriteString(zw, data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func decompressData(data string) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader([]byte(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadCompression, err)
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadCompression, err)
+	}
+	if len(out) > maxDecompressedSize {
+		return "", fmt.Errorf("%w: more than %d bytes", ErrBadCompression, maxDecompressedSize)
+	}
+	return string(out), nil
+}
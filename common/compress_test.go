@@ -0,0 +1,113 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompressReplyThreshold(t *testing.T) {
+	gzipClient := RequestMessage{Capabilities: CapGzip}
+	long := strings.Repeat("a", 100)
+	tests := []struct {
+		name      string
+		req       RequestMessage
+		data      string
+		threshold int
+		want      bool
+	}{
+		{"over the threshold", gzipClient, long, 50, true},
+		{"at the threshold", gzipClient, long, 100, true},
+		{"under the threshold", gzipClient, long, 101, false},
+		{"disabled", gzipClient, long, 0, false},
+		{"client without gzip", RequestMessage{}, long, 50, false},
+	}
+	for _, tt := range tests {
+		rep := CompressReply(tt.req, ReplyMessage{Data: tt.data}, tt.threshold)
+		if got := rep.Flags&FlagCompressed != 0; got != tt.want {
+			t.Errorf("%s: compressed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	batch := CompressReply(gzipClient, ReplyMessage{OpCode: OpBatch, Replies: []ReplyMessage{{Data: long}, {Data: "short"}}}, 50)
+	if batch.Flags&FlagCompressed != 0 || batch.Replies[0].Flags&FlagCompressed == 0 || batch.Replies[1].Flags&FlagCompressed != 0 {
+		t.Errorf("batch flags: envelope %#x, entries %#x and %#x", batch.Flags, batch.Replies[0].Flags, batch.Replies[1].Flags)
+	}
+}
+
+func TestCompressedRoundTrip(t *testing.T) {
+	data := strings.Repeat("RoomA Monday 09:00-10:00 booked\n", 100)
+	plain, err := MarshalReply(ReplyMessage{RequestID: 1, OpCode: OpQueryAvailability, Data: data})
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	packed, err := MarshalReply(ReplyMessage{RequestID: 1, OpCode: OpQueryAvailability, Data: data, Flags: FlagCompressed})
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	if len(packed) >= len(plain)/4 {
+		t.Errorf("compressed reply is %d bytes, plain %d", len(packed), len(plain))
+	}
+	rep, err := UnmarshalReply(packed)
+	if err != nil {
+		t.Fatalf("UnmarshalReply: %v", err)
+	}
+	if rep.Data != data {
+		t.Error("decompressed Data differs")
+	}
+}
+
+// TestIncompressibleSentPlain checks Data that gzip would make larger goes
+// out as it is, without the flag.
+func TestIncompressibleSentPlain(t *testing.T) {
+	raw, err := MarshalReply(ReplyMessage{RequestID: 1, OpCode: OpQueryAvailability, Data: "tiny", Flags: FlagCompressed})
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	if raw[flagsOffset]&FlagCompressed != 0 {
+		t.Error("flag set on a payload sent uncompressed")
+	}
+	rep, err := UnmarshalReply(raw)
+	if err != nil || rep.Data != "tiny" {
+		t.Errorf("UnmarshalReply = %q, %v", rep.Data, err)
+	}
+}
+
+func TestCorruptCompressedPayload(t *testing.T) {
+	// wire builds a reply whose Data is sent as given with FlagCompressed set
+	wire := func(data string) []byte {
+		raw, err := MarshalReply(ReplyMessage{RequestID: 1, OpCode: OpQueryAvailability, Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[flagsOffset] |= FlagCompressed
+		return raw
+	}
+	valid, err := compressData(strings.Repeat("x", 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := []byte(valid)
+	flipped[len(flipped)-6] ^= 0xFF // the CRC trailer
+	bomb, err := compressData(strings.Repeat("\x00", maxDecompressedSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := UnmarshalReply(wire(valid)); err != nil {
+		t.Fatalf("valid payload: %v", err)
+	}
+	tests := []struct {
+		name, data string
+	}{
+		{"not gzip", "plain text"},
+		{"truncated", valid[:len(valid)/2]},
+		{"bad checksum", string(flipped)},
+		{"too large once decompressed", bomb},
+	}
+	for _, tt := range tests {
+		if _, err := UnmarshalReply(wire(tt.data)); !errors.Is(err, ErrBadCompression) {
+			t.Errorf("%s: err = %v, want ErrBadCompression", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package common
+
+import "testing"
+
+func TestCopyBookingRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpCopyBooking, RequestID: 9, ConfirmationID: "BKG-10000", StartDay: 3}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.ConfirmationID != "BKG-10000" || got.StartDay != 3 {
+		t.Errorf("read back as %+v", got)
+	}
+	if _, err := UnmarshalRequest(raw[:len(raw)-1]); err == nil {
+		t.Error("request without a target day accepted")
+	}
+}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	sec := PacketSecurity{Key: []byte("shared-secret"), Encrypt: true}
+	req := RequestMessage{
+		OpCode:          OpAddParticipant,
+		RequestID:       7,
+		ConfirmationID:  "BKG-10000",
+		ParticipantName: "Ada Lovelace",
+	}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+
+	sealed, err := sec.Seal(raw)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Error("sealed packet is not marked encrypted")
+	}
+	if bytes.Contains(sealed, []byte("Ada Lovelace")) || bytes.Contains(sealed, []byte("BKG-10000")) {
+		t.Error("sealed packet contains plaintext fields")
+	}
+	if op, id, ok := PeekHeader(sealed); !ok || op != OpAddParticipant || id != 7 {
+		t.Errorf("PeekHeader = %d, %d, %v; the header stays readable", op, id, ok)
+	}
+
+	opened, err := sec.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(opened, raw) {
+		t.Fatalf("Open returned %x, want %x", opened, raw)
+	}
+	got, err := UnmarshalRequest(opened)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.ConfirmationID != req.ConfirmationID || got.ParticipantName != req.ParticipantName {
+		t.Errorf("round trip = %+v", got)
+	}
+}
+
+func TestEncryptUsesFreshNonces(t *testing.T) {
+	sec := PacketSecurity{Key: []byte("shared-secret"), Encrypt: true}
+	raw, _ := MarshalReply(ReplyMessage{RequestID: 1, OpCode: OpBookFacility, Data: "ID=BKG-1"})
+	a, _ := sec.Seal(raw)
+	b, _ := sec.Seal(raw)
+	if bytes.Equal(a, b) {
+		t.Error("sealing the same reply twice gave identical packets")
+	}
+	for _, p := range [][]byte{a, b} {
+		opened, err := sec.Open(p)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		rep, err := UnmarshalReply(opened)
+		if err != nil || rep.Data != "ID=BKG-1" {
+			t.Errorf("reply round trip = %+v, %v", rep, err)
+		}
+	}
+}
+
+// TestBitFlipRejected flips every bit of an encrypted packet in turn. There
+// is no MAC trailer, so GCM alone must catch each one.
+func TestBitFlipRejected(t *testing.T) {
+	key := []byte("shared-secret")
+	raw, _ := MarshalRequest(RequestMessage{OpCode: OpCancelBooking, RequestID: 3, ConfirmationID: "BKG-10000"})
+	sealed, err := encryptPacket(key, raw)
+	if err != nil {
+		t.Fatalf("encryptPacket: %v", err)
+	}
+	for i := 0; i < len(sealed); i++ {
+		if i == flagsOffset {
+			continue // the flags byte is checked by Open itself
+		}
+		for bit := 0; bit < 8; bit++ {
+			flipped := append([]byte(nil), sealed...)
+			flipped[i] ^= 1 << bit
+			if _, err := decryptPacket(key, flipped); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("flipping bit %d of byte %d: err = %v, want ErrDecrypt", bit, i, err)
+			}
+		}
+	}
+}
+
+func TestOpenEncryptionMismatch(t *testing.T) {
+	key := []byte("shared-secret")
+	raw, _ := MarshalRequest(RequestMessage{OpCode: OpPing, RequestID: 1})
+	encrypted, _ := PacketSecurity{Key: key, Encrypt: true}.Seal(raw)
+	signed, _ := PacketSecurity{Key: key}.Seal(raw)
+
+	tests := []struct {
+		name    string
+		sec     PacketSecurity
+		packet  []byte
+		wantErr error
+	}{
+		{"encrypted to a plaintext peer", PacketSecurity{Key: key}, encrypted, ErrUnexpectedEncryption},
+		{"plaintext to an encrypting peer", PacketSecurity{Key: key, Encrypt: true}, signed, ErrNotEncrypted},
+		{"wrong key", PacketSecurity{Key: []byte("guess"), Encrypt: true}, encrypted, ErrBadMAC},
+	}
+	for _, tt := range tests {
+		if _, err := tt.sec.Open(tt.packet); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := (PacketSecurity{Encrypt: true}).Validate(); err == nil {
+		t.Error("Validate accepted -encrypt without -authKey")
+	}
+}
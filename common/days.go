@@ -0,0 +1,96 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// dayNames are the days of the week in the order they are numbered on the
+// wire, 0=Monday..6=Sunday.
+var dayNames = [7]string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// dayAliases are day names accepted besides English names and their
+// prefixes: German and French short forms.
+var dayAliases = map[string]uint8{
+	"mo": 0, "lun": 0,
+	"di": 1, "mar": 1,
+	"mi": 2, "mer": 2,
+	"do": 3, "jeu": 3,
+	"fr": 4, "ven": 4,
+	"sa": 5, "sam": 5,
+	"so": 6, "dim": 6,
+}
+
+// DayName returns the English name of day d, e.g. "Monday", or "Day 9" for
+// an index outside the week.
+func DayName(d uint8) string {
+	if int(d) >= len(dayNames) {
+		return fmt.Sprintf("Day %d", d)
+	}
+	return dayNames[d]
+}
+
+// ShortDayName returns the three-letter name of day d, e.g. "Mon".
+func ShortDayName(d uint8) string {
+	if int(d) >= len(dayNames) {
+		return fmt.Sprintf("Day %d", d)
+	}
+	return dayNames[d][:3]
+}
+
+// FormatWeekTime renders minutes since Monday 00:00 as "Wed 10:30". The
+// end of the week is "Sun 24:00" rather than a day after Sunday.
+func FormatWeekTime(m int32) string {
+	return formatWeekTime(m, ShortDayName)
+}
+
+// FormatLongWeekTime is FormatWeekTime with full day names: "Wednesday
+// 10:30".
+func FormatLongWeekTime(m int32) string {
+	return formatWeekTime(m, DayName)
+}
+
+func formatWeekTime(m int32, name func(uint8) string) string {
+	if m == schedule.WeekMinutes {
+		return name(6) + " 24:00"
+	}
+	day, hour, minute := schedule.FromMinutes(m)
+	return fmt.Sprintf("%s %02d:%02d", name(day), hour, minute)
+}
+
+// ParseDay reads a day as an index 0-6 or a name, ignoring case: an
+// English name or any prefix of one that fits a single day ("Mon", "Th",
+// "Wednes"), or a German or French short form ("Di", "jeu"). A prefix that
+// fits several days, such as "T" or "S", is refused.
+func ParseDay(s string) (uint8, error) {
+	s = strings.TrimSpace(s)
+	tok := strings.ToLower(s)
+	if n, err := strconv.Atoi(tok); err == nil {
+		if n < 0 || n >= len(dayNames) {
+			return 0, fmt.Errorf("day %d is out of range (0-%d)", n, len(dayNames)-1)
+		}
+		return uint8(n), nil
+	}
+	if day, ok := dayAliases[tok]; ok {
+		return day, nil
+	}
+	var matches []string
+	var day uint8
+	for i, name := range dayNames {
+		if tok != "" && strings.HasPrefix(strings.ToLower(name), tok) {
+			matches = append(matches, name)
+			day = uint8(i)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return day, nil
+	case 0:
+		return 0, fmt.Errorf("unknown day %q (use Mon..Sun or 0-%d)", s, len(dayNames)-1)
+	default:
+		return 0, fmt.Errorf("ambiguous day %q (%s)", s, strings.Join(matches, " or "))
+	}
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// TestParseDayNames: every day is read from its index, its full name and
+// every prefix of it that fits no other day, in any case.
+func TestParseDayNames(t *testing.T) {
+	unique := map[string]bool{}
+	for d, name := range dayNames {
+		for _, in := range []string{string(rune('0' + d)), name, strings.ToLower(name), strings.ToUpper(name), " " + name[:3] + "\t"} {
+			if got, err := ParseDay(in); err != nil || got != uint8(d) {
+				t.Errorf("ParseDay(%q) = %d, %v; want %d", in, got, err, d)
+			}
+		}
+		for n := 1; n <= len(name); n++ {
+			prefix := name[:n]
+			shared := false
+			for other, o := range dayNames {
+				shared = shared || other != d && strings.HasPrefix(o, prefix)
+			}
+			if shared {
+				continue
+			}
+			unique[prefix] = true
+			if got, err := ParseDay(prefix); err != nil || got != uint8(d) {
+				t.Errorf("ParseDay(%q) = %d, %v; want %d", prefix, got, err, d)
+			}
+		}
+	}
+	for _, p := range []string{"M", "W", "F", "Tu", "Th", "Sa", "Su"} {
+		if !unique[p] {
+			t.Errorf("%q was not tried as a unique prefix", p)
+		}
+	}
+}
+
+func TestParseDayAliases(t *testing.T) {
+	tests := map[string]uint8{
+		"Mo": 0, "Di": 1, "Mi": 2, "Do": 3, "Fr": 4, "Sa": 5, "So": 6,
+		"lun": 0, "MAR": 1, "mer": 2, "jeu": 3, "ven": 4, "sam": 5, "dim": 6,
+	}
+	for in, want := range tests {
+		if got, err := ParseDay(in); err != nil || got != want {
+			t.Errorf("ParseDay(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+}
+
+func TestParseDayRefused(t *testing.T) {
+	tests := []struct {
+		in, err string
+	}{
+		{"T", `ambiguous day "T" (Tuesday or Thursday)`},
+		{"s", `ambiguous day "s" (Saturday or Sunday)`},
+		{"7", "day 7 is out of range (0-6)"},
+		{"-1", "day -1 is out of range (0-6)"},
+		{"", "unknown day"},
+		{"Mondays", "unknown day"},
+		{"Tues day", "unknown day"},
+		{"lundi", "unknown day"},
+	}
+	for _, tt := range tests {
+		_, err := ParseDay(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseDay(%q) error %v, want %q", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestDayNames(t *testing.T) {
+	if DayName(0) != "Monday" || DayName(6) != "Sunday" || DayName(7) != "Day 7" {
+		t.Errorf("DayName: %q %q %q", DayName(0), DayName(6), DayName(7))
+	}
+	if ShortDayName(2) != "Wed" || ShortDayName(9) != "Day 9" {
+		t.Errorf("ShortDayName: %q %q", ShortDayName(2), ShortDayName(9))
+	}
+	for m, want := range map[int32]string{
+		0:                             "Mon 00:00",
+		schedule.ToMinutes(2, 10, 30): "Wed 10:30",
+		schedule.WeekMinutes - 1:      "Sun 23:59",
+		schedule.WeekMinutes:          "Sun 24:00",
+	} {
+		if got := FormatWeekTime(m); got != want {
+			t.Errorf("FormatWeekTime(%d) = %q, want %q", m, got, want)
+		}
+	}
+	if got := FormatLongWeekTime(schedule.ToMinutes(3, 9, 5)); got != "Thursday 09:05" {
+		t.Errorf("FormatLongWeekTime = %q", got)
+	}
+}
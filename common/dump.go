@@ -0,0 +1,33 @@
+package common
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Directions for DumpPacket.
+const (
+	DumpSent     = "sent"
+	DumpReceived = "received"
+)
+
+// DumpPacket formats a packet payload (without the length prefix) for
+// debugging: a line with the direction, the length and, when the header can
+// be read, the OpCode, RequestID and flags, then a hex and ASCII dump. The
+// header is readable even for authenticated or encrypted packets.
+func DumpPacket(direction string, payload []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d bytes", direction, len(payload))
+	if op, id, ok := PeekHeader(payload); ok {
+		fmt.Fprintf(&b, ": Op=%s RequestID=%d", OpName(op), id)
+		if len(payload) > flagsOffset {
+			fmt.Fprintf(&b, " Flags=0x%02x", payload[flagsOffset])
+		}
+	} else {
+		b.WriteString(": header not readable")
+	}
+	b.WriteString("\n")
+	b.WriteString(hex.Dump(payload))
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,72 @@
+package common
+
+import "testing"
+
+func TestDumpPacket(t *testing.T) {
+	query := []byte{
+		0xb0, 0x0c, 0x01, 0, 0, 0, 0, 0, 0, 0, 0x2a, 0, 0, 0x05, 'R', 'o',
+		'o', 'm', 'A', 0x02, 0x00, 0x01,
+	}
+	tests := []struct {
+		name      string
+		direction string
+		payload   []byte
+		golden    string
+	}{
+		{
+			name:      "request",
+			direction: DumpSent,
+			payload:   query,
+			golden: `sent 22 bytes: Op=QueryAvailability RequestID=42 Flags=0x00
+00000000  b0 0c 01 00 00 00 00 00  00 00 2a 00 00 05 52 6f  |..........*...Ro|
+00000010  6f 6d 41 02 00 01                                 |omA...|`,
+		},
+		{
+			name:      "encrypted reply",
+			direction: DumpReceived,
+			payload:   []byte{0xb0, 0x0c, 0x02, 0, 0, 0, 0, 0, 0, 0, 0x07, FlagEncrypted | FlagAuthenticated, 0xde, 0xad},
+			golden: `received 14 bytes: Op=BookFacility RequestID=7 Flags=0x03
+00000000  b0 0c 02 00 00 00 00 00  00 00 07 03 de ad        |..............|`,
+		},
+		{
+			name:      "header without flags",
+			direction: DumpReceived,
+			payload:   query[:flagsOffset],
+			golden: `received 11 bytes: Op=QueryAvailability RequestID=42
+00000000  b0 0c 01 00 00 00 00 00  00 00 2a                 |..........*|`,
+		},
+		{
+			name:      "unknown opcode",
+			direction: DumpReceived,
+			payload:   []byte{0xb0, 0x0c, 0xfe, 0, 0, 0, 0, 0, 0, 0, 0x01, 0},
+			golden: `received 12 bytes: Op=unknown(254) RequestID=1 Flags=0x00
+00000000  b0 0c fe 00 00 00 00 00  00 00 01 00              |............|`,
+		},
+		{
+			name:      "short packet",
+			direction: DumpReceived,
+			payload:   []byte{1, 2, 3},
+			golden: `received 3 bytes: header not readable
+00000000  01 02 03                                          |...|`,
+		},
+		{
+			name:      "no magic",
+			direction: DumpReceived,
+			payload:   []byte("GET / HTTP/1.1\r\n"),
+			golden: `received 16 bytes: header not readable
+00000000  47 45 54 20 2f 20 48 54  54 50 2f 31 2e 31 0d 0a  |GET / HTTP/1.1..|`,
+		},
+		{
+			name:      "empty",
+			direction: DumpReceived,
+			golden:    `received 0 bytes: header not readable`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DumpPacket(tt.direction, tt.payload); got != tt.golden {
+				t.Errorf("DumpPacket =\n%s\nwant\n%s", got, tt.golden)
+			}
+		})
+	}
+}
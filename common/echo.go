@@ -0,0 +1,62 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrorEcho repeats the salient fields of a failed request in its error
+// reply, so a client with many requests in flight can tell which one was
+// bad and why. Field and Value name the request field the server rejected,
+// if it was a single field.
+type ErrorEcho struct {
+	Op             string
+	Facility       string
+	ConfirmationID string
+	Field          string
+	Value          string
+}
+
+// String renders the echo compactly, e.g.
+// "op=BookFacility facility=Lab1 field=StartHour value=25". Empty fields
+// are left out and values with spaces are quoted.
+func (e ErrorEcho) String() string {
+	var parts []string
+	for _, kv := range [][2]string{
+		{"op", e.Op}, {"facility", e.Facility}, {"id", e.ConfirmationID}, {"field", e.Field}, {"value", e.Value},
+	} {
+		switch {
+		case kv[1] == "":
+		case strings.ContainsAny(kv[1], " \t\"=") || !IsPlainText(kv[1]):
+			parts = append(parts, kv[0]+"="+strconv.Quote(kv[1]))
+		default:
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// PutErrorEcho stores the echo in ExtErrorEcho as a string list.
+func (e *Extensions) PutErrorEcho(echo ErrorEcho) error {
+	raw, err := appendStringList(nil, []string{echo.Op, echo.Facility, echo.ConfirmationID, echo.Field, echo.Value})
+	if err != nil {
+		return err
+	}
+	e.Put(ExtErrorEcho, raw)
+	return nil
+}
+
+// ErrorEchoOf returns the echo of an error reply; ok is false if it has
+// none, e.g. from a server that predates it.
+func ErrorEchoOf(rep ReplyMessage) (ErrorEcho, bool, error) {
+	raw, ok := rep.Extensions.Get(ExtErrorEcho)
+	if !ok {
+		return ErrorEcho{}, false, nil
+	}
+	list, n, err := readStringList(raw, 0)
+	if err != nil || n != len(raw) || len(list) < 5 {
+		return ErrorEcho{}, true, fmt.Errorf("malformed error echo")
+	}
+	return ErrorEcho{Op: list[0], Facility: list[1], ConfirmationID: list[2], Field: list[3], Value: list[4]}, true, nil
+}
@@ -0,0 +1,52 @@
+package common
+
+import "testing"
+
+func TestErrorEchoString(t *testing.T) {
+	tests := []struct {
+		echo ErrorEcho
+		want string
+	}{
+		{ErrorEcho{Op: "BookFacility", Facility: "Lab1", Field: "StartHour", Value: "25"},
+			"op=BookFacility facility=Lab1 field=StartHour value=25"},
+		{ErrorEcho{Op: "ChangeBooking", ConfirmationID: "BKG-1"}, "op=ChangeBooking id=BKG-1"},
+		{ErrorEcho{Op: "BookFacility", Field: "End", Value: "Thu 09:00"},
+			`op=BookFacility field=End value="Thu 09:00"`},
+		{ErrorEcho{Field: "FacilityName", Value: "a=b\x01"}, `field=FacilityName value="a=b\x01"`},
+		{ErrorEcho{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.echo.String(); got != tt.want {
+			t.Errorf("%+v renders %q, want %q", tt.echo, got, tt.want)
+		}
+	}
+}
+
+// TestErrorEchoRoundTrip sends an echo through a marshalled reply.
+func TestErrorEchoRoundTrip(t *testing.T) {
+	echo := ErrorEcho{Op: "BookFacility", Facility: "Lab1", ConfirmationID: "", Field: "StartHour", Value: "25"}
+	rep := ReplyMessage{RequestID: 7, OpCode: OpBookFacility, Status: StatusInvalidArgument, Data: "Error"}
+	if err := rep.Extensions.PutErrorEcho(echo); err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalReply(rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalReply(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok, err := ErrorEchoOf(got); !ok || err != nil || e != echo {
+		t.Errorf("ErrorEchoOf = %+v, %v, %v; want %+v", e, ok, err, echo)
+	}
+
+	if _, ok, err := ErrorEchoOf(ReplyMessage{}); ok || err != nil {
+		t.Errorf("reply without an echo: %v, %v", ok, err)
+	}
+	var bad ReplyMessage
+	bad.Extensions.Put(ExtErrorEcho, []byte{0xff})
+	if _, ok, err := ErrorEchoOf(bad); !ok || err == nil {
+		t.Errorf("malformed echo: %v, %v", ok, err)
+	}
+}
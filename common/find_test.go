@@ -0,0 +1,27 @@
+package common
+
+import "testing"
+
+func TestFindParticipantRoundTrip(t *testing.T) {
+	for _, req := range []RequestMessage{
+		{OpCode: OpFindParticipant, RequestID: 7, ParticipantName: "Alice", MatchMode: MatchExact},
+		{OpCode: OpFindParticipant, RequestID: 8, ParticipantName: "ali", FacilityName: "RoomA", MatchMode: MatchSubstring},
+	} {
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest: %v", err)
+		}
+		got, err := UnmarshalRequest(raw)
+		if err != nil {
+			t.Fatalf("UnmarshalRequest: %v", err)
+		}
+		if got.ParticipantName != req.ParticipantName || got.FacilityName != req.FacilityName || got.MatchMode != req.MatchMode {
+			t.Errorf("%+v read back as %+v", req, got)
+		}
+
+		// Cut before the match mode
+		if _, err := UnmarshalRequest(raw[:len(raw)-1]); err == nil {
+			t.Errorf("request without a match mode accepted")
+		}
+	}
+}
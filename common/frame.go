@@ -0,0 +1,77 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxFrameSize bounds a single length-prefixed message on stream transports.
+const MaxFrameSize = 1 << 20
+
+// DefaultMaxRequestSize is the default limit on a (sealed) request, matching
+// the server's original UDP receive buffer.
+const DefaultMaxRequestSize = 2048
+
+// MaxConfirmationIDLen is the longest confirmation ID a server generates, so
+// a cancel request for several IDs still fits DefaultMaxRequestSize.
+const MaxConfirmationIDLen = 64
+
+// LengthPrefixSize is the size of the total-length prefix on every message.
+const LengthPrefixSize = 4
+
+// ErrTruncated means fewer bytes arrived than the length prefix declared.
+var ErrTruncated = errors.New("packet truncated")
+
+// PrefixLength prepends the 4-byte big-endian payload length. Datagrams
+// carry it so a receiver can tell a truncated read from a malformed message.
+func PrefixLength(data []byte) []byte {
+	buf := make([]byte, LengthPrefixSize, LengthPrefixSize+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
+
+// SplitLength checks a datagram against its length prefix and returns the
+// payload together with the declared length, which is valid even when the
+// payload is truncated.
+func SplitLength(packet []byte) ([]byte, int, error) {
+	if len(packet) < LengthPrefixSize {
+		return nil, 0, fmt.Errorf("packet of %d bytes has no length prefix", len(packet))
+	}
+	declared := int(binary.BigEndian.Uint32(packet[:LengthPrefixSize]))
+	payload := packet[LengthPrefixSize:]
+	switch {
+	case len(payload) < declared:
+		return payload, declared, fmt.Errorf("%w: received %d of %d bytes", ErrTruncated, len(payload), declared)
+	case len(payload) > declared:
+		return nil, declared, fmt.Errorf("packet has %d bytes after a length prefix of %d", len(payload), declared)
+	}
+	return payload, declared, nil
+}
+
+// WriteFrame writes data preceded by its 4-byte big-endian length.
+func WriteFrame(w io.Writer, data []byte) error {
+	if len(data) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit %d", len(data), MaxFrameSize)
+	}
+	_, err := w.Write(PrefixLength(data))
+	return err
+}
+
+// ReadFrame reads one length-prefixed message written by WriteFrame.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds limit %d", n, MaxFrameSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// States of a facility in a FreeBusy reply.
+const (
+	FreeBusyFree   = 0 // room for one more booking over the whole window
+	FreeBusyBooked = 1 // a booking is in the way; Detail is its confirmation ID
+	FreeBusyClosed = 2 // a blackout overlaps the window; Detail is its reason, if any
+)
+
+// FreeBusy is one facility in an ExtFreeBusy reply.
+type FreeBusy struct {
+	Facility string
+	State    uint8
+	Detail   string
+}
+
+// AppendFreeBusy encodes entries for ExtFreeBusy: a 2-byte count, then per
+// entry the state byte and the facility and detail, each as a 1-byte length
+// and the bytes.
+func AppendFreeBusy(buf []byte, entries []FreeBusy) ([]byte, error) {
+	if len(entries) > 0xFFFF {
+		return nil, fmt.Errorf("too many facilities (max %d)", 0xFFFF)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		if len(e.Facility) > 255 || len(e.Detail) > 255 {
+			return nil, fmt.Errorf("free/busy entry for %q is too long", e.Facility)
+		}
+		buf = append(buf, e.State, byte(len(e.Facility)))
+		buf = append(buf, e.Facility...)
+		buf = append(buf, byte(len(e.Detail)))
+		buf = append(buf, e.Detail...)
+	}
+	return buf, nil
+}
+
+// ParseFreeBusy decodes an ExtFreeBusy value.
+func ParseFreeBusy(raw []byte) ([]FreeBusy, error) {
+	if len(raw) < 2 {
+		return nil, fmt.Errorf("free/busy list of %d bytes has no count", len(raw))
+	}
+	n := int(binary.BigEndian.Uint16(raw))
+	entries := make([]FreeBusy, 0, n)
+	rest := raw[2:]
+	for i := 0; i < n; i++ {
+		if len(rest) < 2 || len(rest) < 2+int(rest[1])+1 {
+			return nil, fmt.Errorf("free/busy entry %d of %d is truncated", i, n)
+		}
+		e := FreeBusy{State: rest[0]}
+		nameLen := int(rest[1])
+		e.Facility = string(rest[2 : 2+nameLen])
+		rest = rest[2+nameLen:]
+		if len(rest) < 1+int(rest[0]) {
+			return nil, fmt.Errorf("free/busy entry %d of %d is truncated", i, n)
+		}
+		e.Detail = string(rest[1 : 1+int(rest[0])])
+		rest = rest[1+int(rest[0]):]
+		entries = append(entries, e)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d bytes after %d free/busy entries", len(rest), n)
+	}
+	return entries, nil
+}
+
+// FreeBusyOf returns the facility states listed in a FreeBusy reply; ok is
+// false if the reply has none.
+func FreeBusyOf(rep ReplyMessage) (entries []FreeBusy, ok bool, err error) {
+	raw, ok := rep.Extensions.Get(ExtFreeBusy)
+	if !ok {
+		return nil, false, nil
+	}
+	entries, err = ParseFreeBusy(raw)
+	return entries, true, err
+}
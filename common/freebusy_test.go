@@ -0,0 +1,55 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFreeBusyRoundTrip(t *testing.T) {
+	entries := []FreeBusy{
+		{Facility: "Lab1", State: FreeBusyFree},
+		{Facility: "RoomA", State: FreeBusyBooked, Detail: "BKG-10001"},
+		{Facility: "Studio", State: FreeBusyClosed},
+	}
+	raw, err := AppendFreeBusy(nil, entries)
+	if err != nil {
+		t.Fatalf("AppendFreeBusy: %v", err)
+	}
+	var rep ReplyMessage
+	rep.Extensions.Put(ExtFreeBusy, raw)
+	got, ok, err := FreeBusyOf(rep)
+	if !ok || err != nil || !reflect.DeepEqual(got, entries) {
+		t.Errorf("FreeBusyOf = %+v, %v, %v; want %+v", got, ok, err, entries)
+	}
+	if _, ok, _ := FreeBusyOf(ReplyMessage{}); ok {
+		t.Error("reply without the extension has entries")
+	}
+
+	for cut := 0; cut < len(raw); cut++ {
+		if _, err := ParseFreeBusy(raw[:cut]); err == nil {
+			t.Errorf("list cut to %d of %d bytes accepted", cut, len(raw))
+		}
+	}
+	if _, err := ParseFreeBusy(append(raw, 0)); err == nil {
+		t.Error("trailing byte accepted")
+	}
+	if _, err := AppendFreeBusy(nil, []FreeBusy{{Facility: strings.Repeat("x", 256)}}); err == nil {
+		t.Error("facility name of 256 bytes encoded")
+	}
+}
+
+func TestFreeBusyRequestRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpFreeBusy, RequestID: 3, StartDay: 1, StartHour: 14, StartMinute: 30, EndDay: 1, EndHour: 16}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.StartDay != 1 || got.StartHour != 14 || got.StartMinute != 30 || got.EndDay != 1 || got.EndHour != 16 {
+		t.Errorf("read back as %+v", got)
+	}
+}
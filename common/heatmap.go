@@ -0,0 +1,45 @@
+package common
+
+import "fmt"
+
+// HeatmapCells is the number of cells in a heatmap, one per hour of the week.
+const HeatmapCells = 7 * 24
+
+// Heatmap holds booked minutes per hour of the week: cell [d][h] is how
+// many minutes of hour h on day d (0=Monday..6=Sunday) are booked, 0-60.
+type Heatmap [7][24]uint8
+
+// AppendHeatmap encodes a heatmap for ExtHeatmap: HeatmapCells bytes, day
+// by day from Monday 00:00.
+func AppendHeatmap(buf []byte, h Heatmap) []byte {
+	for _, day := range h {
+		buf = append(buf, day[:]...)
+	}
+	return buf
+}
+
+// ParseHeatmap decodes an ExtHeatmap value.
+func ParseHeatmap(raw []byte) (Heatmap, error) {
+	var h Heatmap
+	if len(raw) != HeatmapCells {
+		return h, fmt.Errorf("heatmap has %d bytes, want %d", len(raw), HeatmapCells)
+	}
+	for i, v := range raw {
+		if v > 60 {
+			return h, fmt.Errorf("heatmap cell %d holds %d minutes, more than an hour", i, v)
+		}
+		h[i/24][i%24] = v
+	}
+	return h, nil
+}
+
+// HeatmapOf returns the heatmap of a Heatmap reply; ok is false if the
+// reply has none.
+func HeatmapOf(rep ReplyMessage) (h Heatmap, ok bool, err error) {
+	raw, ok := rep.Extensions.Get(ExtHeatmap)
+	if !ok {
+		return h, false, nil
+	}
+	h, err = ParseHeatmap(raw)
+	return h, true, err
+}
@@ -0,0 +1,25 @@
+package common
+
+import "testing"
+
+func TestHeatmapRoundTrip(t *testing.T) {
+	var h Heatmap
+	h[0][9], h[4][23], h[6][23] = 60, 30, 1
+	raw := AppendHeatmap(nil, h)
+	if len(raw) != HeatmapCells || raw[9] != 60 || raw[4*24+23] != 30 || raw[HeatmapCells-1] != 1 {
+		t.Fatalf("encoded as % x", raw)
+	}
+	var rep ReplyMessage
+	rep.Extensions.Put(ExtHeatmap, raw)
+	if got, ok, err := HeatmapOf(rep); !ok || err != nil || got != h {
+		t.Errorf("HeatmapOf = %v, %v, %v", got, ok, err)
+	}
+
+	if _, err := ParseHeatmap(raw[1:]); err == nil {
+		t.Error("short heatmap accepted")
+	}
+	raw[5] = 61
+	if _, err := ParseHeatmap(raw); err == nil {
+		t.Error("cell of 61 minutes accepted")
+	}
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the wire protocol version spoken by this build. Peers
+// that never answer OpHello are treated as version 0 (no optional features).
+const ProtocolVersion = 1
+
+// Capability bits exchanged in OpHello (CapGzip is defined with compression).
+const (
+	CapBatch         = 1 << 1 // OpBatch envelopes
+	CapSessions      = 1 << 2 // OpRegisterUser and session tokens
+	CapSemanticsHint = 1 << 3 // per-request semantics hints (see -allowedSemantics)
+)
+
+// HelloInfo is what a server reports about itself in an OpHello reply. The
+// fields travel as extensions so later versions can add more.
+type HelloInfo struct {
+	ProtocolVersion uint8
+	Capabilities    uint8
+	Semantics       string // the server's default invocation semantics
+	ServerVersion   string // server software version
+}
+
+// HelloReply builds the reply to an OpHello request.
+func HelloReply(requestID uint64, info HelloInfo) ReplyMessage {
+	rep := ReplyMessage{
+		RequestID: requestID,
+		OpCode:    OpHello,
+		Status:    StatusOK,
+		Data:      info.String(),
+	}
+	rep.Extensions.Put(ExtProtocolVersion, []byte{info.ProtocolVersion})
+	rep.Extensions.Put(ExtCapabilities, []byte{info.Capabilities})
+	rep.Extensions.PutString(ExtSemantics, info.Semantics)
+	rep.Extensions.PutString(ExtServerVersion, info.ServerVersion)
+	return rep
+}
+
+// ParseHello extracts the server's HelloInfo from an OpHello reply.
+func ParseHello(rep ReplyMessage) (HelloInfo, error) {
+	var info HelloInfo
+	if rep.OpCode != OpHello || rep.Status != StatusOK {
+		return info, fmt.Errorf("not a successful hello reply: %s", rep.Data)
+	}
+	v, ok := rep.Extensions.Get(ExtProtocolVersion)
+	if !ok || len(v) != 1 {
+		return info, fmt.Errorf("hello reply has no protocol version")
+	}
+	info.ProtocolVersion = v[0]
+	if caps, ok := rep.Extensions.Get(ExtCapabilities); ok && len(caps) == 1 {
+		info.Capabilities = caps[0]
+	}
+	info.Semantics, _ = rep.Extensions.String(ExtSemantics)
+	info.ServerVersion, _ = rep.Extensions.String(ExtServerVersion)
+	return info, nil
+}
+
+// CapabilityNames lists the set capability bits by name.
+func CapabilityNames(caps uint8) []string {
+	names := make([]string, 0)
+	for _, c := range []struct {
+		bit  uint8
+		name string
+	}{
+		{CapGzip, "gzip"},
+		{CapBatch, "batch"},
+		{CapSessions, "sessions"},
+		{CapSemanticsHint, "semantics-hint"},
+	} {
+		if caps&c.bit != 0 {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+func (h HelloInfo) String() string {
+	features := "none"
+	if names := CapabilityNames(h.Capabilities); len(names) > 0 {
+		features = strings.Join(names, ",")
+	}
+	return fmt.Sprintf("protocol=%d version=%s semantics=%s features=%s",
+		h.ProtocolVersion, h.ServerVersion, h.Semantics, features)
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHelloRoundTrip(t *testing.T) {
+	info := HelloInfo{ProtocolVersion: ProtocolVersion, Capabilities: CapBatch | CapGzip, Semantics: "at-most-once", ServerVersion: "1.2.3"}
+	raw, err := MarshalReply(HelloReply(9, info))
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	rep, err := UnmarshalReply(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalReply: %v", err)
+	}
+	got, err := ParseHello(rep)
+	if err != nil {
+		t.Fatalf("ParseHello: %v", err)
+	}
+	if got != info {
+		t.Errorf("ParseHello = %+v, want %+v", got, info)
+	}
+	if want := "protocol=1 version=1.2.3 semantics=at-most-once features=gzip,batch"; rep.Data != want {
+		t.Errorf("Data = %q, want %q", rep.Data, want)
+	}
+}
+
+// TestParseHelloAcrossVersions parses hello replies from servers newer and
+// older than this build.
+func TestParseHelloAcrossVersions(t *testing.T) {
+	newer := HelloReply(1, HelloInfo{ProtocolVersion: 7, Capabilities: 0xFF, Semantics: "at-most-once", ServerVersion: "9.0"})
+	newer.Extensions.PutString(200, "a field this build does not know")
+
+	minimal := ReplyMessage{OpCode: OpHello, Status: StatusOK}
+	minimal.Extensions.Put(ExtProtocolVersion, []byte{1})
+
+	tests := []struct {
+		name    string
+		rep     ReplyMessage
+		want    HelloInfo
+		wantErr bool
+	}{
+		{"newer server", newer, HelloInfo{ProtocolVersion: 7, Capabilities: 0xFF, Semantics: "at-most-once", ServerVersion: "9.0"}, false},
+		{"only a version", minimal, HelloInfo{ProtocolVersion: 1}, false},
+		{"no version", ReplyMessage{OpCode: OpHello, Status: StatusOK}, HelloInfo{}, true},
+		{"error reply", ReplyMessage{OpCode: OpHello, Status: StatusError, Data: "unknown op"}, HelloInfo{}, true},
+		{"not a hello", ReplyMessage{OpCode: OpPing, Status: StatusOK}, HelloInfo{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHello(tt.rep)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: ParseHello = %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestCapabilityNames(t *testing.T) {
+	if got := CapabilityNames(0); len(got) != 0 {
+		t.Errorf("CapabilityNames(0) = %q", got)
+	}
+	want := []string{"gzip", "batch", "sessions", "semantics-hint"}
+	if got := CapabilityNames(0xFF); !reflect.DeepEqual(got, want) {
+		t.Errorf("CapabilityNames(0xFF) = %q, want %q", got, want)
+	}
+}
+
+func TestHelloRequestRoundTrip(t *testing.T) {
+	raw, err := MarshalRequest(RequestMessage{OpCode: OpHello, RequestID: 3, HelloVersion: 5, HelloCapabilities: CapGzip})
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	req, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if req.HelloVersion != 5 || req.HelloCapabilities != CapGzip {
+		t.Errorf("decoded version %d, capabilities %#x", req.HelloVersion, req.HelloCapabilities)
+	}
+}
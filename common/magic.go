@@ -0,0 +1,23 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Magic opens every marshaled request and reply so that stray traffic on
+// the server port (scanners, misdirected datagrams) is recognised and
+// dropped before anything is interpreted as an OpCode.
+var Magic = [MagicSize]byte{0xB0, 0x0C}
+
+// MagicSize is the length of Magic.
+const MagicSize = 2
+
+// ErrBadMagic is returned for data that does not start with Magic.
+var ErrBadMagic = errors.New("packet does not start with the protocol magic")
+
+// HasMagic reports whether a marshaled (possibly sealed) message starts
+// with Magic.
+func HasMagic(packet []byte) bool {
+	return bytes.HasPrefix(packet, Magic[:])
+}
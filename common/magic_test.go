@@ -0,0 +1,77 @@
+package common
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestMessagesStartWithMagic(t *testing.T) {
+	req, err := MarshalRequest(RequestMessage{OpCode: OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"})
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	rep, err := MarshalReply(ReplyMessage{RequestID: 1, OpCode: OpQueryAvailability, Data: "free"})
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	for name, raw := range map[string][]byte{"request": req, "reply": rep} {
+		if !HasMagic(raw) {
+			t.Errorf("%s starts with % x", name, raw[:MagicSize])
+		}
+	}
+	if _, err := UnmarshalRequest(req); err != nil {
+		t.Errorf("UnmarshalRequest: %v", err)
+	}
+	if _, err := UnmarshalReply(rep); err != nil {
+		t.Errorf("UnmarshalReply: %v", err)
+	}
+}
+
+// TestRandomDataRejected feeds random datagrams to both decoders: without
+// the magic they fail with ErrBadMagic before anything else is read.
+func TestRandomDataRejected(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		data := make([]byte, rng.Intn(64))
+		rng.Read(data)
+		if HasMagic(data) {
+			continue
+		}
+		if _, err := UnmarshalRequest(data); !errors.Is(err, ErrBadMagic) {
+			t.Fatalf("UnmarshalRequest(% x) = %v, want ErrBadMagic", data, err)
+		}
+		if _, err := UnmarshalReply(data); !errors.Is(err, ErrBadMagic) {
+			t.Fatalf("UnmarshalReply(% x) = %v, want ErrBadMagic", data, err)
+		}
+	}
+}
+
+// TestRandomDataAfterMagic checks garbage that does start with the magic
+// is still refused, without panicking.
+func TestRandomDataAfterMagic(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		data := make([]byte, MagicSize+rng.Intn(16))
+		rng.Read(data)
+		copy(data, Magic[:])
+		UnmarshalRequest(data)
+		UnmarshalReply(data)
+	}
+	for _, data := range [][]byte{nil, Magic[:1], Magic[:]} {
+		if _, err := UnmarshalRequest(data); err == nil {
+			t.Errorf("UnmarshalRequest(% x) succeeded", data)
+		}
+	}
+}
+
+func TestOldFormatRejected(t *testing.T) {
+	raw, err := MarshalRequest(RequestMessage{OpCode: OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A client from before the magic sends the rest of the message alone
+	if _, err := UnmarshalRequest(raw[MagicSize:]); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("err = %v, want ErrBadMagic", err)
+	}
+}
@@ -9,6 +9,9 @@ func MarshalRequest(req RequestMessage) ([]byte, error) {
 	// Start with a small buffer
 	buf := make([]byte, 0, 128) // adjust as needed
 
+	// Magic (2 bytes)
+	buf = append(buf, Magic[:]...)
+
 	// 1) OpCode (1 byte)
 	buf = append(buf, req.OpCode)
 
@@ -17,19 +20,44 @@ func MarshalRequest(req RequestMessage) ([]byte, error) {
 	binary.BigEndian.PutUint64(tmp, req.RequestID)
 	buf = append(buf, tmp...)
 
+	// Flags (1 byte); security bits are set later by PacketSecurity.Seal
+	flags := req.Flags &^ (FlagSession | FlagSemantics | FlagCapabilities)
+	if req.SessionToken != "" {
+		flags |= FlagSession
+	}
+	if req.Semantics != HintServerDefault {
+		flags |= FlagSemantics
+	}
+	if req.Capabilities != 0 {
+		flags |= FlagCapabilities
+	}
+	buf = append(buf, flags)
+
+	// Optional session token
+	if req.SessionToken != "" {
+		buf = writeString(buf, req.SessionToken)
+	}
+
+	// Optional semantics hint (1 byte)
+	if req.Semantics != HintServerDefault {
+		buf = append(buf, req.Semantics)
+	}
+
+	// Optional capability byte
+	if req.Capabilities != 0 {
+		buf = append(buf, req.Capabilities)
+	}
+
 	// 3) Switch on OpCode to encode the relevant fields
 	switch req.OpCode {
 
 	case OpQueryAvailability:
 		// FacilityName
 		buf = writeString(buf, req.FacilityName)
-		// DaysList: first write 1 byte for number of days, then each day as 1 byte
-		if len(req.DaysList) > 255 {
-			return nil, fmt.Errorf("too many days in DaysList (max 255)")
-		}
-		buf = append(buf, byte(len(req.DaysList)))
-		for _, d := range req.DaysList {
-			buf = append(buf, d)
+		// DaysList
+		var err error
+		if buf, err = appendDaysList(buf, req.DaysList); err != nil {
+			return nil, err
 		}
 
 	case OpBookFacility:
@@ -39,6 +67,34 @@ func MarshalRequest(req RequestMessage) ([]byte, error) {
 		buf = append(buf, req.StartDay, req.StartHour, req.StartMinute,
 			req.EndDay, req.EndHour, req.EndMinute)
 
+	case OpAddBlackout:
+		// FacilityName, the 6 time bytes as for BookFacility, then Reason
+		buf = writeString(buf, req.FacilityName)
+		buf = append(buf, req.StartDay, req.StartHour, req.StartMinute,
+			req.EndDay, req.EndHour, req.EndMinute)
+		buf = writeString(buf, req.Reason)
+
+	case OpListBookings:
+		// FacilityName, PageOffset (4 bytes), PageLimit (2 bytes)
+		buf = writeString(buf, req.FacilityName)
+		tmp6 := make([]byte, 6)
+		binary.BigEndian.PutUint32(tmp6, req.PageOffset)
+		binary.BigEndian.PutUint16(tmp6[4:], req.PageLimit)
+		buf = append(buf, tmp6...)
+
+	case OpClearBookings:
+		// FacilityName, DaysList, then the confirmation (1 byte)
+		buf = writeString(buf, req.FacilityName)
+		var err error
+		if buf, err = appendDaysList(buf, req.DaysList); err != nil {
+			return nil, err
+		}
+		confirm := byte(0)
+		if req.Confirm {
+			confirm = 1
+		}
+		buf = append(buf, confirm)
+
 	case OpChangeBooking:
 		// Write ConfirmationID as before.
 		buf = writeString(buf, req.ConfirmationID)
@@ -66,18 +122,169 @@ func MarshalRequest(req RequestMessage) ([]byte, error) {
 		// ParticipantName
 		buf = writeString(buf, req.ParticipantName)
 
+	case OpSplitBooking:
+		// ConfirmationID, then the cut as the 6 time bytes of BookFacility
+		buf = writeString(buf, req.ConfirmationID)
+		buf = append(buf, req.StartDay, req.StartHour, req.StartMinute,
+			req.EndDay, req.EndHour, req.EndMinute)
+
+	case OpHeatmap:
+		// FacilityName (empty for all)
+		buf = writeString(buf, req.FacilityName)
+
+	case OpFreeBusy:
+		// The window as the 6 time bytes of BookFacility; no facility
+		buf = append(buf, req.StartDay, req.StartHour, req.StartMinute,
+			req.EndDay, req.EndHour, req.EndMinute)
+
+	case OpCopyBooking:
+		// ConfirmationID, then the day the copy starts (1 byte)
+		buf = writeString(buf, req.ConfirmationID)
+		buf = append(buf, req.StartDay)
+
+	case OpTransferBooking:
+		// ConfirmationID, then the target FacilityName
+		buf = writeString(buf, req.ConfirmationID)
+		buf = writeString(buf, req.FacilityName)
+
+	case OpRenameFacility:
+		// FacilityName, then NewFacilityName
+		buf = writeString(buf, req.FacilityName)
+		buf = writeString(buf, req.NewFacilityName)
+
+	case OpCreateNamespace:
+		// TargetNamespace, then the facility names (count + strings)
+		buf = writeString(buf, req.TargetNamespace)
+		var err error
+		if buf, err = appendStringList(buf, req.MoreFacilities); err != nil {
+			return nil, err
+		}
+
+	case OpDeleteNamespace:
+		// TargetNamespace, then the confirmation (1 byte)
+		buf = writeString(buf, req.TargetNamespace)
+		confirm := byte(0)
+		if req.Confirm {
+			confirm = 1
+		}
+		buf = append(buf, confirm)
+
+	case OpApproveBooking:
+		// ConfirmationID
+		buf = writeString(buf, req.ConfirmationID)
+
+	case OpRejectBooking:
+		// ConfirmationID, then Reason
+		buf = writeString(buf, req.ConfirmationID)
+		buf = writeString(buf, req.Reason)
+
+	case OpFindParticipant:
+		// ParticipantName, FacilityName (empty for all), MatchMode (1 byte)
+		buf = writeString(buf, req.ParticipantName)
+		buf = writeString(buf, req.FacilityName)
+		buf = append(buf, req.MatchMode)
+
+	case OpRegisterUser:
+		// Username
+		buf = writeString(buf, req.Username)
+		// Password (may be empty)
+		buf = writeString(buf, req.Password)
+
+	case OpKeepalive, OpListMonitors, OpGetServerInfo:
+		// No body
+
+	case OpPing:
+		// PingTime (8 bytes)
+		tmp8 := make([]byte, 8)
+		binary.BigEndian.PutUint64(tmp8, uint64(req.PingTime))
+		buf = append(buf, tmp8...)
+
+	case OpRebindMonitor:
+		// MonitorToken
+		buf = writeString(buf, req.MonitorToken)
+
+	case OpResendCallbacks, OpQueryChanges:
+		// FacilityName
+		buf = writeString(buf, req.FacilityName)
+		// SinceSeq (8 bytes)
+		tmp8 := make([]byte, 8)
+		binary.BigEndian.PutUint64(tmp8, req.SinceSeq)
+		buf = append(buf, tmp8...)
+
+	case OpHello:
+		// Protocol version + capability bits (1 byte each)
+		buf = append(buf, req.HelloVersion, req.HelloCapabilities)
+
+	case OpBatch:
+		// Count + length-prefixed sub-requests
+		var err error
+		if buf, err = marshalBatchRequests(buf, req.Batch); err != nil {
+			return nil, err
+		}
+
 	default:
-		return nil, fmt.Errorf("unknown OpCode %d", req.OpCode)
+		return nil, fmt.Errorf("cannot encode a request with OpCode %s", OpName(req.OpCode))
 	}
 
-	return buf, nil
+	// 4) Extensions: optional fields as TLVs, then any the caller added
+	ext := append(Extensions(nil), req.Extensions...)
+	if req.Timestamp != 0 {
+		ext.PutUint64(ExtTimestamp, uint64(req.Timestamp))
+	}
+	if req.OpCode == OpMonitorAvailability && len(req.DaysList) > 0 {
+		days, err := appendDaysList(nil, req.DaysList)
+		if err != nil {
+			return nil, err
+		}
+		ext.Put(ExtMonitorDays, days)
+	}
+	if req.OpCode == OpMonitorAvailability && req.EventMask != 0 && req.EventMask != AllEvents {
+		ext.Put(ExtMonitorEvents, []byte{req.EventMask})
+	}
+	if req.OpCode == OpQueryAvailability && len(req.MoreFacilities) > 0 {
+		names, err := appendStringList(nil, req.MoreFacilities)
+		if err != nil {
+			return nil, err
+		}
+		ext.Put(ExtMoreFacilities, names)
+	}
+	if req.OpCode == OpQueryAvailability && req.Bitmap {
+		ext.Put(ExtQueryBitmap, nil)
+	}
+	if req.OpCode == OpBookFacility && req.IdempotencyKey != "" {
+		ext.Put(ExtIdempotencyKey, []byte(req.IdempotencyKey))
+	}
+	if req.OpCode == OpChangeBooking && req.WholeDays {
+		ext.Put(ExtWholeDays, nil)
+	}
+	if req.OpCode == OpChangeBooking && req.EndOnly {
+		ext.Put(ExtEndOnly, nil)
+	}
+	if (req.OpCode == OpChangeBooking || req.OpCode == OpCancelBooking) && req.Force {
+		ext.Put(ExtForce, nil)
+	}
+	if (req.OpCode == OpBookFacility || req.OpCode == OpChangeBooking) && req.DryRun {
+		ext.Put(ExtDryRun, nil)
+	}
+	if req.Namespace != "" && req.Namespace != DefaultNamespace {
+		ext.Put(ExtNamespace, []byte(req.Namespace))
+	}
+	if req.OpCode == OpRegisterUser && req.ClientInstance != "" {
+		ext.Put(ExtClientInstance, []byte(req.ClientInstance))
+	}
+	return appendExtensions(buf, ext)
 }
 func UnmarshalRequest(data []byte) (RequestMessage, error) {
 	var req RequestMessage
-	offset := 0
+
+	// Magic (2 bytes); anything else is not one of our packets
+	if !HasMagic(data) {
+		return req, ErrBadMagic
+	}
+	offset := MagicSize
 
 	// 1) OpCode (1 byte)
-	if len(data) < 1 {
+	if offset+1 > len(data) {
 		return req, fmt.Errorf("data too short for opcode")
 	}
 	req.OpCode = data[offset]
@@ -90,6 +297,41 @@ func UnmarshalRequest(data []byte) (RequestMessage, error) {
 	req.RequestID = binary.BigEndian.Uint64(data[offset : offset+8])
 	offset += 8
 
+	// Flags (1 byte)
+	if offset+1 > len(data) {
+		return req, fmt.Errorf("data too short for flags")
+	}
+	req.Flags = data[offset]
+	offset++
+
+	// Optional session token
+	if req.Flags&FlagSession != 0 {
+		token, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.SessionToken = token
+		offset = newOffset
+	}
+
+	// Optional semantics hint
+	if req.Flags&FlagSemantics != 0 {
+		if offset+1 > len(data) {
+			return req, fmt.Errorf("not enough bytes for semantics hint")
+		}
+		req.Semantics = data[offset]
+		offset++
+	}
+
+	// Optional capability byte
+	if req.Flags&FlagCapabilities != 0 {
+		if offset+1 > len(data) {
+			return req, fmt.Errorf("not enough bytes for capabilities")
+		}
+		req.Capabilities = data[offset]
+		offset++
+	}
+
 	// 3) Switch on OpCode
 	switch req.OpCode {
 
@@ -103,16 +345,9 @@ func UnmarshalRequest(data []byte) (RequestMessage, error) {
 		offset = newOffset
 
 		// DaysList
-		if offset+1 > len(data) {
-			return req, fmt.Errorf("not enough bytes for days count")
-		}
-		ndays := int(data[offset])
-		offset++
-		if offset+ndays > len(data) {
-			return req, fmt.Errorf("not enough bytes for days list")
+		if req.DaysList, offset, err = readDaysList(data, offset); err != nil {
+			return req, err
 		}
-		req.DaysList = data[offset : offset+ndays]
-		offset += ndays
 
 	case OpBookFacility:
 		// FacilityName
@@ -135,6 +370,73 @@ func UnmarshalRequest(data []byte) (RequestMessage, error) {
 		req.EndMinute = data[offset+5]
 		offset += 6
 
+	case OpAddBlackout:
+		// FacilityName
+		facName, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset
+
+		// StartDay/Hour/Minute + EndDay/Hour/Minute
+		if offset+6 > len(data) {
+			return req, fmt.Errorf("not enough bytes for blackout times")
+		}
+		req.StartDay = data[offset]
+		req.StartHour = data[offset+1]
+		req.StartMinute = data[offset+2]
+		req.EndDay = data[offset+3]
+		req.EndHour = data[offset+4]
+		req.EndMinute = data[offset+5]
+		offset += 6
+
+		// Reason
+		reason, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.Reason = reason
+		offset = newOffset
+
+	case OpListBookings:
+		// FacilityName
+		facName, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset
+
+		// PageOffset (4 bytes) + PageLimit (2 bytes)
+		if offset+6 > len(data) {
+			return req, fmt.Errorf("not enough bytes for the page")
+		}
+		req.PageOffset = binary.BigEndian.Uint32(data[offset : offset+4])
+		req.PageLimit = binary.BigEndian.Uint16(data[offset+4 : offset+6])
+		offset += 6
+
+	case OpClearBookings:
+		// FacilityName
+		facName, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset
+
+		// DaysList
+		if req.DaysList, offset, err = readDaysList(data, offset); err != nil {
+			return req, err
+		}
+
+		// Confirmation
+		if offset >= len(data) {
+			return req, fmt.Errorf("not enough bytes for the confirmation")
+		}
+		req.Confirm = data[offset] != 0
+		offset++
+
 	case OpChangeBooking:
 		// Read ConfirmationID.
 		confID, newOffset, err := readString(data, offset)
@@ -193,8 +495,320 @@ func UnmarshalRequest(data []byte) (RequestMessage, error) {
 		req.ParticipantName = part
 		offset = newOffset2
 
+	case OpSplitBooking:
+		// ConfirmationID
+		confID, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.ConfirmationID = confID
+		offset = newOffset
+
+		// The cut: StartDay/Hour/Minute + EndDay/Hour/Minute
+		if offset+6 > len(data) {
+			return req, fmt.Errorf("not enough bytes for the cut")
+		}
+		req.StartDay = data[offset]
+		req.StartHour = data[offset+1]
+		req.StartMinute = data[offset+2]
+		req.EndDay = data[offset+3]
+		req.EndHour = data[offset+4]
+		req.EndMinute = data[offset+5]
+		offset += 6
+
+	case OpHeatmap:
+		// FacilityName (empty for all)
+		facName, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset
+
+	case OpFreeBusy:
+		// The window: StartDay/Hour/Minute + EndDay/Hour/Minute
+		if offset+6 > len(data) {
+			return req, fmt.Errorf("not enough bytes for the window")
+		}
+		req.StartDay = data[offset]
+		req.StartHour = data[offset+1]
+		req.StartMinute = data[offset+2]
+		req.EndDay = data[offset+3]
+		req.EndHour = data[offset+4]
+		req.EndMinute = data[offset+5]
+		offset += 6
+
+	case OpCopyBooking:
+		// ConfirmationID
+		confID, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.ConfirmationID = confID
+		offset = newOffset
+
+		// The day the copy starts
+		if offset >= len(data) {
+			return req, fmt.Errorf("not enough bytes for the target day")
+		}
+		req.StartDay = data[offset]
+		offset++
+
+	case OpTransferBooking:
+		// ConfirmationID
+		confID, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.ConfirmationID = confID
+		offset = newOffset
+
+		// Target FacilityName
+		facName, newOffset2, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset2
+
+	case OpRenameFacility:
+		// FacilityName
+		facName, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset
+
+		// NewFacilityName
+		newName, newOffset2, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.NewFacilityName = newName
+		offset = newOffset2
+
+	case OpCreateNamespace:
+		// TargetNamespace
+		ns, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.TargetNamespace = ns
+		offset = newOffset
+
+		// Facility names
+		if req.MoreFacilities, offset, err = readStringList(data, offset); err != nil {
+			return req, err
+		}
+
+	case OpDeleteNamespace:
+		// TargetNamespace
+		ns, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.TargetNamespace = ns
+		offset = newOffset
+
+		// Confirmation
+		if offset >= len(data) {
+			return req, fmt.Errorf("not enough bytes for the confirmation")
+		}
+		req.Confirm = data[offset] != 0
+		offset++
+
+	case OpApproveBooking:
+		// ConfirmationID
+		confID, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.ConfirmationID = confID
+		offset = newOffset
+
+	case OpRejectBooking:
+		// ConfirmationID
+		confID, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.ConfirmationID = confID
+		offset = newOffset
+
+		// Reason
+		reason, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.Reason = reason
+		offset = newOffset
+
+	case OpFindParticipant:
+		// ParticipantName
+		part, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.ParticipantName = part
+		offset = newOffset
+
+		// FacilityName
+		facName, newOffset2, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset2
+
+		// MatchMode
+		if offset >= len(data) {
+			return req, fmt.Errorf("not enough bytes for the match mode")
+		}
+		req.MatchMode = data[offset]
+		offset++
+
+	case OpRegisterUser:
+		// Username
+		user, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.Username = user
+		offset = newOffset
+
+		// Password
+		pass, newOffset2, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.Password = pass
+		offset = newOffset2
+
+	case OpKeepalive, OpListMonitors, OpGetServerInfo:
+		// No body
+
+	case OpPing:
+		// PingTime (8 bytes)
+		if offset+8 > len(data) {
+			return req, fmt.Errorf("not enough bytes for ping time")
+		}
+		req.PingTime = int64(binary.BigEndian.Uint64(data[offset : offset+8]))
+		offset += 8
+
+	case OpRebindMonitor:
+		// MonitorToken
+		token, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.MonitorToken = token
+		offset = newOffset
+
+	case OpResendCallbacks, OpQueryChanges:
+		// FacilityName
+		facName, newOffset, err := readString(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.FacilityName = facName
+		offset = newOffset
+
+		// SinceSeq (8 bytes)
+		if offset+8 > len(data) {
+			return req, fmt.Errorf("not enough bytes for sequence number")
+		}
+		req.SinceSeq = binary.BigEndian.Uint64(data[offset : offset+8])
+		offset += 8
+
+	case OpHello:
+		// Protocol version + capability bits
+		if offset+2 > len(data) {
+			return req, fmt.Errorf("not enough bytes for hello")
+		}
+		req.HelloVersion = data[offset]
+		req.HelloCapabilities = data[offset+1]
+		offset += 2
+
+	case OpBatch:
+		// Count + length-prefixed sub-requests
+		batch, newOffset, err := unmarshalBatchRequests(data, offset)
+		if err != nil {
+			return req, err
+		}
+		req.Batch = batch
+		offset = newOffset
+
 	default:
-		return req, fmt.Errorf("unknown OpCode %d", req.OpCode)
+		return req, fmt.Errorf("cannot decode a request with OpCode %s", OpName(req.OpCode))
+	}
+
+	// 4) Extensions; known tags fill their fields, unknown ones are kept
+	ext, _, err := readExtensions(data, offset)
+	if err != nil {
+		return req, err
+	}
+	if ts, ok := ext.Uint64(ExtTimestamp); ok {
+		req.Timestamp = int64(ts)
+		ext.Delete(ExtTimestamp)
+	}
+	if raw, ok := ext.Get(ExtMonitorDays); ok && req.OpCode == OpMonitorAvailability {
+		days, n, err := readDaysList(raw, 0)
+		if err != nil || n != len(raw) {
+			return req, fmt.Errorf("malformed monitor days extension")
+		}
+		req.DaysList = days
+		ext.Delete(ExtMonitorDays)
+	}
+	if raw, ok := ext.Get(ExtMonitorEvents); ok && req.OpCode == OpMonitorAvailability {
+		if len(raw) != 1 {
+			return req, fmt.Errorf("malformed monitor events extension")
+		}
+		req.EventMask = raw[0]
+		ext.Delete(ExtMonitorEvents)
+	}
+	if raw, ok := ext.Get(ExtMoreFacilities); ok && req.OpCode == OpQueryAvailability {
+		names, n, err := readStringList(raw, 0)
+		if err != nil || n != len(raw) {
+			return req, fmt.Errorf("malformed facilities extension")
+		}
+		req.MoreFacilities = names
+		ext.Delete(ExtMoreFacilities)
+	}
+	if _, ok := ext.Get(ExtQueryBitmap); ok && req.OpCode == OpQueryAvailability {
+		req.Bitmap = true
+		ext.Delete(ExtQueryBitmap)
+	}
+	if raw, ok := ext.Get(ExtIdempotencyKey); ok && req.OpCode == OpBookFacility {
+		req.IdempotencyKey = string(raw)
+		ext.Delete(ExtIdempotencyKey)
+	}
+	if _, ok := ext.Get(ExtWholeDays); ok && req.OpCode == OpChangeBooking {
+		req.WholeDays = true
+		ext.Delete(ExtWholeDays)
+	}
+	if _, ok := ext.Get(ExtEndOnly); ok && req.OpCode == OpChangeBooking {
+		req.EndOnly = true
+		ext.Delete(ExtEndOnly)
+	}
+	if _, ok := ext.Get(ExtForce); ok && (req.OpCode == OpChangeBooking || req.OpCode == OpCancelBooking) {
+		req.Force = true
+		ext.Delete(ExtForce)
+	}
+	if _, ok := ext.Get(ExtDryRun); ok && (req.OpCode == OpBookFacility || req.OpCode == OpChangeBooking) {
+		req.DryRun = true
+		ext.Delete(ExtDryRun)
+	}
+	if raw, ok := ext.Get(ExtNamespace); ok {
+		req.Namespace = string(raw)
+		ext.Delete(ExtNamespace)
+	}
+	if raw, ok := ext.Get(ExtClientInstance); ok && req.OpCode == OpRegisterUser {
+		req.ClientInstance = string(raw)
+		ext.Delete(ExtClientInstance)
+	}
+	if len(ext) > 0 {
+		req.Extensions = ext
 	}
 
 	return req, nil
@@ -202,6 +816,9 @@ func UnmarshalRequest(data []byte) (RequestMessage, error) {
 func MarshalReply(rep ReplyMessage) ([]byte, error) {
 	buf := make([]byte, 0, 64)
 
+	// Magic (2 bytes)
+	buf = append(buf, Magic[:]...)
+
 	// OpCode (1 byte)
 	buf = append(buf, rep.OpCode)
 
@@ -210,22 +827,65 @@ func MarshalReply(rep ReplyMessage) ([]byte, error) {
 	binary.BigEndian.PutUint64(tmp, rep.RequestID)
 	buf = append(buf, tmp...)
 
+	// Flags (1 byte)
+	buf = append(buf, rep.Flags)
+
 	// Status (4 bytes)
 	tmp4 := make([]byte, 4)
 	binary.BigEndian.PutUint32(tmp4, uint32(rep.Status))
 	buf = append(buf, tmp4...)
 
-	// Data (2-byte length + bytes)
-	buf = writeString(buf, rep.Data)
+	// Data (2-byte length + bytes), gzip-compressed if FlagCompressed is set
+	// and that actually saves space
+	data := rep.Data
+	if rep.Flags&FlagCompressed != 0 {
+		packed, err := compressData(rep.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(packed) < len(data) {
+			data = packed
+		} else {
+			buf[flagsOffset] &^= FlagCompressed
+		}
+	}
+	if len(data) > 0xFFFF {
+		return nil, fmt.Errorf("reply data of %d bytes is too large", len(data))
+	}
+	buf = writeString(buf, data)
+
+	// Batch replies: count + length-prefixed sub-replies
+	if rep.OpCode == OpBatch {
+		var err error
+		if buf, err = marshalBatchReplies(buf, rep.Replies); err != nil {
+			return nil, err
+		}
+	}
 
-	return buf, nil
+	// Extensions
+	ext := rep.Extensions
+	if rep.ServerMicros > 0 || rep.ServerClock > 0 {
+		ext = append(Extensions(nil), rep.Extensions...)
+	}
+	if rep.ServerMicros > 0 {
+		ext.PutUint64(ExtServerTime, rep.ServerMicros)
+	}
+	if rep.ServerClock > 0 {
+		ext.PutUint64(ExtServerClock, uint64(rep.ServerClock))
+	}
+	return appendExtensions(buf, ext)
 }
 func UnmarshalReply(data []byte) (ReplyMessage, error) {
 	var rep ReplyMessage
-	offset := 0
+
+	// Magic (2 bytes)
+	if !HasMagic(data) {
+		return rep, ErrBadMagic
+	}
+	offset := MagicSize
 
 	// OpCode (1 byte)
-	if len(data) < 1 {
+	if offset+1 > len(data) {
 		return rep, fmt.Errorf("reply data too short for opcode")
 	}
 	rep.OpCode = data[offset]
@@ -238,6 +898,13 @@ func UnmarshalReply(data []byte) (ReplyMessage, error) {
 	rep.RequestID = binary.BigEndian.Uint64(data[offset : offset+8])
 	offset += 8
 
+	// Flags (1 byte)
+	if offset+1 > len(data) {
+		return rep, fmt.Errorf("reply too short for flags")
+	}
+	rep.Flags = data[offset]
+	offset++
+
 	// Status (4 bytes)
 	if offset+4 > len(data) {
 		return rep, fmt.Errorf("reply too short for status")
@@ -252,6 +919,38 @@ func UnmarshalReply(data []byte) (ReplyMessage, error) {
 	}
 	rep.Data = str
 	offset = newOffset
+	if rep.Flags&FlagCompressed != 0 {
+		if rep.Data, err = decompressData(str); err != nil {
+			return rep, err
+		}
+	}
+
+	// Batch replies; absent when the envelope was rejected before parsing
+	if rep.OpCode == OpBatch && offset < len(data) {
+		replies, newOffset, err := unmarshalBatchReplies(data, offset)
+		if err != nil {
+			return rep, err
+		}
+		rep.Replies = replies
+		offset = newOffset
+	}
+
+	// Extensions
+	ext, _, err := readExtensions(data, offset)
+	if err != nil {
+		return rep, err
+	}
+	if micros, ok := ext.Uint64(ExtServerTime); ok {
+		rep.ServerMicros = micros
+		ext.Delete(ExtServerTime)
+	}
+	if ms, ok := ext.Uint64(ExtServerClock); ok {
+		rep.ServerClock = int64(ms)
+		ext.Delete(ExtServerClock)
+	}
+	if len(ext) > 0 {
+		rep.Extensions = ext
+	}
 
 	return rep, nil
 }
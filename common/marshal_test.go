@@ -0,0 +1,240 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// monitorReq is a MonitorAvailability request for RoomA.
+func monitorReq() RequestMessage {
+	return RequestMessage{OpCode: OpMonitorAvailability, RequestID: 5, FacilityName: "RoomA", MonitorPeriod: 60}
+}
+
+func TestMonitorDaysRoundTrip(t *testing.T) {
+	for _, days := range [][]uint8{nil, {4}, {0, 2, 6}} {
+		req := monitorReq()
+		req.DaysList = days
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest: %v", err)
+		}
+		got, err := UnmarshalRequest(raw)
+		if err != nil {
+			t.Fatalf("UnmarshalRequest: %v", err)
+		}
+		if len(days) == 0 {
+			if len(got.DaysList) != 0 {
+				t.Errorf("no days read back as %v", got.DaysList)
+			}
+			if plain, _ := MarshalRequest(monitorReq()); !reflect.DeepEqual(raw, plain) {
+				t.Error("an empty days list changed the encoding")
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got.DaysList, days) || got.FacilityName != "RoomA" || got.MonitorPeriod != 60 {
+			t.Errorf("days %v read back as %+v", days, got)
+		}
+		if len(got.Extensions) != 0 {
+			t.Errorf("days left in Extensions: %+v", got.Extensions)
+		}
+	}
+}
+
+func TestMonitorDaysMalformed(t *testing.T) {
+	for _, value := range [][]byte{{}, {3, 1}, {1, 4, 5}} {
+		req := monitorReq()
+		req.Extensions.Put(ExtMonitorDays, value)
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest: %v", err)
+		}
+		if _, err := UnmarshalRequest(raw); err == nil {
+			t.Errorf("days extension % x accepted", value)
+		}
+	}
+}
+
+// TestMonitorDaysOnlyForMonitors: other operations keep their own DaysList
+// and leave the extension alone.
+func TestMonitorDaysOnlyForMonitors(t *testing.T) {
+	req := RequestMessage{OpCode: OpQueryAvailability, RequestID: 5, FacilityName: "RoomA", DaysList: []uint8{1}}
+	req.Extensions.Put(ExtMonitorDays, []byte{1, 4})
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if !reflect.DeepEqual(got.DaysList, []uint8{1}) {
+		t.Errorf("DaysList = %v, want the query's [1]", got.DaysList)
+	}
+	if _, ok := got.Extensions.Get(ExtMonitorDays); !ok {
+		t.Error("extension of another operation consumed")
+	}
+}
+
+func TestMonitorEventsRoundTrip(t *testing.T) {
+	tests := []struct {
+		mask, want uint8
+		sent       bool // whether the mask goes on the wire
+	}{
+		{0, 0, false},
+		{AllEvents, 0, false},
+		{EventCanceled, EventCanceled, true},
+		{EventCreated | EventChanged, EventCreated | EventChanged, true},
+	}
+	for _, tt := range tests {
+		req := monitorReq()
+		req.EventMask = tt.mask
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest: %v", err)
+		}
+		got, err := UnmarshalRequest(raw)
+		if err != nil {
+			t.Fatalf("UnmarshalRequest: %v", err)
+		}
+		if got.EventMask != tt.want {
+			t.Errorf("mask %#x read back as %#x, want %#x", tt.mask, got.EventMask, tt.want)
+		}
+		plain, _ := MarshalRequest(monitorReq())
+		if sent := !reflect.DeepEqual(raw, plain); sent != tt.sent {
+			t.Errorf("mask %#x on the wire = %v, want %v", tt.mask, sent, tt.sent)
+		}
+	}
+
+	req := monitorReq()
+	req.Extensions.Put(ExtMonitorEvents, []byte{1, 2})
+	raw, _ := MarshalRequest(req)
+	if _, err := UnmarshalRequest(raw); err == nil {
+		t.Error("two-byte event mask accepted")
+	}
+}
+
+func TestMoreFacilitiesRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpQueryAvailability, RequestID: 5, FacilityName: "RoomA",
+		MoreFacilities: []string{"Lab1", "", "Hall B"}, DaysList: []uint8{4}}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.FacilityName != "RoomA" || !reflect.DeepEqual(got.MoreFacilities, req.MoreFacilities) || len(got.Extensions) != 0 {
+		t.Errorf("read back as %+v", got)
+	}
+
+	req.MoreFacilities = make([]string, 256)
+	if _, err := MarshalRequest(req); err == nil {
+		t.Error("256 more facilities marshalled")
+	}
+	for _, value := range [][]byte{{}, {2, 0, 4, 'L', 'a', 'b', '1'}, {1, 0, 1, 'x', 'y'}} {
+		req := RequestMessage{OpCode: OpQueryAvailability, RequestID: 5, FacilityName: "RoomA"}
+		req.Extensions.Put(ExtMoreFacilities, value)
+		raw, _ := MarshalRequest(req)
+		if _, err := UnmarshalRequest(raw); err == nil {
+			t.Errorf("facilities extension % x accepted", value)
+		}
+	}
+}
+
+// TestServerTimeRoundTrip: the processing time survives a round trip, is
+// not sent when 0, and marshalling does not add it to the caller's
+// Extensions.
+func TestServerTimeRoundTrip(t *testing.T) {
+	rep := ReplyMessage{RequestID: 5, OpCode: OpBookFacility, Data: "Booked", ServerMicros: 1234}
+	rep.Extensions.PutString(ExtSemantics, "at-most-once")
+	raw, err := MarshalReply(rep)
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	if len(rep.Extensions) != 1 {
+		t.Errorf("MarshalReply changed the reply's extensions to %v", rep.Extensions)
+	}
+	got, err := UnmarshalReply(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalReply: %v", err)
+	}
+	if got.ServerMicros != 1234 || len(got.Extensions) != 1 {
+		t.Errorf("read back as %+v", got)
+	}
+
+	rep = ReplyMessage{RequestID: 5, OpCode: OpBookFacility, Data: "Booked"}
+	withoutTime, _ := MarshalReply(rep)
+	got, _ = UnmarshalReply(withoutTime)
+	if _, sent := got.Extensions.Get(ExtServerTime); sent || got.ServerMicros != 0 || len(withoutTime) >= len(raw) {
+		t.Errorf("0 server time sent: %+v", got)
+	}
+}
+
+func TestDryRunRoundTrip(t *testing.T) {
+	for _, req := range []RequestMessage{
+		{OpCode: OpBookFacility, RequestID: 6, FacilityName: "RoomA", StartHour: 9, EndHour: 10, DryRun: true},
+		{OpCode: OpChangeBooking, RequestID: 7, ConfirmationID: "BKG-10000", OffsetMinutes: 60, DryRun: true},
+	} {
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest: %v", err)
+		}
+		got, err := UnmarshalRequest(raw)
+		if err != nil {
+			t.Fatalf("UnmarshalRequest: %v", err)
+		}
+		if !got.DryRun || len(got.Extensions) != 0 {
+			t.Errorf("%s read back as %+v", OpName(req.OpCode), got)
+		}
+		if got.IsMutating() {
+			t.Errorf("dry %s counts as mutating", OpName(req.OpCode))
+		}
+	}
+
+	// Other operations have no dry run; the flag is not sent
+	cancel := RequestMessage{OpCode: OpCancelBooking, RequestID: 8, ConfirmationID: "BKG-10000"}
+	plain, _ := MarshalRequest(cancel)
+	cancel.DryRun = true
+	if raw, _ := MarshalRequest(cancel); !reflect.DeepEqual(raw, plain) {
+		t.Error("a dry-run flag on a cancel was encoded")
+	}
+}
+
+func TestServerClockRoundTrip(t *testing.T) {
+	rep := ReplyMessage{RequestID: 5, OpCode: OpPing, Data: "17", ServerClock: 1700000000123, ServerMicros: 9}
+	raw, err := MarshalReply(rep)
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	got, err := UnmarshalReply(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalReply: %v", err)
+	}
+	if got.ServerClock != rep.ServerClock || got.ServerMicros != 9 || len(got.Extensions) != 0 {
+		t.Errorf("read back as %+v", got)
+	}
+	if rep.Extensions != nil {
+		t.Errorf("MarshalReply changed the reply's extensions to %v", rep.Extensions)
+	}
+}
+
+// TestDaysListOwnsItsBytes: the decoded DaysList is not a view of the
+// packet, so reusing the receive buffer leaves it intact.
+func TestDaysListOwnsItsBytes(t *testing.T) {
+	req := RequestMessage{OpCode: OpQueryAvailability, RequestID: 5, FacilityName: "RoomA", DaysList: []uint8{1, 4}}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	for i := range raw {
+		raw[i] = 0xFF
+	}
+	if !reflect.DeepEqual(got.DaysList, []uint8{1, 4}) {
+		t.Errorf("DaysList is %v after the buffer was overwritten", got.DaysList)
+	}
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MonitorInfo describes one active subscription in an OpListMonitors reply.
+type MonitorInfo struct {
+	Facility   string
+	Subscriber string // client address, followed by the user in brackets if any
+	Remaining  time.Duration
+	Days       []uint8 // empty for all days
+	Events     uint8   // Event* bits; 0 for all events
+	Failures   int     // callbacks that could not be sent
+}
+
+// FormatMonitorList encodes subscriptions as the Data of an OpListMonitors
+// reply: one line per subscription with tab-separated fields.
+func FormatMonitorList(monitors []MonitorInfo) string {
+	var b strings.Builder
+	for _, m := range monitors {
+		days := make([]string, len(m.Days))
+		for i, d := range m.Days {
+			days[i] = strconv.Itoa(int(d))
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%d\t%s\t%d\t%d\n", m.Facility, m.Subscriber,
+			int64(m.Remaining/time.Second), strings.Join(days, ","), m.Events, m.Failures)
+	}
+	return b.String()
+}
+
+// ParseMonitorList decodes the Data of an OpListMonitors reply.
+func ParseMonitorList(data string) ([]MonitorInfo, error) {
+	var monitors []MonitorInfo
+	for n, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 6 {
+			return nil, fmt.Errorf("line %d: want 6 fields, got %d", n+1, len(f))
+		}
+		m := MonitorInfo{Facility: f[0], Subscriber: f[1]}
+		secs, err1 := strconv.ParseInt(f[2], 10, 64)
+		events, err2 := strconv.ParseUint(f[4], 10, 8)
+		failures, err3 := strconv.Atoi(f[5])
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("line %d: malformed number", n+1)
+		}
+		m.Remaining = time.Duration(secs) * time.Second
+		m.Events = uint8(events)
+		m.Failures = failures
+		if f[3] != "" {
+			for _, d := range strings.Split(f[3], ",") {
+				day, err := strconv.ParseUint(d, 10, 8)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: malformed day %q", n+1, d)
+				}
+				m.Days = append(m.Days, uint8(day))
+			}
+		}
+		monitors = append(monitors, m)
+	}
+	return monitors, nil
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMonitorListRoundTrip(t *testing.T) {
+	monitors := []MonitorInfo{
+		{Facility: "RoomA", Subscriber: "127.0.0.1:5000", Remaining: 59 * time.Second, Days: []uint8{1, 4}, Events: EventCreated | EventCanceled},
+		{Facility: "physics/Lab1", Subscriber: "10.0.0.2:6000 (bob)", Remaining: time.Hour, Failures: 3},
+	}
+	got, err := ParseMonitorList(FormatMonitorList(monitors))
+	if err != nil {
+		t.Fatalf("ParseMonitorList: %v", err)
+	}
+	if !reflect.DeepEqual(got, monitors) {
+		t.Errorf("round trip gave %+v, want %+v", got, monitors)
+	}
+	if got, err := ParseMonitorList(FormatMonitorList(nil)); err != nil || len(got) != 0 {
+		t.Errorf("empty list: %+v, %v", got, err)
+	}
+}
+
+func TestParseMonitorListMalformed(t *testing.T) {
+	for _, data := range []string{
+		"RoomA\t127.0.0.1:5000\t59\t\t0\n",
+		"RoomA\t127.0.0.1:5000\tsoon\t\t0\t0\n",
+		"RoomA\t127.0.0.1:5000\t59\t\t256\t0\n",
+		"RoomA\t127.0.0.1:5000\t59\tMon\t0\t0\n",
+	} {
+		if got, err := ParseMonitorList(data); err == nil {
+			t.Errorf("ParseMonitorList(%q) = %+v, want an error", data, got)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package common
+
+// DefaultNamespace is the facility catalog of requests that name none. It
+// holds the facilities a server starts with, so clients that know nothing
+// of namespaces work as before.
+const DefaultNamespace = "default"
+
+// NamespaceOf returns the namespace a request works in.
+func (r RequestMessage) NamespaceOf() string {
+	if r.Namespace == "" {
+		return DefaultNamespace
+	}
+	return r.Namespace
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNamespaceRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpBookFacility, RequestID: 3, FacilityName: "RoomA", StartDay: 1, StartHour: 9, EndDay: 1, EndHour: 10}
+	plain, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	// The default namespace is not written, so older servers see the
+	// request they always did
+	req.Namespace = DefaultNamespace
+	if raw, _ := MarshalRequest(req); !bytes.Equal(raw, plain) {
+		t.Error("the default namespace changed the encoding")
+	}
+	if got, _ := UnmarshalRequest(plain); got.Namespace != "" || got.NamespaceOf() != DefaultNamespace {
+		t.Errorf("request without a namespace read back in %q", got.Namespace)
+	}
+
+	req.Namespace = "physics"
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.Namespace != "physics" || got.NamespaceOf() != "physics" || got.FacilityName != "RoomA" {
+		t.Errorf("read back as %+v", got)
+	}
+	if _, ok := got.Extensions.Get(ExtNamespace); ok {
+		t.Error("the namespace extension was left among the unknown ones")
+	}
+}
+
+func TestNamespaceAdminRoundTrip(t *testing.T) {
+	for _, req := range []RequestMessage{
+		{OpCode: OpCreateNamespace, RequestID: 4, TargetNamespace: "physics", MoreFacilities: []string{"RoomA", "Cryo Lab"}},
+		{OpCode: OpDeleteNamespace, RequestID: 5, TargetNamespace: "physics", Confirm: true},
+		{OpCode: OpDeleteNamespace, RequestID: 6, TargetNamespace: "physics"},
+	} {
+		raw, err := MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest %s: %v", OpName(req.OpCode), err)
+		}
+		got, err := UnmarshalRequest(raw)
+		if err != nil {
+			t.Fatalf("UnmarshalRequest %s: %v", OpName(req.OpCode), err)
+		}
+		if got.TargetNamespace != req.TargetNamespace || got.Confirm != req.Confirm ||
+			!reflect.DeepEqual(got.MoreFacilities, req.MoreFacilities) {
+			t.Errorf("%s read back as %+v", OpName(req.OpCode), got)
+		}
+		if _, err := UnmarshalRequest(raw[:len(raw)-1]); err == nil {
+			t.Errorf("cut %s accepted", OpName(req.OpCode))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// Occupied is one booking or closure in an ExtOccupied query reply. ID is
+// the booking's confirmation ID, or empty for a blackout or a stretch in
+// which a pool facility is fully booked.
+type Occupied struct {
+	ID       string
+	Interval schedule.Interval
+}
+
+// AppendOccupied encodes entries for ExtOccupied: a 2-byte count, then per
+// entry a 1-byte ID length, the ID, and the start and end as 4-byte minutes
+// since Monday 00:00.
+func AppendOccupied(buf []byte, entries []Occupied) ([]byte, error) {
+	if len(entries) > 0xFFFF {
+		return nil, fmt.Errorf("too many occupied intervals (max %d)", 0xFFFF)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		if len(e.ID) > 255 {
+			return nil, fmt.Errorf("confirmation ID of %d bytes is too long", len(e.ID))
+		}
+		buf = append(buf, byte(len(e.ID)))
+		buf = append(buf, e.ID...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(e.Interval.Start))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(e.Interval.End))
+	}
+	return buf, nil
+}
+
+// ParseOccupied decodes an ExtOccupied value.
+func ParseOccupied(raw []byte) ([]Occupied, error) {
+	if len(raw) < 2 {
+		return nil, fmt.Errorf("occupied list of %d bytes has no count", len(raw))
+	}
+	n := int(binary.BigEndian.Uint16(raw))
+	entries := make([]Occupied, 0, n)
+	rest := raw[2:]
+	for i := 0; i < n; i++ {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0])+8 {
+			return nil, fmt.Errorf("occupied entry %d of %d is truncated", i, n)
+		}
+		idLen := int(rest[0])
+		e := Occupied{ID: string(rest[1 : 1+idLen])}
+		e.Interval.Start = int32(binary.BigEndian.Uint32(rest[1+idLen:]))
+		e.Interval.End = int32(binary.BigEndian.Uint32(rest[5+idLen:]))
+		entries = append(entries, e)
+		rest = rest[9+idLen:]
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d bytes after %d occupied entries", len(rest), n)
+	}
+	return entries, nil
+}
+
+// OccupiedOf returns the bookings and closures listed in a query reply; ok
+// is false if the reply has none, e.g. from an older server.
+func OccupiedOf(rep ReplyMessage) (entries []Occupied, ok bool, err error) {
+	raw, ok := rep.Extensions.Get(ExtOccupied)
+	if !ok {
+		return nil, false, nil
+	}
+	entries, err = ParseOccupied(raw)
+	return entries, true, err
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+func TestOccupiedRoundTrip(t *testing.T) {
+	entries := []Occupied{
+		{ID: "BKG-1", Interval: schedule.Span(0, 9, 0, 0, 10, 0)},
+		{Interval: schedule.Span(5, 8, 0, 5, 12, 0)}, // a blackout
+		{ID: "0b6f4d0e-8f1a-4c3e-9a57-3d2b1f0e6c42", Interval: schedule.Span(6, 22, 0, 7, 0, 0)},
+	}
+	raw, err := AppendOccupied(nil, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseOccupied(raw)
+	if err != nil || !reflect.DeepEqual(got, entries) {
+		t.Fatalf("ParseOccupied = %+v, %v; want %+v", got, err, entries)
+	}
+	if got, err := ParseOccupied([]byte{0, 0}); err != nil || len(got) != 0 {
+		t.Errorf("empty list: %v, %v", got, err)
+	}
+	for _, bad := range [][]byte{nil, {0}, raw[:len(raw)-1], append(raw, 0)} {
+		if _, err := ParseOccupied(bad); err == nil {
+			t.Errorf("ParseOccupied(% x) accepted", bad)
+		}
+	}
+}
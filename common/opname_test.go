@@ -0,0 +1,71 @@
+package common
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestOpNameEveryConstant reads the Op constants from types.go, so a new
+// operation without a name fails here, and checks each is named after its
+// constant.
+func TestOpNameEveryConstant(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "types.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := 0
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if !strings.HasPrefix(name.Name, "Op") || i >= len(vs.Values) {
+					continue
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok {
+					t.Fatalf("%s is not a literal", name.Name)
+				}
+				op, err := strconv.ParseUint(lit.Value, 0, 8)
+				if err != nil {
+					t.Fatalf("%s = %s: %v", name.Name, lit.Value, err)
+				}
+				if got, want := OpName(uint8(op)), strings.TrimPrefix(name.Name, "Op"); got != want {
+					t.Errorf("OpName(%s) = %q, want %q", name.Name, got, want)
+				}
+				seen++
+			}
+		}
+	}
+	if seen != len(opNames) {
+		t.Errorf("%d Op constants, %d names", seen, len(opNames))
+	}
+}
+
+func TestOpNameUnknown(t *testing.T) {
+	for op, want := range map[uint8]string{0: "unknown(0)", 31: "unknown(31)", 99: "unknown(99)", 255: "unknown(255)"} {
+		if got := OpName(op); got != want {
+			t.Errorf("OpName(%d) = %q, want %q", op, got, want)
+		}
+	}
+	if OpName(OpCallback) != "Callback" || OpName(OpBatch) != "Batch" {
+		t.Errorf("OpName: %q, %q", OpName(OpCallback), OpName(OpBatch))
+	}
+
+	_, err := MarshalRequest(RequestMessage{OpCode: 99, RequestID: 1})
+	if err == nil || !strings.Contains(err.Error(), "unknown(99)") {
+		t.Errorf("marshalling OpCode 99: %v", err)
+	}
+	raw, _ := MarshalRequest(RequestMessage{OpCode: OpPing, RequestID: 1})
+	raw[len(Magic)] = 99
+	if _, err := UnmarshalRequest(raw); err == nil || !strings.Contains(err.Error(), "unknown(99)") {
+		t.Errorf("unmarshalling OpCode 99: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package common
+
+import "testing"
+
+func TestRenameFacilityRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpRenameFacility, RequestID: 9, FacilityName: "RoomA", NewFacilityName: "Meeting Room 3.01"}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.FacilityName != "RoomA" || got.NewFacilityName != "Meeting Room 3.01" {
+		t.Errorf("read back as %+v", got)
+	}
+	if _, err := UnmarshalRequest(raw[:len(raw)-1]); err == nil {
+		t.Error("request with a cut new name accepted")
+	}
+}
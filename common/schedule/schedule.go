@@ -0,0 +1,173 @@
+// Package schedule converts between week times and minutes and works with
+// the half-open intervals that bookings and closures occupy. Times are
+// minutes since Monday 00:00; days are 0=Monday..6=Sunday.
+package schedule
+
+import "sort"
+
+// Lengths of the booking week in minutes.
+const (
+	DayMinutes  = 24 * 60
+	WeekMinutes = 7 * DayMinutes
+)
+
+// Interval is the stretch of minutes [Start, End) since Monday 00:00. It
+// includes its start but not its end, so a booking until 10:00 and one from
+// 10:00 do not overlap. An interval with End <= Start is empty.
+type Interval struct {
+	Start, End int32
+}
+
+// ToMinutes converts a day, hour and minute to minutes since Monday 00:00.
+func ToMinutes(day, hour, minute uint8) int32 {
+	return int32(day)*DayMinutes + int32(hour)*60 + int32(minute)
+}
+
+// FromMinutes converts minutes since Monday 00:00 back to a day, hour and
+// minute; it is the inverse of ToMinutes.
+func FromMinutes(m int32) (day, hour, minute uint8) {
+	return uint8(m / DayMinutes), uint8(m % DayMinutes / 60), uint8(m % 60)
+}
+
+// Span returns the interval between two week times.
+func Span(startDay, startHour, startMinute, endDay, endHour, endMinute uint8) Interval {
+	return Interval{ToMinutes(startDay, startHour, startMinute), ToMinutes(endDay, endHour, endMinute)}
+}
+
+// Day returns the whole of day d, from its 00:00 to the next day's.
+func Day(d uint8) Interval {
+	start := int32(d) * DayMinutes
+	return Interval{start, start + DayMinutes}
+}
+
+// Empty reports whether the interval contains no minute.
+func (iv Interval) Empty() bool {
+	return iv.End <= iv.Start
+}
+
+// Overlaps reports whether the intervals share at least one minute.
+func (iv Interval) Overlaps(o Interval) bool {
+	return !iv.Empty() && !o.Empty() && iv.Start < o.End && o.Start < iv.End
+}
+
+// Intersect returns the minutes the intervals share, which may be empty.
+func (iv Interval) Intersect(o Interval) Interval {
+	if o.Start > iv.Start {
+		iv.Start = o.Start
+	}
+	if o.End < iv.End {
+		iv.End = o.End
+	}
+	return iv
+}
+
+// IntersectsDays reports whether the interval covers a minute of any of the
+// days. Every day strictly inside a multi-day interval counts, and one that
+// ends at 00:00 does not touch the day it ends on.
+func (iv Interval) IntersectsDays(days []uint8) bool {
+	for _, d := range days {
+		if iv.Overlaps(Day(d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the non-empty intervals sorted by start, with overlapping
+// and adjoining ones joined. The input is not modified.
+func Merge(ivs []Interval) []Interval {
+	sorted := make([]Interval, 0, len(ivs))
+	for _, iv := range ivs {
+		if !iv.Empty() {
+			sorted = append(sorted, iv)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	merged := sorted[:0]
+	for _, iv := range sorted {
+		if n := len(merged); n > 0 && iv.Start <= merged[n-1].End {
+			if iv.End > merged[n-1].End {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// BusyOnDay clips the busy intervals to day d and merges them: the result
+// is sorted, disjoint and within the day.
+func BusyOnDay(d uint8, busy []Interval) []Interval {
+	day := Day(d)
+	clipped := make([]Interval, 0, len(busy))
+	for _, iv := range busy {
+		clipped = append(clipped, iv.Intersect(day))
+	}
+	return Merge(clipped)
+}
+
+// FreeOnDay returns the gaps between the busy intervals on day d, sorted.
+// Together with BusyOnDay it tiles the day: every minute is in exactly one
+// of the two lists.
+func FreeOnDay(d uint8, busy []Interval) []Interval {
+	day := Day(d)
+	var free []Interval
+	current := day.Start
+	for _, iv := range BusyOnDay(d, busy) {
+		if iv.Start > current {
+			free = append(free, Interval{current, iv.Start})
+		}
+		current = iv.End
+	}
+	if current < day.End {
+		free = append(free, Interval{current, day.End})
+	}
+	return free
+}
+
+// Level is a stretch of time and the number of intervals covering it.
+type Level struct {
+	Interval
+	Count int
+}
+
+// Levels sweeps over the intervals and returns the stretches covered by at
+// least one of them, sorted, each with how many cover it. A new stretch
+// starts wherever the count changes; an interval ending where another
+// starts does not count twice.
+func Levels(ivs []Interval) []Level {
+	delta := make(map[int32]int)
+	for _, iv := range ivs {
+		if !iv.Empty() {
+			delta[iv.Start]++
+			delta[iv.End]--
+		}
+	}
+	times := make([]int32, 0, len(delta))
+	for t, d := range delta {
+		if d != 0 {
+			times = append(times, t)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	var levels []Level
+	count := 0
+	for i, t := range times {
+		count += delta[t]
+		if count > 0 && i+1 < len(times) {
+			levels = append(levels, Level{Interval{t, times[i+1]}, count})
+		}
+	}
+	return levels
+}
+
+// Peak returns the largest number of intervals that cover the same minute.
+func Peak(ivs []Interval) int {
+	peak := 0
+	for _, l := range Levels(ivs) {
+		peak = max(peak, l.Count)
+	}
+	return peak
+}
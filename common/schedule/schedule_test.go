@@ -0,0 +1,222 @@
+package schedule
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// randomIntervals returns up to n intervals within the week, some empty and
+// some running over several days.
+func randomIntervals(r *rand.Rand, n int) []Interval {
+	ivs := make([]Interval, r.Intn(n+1))
+	for i := range ivs {
+		start := r.Int31n(WeekMinutes)
+		ivs[i] = Interval{start, start + r.Int31n(3*DayMinutes) - 60}
+		if ivs[i].End > WeekMinutes {
+			ivs[i].End = WeekMinutes
+		}
+	}
+	return ivs
+}
+
+// covered marks the minutes of the week inside any of the intervals.
+func covered(ivs []Interval) []bool {
+	in := make([]bool, WeekMinutes)
+	for _, iv := range ivs {
+		for m := max(iv.Start, 0); m < min(iv.End, WeekMinutes); m++ {
+			in[m] = true
+		}
+	}
+	return in
+}
+
+// checkDisjoint fails unless ivs are non-empty, sorted and neither overlap
+// nor adjoin.
+func checkDisjoint(t *testing.T, what string, ivs []Interval) {
+	t.Helper()
+	for i, iv := range ivs {
+		if iv.Empty() {
+			t.Fatalf("%s: empty interval %v in %v", what, iv, ivs)
+		}
+		if i > 0 && iv.Start <= ivs[i-1].End {
+			t.Fatalf("%s: %v is not after %v", what, iv, ivs[i-1])
+		}
+	}
+}
+
+func TestMinutesRoundTrip(t *testing.T) {
+	for m := int32(0); m < WeekMinutes; m++ {
+		d, h, mm := FromMinutes(m)
+		if d > 6 || h > 23 || mm > 59 || ToMinutes(d, h, mm) != m {
+			t.Fatalf("minute %d -> %d %02d:%02d -> %d", m, d, h, mm, ToMinutes(d, h, mm))
+		}
+	}
+}
+
+// TestMergeProperty: merging keeps exactly the minutes of its input and
+// leaves them sorted and disjoint.
+func TestMergeProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		ivs := randomIntervals(r, 8)
+		input := append([]Interval(nil), ivs...)
+		merged := Merge(ivs)
+		checkDisjoint(t, "Merge", merged)
+		want, got := covered(ivs), covered(merged)
+		for m := range want {
+			if want[m] != got[m] {
+				t.Fatalf("Merge(%v) = %v differs at minute %d", ivs, merged, m)
+			}
+		}
+		for j := range ivs {
+			if ivs[j] != input[j] {
+				t.Fatalf("Merge modified its input")
+			}
+		}
+	}
+}
+
+// TestFreeBusyTileTheDay: on every day, each minute is in exactly one of
+// the busy and the free intervals, and is busy exactly when some input
+// interval covers it.
+func TestFreeBusyTileTheDay(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 300; i++ {
+		ivs := randomIntervals(r, 8)
+		inInput := covered(ivs)
+		for d := uint8(0); d < 7; d++ {
+			busy, free := BusyOnDay(d, ivs), FreeOnDay(d, ivs)
+			checkDisjoint(t, "BusyOnDay", busy)
+			checkDisjoint(t, "FreeOnDay", free)
+			inBusy, inFree := covered(busy), covered(free)
+			day := Day(d)
+			for m := int32(0); m < WeekMinutes; m++ {
+				inDay := m >= day.Start && m < day.End
+				switch {
+				case !inDay && (inBusy[m] || inFree[m]):
+					t.Fatalf("day %d of %v: minute %d of another day listed", d, ivs, m)
+				case inDay && inBusy[m] == inFree[m]:
+					t.Fatalf("day %d of %v: minute %d busy=%v free=%v", d, ivs, m, inBusy[m], inFree[m])
+				case inDay && inBusy[m] != inInput[m]:
+					t.Fatalf("day %d of %v: minute %d busy=%v, booked=%v", d, ivs, m, inBusy[m], inInput[m])
+				}
+			}
+		}
+	}
+}
+
+// TestOverlapsProperty compares Overlaps, Intersect and IntersectsDays with
+// minute-by-minute answers.
+func TestOverlapsProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 2000; i++ {
+		pair := randomIntervals(r, 2)
+		for len(pair) < 2 {
+			pair = append(pair, Interval{})
+		}
+		a, b := pair[0], pair[1]
+		share := false
+		ca, cb := covered([]Interval{a}), covered([]Interval{b})
+		for m := range ca {
+			share = share || ca[m] && cb[m]
+		}
+		if a.Overlaps(b) != share || b.Overlaps(a) != share {
+			t.Fatalf("%v.Overlaps(%v) = %v, want %v", a, b, a.Overlaps(b), share)
+		}
+		if a.Intersect(b).Empty() == share {
+			t.Fatalf("%v.Intersect(%v) = %v, sharing=%v", a, b, a.Intersect(b), share)
+		}
+		for d := uint8(0); d < 7; d++ {
+			onDay := false
+			for m := Day(d).Start; m < Day(d).End; m++ {
+				onDay = onDay || ca[m]
+			}
+			if a.IntersectsDays([]uint8{d}) != onDay {
+				t.Fatalf("%v.IntersectsDays(%d) = %v", a, d, !onDay)
+			}
+		}
+	}
+}
+
+func TestIntersectsDays(t *testing.T) {
+	tests := []struct {
+		iv   Interval
+		days []uint8
+		want bool
+	}{
+		{Span(1, 9, 0, 3, 9, 0), []uint8{2}, true},  // a day strictly inside
+		{Span(1, 9, 0, 3, 0, 0), []uint8{3}, false}, // ends at 00:00
+		{Span(1, 9, 0, 3, 0, 0), []uint8{0, 2}, true},
+		{Span(1, 9, 0, 1, 10, 0), []uint8{0, 2}, false},
+		{Span(6, 22, 0, 7, 0, 0), []uint8{6}, true}, // until Sunday 24:00
+		{Span(1, 9, 0, 1, 9, 0), []uint8{1}, false}, // empty
+		{Span(1, 9, 0, 1, 10, 0), nil, false},
+	}
+	for _, tt := range tests {
+		if got := tt.iv.IntersectsDays(tt.days); got != tt.want {
+			t.Errorf("%v.IntersectsDays(%v) = %v, want %v", tt.iv, tt.days, got, tt.want)
+		}
+	}
+}
+
+// TestLevelsProperty: each level carries the number of intervals covering
+// its minutes, levels are sorted and disjoint, neighbours that touch differ
+// in count, and Peak is the largest count.
+func TestLevelsProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for i := 0; i < 200; i++ {
+		ivs := randomIntervals(r, 8)
+		count := make([]int, WeekMinutes)
+		for _, iv := range ivs {
+			for m := max(iv.Start, 0); m < min(iv.End, WeekMinutes); m++ {
+				count[m]++
+			}
+		}
+		got := make([]int, WeekMinutes)
+		levels := Levels(ivs)
+		for j, l := range levels {
+			if l.Empty() || l.Count < 1 {
+				t.Fatalf("%v: bad level %v", ivs, l)
+			}
+			if j > 0 {
+				prev := levels[j-1]
+				if l.Start < prev.End || l.Start == prev.End && l.Count == prev.Count {
+					t.Fatalf("%v: level %v after %v", ivs, l, prev)
+				}
+			}
+			for m := l.Start; m < l.End; m++ {
+				got[m] = l.Count
+			}
+		}
+		peak := 0
+		for m := range count {
+			if got[m] != count[m] {
+				t.Fatalf("%v: minute %d covered %d times, levels say %d", ivs, m, count[m], got[m])
+			}
+			peak = max(peak, count[m])
+		}
+		if p := Peak(ivs); p != peak {
+			t.Fatalf("%v: Peak = %d, want %d", ivs, p, peak)
+		}
+	}
+}
+
+func TestLevelsAdjoining(t *testing.T) {
+	ivs := []Interval{{60, 120}, {120, 180}, {0, 240}, {240, 300}}
+	want := []Level{{Interval{0, 60}, 1}, {Interval{60, 180}, 2}, {Interval{180, 300}, 1}}
+	got := Levels(ivs)
+	if len(got) != len(want) {
+		t.Fatalf("Levels = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("level %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if p := Peak(ivs); p != 2 {
+		t.Errorf("Peak = %d, want 2: adjoining intervals counted twice", p)
+	}
+	if p := Peak(nil); p != 0 {
+		t.Errorf("Peak(nil) = %d", p)
+	}
+}
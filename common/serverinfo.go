@@ -0,0 +1,125 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerInfo is how a server is configured, as an OpGetServerInfo reply
+// reports it. Zero limits are off or unlimited, as with the server flags
+// they come from.
+type ServerInfo struct {
+	Semantics        string   // default invocation semantics
+	AllowedSemantics []string // others a request may select with its hint
+	Role             string   // "primary" or "backup"
+	Started          time.Time
+	Uptime           time.Duration
+	ProtocolVersion  uint8
+	ServerVersion    string
+	Facilities       int // in all namespaces
+	Namespaces       int
+
+	HistoryTTL       time.Duration // how long at-most-once replies are kept (-historyTTL)
+	MaxRequestSize   int           // -maxRequestSize
+	MaxMonitorPeriod time.Duration // -maxMonitorPeriod
+	MaxSkew          time.Duration // timestamp window (-maxSkew)
+	MaxInFlight      int           // -maxInFlight
+	MaxLockQueue     int           // -maxLockQueue
+	BusyRetryAfter   time.Duration // -busyRetryAfter
+	AbuseThreshold   int           // malformed packets before a source is blocked (-abuseThreshold)
+	AbuseWindow      time.Duration // -abuseWindow
+	SessionIdle      time.Duration // -sessionIdle
+}
+
+// FormatServerInfo encodes info as the Data of an OpGetServerInfo reply:
+// one "key=value" line per field.
+func FormatServerInfo(info ServerInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "semantics=%s\n", info.Semantics)
+	fmt.Fprintf(&b, "allowedSemantics=%s\n", strings.Join(info.AllowedSemantics, ","))
+	fmt.Fprintf(&b, "role=%s\n", info.Role)
+	fmt.Fprintf(&b, "started=%s\n", info.Started.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "uptime=%s\n", info.Uptime)
+	fmt.Fprintf(&b, "protocol=%d\n", info.ProtocolVersion)
+	fmt.Fprintf(&b, "version=%s\n", info.ServerVersion)
+	fmt.Fprintf(&b, "facilities=%d\n", info.Facilities)
+	fmt.Fprintf(&b, "namespaces=%d\n", info.Namespaces)
+	fmt.Fprintf(&b, "historyTTL=%s\n", info.HistoryTTL)
+	fmt.Fprintf(&b, "maxRequestSize=%d\n", info.MaxRequestSize)
+	fmt.Fprintf(&b, "maxMonitorPeriod=%s\n", info.MaxMonitorPeriod)
+	fmt.Fprintf(&b, "maxSkew=%s\n", info.MaxSkew)
+	fmt.Fprintf(&b, "maxInFlight=%d\n", info.MaxInFlight)
+	fmt.Fprintf(&b, "maxLockQueue=%d\n", info.MaxLockQueue)
+	fmt.Fprintf(&b, "busyRetryAfter=%s\n", info.BusyRetryAfter)
+	fmt.Fprintf(&b, "abuseThreshold=%d\n", info.AbuseThreshold)
+	fmt.Fprintf(&b, "abuseWindow=%s\n", info.AbuseWindow)
+	fmt.Fprintf(&b, "sessionIdle=%s\n", info.SessionIdle)
+	return b.String()
+}
+
+// ParseServerInfo decodes the Data of an OpGetServerInfo reply. Keys it does
+// not know are skipped, so newer servers can report more; known keys that
+// are missing stay zero.
+func ParseServerInfo(data string) (ServerInfo, error) {
+	var info ServerInfo
+	for n, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		key, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return info, fmt.Errorf("line %d: want key=value, got %q", n+1, line)
+		}
+		var err error
+		switch key {
+		case "semantics":
+			info.Semantics = v
+		case "allowedSemantics":
+			if v != "" {
+				info.AllowedSemantics = strings.Split(v, ",")
+			}
+		case "role":
+			info.Role = v
+		case "started":
+			info.Started, err = time.Parse(time.RFC3339, v)
+		case "uptime":
+			info.Uptime, err = time.ParseDuration(v)
+		case "protocol":
+			var p uint64
+			p, err = strconv.ParseUint(v, 10, 8)
+			info.ProtocolVersion = uint8(p)
+		case "version":
+			info.ServerVersion = v
+		case "facilities":
+			info.Facilities, err = strconv.Atoi(v)
+		case "namespaces":
+			info.Namespaces, err = strconv.Atoi(v)
+		case "historyTTL":
+			info.HistoryTTL, err = time.ParseDuration(v)
+		case "maxRequestSize":
+			info.MaxRequestSize, err = strconv.Atoi(v)
+		case "maxMonitorPeriod":
+			info.MaxMonitorPeriod, err = time.ParseDuration(v)
+		case "maxSkew":
+			info.MaxSkew, err = time.ParseDuration(v)
+		case "maxInFlight":
+			info.MaxInFlight, err = strconv.Atoi(v)
+		case "maxLockQueue":
+			info.MaxLockQueue, err = strconv.Atoi(v)
+		case "busyRetryAfter":
+			info.BusyRetryAfter, err = time.ParseDuration(v)
+		case "abuseThreshold":
+			info.AbuseThreshold, err = strconv.Atoi(v)
+		case "abuseWindow":
+			info.AbuseWindow, err = time.ParseDuration(v)
+		case "sessionIdle":
+			info.SessionIdle, err = time.ParseDuration(v)
+		}
+		if err != nil {
+			return info, fmt.Errorf("line %d: malformed %s %q", n+1, key, v)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerInfoRoundTrip(t *testing.T) {
+	info := ServerInfo{
+		Semantics:        "at-least-once",
+		AllowedSemantics: []string{"at-most-once"},
+		Role:             "backup",
+		Started:          time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+		Uptime:           90 * time.Minute,
+		ProtocolVersion:  ProtocolVersion,
+		ServerVersion:    "v1.2",
+		Facilities:       5,
+		Namespaces:       2,
+		HistoryTTL:       10 * time.Minute,
+		MaxRequestSize:   2048,
+		MaxMonitorPeriod: time.Hour,
+		MaxSkew:          30 * time.Second,
+		MaxInFlight:      64,
+		MaxLockQueue:     16,
+		BusyRetryAfter:   2 * time.Second,
+		AbuseThreshold:   5,
+		AbuseWindow:      time.Minute,
+		SessionIdle:      15 * time.Minute,
+	}
+	got, err := ParseServerInfo(FormatServerInfo(info))
+	if err != nil || !reflect.DeepEqual(got, info) {
+		t.Errorf("read back as\n%+v, %v\nwant\n%+v", got, err, info)
+	}
+
+	// No other semantics allowed reads back as none
+	if got, _ := ParseServerInfo(FormatServerInfo(ServerInfo{Semantics: "at-most-once"})); got.AllowedSemantics != nil {
+		t.Errorf("allowed semantics %q", got.AllowedSemantics)
+	}
+}
+
+func TestParseServerInfo(t *testing.T) {
+	// Keys from newer servers are skipped; missing ones stay zero
+	info, err := ParseServerInfo("semantics=at-most-once\nshinyNewLimit=7\n\nfacilities=3\n")
+	if err != nil || info.Semantics != "at-most-once" || info.Facilities != 3 || info.MaxSkew != 0 {
+		t.Errorf("ParseServerInfo = %+v, %v", info, err)
+	}
+	for _, data := range []string{
+		"semantics",
+		"facilities=three",
+		"uptime=1 hour",
+		"protocol=300",
+		"started=yesterday",
+	} {
+		if _, err := ParseServerInfo(data); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("ParseServerInfo(%q): %v", data, err)
+		}
+	}
+}
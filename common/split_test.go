@@ -0,0 +1,23 @@
+package common
+
+import "testing"
+
+func TestSplitBookingRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpSplitBooking, RequestID: 9, ConfirmationID: "BKG-10000",
+		StartDay: 4, StartHour: 10, StartMinute: 15, EndDay: 4, EndHour: 11, EndMinute: 45}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.ConfirmationID != req.ConfirmationID || got.StartDay != 4 || got.StartHour != 10 || got.StartMinute != 15 ||
+		got.EndDay != 4 || got.EndHour != 11 || got.EndMinute != 45 {
+		t.Errorf("read back as %+v", got)
+	}
+	if _, err := UnmarshalRequest(raw[:len(raw)-1]); err == nil {
+		t.Error("request with a cut short by a byte accepted")
+	}
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextError reports a request string field that is not plain text: invalid
+// UTF-8, or a control character such as a newline or the ESC that starts a
+// terminal escape sequence. Value is the field's content, escaped.
+type TextError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *TextError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Reason)
+}
+
+// IsPlainText reports whether s is valid UTF-8 without control characters.
+func IsPlainText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkText returns a TextError if s is not plain text.
+func checkText(field, s string) error {
+	if IsPlainText(s) {
+		return nil
+	}
+	if !utf8.ValidString(s) {
+		return &TextError{Field: field, Value: EscapeText(s), Reason: "is not valid UTF-8"}
+	}
+	i := strings.IndexFunc(s, unicode.IsControl)
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return &TextError{Field: field, Value: EscapeText(s),
+		Reason: "contains control character " + strings.Trim(strconv.QuoteRune(r), "'")}
+}
+
+// EscapeText returns s with control characters and invalid UTF-8 bytes
+// written as Go escapes (\n, \x1b, \u0085), so it prints on one line and
+// cannot drive a terminal. Plain text is returned unchanged.
+func EscapeText(s string) string {
+	if IsPlainText(s) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case unicode.IsControl(r):
+			b.WriteString(strings.Trim(strconv.QuoteRune(r), "'"))
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// CheckText verifies that every string field of the request, and of its
+// batch entries, is plain text. Strings from the wire end up in logs,
+// replies and other clients' callbacks, where a newline could forge a log
+// line and an escape sequence could take over a terminal.
+func (r RequestMessage) CheckText() error {
+	fields := [][2]string{
+		{"SessionToken", r.SessionToken},
+		{"User", r.User},
+		{"FacilityName", r.FacilityName},
+		{"NewFacilityName", r.NewFacilityName},
+		{"Namespace", r.Namespace},
+		{"TargetNamespace", r.TargetNamespace},
+		{"IdempotencyKey", r.IdempotencyKey},
+		{"ConfirmationID", r.ConfirmationID},
+		{"NewID", r.NewID},
+		{"MonitorToken", r.MonitorToken},
+		{"ParticipantName", r.ParticipantName},
+		{"Reason", r.Reason},
+		{"Username", r.Username},
+		{"Password", r.Password},
+		{"ClientInstance", r.ClientInstance},
+	}
+	for i, name := range r.MoreFacilities {
+		fields = append(fields, [2]string{fmt.Sprintf("MoreFacilities[%d]", i), name})
+	}
+	for _, f := range fields {
+		if err := checkText(f[0], f[1]); err != nil {
+			if f[0] == "SessionToken" || f[0] == "Password" {
+				err.(*TextError).Value = "" // secrets are not echoed
+			}
+			return err
+		}
+	}
+	for i, sub := range r.Batch {
+		if err := sub.CheckText(); err != nil {
+			te := err.(*TextError)
+			te.Field = fmt.Sprintf("Batch[%d].%s", i, te.Field)
+			return te
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// badText are payloads that must not reach a log line or a terminal.
+var badText = map[string]string{
+	"escape":  "Room\x1b[2J\x1b[31mA",
+	"newline": "RoomA\n2026/01/01 00:00:00 forged log line",
+	"utf8":    "Room\xffA",
+	"c1":      "Room\u0085A",
+}
+
+// TestCheckTextEveryField puts each payload in each string field of a
+// request, found by reflection so a new field cannot be missed.
+func TestCheckTextEveryField(t *testing.T) {
+	typ := reflect.TypeOf(RequestMessage{})
+	fields := 0
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Type.Kind() != reflect.String {
+			continue
+		}
+		fields++
+		for name, bad := range badText {
+			var req RequestMessage
+			reflect.ValueOf(&req).Elem().Field(i).SetString(bad)
+			err := req.CheckText()
+			var te *TextError
+			if !errors.As(err, &te) || te.Field != f.Name {
+				t.Errorf("%s in %s: %v", name, f.Name, err)
+				continue
+			}
+			if !IsPlainText(te.Value) {
+				t.Errorf("%s in %s: error value %q is not escaped", name, f.Name, te.Value)
+			}
+			if secret := f.Name == "SessionToken" || f.Name == "Password"; secret != (te.Value == "") {
+				t.Errorf("%s in %s: error value %q", name, f.Name, te.Value)
+			}
+		}
+	}
+	if fields < 10 {
+		t.Fatalf("only %d string fields found", fields)
+	}
+
+	for name, bad := range badText {
+		req := RequestMessage{FacilityName: "RoomA", MoreFacilities: []string{"Lab1", bad}}
+		if err := req.CheckText(); err == nil || err.(*TextError).Field != "MoreFacilities[1]" {
+			t.Errorf("%s in MoreFacilities: %v", name, err)
+		}
+		req = RequestMessage{Batch: []RequestMessage{{FacilityName: "RoomA"}, {ParticipantName: bad}}}
+		if err := req.CheckText(); err == nil || err.(*TextError).Field != "Batch[1].ParticipantName" {
+			t.Errorf("%s in a batch entry: %v", name, err)
+		}
+	}
+
+	plain := RequestMessage{FacilityName: "Salle B – étage 2", ParticipantName: "Zoë 山田", Reason: "Maintenance"}
+	if err := plain.CheckText(); err != nil {
+		t.Errorf("plain text refused: %v", err)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"RoomA", "RoomA"},
+		{"Zoë 山田", "Zoë 山田"},
+		{"a\nb", `a\nb`},
+		{"\x1b[31mred", `\x1b[31mred`},
+		{"bad\xffbyte", `bad\xffbyte`},
+		{"next\u0085line", `next\u0085line`},
+	}
+	for _, tt := range tests {
+		got := EscapeText(tt.in)
+		if got != tt.want {
+			t.Errorf("EscapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if strings.ContainsAny(got, "\n\x1b") || !IsPlainText(got) {
+			t.Errorf("EscapeText(%q) = %q is not plain text", tt.in, got)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const serverTimeKey = "server-time="
+
+// StaleRequestData builds the Data of a StatusStaleRequest reply. The server
+// clock is appended so the client can correct its offset and retry.
+func StaleRequestData(serverNow time.Time, reason string) string {
+	return fmt.Sprintf("%s %s%d", reason, serverTimeKey, serverNow.UnixMilli())
+}
+
+// ParseServerTime extracts the server clock from a StatusStaleRequest reply.
+func ParseServerTime(data string) (time.Time, bool) {
+	i := strings.Index(data, serverTimeKey)
+	if i < 0 {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(strings.TrimSpace(data[i+len(serverTimeKey):]), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
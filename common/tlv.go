@@ -0,0 +1,161 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Extensions are optional fields encoded after the body of a request or
+// reply as a 1-byte count followed by (tag 1 byte, length 2 bytes, value)
+// entries. The section is omitted when empty. Decoders skip tags they do not
+// know, so a new optional field can be added without a lockstep upgrade:
+// older peers keep the entry in Extensions and otherwise ignore it.
+type Extensions []TLV
+
+// TLV is one extension entry.
+type TLV struct {
+	Tag   uint8
+	Value []byte
+}
+
+// Extension tags. Tags that map to a message field are decoded into that
+// field and never appear in Extensions.
+const (
+	ExtTimestamp = 1 // request: client clock in Unix milliseconds (uint64)
+
+	// OpHello reply fields (see HelloInfo)
+	ExtProtocolVersion = 2 // 1 byte
+	ExtCapabilities    = 3 // 1 byte of Cap* bits
+	ExtSemantics       = 4 // string
+	ExtServerVersion   = 5 // string
+
+	ExtCallbackSeq      = 6 // callback: per-subscription sequence number (uint64)
+	ExtCallbackFacility = 7 // callback: facility name (string)
+	ExtCallbackAvail    = 8 // callback: availability of the affected days (string)
+
+	ExtMonitorDays    = 9  // MonitorAvailability request: days to watch, encoded like DaysList
+	ExtCallbackEvent  = 10 // callback: event type, one Event* bit (1 byte)
+	ExtMonitorEvents  = 11 // MonitorAvailability request: mask of Event* bits to receive (1 byte)
+	ExtWholeDays      = 12 // ChangeBooking request: the offset must be whole days (no value)
+	ExtEndOnly        = 13 // ChangeBooking request: the offset moves only the end (no value)
+	ExtForce          = 14 // ChangeBooking/CancelBooking request: allow a started booking (no value)
+	ExtMoreFacilities = 15 // QueryAvailability request: facilities after FacilityName, count + strings
+	ExtQueryBitmap    = 16 // QueryAvailability request: answer with free/busy bitmaps (no value)
+	ExtBusyBitmap     = 17 // QueryAvailability reply: per-day bitmaps, see AppendBusyBitmaps
+	ExtIdempotencyKey = 18 // BookFacility request: client key for one logical booking (string)
+	ExtErrorEcho      = 19 // error reply: the failed request's op, facility, ID and bad field, see ErrorEcho
+	ExtServerTime     = 20 // reply: microseconds the server spent on the request (uint64)
+	ExtOccupied       = 21 // QueryAvailability reply: bookings and closures on the queried days, see AppendOccupied
+	ExtFreeBusy       = 22 // FreeBusy reply: each facility's state over the window, see AppendFreeBusy
+	ExtHeatmap        = 23 // Heatmap reply: booked minutes per hour of the week, see AppendHeatmap
+	ExtDryRun         = 24 // BookFacility/ChangeBooking request: check only, change nothing (no value)
+	ExtServerClock    = 25 // Ping/Hello reply: server clock in Unix milliseconds (uint64)
+	ExtRenamedFrom    = 26 // renamed callback: the facility's previous name (string)
+	ExtNamespace      = 27 // request: the namespace it works in, when not DefaultNamespace (string)
+	ExtClientInstance = 28 // RegisterUser request: the ID the client picked for its run (string)
+)
+
+// maxExtensions is the largest number of entries a section may carry.
+const maxExtensions = 255
+
+// Get returns the value of the first entry with the given tag.
+func (e Extensions) Get(tag uint8) ([]byte, bool) {
+	for _, t := range e {
+		if t.Tag == tag {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Put adds or replaces the entry with the given tag.
+func (e *Extensions) Put(tag uint8, value []byte) {
+	for i := range *e {
+		if (*e)[i].Tag == tag {
+			(*e)[i].Value = value
+			return
+		}
+	}
+	*e = append(*e, TLV{Tag: tag, Value: value})
+}
+
+// Delete removes every entry with the given tag.
+func (e *Extensions) Delete(tag uint8) {
+	kept := (*e)[:0]
+	for _, t := range *e {
+		if t.Tag != tag {
+			kept = append(kept, t)
+		}
+	}
+	*e = kept
+}
+
+// PutUint64 stores v as an 8-byte big-endian value.
+func (e *Extensions) PutUint64(tag uint8, v uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	e.Put(tag, b)
+}
+
+// Uint64 reads an 8-byte value; ok is false if the tag is absent or has
+// the wrong length.
+func (e Extensions) Uint64(tag uint8) (uint64, bool) {
+	b, ok := e.Get(tag)
+	if !ok || len(b) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b), true
+}
+
+// PutString stores s as raw bytes.
+func (e *Extensions) PutString(tag uint8, s string) {
+	e.Put(tag, []byte(s))
+}
+
+// String reads a value stored with PutString.
+func (e Extensions) String(tag uint8) (string, bool) {
+	b, ok := e.Get(tag)
+	return string(b), ok
+}
+
+// appendExtensions writes the extensions section; nothing when empty.
+func appendExtensions(buf []byte, e Extensions) ([]byte, error) {
+	if len(e) == 0 {
+		return buf, nil
+	}
+	if len(e) > maxExtensions {
+		return nil, fmt.Errorf("too many extensions (max %d)", maxExtensions)
+	}
+	buf = append(buf, byte(len(e)))
+	for _, t := range e {
+		if len(t.Value) > 0xFFFF {
+			return nil, fmt.Errorf("extension %d of %d bytes is too large", t.Tag, len(t.Value))
+		}
+		buf = append(buf, t.Tag)
+		buf = writeString(buf, string(t.Value))
+	}
+	return buf, nil
+}
+
+// readExtensions decodes the section at offset, if any bytes remain.
+func readExtensions(data []byte, offset int) (Extensions, int, error) {
+	if offset >= len(data) {
+		return nil, offset, nil
+	}
+	n := int(data[offset])
+	offset++
+	e := make(Extensions, 0, n)
+	for i := 0; i < n; i++ {
+		if offset+1 > len(data) {
+			return nil, offset, fmt.Errorf("not enough bytes for extension tag")
+		}
+		tag := data[offset]
+		value, newOffset, err := readString(data, offset+1)
+		if err != nil {
+			return nil, offset, fmt.Errorf("extension %d: %w", tag, err)
+		}
+		e = append(e, TLV{Tag: tag, Value: []byte(value)})
+		offset = newOffset
+	}
+	return e, offset, nil
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExtensionsAccessors(t *testing.T) {
+	var e Extensions
+	e.PutUint64(ExtTimestamp, 1234)
+	e.PutString(ExtSemantics, "at-most-once")
+	e.Put(ExtForce, nil)
+	e.PutString(ExtSemantics, "at-least-once") // replaces
+
+	if v, ok := e.Uint64(ExtTimestamp); !ok || v != 1234 {
+		t.Errorf("Uint64 = %d, %v", v, ok)
+	}
+	if s, ok := e.String(ExtSemantics); !ok || s != "at-least-once" {
+		t.Errorf("String = %q, %v", s, ok)
+	}
+	if len(e) != 3 {
+		t.Errorf("%d entries, want 3", len(e))
+	}
+	if _, ok := e.Get(ExtForce); !ok {
+		t.Error("empty value not found")
+	}
+	if _, ok := e.Uint64(ExtSemantics); ok {
+		t.Error("Uint64 of a string value succeeded")
+	}
+	e.Delete(ExtForce)
+	if _, ok := e.Get(ExtForce); ok {
+		t.Error("deleted entry still there")
+	}
+	if _, ok := e.Get(99); ok {
+		t.Error("absent tag found")
+	}
+}
+
+func TestExtensionsRoundTrip(t *testing.T) {
+	tests := []Extensions{
+		nil,
+		{{Tag: 1, Value: []byte{1, 2, 3}}},
+		{{Tag: 200, Value: nil}, {Tag: 201, Value: bytes.Repeat([]byte("x"), 1000)}},
+	}
+	for _, e := range tests {
+		buf, err := appendExtensions([]byte("body"), e)
+		if err != nil {
+			t.Fatalf("appendExtensions: %v", err)
+		}
+		if len(e) == 0 && len(buf) != len("body") {
+			t.Errorf("empty section written as % x", buf[4:])
+		}
+		got, offset, err := readExtensions(buf, len("body"))
+		if err != nil {
+			t.Fatalf("readExtensions: %v", err)
+		}
+		if offset != len(buf) {
+			t.Errorf("read %d of %d bytes", offset, len(buf))
+		}
+		for i := range e {
+			if got[i].Tag != e[i].Tag || !bytes.Equal(got[i].Value, e[i].Value) {
+				t.Errorf("entry %d = %+v, want %+v", i, got[i], e[i])
+			}
+		}
+		if len(got) != len(e) {
+			t.Errorf("%d entries, want %d", len(got), len(e))
+		}
+	}
+}
+
+func TestExtensionsLimits(t *testing.T) {
+	if _, err := appendExtensions(nil, Extensions{{Tag: 1, Value: make([]byte, 0x10000)}}); err == nil {
+		t.Error("value over 64 KiB accepted")
+	}
+	if _, err := appendExtensions(nil, make(Extensions, maxExtensions+1)); err == nil {
+		t.Error("too many entries accepted")
+	}
+	for _, data := range [][]byte{{1}, {1, 5}, {2, 5, 0, 0}, {1, 5, 0, 9, 'a'}} {
+		if _, _, err := readExtensions(data, 0); err == nil {
+			t.Errorf("readExtensions(% x) succeeded", data)
+		}
+	}
+}
+
+// TestUnknownTagsSkipped decodes messages carrying tags this version does
+// not know, as a newer peer would send: the known fields still decode and
+// the unknown entries are kept aside.
+func TestUnknownTagsSkipped(t *testing.T) {
+	unknown := TLV{Tag: 250, Value: []byte("from the future")}
+	req := RequestMessage{
+		OpCode:         OpBookFacility,
+		RequestID:      7,
+		FacilityName:   "RoomA",
+		StartHour:      9,
+		EndHour:        10,
+		IdempotencyKey: "key-1",
+		Extensions:     Extensions{unknown},
+	}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.FacilityName != "RoomA" || got.IdempotencyKey != "key-1" {
+		t.Errorf("decoded %+v", got)
+	}
+	if !reflect.DeepEqual(got.Extensions, Extensions{unknown}) {
+		t.Errorf("Extensions = %+v, want only the unknown entry", got.Extensions)
+	}
+
+	rep := ReplyMessage{RequestID: 7, OpCode: OpBookFacility, Data: "BKG-1", Extensions: Extensions{unknown}}
+	rawRep, err := MarshalReply(rep)
+	if err != nil {
+		t.Fatalf("MarshalReply: %v", err)
+	}
+	gotRep, err := UnmarshalReply(rawRep)
+	if err != nil {
+		t.Fatalf("UnmarshalReply: %v", err)
+	}
+	if gotRep.Data != "BKG-1" || !reflect.DeepEqual(gotRep.Extensions, Extensions{unknown}) {
+		t.Errorf("decoded %+v", gotRep)
+	}
+}
+
+// TestMigratedFieldsUseTLVs checks optional fields moved onto extensions
+// decode into their fields and only cost bytes when set.
+func TestMigratedFieldsUseTLVs(t *testing.T) {
+	base := RequestMessage{OpCode: OpBookFacility, RequestID: 7, FacilityName: "RoomA", StartHour: 9, EndHour: 10}
+	plain, err := MarshalRequest(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTS := base
+	withTS.Timestamp = 1700000000000
+	raw, err := MarshalRequest(withTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// count + tag + 2-byte length + 8-byte value
+	if extra := len(raw) - len(plain); extra != 12 {
+		t.Errorf("timestamp costs %d bytes, want 12", extra)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Timestamp != withTS.Timestamp || len(got.Extensions) != 0 {
+		t.Errorf("Timestamp = %d, Extensions = %+v", got.Timestamp, got.Extensions)
+	}
+}
@@ -0,0 +1,21 @@
+package common
+
+import "testing"
+
+func TestTransferBookingRoundTrip(t *testing.T) {
+	req := RequestMessage{OpCode: OpTransferBooking, RequestID: 9, ConfirmationID: "BKG-10000", FacilityName: "Lab1"}
+	raw, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest: %v", err)
+	}
+	got, err := UnmarshalRequest(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalRequest: %v", err)
+	}
+	if got.ConfirmationID != "BKG-10000" || got.FacilityName != "Lab1" {
+		t.Errorf("read back as %+v", got)
+	}
+	if _, err := UnmarshalRequest(raw[:len(raw)-2]); err == nil {
+		t.Error("request with a cut facility name accepted")
+	}
+}
@@ -1,5 +1,10 @@
 package common
 
+import (
+	"fmt"
+	"time"
+)
+
 // Operation codes
 const (
 	OpQueryAvailability   = 1
@@ -8,20 +13,187 @@ const (
 	OpMonitorAvailability = 4
 	OpCancelBooking       = 5
 	OpAddParticipant      = 6
+	OpRegisterUser        = 7
+	OpPing                = 8
+	OpBatch               = 9 // envelope for several requests; see Batch
+	OpHello               = 10
+	OpResendCallbacks     = 11 // replay buffered callbacks after a sequence gap
+	OpKeepalive           = 12 // client answer to a keepalive callback; never replied to
+	OpRebindMonitor       = 13 // move a monitor registration to the sender's new address
+	OpListMonitors        = 14 // admin: list active monitor subscriptions
+	OpAddBlackout         = 15 // admin: close a facility for a period
+	OpClearBookings       = 16 // admin: remove all bookings of a facility
+	OpListBookings        = 17 // one page of a facility's bookings, in start order
+	OpQueryChanges        = 18 // a facility's mutations since a sequence number from a query reply
+	OpFindParticipant     = 19 // bookings a participant is in, across facilities or in one
+	OpTransferBooking     = 20 // move a booking to another facility, keeping its ID and time
+	OpSplitBooking        = 21 // give up part of a booking, leaving one or two shorter bookings
+	OpCopyBooking         = 22 // book the same time and facility as a booking on another day
+	OpFreeBusy            = 23 // which facilities are free over one window, and what blocks the rest
+	OpHeatmap             = 24 // booked minutes per hour of the week, for one facility or all
+	OpRenameFacility      = 25 // admin: give a facility a new name, keeping its bookings and subscribers
+	OpGetServerInfo       = 26 // how the server is configured: semantics, uptime, version and limits
+	OpCreateNamespace     = 27 // admin: add a facility catalog with the named facilities
+	OpDeleteNamespace     = 28 // admin: remove a facility catalog with its bookings
+	OpApproveBooking      = 29 // admin: confirm a booking pending approval
+	OpRejectBooking       = 30 // admin: remove a booking pending approval, giving a reason
+
+	// OpCallback marks server-initiated monitor callbacks (RequestID 0)
+	OpCallback = 100
+)
+
+// opNames are the operation names used in logs, errors, metrics and error
+// echoes. Every Op constant has one.
+var opNames = map[uint8]string{
+	OpQueryAvailability:   "QueryAvailability",
+	OpBookFacility:        "BookFacility",
+	OpChangeBooking:       "ChangeBooking",
+	OpMonitorAvailability: "MonitorAvailability",
+	OpCancelBooking:       "CancelBooking",
+	OpAddParticipant:      "AddParticipant",
+	OpRegisterUser:        "RegisterUser",
+	OpPing:                "Ping",
+	OpBatch:               "Batch",
+	OpHello:               "Hello",
+	OpResendCallbacks:     "ResendCallbacks",
+	OpKeepalive:           "Keepalive",
+	OpRebindMonitor:       "RebindMonitor",
+	OpListMonitors:        "ListMonitors",
+	OpAddBlackout:         "AddBlackout",
+	OpClearBookings:       "ClearBookings",
+	OpListBookings:        "ListBookings",
+	OpQueryChanges:        "QueryChanges",
+	OpFindParticipant:     "FindParticipant",
+	OpTransferBooking:     "TransferBooking",
+	OpSplitBooking:        "SplitBooking",
+	OpCopyBooking:         "CopyBooking",
+	OpFreeBusy:            "FreeBusy",
+	OpHeatmap:             "Heatmap",
+	OpRenameFacility:      "RenameFacility",
+	OpGetServerInfo:       "GetServerInfo",
+	OpCreateNamespace:     "CreateNamespace",
+	OpDeleteNamespace:     "DeleteNamespace",
+	OpApproveBooking:      "ApproveBooking",
+	OpRejectBooking:       "RejectBooking",
+	OpCallback:            "Callback",
+}
+
+// OpName returns the name of an operation, such as "BookFacility", or
+// "unknown(<n>)" for a code without one. Logs, errors and metrics use it
+// rather than the number.
+func OpName(op uint8) string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", op)
+}
+
+// Reply status codes
+const (
+	StatusOK               = 0
+	StatusError            = -1
+	StatusConflict         = 1
+	StatusNotPrimary       = 2  // mutation sent to a backup replica
+	StatusAuthRequired     = 3  // request and server disagree on -authKey
+	StatusStaleRequest     = 4  // timestamp outside -maxSkew; Data carries server-time=
+	StatusBadSession       = 5  // session token unknown or expired; register again
+	StatusPermissionDenied = 6  // privileged operation without an admin session
+	StatusTooLarge         = 7  // request exceeds -maxRequestSize; Data names the limit
+	StatusOutsideWindow    = 8  // RequestID older than the server's dedup window; not executed
+	StatusInvalidArgument  = 9  // a request field is out of range, e.g. a zero monitor period
+	StatusInProgress       = 10 // booking has started; only its end may change
+	StatusBookingOver      = 11 // booking has already ended
+	StatusChangesExpired   = 12 // delta query too old for the change journal; query in full
+	StatusBusy             = 13 // server overloaded, not executed; Data carries retry-after=<seconds>
+	StatusInternal         = 14 // the handler crashed; resending will likely crash it again
+)
+
+// How FindParticipant compares names. Both ignore case.
+const (
+	MatchExact     = 0 // the whole name must match
+	MatchSubstring = 1 // the name must contain the query
 )
 
+// IsMutating reports whether an operation changes booking state.
+func IsMutating(op uint8) bool {
+	switch op {
+	case OpBookFacility, OpChangeBooking, OpCancelBooking, OpAddParticipant, OpAddBlackout, OpClearBookings, OpTransferBooking, OpSplitBooking, OpCopyBooking, OpRenameFacility,
+		OpCreateNamespace, OpDeleteNamespace, OpApproveBooking, OpRejectBooking:
+		return true
+	}
+	return false
+}
+
+// IsMutating reports whether this request changes booking state: a
+// mutating operation that is not a dry run.
+func (r RequestMessage) IsMutating() bool {
+	return IsMutating(r.OpCode) && !r.DryRun
+}
+
+// Per-request semantics hints, carried in the header when FlagSemantics is
+// set. The server applies a hint only if its -allowedSemantics permits it.
+const (
+	FlagSemantics = 1 << 4 // a one-byte semantics hint follows the session token
+
+	HintServerDefault = 0
+	HintAtLeastOnce   = 1
+	HintAtMostOnce    = 2
+)
+
+// privilegedOps lists the operations that only the admin user may call.
+var privilegedOps = map[uint8]bool{
+	OpListMonitors:    true,
+	OpAddBlackout:     true,
+	OpClearBookings:   true,
+	OpRenameFacility:  true,
+	OpCreateNamespace: true,
+	OpDeleteNamespace: true,
+	OpApproveBooking:  true,
+	OpRejectBooking:   true,
+}
+
+// IsPrivileged reports whether an operation requires an admin session.
+func IsPrivileged(op uint8) bool {
+	return privilegedOps[op]
+}
+
 // RequestMessage holds all possible input fields for any operation.
 type RequestMessage struct {
 	OpCode    uint8
 	RequestID uint64
+	Flags     uint8 // header flags (see FlagAuthenticated)
+	Timestamp int64 // optional client clock in Unix milliseconds (0 = absent; ExtTimestamp)
+
+	// Optional session token from OpRegisterUser (header field)
+	SessionToken string
+	// User is resolved by the server from SessionToken; it is never marshaled.
+	User string
+	// Optional semantics hint (HintAtLeastOnce/HintAtMostOnce; header field)
+	Semantics uint8
+	// Optional capability bits such as CapGzip (header field)
+	Capabilities uint8
 
 	// Common fields
 	FacilityName string // Used by Query, Book, Monitor, etc.
+	// The facility catalog the request works in; empty means
+	// DefaultNamespace. Facility names and confirmation IDs from other
+	// namespaces are not found.
+	Namespace string
 
-	// For QueryAvailability
+	// For QueryAvailability, and MonitorAvailability (days to watch; empty
+	// means all days)
 	DaysList []uint8 // e.g., day indices 0..6 for Monday..Sunday
+	// For QueryAvailability: more facilities to report after FacilityName.
+	// For CreateNamespace: the facilities the new namespace starts with
+	MoreFacilities []string
+	// For QueryAvailability: reply with a free/busy bitmap per day in
+	// ExtBusyBitmap instead of the interval text
+	Bitmap bool
 
-	// For BookFacility
+	// For BookFacility. For SplitBooking (with ConfirmationID): the part to
+	// give up, or a point to split at if the start equals the end. For
+	// CopyBooking (with ConfirmationID): StartDay is the day the copy starts.
+	// For FreeBusy: the window to check every facility over
 	StartDay    uint8
 	StartHour   uint8
 	StartMinute uint8
@@ -29,20 +201,119 @@ type RequestMessage struct {
 	EndHour     uint8
 	EndMinute   uint8
 
-	// For ChangeBooking / CancelBooking / AddParticipant
+	// For BookFacility: a key the client picks for one logical booking and
+	// reuses on every retry; the server answers repeats with the original
+	// confirmation instead of booking again
+	IdempotencyKey string
+
+	// For SplitBooking and CopyBooking: never sent by clients; a replica
+	// uses it to carry the ID the primary assigned to the second piece or
+	// the copy
+	NewID string
+
+	// For BookFacility and CopyBooking: never sent by clients; a replica uses
+	// it to carry when the primary's hold on a booking pending approval ends
+	PendingUntil time.Time
+
+	// For ChangeBooking / CancelBooking / AddParticipant / TransferBooking
+	// (with FacilityName as the facility to move to) / ApproveBooking /
+	// RejectBooking.
+	// For BookFacility it is never sent by clients; a replica uses it to
+	// carry the ID the primary assigned.
 	ConfirmationID string
 	OffsetMinutes  int32
+	// For ChangeBooking: refuse offsets that are not whole days, so the
+	// booking keeps its time of day
+	WholeDays bool
+	// For ChangeBooking: move only the end, e.g. to extend a running booking
+	EndOnly bool
+	// For ChangeBooking / CancelBooking: touch a booking that has already
+	// started (admin sessions only)
+	Force bool
+	// For BookFacility / ChangeBooking: run every check and answer as the
+	// real request would, but book or change nothing
+	DryRun bool
 	// For MonitorAvailability
 	MonitorPeriod uint32
+	EventMask     uint8 // Event* bits to receive; 0 means all events
+	// For ResendCallbacks (with FacilityName): last sequence number received.
+	// For QueryChanges (with FacilityName): the Seq= of the last reply seen
+	SinceSeq uint64
+	// For RebindMonitor: token from the MonitorAvailability reply
+	MonitorToken string
 
-	// For AddParticipant
+	// For AddParticipant, and FindParticipant (the name to look for; with
+	// FacilityName to search one facility only)
 	ParticipantName string
+	// For FindParticipant: MatchExact or MatchSubstring
+	MatchMode uint8
+
+	// For AddBlackout (with FacilityName and the Start/End fields): why the
+	// facility is closed, e.g. "maintenance". For RejectBooking (with
+	// ConfirmationID): why the booking was refused, passed on to subscribers
+	Reason string
+
+	// For ListBookings (with FacilityName): index of the first booking, from
+	// the previous reply's Next= field, and the page size (0 = server maximum)
+	PageOffset uint32
+	PageLimit  uint16
+
+	// For ClearBookings (with FacilityName and, to limit it to some days,
+	// DaysList) and DeleteNamespace: must be set, so the operation is never
+	// run by accident
+	Confirm bool
+
+	// For RenameFacility: the name FacilityName is to get
+	NewFacilityName string
+
+	// For CreateNamespace and DeleteNamespace: the namespace to create or
+	// remove, whatever Namespace the request itself works in. DeleteNamespace
+	// needs Confirm as well
+	TargetNamespace string
+
+	// For RegisterUser
+	Username string
+	Password string
+	// For RegisterUser: a random ID the client picks once per run and sends
+	// with every login, so the server can tell two clients of one user apart
+	// and still recognize a client that logs in again (ExtClientInstance)
+	ClientInstance string
+
+	// For Ping: client send time in Unix nanoseconds, echoed back as Data
+	PingTime int64
+
+	// For Hello: the client's ProtocolVersion and Cap* bits (body fields,
+	// so a server that predates the capability header can still parse them)
+	HelloVersion      uint8
+	HelloCapabilities uint8
+
+	// For Batch: the sub-requests, executed in order. Each is deduplicated
+	// by its own RequestID; the envelope's header applies to all of them.
+	Batch []RequestMessage
+
+	// Extension entries without a dedicated field (e.g. from newer peers)
+	Extensions Extensions
 }
 
 // ReplyMessage is returned by the server to the client
 type ReplyMessage struct {
 	RequestID uint64
 	OpCode    uint8  // optional if you want to echo the operation code
+	Flags     uint8  // header flags (see FlagAuthenticated)
 	Status    int32  // 0 for success, negative/positive for errors
 	Data      string // e.g., booking ID, schedule info, error message, etc.
+
+	// For Batch: one reply per sub-request, in request order
+	Replies []ReplyMessage
+
+	// Microseconds the server spent handling the request, from receiving
+	// it to sending the reply; 0 if the server did not say
+	ServerMicros uint64
+
+	// For Ping / Hello: the server clock in Unix milliseconds when it
+	// answered, so the client can measure clock skew; 0 if not sent
+	ServerClock int64
+
+	// Extension entries without a dedicated field (e.g. from newer peers)
+	Extensions Extensions
 }
@@ -33,3 +33,59 @@ func readString(data []byte, offset int) (string, int, error) {
     offset += int(length)
     return string(strBytes), offset, nil
 }
+
+// Write a 1-byte count + one byte per day.
+func appendDaysList(buf []byte, days []uint8) ([]byte, error) {
+    if len(days) > 255 {
+        return nil, fmt.Errorf("too many days in DaysList (max 255)")
+    }
+    buf = append(buf, byte(len(days)))
+    return append(buf, days...), nil
+}
+
+// Read a 1-byte count + days.
+func readDaysList(data []byte, offset int) ([]uint8, int, error) {
+    if offset+1 > len(data) {
+        return nil, offset, fmt.Errorf("not enough bytes for days count")
+    }
+    ndays := int(data[offset])
+    offset++
+    if offset+ndays > len(data) {
+        return nil, offset, fmt.Errorf("not enough bytes for days list")
+    }
+    // Copy, so the list outlives the receive buffer it was read from
+    days := make([]uint8, ndays)
+    copy(days, data[offset:offset+ndays])
+    return days, offset + ndays, nil
+}
+
+// Write a 1-byte count + strings.
+func appendStringList(buf []byte, list []string) ([]byte, error) {
+    if len(list) > 255 {
+        return nil, fmt.Errorf("too many strings in list (max 255)")
+    }
+    buf = append(buf, byte(len(list)))
+    for _, s := range list {
+        buf = writeString(buf, s)
+    }
+    return buf, nil
+}
+
+// Read a 1-byte count + strings.
+func readStringList(data []byte, offset int) ([]string, int, error) {
+    if offset+1 > len(data) {
+        return nil, offset, fmt.Errorf("not enough bytes for list count")
+    }
+    n := int(data[offset])
+    offset++
+    list := make([]string, 0, n)
+    for i := 0; i < n; i++ {
+        s, newOffset, err := readString(data, offset)
+        if err != nil {
+            return nil, offset, err
+        }
+        list = append(list, s)
+        offset = newOffset
+    }
+    return list, offset, nil
+}
@@ -0,0 +1,198 @@
+// Package validate holds the range checks that both the client's input
+// layer and the server's handlers apply, so the two accept the same
+// requests. The errors name the request field at fault.
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// Limits of the booking week. Days are 0=Monday..6=Sunday; a booking must
+// end by Sunday 24:00, WeekMinutes after Monday 00:00. An end at 24:00 is
+// sent as 00:00 of the next day, so Sunday 24:00 is the one time with day
+// MaxDay+1.
+const (
+	MaxDay      = 6
+	MaxHour     = 23
+	MaxMinute   = 59
+	WeekMinutes = schedule.WeekMinutes
+)
+
+// MaxDaysListLen is the most entries a DaysList may have: each day once.
+const MaxDaysListLen = MaxDay + 1
+
+// MaxFacilityNameLen is the longest facility name accepted, in bytes.
+const MaxFacilityNameLen = 64
+
+// MinMonitorPeriod is the shortest monitor period, in seconds. Servers cap
+// long periods to their -maxMonitorPeriod rather than refusing them.
+const MinMonitorPeriod = 1
+
+// FieldError reports a request field whose value is not acceptable.
+type FieldError struct {
+	Field  string // request field, e.g. "StartHour"
+	Value  string // the rejected value as written in the message
+	Reason string // e.g. "is out of range (0-23)"
+}
+
+func (e *FieldError) Error() string {
+	if e.Value == "" {
+		return e.Field + " " + e.Reason
+	}
+	return fmt.Sprintf("%s %s %s", e.Field, e.Value, e.Reason)
+}
+
+// inRange checks one numeric field against 0..max.
+func inRange(field string, v uint8, max uint8) error {
+	if v > max {
+		return &FieldError{Field: field, Value: fmt.Sprint(v), Reason: fmt.Sprintf("is out of range (0-%d)", max)}
+	}
+	return nil
+}
+
+// weekTime renders a day and time as "Wed 10:30".
+func weekTime(day, hour, minute uint8) string {
+	return common.FormatWeekTime(schedule.ToMinutes(day, hour, minute))
+}
+
+// ValidateTimeFields checks that each field of a window lies in range,
+// without comparing the start with the end. The end may also be day
+// MaxDay+1 at 00:00, Sunday 24:00.
+func ValidateTimeFields(startDay, startHour, startMinute, endDay, endHour, endMinute uint8) error {
+	maxEndDay := uint8(MaxDay)
+	if endHour == 0 && endMinute == 0 {
+		maxEndDay = MaxDay + 1
+	}
+	for _, f := range []struct {
+		name     string
+		val, max uint8
+	}{
+		{"StartDay", startDay, MaxDay}, {"StartHour", startHour, MaxHour}, {"StartMinute", startMinute, MaxMinute},
+		{"EndDay", endDay, maxEndDay}, {"EndHour", endHour, MaxHour}, {"EndMinute", endMinute, MaxMinute},
+	} {
+		if err := inRange(f.name, f.val, f.max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateBookingTimes checks a booking window: each field in range and the
+// end after the start. Both lie in the same week by construction, so the
+// window never runs past the horizon.
+func ValidateBookingTimes(startDay, startHour, startMinute, endDay, endHour, endMinute uint8) error {
+	if err := ValidateTimeFields(startDay, startHour, startMinute, endDay, endHour, endMinute); err != nil {
+		return err
+	}
+	if schedule.Span(startDay, startHour, startMinute, endDay, endHour, endMinute).Empty() {
+		return &FieldError{Field: "End", Value: weekTime(endDay, endHour, endMinute),
+			Reason: "is not after the start " + weekTime(startDay, startHour, startMinute)}
+	}
+	return nil
+}
+
+// ValidateDaysList checks that the list has at most MaxDaysListLen entries
+// and every day is 0-6. An empty list is valid; operations read it as the
+// whole week or as no days, as documented.
+func ValidateDaysList(days []uint8) error {
+	if len(days) > MaxDaysListLen {
+		return &FieldError{Field: "DaysList", Value: fmt.Sprintf("of %d entries", len(days)),
+			Reason: fmt.Sprintf("is longer than %d", MaxDaysListLen)}
+	}
+	for _, d := range days {
+		if err := inRange("DaysList", d, MaxDay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllDays returns a new list of every day of the week, Monday first. An
+// empty query DaysList is shorthand for it.
+func AllDays() []uint8 {
+	days := make([]uint8, MaxDaysListLen)
+	for i := range days {
+		days[i] = uint8(i)
+	}
+	return days
+}
+
+// NormalizeDaysList validates days and returns them sorted, each day once,
+// in a new slice. Replies follow the normalized order, Monday first,
+// whatever order the days were asked in.
+func NormalizeDaysList(days []uint8) ([]uint8, error) {
+	if err := ValidateDaysList(days); err != nil {
+		return nil, err
+	}
+	var seen [MaxDaysListLen]bool
+	for _, d := range days {
+		seen[d] = true
+	}
+	out := make([]uint8, 0, len(days))
+	for d, ok := range seen {
+		if ok {
+			out = append(out, uint8(d))
+		}
+	}
+	return out, nil
+}
+
+// ValidateFacilityName checks that a name is non-empty plain text of at
+// most MaxFacilityNameLen bytes. Whether the facility exists is for the
+// server to say.
+func ValidateFacilityName(name string) error {
+	switch {
+	case name == "":
+		return &FieldError{Field: "FacilityName", Reason: "is empty"}
+	case len(name) > MaxFacilityNameLen:
+		return &FieldError{Field: "FacilityName", Value: fmt.Sprintf("%.20q...", name),
+			Reason: fmt.Sprintf("is longer than %d bytes", MaxFacilityNameLen)}
+	case !common.IsPlainText(name):
+		return &FieldError{Field: "FacilityName", Value: common.EscapeText(name), Reason: "is not plain text"}
+	}
+	return nil
+}
+
+// FacilityKey is the canonical case of a facility name. The server treats
+// names with the same key as one facility, so clients key what they keep
+// per facility the same way.
+func FacilityKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// MaxNamespaceLen is the longest namespace name accepted, in bytes.
+const MaxNamespaceLen = 32
+
+// ValidateNamespace checks a namespace name: 1 to MaxNamespaceLen lowercase
+// letters, digits and hyphens, so names cannot collide by case and are safe
+// in store keys and logs.
+func ValidateNamespace(name string) error {
+	switch {
+	case name == "":
+		return &FieldError{Field: "Namespace", Reason: "is empty"}
+	case len(name) > MaxNamespaceLen:
+		return &FieldError{Field: "Namespace", Value: fmt.Sprintf("%.20q...", name),
+			Reason: fmt.Sprintf("is longer than %d bytes", MaxNamespaceLen)}
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return &FieldError{Field: "Namespace", Value: common.EscapeText(name),
+				Reason: "may only hold lowercase letters, digits and '-'"}
+		}
+	}
+	return nil
+}
+
+// ValidateMonitorPeriod checks a monitor period in seconds. A zero period
+// would register a subscription that has already expired.
+func ValidateMonitorPeriod(seconds uint32) error {
+	if seconds < MinMonitorPeriod {
+		return &FieldError{Field: "MonitorPeriod", Value: fmt.Sprint(seconds),
+			Reason: fmt.Sprintf("must be at least %d second", MinMonitorPeriod)}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fieldOf returns the field an error names, or "" for nil.
+func fieldOf(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("error %v is not a *FieldError", err)
+	}
+	return fe.Field
+}
+
+func TestValidateBookingTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		times [6]uint8 // start day, hour, minute, end day, hour, minute
+		field string
+		msg   string
+	}{
+		{"an hour", [6]uint8{2, 9, 0, 2, 10, 0}, "", ""},
+		{"overnight", [6]uint8{2, 22, 0, 3, 1, 30}, "", ""},
+		{"until Sunday 24:00", [6]uint8{6, 22, 0, 7, 0, 0}, "", ""},
+		{"start day", [6]uint8{7, 9, 0, 7, 10, 0}, "StartDay", "StartDay 7 is out of range (0-6)"},
+		{"start hour", [6]uint8{2, 24, 0, 2, 23, 0}, "StartHour", "StartHour 24 is out of range (0-23)"},
+		{"start minute", [6]uint8{2, 9, 60, 2, 10, 0}, "StartMinute", "StartMinute 60 is out of range (0-59)"},
+		{"end day past Sunday 24:00", [6]uint8{6, 9, 0, 7, 0, 30}, "EndDay", "EndDay 7 is out of range (0-6)"},
+		{"end hour", [6]uint8{2, 9, 0, 2, 25, 0}, "EndHour", "EndHour 25 is out of range (0-23)"},
+		{"end minute", [6]uint8{2, 9, 0, 2, 10, 75}, "EndMinute", "EndMinute 75 is out of range (0-59)"},
+		{"end before start", [6]uint8{2, 10, 0, 2, 9, 0}, "End", "End Wed 09:00 is not after the start Wed 10:00"},
+		{"empty", [6]uint8{2, 10, 0, 2, 10, 0}, "End", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := tt.times
+			err := ValidateBookingTimes(v[0], v[1], v[2], v[3], v[4], v[5])
+			if got := fieldOf(t, err); got != tt.field {
+				t.Fatalf("error %v, want one on %q", err, tt.field)
+			}
+			if tt.msg != "" && err.Error() != tt.msg {
+				t.Errorf("message %q, want %q", err, tt.msg)
+			}
+			// ValidateTimeFields checks the ranges but not the order
+			want := tt.field
+			if want == "End" {
+				want = ""
+			}
+			if err := ValidateTimeFields(v[0], v[1], v[2], v[3], v[4], v[5]); fieldOf(t, err) != want {
+				t.Errorf("ValidateTimeFields: %v, want one on %q", err, want)
+			}
+		})
+	}
+}
+
+func TestValidateDaysList(t *testing.T) {
+	tests := []struct {
+		days  []uint8
+		field string
+	}{
+		{nil, ""},
+		{[]uint8{0}, ""},
+		{[]uint8{6, 0, 3}, ""},
+		{[]uint8{0, 1, 2, 3, 4, 5, 6}, ""},
+		{[]uint8{7}, "DaysList"},
+		{[]uint8{0, 255}, "DaysList"},
+		{[]uint8{0, 1, 2, 3, 4, 5, 6, 0}, "DaysList"},
+	}
+	for _, tt := range tests {
+		if got := fieldOf(t, ValidateDaysList(tt.days)); got != tt.field {
+			t.Errorf("ValidateDaysList(%v) fails on %q, want %q", tt.days, got, tt.field)
+		}
+	}
+}
+
+func TestNormalizeDaysList(t *testing.T) {
+	tests := []struct {
+		days []uint8
+		want []uint8
+	}{
+		{nil, []uint8{}},
+		{[]uint8{3, 3, 3, 3}, []uint8{3}},
+		{[]uint8{6, 0, 3, 0}, []uint8{0, 3, 6}},
+		{[]uint8{6, 5, 4, 3, 2, 1, 0}, []uint8{0, 1, 2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		in := append([]uint8(nil), tt.days...)
+		got, err := NormalizeDaysList(in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NormalizeDaysList(%v) = %v, %v; want %v", tt.days, got, err, tt.want)
+		}
+		if len(got) > 0 && &got[0] == &in[0] {
+			t.Errorf("NormalizeDaysList(%v) returned its argument", tt.days)
+		}
+	}
+	for _, days := range [][]uint8{{7}, {0, 255}, {0, 0, 0, 0, 0, 0, 0, 0}, make([]uint8, 255)} {
+		if got := fieldOf(t, func() error { _, err := NormalizeDaysList(days); return err }()); got != "DaysList" {
+			t.Errorf("NormalizeDaysList(%d days) fails on %q, want DaysList", len(days), got)
+		}
+	}
+}
+
+func TestAllDays(t *testing.T) {
+	days := AllDays()
+	if !reflect.DeepEqual(days, []uint8{0, 1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("AllDays() = %v", days)
+	}
+	days[0] = 6
+	if AllDays()[0] != 0 {
+		t.Error("AllDays returns a shared slice")
+	}
+}
+
+func TestValidateFacilityName(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+	}{
+		{"RoomA", ""},
+		{"Salle B – étage 2", ""},
+		{strings.Repeat("x", MaxFacilityNameLen), ""},
+		{"", "is empty"},
+		{strings.Repeat("x", MaxFacilityNameLen+1), "is longer than 64 bytes"},
+		{"Room\nA", "is not plain text"},
+		{"Room\x1b[31mA", "is not plain text"},
+	}
+	for _, tt := range tests {
+		err := ValidateFacilityName(tt.name)
+		var fe *FieldError
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Errorf("ValidateFacilityName(%q): %v", tt.name, err)
+		case tt.reason != "" && (!errors.As(err, &fe) || fe.Field != "FacilityName" || fe.Reason != tt.reason):
+			t.Errorf("ValidateFacilityName(%q): %v, want %q", tt.name, err, tt.reason)
+		case fe != nil && strings.ContainsAny(fe.Error(), "\n\x1b"):
+			t.Errorf("ValidateFacilityName(%q): message %q is not escaped", tt.name, fe.Error())
+		}
+	}
+}
+
+func TestValidateMonitorPeriod(t *testing.T) {
+	for _, tt := range []struct {
+		seconds uint32
+		ok      bool
+	}{{0, false}, {1, true}, {3600, true}, {1 << 31, true}} {
+		if err := ValidateMonitorPeriod(tt.seconds); (err == nil) != tt.ok {
+			t.Errorf("ValidateMonitorPeriod(%d): %v", tt.seconds, err)
+		}
+	}
+	if err := ValidateMonitorPeriod(0); err.Error() != "MonitorPeriod 0 must be at least 1 second" {
+		t.Errorf("message %q", err)
+	}
+}
+
+func TestFacilityKey(t *testing.T) {
+	for _, name := range []string{"RoomA", "rooma", "ROOMA", "rOoMa"} {
+		if got := FacilityKey(name); got != "rooma" {
+			t.Errorf("FacilityKey(%q) = %q", name, got)
+		}
+	}
+	if FacilityKey("Room A") == FacilityKey("RoomA") {
+		t.Error("spaces are folded away")
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"default", true},
+		{"physics", true},
+		{"lab-2", true},
+		{strings.Repeat("a", MaxNamespaceLen), true},
+		{"", false},
+		{strings.Repeat("a", MaxNamespaceLen+1), false},
+		{"Physics", false},
+		{"phys ics", false},
+		{"phys/ics", false},
+		{"phys\x1fics", false},
+		{"física", false},
+	}
+	for _, tt := range tests {
+		err := ValidateNamespace(tt.name)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateNamespace(%q) = %v, want valid %v", tt.name, err, tt.valid)
+			continue
+		}
+		if field := fieldOf(t, err); !tt.valid && field != "Namespace" {
+			t.Errorf("ValidateNamespace(%q) names field %q", tt.name, field)
+		}
+	}
+}
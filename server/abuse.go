@@ -0,0 +1,154 @@
+// server/abuse.go
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for -abuseWindow and -abuseCooldown.
+const (
+	defaultAbuseWindow   = 10 * time.Second
+	defaultAbuseCooldown = time.Minute
+)
+
+// maxAbuseSources bounds the sources tracked at once, failing and blocked
+// each. A flood from more addresses than this is not tracked further until
+// old entries expire.
+const maxAbuseSources = 4096
+
+// abuseTracker blocks sources that keep sending malformed packets: more
+// than threshold failures within window block the source's IP for
+// cooldown, during which its packets are dropped before any parsing.
+type abuseTracker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu           sync.Mutex
+	failures     map[string][]time.Time // recent failure times per IP, oldest first
+	blockedUntil map[string]time.Time
+	lastSweep    time.Time
+	dropped      atomic.Uint64 // packets dropped from blocked sources
+}
+
+func newAbuseTracker(threshold int, window, cooldown time.Duration) *abuseTracker {
+	return &abuseTracker{
+		threshold:    threshold,
+		window:       window,
+		cooldown:     cooldown,
+		failures:     make(map[string][]time.Time),
+		blockedUntil: make(map[string]time.Time),
+	}
+}
+
+// peerHost is the address a peer is tracked under: its IP, so a sender
+// cannot escape by changing ports.
+func peerHost(p Peer) string {
+	switch p := p.(type) {
+	case *udpPeer:
+		return p.addr.IP.String()
+	case *tcpPeer:
+		if host, _, err := net.SplitHostPort(p.conn.RemoteAddr().String()); err == nil {
+			return host
+		}
+	}
+	return p.String()
+}
+
+// blocked reports whether packets from host are being dropped. An expired
+// block is lifted here, so the source is served again without any action.
+func (a *abuseTracker) blocked(host string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	until, ok := a.blockedUntil[host]
+	if !ok {
+		return false
+	}
+	if now.Before(until) {
+		a.dropped.Add(1)
+		return true
+	}
+	delete(a.blockedUntil, host)
+	log.Printf("Unblocking %s: cooldown over", host)
+	return false
+}
+
+// fail records a malformed packet from host and blocks the host once it
+// has sent more than threshold within the window.
+func (a *abuseTracker) fail(host string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	times, tracked := a.failures[host]
+	if !tracked && len(a.failures) >= maxAbuseSources {
+		a.sweep(now)
+		if len(a.failures) >= maxAbuseSources {
+			return
+		}
+	}
+	// Drop failures that have slid out of the window
+	cutoff := now.Add(-a.window)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = append(times[i:], now)
+	if len(times) <= a.threshold {
+		a.failures[host] = times
+		return
+	}
+	delete(a.failures, host)
+	if len(a.blockedUntil) >= maxAbuseSources {
+		a.sweep(now)
+		if len(a.blockedUntil) >= maxAbuseSources {
+			return
+		}
+	}
+	a.blockedUntil[host] = now.Add(a.cooldown)
+	log.Printf("Blocking %s for %v: %d malformed packets within %v", host, a.cooldown, len(times), a.window)
+}
+
+// sweep forgets sources with no failure inside the window and lifts
+// expired blocks. It runs at most once a second, so a flood from many
+// addresses does not turn every failure into a scan of the maps. The
+// caller holds a.mu.
+func (a *abuseTracker) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < time.Second {
+		return
+	}
+	a.lastSweep = now
+	cutoff := now.Add(-a.window)
+	for host, times := range a.failures {
+		if !times[len(times)-1].After(cutoff) {
+			delete(a.failures, host)
+		}
+	}
+	for host, until := range a.blockedUntil {
+		if !now.Before(until) {
+			delete(a.blockedUntil, host)
+		}
+	}
+}
+
+// sizes returns the number of sources tracked and blocked, for metrics.
+func (a *abuseTracker) sizes() (tracked, blocked int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.failures), len(a.blockedUntil)
+}
+
+// noteMalformed counts a packet from peer that could not be parsed or
+// verified towards blocking its source.
+func (s *ServerState) noteMalformed(peer Peer) {
+	if s.abuse != nil {
+		s.abuse.fail(peerHost(peer), time.Now())
+	}
+}
+
+// fromBlockedSource reports whether peer's packets are being dropped.
+func (s *ServerState) fromBlockedSource(peer Peer) bool {
+	return s.abuse != nil && s.abuse.blocked(peerHost(peer), time.Now())
+}
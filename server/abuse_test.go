@@ -0,0 +1,119 @@
+// server/abuse_test.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestAbuseTracker(t *testing.T) {
+	a := newAbuseTracker(3, 10*time.Second, time.Minute)
+	now := time.Now()
+
+	// Failures further apart than the window never add up
+	for i := 0; i < 10; i++ {
+		a.fail("10.0.0.1", now.Add(time.Duration(i)*4*time.Second))
+	}
+	if a.blocked("10.0.0.1", now.Add(40*time.Second)) {
+		t.Error("source blocked for failures spread over more than the window")
+	}
+
+	for i := 0; i < 4; i++ {
+		a.fail("10.0.0.2", now.Add(time.Duration(i)*time.Second))
+	}
+	if !a.blocked("10.0.0.2", now.Add(4*time.Second)) {
+		t.Fatal("four failures within the window did not block the source")
+	}
+	if a.blocked("10.0.0.3", now.Add(4*time.Second)) {
+		t.Error("another source is blocked")
+	}
+	if a.blocked("10.0.0.2", now.Add(4*time.Second+time.Minute)) {
+		t.Error("source still blocked after the cooldown")
+	}
+	if _, blocked := a.sizes(); blocked != 0 {
+		t.Errorf("%d sources blocked after the cooldown", blocked)
+	}
+	if n := a.dropped.Load(); n != 1 {
+		t.Errorf("%d packets counted as dropped, want 1", n)
+	}
+}
+
+// TestAbuseMapsBounded sprays failures from more addresses than are
+// tracked: the maps stop growing, and old entries are swept once their
+// window or cooldown has passed.
+func TestAbuseMapsBounded(t *testing.T) {
+	a := newAbuseTracker(1, 10*time.Second, time.Minute)
+	now := time.Now()
+	for i := 0; i < 3*maxAbuseSources; i++ {
+		host := fmt.Sprintf("10.%d.%d.%d", i>>16, i>>8&0xff, i&0xff)
+		a.fail(host, now)
+		if i%2 == 0 {
+			a.fail(host, now) // blocks it
+		}
+	}
+	tracked, blocked := a.sizes()
+	if tracked > maxAbuseSources || blocked > maxAbuseSources {
+		t.Fatalf("%d sources tracked and %d blocked, want at most %d each", tracked, blocked, maxAbuseSources)
+	}
+
+	later := now.Add(2 * time.Minute)
+	a.fail("192.0.2.1", later)
+	a.fail("192.0.2.2", later)
+	a.fail("192.0.2.2", later)
+	if tracked, blocked := a.sizes(); tracked != 1 || blocked != 1 {
+		t.Errorf("after expiry %d sources tracked and %d blocked, want 1 and 1", tracked, blocked)
+	}
+}
+
+// TestAbuseBlocksOnlyTheSender sprays garbage over UDP from 127.0.0.2
+// while a client on 127.0.0.1 keeps working; once the cooldown is over the
+// blocked address is served again.
+func TestAbuseBlocksOnlyTheSender(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.abuse = newAbuseTracker(3, 10*time.Second, 500*time.Millisecond)
+	addr := startUDPServer(t, srv, "127.0.0.1", 1)
+	raddr, _ := net.ResolveUDPAddr("udp", addr)
+	conn, err := net.DialUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)}, raddr)
+	if err != nil {
+		t.Skipf("cannot send from 127.0.0.2: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	abuser := &udpClient{t: t, conn: conn}
+	good := dialUDP(t, addr)
+
+	for i := 0; i < 5; i++ {
+		conn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if _, blocked := srv.abuse.sizes(); blocked == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("garbage sender never blocked")
+		}
+	}
+
+	query := common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"}
+	raw, _ := common.MarshalRequest(query)
+	conn.Write(common.PrefixLength(raw))
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 65536)); err == nil {
+		t.Error("blocked source was answered")
+	}
+	if rep := good.do(query); rep.Status != common.StatusOK {
+		t.Errorf("other source: status %d: %s", rep.Status, rep.Data)
+	}
+	if srv.abuse.dropped.Load() == 0 {
+		t.Error("no packets counted as dropped")
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	query.RequestID = 2
+	if rep := abuser.do(query); rep.Status != common.StatusOK {
+		t.Errorf("after the cooldown: status %d: %s", rep.Status, rep.Data)
+	}
+}
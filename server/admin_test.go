@@ -0,0 +1,121 @@
+// server/admin_test.go
+package main
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// privilegedRequests builds a valid request of each privileged operation,
+// preparing the server so the admin's request can succeed; admin runs a
+// request in the admin's session.
+var privilegedRequests = map[uint8]func(t *testing.T, srv *ServerState, admin func(common.RequestMessage)) common.RequestMessage{
+	common.OpListMonitors: func(*testing.T, *ServerState, func(common.RequestMessage)) common.RequestMessage {
+		return common.RequestMessage{OpCode: common.OpListMonitors}
+	},
+	common.OpAddBlackout: func(*testing.T, *ServerState, func(common.RequestMessage)) common.RequestMessage {
+		req := bookReq(0, "RoomA", 5, 9, 10)
+		req.OpCode, req.Reason = common.OpAddBlackout, "maintenance"
+		return req
+	},
+	common.OpClearBookings: func(*testing.T, *ServerState, func(common.RequestMessage)) common.RequestMessage {
+		return common.RequestMessage{OpCode: common.OpClearBookings, FacilityName: "Lab1", Confirm: true}
+	},
+	common.OpRenameFacility: func(*testing.T, *ServerState, func(common.RequestMessage)) common.RequestMessage {
+		return common.RequestMessage{OpCode: common.OpRenameFacility, FacilityName: "Lab1", NewFacilityName: "Lab2"}
+	},
+	common.OpCreateNamespace: func(*testing.T, *ServerState, func(common.RequestMessage)) common.RequestMessage {
+		return common.RequestMessage{OpCode: common.OpCreateNamespace, TargetNamespace: "physics", MoreFacilities: []string{"Lab1"}}
+	},
+	common.OpDeleteNamespace: func(_ *testing.T, _ *ServerState, admin func(common.RequestMessage)) common.RequestMessage {
+		admin(common.RequestMessage{OpCode: common.OpCreateNamespace, TargetNamespace: "physics", MoreFacilities: []string{"Lab1"}})
+		return common.RequestMessage{OpCode: common.OpDeleteNamespace, TargetNamespace: "physics", Confirm: true}
+	},
+	common.OpApproveBooking: func(t *testing.T, srv *ServerState, _ func(common.RequestMessage)) common.RequestMessage {
+		return common.RequestMessage{OpCode: common.OpApproveBooking, ConfirmationID: pendingBooking(t, srv)}
+	},
+	common.OpRejectBooking: func(t *testing.T, srv *ServerState, _ func(common.RequestMessage)) common.RequestMessage {
+		return common.RequestMessage{OpCode: common.OpRejectBooking, ConfirmationID: pendingBooking(t, srv), Reason: "no"}
+	},
+}
+
+// pendingBooking makes RoomA require approval and books it.
+func pendingBooking(t *testing.T, srv *ServerState) string {
+	t.Helper()
+	if err := srv.applyApprovals([]string{"RoomA"}); err != nil {
+		t.Fatalf("applyApprovals: %v", err)
+	}
+	return confirmationID(t, send(t, srv, newFakePeer("booker"), bookReq(900, "RoomA", 4, 9, 10)))
+}
+
+func TestPrivilegedOperations(t *testing.T) {
+	for op := 0; op < 256; op++ {
+		if common.IsPrivileged(uint8(op)) && privilegedRequests[uint8(op)] == nil {
+			t.Errorf("no test request for privileged %s", common.OpName(uint8(op)))
+		}
+	}
+
+	for op, build := range privilegedRequests {
+		t.Run(common.OpName(op), func(t *testing.T) {
+			if !common.IsPrivileged(op) {
+				t.Fatalf("%s is not privileged", common.OpName(op))
+			}
+			srv := newTestServer(t, SemanticsAtLeastOnce)
+			if err := srv.registerAdmin("admin", "key"); err != nil {
+				t.Fatalf("registerAdmin: %v", err)
+			}
+			p := newFakePeer("client")
+			userToken := login(t, srv, p, 1, "alice", "pw")
+			adminToken := login(t, srv, p, 2, "admin", "key")
+			req := build(t, srv, func(req common.RequestMessage) {
+				req.RequestID, req.SessionToken = 3, adminToken
+				if rep := send(t, srv, p, req); rep.Status != common.StatusOK {
+					t.Fatalf("preparing: %s: status %d: %s", common.OpName(req.OpCode), rep.Status, rep.Data)
+				}
+			})
+
+			tests := []struct {
+				name  string
+				token string
+				want  int32
+			}{
+				{"anonymous", "", common.StatusPermissionDenied},
+				{"user session", userToken, common.StatusPermissionDenied},
+				{"admin session", adminToken, common.StatusOK},
+			}
+			for i, tt := range tests {
+				req.RequestID = uint64(10 + i)
+				req.SessionToken = tt.token
+				if rep := send(t, srv, p, req); rep.Status != tt.want {
+					t.Errorf("%s: status %d, want %d: %s", tt.name, rep.Status, tt.want, rep.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminLoginNeedsTheKey(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	if err := srv.registerAdmin("admin", "key"); err != nil {
+		t.Fatalf("registerAdmin: %v", err)
+	}
+	p := newFakePeer("client")
+	for i, password := range []string{"", "guess"} {
+		rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpRegisterUser, RequestID: uint64(i + 1), Username: "admin", Password: password})
+		if rep.Status == common.StatusOK {
+			t.Errorf("admin login with password %q succeeded", password)
+		}
+	}
+}
+
+func TestNoAdminConfigured(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+	// Without -adminUser nobody is the admin, not even a user named "admin"
+	token := login(t, srv, p, 1, "admin", "")
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpListMonitors, RequestID: 2, SessionToken: token})
+	if rep.Status != common.StatusPermissionDenied {
+		t.Errorf("status %d, want %d", rep.Status, common.StatusPermissionDenied)
+	}
+}
@@ -0,0 +1,242 @@
+// server/approval.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Events reported to webhooks and subscribers of a facility that requires
+// approval when the admin decides on a pending booking, or nobody does in
+// time.
+const (
+	EventBookingApproved = "booking_approved"
+	EventBookingRejected = "booking_rejected"
+	EventBookingExpired  = "booking_expired"
+)
+
+// defaultApprovalTTL is the default for -approvalTTL.
+const defaultApprovalTTL = 24 * time.Hour
+
+// applyApprovals marks the facilities named in the config file as requiring
+// approval. "Lab1" is a facility of the default namespace and
+// "physics/Lab1" one of physics.
+func (s *ServerState) applyApprovals(names []string) error {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	for _, key := range names {
+		ns, name := s.configFacility(key)
+		fac, ok := s.facilityData[ns][name]
+		if !ok {
+			return fmt.Errorf("approval: unknown facility %q", key)
+		}
+		fac.RequiresApproval = true
+	}
+	return nil
+}
+
+// holdForApproval makes a new booking of a facility that requires approval
+// pending: it keeps its time for approvalTTL and is then removed unless the
+// admin has approved it. On a backup, the hold ends when the primary's does.
+func (s *ServerState) holdForApproval(bk *Booking, req common.RequestMessage) {
+	bk.Pending = true
+	bk.PendingUntil = req.PendingUntil
+	if bk.PendingUntil.IsZero() {
+		bk.PendingUntil = s.now().Add(s.approvalTTL)
+	}
+	bk.RequestedBy = req.User
+}
+
+// pendingLabel is how listings mark a booking waiting for approval.
+func pendingLabel(bk Booking) string {
+	return " (pending approval until " + bk.PendingUntil.UTC().Format(time.RFC3339) + ")"
+}
+
+// refusePending is the reply to an operation other than a cancellation on a
+// booking still waiting for approval, which cannot be changed until the
+// admin has decided.
+func refusePending(bk Booking, t *opTiming) (string, int32) {
+	t.reject("ConfirmationID", bk.ConfirmationID)
+	return fmt.Sprintf("Booking %s is pending approval; it can only be canceled until the admin decides", bk.ConfirmationID),
+		common.StatusInvalidArgument
+}
+
+// requester names who made a pending booking in callback messages.
+func requester(bk Booking) string {
+	if bk.RequestedBy == "" {
+		return "an anonymous client"
+	}
+	return bk.RequestedBy
+}
+
+// notifyRequester tells the user who made a pending booking what became of
+// it, at every address the user has a session from. The requester may not
+// monitor the facility, so this doesn't go through its subscriptions;
+// addresses whose subscription to the facility already received the event
+// are skipped. The callback carries no sequence number, as it belongs to
+// no subscription. The caller holds dataLock.
+func (s *ServerState) notifyRequester(ns, facility, eventType string, bk Booking, text string) {
+	if bk.RequestedBy == "" {
+		return
+	}
+	addrs := s.userAddrs(bk.RequestedBy)
+	if len(addrs) == 0 {
+		return
+	}
+	event := eventBits[eventType]
+	days := affectedDays(bk)
+
+	s.monitorLock.Lock()
+	notified := make(map[string]bool)
+	now := s.now()
+	for _, sub := range s.monitorSubs {
+		if sub.Namespace == ns && sub.FacilityName == facility && now.Before(sub.ExpiresAt) &&
+			sub.wantsDays(days) && sub.wantsEvent(event) {
+			notified[sub.ClientAddr.String()] = true
+		}
+	}
+	s.monitorLock.Unlock()
+
+	cb := common.ReplyMessage{OpCode: common.OpCallback, Status: common.StatusOK, Data: text}
+	cb.Extensions.PutString(common.ExtCallbackFacility, facility)
+	if event != 0 {
+		cb.Extensions.Put(common.ExtCallbackEvent, []byte{event})
+	}
+	raw, err := s.encodeReply(cb)
+	if err != nil {
+		log.Printf("Failed to encode requester callback for booking '%s': %v", bk.ConfirmationID, err)
+		return
+	}
+	for _, addr := range addrs {
+		if notified[addr.String()] {
+			continue
+		}
+		if err := addr.Send(raw); err != nil {
+			log.Printf("Failed to notify %s at %s about booking '%s': %v", bk.RequestedBy, addr, bk.ConfirmationID, err)
+			continue
+		}
+		log.Printf("Notified %s at %s about booking '%s'", bk.RequestedBy, addr, bk.ConfirmationID)
+	}
+}
+
+// handleApproveBooking confirms a pending booking. From then on it is an
+// ordinary booking: it is written to the store and no longer expires.
+func (s *ServerState) handleApproveBooking(req common.RequestMessage, t *opTiming) (string, int32) {
+	confID := req.ConfirmationID
+	log.Printf("Handling ApproveBooking for ConfirmationID '%s'", confID)
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	facName, fac, index, ok := s.findBooking(req.Namespace, confID)
+	if !ok {
+		log.Printf("Booking '%s' not found in ApproveBooking", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Error: Booking %s not found", confID), -1
+	}
+	bk := fac.Bookings[index]
+	if !bk.Pending {
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Booking %s is not pending approval", confID), common.StatusInvalidArgument
+	}
+
+	approved := bk
+	approved.Pending = false
+	approved.PendingUntil = time.Time{}
+	if err := s.store.SaveBooking(qualify(req.Namespace, facName), approved); err != nil {
+		log.Printf("Failed to persist approved booking '%s': %v", confID, err)
+		return "Error: could not save booking.", -1
+	}
+	fac.Bookings[index] = approved
+
+	s.notifySubscribers(req.Namespace, facName, EventBookingApproved, confID,
+		fmt.Sprintf("Booking %s by %s approved", confID, requester(bk)), affectedDays(bk))
+	s.notifyRequester(req.Namespace, facName, EventBookingApproved, bk,
+		fmt.Sprintf("Your booking %s of %s was approved", confID, facName))
+	msg := fmt.Sprintf("Approved booking %s in '%s'.", confID, facName)
+	log.Printf("ApproveBooking successful: %s", msg)
+	return msg, 0
+}
+
+// handleRejectBooking removes a pending booking, freeing its time, and
+// passes the admin's reason on to the subscribers.
+func (s *ServerState) handleRejectBooking(req common.RequestMessage, t *opTiming) (string, int32) {
+	confID := req.ConfirmationID
+	log.Printf("Handling RejectBooking for ConfirmationID '%s'", confID)
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	facName, fac, index, ok := s.findBooking(req.Namespace, confID)
+	if !ok {
+		log.Printf("Booking '%s' not found in RejectBooking", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Error: Booking %s not found", confID), -1
+	}
+	bk := fac.Bookings[index]
+	if !bk.Pending {
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Booking %s is not pending approval; cancel it instead", confID), common.StatusInvalidArgument
+	}
+
+	fac.Bookings = append(fac.Bookings[:index], fac.Bookings[index+1:]...)
+	update := fmt.Sprintf("Booking %s by %s rejected", confID, requester(bk))
+	if req.Reason != "" {
+		update += ": " + req.Reason
+	}
+	s.notifySubscribers(req.Namespace, facName, EventBookingRejected, confID, update, affectedDays(bk))
+	mine := fmt.Sprintf("Your booking %s of %s was rejected", confID, facName)
+	if req.Reason != "" {
+		mine += ": " + req.Reason
+	}
+	s.notifyRequester(req.Namespace, facName, EventBookingRejected, bk, mine)
+	msg := fmt.Sprintf("Rejected booking %s in '%s'.", confID, facName)
+	log.Printf("RejectBooking successful: %s", msg)
+	return msg, 0
+}
+
+// expirePending removes the pending bookings whose time to be approved
+// ended before now, in every namespace, and returns how many it removed.
+func (s *ServerState) expirePending(now time.Time) int {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	removed := 0
+	for ns, facilities := range s.facilityData {
+		for name, fac := range facilities {
+			kept := fac.Bookings[:0]
+			var expired []Booking
+			for _, bk := range fac.Bookings {
+				if bk.Pending && now.After(bk.PendingUntil) {
+					expired = append(expired, bk)
+					continue
+				}
+				kept = append(kept, bk)
+			}
+			fac.Bookings = kept
+			for _, bk := range expired {
+				log.Printf("Booking '%s' of facility '%s' was not approved in time; removing it", bk.ConfirmationID, name)
+				s.notifySubscribers(ns, name, EventBookingExpired, bk.ConfirmationID,
+					fmt.Sprintf("Booking %s by %s expired without approval", bk.ConfirmationID, requester(bk)), affectedDays(bk))
+				s.notifyRequester(ns, name, EventBookingExpired, bk,
+					fmt.Sprintf("Your booking %s of %s expired without approval", bk.ConfirmationID, name))
+			}
+			removed += len(expired)
+		}
+	}
+	return removed
+}
+
+// sweepPending removes pending bookings nobody approved in time, every
+// interval.
+func (s *ServerState) sweepPending(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.expirePending(s.now())
+	}
+}
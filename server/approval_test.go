@@ -0,0 +1,228 @@
+// server/approval_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// approvalFixture is a server whose RoomA requires approval, with alice
+// logged in to book it and a watcher monitoring it.
+type approvalFixture struct {
+	srv     *ServerState
+	store   *writeCounter
+	admin   func(common.RequestMessage) common.ReplyMessage
+	alice   *fakePeer
+	token   string
+	watcher *fakePeer
+}
+
+func newApprovalFixture(t *testing.T) *approvalFixture {
+	t.Helper()
+	st := &writeCounter{Store: NewMemoryStore()}
+	srv := newStoreServer(t, st)
+	if err := srv.applyApprovals([]string{"RoomA"}); err != nil {
+		t.Fatalf("applyApprovals: %v", err)
+	}
+	f := &approvalFixture{srv: srv, store: st, admin: adminSender(t, srv),
+		alice: newFakePeer("alice"), watcher: newFakePeer("watcher")}
+	f.token = login(t, srv, f.alice, 1, "alice", "pw")
+	if rep := send(t, srv, f.watcher, monitorReq(2, nil, 0)); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+	return f
+}
+
+// book has alice book RoomA on Friday from..to o'clock.
+func (f *approvalFixture) book(t *testing.T, id uint64, from, to uint8) common.ReplyMessage {
+	t.Helper()
+	req := bookReq(id, "RoomA", 4, from, to)
+	req.SessionToken = f.token
+	return send(t, f.srv, f.alice, req)
+}
+
+// pending books Friday 09:00-10:00 and checks it is held for approval.
+func (f *approvalFixture) pending(t *testing.T) string {
+	t.Helper()
+	rep := f.book(t, 10, 9, 10)
+	id := confirmationID(t, rep)
+	if !strings.Contains(rep.Data, "(pending approval until ") {
+		t.Errorf("booking reply %q does not say it is pending", rep.Data)
+	}
+	if f.store.writes != 0 {
+		t.Errorf("a pending booking was written to the store")
+	}
+	if got := queryData(t, f.srv, 11, []uint8{4}, "RoomA"); !strings.Contains(got, id+" (pending approval until ") {
+		t.Errorf("query does not label %s pending:\n%s", id, got)
+	}
+	if rep := f.book(t, 12, 9, 10); rep.Status != common.StatusConflict {
+		t.Errorf("booking over the pending one: status %d: %s", rep.Status, rep.Data)
+	}
+	return id
+}
+
+// heard returns the text of the callbacks p got after the first skip.
+func heard(p *fakePeer, skip int) []string {
+	var texts []string
+	for _, cb := range p.callbacks()[skip:] {
+		texts = append(texts, cb.Data)
+	}
+	return texts
+}
+
+// TestApprovalTransitions takes a pending booking to each of its ends and
+// checks where its time, the store and the notices end up.
+func TestApprovalTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		decide  func(t *testing.T, f *approvalFixture, id string) common.ReplyMessage
+		kept    bool
+		writes  int
+		watcher string // what the monitor of RoomA is told
+		alice   string // what the requester is told, "" for nothing
+	}{
+		{
+			name: "approved",
+			decide: func(t *testing.T, f *approvalFixture, id string) common.ReplyMessage {
+				return f.admin(common.RequestMessage{OpCode: common.OpApproveBooking, RequestID: 20, ConfirmationID: id})
+			},
+			kept:    true,
+			writes:  1,
+			watcher: "Facility=RoomA updated: Booking %s by alice approved",
+			alice:   "Your booking %s of RoomA was approved",
+		},
+		{
+			name: "rejected",
+			decide: func(t *testing.T, f *approvalFixture, id string) common.ReplyMessage {
+				return f.admin(common.RequestMessage{OpCode: common.OpRejectBooking, RequestID: 20, ConfirmationID: id, Reason: "exam week"})
+			},
+			watcher: "Facility=RoomA updated: Booking %s by alice rejected: exam week",
+			alice:   "Your booking %s of RoomA was rejected: exam week",
+		},
+		{
+			name: "expired",
+			decide: func(t *testing.T, f *approvalFixture, id string) common.ReplyMessage {
+				if n := f.srv.expirePending(time.Now().Add(f.srv.approvalTTL - time.Minute)); n != 0 {
+					t.Errorf("%d bookings expired before their time", n)
+				}
+				if n := f.srv.expirePending(time.Now().Add(f.srv.approvalTTL + time.Minute)); n != 1 {
+					t.Errorf("%d bookings expired, want 1", n)
+				}
+				return common.ReplyMessage{}
+			},
+			watcher: "Facility=RoomA updated: Booking %s by alice expired without approval",
+			alice:   "Your booking %s of RoomA expired without approval",
+		},
+		{
+			name: "canceled",
+			decide: func(t *testing.T, f *approvalFixture, id string) common.ReplyMessage {
+				req := common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 20, ConfirmationID: id, SessionToken: f.token}
+				return send(t, f.srv, f.alice, req)
+			},
+			writes:  1, // the delete of a booking the store never had
+			watcher: "Facility=RoomA updated: Booking %s canceled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newApprovalFixture(t)
+			id := f.pending(t)
+			watched, told := len(f.watcher.callbacks()), len(f.alice.callbacks())
+
+			if rep := tt.decide(t, f, id); rep.Status != common.StatusOK {
+				t.Fatalf("status %d: %s", rep.Status, rep.Data)
+			}
+			if f.store.writes != tt.writes {
+				t.Errorf("%d store writes, want %d", f.store.writes, tt.writes)
+			}
+			if got := heard(f.watcher, watched); len(got) != 1 || got[0] != strings.Replace(tt.watcher, "%s", id, 1) {
+				t.Errorf("watcher told %q", got)
+			}
+			got := heard(f.alice, told)
+			if want := strings.Replace(tt.alice, "%s", id, 1); tt.alice == "" && len(got) != 0 || tt.alice != "" && (len(got) != 1 || got[0] != want) {
+				t.Errorf("alice told %q, want %q", got, want)
+			}
+
+			data := queryData(t, f.srv, 21, []uint8{4}, "RoomA")
+			if strings.Contains(data, "pending") || strings.Contains(data, id) != tt.kept {
+				t.Errorf("query after the decision:\n%s", data)
+			}
+			// Nothing is left to expire
+			if n := f.srv.expirePending(time.Now().Add(f.srv.approvalTTL + time.Minute)); n != 0 {
+				t.Errorf("%d bookings expired after the decision", n)
+			}
+			rep := f.book(t, 22, 9, 10)
+			if freed := rep.Status == common.StatusOK; freed == tt.kept {
+				t.Errorf("booking the slot again: status %d: %s", rep.Status, rep.Data)
+			}
+		})
+	}
+}
+
+// TestPendingRefusals: until the admin decides, a pending booking can only
+// be canceled, and the admin can decide only once.
+func TestPendingRefusals(t *testing.T) {
+	f := newApprovalFixture(t)
+	id := f.pending(t)
+	for _, req := range []common.RequestMessage{
+		{OpCode: common.OpChangeBooking, RequestID: 30, ConfirmationID: id, OffsetMinutes: 60},
+		splitReq(31, id, 9*60, 9*60+30),
+		copyReq(32, id, 3),
+		transferReq(33, id, "Lab1"),
+	} {
+		rep := send(t, f.srv, f.alice, req)
+		if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, "is pending approval") {
+			t.Errorf("%s of a pending booking: status %d: %s", common.OpName(req.OpCode), rep.Status, rep.Data)
+		}
+	}
+	if start, _ := bookingInterval(t, f.srv, id); start != 4*1440+9*60 {
+		t.Errorf("pending booking moved to minute %d", start)
+	}
+
+	if rep := f.admin(common.RequestMessage{OpCode: common.OpApproveBooking, RequestID: 40, ConfirmationID: id}); rep.Status != common.StatusOK {
+		t.Fatalf("approve: status %d: %s", rep.Status, rep.Data)
+	}
+	for i, op := range []uint8{common.OpApproveBooking, common.OpRejectBooking} {
+		rep := f.admin(common.RequestMessage{OpCode: op, RequestID: uint64(41 + i), ConfirmationID: id})
+		if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, "is not pending approval") {
+			t.Errorf("%s of an approved booking: status %d: %s", common.OpName(op), rep.Status, rep.Data)
+		}
+	}
+	for i, op := range []uint8{common.OpApproveBooking, common.OpRejectBooking} {
+		rep := f.admin(common.RequestMessage{OpCode: op, RequestID: uint64(43 + i), ConfirmationID: "BKG-99999"})
+		if rep.Status != -1 || rep.Data != "Error: Booking BKG-99999 not found" {
+			t.Errorf("%s of an unknown booking: status %d: %s", common.OpName(op), rep.Status, rep.Data)
+		}
+	}
+	// Approved, it is an ordinary booking again
+	rep := send(t, f.srv, f.alice, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 50, ConfirmationID: id, OffsetMinutes: 60})
+	if rep.Status != common.StatusOK {
+		t.Errorf("change of the approved booking: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestApprovalNotRequired: other facilities book at once, and an anonymous
+// pending booking notifies only its facility's monitors.
+func TestApprovalNotRequired(t *testing.T) {
+	f := newApprovalFixture(t)
+	rep := send(t, f.srv, f.alice, bookReq(60, "Lab1", 4, 9, 10))
+	if id := confirmationID(t, rep); strings.Contains(rep.Data, "pending") || f.store.writes != 1 {
+		t.Errorf("Lab1 booking %s: %s, %d writes", id, rep.Data, f.store.writes)
+	}
+
+	anon := newFakePeer("anon")
+	id := confirmationID(t, send(t, f.srv, anon, bookReq(61, "RoomA", 4, 14, 15)))
+	watched := len(f.watcher.callbacks())
+	if rep := f.admin(common.RequestMessage{OpCode: common.OpRejectBooking, RequestID: 62, ConfirmationID: id}); rep.Status != common.StatusOK {
+		t.Fatalf("reject: status %d: %s", rep.Status, rep.Data)
+	}
+	if got := heard(f.watcher, watched); len(got) != 1 || got[0] != "Facility=RoomA updated: Booking "+id+" by an anonymous client rejected" {
+		t.Errorf("watcher told %q", got)
+	}
+	if n := len(anon.callbacks()); n != 0 {
+		t.Errorf("anonymous requester got %d callbacks", n)
+	}
+}
@@ -0,0 +1,142 @@
+// server/auth_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestRequestAuthentication sends requests with valid, tampered, missing and
+// unexpected MACs to servers with and without -authKey.
+func TestRequestAuthentication(t *testing.T) {
+	key := []byte("shared-secret")
+	keyed := common.PacketSecurity{Key: key}
+	tamper := func(p []byte) []byte {
+		p[len(p)-common.MACSize-1] ^= 0x01
+		return p
+	}
+
+	tests := []struct {
+		name       string
+		serverKey  []byte
+		client     common.PacketSecurity
+		mangle     func([]byte) []byte
+		wantStatus int32 // of the reply; 1 for no reply at all
+		authFails  uint64
+	}{
+		{"valid MAC", key, keyed, nil, common.StatusOK, 0},
+		{"tampered request", key, keyed, tamper, 1, 1},
+		{"wrong key", key, common.PacketSecurity{Key: []byte("guess")}, nil, 1, 1},
+		{"missing MAC", key, common.PacketSecurity{}, nil, common.StatusAuthRequired, 1},
+		{"unexpected MAC", nil, keyed, nil, common.StatusAuthRequired, 1},
+		{"neither side", nil, common.PacketSecurity{}, nil, common.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtLeastOnce)
+			srv.security = common.PacketSecurity{Key: tt.serverKey}
+			p := newFakePeer("client")
+			p.security = tt.client
+
+			packet := p.seal(t, bookReq(1, "RoomA", 3, 9, 10))
+			if tt.mangle != nil {
+				packet = tt.mangle(packet)
+			}
+			got := deliver(srv, p, packet)
+
+			switch {
+			case tt.wantStatus == 1 && len(got) != 0:
+				t.Errorf("got reply %q, want the packet dropped", got[0].Data)
+			case tt.wantStatus != 1 && len(got) != 1:
+				t.Errorf("got %d replies, want 1", len(got))
+			case tt.wantStatus != 1 && got[0].Status != tt.wantStatus:
+				t.Errorf("status %d, want %d: %s", got[0].Status, tt.wantStatus, got[0].Data)
+			}
+			if n := srv.authFailures.Load(); n != tt.authFails {
+				t.Errorf("auth failures = %d, want %d", n, tt.authFails)
+			}
+			// Nothing was booked unless the request was accepted
+			booked := len(srv.facilityData[common.DefaultNamespace]["RoomA"].Bookings) > 2
+			if booked != (tt.wantStatus == common.StatusOK) {
+				t.Errorf("booking made = %v", booked)
+			}
+		})
+	}
+}
+
+// TestReplyAuthentication checks what a keyed server sends back: replies
+// and callbacks carry a MAC that verifies with the key and fails without it,
+// while a mismatch report stays readable in plaintext.
+func TestReplyAuthentication(t *testing.T) {
+	key := []byte("shared-secret")
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.security = common.PacketSecurity{Key: key}
+
+	watcher := newFakePeer("watcher")
+	watcher.security = srv.security
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	client := newFakePeer("client")
+	client.security = srv.security
+	send(t, srv, client, bookReq(2, "RoomA", 3, 9, 10))
+
+	for _, p := range []*fakePeer{watcher, client} {
+		for i, raw := range p.rawReceived() {
+			if _, err := common.VerifyPacket(key, raw); err != nil {
+				t.Errorf("%s packet %d: %v", p, i, err)
+			}
+			if _, err := common.VerifyPacket([]byte("guess"), raw); err == nil {
+				t.Errorf("%s packet %d verifies with the wrong key", p, i)
+			}
+			if _, err := common.VerifyPacket(nil, raw); err == nil {
+				t.Errorf("%s packet %d accepted by a peer without a key", p, i)
+			}
+		}
+	}
+	if len(watcher.callbacks()) != 1 {
+		t.Errorf("watcher got %d callbacks, want 1", len(watcher.callbacks()))
+	}
+
+	plain := newFakePeer("plain")
+	got := deliver(srv, plain, plain.seal(t, bookReq(3, "RoomA", 4, 9, 10)))
+	if len(got) != 1 || got[0].Status != common.StatusAuthRequired {
+		t.Fatalf("plaintext client got %+v, want one StatusAuthRequired reply", got)
+	}
+	if _, err := common.VerifyPacket(nil, plain.rawReceived()[0]); err != nil {
+		t.Errorf("mismatch report is not plaintext: %v", err)
+	}
+}
+
+// TestEncryptedRequests runs a booking through an encrypting server and
+// checks that a bit-flipped ciphertext is dropped without being executed.
+func TestEncryptedRequests(t *testing.T) {
+	sec := common.PacketSecurity{Key: []byte("shared-secret"), Encrypt: true}
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.security = sec
+	p := newFakePeer("client")
+	p.security = sec
+
+	id := confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 3, 9, 10)))
+	if raw := p.rawReceived()[0]; !common.IsEncrypted(raw) {
+		t.Error("reply is not encrypted")
+	}
+
+	// Flip a bit of the ciphertext and fix up the MAC, as an attacker who
+	// had the HMAC key but not a valid ciphertext would
+	body, err := common.VerifyPacket(sec.Key, p.seal(t, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 2, ConfirmationID: id}))
+	if err != nil {
+		t.Fatalf("VerifyPacket: %v", err)
+	}
+	body[len(body)-1] ^= 0x01
+	body[common.MagicSize+9] &^= common.FlagAuthenticated
+	if got := deliver(srv, p, common.SignPacket(sec.Key, body)); len(got) != 0 {
+		t.Errorf("bit-flipped request got a reply: %q", got[0].Data)
+	}
+	if n := srv.decryptFailures.Load(); n != 1 {
+		t.Errorf("decrypt failures = %d, want 1", n)
+	}
+	if q := query(t, srv, p, 3, "RoomA", 3); !strings.Contains(q, id) {
+		t.Errorf("booking %s is gone after the rejected cancel:\n%s", id, q)
+	}
+}
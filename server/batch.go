@@ -0,0 +1,39 @@
+// server/batch.go
+package main
+
+import (
+	"log"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleBatch executes the sub-requests of an OpBatch envelope in order and
+// collects one reply per entry. Each entry inherits the envelope's session
+// user and semantics and is deduplicated by its own RequestID, so a
+// retransmitted batch re-runs only what at-most-once lets through. A failing
+// entry does not stop the ones after it.
+func (s *ServerState) handleBatch(envelope common.RequestMessage, semantics string, clientAddr Peer) common.ReplyMessage {
+	log.Printf("Handling batch %d from %s with %d entries", envelope.RequestID, clientAddr, len(envelope.Batch))
+	replies := make([]common.ReplyMessage, 0, len(envelope.Batch))
+	for _, req := range envelope.Batch {
+		req.User, req.SessionToken = envelope.User, envelope.SessionToken
+		reply, ok := s.execute(req, semantics, clientAddr)
+		if !ok {
+			// A duplicate dropped by -inflight=drop still needs an entry;
+			// it is not cached, so a retry finds the original's reply
+			reply = common.ReplyMessage{
+				RequestID: req.RequestID,
+				OpCode:    req.OpCode,
+				Status:    common.StatusError,
+				Data:      "Request is still executing; retry later",
+			}
+		}
+		replies = append(replies, reply)
+	}
+	return common.ReplyMessage{
+		RequestID: envelope.RequestID,
+		OpCode:    common.OpBatch,
+		Status:    common.StatusOK,
+		Replies:   replies,
+	}
+}
@@ -0,0 +1,129 @@
+// server/batch_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func batchReq(id uint64, entries ...common.RequestMessage) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpBatch, RequestID: id, Batch: entries}
+}
+
+// TestBatchPartialFailure runs a batch whose middle entry fails: the
+// entries after it still run and each gets its own reply, in order.
+func TestBatchPartialFailure(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	rep := send(t, srv, p, batchReq(10,
+		addParticipant(11, "Ada"),
+		common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 12, ConfirmationID: "BKG-99999", ParticipantName: "Bob"},
+		addParticipant(13, "Grace"),
+	))
+	if rep.Status != common.StatusOK || rep.OpCode != common.OpBatch {
+		t.Fatalf("envelope: status %d: %s", rep.Status, rep.Data)
+	}
+	if len(rep.Replies) != 3 {
+		t.Fatalf("%d replies, want 3", len(rep.Replies))
+	}
+	wantOK := []bool{true, false, true}
+	for i, r := range rep.Replies {
+		if r.RequestID != uint64(11+i) {
+			t.Errorf("reply %d has RequestID %d", i, r.RequestID)
+		}
+		if (r.Status == common.StatusOK) != wantOK[i] {
+			t.Errorf("reply %d: status %d: %s", i, r.Status, r.Data)
+		}
+	}
+	if got := participants(srv); got != "Ada,Grace" {
+		t.Errorf("participants = %q, want Ada,Grace", got)
+	}
+}
+
+// TestBatchDedup retransmits a batch and sends one of its entries alone:
+// under at-most-once each entry runs once, and the cached replies are the
+// originals.
+func TestBatchDedup(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	batch := batchReq(10, addParticipant(11, "Ada"), addParticipant(12, "Grace"))
+
+	first := send(t, srv, p, batch)
+	again := send(t, srv, p, batch)
+	for i := range first.Replies {
+		if again.Replies[i].Data != first.Replies[i].Data {
+			t.Errorf("entry %d: retransmission got %q, want %q", i, again.Replies[i].Data, first.Replies[i].Data)
+		}
+	}
+	if rep := send(t, srv, p, addParticipant(12, "Grace")); rep.Data != first.Replies[1].Data {
+		t.Errorf("entry sent alone got %q, want the batch's reply", rep.Data)
+	}
+	// An entry already executed alone is not run again inside a batch
+	send(t, srv, p, addParticipant(20, "Linus"))
+	send(t, srv, p, batchReq(21, addParticipant(20, "Linus"), addParticipant(22, "Ken")))
+	if got := participants(srv); got != "Ada,Grace,Linus,Ken" {
+		t.Errorf("participants = %q, want each added once", got)
+	}
+}
+
+func TestBatchAtLeastOnce(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+	batch := batchReq(10, addParticipant(11, "Ada"))
+	send(t, srv, p, batch)
+	send(t, srv, p, batch)
+	if got := participants(srv); got != "Ada,Ada" {
+		t.Errorf("participants = %q, want the entry run twice", got)
+	}
+}
+
+// TestBatchInheritsSession checks entries run in the envelope's session:
+// they are deduplicated per session, so the same entry sent alone with the
+// token from another address is answered from the history.
+func TestBatchInheritsSession(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	token := login(t, srv, p, 1, "alice", "pw")
+
+	env := batchReq(10, addParticipant(11, "Ada"))
+	env.SessionToken = token
+	rep := send(t, srv, p, env)
+	if len(rep.Replies) != 1 || rep.Replies[0].Status != common.StatusOK {
+		t.Fatalf("batch: %+v", rep)
+	}
+
+	alone := addParticipant(11, "Ada")
+	alone.SessionToken = token
+	if again := send(t, srv, newFakePeer("moved"), alone); again.Data != rep.Replies[0].Data {
+		t.Errorf("entry resent in the session got %q, want %q", again.Data, rep.Replies[0].Data)
+	}
+	if got := participants(srv); got != "Ada" {
+		t.Errorf("participants = %q, want Ada once", got)
+	}
+}
+
+// TestBatchTooLarge checks the size limit applies to the whole envelope,
+// cut off by the listener's buffer as in TestMaxRequestSize: none of its
+// entries run.
+func TestBatchTooLarge(t *testing.T) {
+	const limit = 256
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.maxRequestSize = limit
+	p := newFakePeer("client")
+	var entries []common.RequestMessage
+	for i := uint64(0); i < 20; i++ {
+		entries = append(entries, addParticipant(11+i, strings.Repeat("x", 20)))
+	}
+	datagram := common.PrefixLength(p.seal(t, batchReq(10, entries...)))
+	srv.handleDatagram(datagram[:common.LengthPrefixSize+limit], p)
+
+	got := p.received()
+	if len(got) != 1 || got[0].Status != common.StatusTooLarge {
+		t.Fatalf("replies %+v, want one StatusTooLarge", got)
+	}
+	if got := participants(srv); got != "" {
+		t.Errorf("participants = %q after a refused batch", got)
+	}
+}
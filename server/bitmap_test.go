@@ -0,0 +1,92 @@
+// server/bitmap_test.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// bitmapFromText rebuilds the bitmap of one day from its "Available
+// timings:" line: a slot is busy unless all of it is free.
+func bitmapFromText(t *testing.T, timings string) common.DayBitmap {
+	t.Helper()
+	free := make([]bool, 1440)
+	if timings != "Fully booked" {
+		for _, part := range strings.Split(timings, ", ") {
+			var fh, fm, th, tm int
+			if _, err := fmt.Sscanf(part, "%d:%d-%d:%d", &fh, &fm, &th, &tm); err != nil {
+				t.Fatalf("free range %q: %v", part, err)
+			}
+			for m := fh*60 + fm; m < th*60+tm; m++ {
+				free[m] = true
+			}
+		}
+	}
+	var b common.DayBitmap
+	for m := range free {
+		if !free[m] {
+			b.MarkBusy(m, m+1)
+		}
+	}
+	return b
+}
+
+// TestBitmapMatchesIntervals queries a week with odd edges both ways and
+// checks the bitmaps say what the interval text says.
+func TestBitmapMatchesIntervals(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	for i, span := range [][2]string{
+		{"Wed 10:05", "Wed 10:10"},
+		{"Thu 23:00", "Fri 01:00"},
+		{"Sat 00:00", "Sat 24:00"},
+	} {
+		confirmationID(t, send(t, srv, p, windowReq(t, common.OpBookFacility, uint64(i+1), "RoomA", span[0], span[1])))
+	}
+	if err := srv.applyBlackouts([]BlackoutConfig{{Facility: "RoomA", Start: "Sun 08:00", End: "Sun 08:05"}}); err != nil {
+		t.Fatalf("applyBlackouts: %v", err)
+	}
+
+	text := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 10, FacilityName: "RoomA"})
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 11, FacilityName: "RoomA", Bitmap: true})
+	busy, ok, err := common.BusyBitmaps(rep)
+	if !ok || err != nil || len(busy) != 7 {
+		t.Fatalf("bitmap reply %q: %d days, %v, %v", rep.Data, len(busy), ok, err)
+	}
+
+	var timings []string
+	for _, line := range strings.Split(text.Data, "\n") {
+		if rest, ok := strings.CutPrefix(line, "Available timings: "); ok {
+			timings = append(timings, rest)
+		}
+	}
+	if len(timings) != 7 {
+		t.Fatalf("%d days of timings in\n%s", len(timings), text.Data)
+	}
+	for i, d := range busy {
+		if d.Day != uint8(i) {
+			t.Errorf("bitmap %d is of day %d", i, d.Day)
+		}
+		if want := bitmapFromText(t, timings[i]); d.Slots != want {
+			t.Errorf("%s: bitmap % x, text %q gives % x", common.DayName(d.Day), d.Slots, timings[i], want)
+		}
+	}
+
+	// A booking of part of a slot makes the whole slot busy
+	wed := busy[2].Slots
+	if !wed.Busy(40) || wed.Busy(39) || wed.Busy(41) {
+		t.Errorf("Wednesday 10:00-10:15 slots: 09:45 %v, 10:00 %v, 10:15 %v", wed.Busy(39), wed.Busy(40), wed.Busy(41))
+	}
+}
+
+func TestBitmapSingleFacility(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1,
+		FacilityName: "RoomA", MoreFacilities: []string{"Lab1"}, Bitmap: true})
+	if rep.Status != common.StatusInvalidArgument {
+		t.Errorf("status %d: %s", rep.Status, rep.Data)
+	}
+}
@@ -0,0 +1,176 @@
+// server/blackout.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// EventFacilityClosed is reported to webhooks and subscribers when a
+// blackout is added.
+const EventFacilityClosed = "facility_closed"
+
+// Blackout is a period in which a facility cannot be booked, such as
+// cleaning or a holiday. It occupies the schedule like a booking but has no
+// confirmation ID.
+type Blackout struct {
+	StartDay    uint8
+	StartHour   uint8
+	StartMinute uint8
+	EndDay      uint8
+	EndHour     uint8
+	EndMinute   uint8
+	Reason      string
+}
+
+// BlackoutConfig is one blackout from the config file; Start and End are
+// written like "Sat 08:00".
+type BlackoutConfig struct {
+	Facility string `json:"facility"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Reason   string `json:"reason"`
+}
+
+// asBooking returns the blackout as a booking, so the availability and
+// overlap helpers treat it as occupied time.
+func (b Blackout) asBooking() Booking {
+	return Booking{
+		StartDay: b.StartDay, StartHour: b.StartHour, StartMinute: b.StartMinute,
+		EndDay: b.EndDay, EndHour: b.EndHour, EndMinute: b.EndMinute,
+	}
+}
+
+// label is how query output shows the blackout.
+func (b Blackout) label() string {
+	reason := common.EscapeText(b.Reason)
+	if reason == "" {
+		reason = "maintenance"
+	}
+	return fmt.Sprintf("CLOSED (%s)", reason)
+}
+
+// span renders the blackout as "Sat 08:00 to Sat 12:00".
+func (b Blackout) span() string {
+	return formatWeekMinutes(schedule.ToMinutes(b.StartDay, b.StartHour, b.StartMinute)) + " to " +
+		formatWeekMinutes(schedule.ToMinutes(b.EndDay, b.EndHour, b.EndMinute))
+}
+
+// occupied returns the minutes in which the facility takes no more
+// bookings: its blackouts and the stretches its bookings fill, for
+// computing free time.
+func (f *FacilityInfo) occupied() []schedule.Interval {
+	all := f.full()
+	for _, b := range f.Blackouts {
+		all = append(all, b.asBooking().interval())
+	}
+	return all
+}
+
+// blackoutOverlapping returns the first blackout that overlaps the window
+// [start, end), in minutes since Monday 00:00.
+func (f *FacilityInfo) blackoutOverlapping(start, end int32) (Blackout, bool) {
+	window := schedule.Interval{Start: start, End: end}
+	for _, b := range f.Blackouts {
+		if b.asBooking().interval().Overlaps(window) {
+			return b, true
+		}
+	}
+	return Blackout{}, false
+}
+
+// blackoutConflict is the reply for a booking window that runs into a
+// blackout.
+func blackoutConflict(b Blackout) string {
+	return fmt.Sprintf("Time conflict: the facility is %s from %s.", b.label(), b.span())
+}
+
+// applyBlackouts adds the blackouts from the config file, whose facilities
+// are those of the default namespace. Unlike the admin operation it refuses
+// blackouts over existing bookings, since nobody would be told about them.
+func (s *ServerState) applyBlackouts(configs []BlackoutConfig) error {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	for i, c := range configs {
+		fac, ok := s.facilityData[common.DefaultNamespace][c.Facility]
+		if !ok {
+			return fmt.Errorf("blackout %d: unknown facility %q", i, c.Facility)
+		}
+		start, err := parseWeekTime(c.Start)
+		if err != nil {
+			return fmt.Errorf("blackout %d: start: %w", i, err)
+		}
+		end, err := parseWeekTime(c.End)
+		if err != nil {
+			return fmt.Errorf("blackout %d: end: %w", i, err)
+		}
+		if end <= start {
+			return fmt.Errorf("blackout %d: end %q is not after start %q", i, c.End, c.Start)
+		}
+		b := newBlackout(start, end, c.Reason)
+		if ids := overlappingBookings(fac, start, end); len(ids) > 0 {
+			return fmt.Errorf("blackout %d (%s %s) overlaps bookings %s", i, c.Facility, b.span(), strings.Join(ids, ", "))
+		}
+		fac.Blackouts = append(fac.Blackouts, b)
+	}
+	return nil
+}
+
+// newBlackout builds a blackout from minutes since Monday 00:00.
+func newBlackout(start, end int32, reason string) Blackout {
+	sd, sh, sm := schedule.FromMinutes(start)
+	ed, eh, em := schedule.FromMinutes(end)
+	return Blackout{StartDay: sd, StartHour: sh, StartMinute: sm, EndDay: ed, EndHour: eh, EndMinute: em, Reason: reason}
+}
+
+// overlappingBookings lists the IDs of a facility's bookings that overlap
+// [start, end).
+func overlappingBookings(fac *FacilityInfo, start, end int32) []string {
+	var ids []string
+	window := schedule.Interval{Start: start, End: end}
+	for _, bk := range fac.Bookings {
+		if bk.interval().Overlaps(window) {
+			ids = append(ids, bk.ConfirmationID)
+		}
+	}
+	return ids
+}
+
+// handleAddBlackout closes a facility for a period. Bookings already in the
+// period are kept, but the reply lists them and subscribers are told, so
+// they can be moved or cancelled.
+func (s *ServerState) handleAddBlackout(req common.RequestMessage, t *opTiming) (string, int32) {
+	facName := req.FacilityName
+	log.Printf("Handling AddBlackout for facility '%s'", facName)
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	fac, ok := s.facilityData[req.Namespace][facName]
+	if !ok {
+		t.reject("FacilityName", facName)
+		return s.facilityNotFound(req.Namespace, facName), -1
+	}
+	if msg, ok := checkTimeFields(req, t); !ok {
+		return msg, common.StatusInvalidArgument
+	}
+	start := schedule.ToMinutes(req.StartDay, req.StartHour, req.StartMinute)
+	end := schedule.ToMinutes(req.EndDay, req.EndHour, req.EndMinute)
+
+	b := newBlackout(start, end, strings.TrimSpace(req.Reason))
+	fac.Blackouts = append(fac.Blackouts, b)
+	msg := fmt.Sprintf("Facility %s is %s from %s.", facName, b.label(), b.span())
+	ids := overlappingBookings(fac, start, end)
+	if len(ids) > 0 {
+		log.Printf("Blackout for '%s' overlaps bookings %v", facName, ids)
+		msg += fmt.Sprintf(" Warning: it overlaps bookings %s, which were kept.", strings.Join(ids, ", "))
+	}
+	s.notifySubscribers(req.Namespace, facName, EventFacilityClosed, "", msg, affectedDays(b.asBooking()))
+	log.Printf("AddBlackout successful: %s", msg)
+	return msg, 0
+}
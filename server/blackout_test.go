@@ -0,0 +1,166 @@
+// server/blackout_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// adminSender registers the admin account and returns a function sending
+// requests in the admin's session.
+func adminSender(t *testing.T, srv *ServerState) func(common.RequestMessage) common.ReplyMessage {
+	t.Helper()
+	if err := srv.registerAdmin("admin", "key"); err != nil {
+		t.Fatalf("registerAdmin: %v", err)
+	}
+	p := newFakePeer("admin")
+	token := login(t, srv, p, 1000, "admin", "key")
+	return func(req common.RequestMessage) common.ReplyMessage {
+		req.SessionToken = token
+		return send(t, srv, p, req)
+	}
+}
+
+// windowReq is a request of op on facility from one "Sat 08:00" to another.
+func windowReq(t *testing.T, op uint8, id uint64, facility, from, to string) common.RequestMessage {
+	t.Helper()
+	start, err := parseWeekTime(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := parseWeekTime(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := common.RequestMessage{OpCode: op, RequestID: id, FacilityName: facility}
+	req.StartDay, req.StartHour, req.StartMinute = schedule.FromMinutes(start)
+	req.EndDay, req.EndHour, req.EndMinute = schedule.FromMinutes(end)
+	return req
+}
+
+// TestBookAroundBlackout books into, around and across RoomA's Saturday
+// morning cleaning.
+func TestBookAroundBlackout(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"Sat 09:00", "Sat 10:00", false},
+		{"Sat 08:00", "Sat 12:00", false},
+		{"Sat 07:00", "Sat 08:30", false},
+		{"Sat 11:59", "Sat 13:00", false},
+		{"Fri 20:00", "Sun 01:00", false},
+		{"Sat 07:00", "Sat 08:00", true},
+		{"Sat 12:00", "Sat 13:00", true},
+		{"Fri 20:00", "Sat 08:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"-"+tt.to, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			if err := srv.applyBlackouts([]BlackoutConfig{{Facility: "RoomA", Start: "Sat 08:00", End: "Sat 12:00", Reason: "cleaning"}}); err != nil {
+				t.Fatalf("applyBlackouts: %v", err)
+			}
+			rep := send(t, srv, newFakePeer("client"), windowReq(t, common.OpBookFacility, 1, "RoomA", tt.from, tt.to))
+			if ok := rep.Status == common.StatusOK; ok != tt.ok {
+				t.Fatalf("status %d: %s", rep.Status, rep.Data)
+			}
+			if !tt.ok && !strings.Contains(rep.Data, "CLOSED (cleaning) from Sat 08:00 to Sat 12:00") {
+				t.Errorf("refusal does not name the blackout: %s", rep.Data)
+			}
+		})
+	}
+}
+
+func TestBlackoutInQuery(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	if err := srv.applyBlackouts([]BlackoutConfig{{Facility: "RoomA", Start: "Sat 08:00", End: "Sat 12:00"}}); err != nil {
+		t.Fatalf("applyBlackouts: %v", err)
+	}
+	rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1,
+		FacilityName: "RoomA", DaysList: []uint8{5}})
+	for _, want := range []string{"CLOSED (maintenance)", "Available timings: 00:00-08:00, 12:00-24:00"} {
+		if !strings.Contains(rep.Data, want) {
+			t.Errorf("query lacks %q:\n%s", want, rep.Data)
+		}
+	}
+}
+
+func TestApplyBlackoutsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  BlackoutConfig
+		want string
+	}{
+		{"unknown facility", BlackoutConfig{Facility: "Gym", Start: "Sat 08:00", End: "Sat 12:00"}, "unknown facility"},
+		{"bad start", BlackoutConfig{Facility: "RoomA", Start: "Sat", End: "Sat 12:00"}, "start"},
+		{"bad end", BlackoutConfig{Facility: "RoomA", Start: "Sat 08:00", End: "Sat 25:00"}, "end"},
+		{"backwards", BlackoutConfig{Facility: "RoomA", Start: "Sat 12:00", End: "Sat 08:00"}, "not after start"},
+		{"over a booking", BlackoutConfig{Facility: "RoomA", Start: "Mon 08:00", End: "Mon 12:00"}, "BKG-10000"},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, SemanticsAtMostOnce)
+		if err := srv.applyBlackouts([]BlackoutConfig{tt.cfg}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestAddBlackoutOverBooking: the admin may close a facility over a
+// booking, which is kept, named in the reply and announced to subscribers.
+func TestAddBlackoutOverBooking(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+
+	req := windowReq(t, common.OpAddBlackout, 2, "RoomA", "Mon 08:00", "Mon 12:00")
+	req.Reason = "holiday"
+	if rep := send(t, srv, newFakePeer("client"), req); rep.Status == common.StatusOK {
+		t.Fatalf("blackout without an admin session: %s", rep.Data)
+	}
+	req.RequestID = 3
+	rep := admin(req)
+	if rep.Status != common.StatusOK {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	if !strings.Contains(rep.Data, "CLOSED (holiday) from Mon 08:00 to Mon 12:00") ||
+		!strings.Contains(rep.Data, "Warning: it overlaps bookings BKG-10000, which were kept.") {
+		t.Errorf("reply %q does not warn about BKG-10000", rep.Data)
+	}
+	bookingInterval(t, srv, "BKG-10000")
+	if got := events(t, watcher); len(got) != 1 || got[0] != common.EventClosed {
+		t.Errorf("subscriber got events %v, want one closed", got)
+	}
+	// A blackout clear of bookings comes without a warning
+	if rep := admin(windowReq(t, common.OpAddBlackout, 4, "RoomA", "Sun 00:00", "Sun 24:00")); rep.Status != common.StatusOK || strings.Contains(rep.Data, "Warning") {
+		t.Errorf("reply %q", rep.Data)
+	}
+	if rep := send(t, srv, newFakePeer("client"), windowReq(t, common.OpBookFacility, 5, "RoomA", "Mon 11:00", "Mon 11:30")); rep.Status == common.StatusOK {
+		t.Errorf("booked into the new blackout: %s", rep.Data)
+	}
+}
+
+// TestBlackoutConfigFile reads blackouts the way the server loads them.
+func TestBlackoutConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	config := `{"blackouts": [{"facility": "Lab1", "start": "Sun 00:00", "end": "Sun 24:00", "reason": "holiday"}]}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	if err := srv.applyBlackouts(cfg.Blackouts); err != nil {
+		t.Fatalf("applyBlackouts: %v", err)
+	}
+	if rep := send(t, srv, newFakePeer("client"), windowReq(t, common.OpBookFacility, 1, "Lab1", "Sun 23:00", "Sun 24:00")); rep.Status == common.StatusOK {
+		t.Errorf("booked on the closed Sunday: %s", rep.Data)
+	}
+}
@@ -0,0 +1,214 @@
+// server/callbacks.go
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// defaultCallbackBuffer is the default for -callbackBuffer.
+const defaultCallbackBuffer = 16
+
+// defaultMaxMonitorPeriod is the default for -maxMonitorPeriod.
+const defaultMaxMonitorPeriod = time.Hour
+
+// eventBits maps webhook event types to the Event* bits callbacks carry.
+var eventBits = map[string]uint8{
+	EventBookingCreated:   common.EventCreated,
+	EventBookingChanged:   common.EventChanged,
+	EventBookingCanceled:  common.EventCanceled,
+	EventParticipantAdded: common.EventParticipant,
+	EventScheduleReset:    common.EventReset,
+	EventFacilityClosed:   common.EventClosed,
+	EventBookingsCleared:  common.EventCanceled,
+	EventFacilityRenamed:  common.EventRenamed,
+	EventBookingApproved:  common.EventChanged,
+	EventBookingRejected:  common.EventCanceled,
+	EventBookingExpired:   common.EventCanceled,
+}
+
+// nextCallback numbers a callback for one subscription and keeps it in the
+// subscription's buffer. event is its Event* bit; avail, if set, is the
+// refreshed availability of the affected days. The caller holds monitorLock.
+func (s *ServerState) nextCallback(sub *MonitorRegistration, event uint8, data, avail string) common.ReplyMessage {
+	sub.Seq++
+	cb := common.ReplyMessage{
+		RequestID: 0, // no direct request ID for callback
+		OpCode:    common.OpCallback,
+		Status:    common.StatusOK,
+		Data:      data,
+	}
+	cb.Extensions.PutUint64(common.ExtCallbackSeq, sub.Seq)
+	cb.Extensions.PutString(common.ExtCallbackFacility, sub.FacilityName)
+	if event != 0 {
+		cb.Extensions.Put(common.ExtCallbackEvent, []byte{event})
+	}
+	if avail != "" {
+		cb.Extensions.PutString(common.ExtCallbackAvail, avail)
+	}
+	if s.callbackBuffer > 0 {
+		sub.Recent = append(sub.Recent, cb)
+		if len(sub.Recent) > s.callbackBuffer {
+			sub.Recent = sub.Recent[len(sub.Recent)-s.callbackBuffer:]
+		}
+	}
+	return cb
+}
+
+// deliver sends an encoded callback to the subscriber and counts sends
+// that fail. A UDP send only fails locally, so a lost callback still counts
+// as delivered.
+func (m *MonitorRegistration) deliver(raw []byte) bool {
+	if err := m.ClientAddr.Send(raw); err != nil {
+		m.Failures++
+		log.Printf("Callback to %s for facility '%s' failed: %v", m.ClientAddr, m.FacilityName, err)
+		return false
+	}
+	return true
+}
+
+// sendCallback delivers a numbered callback to a subscriber. With
+// -dupCallbackRate it sometimes sends it a second time, so clients can be
+// tested against duplicates.
+func (s *ServerState) sendCallback(sub *MonitorRegistration, raw []byte) bool {
+	if !sub.deliver(raw) {
+		return false
+	}
+	if s.dupCallbackRate > 0 && rand.Float64() < s.dupCallbackRate {
+		log.Printf("Injecting duplicate callback to %s for facility '%s' (seq %d)", sub.ClientAddr, sub.FacilityName, sub.Seq)
+		sub.deliver(raw)
+	}
+	return true
+}
+
+// handleResendCallbacks replays the buffered callbacks after req.SinceSeq
+// for the caller's subscription to a facility. If the buffer no longer
+// reaches back that far, whatever is left is still sent, but the reply is an
+// error so the client knows to re-query the facility.
+func (s *ServerState) handleResendCallbacks(clientAddr Peer, req common.RequestMessage, t *opTiming) (string, int32) {
+	log.Printf("Handling ResendCallbacks for facility '%s' since %d from %s", req.FacilityName, req.SinceSeq, clientAddr)
+	if clientAddr == nil {
+		return "No client address to resend to", -1
+	}
+
+	t.lock(&s.monitorLock)
+	defer s.monitorLock.Unlock()
+
+	// A client has at most one subscription per facility
+	var sub *MonitorRegistration
+	for i := range s.monitorSubs {
+		if s.monitorSubs[i].sameSubscriber(req.Namespace, req.FacilityName, clientAddr, req.User) {
+			sub = &s.monitorSubs[i]
+		}
+	}
+	if sub == nil {
+		return fmt.Sprintf("No active subscription to %s", req.FacilityName), -1
+	}
+
+	resent := 0
+	oldest := sub.Seq + 1
+	for _, cb := range sub.Recent {
+		seq, _, _ := common.CallbackSeq(cb)
+		if seq < oldest {
+			oldest = seq
+		}
+		if seq <= req.SinceSeq {
+			continue
+		}
+		if raw, err := s.encodeReply(cb); err == nil && s.sendCallback(sub, raw) {
+			resent++
+		}
+	}
+	if req.SinceSeq+1 < oldest {
+		return fmt.Sprintf("Callbacks %d..%d for %s are no longer buffered; resent %d",
+			req.SinceSeq+1, oldest-1, req.FacilityName, resent), -1
+	}
+	return fmt.Sprintf("Resent %d callbacks for %s", resent, req.FacilityName), 0
+}
+
+// handleRebindMonitor points the subscription holding req.MonitorToken at
+// the sender's current address, after the client's source address changed.
+// A subscription made in a session can only be moved by the same user.
+func (s *ServerState) handleRebindMonitor(clientAddr Peer, req common.RequestMessage, t *opTiming) (string, int32) {
+	log.Printf("Handling RebindMonitor from %s", clientAddr)
+	if clientAddr == nil {
+		return "No client address to rebind to", -1
+	}
+
+	t.lock(&s.monitorLock)
+	defer s.monitorLock.Unlock()
+
+	now := s.now()
+	for i := range s.monitorSubs {
+		sub := &s.monitorSubs[i]
+		if subtle.ConstantTimeCompare([]byte(sub.Token), []byte(req.MonitorToken)) != 1 || !now.Before(sub.ExpiresAt) {
+			continue
+		}
+		if sub.User != "" && sub.User != req.User {
+			log.Printf("Rejecting RebindMonitor for '%s' from %s: registered by user '%s'", sub.FacilityName, clientAddr, sub.User)
+			return "Monitor token belongs to another user", -1
+		}
+		old := sub.ClientAddr.String()
+		sub.ClientAddr = clientAddr
+		ns, facility := sub.Namespace, sub.FacilityName
+		// Drop any other subscription of the new address to the same
+		// facility, as a repeated registration would
+		subs := s.monitorSubs[:0]
+		for j, other := range s.monitorSubs {
+			if j == i || other.Namespace != ns || other.FacilityName != facility || other.ClientAddr.String() != clientAddr.String() {
+				subs = append(subs, other)
+			}
+		}
+		s.monitorSubs = subs
+		log.Printf("Monitor for '%s' moved from %s to %s", facility, old, clientAddr)
+		return fmt.Sprintf("Monitor for %s now sends callbacks to %s.", facility, clientAddr), 0
+	}
+	log.Printf("Rejecting RebindMonitor from %s: unknown or expired token", clientAddr)
+	return "Unknown or expired monitor token; register again", -1
+}
+
+// handleListMonitors lists the subscriptions that have not expired, by
+// facility and subscriber, for OpListMonitors. Facilities outside the
+// default namespace are shown as "namespace/facility".
+func (s *ServerState) handleListMonitors(t *opTiming) string {
+	t.lock(&s.monitorLock)
+	now := s.now()
+	monitors := make([]common.MonitorInfo, 0, len(s.monitorSubs))
+	for _, sub := range s.monitorSubs {
+		if !now.Before(sub.ExpiresAt) {
+			continue
+		}
+		subscriber := sub.ClientAddr.String()
+		if sub.User != "" {
+			subscriber += " (" + sub.User + ")"
+		}
+		facility := sub.FacilityName
+		if sub.Namespace != common.DefaultNamespace {
+			facility = sub.Namespace + "/" + facility
+		}
+		monitors = append(monitors, common.MonitorInfo{
+			Facility:   facility,
+			Subscriber: subscriber,
+			Remaining:  sub.ExpiresAt.Sub(now).Round(time.Second),
+			Days:       sub.Days,
+			Events:     sub.Events,
+			Failures:   sub.Failures,
+		})
+	}
+	s.monitorLock.Unlock()
+
+	sort.Slice(monitors, func(i, j int) bool {
+		if monitors[i].Facility != monitors[j].Facility {
+			return monitors[i].Facility < monitors[j].Facility
+		}
+		return monitors[i].Subscriber < monitors[j].Subscriber
+	})
+	log.Printf("Listing %d active monitor subscriptions", len(monitors))
+	return common.FormatMonitorList(monitors)
+}
@@ -0,0 +1,175 @@
+// server/callbacks_test.go
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// seqs returns the sequence numbers of the callbacks p received.
+func seqs(p *fakePeer) []uint64 {
+	var got []uint64
+	for _, cb := range p.callbacks() {
+		seq, _, _ := common.CallbackSeq(cb)
+		got = append(got, seq)
+	}
+	return got
+}
+
+// watchRoomA registers watcher on RoomA and makes n changes to it.
+func watchRoomA(t *testing.T, srv *ServerState, watcher *fakePeer, n int) {
+	t.Helper()
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	p := newFakePeer("client")
+	for i := 0; i < n; i++ {
+		send(t, srv, p, addParticipant(uint64(10+i), "Ada"))
+	}
+}
+
+func TestCallbackSequence(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	watchRoomA(t, srv, watcher, 3)
+
+	got := seqs(watcher)
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("sequence numbers %v, want 1 2 3", got)
+	}
+	for _, cb := range watcher.callbacks() {
+		if _, facility, ok := common.CallbackSeq(cb); !ok || facility != "RoomA" {
+			t.Errorf("callback facility %q, %v", facility, ok)
+		}
+	}
+}
+
+func TestResendCallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		buffer   int
+		since    uint64
+		want     []uint64
+		wantFail bool // the buffer no longer reaches back to since
+	}{
+		{"after a gap", 16, 1, []uint64{2, 3, 4}, false},
+		{"nothing missed", 16, 4, nil, false},
+		{"buffer too short", 2, 0, []uint64{3, 4}, true},
+		{"no buffer", 0, 1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			srv.callbackBuffer = tt.buffer
+			watcher := newFakePeer("watcher")
+			watchRoomA(t, srv, watcher, 4)
+			before := len(seqs(watcher))
+
+			rep := send(t, srv, watcher, common.RequestMessage{OpCode: common.OpResendCallbacks, RequestID: 2, FacilityName: "RoomA", SinceSeq: tt.since})
+			if failed := rep.Status != common.StatusOK; failed != tt.wantFail {
+				t.Errorf("status %d: %s", rep.Status, rep.Data)
+			}
+			if tt.wantFail && !strings.Contains(rep.Data, "no longer buffered") {
+				t.Errorf("reply %q does not say the callbacks are gone", rep.Data)
+			}
+			got := seqs(watcher)[before:]
+			if len(got) != len(tt.want) {
+				t.Fatalf("resent %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("resent %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestResendWithoutSubscription(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	rep := send(t, srv, newFakePeer("stranger"), common.RequestMessage{OpCode: common.OpResendCallbacks, RequestID: 1, FacilityName: "RoomA"})
+	if rep.Status == common.StatusOK || !strings.Contains(rep.Data, "No active subscription") {
+		t.Errorf("status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestDuplicateCallbacks: with -dupCallbackRate=1 every callback, resent
+// ones included, arrives twice with the same sequence number.
+func TestDuplicateCallbacks(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.dupCallbackRate = 1
+	watcher := newFakePeer("watcher")
+	watchRoomA(t, srv, watcher, 3)
+	want := []uint64{1, 1, 2, 2, 3, 3}
+	if got := seqs(watcher); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sequence numbers %v, want %v", got, want)
+	}
+
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpResendCallbacks, RequestID: 2, FacilityName: "RoomA", SinceSeq: 2})
+	if got := seqs(watcher)[len(want):]; !reflect.DeepEqual(got, []uint64{3, 3}) {
+		t.Errorf("resent %v, want 3 twice", got)
+	}
+}
+
+// TestCallbackAvailability: the availability a callback carries is what a
+// query of the affected days returns right after the change.
+func TestCallbackAvailability(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	client := newFakePeer("client")
+	// A query reply ends with the change sequence number instead of the
+	// blank line
+	queryDays := func(id uint64, days ...uint8) string {
+		data := send(t, srv, client, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: id,
+			FacilityName: "RoomA", DaysList: days}).Data
+		return data[:strings.LastIndex(data, "\nSeq=")]
+	}
+	lastAvail := func() string {
+		cbs := watcher.callbacks()
+		avail, ok := common.CallbackAvailability(cbs[len(cbs)-1])
+		if !ok {
+			t.Fatalf("callback %q carries no availability", cbs[len(cbs)-1].Data)
+		}
+		return strings.TrimRight(avail, "\n")
+	}
+
+	id := confirmationID(t, send(t, srv, client, bookReq(10, "RoomA", 3, 9, 10)))
+	if got, want := lastAvail(), queryDays(11, 3); got != want {
+		t.Errorf("after booking:\n%s\nwant\n%s", got, want)
+	}
+	send(t, srv, client, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 12, ConfirmationID: id, OffsetMinutes: 1440})
+	if got, want := lastAvail(), queryDays(13, 3, 4); got != want {
+		t.Errorf("after moving to the next day:\n%s\nwant both days\n%s", got, want)
+	}
+	send(t, srv, client, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 14, ConfirmationID: id})
+	if got, want := lastAvail(), queryDays(15, 4); got != want {
+		t.Errorf("after cancelling:\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestCallbackAvailabilityTooLarge: a day too busy to fit in one datagram
+// is left out of the callback, which still goes out.
+func TestCallbackAvailabilityTooLarge(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	client := newFakePeer("client")
+	for m := uint8(0); m < 48; m++ {
+		req := bookReq(uint64(10+m), "RoomA", 5, m/2, m/2)
+		req.StartMinute, req.EndMinute = m%2*30, m%2*30+15
+		confirmationID(t, send(t, srv, client, req))
+	}
+	cbs := watcher.callbacks()
+	if len(cbs) != 48 {
+		t.Fatalf("%d callbacks, want 48", len(cbs))
+	}
+	if _, ok := common.CallbackAvailability(cbs[0]); !ok {
+		t.Error("first callback carries no availability")
+	}
+	if avail, ok := common.CallbackAvailability(cbs[47]); ok {
+		t.Errorf("last callback carries %d bytes of availability", len(avail))
+	}
+}
@@ -0,0 +1,136 @@
+// server/capacity.go
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// capacity returns how many bookings may overlap at any minute. Facilities
+// are single rooms, with a capacity of 1, unless the config makes them a
+// pool of identical places.
+func (f *FacilityInfo) capacity() int {
+	if f.ConcurrentCapacity < 1 {
+		return 1
+	}
+	return f.ConcurrentCapacity
+}
+
+// bookingIntervals returns the intervals of the facility's bookings.
+func (f *FacilityInfo) bookingIntervals() []schedule.Interval {
+	ivs := make([]schedule.Interval, 0, len(f.Bookings))
+	for _, bk := range f.Bookings {
+		ivs = append(ivs, bk.interval())
+	}
+	return ivs
+}
+
+// hasRoom reports whether one more booking fits into window: the bookings
+// overlapping it, clipped to it, must leave a place free at every minute.
+// At capacity 1 that means no booking overlaps at all.
+func (f *FacilityInfo) hasRoom(window schedule.Interval) bool {
+	var overlapping []schedule.Interval
+	for _, bk := range f.Bookings {
+		if iv := bk.interval(); iv.Overlaps(window) {
+			overlapping = append(overlapping, iv.Intersect(window))
+		}
+	}
+	return schedule.Peak(overlapping) < f.capacity()
+}
+
+// full returns the stretches in which the bookings take every place.
+func (f *FacilityInfo) full() []schedule.Interval {
+	var full []schedule.Interval
+	for _, l := range schedule.Levels(f.bookingIntervals()) {
+		if l.Count >= f.capacity() {
+			full = append(full, l.Interval)
+		}
+	}
+	return full
+}
+
+// bookingConflict is the reply for a booking window without a free place.
+func (f *FacilityInfo) bookingConflict() string {
+	if f.capacity() == 1 {
+		return "Time conflict with an existing booking."
+	}
+	return fmt.Sprintf("Time conflict: all %d places are booked during part of that window.", f.capacity())
+}
+
+// capacityStretch is part of a day with the places still free in it.
+type capacityStretch struct {
+	schedule.Interval
+	free int
+}
+
+// remainingOnDay returns the stretches of day d in which places are free,
+// sorted, with how many. Blackouts close every place.
+func (f *FacilityInfo) remainingOnDay(d uint8) []capacityStretch {
+	blackouts := make([]schedule.Interval, 0, len(f.Blackouts))
+	for _, b := range f.Blackouts {
+		blackouts = append(blackouts, b.asBooking().interval())
+	}
+	levels := schedule.Levels(f.bookingIntervals())
+	var stretches []capacityStretch
+	add := func(iv schedule.Interval, free int) {
+		if free > 0 && !iv.Empty() {
+			stretches = append(stretches, capacityStretch{iv, free})
+		}
+	}
+	for _, open := range schedule.FreeOnDay(d, blackouts) {
+		current := open.Start
+		for _, l := range levels {
+			part := l.Interval.Intersect(open)
+			if part.Empty() {
+				continue
+			}
+			add(schedule.Interval{Start: current, End: part.Start}, f.capacity())
+			add(part, f.capacity()-l.Count)
+			current = part.End
+		}
+		add(schedule.Interval{Start: current, End: open.End}, f.capacity())
+	}
+	return stretches
+}
+
+// remainingCapacityForDay lists the free places of a pool on day d, as
+// "09:00-10:00 (1 free)".
+func remainingCapacityForDay(f *FacilityInfo, d uint8) string {
+	stretches := f.remainingOnDay(d)
+	if len(stretches) == 0 {
+		return "Fully booked"
+	}
+	dayStart := schedule.Day(d).Start
+	parts := make([]string, len(stretches))
+	for i, st := range stretches {
+		from, to := st.Start-dayStart, st.End-dayStart
+		parts[i] = fmt.Sprintf("%02d:%02d-%02d:%02d (%d free)", from/60, from%60, to/60, to%60, st.free)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// applyCapacities sets the capacities from the config file, for facilities
+// of the default namespace. Lowering a
+// facility below the bookings it already holds at once is refused.
+func (s *ServerState) applyCapacities(capacities map[string]int) error {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	for name, capacity := range capacities {
+		fac, ok := s.facilityData[common.DefaultNamespace][name]
+		if !ok {
+			return fmt.Errorf("capacity: unknown facility %q", name)
+		}
+		if capacity < 1 {
+			return fmt.Errorf("capacity of %s is %d, want at least 1", name, capacity)
+		}
+		if peak := schedule.Peak(fac.bookingIntervals()); peak > capacity {
+			return fmt.Errorf("capacity %d of %s is below the %d bookings it holds at once", capacity, name, peak)
+		}
+		fac.ConcurrentCapacity = capacity
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// server/capacity_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// bookMinutes is a Friday booking of RoomA from..to, as minutes of the day.
+func bookMinutes(id uint64, from, to int) common.RequestMessage {
+	req := bookReq(id, "RoomA", 4, uint8(from/60), uint8(to/60))
+	req.StartMinute, req.EndMinute = uint8(from%60), uint8(to%60)
+	return req
+}
+
+// TestCapacity books overlapping windows into RoomA at different
+// capacities; each step is accepted or refused as the most bookings at
+// any minute allow.
+func TestCapacity(t *testing.T) {
+	type step struct {
+		from, to int // minutes of Friday
+		ok       bool
+	}
+	tests := []struct {
+		name     string
+		capacity int
+		steps    []step
+		conflict string
+	}{
+		{"single room", 1, []step{
+			{9 * 60, 11 * 60, true},
+			{10 * 60, 12 * 60, false},
+			{11 * 60, 12 * 60, true}, // adjoining is not overlapping
+			{8 * 60, 9*60 + 1, false},
+		}, "Time conflict with an existing booking."},
+		{"pool of two", 2, []step{
+			{9 * 60, 11 * 60, true},
+			{10 * 60, 12 * 60, true},
+			{11 * 60, 13 * 60, true},        // 11-12 holds two, not three
+			{10*60 + 30, 11*60 + 30, false}, // 10:30-11 would hold three
+			{12 * 60, 14 * 60, true},        // 12-13 holds two
+			{12*60 + 59, 13 * 60, false},
+		}, "Time conflict: all 2 places are booked during part of that window."},
+		{"stacked to the limit", 3, []step{
+			{9 * 60, 10 * 60, true},
+			{9 * 60, 10 * 60, true},
+			{9 * 60, 10 * 60, true},
+			{9 * 60, 10 * 60, false},
+			{9*60 + 59, 10*60 + 30, false},
+			{10 * 60, 10*60 + 30, true},
+		}, "Time conflict: all 3 places"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			if err := srv.applyCapacities(map[string]int{"RoomA": tt.capacity}); err != nil {
+				t.Fatal(err)
+			}
+			p := newFakePeer("client")
+			for i, st := range tt.steps {
+				rep := send(t, srv, p, bookMinutes(uint64(i+1), st.from, st.to))
+				if ok := rep.Status == common.StatusOK; ok != st.ok {
+					t.Fatalf("step %d (%d-%d): status %d: %s", i+1, st.from, st.to, rep.Status, rep.Data)
+				}
+				if !st.ok && !strings.Contains(rep.Data, tt.conflict) {
+					t.Errorf("step %d: refusal %q, want %q", i+1, rep.Data, tt.conflict)
+				}
+			}
+		})
+	}
+}
+
+// TestCapacityFreedByCancel: cancelling one of the stacked bookings makes
+// room for another.
+func TestCapacityFreedByCancel(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.applyCapacities(map[string]int{"RoomA": 2})
+	p := newFakePeer("client")
+	first := confirmationID(t, send(t, srv, p, bookMinutes(1, 9*60, 10*60)))
+	confirmationID(t, send(t, srv, p, bookMinutes(2, 9*60, 10*60)))
+	if rep := send(t, srv, p, bookMinutes(3, 9*60, 10*60)); rep.Status == common.StatusOK {
+		t.Fatal("third booking accepted at capacity 2")
+	}
+	send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 4, ConfirmationID: first})
+	confirmationID(t, send(t, srv, p, bookMinutes(5, 9*60, 10*60)))
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.applyCapacities(map[string]int{"RoomA": 2})
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, bookMinutes(1, 9*60, 11*60)))
+	confirmationID(t, send(t, srv, p, bookMinutes(2, 10*60, 12*60)))
+
+	srv.dataLock.RLock()
+	got := remainingCapacityForDay(srv.facilityData[common.DefaultNamespace]["RoomA"], 4)
+	srv.dataLock.RUnlock()
+	want := "00:00-09:00 (2 free), 09:00-10:00 (1 free), 11:00-12:00 (1 free), 12:00-24:00 (2 free)"
+	if got != want {
+		t.Errorf("remaining capacity %q, want %q", got, want)
+	}
+	if out := queryData(t, srv, 3, []uint8{4}, "RoomA"); !strings.Contains(out, want) || !strings.Contains(out, "Capacity: 2 concurrent bookings") {
+		t.Errorf("query output:\n%s", out)
+	}
+
+	// Two whole-day bookings fill Saturday
+	for id := uint64(4); id <= 5; id++ {
+		req := bookReq(id, "RoomA", 5, 0, 0)
+		req.EndDay = 6
+		confirmationID(t, send(t, srv, p, req))
+	}
+	srv.dataLock.RLock()
+	got = remainingCapacityForDay(srv.facilityData[common.DefaultNamespace]["RoomA"], 5)
+	srv.dataLock.RUnlock()
+	if got != "Fully booked" {
+		t.Errorf("full day: %q, want Fully booked", got)
+	}
+}
+
+func TestApplyCapacities(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.applyCapacities(map[string]int{"RoomA": 2})
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, bookMinutes(1, 9*60, 10*60)))
+	confirmationID(t, send(t, srv, p, bookMinutes(2, 9*60, 10*60)))
+
+	for caps, want := range map[string]map[string]int{
+		`unknown facility "Gym"`:        {"Gym": 2},
+		"want at least 1":               {"Lab1": 0},
+		"below the 2 bookings it holds": {"RoomA": 1},
+	} {
+		if err := srv.applyCapacities(want); err == nil || !strings.Contains(err.Error(), caps) {
+			t.Errorf("applyCapacities(%v): %v, want %q", want, err, caps)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// server/change_test.go
+package main
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/client/utils"
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// bookingInterval returns where booking id lies now.
+func bookingInterval(t *testing.T, srv *ServerState, id string) (start, end int32) {
+	t.Helper()
+	srv.dataLock.RLock()
+	defer srv.dataLock.RUnlock()
+	_, fac, i, ok := srv.findBooking(common.DefaultNamespace, id)
+	if !ok {
+		t.Fatalf("booking %s not found", id)
+	}
+	iv := fac.Bookings[i].interval()
+	return iv.Start, iv.End
+}
+
+// TestChangeBookingShift sends shifts written the way a user types them
+// over UDP and checks where the booking ends up.
+func TestChangeBookingShift(t *testing.T) {
+	tests := []struct {
+		offset string
+		moved  int32 // minutes, 0 when refused
+	}{
+		{"+1d", 1440},
+		{"-1d", -1440},
+		{"+2d", 2 * 1440},
+		{"+2h", 120},
+		{"1d-2h+30m", 1440 - 90},
+		{"+4d", 0}, // past Sunday
+	}
+	for _, tt := range tests {
+		t.Run(tt.offset, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			c := dialUDP(t, startUDPServer(t, srv, "127.0.0.1", 1))
+			id := confirmationID(t, c.do(bookReq(1, "Lab1", 3, 9, 10)))
+			start, end := bookingInterval(t, srv, id)
+
+			minutes, wholeDays, err := utils.ParseOffset(tt.offset)
+			if err != nil {
+				t.Fatalf("ParseOffset: %v", err)
+			}
+			rep := c.do(common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 2, ConfirmationID: id,
+				OffsetMinutes: minutes, WholeDays: wholeDays})
+			if ok := rep.Status == common.StatusOK; ok != (tt.moved != 0) {
+				t.Fatalf("status %d: %s", rep.Status, rep.Data)
+			}
+			newStart, newEnd := bookingInterval(t, srv, id)
+			if newStart-start != tt.moved || newEnd-end != tt.moved {
+				t.Errorf("booking moved by %d..%d minutes, want %d", newStart-start, newEnd-end, tt.moved)
+			}
+		})
+	}
+}
+
+// TestChangeBookingWholeDays: a shift flagged as whole days must be one.
+func TestChangeBookingWholeDays(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	id := confirmationID(t, send(t, srv, p, bookReq(1, "Lab1", 2, 9, 10)))
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 2, ConfirmationID: id,
+		OffsetMinutes: 1500, WholeDays: true})
+	if rep.Status != common.StatusInvalidArgument {
+		t.Errorf("status %d: %s", rep.Status, rep.Data)
+	}
+	if start, _ := bookingInterval(t, srv, id); start != schedule.ToMinutes(2, 9, 0) {
+		t.Errorf("refused change moved the booking to minute %d", start)
+	}
+}
@@ -0,0 +1,137 @@
+// server/changes.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// defaultChangeJournal is how many mutations are kept for delta queries.
+const defaultChangeJournal = 1024
+
+// changeEntry is one mutation in the change journal.
+type changeEntry struct {
+	Seq            uint64
+	Facility       string
+	Event          string
+	ConfirmationID string
+	Message        string
+}
+
+// changeJournal numbers every successful mutation and keeps the most recent
+// ones, so polling clients can ask what changed since the number they last
+// saw instead of downloading the whole schedule again.
+//
+// The counter starts at the server's start time in microseconds rather than
+// at zero, so numbers keep increasing across restarts and a number from a
+// previous run is always older than base, which makes it fall back to a
+// full query instead of matching unrelated entries.
+type changeJournal struct {
+	mu      sync.Mutex
+	base    uint64 // counter value at startup; nothing before it is known
+	seq     uint64 // number of the latest mutation
+	entries []changeEntry
+	max     int
+}
+
+func newChangeJournal(max int) *changeJournal {
+	start := uint64(time.Now().UnixMicro())
+	return &changeJournal{base: start, seq: start, max: max}
+}
+
+// record bumps the counter for a mutation of facility, a qualified name,
+// and appends it to the journal, dropping the oldest entry when the journal
+// is full.
+func (j *changeJournal) record(facility, event, confID, msg string) uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.seq++
+	if j.max <= 0 {
+		return j.seq
+	}
+	if len(j.entries) == j.max {
+		copy(j.entries, j.entries[1:])
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	j.entries = append(j.entries, changeEntry{Seq: j.seq, Facility: facility, Event: event, ConfirmationID: confID, Message: msg})
+	return j.seq
+}
+
+// renameFacility files the kept mutations of a facility under its new
+// name, so a delta query with the new name still sees them.
+func (j *changeJournal) renameFacility(oldName, newName string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.entries {
+		if j.entries[i].Facility == oldName {
+			j.entries[i].Facility = newName
+		}
+	}
+}
+
+// current returns the number of the latest mutation.
+func (j *changeJournal) current() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// since returns the mutations of facility (a qualified name) after number n, and the current
+// number. complete is false when some mutations after n are no longer in the
+// journal, or n does not come from this run of the server.
+func (j *changeJournal) since(n uint64, facility string) (changes []changeEntry, seq uint64, complete bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if n < j.base || n > j.seq {
+		return nil, j.seq, false
+	}
+	if n < j.seq && (len(j.entries) == 0 || j.entries[0].Seq > n+1) {
+		return nil, j.seq, false
+	}
+	for _, e := range j.entries {
+		if e.Seq > n && e.Facility == facility {
+			changes = append(changes, e)
+		}
+	}
+	return changes, j.seq, true
+}
+
+// handleQueryChanges answers a delta query: "Unchanged" when the facility
+// has not changed since req.SinceSeq, otherwise one line per mutation.
+// Either way the reply ends with "Seq=<number>" to send next time. When the
+// journal no longer covers SinceSeq the reply is StatusChangesExpired and
+// the client should query the full schedule.
+func (s *ServerState) handleQueryChanges(req common.RequestMessage, t *opTiming) (string, int32) {
+	facName := req.FacilityName
+	log.Printf("Handling QueryChanges for facility '%s' since %d", facName, req.SinceSeq)
+
+	t.rlock(&s.dataLock)
+	_, ok := s.facilityData[req.Namespace][facName]
+	s.dataLock.RUnlock()
+	if !ok {
+		t.reject("FacilityName", facName)
+		return "Error: " + s.facilityNotFound(req.Namespace, facName), -1
+	}
+
+	changes, seq, complete := s.changes.since(req.SinceSeq, qualify(req.Namespace, facName))
+	if !complete {
+		t.reject("SinceSeq", req.SinceSeq)
+		return fmt.Sprintf("Changes since %d are no longer kept; query the full schedule.\nSeq=%d", req.SinceSeq, seq),
+			common.StatusChangesExpired
+	}
+	if len(changes) == 0 {
+		return fmt.Sprintf("Unchanged.\nSeq=%d", seq), 0
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Facility=%s, %d changes since %d:\n", facName, len(changes), req.SinceSeq)
+	for _, e := range changes {
+		fmt.Fprintf(&b, "  #%d %s: %s\n", e.Seq, e.Event, e.Message)
+	}
+	fmt.Fprintf(&b, "Seq=%d", seq)
+	return b.String(), 0
+}
@@ -0,0 +1,104 @@
+// server/changes_test.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// querySeq queries facility in full and returns the Seq= its reply ends with.
+func querySeq(t *testing.T, srv *ServerState, p *fakePeer, id uint64, facility string) uint64 {
+	t.Helper()
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: id, FacilityName: facility})
+	i := strings.LastIndex(rep.Data, "\nSeq=")
+	if rep.Status != common.StatusOK || i < 0 {
+		t.Fatalf("query %s: status %d: %s", facility, rep.Status, rep.Data)
+	}
+	var seq uint64
+	if _, err := fmt.Sscanf(rep.Data[i+1:], "Seq=%d", &seq); err != nil {
+		t.Fatalf("query %s: %v in %q", facility, err, rep.Data[i+1:])
+	}
+	return seq
+}
+
+func changesReq(id uint64, facility string, since uint64) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpQueryChanges, RequestID: id, FacilityName: facility, SinceSeq: since}
+}
+
+func TestQueryChangesUnchanged(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	seq := querySeq(t, srv, p, 1, "RoomA")
+
+	// A mutation elsewhere does not count as a change of RoomA
+	confirmationID(t, send(t, srv, p, bookReq(2, "Lab1", 4, 9, 10)))
+	rep := send(t, srv, p, changesReq(3, "RoomA", seq))
+	if want := fmt.Sprintf("Unchanged.\nSeq=%d", seq+1); rep.Status != common.StatusOK || rep.Data != want {
+		t.Errorf("status %d: %q, want %q", rep.Status, rep.Data, want)
+	}
+}
+
+func TestQueryChangesDelta(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	seq := querySeq(t, srv, p, 1, "RoomA")
+
+	id := confirmationID(t, send(t, srv, p, bookReq(2, "RoomA", 3, 9, 10)))
+	confirmationID(t, send(t, srv, p, bookReq(3, "Lab1", 4, 9, 10)))
+	send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 4, ConfirmationID: id})
+
+	rep := send(t, srv, p, changesReq(5, "RoomA", seq))
+	if rep.Status != common.StatusOK {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	lines := strings.Split(rep.Data, "\n")
+	if want := fmt.Sprintf("Facility=RoomA, 2 changes since %d:", seq); lines[0] != want {
+		t.Errorf("header %q, want %q", lines[0], want)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("reply %q, want a header, two changes and Seq=", rep.Data)
+	}
+	for i, n := range []uint64{seq + 1, seq + 3} {
+		if prefix := fmt.Sprintf("  #%d ", n); !strings.HasPrefix(lines[i+1], prefix) || !strings.Contains(lines[i+1], id) {
+			t.Errorf("change %d is %q, want #%d on %s", i+1, lines[i+1], n, id)
+		}
+	}
+	if want := fmt.Sprintf("Seq=%d", seq+3); lines[3] != want {
+		t.Errorf("last line %q, want %q", lines[3], want)
+	}
+
+	// The number returned is where the next delta query starts
+	rep = send(t, srv, p, changesReq(6, "RoomA", seq+3))
+	if !strings.HasPrefix(rep.Data, "Unchanged.") {
+		t.Errorf("query from the returned Seq: %q", rep.Data)
+	}
+}
+
+// TestQueryChangesOverflow: once the journal has dropped mutations after a
+// number, and for numbers this run never handed out, the client is told to
+// query in full.
+func TestQueryChangesOverflow(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.changes = newChangeJournal(2)
+	p := newFakePeer("client")
+	seq := querySeq(t, srv, p, 1, "RoomA")
+	for i := 0; i < 3; i++ {
+		confirmationID(t, send(t, srv, p, bookReq(uint64(2+i), "RoomA", 3, uint8(9+i), uint8(10+i))))
+	}
+
+	for i, since := range []uint64{seq, seq - 1, seq + 4} {
+		rep := send(t, srv, p, changesReq(uint64(10+i), "RoomA", since))
+		if want := fmt.Sprintf("Seq=%d", seq+3); rep.Status != common.StatusChangesExpired || !strings.HasSuffix(rep.Data, want) {
+			t.Errorf("since %d: status %d: %q, want ChangesExpired ending %s", since, rep.Status, rep.Data, want)
+		}
+	}
+
+	// The two kept mutations are still served
+	rep := send(t, srv, p, changesReq(20, "RoomA", seq+1))
+	if rep.Status != common.StatusOK || !strings.HasPrefix(rep.Data, "Facility=RoomA, 2 changes") {
+		t.Errorf("since %d: status %d: %q", seq+1, rep.Status, rep.Data)
+	}
+}
@@ -0,0 +1,77 @@
+// server/clear.go
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// EventBookingsCleared is reported to webhooks and subscribers when the
+// admin clears a facility.
+const EventBookingsCleared = "bookings_cleared"
+
+// deleteBookings removes the facility's bookings that match from memory and
+// the store and returns them. A booking the store fails to delete is kept.
+// The caller holds dataLock.
+func (s *ServerState) deleteBookings(fac *FacilityInfo, match func(Booking) bool) []Booking {
+	var removed []Booking
+	kept := fac.Bookings[:0]
+	for _, bk := range fac.Bookings {
+		if !match(bk) {
+			kept = append(kept, bk)
+			continue
+		}
+		if err := s.store.DeleteBooking(bk.ConfirmationID); err != nil {
+			log.Printf("Keeping booking '%s': %v", bk.ConfirmationID, err)
+			kept = append(kept, bk)
+			continue
+		}
+		removed = append(removed, bk)
+	}
+	fac.Bookings = kept
+	return removed
+}
+
+// handleClearBookings removes every booking of a facility, or only those on
+// the requested days, in one pass. Subscribers get a single summary
+// callback rather than one per booking.
+func (s *ServerState) handleClearBookings(req common.RequestMessage, t *opTiming) (string, int32) {
+	facName := req.FacilityName
+	log.Printf("Handling ClearBookings for facility '%s' (days %v)", facName, req.DaysList)
+	if !req.Confirm {
+		t.reject("Confirm", req.Confirm)
+		return "Refusing to clear bookings without confirmation.", common.StatusInvalidArgument
+	}
+	days, err := validate.NormalizeDaysList(req.DaysList)
+	if err != nil {
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v", err), common.StatusInvalidArgument
+	}
+	req.DaysList = days
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	fac, ok := s.facilityData[req.Namespace][facName]
+	if !ok {
+		t.reject("FacilityName", facName)
+		return s.facilityNotFound(req.Namespace, facName), -1
+	}
+	removed := s.deleteBookings(fac, func(bk Booking) bool {
+		return len(req.DaysList) == 0 || bk.interval().IntersectsDays(req.DaysList)
+	})
+
+	scope := "all days"
+	if len(req.DaysList) > 0 {
+		scope = fmt.Sprintf("days %v", req.DaysList)
+	}
+	msg := fmt.Sprintf("Cleared the bookings of %s on %s. Removed=%d", facName, scope, len(removed))
+	log.Printf("AUDIT admin '%s' cleared %d bookings of '%s' on %s", req.User, len(removed), facName, scope)
+	if len(removed) > 0 {
+		s.notifySubscribers(req.Namespace, facName, EventBookingsCleared, "", msg, affectedDays(removed...))
+	}
+	return msg, 0
+}
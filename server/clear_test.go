@@ -0,0 +1,123 @@
+// server/clear_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// clearReq is a confirmed ClearBookings of facility on days.
+func clearReq(id uint64, facility string, days ...uint8) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpClearBookings, RequestID: id, FacilityName: facility, DaysList: days, Confirm: true}
+}
+
+// facilityBookings returns the IDs of a facility's bookings.
+func facilityBookings(srv *ServerState, facility string) []string {
+	srv.dataLock.RLock()
+	defer srv.dataLock.RUnlock()
+	var ids []string
+	for _, bk := range srv.facilityData[common.DefaultNamespace][facility].Bookings {
+		ids = append(ids, bk.ConfirmationID)
+	}
+	return ids
+}
+
+func TestClearBookings(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    []uint8
+		removed string
+		kept    []string
+	}{
+		{"all days", nil, "Removed=3", nil},
+		{"Monday", []uint8{0}, "Removed=2", []string{"BKG-10001"}},
+		{"Tuesday", []uint8{1}, "Removed=2", []string{"BKG-10000"}},
+		{"Sunday", []uint8{6}, "Removed=0", []string{"BKG-10000", "BKG-10001", "overnight"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			admin := adminSender(t, srv)
+			watcher := newFakePeer("watcher")
+			send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+			// Runs from Monday night into Tuesday
+			overnight := confirmationID(t, send(t, srv, newFakePeer("client"), spanReq(2, 0, 22, 1, 2)))
+			lab := facilityBookings(srv, "Lab1")
+
+			rep := admin(clearReq(3, "RoomA", tt.days...))
+			if rep.Status != common.StatusOK || !strings.HasSuffix(rep.Data, tt.removed) {
+				t.Fatalf("status %d: %s, want %s", rep.Status, rep.Data, tt.removed)
+			}
+			got := strings.ReplaceAll(strings.Join(facilityBookings(srv, "RoomA"), ","), overnight, "overnight")
+			if got != strings.Join(tt.kept, ",") {
+				t.Errorf("kept %s, want %v", got, tt.kept)
+			}
+			if got := facilityBookings(srv, "Lab1"); len(got) != len(lab) {
+				t.Errorf("Lab1 lost bookings: %v", got)
+			}
+			want := 1
+			if tt.removed == "Removed=0" {
+				want = 0
+			}
+			if n := len(watcher.callbacks()) - 1; n != want { // the first announces the overnight booking
+				t.Errorf("%d summary callbacks, want %d", n, want)
+			}
+		})
+	}
+}
+
+// TestClearEmptyFacility: clearing again finds nothing and tells no one.
+func TestClearEmptyFacility(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	admin(clearReq(1, "Lab1"))
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 2, FacilityName: "Lab1", MonitorPeriod: 60})
+
+	if rep := admin(clearReq(3, "Lab1")); rep.Status != common.StatusOK || !strings.HasSuffix(rep.Data, "Removed=0") {
+		t.Errorf("status %d: %s", rep.Status, rep.Data)
+	}
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Errorf("%d callbacks for clearing nothing", n)
+	}
+}
+
+func TestClearBookingsRefused(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	unconfirmed := clearReq(1, "RoomA")
+	unconfirmed.Confirm = false
+	tests := []struct {
+		name   string
+		rep    common.ReplyMessage
+		status int32
+	}{
+		{"not the admin", send(t, srv, newFakePeer("client"), clearReq(2, "RoomA")), common.StatusPermissionDenied},
+		{"unconfirmed", admin(unconfirmed), common.StatusInvalidArgument},
+		{"bad day", admin(clearReq(3, "RoomA", 7)), common.StatusInvalidArgument},
+		{"unknown facility", admin(clearReq(4, "Gym")), -1},
+	}
+	for _, tt := range tests {
+		if tt.rep.Status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, tt.rep.Status, tt.status, tt.rep.Data)
+		}
+	}
+	if got := facilityBookings(srv, "RoomA"); len(got) != 2 {
+		t.Errorf("refused clears left %v", got)
+	}
+}
+
+// TestClearBookingsAudit: one audit line per clear, naming the admin.
+func TestClearBookingsAudit(t *testing.T) {
+	logs := captureLogs(t, LogFormatText)
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	adminSender(t, srv)(clearReq(1, "RoomA"))
+	if n := strings.Count(logs.String(), "AUDIT"); n != 1 {
+		t.Errorf("%d audit lines, want 1:\n%s", n, logs.String())
+	}
+	if !strings.Contains(logs.String(), "AUDIT admin 'admin' cleared 2 bookings of 'RoomA' on all days") {
+		t.Errorf("audit line:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,130 @@
+// server/clock.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// Values of -currentTime besides a fixed "<day> HH:MM".
+const (
+	CurrentTimeOff  = ""     // no notion of now: bookings are never in progress
+	CurrentTimeReal = "real" // the wall clock mapped onto the booking week
+)
+
+// WeekClock returns the current time as minutes since Monday 00:00.
+type WeekClock func() int32
+
+// realWeekClock maps the local wall clock, shifted by offset, onto the
+// booking week.
+func realWeekClock(offset time.Duration) WeekClock {
+	return func() int32 {
+		now := time.Now().Add(offset)
+		day := (int(now.Weekday()) + 6) % 7 // time.Weekday starts on Sunday
+		return schedule.ToMinutes(uint8(day), uint8(now.Hour()), uint8(now.Minute()))
+	}
+}
+
+// now is the server's wall clock: the local time shifted by -clockOffset.
+// Everything a client can compare with its own clock reads it, that is
+// request timestamps, monitor expiries and the time in Ping and Hello
+// replies.
+func (s *ServerState) now() time.Time {
+	return time.Now().Add(s.clockOffset)
+}
+
+// fixedWeekClock always reports the same moment, for demos and tests.
+func fixedWeekClock(minutes int32) WeekClock {
+	return func() int32 { return minutes }
+}
+
+// parseCurrentTime turns a -currentTime value into a clock: nil when off,
+// the wall clock shifted by offset for "real", otherwise a fixed time such
+// as "Wed 10:30" or "2 10:30".
+func parseCurrentTime(v string, offset time.Duration) (WeekClock, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case CurrentTimeOff:
+		return nil, nil
+	case CurrentTimeReal:
+		return realWeekClock(offset), nil
+	}
+	if !strings.Contains(v, " ") {
+		return nil, fmt.Errorf("%q is not %q or a time like \"Wed 10:30\"", v, CurrentTimeReal)
+	}
+	minutes, err := parseWeekTime(v)
+	if err != nil {
+		return nil, err
+	}
+	if minutes >= schedule.WeekMinutes {
+		return nil, fmt.Errorf("%q is the end of the week, not a time in it", v)
+	}
+	return fixedWeekClock(minutes), nil
+}
+
+// parseWeekTime reads a day and time such as "Wed 10:30" or "2 10:30" as
+// minutes since Monday 00:00. "24:00" is the end of the day, the same as
+// 00:00 of the next, so "Sun 24:00" is the end of the week.
+func parseWeekTime(v string) (int32, error) {
+	dayStr, timeStr, ok := strings.Cut(strings.ToLower(strings.TrimSpace(v)), " ")
+	if !ok {
+		return 0, fmt.Errorf("%q is not a day and time like \"Wed 10:30\"", v)
+	}
+	day, err := common.ParseDay(dayStr)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(timeStr) == "24:00" {
+		return schedule.Day(day).End, nil
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(timeStr))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 10:30", timeStr)
+	}
+	return schedule.ToMinutes(day, uint8(t.Hour()), uint8(t.Minute())), nil
+}
+
+// bookingStarted reports whether the booking's start has passed and, if
+// so, the status that refuses touching it: StatusInProgress while it runs,
+// StatusBookingOver once it has ended. Without a clock nothing has started.
+func (s *ServerState) bookingStarted(bk Booking) (int32, bool) {
+	if s.clock == nil {
+		return 0, false
+	}
+	now := s.clock()
+	if now < schedule.ToMinutes(bk.StartDay, bk.StartHour, bk.StartMinute) {
+		return 0, false
+	}
+	if now < schedule.ToMinutes(bk.EndDay, bk.EndHour, bk.EndMinute) {
+		return common.StatusInProgress, true
+	}
+	return common.StatusBookingOver, true
+}
+
+// defaultPastGrace is how far in the past a booking may end by default.
+const defaultPastGrace = 5 * time.Minute
+
+// endsInPast reports whether a booking ending at end (minutes since Monday
+// 00:00) ended more than -pastGrace ago. Without a clock nothing is past.
+func (s *ServerState) endsInPast(end int32) bool {
+	if s.clock == nil {
+		return false
+	}
+	return end < s.clock()-int32(s.pastGrace/time.Minute)
+}
+
+// pastBookingReply is the refusal for a booking window that is already
+// over; it echoes the server's time so clients can see any skew.
+func (s *ServerState) pastBookingReply(end int32) string {
+	return fmt.Sprintf("The booking would end at %s, which is already past (grace %v). Now=%s",
+		formatWeekMinutes(end), s.pastGrace, formatWeekMinutes(s.clock()))
+}
+
+// formatWeekMinutes renders minutes since Monday 00:00 as "Wed 10:30".
+func formatWeekMinutes(m int32) string {
+	return common.FormatWeekTime(m)
+}
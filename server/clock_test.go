@@ -0,0 +1,192 @@
+// server/clock_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+func TestParseCurrentTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int32 // minutes since Monday 00:00, -1 for no clock
+		wantErr bool
+	}{
+		{"", -1, false},
+		{"Wed 10:30", schedule.ToMinutes(2, 10, 30), false},
+		{" 2 10:30 ", schedule.ToMinutes(2, 10, 30), false},
+		{"mon 00:00", 0, false},
+		{"Sun 23:59", schedule.WeekMinutes - 1, false},
+		{"Sat 24:00", schedule.ToMinutes(6, 0, 0), false},
+		{"Sun 24:00", 0, true},
+		{"Wed", 0, true},
+		{"Wed 25:00", 0, true},
+		{"Someday 10:00", 0, true},
+	}
+	for _, tt := range tests {
+		clock, err := parseCurrentTime(tt.in, 0)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCurrentTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		switch {
+		case err != nil:
+		case tt.want < 0 && clock != nil:
+			t.Errorf("parseCurrentTime(%q) returned a clock", tt.in)
+		case tt.want >= 0 && (clock == nil || clock() != tt.want):
+			t.Errorf("parseCurrentTime(%q) does not read %d", tt.in, tt.want)
+		}
+	}
+	if clock, err := parseCurrentTime("real", 0); err != nil || clock == nil {
+		t.Errorf("real clock: %v", err)
+	} else if now := clock(); now < 0 || now >= schedule.WeekMinutes {
+		t.Errorf("real clock reads %d, outside the week", now)
+	}
+}
+
+// startedAt returns a server whose clock reads minutes, with an admin
+// account, and the admin's session token.
+func startedAt(t *testing.T, minutes int32) (*ServerState, string) {
+	t.Helper()
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.clock = fixedWeekClock(minutes)
+	if err := srv.registerAdmin("admin", "key"); err != nil {
+		t.Fatalf("registerAdmin: %v", err)
+	}
+	return srv, login(t, srv, newFakePeer("admin"), 100, "admin", "key")
+}
+
+// The cases below run against the seeded BKG-10000, RoomA Monday 09:00-10:00.
+var clockCases = []struct {
+	name   string
+	now    int32
+	status int32
+}{
+	{"before start", schedule.ToMinutes(0, 8, 59), common.StatusOK},
+	{"at start", schedule.ToMinutes(0, 9, 0), common.StatusInProgress},
+	{"in progress", schedule.ToMinutes(0, 9, 30), common.StatusInProgress},
+	{"at end", schedule.ToMinutes(0, 10, 0), common.StatusBookingOver},
+	{"after end", schedule.ToMinutes(3, 12, 0), common.StatusBookingOver},
+}
+
+func TestCancelStartedBooking(t *testing.T) {
+	for _, tt := range clockCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, admin := startedAt(t, tt.now)
+			p := newFakePeer("client")
+			cancel := common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 1, ConfirmationID: "BKG-10000"}
+			if rep := send(t, srv, p, cancel); rep.Status != tt.status {
+				t.Fatalf("cancel: status %d, want %d: %s", rep.Status, tt.status, rep.Data)
+			}
+			if tt.status == common.StatusOK {
+				return
+			}
+			cancel.RequestID, cancel.Force = 2, true
+			if rep := send(t, srv, p, cancel); rep.Status == common.StatusOK {
+				t.Errorf("forced cancel without an admin session: %s", rep.Data)
+			}
+			cancel.RequestID, cancel.SessionToken = 3, admin
+			if rep := send(t, srv, p, cancel); rep.Status != common.StatusOK {
+				t.Errorf("admin's forced cancel: status %d: %s", rep.Status, rep.Data)
+			}
+		})
+	}
+}
+
+func TestChangeStartedBooking(t *testing.T) {
+	for _, tt := range clockCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, admin := startedAt(t, tt.now)
+			p := newFakePeer("client")
+			move := common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 1, ConfirmationID: "BKG-10000", OffsetMinutes: 60}
+			if rep := send(t, srv, p, move); rep.Status != tt.status {
+				t.Fatalf("move: status %d, want %d: %s", rep.Status, tt.status, rep.Data)
+			}
+			if tt.status == common.StatusOK {
+				return
+			}
+			start, end := bookingInterval(t, srv, "BKG-10000")
+
+			// Only the end of a running booking moves, and not into the past
+			extend := common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 2, ConfirmationID: "BKG-10000", OffsetMinutes: 30, EndOnly: true}
+			rep := send(t, srv, p, extend)
+			if tt.status == common.StatusInProgress {
+				if rep.Status != common.StatusOK {
+					t.Fatalf("extend: status %d: %s", rep.Status, rep.Data)
+				}
+				if s, e := bookingInterval(t, srv, "BKG-10000"); s != start || e != end+30 {
+					t.Errorf("extended to %d..%d, want %d..%d", s, e, start, end+30)
+				}
+				shorten := extend
+				shorten.RequestID, shorten.OffsetMinutes = 3, -90
+				if rep := send(t, srv, p, shorten); rep.Status != common.StatusInvalidArgument {
+					t.Errorf("ending it before now: status %d: %s", rep.Status, rep.Data)
+				}
+				return
+			}
+			if rep.Status != common.StatusBookingOver {
+				t.Errorf("extending an ended booking: status %d: %s", rep.Status, rep.Data)
+			}
+			move.RequestID, move.Force, move.SessionToken = 4, true, admin
+			if rep := send(t, srv, p, move); rep.Status != common.StatusOK {
+				t.Errorf("admin's forced move: status %d: %s", rep.Status, rep.Data)
+			}
+		})
+	}
+}
+
+// TestPastBookings books and moves bookings to end around Wed 10:00 minus
+// the grace period.
+func TestPastBookings(t *testing.T) {
+	now := schedule.ToMinutes(2, 10, 0)
+	tests := []struct {
+		name  string
+		grace time.Duration
+		end   int32
+		ok    bool
+	}{
+		{"ends within the grace", 5 * time.Minute, now - 5, true},
+		{"ends a minute too early", 5 * time.Minute, now - 6, false},
+		{"ends now without grace", 0, now, true},
+		{"ended a minute ago without grace", 0, now - 1, false},
+		{"ends in the future", 0, now + 60, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fresh := func() *ServerState {
+				srv := newTestServer(t, SemanticsAtMostOnce)
+				srv.clock = fixedWeekClock(now)
+				srv.pastGrace = tt.grace
+				return srv
+			}
+			srv, p := fresh(), newFakePeer("client")
+
+			day, hour, minute := schedule.FromMinutes(tt.end)
+			req := common.RequestMessage{OpCode: common.OpBookFacility, RequestID: 1, FacilityName: "RoomA",
+				StartDay: 2, StartHour: 8, EndDay: day, EndHour: hour, EndMinute: minute}
+			rep := send(t, srv, p, req)
+			if ok := rep.Status == common.StatusOK; ok != tt.ok {
+				t.Fatalf("book: status %d: %s", rep.Status, rep.Data)
+			}
+			if !tt.ok {
+				if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, "Now=Wed 10:00") {
+					t.Errorf("refusal: status %d: %s", rep.Status, rep.Data)
+				}
+			}
+
+			// A booking tomorrow at the same time, moved back a day, ends
+			// at the same minute and meets the same rule
+			srv = fresh()
+			req.RequestID, req.StartDay, req.EndDay = 2, 3, day+1
+			id := confirmationID(t, send(t, srv, p, req))
+			rep = send(t, srv, p, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 3, ConfirmationID: id, OffsetMinutes: -1440})
+			if ok := rep.Status == common.StatusOK; ok != tt.ok {
+				t.Errorf("move: status %d: %s", rep.Status, rep.Data)
+			}
+		})
+	}
+}
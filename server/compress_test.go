@@ -0,0 +1,38 @@
+// server/compress_test.go
+package main
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestReplyCompression checks only clients that advertise gzip get
+// compressed replies, and they decode to the same text.
+func TestReplyCompression(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.compressThreshold = 64
+	req := common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"} // the whole week
+
+	old := newFakePeer("old-client")
+	plain := send(t, srv, old, req)
+	if plain.Flags&common.FlagCompressed != 0 {
+		t.Error("compressed reply to a client that did not advertise gzip")
+	}
+	if len(plain.Data) < srv.compressThreshold {
+		t.Fatalf("reply of %d bytes is under the threshold", len(plain.Data))
+	}
+
+	req.Capabilities = common.CapGzip
+	gz := newFakePeer("new-client")
+	packed := send(t, srv, gz, req)
+	if packed.Flags&common.FlagCompressed == 0 {
+		t.Error("reply to a gzip client not compressed")
+	}
+	if packed.Data != plain.Data {
+		t.Errorf("decompressed reply differs:\n%s\nwant\n%s", packed.Data, plain.Data)
+	}
+	if sizes := [2]int{len(old.rawReceived()[0]), len(gz.rawReceived()[0])}; sizes[1] >= sizes[0] {
+		t.Errorf("compressed reply is %d bytes, plain %d", sizes[1], sizes[0])
+	}
+}
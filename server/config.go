@@ -0,0 +1,36 @@
+// server/config.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ServerConfig holds the optional settings loaded from the -config JSON file.
+type ServerConfig struct {
+	Webhooks  []WebhookConfig  `json:"webhooks"`
+	Blackouts []BlackoutConfig `json:"blackouts"`
+	// Facility name -> bookings allowed at once, for pools of identical places
+	Capacities map[string]int `json:"capacities"`
+	// Facilities whose bookings wait for the admin's approval
+	Approval []string `json:"approvalRequired"`
+}
+
+// LoadConfig reads and parses the JSON config file at path.
+func LoadConfig(path string) (*ServerConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	var cfg ServerConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	for i, hook := range cfg.Webhooks {
+		if hook.URL == "" {
+			return nil, fmt.Errorf("config %s: webhook %d has no url", path, i)
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,88 @@
+// server/copy.go
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// handleCopyBooking books the same facility, time of day, length and
+// participants as an existing booking, starting on another day. The copy
+// gets its own confirmation ID and is independent of the original from
+// then on. A booking that runs over midnight keeps doing so, and must
+// still end by Sunday 24:00 once moved.
+func (s *ServerState) handleCopyBooking(req common.RequestMessage, t *opTiming) (string, int32) {
+	confID := req.ConfirmationID
+	log.Printf("Handling CopyBooking of '%s' to day %d", confID, req.StartDay)
+	if req.StartDay > validate.MaxDay {
+		t.reject("StartDay", fmt.Sprint(req.StartDay))
+		return fmt.Sprintf("Error: StartDay %d is out of range (0-%d).", req.StartDay, validate.MaxDay), common.StatusInvalidArgument
+	}
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	facName, fac, index, ok := s.findBooking(req.Namespace, confID)
+	if !ok {
+		log.Printf("Booking '%s' not found in CopyBooking", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Error: Booking %s not found", confID), -1
+	}
+	bk := fac.Bookings[index]
+	if bk.Pending {
+		return refusePending(bk, t)
+	}
+	if req.StartDay == bk.StartDay {
+		t.reject("StartDay", fmt.Sprint(req.StartDay))
+		return fmt.Sprintf("Booking %s already starts on that day", confID), common.StatusInvalidArgument
+	}
+
+	shift := (int32(req.StartDay) - int32(bk.StartDay)) * schedule.DayMinutes
+	orig := bk.interval()
+	window := schedule.Interval{Start: orig.Start + shift, End: orig.End + shift}
+	if window.End > validate.WeekMinutes {
+		t.reject("StartDay", fmt.Sprint(req.StartDay))
+		return fmt.Sprintf("A copy of booking %s starting %s would run past the end of the week",
+			confID, formatWeekMinutes(window.Start)), common.StatusInvalidArgument
+	}
+	if !req.Force && s.endsInPast(window.End) {
+		log.Printf("Refusing to copy booking '%s' into the past", confID)
+		t.reject("StartDay", fmt.Sprint(req.StartDay))
+		return s.pastBookingReply(window.End), common.StatusInvalidArgument
+	}
+	if !fac.hasRoom(window) {
+		log.Printf("Time conflict in '%s' when copying booking '%s'", facName, confID)
+		return fac.bookingConflict(), 1
+	}
+	if b, closed := fac.blackoutOverlapping(window.Start, window.End); closed {
+		log.Printf("Copying booking '%s' would place it in a blackout of '%s'", confID, facName)
+		return blackoutConflict(b), 1
+	}
+
+	id := req.NewID
+	if id == "" {
+		id = s.newID()
+	}
+	cp := bookingAt(bk, id, window)
+	// A copy is a new booking, so it needs its own approval
+	if fac.RequiresApproval {
+		s.holdForApproval(&cp, req)
+	} else if err := s.store.SaveBooking(qualify(req.Namespace, facName), cp); err != nil {
+		log.Printf("Failed to persist copy of booking '%s': %v", confID, err)
+		return "Error: could not save booking copy.", -1
+	}
+	fac.Bookings = append(fac.Bookings, cp)
+
+	msg := fmt.Sprintf("Booking %s copied to %s: %s to %s", confID, id,
+		formatWeekMinutes(window.Start), formatWeekMinutes(window.End))
+	if cp.Pending {
+		msg += pendingLabel(cp)
+	}
+	s.notifySubscribers(req.Namespace, facName, EventBookingCreated, id, msg, affectedDays(cp))
+	log.Printf("CopyBooking successful: %s", msg)
+	return msg + ". ID=" + id, 0
+}
@@ -0,0 +1,107 @@
+// server/copy_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+func copyReq(id uint64, confID string, day uint8) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpCopyBooking, RequestID: id, ConfirmationID: confID, StartDay: day}
+}
+
+func TestCopyBooking(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p, watcher := newFakePeer("client"), newFakePeer("watcher")
+	send(t, srv, p, addParticipant(1, "Ada"))
+	send(t, srv, watcher, monitorReq(2, []uint8{3}, 0))
+
+	rep := send(t, srv, p, copyReq(3, "BKG-10000", 3))
+	id := confirmationID(t, rep)
+	if id == "BKG-10000" {
+		t.Fatal("copy kept the original ID")
+	}
+	if start, end := bookingInterval(t, srv, id); start != schedule.ToMinutes(3, 9, 0) || end != schedule.ToMinutes(3, 10, 0) {
+		t.Errorf("copy at %d-%d, want Thursday 09:00-10:00", start, end)
+	}
+	if start, _ := bookingInterval(t, srv, "BKG-10000"); start != schedule.ToMinutes(0, 9, 0) {
+		t.Errorf("original moved to minute %d", start)
+	}
+	srv.dataLock.RLock()
+	_, fac, i, _ := srv.findBooking(common.DefaultNamespace, id)
+	copied := strings.Join(fac.Bookings[i].Participants, ",")
+	srv.dataLock.RUnlock()
+	if copied != "Ada" {
+		t.Errorf("copy has participants %q", copied)
+	}
+	if got := events(t, watcher); len(got) != 1 || got[0] != common.EventCreated {
+		t.Errorf("Thursday monitor heard %v, want one creation", got)
+	}
+
+	// The two are independent: a participant added to the original is not
+	// added to the copy, and cancelling the original keeps the copy
+	send(t, srv, p, addParticipant(4, "Bob"))
+	send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 5, ConfirmationID: "BKG-10000"})
+	srv.dataLock.RLock()
+	_, fac, i, ok := srv.findBooking(common.DefaultNamespace, id)
+	if ok {
+		copied = strings.Join(fac.Bookings[i].Participants, ",")
+	}
+	srv.dataLock.RUnlock()
+	if !ok || copied != "Ada" {
+		t.Errorf("copy after changes to the original: found %v, participants %q", ok, copied)
+	}
+}
+
+// TestCopyMultiDay: a booking over midnight is copied with its length and
+// times of day, as long as the copy ends by Sunday 24:00.
+func TestCopyMultiDay(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	req := bookReq(1, "Lab1", 4, 22, 1)
+	req.EndDay = 5
+	orig := confirmationID(t, send(t, srv, p, req))
+
+	id := confirmationID(t, send(t, srv, p, copyReq(2, orig, 0)))
+	if start, end := bookingInterval(t, srv, id); start != schedule.ToMinutes(0, 22, 0) || end != schedule.ToMinutes(1, 1, 0) {
+		t.Errorf("copy at %d-%d, want Monday 22:00 to Tuesday 01:00", start, end)
+	}
+	id = confirmationID(t, send(t, srv, p, copyReq(3, orig, 5)))
+	if start, end := bookingInterval(t, srv, id); start != schedule.ToMinutes(5, 22, 0) || end != schedule.ToMinutes(6, 1, 0) {
+		t.Errorf("copy at %d-%d, want Saturday 22:00 to Sunday 01:00", start, end)
+	}
+	rep := send(t, srv, p, copyReq(4, orig, 6))
+	if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, "past the end of the week") {
+		t.Errorf("copy to Sunday: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+func TestCopyRefused(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 3, 8, 10)))
+	before := facilityBookings(srv, "RoomA")
+
+	tests := []struct {
+		req    common.RequestMessage
+		status int32
+		reply  string
+	}{
+		{copyReq(2, "BKG-10000", 3), 1, "Time conflict"},
+		{copyReq(3, "BKG-10000", 0), common.StatusInvalidArgument, "already starts on that day"},
+		{copyReq(4, "BKG-10000", 7), common.StatusInvalidArgument, "out of range"},
+		{copyReq(5, "BKG-99999", 2), -1, "not found"},
+	}
+	for _, tt := range tests {
+		rep := send(t, srv, p, tt.req)
+		if rep.Status != tt.status || !strings.Contains(rep.Data, tt.reply) {
+			t.Errorf("copy to day %d: status %d: %s; want %d and %q", tt.req.StartDay, rep.Status, rep.Data, tt.status, tt.reply)
+		}
+	}
+	if after := facilityBookings(srv, "RoomA"); strings.Join(after, ",") != strings.Join(before, ",") {
+		t.Errorf("refused copies changed RoomA from %v to %v", before, after)
+	}
+}
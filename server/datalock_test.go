@@ -0,0 +1,107 @@
+// server/datalock_test.go
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// discardPeer drops everything the server sends it.
+type discardPeer struct{}
+
+func (discardPeer) Send([]byte) error { return nil }
+func (discardPeer) String() string    { return "discard" }
+
+// TestQueriesShareDataLock: a query runs while another reader holds
+// dataLock, and a booking waits for it.
+func TestQueriesShareDataLock(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+	srv.dataLock.RLock()
+
+	queried := make(chan common.ReplyMessage)
+	go func() {
+		queried <- send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"})
+	}()
+	select {
+	case rep := <-queried:
+		if rep.Status != common.StatusOK {
+			t.Errorf("query: status %d: %s", rep.Status, rep.Data)
+		}
+	case <-time.After(time.Second):
+		srv.dataLock.RUnlock()
+		t.Fatal("query blocked behind another reader")
+	}
+
+	booked := make(chan common.ReplyMessage)
+	go func() { booked <- send(t, srv, newFakePeer("booker"), bookReq(2, "Lab1", 4, 9, 10)) }()
+	select {
+	case rep := <-booked:
+		t.Fatalf("booking ran under a read lock: %+v", rep)
+	case <-time.After(50 * time.Millisecond):
+	}
+	srv.dataLock.RUnlock()
+	if rep := <-booked; rep.Status != common.StatusOK {
+		t.Errorf("booking: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// BenchmarkReadersWithBooker runs b.N queries from 32 goroutines while one
+// more books and cancels in a loop, and reports how many bookings it made.
+// Run it with -race too.
+func BenchmarkReadersWithBooker(b *testing.B) {
+	const readers = 32
+	srv := newTestServer(b, SemanticsAtLeastOnce)
+	peer := newFakePeer("reader")
+	query := peer.seal(b, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"})
+
+	stop := make(chan struct{})
+	var bookings atomic.Int64
+	booked := make(chan struct{})
+	go func() {
+		defer close(booked)
+		booker := newFakePeer("booker")
+		for id := uint64(1); ; id += 2 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			got := deliver(srv, booker, booker.seal(b, bookReq(id, "Lab1", 4, 9, 10)))
+			i := -1
+			if len(got) == 1 && got[0].Status == common.StatusOK {
+				i = strings.LastIndex(got[0].Data, "ID=")
+			}
+			if i < 0 {
+				b.Errorf("booking: %+v", got)
+				return
+			}
+			bookings.Add(1)
+			cancel := common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: id + 1, ConfirmationID: got[0].Data[i+len("ID="):]}
+			deliver(srv, booker, booker.seal(b, cancel))
+		}
+	}()
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next.Add(1) <= int64(b.N) {
+				srv.handlePacket(query, discardPeer{})
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+	close(stop)
+	<-booked
+	b.ReportMetric(float64(bookings.Load())/b.Elapsed().Seconds(), "bookings/s")
+}
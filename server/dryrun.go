@@ -0,0 +1,93 @@
+// server/dryrun.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// overlapping returns the facility's bookings that overlap window, in
+// start order.
+func (f *FacilityInfo) overlapping(window schedule.Interval) []Booking {
+	var out []Booking
+	for _, bk := range f.Bookings {
+		if bk.interval().Overlaps(window) {
+			out = append(out, bk)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].interval().Start < out[j].interval().Start })
+	return out
+}
+
+// nextFit returns the earliest start after window.Start at which a
+// booking of the same length fits into the facility before the end of the
+// week. Only the ends of bookings and blackouts need trying: a window that
+// does not fit can only start to fit where something in its way ends.
+func (s *ServerState) nextFit(f *FacilityInfo, window schedule.Interval) (int32, bool) {
+	length := window.End - window.Start
+	var starts []int32
+	for _, bk := range f.Bookings {
+		starts = append(starts, bk.interval().End)
+	}
+	for _, b := range f.Blackouts {
+		starts = append(starts, b.asBooking().interval().End)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		try := schedule.Interval{Start: start, End: start + length}
+		if start <= window.Start || try.End > schedule.WeekMinutes || s.endsInPast(try.End) {
+			continue
+		}
+		if _, closed := f.blackoutOverlapping(try.Start, try.End); f.hasRoom(try) && !closed {
+			return start, true
+		}
+	}
+	return 0, false
+}
+
+// dryRunConflict adds to a conflict refusal what a dry run reports besides:
+// the bookings in the way and the next start at which the window would fit.
+func (s *ServerState) dryRunConflict(msg string, f *FacilityInfo, window schedule.Interval) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, bk := range f.overlapping(window) {
+		iv := bk.interval()
+		fmt.Fprintf(&b, "\nConflicts with %s from %s to %s.", bk.ConfirmationID,
+			common.FormatLongWeekTime(iv.Start), common.FormatLongWeekTime(iv.End))
+	}
+	if start, ok := s.nextFit(f, window); ok {
+		fmt.Fprintf(&b, "\nThe same length would fit from %s to %s.",
+			common.FormatLongWeekTime(start), common.FormatLongWeekTime(start+window.End-window.Start))
+	} else {
+		b.WriteString("\nThe same length fits nowhere later this week.")
+	}
+	return b.String()
+}
+
+// dryRunChange answers a ChangeBooking dry run once the moved booking has
+// passed every check but the conflict checks. It tests the new window
+// against the other bookings without taking the booking out of the
+// facility, as the real change does. The caller holds dataLock.
+func (s *ServerState) dryRunChange(req common.RequestMessage, fac *FacilityInfo, index int, window schedule.Interval) (string, int32) {
+	others := *fac
+	others.Bookings = make([]Booking, 0, len(fac.Bookings)-1)
+	others.Bookings = append(others.Bookings, fac.Bookings[:index]...)
+	others.Bookings = append(others.Bookings, fac.Bookings[index+1:]...)
+
+	if !others.hasRoom(window) {
+		log.Printf("Dry run: changing booking '%s' would conflict", req.ConfirmationID)
+		return s.dryRunConflict(others.bookingConflict(), &others, window), common.StatusConflict
+	}
+	if b, closed := others.blackoutOverlapping(window.Start, window.End); closed {
+		log.Printf("Dry run: changing booking '%s' would move it into a blackout", req.ConfirmationID)
+		return s.dryRunConflict(blackoutConflict(b), &others, window), common.StatusConflict
+	}
+	log.Printf("Dry run: changing booking '%s' would succeed", req.ConfirmationID)
+	return fmt.Sprintf("Dry run: booking %s would move to %s - %s. Nothing was changed.",
+		req.ConfirmationID, common.FormatLongWeekTime(window.Start), common.FormatLongWeekTime(window.End)), common.StatusOK
+}
@@ -0,0 +1,135 @@
+// server/dryrun_test.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// writeCounter is a memory store that counts the booking writes.
+type writeCounter struct {
+	Store
+	writes int
+}
+
+func (w *writeCounter) SaveBooking(facility string, bk Booking) error {
+	w.writes++
+	return w.Store.SaveBooking(facility, bk)
+}
+
+func (w *writeCounter) UpdateBooking(facility string, bk Booking) error {
+	w.writes++
+	return w.Store.UpdateBooking(facility, bk)
+}
+
+func (w *writeCounter) DeleteBooking(confID string) error {
+	w.writes++
+	return w.Store.DeleteBooking(confID)
+}
+
+// stateSnapshot describes everything a dry run has to leave alone: every
+// booking, the change counter and the size of the history.
+func stateSnapshot(srv *ServerState) string {
+	srv.dataLock.RLock()
+	defer srv.dataLock.RUnlock()
+	var lines []string
+	for ns, facs := range srv.facilityData {
+		for name, fac := range facs {
+			lines = append(lines, fmt.Sprintf("%s/%s: %+v", ns, name, fac.Bookings))
+		}
+	}
+	sort.Strings(lines)
+	lines = append(lines, fmt.Sprintf("seq %d, history %d", srv.changes.current(), srv.history.(*MemoryHistory).Len()))
+	return strings.Join(lines, "\n")
+}
+
+func dryRun(req common.RequestMessage) common.RequestMessage {
+	req.DryRun = true
+	return req
+}
+
+// TestDryRunChangesNothing runs dry runs that would succeed and dry runs
+// that would fail, each twice, and checks that the bookings, the store,
+// the IDs, the change journal, the history and the subscribers are all
+// left as they were.
+func TestDryRunChangesNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    common.RequestMessage
+		status int32
+		want   []string
+	}{
+		{"book", dryRun(bookReq(1, "RoomA", 4, 9, 10)), common.StatusOK,
+			[]string{"Dry run: booking 'RoomA' from Friday 09:00 to Friday 10:00 would succeed. Nothing was booked."}},
+		{"book conflict", dryRun(bookReq(1, "RoomA", 0, 9, 11)), common.StatusConflict,
+			[]string{"Conflicts with BKG-10000 from Monday 09:00 to Monday 10:00.", "The same length would fit from Monday 10:00 to Monday 12:00."}},
+		{"change", dryRun(common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 1, ConfirmationID: "BKG-10000", OffsetMinutes: 60}),
+			common.StatusOK, []string{"Dry run: booking BKG-10000 would move to Monday 10:00 - Monday 11:00. Nothing was changed."}},
+		{"change conflict", dryRun(common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 1, ConfirmationID: "BKG-10000", OffsetMinutes: 1440 + 5*60}),
+			common.StatusConflict, []string{"Conflicts with BKG-10001 from Tuesday 14:00 to Tuesday 15:30."}},
+		{"unknown booking", dryRun(common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 1, ConfirmationID: "BKG-99999", OffsetMinutes: 60}),
+			common.StatusError, []string{"Booking BKG-99999 not found"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &writeCounter{Store: NewMemoryStore()}
+			srv, err := NewServerState(SemanticsAtMostOnce, store, NewMemoryHistory(0))
+			if err != nil {
+				t.Fatalf("NewServerState: %v", err)
+			}
+			ids := 0
+			gen := srv.newID
+			srv.newID = func() string { ids++; return gen() }
+			watcher := newFakePeer("watcher")
+			if rep := send(t, srv, watcher, monitorReq(1, nil, 0)); rep.Status != common.StatusOK {
+				t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+			}
+			before := stateSnapshot(srv)
+
+			p := newFakePeer("client")
+			for i := 0; i < 2; i++ {
+				rep := send(t, srv, p, tt.req)
+				if rep.Status != tt.status {
+					t.Fatalf("status %d, want %d: %s", rep.Status, tt.status, rep.Data)
+				}
+				for _, want := range tt.want {
+					if !strings.Contains(rep.Data, want) {
+						t.Errorf("reply lacks %q:\n%s", want, rep.Data)
+					}
+				}
+			}
+			if after := stateSnapshot(srv); after != before {
+				t.Errorf("state changed from\n%s\nto\n%s", before, after)
+			}
+			if store.writes != 0 || ids != 0 {
+				t.Errorf("%d store writes, %d IDs generated", store.writes, ids)
+			}
+			if cbs := watcher.callbacks(); len(cbs) != 0 {
+				t.Errorf("subscriber notified: %q", cbs[0].Data)
+			}
+		})
+	}
+}
+
+// TestDryRunThenBook: a dry run answers as the real request then does.
+func TestDryRunThenBook(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	req := bookReq(1, "Lab1", 2, 12, 13)
+	if rep := send(t, srv, p, dryRun(req)); rep.Status != common.StatusOK {
+		t.Fatalf("dry run: status %d: %s", rep.Status, rep.Data)
+	}
+	// The same RequestID is not taken as a duplicate of the dry run
+	id := confirmationID(t, send(t, srv, p, req))
+	if got := facilityBookings(srv, "Lab1"); len(got) != 2 {
+		t.Errorf("Lab1 holds %q after booking %s", got, id)
+	}
+	if rep := send(t, srv, p, dryRun(bookReq(2, "Lab1", 2, 12, 13))); rep.Status != common.StatusConflict ||
+		!strings.Contains(rep.Data, "Conflicts with "+id) {
+		t.Errorf("dry run of the booked window: status %d: %s", rep.Status, rep.Data)
+	}
+}
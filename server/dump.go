@@ -0,0 +1,106 @@
+// server/dump.go
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// StateDump is the JSON document written on SIGUSR1.
+type StateDump struct {
+	Time        time.Time
+	Semantics   string
+	Role        string
+	Facilities  map[string]map[string]*FacilityInfo // by namespace, then name
+	Monitors    []MonitorDump
+	HistorySize int
+	Sessions    int
+	InFlight    int
+	Goroutines  int
+	Metrics     map[string]json.RawMessage
+}
+
+// MonitorDump describes one monitor registration.
+type MonitorDump struct {
+	Client    string
+	Namespace string
+	Facility  string
+	ExpiresAt time.Time
+	LastSeq   uint64
+}
+
+// snapshot copies the server state. Each lock is held only for the copy.
+func (s *ServerState) snapshot() StateDump {
+	d := StateDump{
+		Time:       time.Now(),
+		Semantics:  s.semantics,
+		Role:       s.role,
+		Facilities: make(map[string]map[string]*FacilityInfo),
+		Monitors:   make([]MonitorDump, 0),
+		Metrics:    make(map[string]json.RawMessage),
+	}
+
+	s.dataLock.RLock()
+	for ns, facilities := range s.facilityData {
+		d.Facilities[ns] = make(map[string]*FacilityInfo, len(facilities))
+		for name, fac := range facilities {
+			cp := &FacilityInfo{Name: fac.Name, Bookings: make([]Booking, len(fac.Bookings)), ConcurrentCapacity: fac.ConcurrentCapacity,
+				RequiresApproval: fac.RequiresApproval}
+			copy(cp.Bookings, fac.Bookings)
+			cp.Blackouts = append([]Blackout(nil), fac.Blackouts...)
+			d.Facilities[ns][name] = cp
+		}
+	}
+	s.dataLock.RUnlock()
+
+	s.monitorLock.Lock()
+	for _, sub := range s.monitorSubs {
+		d.Monitors = append(d.Monitors, MonitorDump{
+			Client:    sub.ClientAddr.String(),
+			Namespace: sub.Namespace,
+			Facility:  sub.FacilityName,
+			ExpiresAt: sub.ExpiresAt,
+			LastSeq:   sub.Seq,
+		})
+	}
+	s.monitorLock.Unlock()
+
+	s.sessionLock.Lock()
+	d.Sessions = len(s.sessions)
+	s.sessionLock.Unlock()
+
+	s.inflightLock.Lock()
+	d.InFlight = len(s.inflight)
+	s.inflightLock.Unlock()
+
+	if l, ok := s.history.(interface{ Len() int }); ok {
+		d.HistorySize = l.Len()
+	}
+	d.Goroutines = runtime.NumGoroutine()
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key != "cmdline" && kv.Key != "memstats" {
+			d.Metrics[kv.Key] = json.RawMessage(kv.Value.String())
+		}
+	})
+	return d
+}
+
+// writeStateDump writes a timestamped JSON snapshot to dir and returns
+// the file name.
+func (s *ServerState) writeStateDump(dir string) (string, error) {
+	d := s.snapshot()
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("state-%s.json", d.Time.Format("20060102-150405.000")))
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+// server/dump_signal.go
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleDumpSignal writes a state dump to dir on every SIGUSR1.
+func (s *ServerState) handleDumpSignal(dir string) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			name, err := s.writeStateDump(dir)
+			if err != nil {
+				log.Printf("State dump failed: %v", err)
+				continue
+			}
+			log.Printf("State dump written to %s", name)
+		}
+	}()
+}
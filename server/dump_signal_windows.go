@@ -0,0 +1,11 @@
+//go:build windows
+
+// server/dump_signal_windows.go
+package main
+
+import "log"
+
+// handleDumpSignal is a no-op: Windows has no SIGUSR1.
+func (s *ServerState) handleDumpSignal(dir string) {
+	log.Printf("State dumps on SIGUSR1 are not supported on Windows")
+}
@@ -0,0 +1,80 @@
+// server/dump_test.go
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestStateDump(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	p := newFakePeer("client")
+	send(t, srv, p, addParticipant(1, "Ada"))
+
+	dir := t.TempDir()
+	name, err := srv.writeStateDump(dir)
+	if err != nil {
+		t.Fatalf("writeStateDump: %v", err)
+	}
+	if filepath.Dir(name) != dir {
+		t.Errorf("dump written to %s, want a file in %s", name, dir)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The document has every top-level field
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("dump is not JSON: %v", err)
+	}
+	for _, field := range []string{"Time", "Semantics", "Role", "Facilities", "Monitors", "HistorySize", "Sessions", "InFlight", "Goroutines", "Metrics"} {
+		if _, ok := doc[field]; !ok {
+			t.Errorf("dump has no %s", field)
+		}
+	}
+
+	var d StateDump
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("decoding the dump: %v", err)
+	}
+	if d.Semantics != SemanticsAtMostOnce {
+		t.Errorf("Semantics = %q", d.Semantics)
+	}
+	roomA := d.Facilities[common.DefaultNamespace]["RoomA"]
+	if roomA == nil || len(roomA.Bookings) != 2 {
+		t.Fatalf("RoomA in the dump = %+v, want its 2 bookings", roomA)
+	}
+	if got := roomA.Bookings[0].Participants; len(got) != 1 || got[0] != "Ada" {
+		t.Errorf("BKG-10000 participants = %q, want [Ada]", got)
+	}
+	if len(d.Monitors) != 1 || d.Monitors[0].Client != "watcher" || d.Monitors[0].Facility != "RoomA" {
+		t.Errorf("Monitors = %+v, want the watcher on RoomA", d.Monitors)
+	}
+	if d.HistorySize != 2 {
+		t.Errorf("HistorySize = %d, want 2", d.HistorySize)
+	}
+	if d.Goroutines <= 0 {
+		t.Errorf("Goroutines = %d", d.Goroutines)
+	}
+	if _, ok := d.Metrics["requests_executed"]; !ok {
+		t.Error("metrics have no requests_executed")
+	}
+}
+
+// TestSnapshotIsACopy checks later changes don't reach a snapshot.
+func TestSnapshotIsACopy(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	d := srv.snapshot()
+	send(t, srv, newFakePeer("client"), addParticipant(1, "Ada"))
+	if got := d.Facilities[common.DefaultNamespace]["RoomA"].Bookings[0].Participants; len(got) != 0 {
+		t.Errorf("snapshot participants = %q after a later change", got)
+	}
+}
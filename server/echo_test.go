@@ -0,0 +1,65 @@
+// server/echo_test.go
+package main
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestErrorEcho sends one bad request per validation failure and checks
+// which request fields the error reply repeats.
+func TestErrorEcho(t *testing.T) {
+	badHour := bookReq(0, "Lab1", 3, 9, 10)
+	badHour.StartHour = 25
+	tests := []struct {
+		name string
+		req  common.RequestMessage
+		want common.ErrorEcho
+	}{
+		{"unknown facility", bookReq(0, "Gym", 3, 9, 10),
+			common.ErrorEcho{Op: "BookFacility", Facility: "Gym", Field: "FacilityName", Value: "Gym"}},
+		{"hour out of range", badHour,
+			common.ErrorEcho{Op: "BookFacility", Facility: "Lab1", Field: "StartHour", Value: "25"}},
+		{"end before start", bookReq(0, "Lab1", 3, 10, 9),
+			common.ErrorEcho{Op: "BookFacility", Facility: "Lab1", Field: "End", Value: "Thu 09:00"}},
+		{"unknown booking",
+			common.RequestMessage{OpCode: common.OpChangeBooking, ConfirmationID: "BKG-404", OffsetMinutes: 60},
+			common.ErrorEcho{Op: "ChangeBooking", ConfirmationID: "BKG-404", Field: "ConfirmationID", Value: "BKG-404"}},
+		{"partial days",
+			common.RequestMessage{OpCode: common.OpChangeBooking, ConfirmationID: "BKG-10000", OffsetMinutes: 90, WholeDays: true},
+			common.ErrorEcho{Op: "ChangeBooking", ConfirmationID: "BKG-10000", Field: "OffsetMinutes", Value: "90"}},
+		{"bitmap of two facilities",
+			common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "Lab1", MoreFacilities: []string{"RoomA"}, Bitmap: true},
+			common.ErrorEcho{Op: "QueryAvailability", Facility: "Lab1", Field: "MoreFacilities", Value: "RoomA"}},
+		{"changes of an unknown facility",
+			common.RequestMessage{OpCode: common.OpQueryChanges, FacilityName: "Gym", SinceSeq: 1},
+			common.ErrorEcho{Op: "QueryChanges", Facility: "Gym", Field: "FacilityName", Value: "Gym"}},
+	}
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.RequestID = uint64(i + 1)
+			rep := send(t, srv, p, tt.req)
+			if rep.Status == common.StatusOK {
+				t.Fatalf("request accepted: %s", rep.Data)
+			}
+			echo, ok, err := common.ErrorEchoOf(rep)
+			if !ok || err != nil {
+				t.Fatalf("no echo (%v) in %+v", err, rep)
+			}
+			if echo != tt.want {
+				t.Errorf("echo %+v, want %+v", echo, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoEchoOnSuccess(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	rep := send(t, srv, newFakePeer("client"), bookReq(1, "Lab1", 3, 9, 10))
+	if _, ok, _ := common.ErrorEchoOf(rep); ok || rep.Status != common.StatusOK {
+		t.Errorf("successful reply echoes its request: %+v", rep)
+	}
+}
@@ -0,0 +1,121 @@
+// server/find.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// maxFindResults bounds the matches in one FindParticipant reply, so a
+// short substring cannot produce a reply larger than a datagram.
+const maxFindResults = 50
+
+// participantQuery is a parsed FindParticipant request.
+type participantQuery struct {
+	name      string // the name asked for, as sent
+	facility  string // empty for every facility
+	substring bool
+}
+
+// matches reports whether a participant name satisfies the query. Case is
+// ignored in both modes.
+func (q participantQuery) matches(participant string) bool {
+	if q.substring {
+		return strings.Contains(strings.ToLower(participant), strings.ToLower(q.name))
+	}
+	return strings.EqualFold(participant, q.name)
+}
+
+// participantMatch is one booking a participant is in.
+type participantMatch struct {
+	facility string
+	booking  Booking
+}
+
+// findParticipant returns the bookings with a participant matching q,
+// sorted by facility, start and confirmation ID. It scans every booking,
+// which is cheap at the sizes the server holds; an index by participant
+// name could replace it without changing the handler. The caller holds
+// dataLock for reading.
+func findParticipant(facilities map[string]*FacilityInfo, q participantQuery) []participantMatch {
+	var found []participantMatch
+	for name, fac := range facilities {
+		if q.facility != "" && name != q.facility {
+			continue
+		}
+		for _, bk := range fac.Bookings {
+			for _, p := range bk.Participants {
+				if q.matches(p) {
+					found = append(found, participantMatch{facility: name, booking: bk})
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.facility != b.facility {
+			return a.facility < b.facility
+		}
+		if as, bs := a.booking.interval().Start, b.booking.interval().Start; as != bs {
+			return as < bs
+		}
+		return a.booking.ConfirmationID < b.booking.ConfirmationID
+	})
+	return found
+}
+
+// handleFindParticipant answers which bookings a participant is in, across
+// all facilities of the request's namespace or in the one named.
+func (s *ServerState) handleFindParticipant(req common.RequestMessage, t *opTiming) (string, int32) {
+	log.Printf("Handling FindParticipant for '%s' in facility '%s' (mode %d)", req.ParticipantName, req.FacilityName, req.MatchMode)
+	if req.ParticipantName == "" {
+		t.reject("ParticipantName", "")
+		return "Error: ParticipantName is empty", common.StatusInvalidArgument
+	}
+	if req.MatchMode != common.MatchExact && req.MatchMode != common.MatchSubstring {
+		t.reject("MatchMode", fmt.Sprint(req.MatchMode))
+		return fmt.Sprintf("Error: MatchMode %d is not %d (exact) or %d (substring)",
+			req.MatchMode, common.MatchExact, common.MatchSubstring), common.StatusInvalidArgument
+	}
+	q := participantQuery{name: req.ParticipantName, facility: req.FacilityName, substring: req.MatchMode == common.MatchSubstring}
+
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+	if q.facility != "" {
+		if _, ok := s.facilityData[req.Namespace][q.facility]; !ok {
+			t.reject("FacilityName", q.facility)
+			return "Error: " + s.facilityNotFound(req.Namespace, q.facility), -1
+		}
+	}
+	return formatParticipantMatches(q, findParticipant(s.facilityData[req.Namespace], q)), common.StatusOK
+}
+
+// formatParticipantMatches renders the matches, at most maxFindResults.
+func formatParticipantMatches(q participantQuery, found []participantMatch) string {
+	mode := "exact"
+	if q.substring {
+		mode = "substring"
+	}
+	if len(found) == 0 {
+		return fmt.Sprintf("No bookings with participant %q (%s match).", q.name, mode)
+	}
+	result := fmt.Sprintf("Bookings with participant %q (%s match): %d\n", q.name, mode, len(found))
+	shown := found[:min(len(found), maxFindResults)]
+	for _, m := range shown {
+		bk := m.booking
+		iv := bk.interval()
+		result += fmt.Sprintf("  - %s: %s, %s to %s\n",
+			bk.ConfirmationID, common.EscapeText(m.facility),
+			common.FormatLongWeekTime(iv.Start), common.FormatLongWeekTime(iv.End))
+		result += fmt.Sprintf("      Participants: %v\n", escapeNames(bk.Participants))
+	}
+	if len(shown) < len(found) {
+		result += fmt.Sprintf("First %d of %d shown; narrow the search to see the rest.\n", len(shown), len(found))
+	}
+	return result
+}
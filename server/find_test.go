@@ -0,0 +1,114 @@
+// server/find_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// findReq looks for name in facility (empty for all) with the given mode.
+func findReq(id uint64, name, facility string, mode uint8) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpFindParticipant, RequestID: id,
+		ParticipantName: name, FacilityName: facility, MatchMode: mode}
+}
+
+// findServer has Alice in BKG-10000 and BKG-20000, and Alicia in BKG-10001.
+func findServer(t *testing.T) (*ServerState, *fakePeer) {
+	t.Helper()
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	for i, add := range []common.RequestMessage{
+		addParticipant(1, "Alice"),
+		{OpCode: common.OpAddParticipant, ConfirmationID: "BKG-20000", ParticipantName: "alice"},
+		{OpCode: common.OpAddParticipant, ConfirmationID: "BKG-10001", ParticipantName: "Alicia"},
+	} {
+		add.RequestID = uint64(i + 1)
+		if rep := send(t, srv, p, add); rep.Status != common.StatusOK {
+			t.Fatalf("add participant: %s", rep.Data)
+		}
+	}
+	return srv, p
+}
+
+func TestFindParticipant(t *testing.T) {
+	tests := []struct {
+		name, facility string
+		mode           uint8
+		want           []string // confirmation IDs, in order
+	}{
+		{"ALICE", "", common.MatchExact, []string{"BKG-20000", "BKG-10000"}},
+		{"alic", "", common.MatchSubstring, []string{"BKG-20000", "BKG-10000", "BKG-10001"}},
+		{"alice", "RoomA", common.MatchSubstring, []string{"BKG-10000"}},
+		{"alic", "", common.MatchExact, nil},
+		{"Bob", "", common.MatchSubstring, nil},
+	}
+	srv, p := findServer(t)
+	for i, tt := range tests {
+		rep := send(t, srv, p, findReq(uint64(10+i), tt.name, tt.facility, tt.mode))
+		if rep.Status != common.StatusOK {
+			t.Fatalf("find %q: status %d: %s", tt.name, rep.Status, rep.Data)
+		}
+		if len(tt.want) == 0 {
+			if !strings.HasPrefix(rep.Data, "No bookings with participant") {
+				t.Errorf("find %q (mode %d): %s", tt.name, tt.mode, rep.Data)
+			}
+			continue
+		}
+		var got []string
+		for _, line := range strings.Split(rep.Data, "\n") {
+			if id, _, ok := strings.Cut(strings.TrimPrefix(line, "  - "), ":"); ok && strings.HasPrefix(id, "BKG-") {
+				got = append(got, id)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("find %q in %q (mode %d) = %v, want %v\n%s", tt.name, tt.facility, tt.mode, got, tt.want, rep.Data)
+		}
+	}
+
+	rep := send(t, srv, p, findReq(20, "Alice", "", common.MatchExact))
+	if !strings.Contains(rep.Data, "  - BKG-10000: RoomA, Monday 09:00 to Monday 10:00\n") {
+		t.Errorf("match line missing:\n%s", rep.Data)
+	}
+}
+
+func TestFindParticipantRefused(t *testing.T) {
+	srv, p := findServer(t)
+	for i, tt := range []struct {
+		req    common.RequestMessage
+		status int32
+	}{
+		{findReq(10, "", "", common.MatchExact), common.StatusInvalidArgument},
+		{findReq(11, "Alice", "", 2), common.StatusInvalidArgument},
+		{findReq(12, "Alice", "Gym", common.MatchExact), -1},
+	} {
+		if rep := send(t, srv, p, tt.req); rep.Status != tt.status {
+			t.Errorf("case %d: status %d, want %d: %s", i+1, rep.Status, tt.status, rep.Data)
+		}
+	}
+}
+
+// TestFindParticipantBounded: a search matching more than maxFindResults
+// bookings lists only the first ones and says so.
+func TestFindParticipantBounded(t *testing.T) {
+	var facilities = map[string]*FacilityInfo{"RoomA": {Name: "RoomA"}}
+	for i := 0; i < maxFindResults+5; i++ {
+		facilities["RoomA"].Bookings = append(facilities["RoomA"].Bookings, Booking{
+			ConfirmationID: "BKG-" + strings.Repeat("1", i+1), StartDay: 0, StartHour: uint8(i % 24),
+			EndDay: 0, EndHour: uint8(i%24) + 1, Participants: []string{"Alice"},
+		})
+	}
+	q := participantQuery{name: "alice"}
+	found := findParticipant(facilities, q)
+	if len(found) != maxFindResults+5 {
+		t.Fatalf("%d matches, want %d", len(found), maxFindResults+5)
+	}
+	out := formatParticipantMatches(q, found)
+	if n := strings.Count(out, "  - BKG-"); n != maxFindResults {
+		t.Errorf("%d matches listed, want %d", n, maxFindResults)
+	}
+	if !strings.Contains(out, "First 50 of 55 shown") {
+		t.Errorf("no truncation note:\n%s", out)
+	}
+}
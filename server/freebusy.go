@@ -0,0 +1,91 @@
+// server/freebusy.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// freeBusy reports whether one more booking fits into window. A blackout
+// in the window wins over bookings, since it closes every place. A busy
+// facility names the earliest booking overlapping the window; in a pool
+// that is one of the bookings filling it.
+func (f *FacilityInfo) freeBusy(name string, window schedule.Interval) common.FreeBusy {
+	if b, closed := f.blackoutOverlapping(window.Start, window.End); closed {
+		return common.FreeBusy{Facility: name, State: common.FreeBusyClosed, Detail: b.Reason}
+	}
+	if f.hasRoom(window) {
+		return common.FreeBusy{Facility: name, State: common.FreeBusyFree}
+	}
+	var first *Booking
+	for i := range f.Bookings {
+		bk := &f.Bookings[i]
+		if bk.interval().Overlaps(window) && (first == nil || bk.interval().Start < first.interval().Start) {
+			first = bk
+		}
+	}
+	return common.FreeBusy{Facility: name, State: common.FreeBusyBooked, Detail: first.ConfirmationID}
+}
+
+// handleFreeBusy checks every facility of the request's namespace over one
+// window and answers which are free and what blocks the others, sorted by
+// facility name. The text lists both; ExtFreeBusy carries the same for
+// clients to lay out.
+func (s *ServerState) handleFreeBusy(req common.RequestMessage, t *opTiming) (string, int32, common.Extensions) {
+	if err := validate.ValidateBookingTimes(req.StartDay, req.StartHour, req.StartMinute, req.EndDay, req.EndHour, req.EndMinute); err != nil {
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v.", err), common.StatusInvalidArgument, nil
+	}
+	window := schedule.Span(req.StartDay, req.StartHour, req.StartMinute, req.EndDay, req.EndHour, req.EndMinute)
+	span := formatWeekMinutes(window.Start) + " to " + formatWeekMinutes(window.End)
+	log.Printf("Handling FreeBusy for %s", span)
+
+	t.rlock(&s.dataLock)
+	facilities := s.facilityData[req.Namespace]
+	entries := make([]common.FreeBusy, 0, len(facilities))
+	for name, fac := range facilities {
+		entries = append(entries, fac.freeBusy(name, window))
+	}
+	s.dataLock.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Facility < entries[j].Facility })
+
+	var free, busy []string
+	for _, e := range entries {
+		name := common.EscapeText(e.Facility)
+		switch e.State {
+		case common.FreeBusyFree:
+			free = append(free, name)
+		case common.FreeBusyBooked:
+			busy = append(busy, fmt.Sprintf("%s (%s)", name, e.Detail))
+		case common.FreeBusyClosed:
+			reason := common.EscapeText(e.Detail)
+			if reason == "" {
+				reason = "maintenance"
+			}
+			busy = append(busy, fmt.Sprintf("%s (closed: %s)", name, reason))
+		}
+	}
+	result := fmt.Sprintf("Free %s: %s\nBusy %s: %s\n", span, joinOrNone(free), span, joinOrNone(busy))
+
+	var ext common.Extensions
+	if raw, err := common.AppendFreeBusy(nil, entries); err != nil {
+		log.Printf("FreeBusy for %s: not listing facilities: %v", span, err)
+	} else {
+		ext.Put(common.ExtFreeBusy, raw)
+	}
+	return result, common.StatusOK, ext
+}
+
+// joinOrNone joins names with commas, or says "none".
+func joinOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
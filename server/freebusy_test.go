@@ -0,0 +1,110 @@
+// server/freebusy_test.go
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// freeBusyReq asks what is free on day from one hour to another.
+func freeBusyReq(id uint64, day, from, to uint8) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpFreeBusy, RequestID: id,
+		StartDay: day, StartHour: from, EndDay: day, EndHour: to}
+}
+
+// TestFreeBusy checks Tuesday 14:00-16:00 against a fixture with each kind
+// of facility: booked (RoomA), free (Lab1), one ending as the window starts
+// (Gym), a pool with one place left (Hall) and none (Pool), and one closed
+// by a blackout over a booking (Studio).
+func TestFreeBusy(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	facilities := srv.facilityData[common.DefaultNamespace]
+	for _, name := range []string{"Gym", "Hall", "Pool", "Studio"} {
+		facilities[name] = &FacilityInfo{Name: name}
+	}
+	facilities["Hall"].ConcurrentCapacity = 2
+	facilities["Pool"].ConcurrentCapacity = 2
+
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, bookReq(1, "Gym", 1, 12, 14)))
+	confirmationID(t, send(t, srv, p, bookReq(2, "Hall", 1, 15, 17)))
+	first := confirmationID(t, send(t, srv, p, bookReq(3, "Pool", 1, 14, 15)))
+	confirmationID(t, send(t, srv, p, bookReq(4, "Pool", 1, 14, 16)))
+	confirmationID(t, send(t, srv, p, bookReq(5, "Studio", 1, 14, 15)))
+	admin := adminSender(t, srv)
+	closure := windowReq(t, common.OpAddBlackout, 6, "Studio", "Tue 13:00", "Tue 14:30")
+	closure.Reason = "painting"
+	if rep := admin(closure); rep.Status != common.StatusOK {
+		t.Fatalf("blackout: %s", rep.Data)
+	}
+
+	rep := send(t, srv, p, freeBusyReq(7, 1, 14, 16))
+	if rep.Status != common.StatusOK {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	want := "Free Tue 14:00 to Tue 16:00: Gym, Hall, Lab1\n" +
+		"Busy Tue 14:00 to Tue 16:00: Pool (" + first + "), RoomA (BKG-10001), Studio (closed: painting)\n"
+	if rep.Data != want {
+		t.Errorf("reply:\n%s\nwant:\n%s", rep.Data, want)
+	}
+
+	entries, ok, err := common.FreeBusyOf(rep)
+	if !ok || err != nil {
+		t.Fatalf("FreeBusyOf: %v, %v", ok, err)
+	}
+	wantEntries := []common.FreeBusy{
+		{Facility: "Gym", State: common.FreeBusyFree},
+		{Facility: "Hall", State: common.FreeBusyFree},
+		{Facility: "Lab1", State: common.FreeBusyFree},
+		{Facility: "Pool", State: common.FreeBusyBooked, Detail: first},
+		{Facility: "RoomA", State: common.FreeBusyBooked, Detail: "BKG-10001"},
+		{Facility: "Studio", State: common.FreeBusyClosed, Detail: "painting"},
+	}
+	if !reflect.DeepEqual(entries, wantEntries) {
+		t.Errorf("entries %+v, want %+v", entries, wantEntries)
+	}
+}
+
+func TestFreeBusyInvalidWindow(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	for i, req := range []common.RequestMessage{
+		freeBusyReq(1, 1, 16, 14),
+		freeBusyReq(2, 7, 14, 16),
+		freeBusyReq(3, 1, 14, 25),
+	} {
+		rep := send(t, srv, p, req)
+		if rep.Status != common.StatusInvalidArgument {
+			t.Errorf("case %d: status %d: %s", i+1, rep.Status, rep.Data)
+		}
+		if _, ok, _ := common.FreeBusyOf(rep); ok {
+			t.Errorf("case %d: refusal lists facilities", i+1)
+		}
+	}
+}
+
+// BenchmarkFreeBusy checks one window against 500 facilities of 50
+// bookings each, all under one read lock.
+func BenchmarkFreeBusy(b *testing.B) {
+	srv := newTestServer(b, SemanticsAtLeastOnce)
+	facilities := srv.facilityData[common.DefaultNamespace]
+	for f := 0; f < 500; f++ {
+		fac := &FacilityInfo{Name: fmt.Sprintf("Room%03d", f), ConcurrentCapacity: 1 + f%3}
+		for i := 0; i < 50; i++ {
+			day, hour := uint8(i%7), uint8(i/7*3)
+			fac.Bookings = append(fac.Bookings, Booking{ConfirmationID: fmt.Sprintf("BKG-%d-%d", f, i),
+				StartDay: day, StartHour: hour, EndDay: day, EndHour: hour + 2})
+		}
+		facilities[fac.Name] = fac
+	}
+	packet := newFakePeer("reception").seal(b, freeBusyReq(1, 1, 14, 16))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		srv.handlePacket(packet, discardPeer{})
+	}
+}
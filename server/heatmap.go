@@ -0,0 +1,78 @@
+// server/heatmap.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// bookedPerHour returns the minutes booked in each hour of the week, as a
+// share of the facility's places: 60 means every place is taken for the
+// whole hour. A booking over several hours or days adds to every hour it
+// covers. Blackouts are closures rather than demand and do not count.
+func (f *FacilityInfo) bookedPerHour() [common.HeatmapCells]float64 {
+	var cells [common.HeatmapCells]float64
+	for _, bk := range f.Bookings {
+		iv := bk.interval()
+		for h := iv.Start / 60; h*60 < iv.End && h < common.HeatmapCells; h++ {
+			hour := schedule.Interval{Start: h * 60, End: h*60 + 60}
+			part := iv.Intersect(hour)
+			cells[h] += float64(part.End-part.Start) / float64(f.capacity())
+		}
+	}
+	return cells
+}
+
+// handleHeatmap answers booked minutes per hour of the week in
+// ExtHeatmap, for the facility named or, with none, as the mean over all
+// facilities of the request's namespace. The text names the busiest hour.
+func (s *ServerState) handleHeatmap(req common.RequestMessage, t *opTiming) (string, int32, common.Extensions) {
+	name := req.FacilityName
+	log.Printf("Handling Heatmap for facility '%s'", name)
+
+	t.rlock(&s.dataLock)
+	var sum [common.HeatmapCells]float64
+	n := 0
+	for facName, fac := range s.facilityData[req.Namespace] {
+		if name != "" && facName != name {
+			continue
+		}
+		for i, v := range fac.bookedPerHour() {
+			sum[i] += v
+		}
+		n++
+	}
+	s.dataLock.RUnlock()
+	if name != "" && n == 0 {
+		t.reject("FacilityName", name)
+		return "Error: " + s.facilityNotFound(req.Namespace, name), -1, nil
+	}
+
+	var h common.Heatmap
+	busiest := 0
+	for i, v := range sum {
+		if n > 0 {
+			h[i/24][i%24] = uint8(min(math.Round(v/float64(n)), 60))
+		}
+		if h[i/24][i%24] > h[busiest/24][busiest%24] {
+			busiest = i
+		}
+	}
+	label := "all facilities"
+	if name != "" {
+		label = "'" + common.EscapeText(name) + "'"
+	}
+	result := fmt.Sprintf("Booked minutes per hour for %s; busiest hour %s with %d minutes.",
+		label, formatWeekMinutes(int32(busiest*60)), h[busiest/24][busiest%24])
+	if h[busiest/24][busiest%24] == 0 {
+		result = fmt.Sprintf("Booked minutes per hour for %s; nothing is booked.", label)
+	}
+
+	var ext common.Extensions
+	ext.Put(common.ExtHeatmap, common.AppendHeatmap(nil, h))
+	return result, common.StatusOK, ext
+}
@@ -0,0 +1,86 @@
+// server/heatmap_test.go
+package main
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func heatmapReq(id uint64, facility string) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpHeatmap, RequestID: id, FacilityName: facility}
+}
+
+// heatmap sends a Heatmap request and returns the reply and its matrix.
+func heatmap(t *testing.T, srv *ServerState, p *fakePeer, req common.RequestMessage) (common.ReplyMessage, common.Heatmap) {
+	t.Helper()
+	rep := send(t, srv, p, req)
+	if rep.Status != common.StatusOK {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	h, ok, err := common.HeatmapOf(rep)
+	if !ok || err != nil {
+		t.Fatalf("HeatmapOf: %v, %v", ok, err)
+	}
+	return rep, h
+}
+
+// TestHeatmap adds to the seeds a RoomA booking from Friday 22:30 to
+// Saturday 01:15, and checks cells of RoomA alone and of the mean with
+// Lab1.
+func TestHeatmap(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	req := bookReq(1, "RoomA", 4, 22, 1)
+	req.StartMinute, req.EndDay, req.EndMinute = 30, 5, 15
+	confirmationID(t, send(t, srv, p, req))
+
+	type cell struct{ day, hour int }
+	rep, h := heatmap(t, srv, p, heatmapReq(2, "RoomA"))
+	for c, want := range map[cell]uint8{
+		{0, 9}: 60, {0, 8}: 0, {0, 10}: 0, // Mon 09:00-10:00
+		{1, 14}: 60, {1, 15}: 30, // Tue 14:00-15:30
+		{4, 22}: 30, {4, 23}: 60, {5, 0}: 60, {5, 1}: 15, {5, 2}: 0, // over midnight
+		{2, 10}: 0, // Lab1's booking
+	} {
+		if got := h[c.day][c.hour]; got != want {
+			t.Errorf("RoomA day %d hour %d = %d, want %d", c.day, c.hour, got, want)
+		}
+	}
+	if want := "Booked minutes per hour for 'RoomA'; busiest hour Mon 09:00 with 60 minutes."; rep.Data != want {
+		t.Errorf("reply %q, want %q", rep.Data, want)
+	}
+
+	_, h = heatmap(t, srv, p, heatmapReq(3, ""))
+	for c, want := range map[cell]uint8{{0, 9}: 30, {1, 15}: 15, {2, 10}: 30, {2, 11}: 30, {5, 1}: 8} {
+		if got := h[c.day][c.hour]; got != want {
+			t.Errorf("all facilities day %d hour %d = %d, want %d", c.day, c.hour, got, want)
+		}
+	}
+}
+
+// TestHeatmapPool: in a facility of two places, one booking fills half of
+// each hour it covers.
+func TestHeatmapPool(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.facilityData[common.DefaultNamespace]["Lab1"].ConcurrentCapacity = 2
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, bookReq(1, "Lab1", 2, 10, 11)))
+	_, h := heatmap(t, srv, p, heatmapReq(2, "Lab1"))
+	if h[2][10] != 60 || h[2][11] != 30 {
+		t.Errorf("Wed 10:00 = %d, 11:00 = %d; want 60 and 30", h[2][10], h[2][11])
+	}
+}
+
+func TestHeatmapEmptyAndUnknown(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.facilityData[common.DefaultNamespace]["Gym"] = &FacilityInfo{Name: "Gym"}
+	p := newFakePeer("client")
+	rep, h := heatmap(t, srv, p, heatmapReq(1, "Gym"))
+	if h != (common.Heatmap{}) || rep.Data != "Booked minutes per hour for 'Gym'; nothing is booked." {
+		t.Errorf("empty facility: %q, %v", rep.Data, h)
+	}
+	if rep := send(t, srv, p, heatmapReq(2, "Nowhere")); rep.Status != -1 {
+		t.Errorf("unknown facility: status %d: %s", rep.Status, rep.Data)
+	}
+}
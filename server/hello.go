@@ -0,0 +1,43 @@
+// server/hello.go
+package main
+
+import (
+	"log"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// serverVersion is reported in OpHello replies; release builds set it with
+// -ldflags "-X main.serverVersion=<version>".
+var serverVersion = "dev"
+
+// capabilities returns the optional features this server has enabled.
+func (s *ServerState) capabilities() uint8 {
+	caps := uint8(common.CapBatch | common.CapSessions)
+	if s.compressThreshold > 0 {
+		caps |= common.CapGzip
+	}
+	for sem := range s.allowedSemantics {
+		if sem != s.semantics {
+			caps |= common.CapSemanticsHint
+		}
+	}
+	return caps
+}
+
+// helloReply answers an OpHello handshake. It needs no session, timestamp
+// or history, so it is answered as soon as the request is authenticated.
+// It carries the server clock, from which the client measures skew before
+// its first timestamped request.
+func (s *ServerState) helloReply(req common.RequestMessage, clientAddr Peer) common.ReplyMessage {
+	log.Printf("Hello from %s: protocol=%d features=%v", clientAddr, req.HelloVersion,
+		common.CapabilityNames(req.HelloCapabilities))
+	rep := common.HelloReply(req.RequestID, common.HelloInfo{
+		ProtocolVersion: common.ProtocolVersion,
+		Capabilities:    s.capabilities(),
+		Semantics:       s.semantics,
+		ServerVersion:   serverVersion,
+	})
+	rep.ServerClock = s.now().UnixMilli()
+	return rep
+}
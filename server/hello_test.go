@@ -0,0 +1,77 @@
+// server/hello_test.go
+package main
+
+import (
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestHelloCapabilities(t *testing.T) {
+	base := uint8(common.CapBatch | common.CapSessions)
+	tests := []struct {
+		name     string
+		compress int
+		allowed  []string
+		want     uint8
+	}{
+		{"default", common.DefaultCompressThreshold, nil, base | common.CapGzip},
+		{"compression off", 0, nil, base},
+		{"only its own semantics", 0, []string{SemanticsAtMostOnce}, base},
+		{"hints allowed", 0, []string{SemanticsAtLeastOnce}, base | common.CapSemanticsHint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			srv.compressThreshold = tt.compress
+			srv.allowedSemantics = make(map[string]bool)
+			for _, sem := range tt.allowed {
+				srv.allowedSemantics[sem] = true
+			}
+			rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpHello, RequestID: 1, HelloVersion: common.ProtocolVersion})
+			info, err := common.ParseHello(rep)
+			if err != nil {
+				t.Fatalf("ParseHello: %v", err)
+			}
+			if info.Capabilities != tt.want {
+				t.Errorf("capabilities %v, want %v", common.CapabilityNames(info.Capabilities), common.CapabilityNames(tt.want))
+			}
+			if info.ProtocolVersion != common.ProtocolVersion || info.Semantics != SemanticsAtMostOnce || info.ServerVersion != serverVersion {
+				t.Errorf("hello = %+v", info)
+			}
+		})
+	}
+}
+
+// TestHelloFromNewerClient checks a client of a later protocol version
+// with capabilities this server doesn't know still gets this server's
+// answer, and the handshake leaves nothing in the history.
+func TestHelloFromNewerClient(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpHello, RequestID: 1, HelloVersion: 9, HelloCapabilities: 0xFF})
+	info, err := common.ParseHello(rep)
+	if err != nil {
+		t.Fatalf("ParseHello: %v", err)
+	}
+	if info.ProtocolVersion != common.ProtocolVersion {
+		t.Errorf("protocol %d, want this server's %d", info.ProtocolVersion, common.ProtocolVersion)
+	}
+	if rep.ServerClock == 0 {
+		t.Error("no server clock in the hello reply")
+	}
+	if n := srv.history.(*MemoryHistory).Len(); n != 0 {
+		t.Errorf("history holds %d entries after a hello", n)
+	}
+}
+
+// TestRequestFromOlderClient checks a request without a capability byte,
+// as a client that never sent OpHello would send, gets uncompressed replies.
+func TestRequestFromOlderClient(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.compressThreshold = 1
+	rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA"})
+	if rep.Status != common.StatusOK || rep.Flags&common.FlagCompressed != 0 {
+		t.Errorf("status %d, flags %#x", rep.Status, rep.Flags)
+	}
+}
@@ -0,0 +1,158 @@
+// server/helpers_test.go
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestMain keeps the server's per-request logging out of test output; run
+// with -v to see it.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePeer stands in for a client: it decodes and keeps everything the
+// server sends it. With security set it seals its requests and opens the
+// replies like a client started with -authKey/-encrypt would.
+type fakePeer struct {
+	name     string
+	security common.PacketSecurity
+
+	mu      sync.Mutex
+	raw     [][]byte
+	replies []common.ReplyMessage
+}
+
+func newFakePeer(name string) *fakePeer {
+	return &fakePeer{name: name}
+}
+
+func (p *fakePeer) Send(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.raw = append(p.raw, append([]byte(nil), data...))
+	body, err := p.security.Open(data)
+	if err != nil {
+		// A configuration mismatch is reported in plaintext
+		body = data
+	}
+	rep, err := common.UnmarshalReply(body)
+	if err != nil {
+		return err
+	}
+	p.replies = append(p.replies, rep)
+	return nil
+}
+
+func (p *fakePeer) String() string {
+	return p.name
+}
+
+// received returns what the peer has been sent so far.
+func (p *fakePeer) received() []common.ReplyMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]common.ReplyMessage(nil), p.replies...)
+}
+
+// callbacks returns the monitor callbacks among what the peer received.
+func (p *fakePeer) callbacks() []common.ReplyMessage {
+	var cbs []common.ReplyMessage
+	for _, rep := range p.received() {
+		if rep.OpCode == common.OpCallback {
+			cbs = append(cbs, rep)
+		}
+	}
+	return cbs
+}
+
+// newTestServer returns a server on the demo facilities of a memory store
+// with an unbounded memory history.
+func newTestServer(t testing.TB, semantics string) *ServerState {
+	t.Helper()
+	srv, err := NewServerState(semantics, NewMemoryStore(), NewMemoryHistory(0))
+	if err != nil {
+		t.Fatalf("NewServerState: %v", err)
+	}
+	return srv
+}
+
+// rawReceived returns the packets the peer has been sent so far, as sent.
+func (p *fakePeer) rawReceived() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]byte(nil), p.raw...)
+}
+
+// seal marshals req and applies the peer's security.
+func (p *fakePeer) seal(t testing.TB, req common.RequestMessage) []byte {
+	t.Helper()
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		t.Fatalf("MarshalRequest(%s): %v", common.OpName(req.OpCode), err)
+	}
+	if raw, err = p.security.Seal(raw); err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	return raw
+}
+
+// deliver hands a packet to the server as if p had sent it and returns
+// whatever p was sent in response, callbacks included.
+func deliver(s *ServerState, p *fakePeer, packet []byte) []common.ReplyMessage {
+	before := len(p.received())
+	s.handlePacket(packet, p)
+	return p.received()[before:]
+}
+
+// send delivers req to the server as a packet from p, the way the UDP
+// listener would, and returns the reply to it.
+func send(t testing.TB, s *ServerState, p *fakePeer, req common.RequestMessage) common.ReplyMessage {
+	t.Helper()
+	got := deliver(s, p, p.seal(t, req))
+	for i := len(got) - 1; i >= 0; i-- {
+		if got[i].OpCode != common.OpCallback && got[i].RequestID == req.RequestID {
+			return got[i]
+		}
+	}
+	t.Fatalf("no reply to %s RequestID %d", common.OpName(req.OpCode), req.RequestID)
+	return common.ReplyMessage{}
+}
+
+// bookReq is a BookFacility request for day from..to o'clock.
+func bookReq(id uint64, facility string, day, from, to uint8) common.RequestMessage {
+	return common.RequestMessage{
+		OpCode:       common.OpBookFacility,
+		RequestID:    id,
+		FacilityName: facility,
+		StartDay:     day,
+		StartHour:    from,
+		EndDay:       day,
+		EndHour:      to,
+	}
+}
+
+// confirmationID extracts the "ID=" of a booking reply.
+func confirmationID(t testing.TB, rep common.ReplyMessage) string {
+	t.Helper()
+	if rep.Status != common.StatusOK {
+		t.Fatalf("booking failed: status %d: %s", rep.Status, rep.Data)
+	}
+	i := strings.LastIndex(rep.Data, "ID=")
+	if i < 0 {
+		t.Fatalf("no confirmation ID in %q", rep.Data)
+	}
+	return strings.TrimSpace(rep.Data[i+len("ID="):])
+}
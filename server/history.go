@@ -0,0 +1,141 @@
+// server/history.go
+package main
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// HistoryCache stores replies for at-most-once deduplication.
+// A ttl of zero means the entry never expires.
+type HistoryCache interface {
+	Get(key RequestKey) (common.ReplyMessage, bool)
+	Put(key RequestKey, reply common.ReplyMessage, ttl time.Duration)
+}
+
+// Dedup cache backends selectable with -history
+const (
+	HistoryMemory = "memory"
+	HistoryRedis  = "redis"
+)
+
+type historyEntry struct {
+	reply     common.ReplyMessage
+	expiresAt time.Time // zero = never
+}
+
+// lruEntry is the value stored in MemoryHistory's recency list.
+type lruEntry struct {
+	key RequestKey
+	historyEntry
+}
+
+// MemoryHistory is the default in-process dedup cache. Besides the TTL it
+// can be capped at maxEntries, evicting the least recently used entry; a
+// duplicate hit counts as a use.
+type MemoryHistory struct {
+	mu         sync.Mutex
+	entries    map[RequestKey]*list.Element
+	order      *list.List // front = most recently used
+	maxEntries int        // 0 = unlimited
+	evictions  atomic.Uint64
+}
+
+// NewMemoryHistory returns an empty in-memory cache holding at most
+// maxEntries replies (0 = unlimited).
+func NewMemoryHistory(maxEntries int) *MemoryHistory {
+	return &MemoryHistory{
+		entries:    make(map[RequestKey]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+func (h *MemoryHistory) Get(key RequestKey) (common.ReplyMessage, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	el, ok := h.entries[key]
+	if !ok {
+		return common.ReplyMessage{}, false
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expiresAt.IsZero() && time.Now().After(e.expiresAt) {
+		h.remove(el)
+		return common.ReplyMessage{}, false
+	}
+	h.order.MoveToFront(el)
+	return e.reply, true
+}
+
+func (h *MemoryHistory) Put(key RequestKey, reply common.ReplyMessage, ttl time.Duration) {
+	e := &lruEntry{key: key, historyEntry: historyEntry{reply: reply}}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if el, ok := h.entries[key]; ok {
+		el.Value = e
+		h.order.MoveToFront(el)
+	} else {
+		h.entries[key] = h.order.PushFront(e)
+	}
+	for h.maxEntries > 0 && h.order.Len() > h.maxEntries {
+		h.remove(h.order.Back())
+		h.evictions.Add(1)
+	}
+}
+
+// Sweep drops expired entries and returns how many were removed.
+func (h *MemoryHistory) Sweep(now time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	removed := 0
+	for el := h.order.Back(); el != nil; {
+		prev := el.Prev()
+		if e := el.Value.(*lruEntry); !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+			h.remove(el)
+			removed++
+		}
+		el = prev
+	}
+	return removed
+}
+
+// Len returns the number of cached replies.
+func (h *MemoryHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.order.Len()
+}
+
+// Evictions returns how many entries were dropped to respect maxEntries.
+func (h *MemoryHistory) Evictions() uint64 {
+	return h.evictions.Load()
+}
+
+func (h *MemoryHistory) remove(el *list.Element) {
+	h.order.Remove(el)
+	delete(h.entries, el.Value.(*lruEntry).key)
+}
+
+// sweepHistory periodically removes expired replies from histories that
+// support it, so entries that are never looked up again do not pile up.
+func (s *ServerState) sweepHistory(interval time.Duration) {
+	sw, ok := s.history.(interface{ Sweep(time.Time) int })
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if n := sw.Sweep(now); n > 0 {
+			log.Printf("Expired %d history entries", n)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// server/history_journal.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// When a journaled history entry must be on disk (-historySync)
+const (
+	JournalSyncAll      = "all"      // every reply waits for its entry to be written and synced
+	JournalSyncMutating = "mutating" // only replies to booking changes wait
+	JournalSyncNone     = "none"     // entries are written in the background
+)
+
+// journalCompactInterval is how often the journal is compacted when
+// -historyTTL doesn't already sweep the history.
+const journalCompactInterval = 10 * time.Minute
+
+// journalRecord is one line of the history journal.
+type journalRecord struct {
+	Addr      string
+	RequestID uint64
+	Reply     common.ReplyMessage
+	ExpiresAt int64 `json:",omitempty"` // Unix milliseconds; 0 = never
+}
+
+type journalWrite struct {
+	rec     journalRecord
+	compact bool          // rewrite the file instead of appending rec
+	done    chan struct{} // closed once written and synced; nil = don't wait
+}
+
+// JournalHistory wraps another history and appends every entry to a file,
+// so requests executed before a crash are still recognised as duplicates
+// after the restart. Writes happen on one goroutine in order; Put waits for
+// the write when the sync mode requires it, which keeps the reply from
+// leaving before its entry is durable. Sweep compacts the file on the same
+// goroutine, so it never grows much beyond the live history.
+type JournalHistory struct {
+	inner    HistoryCache
+	sync     string
+	path     string
+	file     *os.File
+	appended atomic.Int64 // records written since the last compaction
+	queue    chan journalWrite
+	done     chan struct{}
+
+	mu     sync.RWMutex // held for reading while queueing, for writing by Close
+	closed bool
+}
+
+// OpenJournalHistory loads the unexpired entries of the journal at path
+// into inner, compacts the file and starts appending to it.
+func OpenJournalHistory(path string, inner HistoryCache, syncMode string) (*JournalHistory, error) {
+	switch syncMode {
+	case JournalSyncAll, JournalSyncMutating, JournalSyncNone:
+	default:
+		return nil, fmt.Errorf("unknown history sync mode %q", syncMode)
+	}
+
+	live, err := loadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, rec := range live {
+		var ttl time.Duration
+		if rec.ExpiresAt != 0 {
+			ttl = time.UnixMilli(rec.ExpiresAt).Sub(now)
+		}
+		inner.Put(RequestKey{Addr: rec.Addr, RequestID: rec.RequestID}, rec.Reply, ttl)
+	}
+
+	f, err := rewriteJournal(path, live)
+	if err != nil {
+		return nil, err
+	}
+	h := &JournalHistory{
+		inner: inner,
+		sync:  syncMode,
+		path:  path,
+		file:  f,
+		queue: make(chan journalWrite, 256),
+		done:  make(chan struct{}),
+	}
+	go h.writer()
+	log.Printf("Loaded %d history entries from %s", len(live), path)
+	return h, nil
+}
+
+// loadJournal reads the unexpired records of a journal; a missing file is
+// empty and a torn last line (crash mid-write) is ignored.
+func loadJournal(path string) ([]journalRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	live := make([]journalRecord, 0)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), common.MaxFrameSize)
+	for sc.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			log.Printf("Skipping unreadable history journal line: %v", err)
+			continue
+		}
+		if rec.ExpiresAt != 0 && now.After(time.UnixMilli(rec.ExpiresAt)) {
+			continue
+		}
+		live = append(live, rec)
+	}
+	return live, sc.Err()
+}
+
+// rewriteJournal replaces the journal at path with the records in live,
+// through a temporary file and a rename so a crash leaves either the old or
+// the new journal, and returns the new file opened for appending.
+func rewriteJournal(path string, live []journalRecord) (*os.File, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range live {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+}
+
+// compact rewrites the journal with the records that are unexpired and
+// still held by the inner history. It runs on the writer goroutine, so no
+// append can interleave with the rewrite.
+func (h *JournalHistory) compact() {
+	records, err := loadJournal(h.path)
+	if err != nil {
+		log.Printf("History journal compaction failed: %v", err)
+		return
+	}
+	live := records[:0]
+	for _, rec := range records {
+		if _, ok := h.inner.Get(RequestKey{Addr: rec.Addr, RequestID: rec.RequestID}); ok {
+			live = append(live, rec)
+		}
+	}
+	f, err := rewriteJournal(h.path, live)
+	if err != nil {
+		log.Printf("History journal compaction failed: %v", err)
+		return
+	}
+	h.file.Close()
+	h.file = f
+	h.appended.Store(0)
+	if dropped := len(records) - len(live); dropped > 0 {
+		log.Printf("Compacted history journal %s: dropped %d entries, kept %d", h.path, dropped, len(live))
+	}
+}
+
+func (h *JournalHistory) writer() {
+	defer close(h.done)
+	for w := range h.queue {
+		if w.compact {
+			h.compact()
+			continue
+		}
+		if err := json.NewEncoder(h.file).Encode(w.rec); err != nil {
+			log.Printf("History journal write failed: %v", err)
+		}
+		h.appended.Add(1)
+		if w.done != nil {
+			if err := h.file.Sync(); err != nil {
+				log.Printf("History journal sync failed: %v", err)
+			}
+			close(w.done)
+		}
+	}
+}
+
+func (h *JournalHistory) Get(key RequestKey) (common.ReplyMessage, bool) {
+	return h.inner.Get(key)
+}
+
+func (h *JournalHistory) Put(key RequestKey, reply common.ReplyMessage, ttl time.Duration) {
+	h.inner.Put(key, reply, ttl)
+
+	w := journalWrite{rec: journalRecord{Addr: key.Addr, RequestID: key.RequestID, Reply: reply}}
+	if ttl > 0 {
+		w.rec.ExpiresAt = time.Now().Add(ttl).UnixMilli()
+	}
+	if h.sync == JournalSyncAll || (h.sync == JournalSyncMutating && common.IsMutating(reply.OpCode)) {
+		w.done = make(chan struct{})
+	}
+	if !h.enqueue(w) {
+		return
+	}
+	if w.done != nil {
+		<-w.done
+	}
+}
+
+// enqueue hands w to the writer; it reports false once the journal is closed.
+func (h *JournalHistory) enqueue(w journalWrite) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return false
+	}
+	h.queue <- w
+	return true
+}
+
+// BelowWindow delegates to a windowed inner history.
+func (h *JournalHistory) BelowWindow(key RequestKey) bool {
+	if w, ok := h.inner.(windowedHistory); ok {
+		return w.BelowWindow(key)
+	}
+	return false
+}
+
+// Sweep expires entries of the inner history when it supports that and
+// then, if anything was appended since the last compaction, queues a
+// rewrite of the journal without the entries the inner history has dropped.
+func (h *JournalHistory) Sweep(now time.Time) int {
+	n := 0
+	if sw, ok := h.inner.(interface{ Sweep(time.Time) int }); ok {
+		n = sw.Sweep(now)
+	}
+	if h.appended.Load() > 0 {
+		h.enqueue(journalWrite{compact: true})
+	}
+	return n
+}
+
+// Len and Evictions delegate to the inner history when it supports them.
+
+func (h *JournalHistory) Len() int {
+	if l, ok := h.inner.(interface{ Len() int }); ok {
+		return l.Len()
+	}
+	return 0
+}
+
+func (h *JournalHistory) Evictions() uint64 {
+	if e, ok := h.inner.(interface{ Evictions() uint64 }); ok {
+		return e.Evictions()
+	}
+	return 0
+}
+
+// Close flushes pending entries and closes the journal. Entries put after
+// Close are kept in the inner history only.
+func (h *JournalHistory) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+	<-h.done
+	return h.file.Close()
+}
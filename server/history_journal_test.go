@@ -0,0 +1,176 @@
+// server/history_journal_test.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func openJournal(t *testing.T, path string, inner HistoryCache) *JournalHistory {
+	t.Helper()
+	h, err := OpenJournalHistory(path, inner, JournalSyncAll)
+	if err != nil {
+		t.Fatalf("OpenJournalHistory: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// journalLines counts the records in the journal file.
+func journalLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); n++ {
+	}
+	return n
+}
+
+// TestJournalSurvivesRestart executes an AddParticipant, restarts the
+// server from the journal and replays the request. The memory store starts
+// over from the seed data, so the replay must come from the history: run
+// again, it would add the participant to the fresh state. A logged-in
+// client is recognised by its instance even from a new address and session.
+func TestJournalSurvivesRestart(t *testing.T) {
+	tests := []struct {
+		name  string
+		login bool
+	}{
+		{"anonymous client", false},
+		{"logged-in client", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.journal")
+			req := addParticipant(100, "Ada")
+			var replies [2]common.ReplyMessage
+			var srv *ServerState
+			for run := range replies {
+				journal := openJournal(t, path, NewMemoryHistory(0))
+				var err error
+				if srv, err = NewServerState(SemanticsAtMostOnce, NewMemoryStore(), journal); err != nil {
+					t.Fatalf("NewServerState: %v", err)
+				}
+				p := newFakePeer("client")
+				if tt.login {
+					p = newFakePeer(fmt.Sprintf("client-run-%d", run))
+					rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpRegisterUser, RequestID: uint64(run + 1),
+						Username: "alice", Password: "pw", ClientInstance: "laptop"})
+					req.SessionToken, req.User = rep.Data, "alice"
+				}
+				replies[run] = send(t, srv, p, req)
+				if err := journal.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				if run == 0 && participants(srv) != "Ada" {
+					t.Fatalf("participants = %q, want Ada", participants(srv))
+				}
+			}
+			if replies[0].Status != common.StatusOK || replies[1].Data != replies[0].Data {
+				t.Errorf("replay after restart = %q, want the cached %q", replies[1].Data, replies[0].Data)
+			}
+			if got := participants(srv); got != "" {
+				t.Errorf("participants after the replay = %q, want none: the request ran again", got)
+			}
+		})
+	}
+}
+
+func TestJournalLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.journal")
+	h := openJournal(t, path, NewMemoryHistory(0))
+	h.Put(RequestKey{"a", 1}, common.ReplyMessage{RequestID: 1, Data: "kept"}, 0)
+	h.Put(RequestKey{"a", 2}, common.ReplyMessage{RequestID: 2, Data: "expires"}, 20*time.Millisecond)
+	h.Put(RequestKey{"a", 3}, common.ReplyMessage{RequestID: 3, Data: "later"}, time.Hour)
+	h.Close()
+
+	// A crash in the middle of a write leaves a torn last line
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Addr":"a","RequestID":4,"Rep`)
+	f.Close()
+	time.Sleep(30 * time.Millisecond)
+
+	inner := NewMemoryHistory(0)
+	openJournal(t, path, inner)
+	for id, want := range map[uint64]string{1: "kept", 3: "later"} {
+		if rep, ok := inner.Get(RequestKey{"a", id}); !ok || rep.Data != want {
+			t.Errorf("entry %d = %q, %v; want %q", id, rep.Data, ok, want)
+		}
+	}
+	for _, id := range []uint64{2, 4} {
+		if _, ok := inner.Get(RequestKey{"a", id}); ok {
+			t.Errorf("entry %d loaded", id)
+		}
+	}
+	// Opening compacts: the expired and torn records are gone from the file
+	if n := journalLines(t, path); n != 2 {
+		t.Errorf("journal has %d lines after opening, want 2", n)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.journal")
+	h := openJournal(t, path, NewWindowHistory(2, 0))
+	for id := uint64(1); id <= 5; id++ {
+		h.Put(RequestKey{"a", id}, common.ReplyMessage{RequestID: id}, 0)
+	}
+	if n := journalLines(t, path); n != 5 {
+		t.Fatalf("journal has %d lines, want 5", n)
+	}
+	h.Sweep(time.Now())
+	h.Close() // waits for the queued compaction
+	if n := journalLines(t, path); n != 2 {
+		t.Errorf("journal has %d lines after compaction, want the 2 in the window", n)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestJournalClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.journal")
+	inner := NewMemoryHistory(0)
+	h := openJournal(t, path, inner)
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	// After Close entries still reach the inner history, but not the file
+	h.Put(RequestKey{"a", 1}, common.ReplyMessage{RequestID: 1, OpCode: common.OpBookFacility}, 0)
+	if _, ok := inner.Get(RequestKey{"a", 1}); !ok {
+		t.Error("entry put after Close is not in the inner history")
+	}
+	if n := journalLines(t, path); n != 0 {
+		t.Errorf("journal has %d lines", n)
+	}
+}
+
+func TestJournalSyncModes(t *testing.T) {
+	dir := t.TempDir()
+	for _, mode := range []string{JournalSyncAll, JournalSyncMutating, JournalSyncNone} {
+		h, err := OpenJournalHistory(filepath.Join(dir, mode), NewMemoryHistory(0), mode)
+		if err != nil {
+			t.Errorf("mode %s: %v", mode, err)
+			continue
+		}
+		h.Close()
+	}
+	if _, err := OpenJournalHistory(filepath.Join(dir, "bad"), NewMemoryHistory(0), "sometimes"); err == nil {
+		t.Error("unknown sync mode accepted")
+	}
+}
@@ -0,0 +1,110 @@
+// server/history_test.go
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// has reports which of ids are in h, as a string like "1 3".
+func has(h *MemoryHistory, ids ...uint64) string {
+	var got string
+	for _, id := range ids {
+		if _, ok := h.Get(RequestKey{"client", id}); ok {
+			got += fmt.Sprint(" ", id)
+		}
+	}
+	if got == "" {
+		return got
+	}
+	return got[1:]
+}
+
+func putID(h *MemoryHistory, id uint64, ttl time.Duration) {
+	h.Put(RequestKey{"client", id}, common.ReplyMessage{RequestID: id}, ttl)
+}
+
+func TestHistoryCap(t *testing.T) {
+	h := NewMemoryHistory(3)
+	for id := uint64(1); id <= 5; id++ {
+		putID(h, id, 0)
+	}
+	if h.Len() != 3 || h.Evictions() != 2 {
+		t.Errorf("Len() = %d, Evictions() = %d; want 3 and 2", h.Len(), h.Evictions())
+	}
+	if got := has(h, 1, 2, 3, 4, 5); got != "3 4 5" {
+		t.Errorf("kept %q, want the newest: 3 4 5", got)
+	}
+}
+
+func TestHistoryHitRefreshesRecency(t *testing.T) {
+	h := NewMemoryHistory(3)
+	for id := uint64(1); id <= 3; id++ {
+		putID(h, id, 0)
+	}
+	h.Get(RequestKey{"client", 1}) // a duplicate of the oldest arrives
+	putID(h, 4, 0)
+	putID(h, 5, 0)
+	if got := has(h, 1, 2, 3, 4, 5); got != "1 4 5" {
+		t.Errorf("kept %q, want 1 4 5: the hit on 1 made 2 and 3 the oldest", got)
+	}
+}
+
+func TestHistoryPutReplaces(t *testing.T) {
+	h := NewMemoryHistory(2)
+	putID(h, 1, 0)
+	putID(h, 2, 0)
+	putID(h, 1, 0)
+	if h.Len() != 2 || h.Evictions() != 0 {
+		t.Errorf("Len() = %d, Evictions() = %d; want 2 and 0", h.Len(), h.Evictions())
+	}
+	putID(h, 3, 0)
+	if got := has(h, 1, 2, 3); got != "1 3" {
+		t.Errorf("kept %q, want 1 3", got)
+	}
+}
+
+func TestHistoryUnlimited(t *testing.T) {
+	h := NewMemoryHistory(0)
+	for id := uint64(1); id <= 1000; id++ {
+		putID(h, id, 0)
+	}
+	if h.Len() != 1000 || h.Evictions() != 0 {
+		t.Errorf("Len() = %d, Evictions() = %d; want 1000 and 0", h.Len(), h.Evictions())
+	}
+}
+
+// TestHistorySweepWithCap checks the TTL sweeper and the cap share one
+// bookkeeping: swept entries free room without counting as evictions.
+func TestHistorySweepWithCap(t *testing.T) {
+	h := NewMemoryHistory(3)
+	putID(h, 1, time.Millisecond)
+	putID(h, 2, 0)
+	putID(h, 3, time.Millisecond)
+	if n := h.Sweep(time.Now().Add(time.Second)); n != 2 {
+		t.Fatalf("Sweep removed %d, want 2", n)
+	}
+	putID(h, 4, 0)
+	putID(h, 5, 0)
+	if h.Len() != 3 || h.Evictions() != 0 {
+		t.Errorf("Len() = %d, Evictions() = %d; want 3 and 0", h.Len(), h.Evictions())
+	}
+	if got := has(h, 2, 4, 5); got != "2 4 5" {
+		t.Errorf("kept %q, want 2 4 5", got)
+	}
+}
+
+func TestHistoryExpiredOnGet(t *testing.T) {
+	h := NewMemoryHistory(0)
+	putID(h, 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if got := has(h, 1); got != "" {
+		t.Error("expired entry returned")
+	}
+	if h.Len() != 0 {
+		t.Errorf("Len() = %d after the expired lookup, want 0", h.Len())
+	}
+}
@@ -0,0 +1,118 @@
+// server/idempotency.go
+package main
+
+import (
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// defaultIdempotencyWindow is how long a booking's idempotency key is
+// remembered by default.
+const defaultIdempotencyWindow = 10 * time.Minute
+
+// keyedBooking is what an idempotency key maps to: the booking it created,
+// to recognise a different booking reusing the key, and the reply to send
+// again.
+type keyedBooking struct {
+	ConfirmationID string
+	Facility       string // qualified name
+	Start          int32
+	End            int32
+	Reply          string
+	ExpiresAt      time.Time
+}
+
+// idempotencyKeys remembers which booking each idempotency key created, so
+// a repeated BookFacility returns the original confirmation instead of a
+// second booking, whatever the invocation semantics. It is guarded by
+// dataLock, so the check and the booking happen as one step.
+type idempotencyKeys struct {
+	window  time.Duration           // 0 disables the keys
+	entries map[string]keyedBooking // by key, qualified by namespace
+}
+
+func newIdempotencyKeys(window time.Duration) *idempotencyKeys {
+	return &idempotencyKeys{window: window, entries: make(map[string]keyedBooking)}
+}
+
+// lookup returns the booking a key created within the window.
+func (k *idempotencyKeys) lookup(key string, now time.Time) (keyedBooking, bool) {
+	if k.window <= 0 || key == "" {
+		return keyedBooking{}, false
+	}
+	kb, ok := k.entries[key]
+	if !ok || now.After(kb.ExpiresAt) {
+		return keyedBooking{}, false
+	}
+	return kb, true
+}
+
+// remember records the booking a key created and forgets expired keys.
+func (k *idempotencyKeys) remember(key string, kb keyedBooking, now time.Time) {
+	if k.window <= 0 || key == "" {
+		return
+	}
+	for old, e := range k.entries {
+		if now.After(e.ExpiresAt) {
+			delete(k.entries, old)
+		}
+	}
+	kb.ExpiresAt = now.Add(k.window)
+	k.entries[key] = kb
+}
+
+// renameFacility points the keys of a facility's bookings at its new name,
+// so a retried booking is still recognised as the same one.
+func (k *idempotencyKeys) renameFacility(oldName, newName string) {
+	for key, kb := range k.entries {
+		if kb.Facility == oldName {
+			kb.Facility = newName
+			k.entries[key] = kb
+		}
+	}
+}
+
+// forget drops the keys of bookings that were removed, so a retry books
+// again rather than confirming a booking that no longer exists.
+func (k *idempotencyKeys) forget(removed []Booking) {
+	if len(removed) == 0 {
+		return
+	}
+	ids := make(map[string]bool, len(removed))
+	for _, bk := range removed {
+		ids[bk.ConfirmationID] = true
+	}
+	for key, kb := range k.entries {
+		if ids[kb.ConfirmationID] {
+			delete(k.entries, key)
+		}
+	}
+}
+
+// idempotencyKey is the key of a BookFacility, qualified by its namespace,
+// or "" if it has none.
+func idempotencyKey(req common.RequestMessage) string {
+	if req.IdempotencyKey == "" {
+		return ""
+	}
+	return qualify(req.Namespace, req.IdempotencyKey)
+}
+
+// repeatedBooking answers a BookFacility whose idempotency key already
+// created a booking: the original reply if the request is the same, a
+// refusal if the key was reused for a different booking. ok is false for a
+// new key. The caller holds dataLock.
+func (s *ServerState) repeatedBooking(req common.RequestMessage) (msg string, status int32, ok bool) {
+	kb, ok := s.idempotency.lookup(idempotencyKey(req), s.now())
+	if !ok {
+		return "", 0, false
+	}
+	start := schedule.ToMinutes(req.StartDay, req.StartHour, req.StartMinute)
+	end := schedule.ToMinutes(req.EndDay, req.EndHour, req.EndMinute)
+	if kb.Facility != qualify(req.Namespace, req.FacilityName) || kb.Start != start || kb.End != end {
+		return "Error: the idempotency key was already used for a different booking.", common.StatusInvalidArgument, true
+	}
+	return kb.Reply, 0, true
+}
@@ -0,0 +1,86 @@
+// server/idempotency_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestIdempotentRetry replays a booking the way a client retry does under
+// at-least-once: RoomA takes two overlapping bookings, so without a key the
+// replay books the requester twice.
+func TestIdempotentRetry(t *testing.T) {
+	tests := []struct {
+		key      string
+		bookings int // added by the two sends
+	}{
+		{"", 2},
+		{"key-1", 1},
+	}
+	for _, tt := range tests {
+		t.Run("key="+tt.key, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtLeastOnce)
+			srv.facilityData[common.DefaultNamespace]["RoomA"].ConcurrentCapacity = 2
+			before := bookingCount(srv)
+			p := newFakePeer("client")
+			req := bookReq(1, "RoomA", 3, 9, 10)
+			req.IdempotencyKey = tt.key
+
+			first := confirmationID(t, send(t, srv, p, req))
+			second := confirmationID(t, send(t, srv, p, req))
+			if n := bookingCount(srv) - before; n != tt.bookings {
+				t.Errorf("%d bookings made, want %d", n, tt.bookings)
+			}
+			if same := first == second; same != (tt.key != "") {
+				t.Errorf("replies confirm %s and %s", first, second)
+			}
+		})
+	}
+}
+
+// TestIdempotencyKeyScope: a key answers only the booking it made, and only
+// within the window; a new RequestID does not hide a repeat.
+func TestIdempotencyKeyScope(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+	req := bookReq(1, "RoomA", 3, 9, 10)
+	req.IdempotencyKey = "key-1"
+	id := confirmationID(t, send(t, srv, p, req))
+
+	req.RequestID = 2
+	if got := confirmationID(t, send(t, srv, p, req)); got != id {
+		t.Errorf("repeat under a new RequestID confirmed %s, want %s", got, id)
+	}
+
+	other := bookReq(3, "RoomA", 4, 9, 10)
+	other.IdempotencyKey = "key-1"
+	if rep := send(t, srv, p, other); rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, "different booking") {
+		t.Errorf("key reused for another booking: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// Past the window on the server clock the key is forgotten: the
+	// request is a new booking, which now conflicts with the first
+	srv.clockOffset = defaultIdempotencyWindow + time.Minute
+	req.RequestID = 4
+	if rep := send(t, srv, p, req); rep.Status == common.StatusOK {
+		t.Errorf("expired key still answered: %s", rep.Data)
+	}
+}
+
+func TestIdempotencyDisabled(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.idempotency = newIdempotencyKeys(0)
+	srv.facilityData[common.DefaultNamespace]["RoomA"].ConcurrentCapacity = 2
+	before := bookingCount(srv)
+	p := newFakePeer("client")
+	req := bookReq(1, "RoomA", 3, 9, 10)
+	req.IdempotencyKey = "key-1"
+	send(t, srv, p, req)
+	send(t, srv, p, req)
+	if n := bookingCount(srv) - before; n != 2 {
+		t.Errorf("%d bookings with the window off, want 2", n)
+	}
+}
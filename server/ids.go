@@ -0,0 +1,71 @@
+// server/ids.go
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Values of -idFormat.
+const (
+	IDFormatLegacy = "legacy" // "BKG-<nanoseconds>", increasing
+	IDFormatUUID   = "uuid"   // random RFC 4122 version 4 UUIDs
+)
+
+// IDGenerator returns a new confirmation ID. It must be safe for concurrent
+// use and never return the same ID twice.
+type IDGenerator func() string
+
+// newIDGenerator returns the generator for an -idFormat value, after
+// checking that its IDs fit common.MaxConfirmationIDLen.
+func newIDGenerator(format string) (IDGenerator, error) {
+	var gen IDGenerator
+	switch format {
+	case IDFormatLegacy:
+		gen = legacyID
+	case IDFormatUUID:
+		gen = uuidV4
+	default:
+		return nil, fmt.Errorf("unknown format %q (choose %q or %q)", format, IDFormatLegacy, IDFormatUUID)
+	}
+	if n := len(gen()); n > common.MaxConfirmationIDLen {
+		return nil, fmt.Errorf("%s IDs are %d bytes, longer than the %d-byte limit", format, n, common.MaxConfirmationIDLen)
+	}
+	return gen, nil
+}
+
+// lastLegacyID is the number of the latest legacy ID.
+var lastLegacyID atomic.Int64
+
+// legacyID keeps the original "BKG-<nanoseconds>" format, but bumps the
+// number past the previous one, so two bookings made within the same clock
+// tick no longer get the same ID.
+func legacyID() string {
+	for {
+		last := lastLegacyID.Load()
+		n := time.Now().UnixNano()
+		if n <= last {
+			n = last + 1
+		}
+		if lastLegacyID.CompareAndSwap(last, n) {
+			return fmt.Sprintf("BKG-%d", n)
+		}
+	}
+}
+
+// uuidV4 returns a random UUID such as
+// "0b6f4d0e-8f1a-4c3e-9a57-3d2b1f0e6c42". Its 122 random bits make IDs
+// unique without coordination and impossible to guess from one another.
+func uuidV4() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("reading random bytes for a booking ID: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,79 @@
+// server/ids_test.go
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+var idFormats = map[string]*regexp.Regexp{
+	IDFormatLegacy: regexp.MustCompile(`^BKG-[0-9]+$`),
+	IDFormatUUID:   regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+}
+
+// TestIDGenerators checks the shape of each format's IDs and that many
+// goroutines generating at once never get the same one.
+func TestIDGenerators(t *testing.T) {
+	for format, shape := range idFormats {
+		t.Run(format, func(t *testing.T) {
+			gen, err := newIDGenerator(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const workers, each = 16, 500
+			ids := make(chan string, workers*each)
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < each; i++ {
+						ids <- gen()
+					}
+				}()
+			}
+			wg.Wait()
+			close(ids)
+
+			seen := make(map[string]bool)
+			for id := range ids {
+				if !shape.MatchString(id) || len(id) > common.MaxConfirmationIDLen {
+					t.Fatalf("ID %q does not have the %s format", id, format)
+				}
+				if seen[id] {
+					t.Fatalf("ID %q generated twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestIDGeneratorUnknown(t *testing.T) {
+	if _, err := newIDGenerator("serial"); err == nil || !strings.Contains(err.Error(), `unknown format "serial"`) {
+		t.Errorf("newIDGenerator(serial): %v", err)
+	}
+}
+
+// TestUUIDBookings books and cancels with UUID confirmation IDs: lookups
+// treat them like any other ID.
+func TestUUIDBookings(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.newID = uuidV4
+	p := newFakePeer("client")
+	id := confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 3, 9, 10)))
+	if !idFormats[IDFormatUUID].MatchString(id) {
+		t.Fatalf("booking ID %q is not a UUID", id)
+	}
+	if start, _ := bookingInterval(t, srv, id); start != 3*1440+9*60 {
+		t.Errorf("booking %s starts at minute %d", id, start)
+	}
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 2, ConfirmationID: id})
+	if rep.Status != common.StatusOK || !strings.Contains(rep.Data, id) {
+		t.Errorf("cancel: status %d: %s", rep.Status, rep.Data)
+	}
+}
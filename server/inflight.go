@@ -0,0 +1,87 @@
+// server/inflight.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// How duplicates of a request that is still executing are handled (-inflight)
+const (
+	InflightWait = "wait" // block until the original finishes, then send its reply
+	InflightDrop = "drop" // ignore; the client's next retransmission hits the history
+)
+
+// inflightCall tracks one executing at-most-once request. done is closed
+// when the handler returns; reply is only valid if ok is set, which is not
+// the case when the handler panicked.
+type inflightCall struct {
+	done  chan struct{}
+	reply common.ReplyMessage
+	ok    bool
+}
+
+// beginInflight registers key as executing. It returns the existing call
+// and false if another handler already owns the key.
+func (s *ServerState) beginInflight(key RequestKey) (*inflightCall, bool) {
+	s.inflightLock.Lock()
+	defer s.inflightLock.Unlock()
+	if call, ok := s.inflight[key]; ok {
+		return call, false
+	}
+	call := &inflightCall{done: make(chan struct{})}
+	s.inflight[key] = call
+	return call, true
+}
+
+// endInflight releases waiting duplicates. It is deferred by the owning
+// handler so the entry is removed even if processing panics; by then a
+// successful reply is already in the history.
+func (s *ServerState) endInflight(key RequestKey, call *inflightCall) {
+	s.inflightLock.Lock()
+	delete(s.inflight, key)
+	s.inflightLock.Unlock()
+	close(call.done)
+}
+
+// awaitInflight handles a duplicate that arrived while the original request
+// was still executing. It returns false if the duplicate is dropped.
+func (s *ServerState) awaitInflight(key RequestKey, call *inflightCall, clientAddr Peer) (common.ReplyMessage, bool) {
+	if s.inflightPolicy == InflightDrop {
+		log.Printf("Duplicate request %d from %s is still executing -> dropped", key.RequestID, clientAddr)
+		return common.ReplyMessage{}, false
+	}
+	log.Printf("Duplicate request %d from %s is still executing -> waiting for its reply", key.RequestID, clientAddr)
+	<-call.done
+	if !call.ok {
+		// The owner found the reply in the history, or panicked
+		return s.cachedReply(key, clientAddr)
+	}
+	metricFromHistory.Add(opKey(call.reply.OpCode), 1)
+	return call.reply, true
+}
+
+// recoverPacket keeps a panicking handler from taking down the server. It
+// logs the panic with the request being handled and answers StatusInternal
+// from the packet's cleartext header, so the client stops retrying a
+// request that would crash again. The panic unwound execute before it
+// stored a reply, so nothing half-built is in the history; waiting
+// duplicates are released unanswered and a resend runs afresh.
+func (s *ServerState) recoverPacket(data []byte, clientAddr Peer, req *common.RequestMessage) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	s.panics.Add(1)
+	summary := "packet"
+	if req.RequestID != 0 {
+		summary = fmt.Sprintf("%s RequestID=%d facility=%q id=%q",
+			common.OpName(req.OpCode), req.RequestID, req.FacilityName, req.ConfirmationID)
+	}
+	log.Printf("Panic while handling %s from %s: %v\n%s", summary, clientAddr, r, debug.Stack())
+	s.replyToHeader(data, clientAddr, common.StatusInternal,
+		"Internal server error while handling this request; it may or may not have taken effect")
+}
@@ -0,0 +1,131 @@
+// server/inflight_test.go
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// hookStore is a memory store that runs save whenever a booking is
+// saved, to make a handler slow or fail at a known point.
+type hookStore struct {
+	Store
+	save func(facility string, bk Booking)
+}
+
+func (h *hookStore) SaveBooking(facility string, bk Booking) error {
+	if h.save != nil {
+		h.save(facility, bk)
+	}
+	return h.Store.SaveBooking(facility, bk)
+}
+
+// newHookServer returns a server on the demo facilities whose booking saves
+// run save first.
+func newHookServer(t testing.TB, semantics string, save func(string, Booking)) *ServerState {
+	t.Helper()
+	srv, err := NewServerState(semantics, &hookStore{Store: NewMemoryStore(), save: save}, NewMemoryHistory(0))
+	if err != nil {
+		t.Fatalf("NewServerState: %v", err)
+	}
+	return srv
+}
+
+// slowSaves returns a save hook that blocks the first save until release
+// is closed, after closing entered, and counts every save.
+func slowSaves(entered, release chan struct{}, saves *atomic.Int32) func(string, Booking) {
+	return func(string, Booking) {
+		if saves.Add(1) == 1 {
+			close(entered)
+			<-release
+		}
+	}
+}
+
+// TestConcurrentDuplicateRunsOnce sends a booking whose handler is held
+// up in the store and, while it runs, the same request again. Under
+// at-most-once the duplicate waits and gets the original's reply; the
+// booking is made once.
+func TestConcurrentDuplicateRunsOnce(t *testing.T) {
+	for _, policy := range []string{InflightWait, InflightDrop} {
+		t.Run(policy, func(t *testing.T) {
+			entered, release := make(chan struct{}), make(chan struct{})
+			var saves atomic.Int32
+			srv := newHookServer(t, SemanticsAtMostOnce, slowSaves(entered, release, &saves))
+			srv.inflightPolicy = policy
+
+			// Two peers with one address: the original and its retransmission
+			first, dup := newFakePeer("client"), newFakePeer("client")
+			raw := first.seal(t, bookReq(1, "RoomA", 3, 9, 10))
+
+			original := make(chan []common.ReplyMessage)
+			go func() { original <- deliver(srv, first, raw) }()
+			<-entered
+
+			duplicate := make(chan []common.ReplyMessage)
+			go func() { duplicate <- deliver(srv, dup, raw) }()
+			select {
+			case got := <-duplicate:
+				if policy == InflightWait {
+					t.Fatalf("duplicate answered while the original was running: %+v", got)
+				}
+				if len(got) != 0 {
+					t.Fatalf("dropped duplicate got %d replies", len(got))
+				}
+			case <-time.After(50 * time.Millisecond):
+				if policy == InflightDrop {
+					t.Fatal("dropped duplicate still blocked")
+				}
+			}
+			close(release)
+
+			want := <-original
+			if len(want) != 1 {
+				t.Fatalf("original got %d replies", len(want))
+			}
+			id := confirmationID(t, want[0])
+			if policy == InflightWait {
+				got := <-duplicate
+				if len(got) != 1 || got[0].Data != want[0].Data {
+					t.Errorf("duplicate got %+v, want the original's %q", got, want[0].Data)
+				}
+			}
+			if n := saves.Load(); n != 1 {
+				t.Errorf("booking saved %d times, want once", n)
+			}
+
+			// A later retransmission is served from the history
+			if rep := send(t, srv, dup, bookReq(1, "RoomA", 3, 9, 10)); confirmationID(t, rep) != id {
+				t.Errorf("late retransmission got %q", rep.Data)
+			}
+			if n := saves.Load(); n != 1 {
+				t.Errorf("booking saved %d times after the retransmission", n)
+			}
+		})
+	}
+}
+
+// TestConcurrentDuplicateAtLeastOnce: without at-most-once nothing is
+// held back; the duplicate runs too, and conflicts with the original.
+func TestConcurrentDuplicateAtLeastOnce(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var saves atomic.Int32
+	srv := newHookServer(t, SemanticsAtLeastOnce, slowSaves(entered, release, &saves))
+	first, dup := newFakePeer("client"), newFakePeer("client")
+	raw := first.seal(t, bookReq(1, "RoomA", 3, 9, 10))
+
+	original := make(chan []common.ReplyMessage)
+	go func() { original <- deliver(srv, first, raw) }()
+	<-entered
+	duplicate := make(chan []common.ReplyMessage)
+	go func() { duplicate <- deliver(srv, dup, raw) }()
+	close(release)
+
+	confirmationID(t, (<-original)[0])
+	if got := <-duplicate; len(got) != 1 || got[0].Status != common.StatusConflict {
+		t.Errorf("re-executed duplicate got %+v, want a conflict with the original", got)
+	}
+}
@@ -0,0 +1,63 @@
+// server/info.go
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// serverInfo reports the semantics, version and limits the server runs
+// with, for clients and test harnesses that must match their behaviour to
+// it.
+func (s *ServerState) serverInfo() common.ServerInfo {
+	info := common.ServerInfo{
+		Semantics:        s.semantics,
+		Role:             s.role,
+		Uptime:           time.Since(s.started).Round(time.Second),
+		ProtocolVersion:  common.ProtocolVersion,
+		ServerVersion:    serverVersion,
+		HistoryTTL:       s.historyTTL,
+		MaxRequestSize:   s.maxRequestSize,
+		MaxMonitorPeriod: s.maxMonitorPeriod,
+		MaxSkew:          s.maxSkew,
+		MaxInFlight:      int(s.overload.maxInFlight),
+		MaxLockQueue:     int(s.overload.maxLockQueue),
+		BusyRetryAfter:   s.overload.retryAfter,
+		SessionIdle:      s.sessionIdle,
+	}
+	// The start in server time, which -clockOffset may shift
+	info.Started = s.now().Add(-time.Since(s.started)).Round(time.Second)
+	for sem := range s.allowedSemantics {
+		if sem != s.semantics {
+			info.AllowedSemantics = append(info.AllowedSemantics, sem)
+		}
+	}
+	sort.Strings(info.AllowedSemantics)
+	if s.abuse != nil {
+		info.AbuseThreshold = s.abuse.threshold
+		info.AbuseWindow = s.abuse.window
+	}
+	s.dataLock.RLock()
+	info.Namespaces = len(s.facilityData)
+	for _, facilities := range s.facilityData {
+		info.Facilities += len(facilities)
+	}
+	s.dataLock.RUnlock()
+	return info
+}
+
+// serverInfoReply answers OpGetServerInfo. Like OpHello it needs no
+// session, timestamp or history: the answer describes the server rather
+// than changing it, and a retry should see the current uptime.
+func (s *ServerState) serverInfoReply(req common.RequestMessage, clientAddr Peer) common.ReplyMessage {
+	log.Printf("Server info requested by %s", clientAddr)
+	return common.ReplyMessage{
+		RequestID: req.RequestID,
+		OpCode:    common.OpGetServerInfo,
+		Status:    common.StatusOK,
+		Data:      common.FormatServerInfo(s.serverInfo()),
+	}
+}
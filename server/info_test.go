@@ -0,0 +1,110 @@
+// server/info_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// getInfo asks srv for its info and decodes the reply.
+func getInfo(t *testing.T, srv *ServerState, id uint64) common.ServerInfo {
+	t.Helper()
+	rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpGetServerInfo, RequestID: id})
+	if rep.Status != common.StatusOK || rep.OpCode != common.OpGetServerInfo {
+		t.Fatalf("server info: op %d status %d: %s", rep.OpCode, rep.Status, rep.Data)
+	}
+	info, err := common.ParseServerInfo(rep.Data)
+	if err != nil {
+		t.Fatalf("ParseServerInfo: %v in\n%s", err, rep.Data)
+	}
+	return info
+}
+
+func TestServerInfoDefaults(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	info := getInfo(t, srv, 1)
+	want := common.ServerInfo{
+		Semantics:        SemanticsAtMostOnce,
+		Role:             RolePrimary,
+		ProtocolVersion:  common.ProtocolVersion,
+		ServerVersion:    serverVersion,
+		Facilities:       2,
+		Namespaces:       1,
+		MaxRequestSize:   common.DefaultMaxRequestSize,
+		MaxMonitorPeriod: defaultMaxMonitorPeriod,
+		BusyRetryAfter:   defaultBusyRetryAfter,
+	}
+	info.Started, info.Uptime = time.Time{}, 0
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("info\n%+v\nwant\n%+v", info, want)
+	}
+}
+
+// TestServerInfoReflectsFlags sets the state the server flags set and
+// checks the reply reports each of them.
+func TestServerInfoReflectsFlags(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.allowedSemantics = map[string]bool{SemanticsAtLeastOnce: true, SemanticsAtMostOnce: true}
+	srv.historyTTL = 10 * time.Minute
+	srv.maxRequestSize = 2048
+	srv.maxMonitorPeriod = time.Hour
+	srv.maxSkew = 30 * time.Second
+	srv.overload = overloadLimits{maxInFlight: 64, maxLockQueue: 16, retryAfter: 2 * time.Second}
+	srv.abuse = newAbuseTracker(5, time.Minute, time.Hour)
+	srv.sessionIdle = 15 * time.Minute
+	srv.started = time.Now().Add(-90 * time.Minute)
+	srv.clockOffset = time.Hour
+
+	info := getInfo(t, srv, 1)
+	want := common.ServerInfo{
+		Semantics:        SemanticsAtLeastOnce,
+		AllowedSemantics: []string{SemanticsAtMostOnce},
+		Role:             RolePrimary,
+		Uptime:           90 * time.Minute,
+		ProtocolVersion:  common.ProtocolVersion,
+		ServerVersion:    serverVersion,
+		Facilities:       2,
+		Namespaces:       1,
+		HistoryTTL:       10 * time.Minute,
+		MaxRequestSize:   2048,
+		MaxMonitorPeriod: time.Hour,
+		MaxSkew:          30 * time.Second,
+		MaxInFlight:      64,
+		MaxLockQueue:     16,
+		BusyRetryAfter:   2 * time.Second,
+		AbuseThreshold:   5,
+		AbuseWindow:      time.Minute,
+		SessionIdle:      15 * time.Minute,
+	}
+	// The start is reported in server time
+	started := info.Started
+	info.Started = time.Time{}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("info\n%+v\nwant\n%+v", info, want)
+	}
+	if d := started.Sub(time.Now().Add(-30 * time.Minute)); d < -2*time.Second || d > 2*time.Second {
+		t.Errorf("started %v, want 30 minutes ago shifted by the hour's offset", started)
+	}
+}
+
+// TestServerInfoUncached: the info is answered outside the history and the
+// timestamp window, so a retry sees the current facility count.
+func TestServerInfoUncached(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.maxSkew = time.Second
+	if got := getInfo(t, srv, 1).Facilities; got != 2 {
+		t.Fatalf("%d facilities", got)
+	}
+	srv.dataLock.Lock()
+	srv.facilityData["physics"] = map[string]*FacilityInfo{"Lab1": {Name: "Lab1"}, "Lab2": {Name: "Lab2"}}
+	srv.dataLock.Unlock()
+	if info := getInfo(t, srv, 1); info.Facilities != 4 || info.Namespaces != 2 {
+		t.Errorf("retry reports %d facilities in %d namespaces, want 4 in 2", info.Facilities, info.Namespaces)
+	}
+	if n := srv.history.(*MemoryHistory).Len(); n != 0 {
+		t.Errorf("history holds %d entries", n)
+	}
+}
@@ -0,0 +1,61 @@
+// server/keepalive.go
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// defaultKeepalive is the default for -keepalive: below the 30 seconds after
+// which many NATs forget an idle UDP mapping.
+const defaultKeepalive = 25 * time.Second
+
+// keepaliveCallback is the empty callback sent to a subscriber. It has no
+// sequence number and is not buffered, so clients never mistake a lost
+// keepalive for a lost update and resends never replay one.
+func keepaliveCallback(facility string) common.ReplyMessage {
+	cb := common.ReplyMessage{
+		OpCode: common.OpCallback,
+		Status: common.StatusOK,
+	}
+	cb.Extensions.PutString(common.ExtCallbackFacility, facility)
+	cb.Extensions.Put(common.ExtCallbackEvent, []byte{common.EventKeepalive})
+	return cb
+}
+
+// sendKeepalives sends a keepalive to every active subscriber each interval.
+func (s *ServerState) sendKeepalives(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.keepaliveTick(s.now())
+	}
+}
+
+// keepaliveTick sends one round of keepalives to the subscriptions that are
+// still active at now and returns how many were sent. Expired subscriptions
+// get none; notifySubscribers drops them.
+func (s *ServerState) keepaliveTick(now time.Time) int {
+	s.monitorLock.Lock()
+	defer s.monitorLock.Unlock()
+
+	sent := 0
+	for i := range s.monitorSubs {
+		sub := &s.monitorSubs[i]
+		if !now.Before(sub.ExpiresAt) {
+			continue
+		}
+		raw, err := s.encodeReply(keepaliveCallback(sub.FacilityName))
+		if err != nil {
+			log.Printf("Error marshalling keepalive: %v", err)
+			return sent
+		}
+		if sub.deliver(raw) {
+			sent++
+		}
+	}
+	s.keepalivesSent.Add(uint64(sent))
+	return sent
+}
@@ -0,0 +1,70 @@
+// server/keepalive_test.go
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestKeepaliveCadence steps a fake clock through a one-minute
+// subscription in keepalive intervals: one keepalive per tick while it is
+// active, none once it expires.
+func TestKeepaliveCadence(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	start := srv.now()
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+
+	want := []int{1, 1, 0, 0} // at 25s, 50s, 75s and 100s
+	for i, n := range want {
+		now := start.Add(time.Duration(i+1) * defaultKeepalive)
+		if got := srv.keepaliveTick(now); got != n {
+			t.Errorf("tick at %v sent %d keepalives, want %d", now.Sub(start), got, n)
+		}
+	}
+	cbs := watcher.callbacks()
+	if len(cbs) != 2 {
+		t.Fatalf("watcher got %d callbacks, want 2 keepalives", len(cbs))
+	}
+	for _, cb := range cbs {
+		if !common.IsKeepalive(cb) {
+			t.Errorf("callback %q is not a keepalive", cb.Data)
+		}
+		if _, _, ok := common.CallbackSeq(cb); ok {
+			t.Error("keepalive carries a sequence number")
+		}
+	}
+	if n := srv.keepalivesSent.Load(); n != 2 {
+		t.Errorf("keepalivesSent = %d, want 2", n)
+	}
+}
+
+// TestKeepaliveLeavesSequence: keepalives are neither numbered nor kept
+// for resends, so the first update is still callback 1.
+func TestKeepaliveLeavesSequence(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	srv.keepaliveTick(srv.now())
+	srv.keepaliveTick(srv.now())
+	send(t, srv, newFakePeer("client"), addParticipant(2, "Ada"))
+
+	if got := seqs(watcher); len(got) != 3 || got[2] != 1 {
+		t.Fatalf("sequence numbers %v, want two keepalives then 1", got)
+	}
+	resent := deliver(srv, watcher, watcher.seal(t, common.RequestMessage{OpCode: common.OpResendCallbacks, RequestID: 3, FacilityName: "RoomA"}))
+	replayed := 0
+	for _, rep := range resent {
+		if common.IsKeepalive(rep) {
+			t.Error("resend replayed a keepalive")
+		}
+		if rep.OpCode == common.OpCallback {
+			replayed++
+		}
+	}
+	if replayed != 1 {
+		t.Errorf("resend replayed %d callbacks, want the update only", replayed)
+	}
+}
@@ -0,0 +1,105 @@
+// server/list_test.go
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// bookQuarters fills RoomA with n quarter-hour bookings from Wednesday on,
+// after the two seeded ones.
+func bookQuarters(t *testing.T, srv *ServerState, n int) {
+	t.Helper()
+	p := newFakePeer("client")
+	for i := 0; i < n; i++ {
+		start := schedule.ToMinutes(2, 0, 0) + int32(i)*15
+		req := common.RequestMessage{OpCode: common.OpBookFacility, RequestID: uint64(100 + i), FacilityName: "RoomA"}
+		req.StartDay, req.StartHour, req.StartMinute = schedule.FromMinutes(start)
+		req.EndDay, req.EndHour, req.EndMinute = schedule.FromMinutes(start + 15)
+		confirmationID(t, send(t, srv, p, req))
+	}
+}
+
+var (
+	listedBooking = regexp.MustCompile(`(?m)^  - (\S+): `)
+	nextOffset    = regexp.MustCompile(`(?m)^Next=(\d+)$`)
+)
+
+// TestListBookingsPages pages through 300 bookings and checks every one
+// is listed exactly once, in start order.
+func TestListBookingsPages(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	bookQuarters(t, srv, 298)
+	want := facilityBookings(srv, "RoomA")
+	if len(want) != 300 {
+		t.Fatalf("%d bookings, want 300", len(want))
+	}
+
+	// The server caps pages at maxListPage, 0 included
+	for limit, wantPages := range map[uint16]int{0: 6, 7: 43, 50: 6, 300: 6} {
+		p := newFakePeer(fmt.Sprintf("client-%d", limit)) // RequestIDs repeat per limit
+		seen := make(map[string]int)
+		var order []string
+		pages := 0
+		for offset, more := uint32(0), true; more; {
+			pages++
+			rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpListBookings, RequestID: uint64(1000 + pages),
+				FacilityName: "RoomA", PageOffset: offset, PageLimit: limit})
+			if rep.Status != common.StatusOK {
+				t.Fatalf("limit %d, page %d: status %d: %s", limit, pages, rep.Status, rep.Data)
+			}
+			for _, m := range listedBooking.FindAllStringSubmatch(rep.Data, -1) {
+				seen[m[1]]++
+				order = append(order, m[1])
+			}
+			m := nextOffset.FindStringSubmatch(rep.Data)
+			if more = m != nil; more {
+				next, _ := strconv.ParseUint(m[1], 10, 32)
+				offset = uint32(next)
+			}
+		}
+
+		for _, id := range want {
+			if seen[id] != 1 {
+				t.Errorf("limit %d: %s listed %d times", limit, id, seen[id])
+			}
+		}
+		if len(order) != len(want) {
+			t.Errorf("limit %d: %d bookings listed, want %d", limit, len(order), len(want))
+		}
+		for i := 1; i < len(order); i++ {
+			prev, _ := bookingInterval(t, srv, order[i-1])
+			cur, _ := bookingInterval(t, srv, order[i])
+			if prev > cur {
+				t.Errorf("limit %d: %s listed before the earlier %s", limit, order[i-1], order[i])
+				break
+			}
+		}
+		if pages != wantPages {
+			t.Errorf("limit %d: %d pages, want %d", limit, pages, wantPages)
+		}
+	}
+}
+
+// TestListBookingsPastTheEnd: an offset beyond the last booking and an
+// empty facility answer without a Next= field.
+func TestListBookingsPastTheEnd(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpListBookings, RequestID: 1, FacilityName: "RoomA", PageOffset: 2})
+	if rep.Status != common.StatusOK || rep.Data != "Facility=RoomA, no bookings after 2 of 2." {
+		t.Errorf("past the end: status %d: %q", rep.Status, rep.Data)
+	}
+	adminSender(t, srv)(clearReq(2, "Lab1"))
+	if rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpListBookings, RequestID: 3, FacilityName: "Lab1"}); rep.Data != "Facility=Lab1 has no bookings." {
+		t.Errorf("empty facility: %q", rep.Data)
+	}
+	if rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpListBookings, RequestID: 4, FacilityName: "Gym"}); rep.Status == common.StatusOK {
+		t.Errorf("unknown facility: %q", rep.Data)
+	}
+}
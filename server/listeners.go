@@ -0,0 +1,81 @@
+// server/listeners.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"syscall"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// listenUDP opens n sockets bound to the same address with SO_REUSEPORT so
+// the kernel spreads incoming flows across them. Where the option is not
+// available it falls back to a single socket.
+func listenUDP(addr *net.UDPAddr, n int) ([]*net.UDPConn, error) {
+	if n > 1 && !reusePortSupported {
+		log.Printf("WARNING: -listeners=%d needs SO_REUSEPORT, which this platform lacks; using one socket", n)
+		n = 1
+	}
+	if n <= 1 {
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.UDPConn{conn}, nil
+	}
+
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var opErr error
+			if err := c.Control(func(fd uintptr) { opErr = setReusePort(fd) }); err != nil {
+				return err
+			}
+			return opErr
+		},
+	}
+	conns := make([]*net.UDPConn, 0, n)
+	bind := addr.String()
+	for i := 0; i < n; i++ {
+		pc, err := lc.ListenPacket(context.Background(), "udp", bind)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conn := pc.(*net.UDPConn)
+		conns = append(conns, conn)
+		// With -port=0 the first socket picks the port; the rest must join it
+		bind = conn.LocalAddr().String()
+	}
+	return conns, nil
+}
+
+// serveUDP is the read loop of one listening socket. Replies and callbacks
+// for a client go out through the socket that received its request: all
+// sockets share the same local address, so the client cannot tell them
+// apart, and the kernel keeps hashing its flow to that same socket.
+func (s *ServerState) serveUDP(conn *net.UDPConn) {
+	// An oversized request is cut off at the limit, but its length prefix
+	// and header still arrive for handleDatagram to answer
+	buf := make([]byte, common.LengthPrefixSize+s.maxRequestSize)
+	for {
+		n, clientAddr, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("ReadFromUDP error: %v\n", err)
+			continue
+		}
+
+		// Copy the packet: buf is reused by the next read while the handler runs
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		peer := &udpPeer{conn: conn, addr: clientAddr}
+		s.schedule(packet[min(n, common.LengthPrefixSize):], peer, func() { s.handleDatagram(packet, peer) })
+	}
+}
@@ -0,0 +1,257 @@
+// server/listeners_test.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// startUDPServer serves srv on n sockets bound to ip until the test ends
+// and returns the address clients send to. It skips the test if ip is not
+// configured on this host.
+func startUDPServer(t testing.TB, srv *ServerState, ip string, n int) string {
+	t.Helper()
+	conns, err := listenUDP(&net.UDPAddr{IP: net.ParseIP(ip)}, n)
+	if err != nil {
+		if ip == "::1" {
+			t.Skipf("no IPv6 loopback: %v", err)
+		}
+		t.Fatalf("listenUDP: %v", err)
+	}
+	for _, c := range conns {
+		c := c
+		t.Cleanup(func() { c.Close() })
+		go srv.serveUDP(c)
+	}
+	return conns[0].LocalAddr().String()
+}
+
+// udpClient sends requests from one UDP socket and keeps the callbacks
+// that arrive between replies.
+type udpClient struct {
+	t         testing.TB
+	conn      *net.UDPConn
+	callbacks []common.ReplyMessage
+}
+
+func dialUDP(t testing.TB, addr string) *udpClient {
+	t.Helper()
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &udpClient{t: t, conn: conn}
+}
+
+// next reads one packet.
+func (c *udpClient) next() common.ReplyMessage {
+	c.t.Helper()
+	buf := make([]byte, 65536)
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		c.t.Fatalf("reading reply: %v", err)
+	}
+	payload, _, err := common.SplitLength(buf[:n])
+	if err != nil {
+		c.t.Fatalf("SplitLength: %v", err)
+	}
+	rep, err := common.UnmarshalReply(payload)
+	if err != nil {
+		c.t.Fatalf("UnmarshalReply: %v", err)
+	}
+	return rep
+}
+
+// do sends req and returns its reply.
+func (c *udpClient) do(req common.RequestMessage) common.ReplyMessage {
+	c.t.Helper()
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		c.t.Fatalf("MarshalRequest: %v", err)
+	}
+	if _, err := c.conn.Write(common.PrefixLength(raw)); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+	for {
+		rep := c.next()
+		if rep.OpCode == common.OpCallback {
+			c.callbacks = append(c.callbacks, rep)
+			continue
+		}
+		if rep.RequestID == req.RequestID {
+			return rep
+		}
+	}
+}
+
+// TestIPv6Loopback runs requests over [::1]: clients are told apart by
+// their IPv6 address and port, and callbacks reach a monitor there.
+func TestIPv6Loopback(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	addr := startUDPServer(t, srv, "::1", 1)
+	if !strings.HasPrefix(addr, "[::1]:") {
+		t.Fatalf("listening on %s, want [::1]", addr)
+	}
+	watcher, a, b := dialUDP(t, addr), dialUDP(t, addr), dialUDP(t, addr)
+
+	if rep := watcher.do(common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60}); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// The same RequestID twice from one client is a duplicate; from another
+	// client it is a request of its own
+	first := a.do(addParticipant(7, "Ada"))
+	again := a.do(addParticipant(7, "Ada"))
+	if again.Data != first.Data {
+		t.Errorf("duplicate got %q, want the cached %q", again.Data, first.Data)
+	}
+	if rep := b.do(addParticipant(7, "Grace")); rep.Status != common.StatusOK {
+		t.Errorf("other client: status %d: %s", rep.Status, rep.Data)
+	}
+	if got := participants(srv); got != "Ada,Grace" {
+		t.Errorf("participants = %q, want Ada,Grace", got)
+	}
+	history := srv.history.(*MemoryHistory)
+	for _, c := range []*udpClient{a, b} {
+		key := RequestKey{c.conn.LocalAddr().String(), 7}
+		if !strings.HasPrefix(key.Addr, "[::1]:") {
+			t.Fatalf("client address %s", key.Addr)
+		}
+		if _, ok := history.Get(key); !ok {
+			t.Errorf("no history entry for %v", key)
+		}
+	}
+
+	// Each participant added means one callback to the monitor
+	for i := 0; i < 2; i++ {
+		if cb := watcher.next(); cb.OpCode != common.OpCallback {
+			t.Fatalf("watcher got %+v, want a callback", cb)
+		}
+	}
+}
+
+// TestZonedPeerAddress checks a link-local client keeps its zone in the
+// address its replies, callbacks and history entries are keyed by.
+func TestZonedPeerAddress(t *testing.T) {
+	peer := &udpPeer{addr: &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 4000, Zone: "eth0"}}
+	if got := peer.String(); got != "[fe80::1%eth0]:4000" {
+		t.Errorf("String() = %q", got)
+	}
+	other := &udpPeer{addr: &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 4000, Zone: "eth1"}}
+	if peer.String() == other.String() {
+		t.Error("the same link-local address on two interfaces is one client")
+	}
+}
+
+// TestServeUDPStops checks the read loop ends when its socket is closed.
+func TestServeUDPStops(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	conns, err := listenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 1)
+	if err != nil {
+		t.Fatalf("listenUDP: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.serveUDP(conns[0])
+		close(done)
+	}()
+	conns[0].Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("serveUDP still running after Close")
+	}
+}
+
+func TestListenUDPSharesThePort(t *testing.T) {
+	conns, err := listenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 4)
+	if err != nil {
+		t.Fatalf("listenUDP: %v", err)
+	}
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	want := 4
+	if !reusePortSupported {
+		want = 1 // with a warning
+	}
+	if len(conns) != want {
+		t.Fatalf("%d sockets, want %d", len(conns), want)
+	}
+	for _, c := range conns[1:] {
+		if c.LocalAddr().String() != conns[0].LocalAddr().String() {
+			t.Errorf("socket on %s, want %s", c.LocalAddr(), conns[0].LocalAddr())
+		}
+	}
+}
+
+// TestShardedListeners sends from many clients to a server with four
+// sockets on one port. Every reply and callback comes back from the port
+// the client sent to, whichever socket the kernel handed its flow to.
+func TestShardedListeners(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	addr := startUDPServer(t, srv, "127.0.0.1", 4)
+	watcher := dialUDP(t, addr)
+	if rep := watcher.do(common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60}); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+
+	const clients = 16
+	for i := 0; i < clients; i++ {
+		c := dialUDP(t, addr)
+		if rep := c.do(common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA", DaysList: []uint8{0}}); rep.Status != common.StatusOK {
+			t.Fatalf("client %d: status %d: %s", i, rep.Status, rep.Data)
+		}
+		// A connected UDP socket only accepts packets from addr, so the
+		// reply arriving at all shows it came from the shared port
+		if i%4 == 0 {
+			if rep := c.do(addParticipant(2, "Ada")); rep.Status != common.StatusOK {
+				t.Fatalf("client %d: status %d: %s", i, rep.Status, rep.Data)
+			}
+		}
+	}
+	for i := 0; i < clients/4; i++ {
+		if cb := watcher.next(); cb.OpCode != common.OpCallback {
+			t.Fatalf("watcher got %+v, want a callback", cb)
+		}
+	}
+}
+
+// BenchmarkListeners measures query throughput from parallel clients
+// against one socket and against four sharing the port.
+func BenchmarkListeners(b *testing.B) {
+	for _, n := range []int{1, 4} {
+		b.Run(fmt.Sprintf("listeners=%d", n), func(b *testing.B) {
+			if n > 1 && !reusePortSupported {
+				b.Skip("SO_REUSEPORT is not supported on this platform")
+			}
+			srv := newTestServer(b, SemanticsAtLeastOnce)
+			addr := startUDPServer(b, srv, "127.0.0.1", n)
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				c := dialUDP(b, addr)
+				for id := uint64(1); pb.Next(); id++ {
+					req := common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: id, FacilityName: "RoomA", DaysList: []uint8{0}}
+					if rep := c.do(req); rep.Status != common.StatusOK {
+						b.Errorf("status %d: %s", rep.Status, rep.Data)
+						return
+					}
+				}
+			})
+		})
+	}
+}
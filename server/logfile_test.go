@@ -0,0 +1,112 @@
+// server/logfile_test.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logFiles returns the current log file and the rotated ones at path.
+func logFiles(t *testing.T, path string) (current []byte, rotated []string) {
+	t.Helper()
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	rotated, err = filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return current, rotated
+}
+
+// TestLogRotation writes from several goroutines until the file has been
+// rotated many times and checks which files are left.
+func TestLogRotation(t *testing.T) {
+	const (
+		maxSize = 1024
+		keep    = 3
+		writers = 8
+		lines   = 100
+	)
+	path := filepath.Join(t.TempDir(), "server.log")
+	r, err := OpenRotatingFile(path, maxSize, keep)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				fmt.Fprintf(r, "writer %d line %03d\n", w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	current, rotated := logFiles(t, path)
+	if len(rotated) != keep {
+		t.Fatalf("%d rotated files, want %d: %q", len(rotated), keep, rotated)
+	}
+	for _, name := range append(rotated, path) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > maxSize {
+			t.Errorf("%s has %d bytes, over the %d limit", filepath.Base(name), len(data), maxSize)
+		}
+		// Writes are never split, so every file holds whole lines
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			var w, i int
+			if n, _ := fmt.Sscanf(line, "writer %d line %d", &w, &i); n != 2 {
+				t.Errorf("%s has a torn line %q", filepath.Base(name), line)
+			}
+		}
+	}
+	if len(current) == 0 {
+		t.Error("current log file is empty")
+	}
+}
+
+func TestLogRotationAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 90)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRotatingFile(path, 100, 1)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer r.Close()
+
+	// The existing 91 bytes count: this line no longer fits
+	fmt.Fprintln(r, "first line of the new file")
+	current, rotated := logFiles(t, path)
+	if string(current) != "first line of the new file\n" || len(rotated) != 1 {
+		t.Errorf("current file %q and %d rotated files, want the new line alone and 1", current, len(rotated))
+	}
+}
+
+func TestLogWithoutLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	r, err := OpenRotatingFile(path, 0, 3)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer r.Close()
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintln(r, "a line that would otherwise fill a small file")
+	}
+	if _, rotated := logFiles(t, path); len(rotated) != 0 {
+		t.Errorf("rotated %d times without a size limit", len(rotated))
+	}
+}
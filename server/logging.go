@@ -0,0 +1,30 @@
+// server/logging.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+)
+
+// Log output formats selectable with -logFormat
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// setupLogging routes all logging to w. In JSON mode every entry, including
+// plain log.Printf lines, becomes one JSON object with time, level and msg;
+// structured events (slog) add their key-value pairs as fields.
+func setupLogging(format string, w io.Writer) error {
+	switch format {
+	case LogFormatText:
+		log.SetOutput(w)
+	case LogFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, nil)))
+	default:
+		return fmt.Errorf("unknown log format %q; choose %q or %q", format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// server/logging_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs switches logging to format for the rest of the test and
+// returns what gets written.
+func captureLogs(t *testing.T, format string) *syncBuffer {
+	t.Helper()
+	out, flags, logger := log.Writer(), log.Flags(), slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(logger)
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	buf := &syncBuffer{}
+	if err := setupLogging(format, buf); err != nil {
+		t.Fatalf("setupLogging: %v", err)
+	}
+	return buf
+}
+
+func TestJSONLogs(t *testing.T) {
+	buf := captureLogs(t, LogFormatJSON)
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	send(t, srv, newFakePeer("client"), addParticipant(7, "Ada"))
+
+	var reply map[string]any
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v\n%s", i+1, err, line)
+		}
+		for _, field := range []string{"time", "level", "msg"} {
+			if _, ok := entry[field]; !ok {
+				t.Errorf("line %d has no %s: %s", i+1, field, line)
+			}
+		}
+		if entry["msg"] == "Sending reply" {
+			reply = entry
+		}
+	}
+	if len(lines) < 2 {
+		t.Errorf("%d log lines, want the handler's plain lines too", len(lines))
+	}
+	if reply == nil {
+		t.Fatal("no Sending reply event")
+	}
+	want := map[string]any{"client": "client", "requestID": 7.0, "opcode": "AddParticipant", "status": 0.0, "level": "INFO"}
+	for k, v := range want {
+		if reply[k] != v {
+			t.Errorf("%s = %v, want %v", k, reply[k], v)
+		}
+	}
+	if _, ok := reply["duration"].(float64); !ok {
+		t.Errorf("duration = %v, want a number", reply["duration"])
+	}
+}
+
+func TestTextLogs(t *testing.T) {
+	buf := captureLogs(t, LogFormatText)
+	log.Print("plain line")
+	if got := buf.String(); !strings.Contains(got, "plain line") || strings.HasPrefix(got, "{") {
+		t.Errorf("text log = %q", got)
+	}
+}
+
+func TestUnknownLogFormat(t *testing.T) {
+	if err := setupLogging("xml", &syncBuffer{}); err == nil {
+		t.Error("unknown log format accepted")
+	}
+}
@@ -0,0 +1,205 @@
+// server/lookup.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// maxSuggestions is how many similar names a not-found reply offers.
+const maxSuggestions = 3
+
+// facilityIndex finds facilities by name regardless of case and suggests
+// names close to one that matches nothing, within one namespace. It has its
+// own lock so that handlers can build a not-found reply whether or not they
+// hold dataLock; it never takes another lock.
+type facilityIndex struct {
+	mu    sync.RWMutex
+	names map[string]string // qualified folded name -> display name
+}
+
+func newFacilityIndex(data map[string]map[string]*FacilityInfo) *facilityIndex {
+	x := &facilityIndex{names: make(map[string]string)}
+	for ns, facilities := range data {
+		for name := range facilities {
+			key := qualify(ns, validate.FacilityKey(name))
+			if other, dup := x.names[key]; dup {
+				log.Printf("Facilities '%s' and '%s' differ only in case; other spellings find '%s'", name, other, other)
+				continue
+			}
+			x.names[key] = name
+		}
+	}
+	return x
+}
+
+// resolve returns the display name of the facility of namespace ns called
+// name in any case.
+func (x *facilityIndex) resolve(ns, name string) (string, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	display, ok := x.names[qualify(ns, validate.FacilityKey(name))]
+	return display, ok
+}
+
+// add records a new facility of namespace ns.
+func (x *facilityIndex) add(ns, name string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.names[qualify(ns, validate.FacilityKey(name))] = name
+}
+
+// rename moves a facility of namespace ns to its new name.
+func (x *facilityIndex) rename(ns, oldName, newName string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if old := qualify(ns, validate.FacilityKey(oldName)); x.names[old] == oldName {
+		delete(x.names, old)
+	}
+	x.names[qualify(ns, validate.FacilityKey(newName))] = newName
+}
+
+// dropNamespace forgets every facility of namespace ns.
+func (x *facilityIndex) dropNamespace(ns string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key := range x.names {
+		if owner, _ := splitQualified(key); owner == ns {
+			delete(x.names, key)
+		}
+	}
+}
+
+// reset replaces the whole index with the facilities in data, as a backup
+// does when it installs a state transfer.
+func (x *facilityIndex) reset(data map[string]map[string]*FacilityInfo) {
+	names := newFacilityIndex(data).names
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.names = names
+}
+
+// suggest returns up to maxSuggestions facility names of namespace ns within
+// a small edit distance of name, closest first. Case is ignored, so "roomb"
+// and "ROOMa" both find RoomA. Names that share little with name are not
+// offered.
+func (x *facilityIndex) suggest(ns, name string) []string {
+	folded := validate.FacilityKey(name)
+	limit := len([]rune(folded)) / 3
+	if limit < 2 {
+		limit = 2
+	}
+
+	type candidate struct {
+		name string
+		dist int
+	}
+	var found []candidate
+	x.mu.RLock()
+	for key, display := range x.names {
+		owner, other := splitQualified(key)
+		if owner != ns {
+			continue
+		}
+		if d := editDistance(folded, other); d <= limit {
+			found = append(found, candidate{display, d})
+		}
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].dist != found[j].dist {
+			return found[i].dist < found[j].dist
+		}
+		return found[i].name < found[j].name
+	})
+	if len(found) > maxSuggestions {
+		found = found[:maxSuggestions]
+	}
+	names := make([]string, len(found))
+	for i, c := range found {
+		names[i] = c.name
+	}
+	return names
+}
+
+// editDistance is the Levenshtein distance between a and b, in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// canonicalFacility returns the name a facility of namespace ns is stored
+// under, given a name that may differ from it in case. An exact name always
+// wins, and a name that matches nothing is returned as it is.
+func (s *ServerState) canonicalFacility(ns, name string, t *opTiming) string {
+	if name == "" {
+		return name
+	}
+	t.rlock(&s.dataLock)
+	_, exact := s.facilityData[ns][name]
+	s.dataLock.RUnlock()
+	if exact {
+		return name
+	}
+	if display, ok := s.facilityNames.resolve(ns, name); ok {
+		return display
+	}
+	return name
+}
+
+// canonicalFacilities rewrites the facility names of a request to the names
+// they are stored under, so every handler, the change journal and the
+// callbacks see one spelling.
+func (s *ServerState) canonicalFacilities(req *common.RequestMessage, t *opTiming) {
+	req.FacilityName = s.canonicalFacility(req.Namespace, req.FacilityName, t)
+	// The facilities of a new namespace are names to create, not to look up
+	if len(req.MoreFacilities) > 0 && req.OpCode != common.OpCreateNamespace {
+		more := make([]string, len(req.MoreFacilities))
+		for i, name := range req.MoreFacilities {
+			more[i] = s.canonicalFacility(req.Namespace, name, t)
+		}
+		req.MoreFacilities = more
+	}
+}
+
+// facilityNotFound is the reply text for a facility name that matches
+// nothing in namespace ns, naming up to three similar facilities of it.
+func (s *ServerState) facilityNotFound(ns, name string) string {
+	msg := fmt.Sprintf("Facility '%s' not found", name)
+	suggestions := s.facilityNames.suggest(ns, name)
+	if len(suggestions) == 0 {
+		return msg
+	}
+	quoted := make([]string, len(suggestions))
+	for i, n := range suggestions {
+		quoted[i] = "'" + n + "'"
+	}
+	list := quoted[0]
+	if n := len(quoted); n > 1 {
+		list = strings.Join(quoted[:n-1], ", ") + " or " + quoted[n-1]
+	}
+	return fmt.Sprintf("%s; did you mean %s?", msg, list)
+}
@@ -0,0 +1,159 @@
+// server/lookup_test.go
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// addFacilities adds empty facilities to the default namespace, indexed
+// as the server indexes its own.
+func addFacilities(srv *ServerState, names ...string) {
+	for _, name := range names {
+		srv.facilityData[common.DefaultNamespace][name] = &FacilityInfo{Name: name}
+		srv.facilityNames.add(common.DefaultNamespace, name)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"rooma", "rooma", 0},
+		{"", "lab1", 4},
+		{"roomc", "rooma", 1},
+		{"rom", "room", 1},
+		{"labl", "lab1", 1},
+		{"kitten", "sitting", 3},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	addFacilities(srv, "RoomB", "RoomC", "RoomD", "Auditorium")
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"RoomE", []string{"RoomA", "RoomB", "RoomC"}}, // closest first, then by name, at most three
+		{"ROOMb", []string{"RoomB", "RoomA", "RoomC"}},
+		{"Lab", []string{"Lab1"}},
+		{"Audtorium", []string{"Auditorium"}},
+		{"Gym", []string{}},
+		{"Observatory", []string{}},
+	}
+	for _, tt := range tests {
+		if got := srv.facilityNames.suggest(common.DefaultNamespace, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := srv.facilityNames.suggest("physics", "RoomA"); len(got) != 0 {
+		t.Errorf("another namespace suggests %q", got)
+	}
+}
+
+// TestCaseInsensitiveLookup: every handler finds a facility in any case
+// and answers with its stored name.
+func TestCaseInsensitiveLookup(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	want := queryData(t, srv, 1, []uint8{0}, "RoomA")
+	for i, name := range []string{"rooma", "ROOMA", "rOoMa"} {
+		if got := queryData(t, srv, uint64(2+i), []uint8{0}, name); got != want {
+			t.Errorf("query of %s:\n%s\nwant\n%s", name, got, want)
+		}
+	}
+
+	watcher := newFakePeer("watcher")
+	if rep := send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 10,
+		FacilityName: "ROOMA", MonitorPeriod: 60}); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+	rep := send(t, srv, p, bookReq(11, "roomA", 4, 9, 10))
+	if !strings.HasPrefix(rep.Data, "Booked 'RoomA' from Friday 09:00") {
+		t.Errorf("booking reply %q", rep.Data)
+	}
+	cbs := watcher.callbacks()
+	if len(cbs) != 1 {
+		t.Fatalf("%d callbacks, want 1", len(cbs))
+	}
+	if _, facility, _ := common.CallbackSeq(cbs[0]); facility != "RoomA" {
+		t.Errorf("callback for facility %q, want RoomA", facility)
+	}
+	if got := facilityBookings(srv, "RoomA"); len(got) != 3 {
+		t.Errorf("RoomA holds %q", got)
+	}
+	if got := queryData(t, srv, 12, []uint8{0}, "lab1", "ROOMA"); !strings.Contains(got, "Facility Lab1") || !strings.Contains(got, "Facility RoomA") {
+		t.Errorf("query of several facilities:\n%s", got)
+	}
+}
+
+// TestExactNameWins: of two facilities differing only in case, each is
+// found by its own spelling.
+func TestExactNameWins(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	addFacilities(srv, "ROOMA")
+	p := newFakePeer("client")
+	if rep := send(t, srv, p, bookReq(1, "ROOMA", 4, 9, 10)); !strings.HasPrefix(rep.Data, "Booked 'ROOMA'") {
+		t.Errorf("booking ROOMA: %q", rep.Data)
+	}
+	if rep := send(t, srv, p, bookReq(2, "RoomA", 4, 9, 10)); !strings.HasPrefix(rep.Data, "Booked 'RoomA'") {
+		t.Errorf("booking RoomA: %q", rep.Data)
+	}
+}
+
+// TestFacilityNotFound: near misses are offered in every handler's reply;
+// names close to nothing get the plain refusal.
+func TestFacilityNotFound(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	const hint = "Facility 'Roomz' not found; did you mean 'RoomA'?"
+	tests := []struct {
+		name string
+		req  common.RequestMessage
+		want string
+	}{
+		{"query", common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "Roomz"}, "Error: " + hint},
+		{"bitmap", common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "Roomz", Bitmap: true}, "Error: " + hint},
+		{"book", bookReq(0, "Roomz", 4, 9, 10), hint},
+		{"monitor", common.RequestMessage{OpCode: common.OpMonitorAvailability, FacilityName: "Roomz", MonitorPeriod: 60}, hint},
+		{"prefix", common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "Lab"},
+			"Error: Facility 'Lab' not found; did you mean 'Lab1'?"},
+		{"unknown", bookReq(0, "Gymnasium", 4, 9, 10), "Facility 'Gymnasium' not found"},
+	}
+	for i, tt := range tests {
+		tt.req.RequestID = uint64(i + 1)
+		rep := send(t, srv, p, tt.req)
+		if rep.Data != tt.want {
+			t.Errorf("%s: status %d: %q, want %q", tt.name, rep.Status, rep.Data, tt.want)
+		}
+	}
+
+	got := queryData(t, srv, 20, []uint8{0}, "RoomA", "Lab2")
+	if !strings.Contains(got, "Error: Facility 'Lab2' not found; did you mean 'Lab1'?") {
+		t.Errorf("query of several facilities:\n%s", got)
+	}
+
+	addFacilities(srv, "RoomB")
+	if rep := send(t, srv, p, bookReq(21, "Roomz", 4, 9, 10)); rep.Data != "Facility 'Roomz' not found; did you mean 'RoomA' or 'RoomB'?" {
+		t.Errorf("two suggestions: %q", rep.Data)
+	}
+	addFacilities(srv, "RoomC")
+	if rep := send(t, srv, p, bookReq(22, "Roomz", 4, 9, 10)); rep.Data != "Facility 'Roomz' not found; did you mean 'RoomA', 'RoomB' or 'RoomC'?" {
+		t.Errorf("three suggestions: %q", rep.Data)
+	}
+}
@@ -0,0 +1,44 @@
+// server/magic_test.go
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestStrayTrafficDropped sends random datagrams between legitimate
+// requests: the stray ones are counted and never answered.
+func TestStrayTrafficDropped(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	rng := rand.New(rand.NewSource(1))
+
+	stray := 0
+	for i := 0; i < 200; i++ {
+		data := make([]byte, 1+rng.Intn(64))
+		rng.Read(data)
+		if common.HasMagic(data) {
+			continue
+		}
+		srv.handleDatagram(common.PrefixLength(data), p)
+		stray++
+	}
+	// A scanner that skips the length prefix gets the same treatment
+	srv.handlePacket([]byte("GET / HTTP/1.0\r\n\r\n"), p)
+	stray++
+
+	if n := len(p.received()); n != 0 {
+		t.Fatalf("%d replies to stray traffic", n)
+	}
+	if got := srv.badMagic.Load(); got != uint64(stray) {
+		t.Errorf("bad magic counter = %d, want %d", got, stray)
+	}
+
+	req := common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA", DaysList: []uint8{0}}
+	srv.handleDatagram(common.PrefixLength(p.seal(t, req)), p)
+	if got := p.received(); len(got) != 1 || got[0].Status != common.StatusOK {
+		t.Errorf("legitimate request got %+v", got)
+	}
+}
@@ -3,53 +3,391 @@ package main
 
 import (
     "flag"
+    "io"
     "log"
     "net"
+    "os"
+    "strconv"
     "strings"
+    "time"
+
+    "github.com/Iyzyman/distributed-go/common"
 )
 
 // Command-line flags for server
 var (
     portFlag       = flag.Int("port", 2222, "UDP port to listen on")
+    listenersFlag  = flag.Int("listeners", 1, "Number of UDP sockets sharing -port via SO_REUSEPORT, each with its own read loop")
+    listenAddrFlag = flag.String("listenAddr", "", "IP address to listen on, e.g. 0.0.0.0, :: or fe80::1%eth0 (empty = all interfaces, dual-stack)")
+    authKeyFlag    = flag.String("authKey", "", "Shared secret for HMAC request/reply authentication (empty = disabled)")
+    encryptFlag    = flag.Bool("encrypt", false, "Encrypt payloads with AES-GCM using a key derived from -authKey")
+    maxSkewFlag    = flag.Duration("maxSkew", 0, "Reject requests whose timestamp differs from server time by more than this (0 = disabled)")
+    clockOffsetFlag = flag.Duration("clockOffset", 0, "Run the server clock this far ahead of the local clock (negative = behind), to demonstrate skew")
+    maxRequestSizeFlag = flag.Int("maxRequestSize", common.DefaultMaxRequestSize, "Largest accepted request in bytes; larger ones get a \"too large\" reply")
+    tcpPortFlag    = flag.Int("tcpPort", 0, "Also accept length-prefixed requests over TCP on this port (0 = disabled)")
     semanticsFlag  = flag.String("semantics", SemanticsAtLeastOnce, "Invocation semantics: at-least-once or at-most-once")
+    allowedSemFlag = flag.String("allowedSemantics", "", "Comma-separated semantics that requests may select per request (empty = only -semantics)")
+    metricsAddrFlag = flag.String("metricsAddr", "", "Serve counters as JSON at http://<addr>/debug/vars (empty = disabled)")
+    dumpDirFlag    = flag.String("dumpDir", ".", "Directory for JSON state dumps written on SIGUSR1")
+    logFileFlag    = flag.String("logFile", "", "Write logs to this file instead of stderr")
+    logMaxSizeFlag = flag.Int("logMaxSizeMB", 100, "Rotate -logFile when it reaches this size in MB (0 = never)")
+    logKeepFlag    = flag.Int("logKeep", 5, "Number of rotated log files to keep")
+    logFormatFlag  = flag.String("logFormat", LogFormatText, "Log format: text or json (one object per line)")
+    callbackBufFlag = flag.Int("callbackBuffer", defaultCallbackBuffer, "Callbacks kept per monitor subscription for clients that detect a sequence gap")
+    maxMonitorFlag = flag.Duration("maxMonitorPeriod", defaultMaxMonitorPeriod, "Longest monitor period granted; longer requests are capped to it")
+    renameGraceFlag = flag.Duration("renameGrace", defaultRenameGrace, "How long requests using a renamed facility's old name are told the new one")
+    approvalTTLFlag = flag.Duration("approvalTTL", defaultApprovalTTL, "How long a booking pending approval holds its time before it is removed")
+    dupCallbackFlag = flag.Float64("dupCallbackRate", 0, "Fraction of monitor callbacks (0-1) sent twice, to test client duplicate handling")
+    keepaliveFlag  = flag.Duration("keepalive", defaultKeepalive, "Send monitoring clients a keepalive callback this often so NAT mappings stay open (0 = disabled)")
+    compressFlag   = flag.Int("compressThreshold", common.DefaultCompressThreshold, "Gzip reply payloads of at least this many bytes for clients that support it (0 = never)")
+    debugFlag      = flag.Bool("debug", false, "Log a hex dump of every packet received and reply sent")
+    maxInFlightFlag = flag.Int("maxInFlight", 0, "Answer new requests with a busy reply while this many are being handled (0 = unlimited)")
+    maxLockQueueFlag = flag.Int("maxLockQueue", 0, "Answer new requests with a busy reply while this many operations wait for the schedule lock (0 = unlimited)")
+    busyRetryAfterFlag = flag.Duration("busyRetryAfter", defaultBusyRetryAfter, "Wait suggested to clients in busy replies (rounded up to whole seconds)")
+    abuseThresholdFlag = flag.Int("abuseThreshold", 0, "Block a source IP after more than this many malformed packets within -abuseWindow (0 = never)")
+    abuseWindowFlag = flag.Duration("abuseWindow", defaultAbuseWindow, "Sliding window for counting malformed packets per source")
+    abuseCooldownFlag = flag.Duration("abuseCooldown", defaultAbuseCooldown, "How long a blocked source's packets are dropped unread")
+    workersFlag    = flag.Int("workers", 0, "Handle requests on this many workers fed from per-class queues (0 = a goroutine per request)")
+    queueSizeFlag  = flag.Int("queueSize", defaultQueueSize, "Requests of each class (read, write) that may wait for a worker with -workers")
+    readWeightFlag = flag.Int("readWeight", 1, "Read requests started per scheduling round with -workers")
+    writeWeightFlag = flag.Int("writeWeight", 1, "Mutating requests started per scheduling round with -workers")
+    slowOpFlag     = flag.Duration("slowOpThreshold", 100*time.Millisecond, "Log operations that take longer than this (0 = disabled)")
+    configFlag     = flag.String("config", "", "Optional JSON config file (webhooks, ...)")
+    storeFlag      = flag.String("store", StoreMemory, "Storage backend: memory or sqlite")
+    dbPathFlag     = flag.String("dbPath", "bookings.db", "Database file for -store=sqlite")
+    historyFlag    = flag.String("history", HistoryMemory, "At-most-once history backend: memory, window or redis")
+    dedupWindowFlag = flag.Int("dedupWindow", 64, "Replies kept per client with -history=window")
+    dedupIdleFlag   = flag.Duration("dedupIdle", 30*time.Minute, "Forget a client's window after it has been idle this long with -history=window (0 = never)")
+    redisAddrFlag  = flag.String("redisAddr", "localhost:6379", "Redis address for -history=redis")
+    inflightFlag   = flag.String("inflight", InflightWait, "Duplicates of a request that is still executing: wait for its reply or drop")
+    historyFileFlag = flag.String("historyFile", "", "Journal file that keeps the at-most-once history across restarts (empty = memory only)")
+    historySyncFlag = flag.String("historySync", JournalSyncMutating, "When replies wait for their journal entry: all, mutating or none")
+    historyMaxFlag = flag.Int("historyMax", 0, "Maximum cached replies for -history=memory; least recently used are evicted (0 = unlimited)")
+    historyTTLFlag = flag.Duration("historyTTL", 0, "How long cached replies are kept (0 = forever)")
+    roleFlag       = flag.String("role", RolePrimary, "Replication role: primary or backup")
+    replAddrFlag   = flag.String("replAddr", ":2223", "UDP address for replication traffic")
+    backupAddrFlag = flag.String("backupAddr", "", "Backup replication address (primary only; empty = no backup)")
+    primaryAddrFlag = flag.String("primaryAddr", "", "Primary replication address (backup only)")
+    adminUserFlag  = flag.String("adminUser", "admin", "Name of the admin account created from -adminKey")
+    adminKeyFlag   = flag.String("adminKey", "", "Password of the admin account allowed to run privileged operations (empty = no admin)")
+    sessionIdleFlag = flag.Duration("sessionIdle", 30*time.Minute, "Expire session tokens idle for longer than this (0 = never)")
+    currentTimeFlag = flag.String("currentTime", CurrentTimeOff, "Current time for refusing changes to started bookings: real (wall clock), a fixed time like \"Wed 10:30\", or empty (off)")
+    pastGraceFlag  = flag.Duration("pastGrace", defaultPastGrace, "With -currentTime, refuse bookings that ended longer ago than this")
+    rolloverFlag   = flag.String("rollover", RolloverKeep, "At the start of each week (needs -currentTime): keep, delete or archive last week's bookings")
+    archiveFileFlag = flag.String("archiveFile", "archived-bookings.jsonl", "File -rollover=archive appends bookings to, one JSON object per line")
+    idFormatFlag   = flag.String("idFormat", IDFormatLegacy, "Confirmation ID format for new bookings: legacy (BKG-<nanoseconds>) or uuid (random UUIDv4)")
+    idempotencyFlag = flag.Duration("idempotencyWindow", defaultIdempotencyWindow, "How long a booking's idempotency key returns the original confirmation, under any semantics (0 = disabled)")
+    changeJournalFlag = flag.Int("changeJournal", defaultChangeJournal, "Mutations kept for delta queries; older ones make clients query in full (0 = none)")
 )
 
 func main() {
     flag.Parse()
 
+    var logOut io.Writer = os.Stderr
+    if *logFileFlag != "" {
+        logFile, err := OpenRotatingFile(*logFileFlag, int64(*logMaxSizeFlag)<<20, *logKeepFlag)
+        if err != nil {
+            log.Fatalf("Failed to open log file: %v", err)
+        }
+        defer logFile.Close()
+        logOut = logFile
+    }
+    if err := setupLogging(*logFormatFlag, logOut); err != nil {
+        log.Fatalf("%v", err)
+    }
+
     semantics := strings.ToLower(*semanticsFlag)
     if semantics != SemanticsAtLeastOnce && semantics != SemanticsAtMostOnce {
         log.Fatalf("Unknown semantics: %s. Choose '%s' or '%s'.",
             semantics, SemanticsAtLeastOnce, SemanticsAtMostOnce)
     }
 
+    // Open the storage backend
+    store, err := OpenStore(*storeFlag, *dbPathFlag)
+    if err != nil {
+        log.Fatalf("Failed to open store: %v", err)
+    }
+    defer store.Close()
+
+    // Choose the dedup history backend
+    var history HistoryCache
+    switch *historyFlag {
+    case HistoryMemory:
+        history = NewMemoryHistory(*historyMaxFlag)
+    case HistoryWindow:
+        if *dedupWindowFlag <= 0 {
+            log.Fatalf("-dedupWindow must be positive")
+        }
+        history = NewWindowHistory(*dedupWindowFlag, *dedupIdleFlag)
+        log.Printf("Keeping the last %d replies per client for at-most-once", *dedupWindowFlag)
+    case HistoryRedis:
+        history = NewRedisHistory(*redisAddrFlag)
+        log.Printf("Sharing at-most-once history via Redis at %s", *redisAddrFlag)
+    default:
+        log.Fatalf("Unknown history backend: %s. Choose '%s', '%s' or '%s'.",
+            *historyFlag, HistoryMemory, HistoryWindow, HistoryRedis)
+    }
+    var journal *JournalHistory
+    if *historyFileFlag != "" {
+        var err error
+        journal, err = OpenJournalHistory(*historyFileFlag, history, *historySyncFlag)
+        if err != nil {
+            log.Fatalf("Failed to open history journal: %v", err)
+        }
+        closeOnShutdown(journal)
+        history = journal
+    }
+
     // Create the server state
-    srv := NewServerState(semantics)
+    srv, err := NewServerState(semantics, store, history)
+    if err != nil {
+        log.Fatalf("Failed to load state from %s store: %v", *storeFlag, err)
+    }
+
+    srv.historyTTL = *historyTTLFlag
+    sweepEvery := srv.historyTTL
+    if sweepEvery == 0 && *historyFlag == HistoryWindow {
+        // Nothing expires, but idle clients still have to be forgotten
+        sweepEvery = *dedupIdleFlag
+    }
+    if sweepEvery == 0 && journal != nil {
+        // Nothing expires, but the journal still needs compacting
+        sweepEvery = journalCompactInterval
+    }
+    if sweepEvery > 0 {
+        go srv.sweepHistory(sweepEvery)
+    }
+    srv.allowedSemantics = make(map[string]bool)
+    for _, sem := range strings.Split(*allowedSemFlag, ",") {
+        sem = strings.ToLower(strings.TrimSpace(sem))
+        if sem == "" {
+            continue
+        }
+        if sem != SemanticsAtLeastOnce && sem != SemanticsAtMostOnce {
+            log.Fatalf("Unknown semantics in -allowedSemantics: %s", sem)
+        }
+        srv.allowedSemantics[sem] = true
+    }
+    if *inflightFlag != InflightWait && *inflightFlag != InflightDrop {
+        log.Fatalf("Unknown -inflight policy: %s. Choose '%s' or '%s'.", *inflightFlag, InflightWait, InflightDrop)
+    }
+    srv.inflightPolicy = *inflightFlag
+    srv.maxSkew = *maxSkewFlag
+    srv.clockOffset = *clockOffsetFlag
+    if srv.clockOffset != 0 {
+        log.Printf("Server clock runs %v off the local clock (-clockOffset)", srv.clockOffset)
+    }
+    srv.slowOpThreshold = *slowOpFlag
+    if *maxInFlightFlag < 0 || *maxLockQueueFlag < 0 || *busyRetryAfterFlag < 0 {
+        log.Fatalf("-maxInFlight, -maxLockQueue and -busyRetryAfter must not be negative")
+    }
+    srv.overload = overloadLimits{
+        maxInFlight:  int64(*maxInFlightFlag),
+        maxLockQueue: int64(*maxLockQueueFlag),
+        retryAfter:   *busyRetryAfterFlag,
+    }
+    if *abuseThresholdFlag < 0 {
+        log.Fatalf("-abuseThreshold must not be negative")
+    }
+    if *abuseThresholdFlag > 0 {
+        if *abuseWindowFlag <= 0 || *abuseCooldownFlag <= 0 {
+            log.Fatalf("-abuseWindow and -abuseCooldown must be positive")
+        }
+        srv.abuse = newAbuseTracker(*abuseThresholdFlag, *abuseWindowFlag, *abuseCooldownFlag)
+    }
+    if *workersFlag < 0 || *queueSizeFlag < 1 || *readWeightFlag < 1 || *writeWeightFlag < 1 {
+        log.Fatalf("-workers must not be negative; -queueSize, -readWeight and -writeWeight must be at least 1")
+    }
+    if *workersFlag > 0 {
+        srv.scheduler = newPacketScheduler(*workersFlag, *queueSizeFlag, [numClasses]int{*readWeightFlag, *writeWeightFlag})
+        log.Printf("Scheduling requests on %d workers (read:write weight %d:%d)", *workersFlag, *readWeightFlag, *writeWeightFlag)
+    }
+    if *maxRequestSizeFlag <= 0 {
+        log.Fatalf("-maxRequestSize must be positive")
+    }
+    srv.maxRequestSize = *maxRequestSizeFlag
+    srv.compressThreshold = *compressFlag
+    srv.debugPackets = *debugFlag
+    srv.callbackBuffer = *callbackBufFlag
+    if *maxMonitorFlag < time.Second {
+        log.Fatalf("-maxMonitorPeriod must be at least 1s")
+    }
+    srv.maxMonitorPeriod = *maxMonitorFlag
+    if *dupCallbackFlag < 0 || *dupCallbackFlag > 1 {
+        log.Fatalf("-dupCallbackRate must be between 0 and 1")
+    }
+    srv.dupCallbackRate = *dupCallbackFlag
+    if *renameGraceFlag < 0 {
+        log.Fatalf("-renameGrace must not be negative")
+    }
+    srv.renameGrace = *renameGraceFlag
+    if *approvalTTLFlag <= 0 {
+        log.Fatalf("-approvalTTL must be positive")
+    }
+    srv.approvalTTL = *approvalTTLFlag
+    if srv.dupCallbackRate > 0 {
+        log.Printf("Sending %.0f%% of monitor callbacks twice (-dupCallbackRate)", srv.dupCallbackRate*100)
+    }
+    srv.clock, err = parseCurrentTime(*currentTimeFlag, srv.clockOffset)
+    if err != nil {
+        log.Fatalf("Invalid -currentTime: %v", err)
+    }
+    if *pastGraceFlag < 0 {
+        log.Fatalf("-pastGrace must not be negative")
+    }
+    srv.pastGrace = *pastGraceFlag
+    if srv.clock != nil {
+        log.Printf("Current time is %s (-currentTime=%s); started bookings need an admin to force changes", formatWeekMinutes(srv.clock()), *currentTimeFlag)
+    }
+    srv.rollover, err = newWeekRollover(*rolloverFlag, *archiveFileFlag, srv.clock)
+    if err != nil {
+        log.Fatalf("Invalid -rollover: %v", err)
+    }
+    if *changeJournalFlag < 0 {
+        log.Fatalf("-changeJournal must not be negative")
+    }
+    srv.changes = newChangeJournal(*changeJournalFlag)
+    if *idempotencyFlag < 0 {
+        log.Fatalf("-idempotencyWindow must not be negative")
+    }
+    srv.idempotency = newIdempotencyKeys(*idempotencyFlag)
+    // The rollover numbers its resets in the change journal and forgets the
+    // idempotency keys of the bookings it removes, so it starts once both exist
+    if srv.rollover != nil {
+        log.Printf("Applying -rollover=%s to last week's bookings at the start of each week", *rolloverFlag)
+        go srv.runRollover()
+    }
+    srv.newID, err = newIDGenerator(*idFormatFlag)
+    if err != nil {
+        log.Fatalf("Invalid -idFormat: %v", err)
+    }
+    srv.sessionIdle = *sessionIdleFlag
+    if *adminKeyFlag != "" {
+        if err := srv.registerAdmin(*adminUserFlag, *adminKeyFlag); err != nil {
+            log.Fatalf("Failed to create admin account: %v", err)
+        }
+        log.Printf("Admin account '%s' enabled", *adminUserFlag)
+    }
+    if srv.sessionIdle > 0 {
+        sweep := time.Minute
+        if srv.sessionIdle < sweep {
+            sweep = srv.sessionIdle
+        }
+        go srv.sweepSessions(sweep)
+    }
+    srv.security = common.PacketSecurity{Key: []byte(*authKeyFlag), Encrypt: *encryptFlag}
+    if err := srv.security.Validate(); err != nil {
+        log.Fatalf("%v", err)
+    }
+    if len(srv.security.Key) > 0 {
+        log.Printf("HMAC authentication enabled (encryption=%v)", srv.security.Encrypt)
+    }
+    if *keepaliveFlag > 0 {
+        go srv.sendKeepalives(*keepaliveFlag)
+    }
+
+    srv.publishServerMetrics()
+    srv.handleDumpSignal(*dumpDirFlag)
+    if *metricsAddrFlag != "" {
+        go serveMetrics(*metricsAddrFlag)
+    }
 
-    // Listen on UDP
-    addr := net.UDPAddr{IP: net.ParseIP("0.0.0.0"), Port: *portFlag}
-    conn, err := net.ListenUDP("udp", &addr)
+    // Load the optional config file
+    if *configFlag != "" {
+        cfg, err := LoadConfig(*configFlag)
+        if err != nil {
+            log.Fatalf("Failed to load config: %v", err)
+        }
+        if len(cfg.Webhooks) > 0 {
+            srv.resolveWebhooks(cfg.Webhooks)
+            srv.webhooks = NewWebhookNotifier(cfg.Webhooks)
+            log.Printf("Configured %d webhook(s)", len(cfg.Webhooks))
+        }
+        if err := srv.applyCapacities(cfg.Capacities); err != nil {
+            log.Fatalf("Failed to load config: %v", err)
+        }
+        if len(cfg.Capacities) > 0 {
+            log.Printf("Configured %d facility capacities", len(cfg.Capacities))
+        }
+        if err := srv.applyBlackouts(cfg.Blackouts); err != nil {
+            log.Fatalf("Failed to load config: %v", err)
+        }
+        if len(cfg.Blackouts) > 0 {
+            log.Printf("Configured %d blackout(s)", len(cfg.Blackouts))
+        }
+        if err := srv.applyApprovals(cfg.Approval); err != nil {
+            log.Fatalf("Failed to load config: %v", err)
+        }
+        if len(cfg.Approval) > 0 {
+            log.Printf("Configured %d facilities requiring approval", len(cfg.Approval))
+            sweep := time.Minute
+            if srv.approvalTTL < sweep {
+                sweep = srv.approvalTTL
+            }
+            go srv.sweepPending(sweep)
+        }
+    }
+
+    // Set up replication
+    srv.role = *roleFlag
+    switch srv.role {
+    case RolePrimary:
+        if *backupAddrFlag != "" {
+            srv.replicator, err = NewReplicator(srv, *replAddrFlag, *backupAddrFlag)
+            if err != nil {
+                log.Fatalf("Failed to start replication: %v", err)
+            }
+            log.Printf("Primary replicating to backup at %s", *backupAddrFlag)
+            go srv.replicator.RunPrimary()
+        }
+    case RoleBackup:
+        if *primaryAddrFlag == "" {
+            log.Fatalf("-role=backup requires -primaryAddr")
+        }
+        repl, err := NewReplicator(srv, *replAddrFlag, *primaryAddrFlag)
+        if err != nil {
+            log.Fatalf("Failed to start replication: %v", err)
+        }
+        log.Printf("Backup replicating from primary at %s", *primaryAddrFlag)
+        go repl.RunBackup()
+    default:
+        log.Fatalf("Unknown role: %s. Choose '%s' or '%s'.", srv.role, RolePrimary, RoleBackup)
+    }
+
+    // Listen on UDP; an empty or "::" address accepts both IPv4 and IPv6
+    addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(*listenAddrFlag, strconv.Itoa(*portFlag)))
     if err != nil {
-        log.Fatalf("Failed to listen on UDP port %d: %v", *portFlag, err)
+        log.Fatalf("Invalid -listenAddr %q: %v", *listenAddrFlag, err)
+    }
+    conns, err := listenUDP(addr, *listenersFlag)
+    if err != nil {
+        log.Fatalf("Failed to listen on UDP %s: %v", addr, err)
+    }
+    for _, c := range conns {
+        defer c.Close()
     }
-    defer conn.Close()
 
-    // Attach the connection to the server state so it can send replies/callbacks
-    srv.conn = conn
+    // Attach the first connection to the server state; replies and
+    // callbacks use the socket each request arrived on
+    srv.conn = conns[0]
 
-    log.Printf("Server listening on UDP %s with semantics=%s\n",
-        conn.LocalAddr().String(), semantics)
+    log.Printf("Server listening on UDP %s with semantics=%s (%d listener(s))\n",
+        srv.conn.LocalAddr().String(), semantics, len(conns))
 
-    // Read loop
-    buf := make([]byte, 2048)
-    for {
-        n, clientAddr, err := conn.ReadFromUDP(buf)
+    // Optional TCP listener sharing the same request path
+    if *tcpPortFlag != 0 {
+        ln, err := net.Listen("tcp", net.JoinHostPort(*listenAddrFlag, strconv.Itoa(*tcpPortFlag)))
         if err != nil {
-            log.Printf("ReadFromUDP error: %v\n", err)
-            continue
+            log.Fatalf("Failed to listen on TCP port %d: %v", *tcpPortFlag, err)
         }
+        defer ln.Close()
+        log.Printf("Server listening on TCP %s", ln.Addr())
+        go srv.serveTCP(ln)
+    }
 
-        // Handle in a goroutine if you want concurrency
-        go srv.handlePacket(buf[:n], clientAddr)
+    // One read loop per socket; the first runs on the main goroutine
+    for _, c := range conns[1:] {
+        go srv.serveUDP(c)
     }
+    srv.serveUDP(conns[0])
 }
@@ -0,0 +1,115 @@
+// server/metrics.go
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Counters published through expvar; with -metricsAddr they are served as
+// JSON at /debug/vars. Per-opcode maps are keyed by operation name.
+var (
+	metricExecuted    = expvar.NewMap("requests_executed")
+	metricFromHistory = expvar.NewMap("duplicates_from_history")
+	metricReexecuted  = expvar.NewMap("duplicates_reexecuted")
+)
+
+// latencyBuckets are the upper bounds of the operation latency histogram.
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// metricLatency counts processOperation durations per bucket ("le_<bound>"
+// or "inf"); metricLatencyUs holds the count and total in microseconds.
+var (
+	metricLatency   = expvar.NewMap("op_latency_buckets")
+	metricLatencyUs = expvar.NewMap("op_latency_us")
+)
+
+func observeLatency(d time.Duration) {
+	bucket := "inf"
+	for _, b := range latencyBuckets {
+		if d <= b {
+			bucket = "le_" + b.String()
+			break
+		}
+	}
+	metricLatency.Add(bucket, 1)
+	metricLatencyUs.Add("count", 1)
+	metricLatencyUs.Add("sum", d.Microseconds())
+}
+
+func opKey(op uint8) string {
+	return common.OpName(op)
+}
+
+// publishServerMetrics exposes counters that live on the ServerState.
+func (s *ServerState) publishServerMetrics() {
+	expvar.Publish("auth_failures", expvar.Func(func() any { return s.authFailures.Load() }))
+	expvar.Publish("decrypt_failures", expvar.Func(func() any { return s.decryptFailures.Load() }))
+	expvar.Publish("bad_magic_packets", expvar.Func(func() any { return s.badMagic.Load() }))
+	expvar.Publish("handler_panics", expvar.Func(func() any { return s.panics.Load() }))
+	if s.abuse != nil {
+		expvar.Publish("blocked_packets", expvar.Func(func() any { return s.abuse.dropped.Load() }))
+		expvar.Publish("abuse_sources", expvar.Func(func() any {
+			tracked, blocked := s.abuse.sizes()
+			return map[string]int{"tracked": tracked, "blocked": blocked}
+		}))
+	}
+	expvar.Publish("keepalives_sent", expvar.Func(func() any { return s.keepalivesSent.Load() }))
+	expvar.Publish("busy_replies", expvar.Func(func() any { return s.busyReplies.Load() }))
+	expvar.Publish("requests_in_flight", expvar.Func(func() any { return s.inFlight.Load() }))
+	expvar.Publish("lock_waiters", expvar.Func(func() any { return lockWaiters.Load() }))
+	if s.scheduler != nil {
+		expvar.Publish("queue_depth", expvar.Func(func() any { return s.scheduler.depths() }))
+	}
+	if l, ok := s.history.(interface{ Len() int }); ok {
+		expvar.Publish("history_size", expvar.Func(func() any { return l.Len() }))
+	}
+	if e, ok := s.history.(interface{ Evictions() uint64 }); ok {
+		expvar.Publish("history_evictions", expvar.Func(func() any { return e.Evictions() }))
+	}
+}
+
+// serveMetrics serves expvar on addr until the process exits.
+func serveMetrics(addr string) {
+	log.Printf("Serving metrics on http://%s/debug/vars", addr)
+	if err := http.ListenAndServe(addr, nil); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
+
+// recentRequests remembers the last few RequestKeys so duplicates can be
+// counted in at-least-once mode, where there is no history to consult.
+type recentRequests struct {
+	mu   sync.Mutex
+	seen map[RequestKey]bool
+	ring []RequestKey
+	next int
+}
+
+func newRecentRequests(size int) *recentRequests {
+	return &recentRequests{seen: make(map[RequestKey]bool), ring: make([]RequestKey, size)}
+}
+
+// observe records key and reports whether it was already among the recent ones.
+func (r *recentRequests) observe(key RequestKey) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[key] {
+		return true
+	}
+	if old := r.ring[r.next]; r.seen[old] {
+		delete(r.seen, old)
+	}
+	r.ring[r.next] = key
+	r.next = (r.next + 1) % len(r.ring)
+	r.seen[key] = true
+	return false
+}
@@ -0,0 +1,113 @@
+// server/metrics_test.go
+package main
+
+import (
+	"expvar"
+	"strconv"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// counter reads one key of a per-opcode expvar map. The maps are global, so
+// tests compare readings taken before and after.
+func counter(m *expvar.Map, op uint8) int64 {
+	if v, ok := m.Get(opKey(op)).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// TestDuplicateCounters sends an AddParticipant three times under each
+// semantics and checks what the counters say about the two duplicates.
+func TestDuplicateCounters(t *testing.T) {
+	tests := []struct {
+		semantics       string
+		wantExecuted    int64
+		wantFromHistory int64
+		wantReexecuted  int64
+	}{
+		{SemanticsAtMostOnce, 1, 2, 0},
+		{SemanticsAtLeastOnce, 3, 0, 2},
+	}
+	op := uint8(common.OpAddParticipant)
+	for _, tt := range tests {
+		t.Run(tt.semantics, func(t *testing.T) {
+			srv := newTestServer(t, tt.semantics)
+			p := newFakePeer("client")
+			executed, fromHistory, reexecuted := counter(metricExecuted, op), counter(metricFromHistory, op), counter(metricReexecuted, op)
+
+			for i := 0; i < 3; i++ {
+				if rep := send(t, srv, p, addParticipant(1, "Ada")); rep.Status != common.StatusOK {
+					t.Fatalf("attempt %d: status %d: %s", i+1, rep.Status, rep.Data)
+				}
+			}
+			// A different request from the same client is no duplicate
+			send(t, srv, p, addParticipant(2, "Grace"))
+
+			if got := counter(metricExecuted, op) - executed; got != tt.wantExecuted+1 {
+				t.Errorf("executed %d, want %d", got, tt.wantExecuted+1)
+			}
+			if got := counter(metricFromHistory, op) - fromHistory; got != tt.wantFromHistory {
+				t.Errorf("served from history %d, want %d", got, tt.wantFromHistory)
+			}
+			if got := counter(metricReexecuted, op) - reexecuted; got != tt.wantReexecuted {
+				t.Errorf("re-executed %d, want %d", got, tt.wantReexecuted)
+			}
+		})
+	}
+}
+
+func TestDuplicateCountersPerOpcode(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	queries, adds := counter(metricFromHistory, common.OpQueryAvailability), counter(metricFromHistory, common.OpAddParticipant)
+
+	req := common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 1, FacilityName: "RoomA", DaysList: []uint8{0}}
+	send(t, srv, p, req)
+	send(t, srv, p, req)
+	if got := counter(metricFromHistory, common.OpQueryAvailability) - queries; got != 1 {
+		t.Errorf("QueryAvailability served from history %d times, want 1", got)
+	}
+	if got := counter(metricFromHistory, common.OpAddParticipant) - adds; got != 0 {
+		t.Errorf("AddParticipant served from history %d times, want 0", got)
+	}
+}
+
+func TestRecentRequests(t *testing.T) {
+	r := newRecentRequests(2)
+	steps := []struct {
+		id   uint64
+		want bool
+	}{
+		{1, false},
+		{1, true},
+		{2, false},
+		{3, false}, // pushes 1 out
+		{1, false},
+		{3, true},
+	}
+	for i, step := range steps {
+		if got := r.observe(RequestKey{"client", step.id}); got != step.want {
+			t.Errorf("step %d: observe(%d) = %v, want %v", i, step.id, got, step.want)
+		}
+	}
+	if got := r.observe(RequestKey{"other", 3}); got {
+		t.Error("same RequestID from another client counted as a duplicate")
+	}
+}
+
+// TestMetricLabelsAreNames: the per-opcode metrics are keyed by operation
+// name, not number.
+func TestMetricLabelsAreNames(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	send(t, srv, newFakePeer("client"), addParticipant(1, "Ada"))
+	if metricExecuted.Get("AddParticipant") == nil {
+		t.Error("no AddParticipant key in the executed counters")
+	}
+	metricExecuted.Do(func(kv expvar.KeyValue) {
+		if _, err := strconv.Atoi(kv.Key); err == nil {
+			t.Errorf("numeric metric label %q", kv.Key)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// server/midnight_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// untilMidnight books facility on day from hour until 24:00, sent as 00:00
+// of the next day.
+func untilMidnight(id uint64, facility string, day, from uint8) common.RequestMessage {
+	req := bookReq(id, facility, day, from, 0)
+	req.EndDay = day + 1
+	return req
+}
+
+// availableOn returns the "Available timings:" of one day of a query.
+func availableOn(t *testing.T, srv *ServerState, id uint64, facility string, day uint8) string {
+	t.Helper()
+	out := queryData(t, srv, id, []uint8{day}, facility)
+	_, timings, ok := strings.Cut(out, "Available timings: ")
+	if !ok {
+		t.Fatalf("no available timings in:\n%s", out)
+	}
+	timings, _, _ = strings.Cut(timings, "\n")
+	return timings
+}
+
+func TestFullDayBooking(t *testing.T) {
+	for day, reply := range map[uint8]string{
+		4: "Booked 'RoomA' from Friday 00:00 to Saturday 00:00.",
+		6: "Booked 'RoomA' from Sunday 00:00 to Sunday 24:00.",
+	} {
+		srv := newTestServer(t, SemanticsAtMostOnce)
+		p := newFakePeer("client")
+		rep := send(t, srv, p, untilMidnight(1, "RoomA", day, 0))
+		if !strings.HasPrefix(rep.Data, reply) {
+			t.Errorf("booking reply %q, want %q", rep.Data, reply)
+		}
+		confirmationID(t, rep)
+		if got := availableOn(t, srv, 2, "RoomA", day); got != "Fully booked" {
+			t.Errorf("day %d: %q, want Fully booked", day, got)
+		}
+		if day < 6 {
+			if got := availableOn(t, srv, 3, "RoomA", day+1); got != "00:00-24:00" {
+				t.Errorf("day after %d: %q, want all of it free", day, got)
+			}
+		}
+	}
+}
+
+// TestBackToBackAcrossMidnight: a booking until 24:00 and one from 00:00
+// the next day adjoin without conflict, and leave no minute free between
+// them.
+func TestBackToBackAcrossMidnight(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, untilMidnight(1, "Lab1", 3, 22)))
+	confirmationID(t, send(t, srv, p, bookReq(2, "Lab1", 4, 0, 2)))
+
+	if got := availableOn(t, srv, 3, "Lab1", 3); got != "00:00-22:00" {
+		t.Errorf("Thursday: %q, want 00:00-22:00 with no 23:59-24:00", got)
+	}
+	if got := availableOn(t, srv, 4, "Lab1", 4); got != "02:00-24:00" {
+		t.Errorf("Friday: %q, want 02:00-24:00", got)
+	}
+
+	over := bookReq(5, "Lab1", 3, 23, 1)
+	over.StartMinute, over.EndDay = 59, 4
+	for i, req := range []common.RequestMessage{over, untilMidnight(6, "Lab1", 3, 23), bookReq(7, "Lab1", 4, 0, 1)} {
+		if rep := send(t, srv, p, req); rep.Status == common.StatusOK {
+			t.Errorf("booking %d overlapping the pair accepted: %s", i+1, rep.Data)
+		}
+	}
+}
+
+// TestEndOfWeek: Sunday 24:00 is the last end a booking may have.
+func TestEndOfWeek(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, untilMidnight(1, "RoomA", 6, 23)))
+	if got := availableOn(t, srv, 2, "RoomA", 6); got != "00:00-23:00" {
+		t.Errorf("Sunday: %q", got)
+	}
+	past := untilMidnight(3, "Lab1", 6, 23)
+	past.EndMinute = 1
+	if rep := send(t, srv, p, past); rep.Status != common.StatusInvalidArgument {
+		t.Errorf("end past Sunday 24:00: status %d: %s", rep.Status, rep.Data)
+	}
+}
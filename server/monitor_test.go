@@ -0,0 +1,323 @@
+// server/monitor_test.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// monitorReq registers on RoomA for a minute, limited to days and events.
+func monitorReq(id uint64, days []uint8, events uint8) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: id, FacilityName: "RoomA",
+		MonitorPeriod: 60, DaysList: days, EventMask: events}
+}
+
+// spanReq is a BookFacility request of RoomA from one day and hour to
+// another.
+func spanReq(id uint64, startDay, startHour, endDay, endHour uint8) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpBookFacility, RequestID: id, FacilityName: "RoomA",
+		StartDay: startDay, StartHour: startHour, EndDay: endDay, EndHour: endHour}
+}
+
+func TestMonitorDays(t *testing.T) {
+	tests := []struct {
+		name     string
+		days     []uint8
+		booking  common.RequestMessage
+		notified bool
+	}{
+		{"other day", []uint8{4}, spanReq(10, 0, 10, 0, 11), false},
+		{"watched day", []uint8{4}, spanReq(10, 4, 10, 4, 11), true},
+		{"one of several days", []uint8{1, 4}, spanReq(10, 4, 10, 4, 11), true},
+		{"all days", nil, spanReq(10, 0, 10, 0, 11), true},
+		{"across the watched day", []uint8{4}, spanReq(10, 3, 22, 5, 1), true},
+		{"into the watched day", []uint8{4}, spanReq(10, 3, 22, 4, 1), true},
+		{"out of the watched day", []uint8{4}, spanReq(10, 4, 23, 5, 2), true},
+		{"ending as the watched day starts", []uint8{4}, spanReq(10, 3, 22, 4, 0), false},
+		{"starting as the watched day ends", []uint8{4}, spanReq(10, 5, 0, 5, 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			watcher := newFakePeer("watcher")
+			if rep := send(t, srv, watcher, monitorReq(1, tt.days, 0)); rep.Status != common.StatusOK {
+				t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+			}
+			confirmationID(t, send(t, srv, newFakePeer("client"), tt.booking))
+			if got := len(watcher.callbacks()) > 0; got != tt.notified {
+				t.Errorf("notified = %v, want %v", got, tt.notified)
+			}
+		})
+	}
+}
+
+// TestMonitorDaysCancel: a cancellation is filtered by the days of the
+// booking it removes.
+func TestMonitorDaysCancel(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	client := newFakePeer("client")
+	friday := confirmationID(t, send(t, srv, client, spanReq(10, 4, 10, 4, 11)))
+	monday := confirmationID(t, send(t, srv, client, spanReq(11, 0, 12, 0, 13)))
+
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, monitorReq(1, []uint8{4}, 0))
+	send(t, srv, client, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 12, ConfirmationID: monday})
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Fatalf("%d callbacks for a Monday cancellation", n)
+	}
+	send(t, srv, client, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 13, ConfirmationID: friday})
+	if n := len(watcher.callbacks()); n != 1 {
+		t.Errorf("%d callbacks for a Friday cancellation, want 1", n)
+	}
+}
+
+func TestMonitorDaysInvalid(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	if rep := send(t, srv, watcher, monitorReq(1, []uint8{7}, 0)); rep.Status != common.StatusInvalidArgument {
+		t.Errorf("day 7: status %d: %s", rep.Status, rep.Data)
+	}
+	send(t, srv, newFakePeer("client"), spanReq(10, 4, 10, 4, 11))
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Errorf("refused registration got %d callbacks", n)
+	}
+}
+
+// events returns the event types of the callbacks p received.
+func events(t *testing.T, p *fakePeer) []uint8 {
+	t.Helper()
+	var got []uint8
+	for _, cb := range p.callbacks() {
+		event, ok := common.CallbackEvent(cb)
+		if !ok {
+			t.Fatalf("callback without an event type: %q", cb.Data)
+		}
+		got = append(got, event)
+	}
+	return got
+}
+
+func TestMonitorEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		mask uint8
+		want []uint8
+	}{
+		{"all events", 0, []uint8{common.EventCreated, common.EventParticipant, common.EventChanged, common.EventCanceled}},
+		{"cancellations", common.EventCanceled, []uint8{common.EventCanceled}},
+		{"bookings", common.EventCreated | common.EventChanged, []uint8{common.EventCreated, common.EventChanged}},
+		{"participants", common.EventParticipant, []uint8{common.EventParticipant}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			watcher := newFakePeer("watcher")
+			send(t, srv, watcher, monitorReq(1, nil, tt.mask))
+
+			client := newFakePeer("client")
+			id := confirmationID(t, send(t, srv, client, bookReq(10, "RoomA", 2, 10, 11)))
+			send(t, srv, client, common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 11, ConfirmationID: id, ParticipantName: "Ada"})
+			send(t, srv, client, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 12, ConfirmationID: id, OffsetMinutes: 60})
+			send(t, srv, client, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 13, ConfirmationID: id})
+
+			got := events(t, watcher)
+			if len(got) != len(tt.want) {
+				t.Fatalf("events %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("events %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorPeriod(t *testing.T) {
+	tests := []struct {
+		period  uint32
+		status  int32
+		granted time.Duration
+	}{
+		{0, common.StatusInvalidArgument, 0},
+		{1, common.StatusOK, time.Second},
+		{3599, common.StatusOK, 3599 * time.Second},
+		{3600, common.StatusOK, time.Hour},
+		{3601, common.StatusOK, time.Hour},
+		{math.MaxUint32, common.StatusOK, time.Hour},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, SemanticsAtMostOnce)
+		srv.maxMonitorPeriod = time.Hour
+		req := monitorReq(1, nil, 0)
+		req.MonitorPeriod = tt.period
+		start := srv.now()
+		rep := send(t, srv, newFakePeer("watcher"), req)
+		if rep.Status != tt.status {
+			t.Errorf("period %d: status %d: %s", tt.period, rep.Status, rep.Data)
+			continue
+		}
+		if tt.status != common.StatusOK {
+			if len(srv.monitorSubs) != 0 {
+				t.Errorf("period %d: refused registration was kept", tt.period)
+			}
+			continue
+		}
+		if capped := strings.Contains(rep.Data, "the server allows at most 3600"); capped != (time.Duration(tt.period)*time.Second > time.Hour) {
+			t.Errorf("period %d: reply %q", tt.period, rep.Data)
+		}
+		if want := fmt.Sprintf(" for %d seconds", tt.granted/time.Second); !strings.Contains(rep.Data, want) {
+			t.Errorf("period %d: reply %q lacks %q", tt.period, rep.Data, want)
+		}
+		if got := srv.monitorSubs[0].ExpiresAt.Sub(start); got < tt.granted || got > tt.granted+time.Second {
+			t.Errorf("period %d: subscription lasts %v, want %v", tt.period, got, tt.granted)
+		}
+		_, field, _ := strings.Cut(rep.Data, "Expires=")
+		field, _, _ = strings.Cut(field, " ")
+		expiry, err := time.Parse(time.RFC3339, field)
+		if err != nil {
+			t.Errorf("period %d: no expiry in %q", tt.period, rep.Data)
+		} else if d := expiry.Sub(srv.monitorSubs[0].ExpiresAt); d < -time.Second || d > time.Second {
+			t.Errorf("period %d: reply says it expires at %v, subscription at %v", tt.period, expiry, srv.monitorSubs[0].ExpiresAt)
+		}
+	}
+}
+
+// TestMonitorReregister: registering twice extends the one subscription,
+// so each change arrives once and the later expiry wins whichever order
+// the periods come in.
+func TestMonitorReregister(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second uint32
+		want          time.Duration
+	}{
+		{"longer second", 60, 600, 600 * time.Second},
+		{"shorter second", 600, 60, 600 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			watcher := newFakePeer("watcher")
+			start := srv.now()
+			req := monitorReq(1, nil, 0)
+			req.MonitorPeriod = tt.first
+			first := send(t, srv, watcher, req)
+			req.RequestID, req.MonitorPeriod = 2, tt.second
+			second := send(t, srv, watcher, req)
+			if !strings.HasPrefix(second.Data, "Extended monitoring of RoomA") {
+				t.Errorf("second registration: %s", second.Data)
+			}
+			_, token1, _ := strings.Cut(first.Data, "Token=")
+			_, token2, _ := strings.Cut(second.Data, "Token=")
+			if token1 != token2 {
+				t.Errorf("token changed from %q to %q", token1, token2)
+			}
+
+			if len(srv.monitorSubs) != 1 {
+				t.Fatalf("%d subscriptions, want 1", len(srv.monitorSubs))
+			}
+			if got := srv.monitorSubs[0].ExpiresAt.Sub(start); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("subscription lasts %v, want %v", got, tt.want)
+			}
+			send(t, srv, newFakePeer("client"), addParticipant(3, "Ada"))
+			if got := seqs(watcher); len(got) != 1 || got[0] != 1 {
+				t.Errorf("callbacks %v, want a single one", got)
+			}
+		})
+	}
+}
+
+// TestMonitorReregisterFilters: the filters of the repeat registration
+// replace the old ones.
+func TestMonitorReregisterFilters(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, monitorReq(1, []uint8{0}, 0))
+	send(t, srv, watcher, monitorReq(2, []uint8{4}, 0))
+	client := newFakePeer("client")
+	confirmationID(t, send(t, srv, client, spanReq(10, 0, 12, 0, 13)))
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Fatalf("%d callbacks for a Monday booking after switching to Friday", n)
+	}
+	confirmationID(t, send(t, srv, client, spanReq(11, 4, 12, 4, 13)))
+	if n := len(watcher.callbacks()); n != 1 {
+		t.Errorf("%d callbacks for a Friday booking, want 1", n)
+	}
+}
+
+// TestMonitorReregisterSession: a session user registering again from a
+// new address moves the subscription there rather than adding one.
+func TestMonitorReregisterSession(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	before, after := newFakePeer("old-port"), newFakePeer("new-port")
+	req := monitorReq(2, nil, 0)
+	req.SessionToken = login(t, srv, before, 1, "alice", "pw")
+	send(t, srv, before, req)
+	req.RequestID = 3
+	if rep := send(t, srv, after, req); !strings.HasPrefix(rep.Data, "Extended") {
+		t.Errorf("registration from the new address: %s", rep.Data)
+	}
+	send(t, srv, newFakePeer("client"), addParticipant(4, "Ada"))
+	if n, m := len(before.callbacks()), len(after.callbacks()); n != 0 || m != 1 {
+		t.Errorf("old address got %d callbacks and new %d, want 0 and 1", n, m)
+	}
+}
+
+// TestListMonitors registers a few subscriptions, lets one expire, and
+// reads the admin listing back.
+func TestListMonitors(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	if err := srv.registerAdmin("admin", "key"); err != nil {
+		t.Fatalf("registerAdmin: %v", err)
+	}
+	admin := newFakePeer("admin")
+	adminToken := login(t, srv, admin, 1, "admin", "key")
+
+	send(t, srv, newFakePeer("alpha"), monitorReq(2, []uint8{1, 4}, common.EventCreated))
+	bob := newFakePeer("bob-laptop")
+	lab := monitorReq(3, nil, 0)
+	lab.FacilityName, lab.MonitorPeriod = "Lab1", 600
+	lab.SessionToken = login(t, srv, bob, 4, "bob", "pw")
+	send(t, srv, bob, lab)
+	send(t, srv, newFakePeer("gone"), monitorReq(5, nil, 0))
+	srv.monitorLock.Lock()
+	srv.monitorSubs[len(srv.monitorSubs)-1].ExpiresAt = srv.now().Add(-time.Second)
+	srv.monitorLock.Unlock()
+
+	rep := send(t, srv, admin, common.RequestMessage{OpCode: common.OpListMonitors, RequestID: 6, SessionToken: adminToken})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("list: status %d: %s", rep.Status, rep.Data)
+	}
+	got, err := common.ParseMonitorList(rep.Data)
+	if err != nil {
+		t.Fatalf("ParseMonitorList(%q): %v", rep.Data, err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("listed %d subscriptions, want 2 without the expired one:\n%s", len(got), rep.Data)
+	}
+	want := []common.MonitorInfo{
+		{Facility: "Lab1", Subscriber: "bob-laptop (bob)", Remaining: 600 * time.Second},
+		{Facility: "RoomA", Subscriber: "alpha", Remaining: 60 * time.Second, Days: []uint8{1, 4}, Events: common.EventCreated},
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Facility != w.Facility || g.Subscriber != w.Subscriber || !reflect.DeepEqual(g.Days, w.Days) || g.Events != w.Events || g.Failures != 0 {
+			t.Errorf("entry %d = %+v, want %+v", i, g, w)
+		}
+		if g.Remaining < w.Remaining-time.Second || g.Remaining > w.Remaining {
+			t.Errorf("entry %d: %v left, want %v", i, g.Remaining, w.Remaining)
+		}
+	}
+
+	if rep := send(t, srv, newFakePeer("alpha"), common.RequestMessage{OpCode: common.OpListMonitors, RequestID: 7}); rep.Status == common.StatusOK {
+		t.Errorf("listing without an admin session: %s", rep.Data)
+	}
+}
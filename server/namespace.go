@@ -0,0 +1,199 @@
+// server/namespace.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// EventNamespaceDeleted is reported to webhooks and subscribers of each
+// facility of a namespace the admin deletes.
+const EventNamespaceDeleted = "namespace_deleted"
+
+// namespaceSep separates the namespace from the facility name in qualified
+// names. Namespace and facility names are plain text, so it occurs in
+// neither.
+const namespaceSep = "\x1f"
+
+// qualify is how a facility name of namespace ns is written where one key
+// serves every namespace: in the store, the change journal, the idempotency
+// keys and the rename records. Names in the default namespace are kept as
+// they are, so stores written before namespaces existed load unchanged.
+func qualify(ns, name string) string {
+	if ns == common.DefaultNamespace {
+		return name
+	}
+	return ns + namespaceSep + name
+}
+
+// splitQualified undoes qualify.
+func splitQualified(key string) (ns, name string) {
+	if ns, name, ok := strings.Cut(key, namespaceSep); ok {
+		return ns, name
+	}
+	return common.DefaultNamespace, key
+}
+
+// configFacility splits a facility named in the config file into its
+// namespace and name: "ns/name" is a facility of namespace ns and a bare
+// name one of the default namespace. Facility names may contain '/', so a
+// prefix that is not an existing namespace is part of the name. The caller
+// holds dataLock.
+func (s *ServerState) configFacility(key string) (ns, name string) {
+	if ns, name, ok := strings.Cut(key, "/"); ok && s.facilityData[ns] != nil {
+		return ns, name
+	}
+	return common.DefaultNamespace, key
+}
+
+// partitionFacilities sorts the facilities loaded from the store, keyed by
+// qualified name, into namespaces. The default namespace always exists.
+func partitionFacilities(loaded map[string]*FacilityInfo) map[string]map[string]*FacilityInfo {
+	data := map[string]map[string]*FacilityInfo{common.DefaultNamespace: {}}
+	for key, fac := range loaded {
+		ns, name := splitQualified(key)
+		if data[ns] == nil {
+			data[ns] = make(map[string]*FacilityInfo)
+		}
+		fac.Name = name
+		data[ns][name] = fac
+	}
+	return data
+}
+
+// namespaceLabel is how namespace ns is written in webhook events and
+// archive lines: not at all for the default namespace, so those stay as
+// they were before namespaces.
+func namespaceLabel(ns string) string {
+	if ns == common.DefaultNamespace {
+		return ""
+	}
+	return ns
+}
+
+// namespaceNotFound is the reply text for a namespace that does not exist.
+func namespaceNotFound(ns string) string {
+	return fmt.Sprintf("Namespace '%s' not found", ns)
+}
+
+// hasNamespace reports whether namespace ns exists.
+func (s *ServerState) hasNamespace(ns string, t *opTiming) bool {
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+	_, ok := s.facilityData[ns]
+	return ok
+}
+
+// handleCreateNamespace adds a namespace with the facilities named in
+// req.MoreFacilities, all empty. Bookings made in it get IDs from the same
+// generator as every other namespace, so an ID names one booking anywhere.
+func (s *ServerState) handleCreateNamespace(req common.RequestMessage, t *opTiming) (string, int32) {
+	ns := req.TargetNamespace
+	log.Printf("Handling CreateNamespace '%s' with facilities %v", ns, req.MoreFacilities)
+	if err := validate.ValidateNamespace(ns); err != nil {
+		t.reject("TargetNamespace", ns)
+		return fmt.Sprintf("Error: %v", err), common.StatusInvalidArgument
+	}
+	if len(req.MoreFacilities) == 0 {
+		t.reject("MoreFacilities", "")
+		return "Error: a namespace needs at least one facility", common.StatusInvalidArgument
+	}
+	seen := make(map[string]bool, len(req.MoreFacilities))
+	for _, name := range req.MoreFacilities {
+		if err := validate.ValidateFacilityName(name); err != nil {
+			rejectField(t, err)
+			return fmt.Sprintf("Error: %v", err), common.StatusInvalidArgument
+		}
+		if seen[validate.FacilityKey(name)] {
+			t.reject("MoreFacilities", name)
+			return fmt.Sprintf("Error: facility '%s' is listed twice", name), common.StatusInvalidArgument
+		}
+		seen[validate.FacilityKey(name)] = true
+	}
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+	if _, ok := s.facilityData[ns]; ok {
+		t.reject("TargetNamespace", ns)
+		return fmt.Sprintf("Namespace '%s' already exists", ns), common.StatusConflict
+	}
+	facilities := make(map[string]*FacilityInfo, len(req.MoreFacilities))
+	for _, name := range req.MoreFacilities {
+		if err := s.store.SaveFacility(qualify(ns, name)); err != nil {
+			log.Printf("Failed to persist facility '%s' of namespace '%s': %v", name, ns, err)
+			return "Error: could not save the namespace.", -1
+		}
+		facilities[name] = &FacilityInfo{Name: name}
+		s.facilityNames.add(ns, name)
+	}
+	s.facilityData[ns] = facilities
+	log.Printf("CreateNamespace successful: '%s' with %d facilities", ns, len(facilities))
+	return fmt.Sprintf("Created namespace '%s' with facilities %s.", ns, strings.Join(req.MoreFacilities, ", ")), 0
+}
+
+// handleDeleteNamespace removes a namespace with its facilities and
+// bookings. Its subscribers are told, as after a rollover, and their
+// subscriptions end. The default namespace cannot be deleted.
+func (s *ServerState) handleDeleteNamespace(req common.RequestMessage, t *opTiming) (string, int32) {
+	ns := req.TargetNamespace
+	log.Printf("Handling DeleteNamespace '%s'", ns)
+	if !req.Confirm {
+		t.reject("Confirm", false)
+		return "Error: deleting a namespace must be confirmed", common.StatusInvalidArgument
+	}
+	if ns == common.DefaultNamespace {
+		t.reject("TargetNamespace", ns)
+		return "Error: the default namespace cannot be deleted", common.StatusInvalidArgument
+	}
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+	facilities, ok := s.facilityData[ns]
+	if !ok {
+		t.reject("TargetNamespace", ns)
+		return namespaceNotFound(ns), -1
+	}
+	names := make([]string, 0, len(facilities))
+	for name := range facilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := s.store.DeleteFacility(qualify(ns, name)); err != nil {
+			log.Printf("Failed to delete facility '%s' of namespace '%s' from store: %v", name, ns, err)
+			return fmt.Sprintf("Error: could not delete facility '%s'; the namespace is left in place.", name), -1
+		}
+	}
+	removed := 0
+	for _, name := range names {
+		removed += len(facilities[name].Bookings)
+		s.notifySubscribers(ns, name, EventNamespaceDeleted, "",
+			fmt.Sprintf("Namespace %s deleted with %d bookings", ns, len(facilities[name].Bookings)), nil)
+	}
+	delete(s.facilityData, ns)
+	s.facilityNames.dropNamespace(ns)
+	for key := range s.renamed {
+		if owner, _ := splitQualified(key); owner == ns {
+			delete(s.renamed, key)
+		}
+	}
+
+	s.monitorLock.Lock()
+	subs := s.monitorSubs[:0]
+	for _, sub := range s.monitorSubs {
+		if sub.Namespace != ns {
+			subs = append(subs, sub)
+		}
+	}
+	s.monitorSubs = subs
+	s.monitorLock.Unlock()
+
+	log.Printf("DeleteNamespace successful: '%s' with %d facilities and %d bookings", ns, len(names), removed)
+	return fmt.Sprintf("Deleted namespace '%s' with %d facilities and %d bookings.", ns, len(names), removed), 0
+}
@@ -0,0 +1,261 @@
+// server/namespace_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// inNamespace returns req working in namespace ns.
+func inNamespace(ns string, req common.RequestMessage) common.RequestMessage {
+	req.Namespace = ns
+	return req
+}
+
+// physicsServer has the seeded default namespace and a "physics" namespace
+// holding its own, empty RoomA and Lab1 and a Cryo the default lacks.
+func physicsServer(t *testing.T) *ServerState {
+	t.Helper()
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	rep := admin(common.RequestMessage{OpCode: common.OpCreateNamespace, RequestID: 1,
+		TargetNamespace: "physics", MoreFacilities: []string{"RoomA", "Lab1", "Cryo"}})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("create namespace: status %d: %s", rep.Status, rep.Data)
+	}
+	return srv
+}
+
+// TestNamespaceIsolation books the same window of RoomA in two namespaces
+// and checks that neither sees, changes or hears about the other's booking.
+func TestNamespaceIsolation(t *testing.T) {
+	srv := physicsServer(t)
+	p := newFakePeer("client")
+	watcher := newFakePeer("watcher")
+	if rep := send(t, srv, watcher, inNamespace("physics", monitorReq(1, nil, 0))); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// Monday 09:00-10:00 is BKG-10000 in the default namespace only
+	if rep := send(t, srv, p, bookReq(2, "RoomA", 0, 9, 10)); rep.Status != common.StatusConflict {
+		t.Fatalf("default booking over BKG-10000: status %d: %s", rep.Status, rep.Data)
+	}
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Errorf("physics monitor told of %d default-namespace events", n)
+	}
+	physics := confirmationID(t, send(t, srv, p, inNamespace("physics", bookReq(3, "RoomA", 0, 9, 10))))
+	if physics == "BKG-10000" {
+		t.Fatal("the physics booking reused a default-namespace ID")
+	}
+	if n := len(watcher.callbacks()); n != 1 {
+		t.Errorf("physics monitor got %d callbacks for a physics booking, want 1", n)
+	}
+
+	physicsQuery := send(t, srv, p, inNamespace("physics", common.RequestMessage{OpCode: common.OpQueryAvailability,
+		RequestID: 4, FacilityName: "RoomA", DaysList: []uint8{0, 1}}))
+	if !strings.Contains(physicsQuery.Data, physics) || strings.Contains(physicsQuery.Data, "BKG-1000") {
+		t.Errorf("physics query:\n%s", physicsQuery.Data)
+	}
+	if got := queryData(t, srv, 5, []uint8{0, 1}, "RoomA"); strings.Contains(got, physics) || !strings.Contains(got, "BKG-10001") {
+		t.Errorf("default query:\n%s", got)
+	}
+
+	// IDs of the other namespace are not found, and the booking stays
+	for i, req := range []common.RequestMessage{
+		{OpCode: common.OpCancelBooking, ConfirmationID: physics},
+		{OpCode: common.OpChangeBooking, ConfirmationID: physics, OffsetMinutes: 60},
+		{OpCode: common.OpAddParticipant, ConfirmationID: physics, ParticipantName: "Ada"},
+	} {
+		req.RequestID = uint64(10 + i)
+		rep := send(t, srv, p, req)
+		if !strings.Contains(rep.Data, "Booking "+physics+" not found") {
+			t.Errorf("%s from the default namespace: status %d: %s", common.OpName(req.OpCode), rep.Status, rep.Data)
+		}
+	}
+	if rep := send(t, srv, p, inNamespace("physics", common.RequestMessage{OpCode: common.OpCancelBooking,
+		RequestID: 13, ConfirmationID: "BKG-10000"})); !strings.Contains(rep.Data, "not found") {
+		t.Errorf("physics cancel of BKG-10000: %s", rep.Data)
+	}
+	if facilityBookings(srv, "RoomA")[0] != "BKG-10000" {
+		t.Error("BKG-10000 was cancelled from another namespace")
+	}
+	if start, _ := bookingInterval(t, srv, "BKG-10000"); start != 9*60 {
+		t.Errorf("BKG-10000 moved to minute %d", start)
+	}
+
+	// Cryo exists only in physics
+	if got := send(t, srv, p, bookReq(14, "Cryo", 2, 9, 10)); !strings.Contains(got.Data, "Facility 'Cryo' not found") {
+		t.Errorf("default booking of Cryo: status %d: %s", got.Status, got.Data)
+	}
+	// A second booking without an idempotency key is not taken for a repeat
+	if rep := send(t, srv, p, inNamespace("physics", bookReq(15, "Cryo", 2, 9, 10))); rep.Status != common.StatusOK {
+		t.Errorf("physics booking of Cryo: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// Free-busy and find look at the caller's namespace only
+	freeBusy := send(t, srv, p, inNamespace("physics", freeBusyReq(16, 0, 9, 10)))
+	if freeBusy.Data != "Free Mon 09:00 to Mon 10:00: Cryo, Lab1\nBusy Mon 09:00 to Mon 10:00: RoomA ("+physics+")\n" {
+		t.Errorf("physics free-busy:\n%s", freeBusy.Data)
+	}
+	if got := send(t, srv, p, freeBusyReq(17, 2, 9, 10)).Data; strings.Contains(got, "Cryo") {
+		t.Errorf("default free-busy lists Cryo:\n%s", got)
+	}
+	if rep := send(t, srv, p, inNamespace("physics", common.RequestMessage{OpCode: common.OpAddParticipant,
+		RequestID: 18, ConfirmationID: physics, ParticipantName: "Ada"})); rep.Status != common.StatusOK {
+		t.Fatalf("add participant: status %d: %s", rep.Status, rep.Data)
+	}
+	if rep := send(t, srv, p, findReq(19, "Ada", "", common.MatchExact)); strings.Contains(rep.Data, physics) {
+		t.Errorf("default find shows the physics booking:\n%s", rep.Data)
+	}
+	if rep := send(t, srv, p, inNamespace("physics", findReq(20, "Ada", "", common.MatchExact))); !strings.Contains(rep.Data, physics) {
+		t.Errorf("physics find:\n%s", rep.Data)
+	}
+
+	if rep := send(t, srv, p, inNamespace("chem", bookReq(21, "RoomA", 2, 9, 10))); rep.Status != -1 || rep.Data != "Namespace 'chem' not found" {
+		t.Errorf("unknown namespace: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestNamespaceIdempotencyKeys: one key names a booking per namespace, so
+// the same key books in each.
+func TestNamespaceIdempotencyKeys(t *testing.T) {
+	srv := physicsServer(t)
+	p := newFakePeer("client")
+	keyed := bookReq(1, "Lab1", 2, 9, 10)
+	keyed.IdempotencyKey = "weekly-sync"
+	first := confirmationID(t, send(t, srv, p, keyed))
+	keyed.RequestID = 2
+	second := confirmationID(t, send(t, srv, p, inNamespace("physics", keyed)))
+	if first == second {
+		t.Fatalf("the physics booking repeated the default one: %s", first)
+	}
+	keyed.RequestID = 3
+	if again := confirmationID(t, send(t, srv, p, inNamespace("physics", keyed))); again != second {
+		t.Errorf("retry in physics gave %s, want %s", again, second)
+	}
+}
+
+func TestCreateNamespaceRefused(t *testing.T) {
+	srv := physicsServer(t)
+	admin := adminSender(t, srv)
+	tests := []struct {
+		name   string
+		req    common.RequestMessage
+		status int32
+	}{
+		{"bad name", common.RequestMessage{TargetNamespace: "Chem", MoreFacilities: []string{"Lab1"}}, common.StatusInvalidArgument},
+		{"no facilities", common.RequestMessage{TargetNamespace: "chem"}, common.StatusInvalidArgument},
+		{"listed twice", common.RequestMessage{TargetNamespace: "chem", MoreFacilities: []string{"Lab1", "lab1"}}, common.StatusInvalidArgument},
+		{"exists", common.RequestMessage{TargetNamespace: "physics", MoreFacilities: []string{"Lab9"}}, common.StatusConflict},
+		{"default", common.RequestMessage{TargetNamespace: common.DefaultNamespace, MoreFacilities: []string{"Lab9"}}, common.StatusConflict},
+	}
+	for i, tt := range tests {
+		tt.req.OpCode = common.OpCreateNamespace
+		tt.req.RequestID = uint64(10 + i)
+		if rep := admin(tt.req); rep.Status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rep.Status, tt.status, rep.Data)
+		}
+	}
+	if _, ok := srv.facilityData["chem"]; ok {
+		t.Error("a refused create left namespace chem")
+	}
+	if _, ok := srv.facilityData["physics"]["Lab9"]; ok {
+		t.Error("creating an existing namespace added to it")
+	}
+
+	rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpCreateNamespace, RequestID: 20,
+		TargetNamespace: "chem", MoreFacilities: []string{"Lab1"}})
+	if rep.Status != common.StatusPermissionDenied {
+		t.Errorf("create without a session: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	srv := physicsServer(t)
+	admin := adminSender(t, srv)
+	p := newFakePeer("client")
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, inNamespace("physics", monitorReq(1, nil, 0)))
+	send(t, srv, watcher, monitorReq(2, nil, 0))
+	id := confirmationID(t, send(t, srv, p, inNamespace("physics", bookReq(3, "RoomA", 2, 9, 10))))
+	before := len(watcher.callbacks())
+
+	for i, req := range []common.RequestMessage{
+		{TargetNamespace: "physics"},
+		{TargetNamespace: common.DefaultNamespace, Confirm: true},
+	} {
+		req.OpCode = common.OpDeleteNamespace
+		req.RequestID = uint64(10 + i)
+		if rep := admin(req); rep.Status != common.StatusInvalidArgument {
+			t.Errorf("delete %+v: status %d: %s", req, rep.Status, rep.Data)
+		}
+	}
+	if rep := admin(common.RequestMessage{OpCode: common.OpDeleteNamespace, RequestID: 12, TargetNamespace: "chem", Confirm: true}); rep.Data != "Namespace 'chem' not found" {
+		t.Errorf("delete of an unknown namespace: %s", rep.Data)
+	}
+
+	rep := admin(common.RequestMessage{OpCode: common.OpDeleteNamespace, RequestID: 13, TargetNamespace: "physics", Confirm: true})
+	if rep.Status != common.StatusOK || rep.Data != "Deleted namespace 'physics' with 3 facilities and 1 bookings." {
+		t.Fatalf("delete: status %d: %s", rep.Status, rep.Data)
+	}
+	cbs := watcher.callbacks()[before:]
+	if len(cbs) != 1 || !strings.Contains(cbs[0].Data, "Namespace physics deleted with 1 bookings") {
+		t.Errorf("physics subscriber told %+v, want one deletion notice for its RoomA", cbs)
+	}
+	srv.monitorLock.Lock()
+	subs := len(srv.monitorSubs)
+	srv.monitorLock.Unlock()
+	if subs != 1 {
+		t.Errorf("%d subscriptions left, want only the default namespace's", subs)
+	}
+
+	if rep := send(t, srv, p, inNamespace("physics", bookReq(4, "RoomA", 2, 9, 10))); rep.Data != "Namespace 'physics' not found" {
+		t.Errorf("booking in the deleted namespace: %s", rep.Data)
+	}
+	if rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 5, ConfirmationID: id}); !strings.Contains(rep.Data, "not found") {
+		t.Errorf("cancel of a deleted booking: %s", rep.Data)
+	}
+	if got := facilityBookings(srv, "RoomA"); len(got) != 2 {
+		t.Errorf("default RoomA holds %v after the delete", got)
+	}
+	if rep := send(t, srv, p, bookReq(6, "RoomA", 2, 9, 10)); rep.Status != common.StatusOK {
+		t.Errorf("default booking after the delete: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestNamespaceSurvivesRestart: a namespace and its bookings load back from
+// the store, still apart from the default namespace.
+func TestNamespaceSurvivesRestart(t *testing.T) {
+	for _, b := range storeBackends {
+		if !b.persists {
+			continue
+		}
+		t.Run(b.name, func(t *testing.T) {
+			dir := t.TempDir()
+			srv := newStoreServer(t, openStore(t, b, dir))
+			admin := adminSender(t, srv)
+			if rep := admin(common.RequestMessage{OpCode: common.OpCreateNamespace, TargetNamespace: "physics",
+				MoreFacilities: []string{"RoomA", "Cryo"}}); rep.Status != common.StatusOK {
+				t.Fatalf("create: %s", rep.Data)
+			}
+			id := confirmationID(t, send(t, srv, newFakePeer("client"), inNamespace("physics", bookReq(1, "RoomA", 2, 9, 10))))
+			srv.store.Close()
+
+			srv = newStoreServer(t, openStore(t, b, dir))
+			p := newFakePeer("client")
+			rep := send(t, srv, p, inNamespace("physics", common.RequestMessage{OpCode: common.OpQueryAvailability,
+				RequestID: 2, FacilityName: "RoomA", DaysList: []uint8{2}}))
+			if !strings.Contains(rep.Data, id) {
+				t.Errorf("physics RoomA after restart:\n%s", rep.Data)
+			}
+			if got := query(t, srv, p, 3, "RoomA", 2); strings.Contains(got, id) {
+				t.Errorf("default RoomA holds the physics booking after restart:\n%s", got)
+			}
+			if _, ok := srv.facilityData[common.DefaultNamespace]["Cryo"]; ok {
+				t.Error("Cryo loaded into the default namespace")
+			}
+		})
+	}
+}
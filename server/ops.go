@@ -2,101 +2,520 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"net"
+	"log/slog"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
 )
 
-// handlePacket is called from main.go whenever a packet arrives
-func (s *ServerState) handlePacket(data []byte, clientAddr *net.UDPAddr) {
+// handleDatagram checks a UDP datagram for the protocol magic, against its
+// length prefix and -maxRequestSize before handing the payload to
+// handlePacket. The read buffer is only slightly larger than the limit, so
+// an oversized request arrives truncated; its declared length still tells
+// the two cases apart.
+func (s *ServerState) handleDatagram(packet []byte, clientAddr Peer) {
+	payload, declared, err := common.SplitLength(packet)
+	switch {
+	case !common.HasMagic(payload):
+		// Not our protocol; never answer stray traffic
+		s.badMagic.Add(1)
+		s.noteMalformed(clientAddr)
+	case declared > s.maxRequestSize:
+		s.rejectTooLarge(payload, declared, clientAddr)
+	case errors.Is(err, common.ErrTruncated):
+		log.Printf("Rejecting request from %s: %v", clientAddr, err)
+		s.replyToHeader(payload, clientAddr, common.StatusError,
+			fmt.Sprintf("Request was truncated in transit (%v)", err))
+	case err != nil:
+		log.Printf("Dropping malformed packet from %s: %v", clientAddr, err)
+		s.noteMalformed(clientAddr)
+	default:
+		s.handlePacket(payload, clientAddr)
+	}
+}
+
+// rejectTooLarge answers a request that exceeds -maxRequestSize, as long as
+// enough of it arrived to read the OpCode and RequestID.
+func (s *ServerState) rejectTooLarge(payload []byte, size int, clientAddr Peer) {
+	log.Printf("Rejecting %d-byte request from %s (limit %d)", size, clientAddr, s.maxRequestSize)
+	s.replyToHeader(payload, clientAddr, common.StatusTooLarge,
+		fmt.Sprintf("Request of %d bytes exceeds the server limit of %d bytes", size, s.maxRequestSize))
+}
+
+// replyToHeader sends an error reply to a request that could not be
+// unmarshaled, using only its cleartext header.
+func (s *ServerState) replyToHeader(payload []byte, clientAddr Peer, status int32, msg string) {
+	opCode, requestID, ok := common.PeekHeader(payload)
+	if !ok {
+		return
+	}
+	rawReply, err := s.encodeReply(common.ReplyMessage{
+		RequestID: requestID,
+		OpCode:    opCode,
+		Status:    status,
+		Data:      msg,
+	})
+	if err == nil {
+		clientAddr.Send(rawReply)
+	}
+}
+
+// handlePacket is called for every complete request payload
+func (s *ServerState) handlePacket(data []byte, clientAddr Peer) {
+	var reqMsg common.RequestMessage
+	defer s.recoverPacket(data, clientAddr, &reqMsg)
+	start := time.Now()
+	if !common.HasMagic(data) {
+		s.badMagic.Add(1)
+		s.noteMalformed(clientAddr)
+		return
+	}
+	// Answers to keepalives only keep the client's NAT mapping open; drop
+	// them without logging so long monitors do not flood the log.
+	if op, _, ok := common.PeekHeader(data); ok && op == common.OpKeepalive {
+		return
+	}
+	// Past -maxInFlight or -maxLockQueue, answer from the cleartext header
+	// at once: nothing is decrypted, executed or logged, and the busy reply
+	// never enters the history cache, so the client's resend after the
+	// suggested wait is handled like a first attempt.
+	reason, admitted := s.admit()
+	if !admitted {
+		s.replyToHeader(data, clientAddr, common.StatusBusy, common.BusyData(s.overload.retryAfter, reason))
+		return
+	}
+	defer s.inFlight.Add(-1)
 	log.Printf("Received packet from %s", clientAddr)
+	if s.debugPackets {
+		log.Print(common.DumpPacket(common.DumpReceived, data))
+	}
 
-	// 1) Unmarshal the request
-	reqMsg, err := common.UnmarshalRequest(data)
+	// 1) Verify/decrypt (if -authKey/-encrypt are set) and unmarshal the request
+	body, err := s.security.Open(data)
+	if err != nil {
+		s.rejectInsecure(data, clientAddr, err)
+		return
+	}
+	reqMsg, err = common.UnmarshalRequest(body)
 	if err != nil {
 		log.Printf("Failed to unmarshal request from %s: %v", clientAddr, err)
+		s.noteMalformed(clientAddr)
+		return
+	}
+	log.Printf("Unmarshaled request: Op=%s, RequestID=%d", common.OpName(reqMsg.OpCode), reqMsg.RequestID)
+
+	// Refuse control characters and invalid UTF-8 in any string field before
+	// they reach a log line, a reply or another client's callback
+	if err := reqMsg.CheckText(); err != nil {
+		s.rejectText(reqMsg, clientAddr, err)
+		return
+	}
+
+	// Pings are answered at once: no timestamp window, history or locks,
+	// so the measured round trip reflects the network only. The server
+	// clock lets the client measure skew as well.
+	if reqMsg.OpCode == common.OpPing {
+		if rawReply, err := s.encodeReply(common.ReplyMessage{
+			RequestID:   reqMsg.RequestID,
+			OpCode:      common.OpPing,
+			Status:      common.StatusOK,
+			Data:        strconv.FormatInt(reqMsg.PingTime, 10),
+			ServerClock: s.now().UnixMilli(),
+		}); err == nil {
+			clientAddr.Send(rawReply)
+		}
 		return
 	}
-	log.Printf("Unmarshaled request: OpCode=%d, RequestID=%d", reqMsg.OpCode, reqMsg.RequestID)
+
+	var reply common.ReplyMessage
+	switch reqMsg.OpCode {
+	case common.OpHello:
+		reply = s.helloReply(reqMsg, clientAddr)
+	case common.OpGetServerInfo:
+		reply = s.serverInfoReply(reqMsg, clientAddr)
+	default:
+		var ok bool
+		if reply, ok = s.handleRequest(reqMsg, clientAddr); !ok {
+			return
+		}
+	}
+	reply = common.CompressReply(reqMsg, reply, s.compressThreshold)
+
+	// Report the time spent on this packet, so clients can tell server time
+	// from network time. A duplicate answered from the history reports its
+	// own lookup, close to 0, not the original's processing: the client
+	// waited only for this exchange, so that is what it should subtract.
+	reply.ServerMicros = uint64(time.Since(start).Microseconds())
+
+	// Marshal and send the reply
+	rawReply, err := s.encodeReply(reply)
+	if err != nil {
+		log.Printf("Error marshalling reply: %v", err)
+		return
+	}
+	slog.Info("Sending reply",
+		"client", clientAddr.String(),
+		"requestID", reqMsg.RequestID,
+		"opcode", common.OpName(reqMsg.OpCode),
+		"status", reply.Status,
+		"duration", time.Since(start))
+	clientAddr.Send(rawReply)
+}
+
+// rejectText answers a request with a string field that is not plain text.
+// The rejection is never cached, like the other header checks.
+func (s *ServerState) rejectText(req common.RequestMessage, clientAddr Peer, err error) {
+	log.Printf("Rejecting RequestID %d from %s: %v", req.RequestID, clientAddr, err)
+	reply := common.ReplyMessage{
+		RequestID: req.RequestID,
+		OpCode:    req.OpCode,
+		Status:    common.StatusInvalidArgument,
+		Data:      fmt.Sprintf("Invalid request: %v", err),
+	}
+	if te, ok := err.(*common.TextError); ok {
+		echoRequest(&reply, req, te.Field, te.Value)
+	}
+	if rawReply, err := s.encodeReply(reply); err == nil {
+		clientAddr.Send(rawReply)
+	}
+}
+
+// handleRequest applies the header checks (timestamp, session, semantics
+// hint) to a request or batch envelope and executes it. It returns false
+// when no reply should be sent.
+func (s *ServerState) handleRequest(reqMsg common.RequestMessage, clientAddr Peer) (common.ReplyMessage, bool) {
+	// Reject stale or replayed requests before dedup so the rejection is
+	// never cached and the client can retry with a corrected timestamp.
+	if stale, ok := s.checkTimestamp(reqMsg); !ok {
+		log.Printf("Rejecting RequestID %d from %s: %s", reqMsg.RequestID, clientAddr, stale.Data)
+		return stale, true
+	}
+
+	// Resolve the session token, if any, to the user it belongs to
+	if reqMsg.SessionToken != "" {
+		user, ok := s.resolveSession(reqMsg.SessionToken, clientAddr)
+		if !ok {
+			log.Printf("Rejecting RequestID %d from %s: unknown or expired session", reqMsg.RequestID, clientAddr)
+			return common.ReplyMessage{
+				RequestID: reqMsg.RequestID,
+				OpCode:    reqMsg.OpCode,
+				Status:    common.StatusBadSession,
+				Data:      "Session expired or unknown; register again",
+			}, true
+		}
+		reqMsg.User = user
+	}
+
+	// Apply the request's semantics hint, if the server allows it
+	semantics, ok := s.effectiveSemantics(reqMsg)
+	if !ok {
+		log.Printf("Rejecting RequestID %d from %s: semantics hint %d not allowed", reqMsg.RequestID, clientAddr, reqMsg.Semantics)
+		return common.ReplyMessage{
+			RequestID: reqMsg.RequestID,
+			OpCode:    reqMsg.OpCode,
+			Status:    common.StatusError,
+			Data:      fmt.Sprintf("Server does not allow overriding its %s semantics for this request", s.semantics),
+		}, true
+	}
+
+	if reqMsg.OpCode == common.OpBatch {
+		return s.handleBatch(reqMsg, semantics, clientAddr), true
+	}
+	return s.execute(reqMsg, semantics, clientAddr)
+}
+
+// execute runs one admitted request under the given semantics: duplicates
+// are answered from the history (at-most-once) and new requests are
+// dispatched and their replies recorded. It returns false when a duplicate
+// is dropped while the original is still executing.
+func (s *ServerState) execute(reqMsg common.RequestMessage, semantics string, clientAddr Peer) (common.ReplyMessage, bool) {
+	// A dry run changes nothing, so a duplicate may simply run again; it
+	// never takes a place in the history
+	if reqMsg.DryRun {
+		semantics = SemanticsAtLeastOnce
+	}
 
 	// 2) Build a RequestKey for dedup (at-most-once only)
 	key := RequestKey{
-		Addr:      clientAddr.String(),
+		Addr:      s.historyClient(reqMsg, clientAddr),
 		RequestID: reqMsg.RequestID,
 	}
 
 	// 3) Check for duplicate if semantics = at-most-once
-	if s.semantics == SemanticsAtMostOnce {
-		s.historyLock.Lock()
-		cachedReply, found := s.history[key]
-		s.historyLock.Unlock()
-		if found {
-			log.Printf("Duplicate request %d from %s -> resending cached reply", reqMsg.RequestID, clientAddr)
-			rawReply, marshalErr := common.MarshalReply(cachedReply)
-			if marshalErr == nil {
-				s.conn.WriteToUDP(rawReply, clientAddr)
-			}
-			return
+	var call *inflightCall
+	if semantics == SemanticsAtMostOnce {
+		if cached, found := s.cachedReply(key, clientAddr); found {
+			return cached, true
+		}
+		if w, ok := s.history.(windowedHistory); ok && w.BelowWindow(key) {
+			log.Printf("Rejecting RequestID %d from %s: older than the dedup window", reqMsg.RequestID, clientAddr)
+			return common.ReplyMessage{
+				RequestID: reqMsg.RequestID,
+				OpCode:    reqMsg.OpCode,
+				Status:    common.StatusOutsideWindow,
+				Data:      "Request is older than the server's duplicate window and was not executed",
+			}, true
+		}
+
+		// A duplicate of a request that is still executing must not run
+		// again: wait for the original's reply (or drop it)
+		var leader bool
+		if call, leader = s.beginInflight(key); !leader {
+			return s.awaitInflight(key, call, clientAddr)
+		}
+		defer s.endInflight(key, call)
+		// The original may have finished between the lookup and registering
+		if cached, found := s.cachedReply(key, clientAddr); found {
+			return cached, true
+		}
+	}
+
+	if semantics == SemanticsAtLeastOnce && s.recent.observe(key) {
+		log.Printf("Duplicate request %d from %s -> executing again (at-least-once)", reqMsg.RequestID, clientAddr)
+		metricReexecuted.Add(opKey(reqMsg.OpCode), 1)
+	}
+
+	// 4) Process the operation (admin-only ops are gated here rather than in
+	// processOperation, which also applies replicated requests that carry no
+	// session; backups only serve reads; primaries replicate writes)
+	var reply common.ReplyMessage
+	switch {
+	case common.IsPrivileged(reqMsg.OpCode) && !s.isAdmin(reqMsg.User):
+		log.Printf("Rejecting privileged %s from %s: not an admin session", common.OpName(reqMsg.OpCode), clientAddr)
+		reply = common.ReplyMessage{
+			RequestID: reqMsg.RequestID,
+			OpCode:    reqMsg.OpCode,
+			Status:    common.StatusPermissionDenied,
+			Data:      "Permission denied; log in as the admin user first",
+		}
+	case reqMsg.Force && !s.isAdmin(reqMsg.User):
+		log.Printf("Rejecting forced %s from %s: not an admin session", common.OpName(reqMsg.OpCode), clientAddr)
+		reply = common.ReplyMessage{
+			RequestID: reqMsg.RequestID,
+			OpCode:    reqMsg.OpCode,
+			Status:    common.StatusPermissionDenied,
+			Data:      "Permission denied; only the admin user may force changes to a started booking",
 		}
+	case s.role == RoleBackup && reqMsg.IsMutating():
+		log.Printf("Rejecting mutating %s from %s: this server is a backup", common.OpName(reqMsg.OpCode), clientAddr)
+		reply = common.ReplyMessage{
+			RequestID: reqMsg.RequestID,
+			OpCode:    reqMsg.OpCode,
+			Status:    common.StatusNotPrimary,
+			Data:      "Not primary; send booking changes to the primary server",
+		}
+	case s.replicator != nil && reqMsg.IsMutating():
+		reply = s.replicator.processAndReplicate(reqMsg, clientAddr)
+	default:
+		reply = s.processOperation(reqMsg, clientAddr)
 	}
+	echoRequest(&reply, reqMsg, "", "")
+	metricExecuted.Add(opKey(reqMsg.OpCode), 1)
+
+	// 5) Store in history if at-most-once; waiting duplicates get the reply
+	// once endInflight runs
+	if semantics == SemanticsAtMostOnce {
+		s.history.Put(key, reply, s.historyTTL)
+		call.reply, call.ok = reply, true
+	}
+	return reply, true
+}
 
-	// 4) Process the operation
-	reply := s.processOperation(reqMsg, clientAddr)
+// effectiveSemantics returns the semantics for one request: the server's
+// own, or the request's hint if -allowedSemantics permits it.
+func (s *ServerState) effectiveSemantics(req common.RequestMessage) (string, bool) {
+	var hinted string
+	switch req.Semantics {
+	case common.HintServerDefault:
+		return s.semantics, true
+	case common.HintAtLeastOnce:
+		hinted = SemanticsAtLeastOnce
+	case common.HintAtMostOnce:
+		hinted = SemanticsAtMostOnce
+	default:
+		return "", false
+	}
+	if hinted != s.semantics && !s.allowedSemantics[hinted] {
+		return "", false
+	}
+	return hinted, true
+}
 
-	// 5) Store in history if at-most-once
-	if s.semantics == SemanticsAtMostOnce {
-		s.historyLock.Lock()
-		s.history[key] = reply
-		s.historyLock.Unlock()
+// cachedReply looks up a duplicate in the at-most-once history.
+func (s *ServerState) cachedReply(key RequestKey, clientAddr Peer) (common.ReplyMessage, bool) {
+	cachedReply, found := s.history.Get(key)
+	if !found {
+		return common.ReplyMessage{}, false
 	}
+	log.Printf("Duplicate request %d from %s -> resending cached reply", key.RequestID, clientAddr)
+	metricFromHistory.Add(opKey(cachedReply.OpCode), 1)
+	return cachedReply, true
+}
 
-	// 6) Marshal and send the reply
-	rawReply, err := common.MarshalReply(reply)
+// checkTimestamp enforces the -maxSkew window. Requests without a timestamp
+// are rejected too while the window is enabled, otherwise a replay could
+// simply omit it.
+func (s *ServerState) checkTimestamp(req common.RequestMessage) (common.ReplyMessage, bool) {
+	if s.maxSkew <= 0 {
+		return common.ReplyMessage{}, true
+	}
+	now := s.now()
+	reason := fmt.Sprintf("Request has no timestamp (server requires one within ±%v).", s.maxSkew)
+	if req.Timestamp != 0 {
+		skew := now.Sub(time.UnixMilli(req.Timestamp))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew <= s.maxSkew {
+			return common.ReplyMessage{}, true
+		}
+		reason = fmt.Sprintf("Request timestamp is %v off the server clock (allowed ±%v).",
+			skew.Round(time.Millisecond), s.maxSkew)
+	}
+	return common.ReplyMessage{
+		RequestID: req.RequestID,
+		OpCode:    req.OpCode,
+		Status:    common.StatusStaleRequest,
+		Data:      common.StaleRequestData(now, reason),
+	}, false
+}
+
+// encodeReply marshals a reply or callback and applies the configured
+// authentication/encryption. Cached replies are stored in plaintext and
+// sealed afresh (new nonce) every time they are sent.
+func (s *ServerState) encodeReply(rep common.ReplyMessage) ([]byte, error) {
+	raw, err := common.MarshalReply(rep)
 	if err != nil {
-		log.Printf("Error marshalling reply: %v", err)
+		return nil, err
+	}
+	sealed, err := s.security.Seal(raw)
+	if err == nil && s.debugPackets {
+		log.Print(common.DumpPacket(common.DumpSent, sealed))
+	}
+	return sealed, err
+}
+
+// rejectInsecure counts a packet that failed verification or decryption.
+// When the failure is a configuration mismatch (one side uses -authKey or
+// -encrypt and the other does not) a plaintext error reply is sent so the
+// client sees a clear message instead of timing out; tampered packets are
+// dropped silently.
+func (s *ServerState) rejectInsecure(data []byte, clientAddr Peer, verr error) {
+	if errors.Is(verr, common.ErrDecrypt) {
+		s.decryptFailures.Add(1)
+		log.Printf("Dropping packet from %s: %v (%d decryption failures so far)", clientAddr, verr, s.decryptFailures.Load())
+		s.noteMalformed(clientAddr)
+		return
+	}
+	s.authFailures.Add(1)
+	log.Printf("Dropping packet from %s: %v (%d auth failures so far)", clientAddr, verr, s.authFailures.Load())
+	if errors.Is(verr, common.ErrBadMAC) {
+		s.noteMalformed(clientAddr)
+		return
+	}
+
+	opCode, requestID, ok := common.PeekHeader(data)
+	if !ok {
 		return
 	}
-	log.Printf("Sending reply for RequestID=%d to %s", reqMsg.RequestID, clientAddr)
-	s.conn.WriteToUDP(rawReply, clientAddr)
+	var msg string
+	switch {
+	case errors.Is(verr, common.ErrMissingMAC):
+		msg = "Server requires authentication; start the client with the server's -authKey"
+	case errors.Is(verr, common.ErrUnexpectedMAC):
+		msg = "Server has no -authKey configured; start the client without -authKey"
+	case errors.Is(verr, common.ErrNotEncrypted):
+		msg = "Server requires encryption; start the client with -encrypt"
+	case errors.Is(verr, common.ErrUnexpectedEncryption):
+		msg = "Server does not use encryption; start the client without -encrypt"
+	default:
+		return
+	}
+	raw, err := common.MarshalReply(common.ReplyMessage{
+		RequestID: requestID,
+		OpCode:    opCode,
+		Status:    common.StatusAuthRequired,
+		Data:      msg,
+	})
+	if err == nil {
+		clientAddr.Send(raw)
+	}
 }
 
-// intersectsDays returns true if a booking touches any of the input days
-func intersectsDays(bk Booking, days []uint8) bool {
-	for _, d := range days {
-		// if the booking starts at day bk.StartDay and ends at day bk.EndDay,
-		// check if d is in [StartDay..EndDay] (naive approach)
-		if d >= bk.StartDay && d <= bk.EndDay {
-			return true
+// interval returns the minutes the booking occupies.
+func (bk Booking) interval() schedule.Interval {
+	return schedule.Span(bk.StartDay, bk.StartHour, bk.StartMinute, bk.EndDay, bk.EndHour, bk.EndMinute)
+}
+
+// callbackAvailLimit caps the availability embedded in a callback so the
+// datagram stays within a typical MTU and is not fragmented.
+const callbackAvailLimit = 1200
+
+// affectedDays lists the days, in order, covered by any of the bookings.
+func affectedDays(bookings ...Booking) []uint8 {
+	days := make([]uint8, 0, 7)
+	for d := uint8(0); d < 7; d++ {
+		for _, bk := range bookings {
+			if bk.interval().IntersectsDays([]uint8{d}) {
+				days = append(days, d)
+				break
+			}
 		}
 	}
-	return false
+	return days
 }
 
-// notifySubscribers is called whenever a facility's schedule changes
-func (s *ServerState) notifySubscribers(facility, updateMsg string) {
-	now := time.Now()
+// notifySubscribers reports a change to the schedule of facility in
+// namespace ns. It numbers the change in the change journal, forwards it to
+// the webhooks and sends a callback to every subscription that watches one
+// of days, the days the change touched, and wants eventType. Callbacks
+// embed the refreshed availability of those days unless it is too large.
+// The caller holds dataLock.
+func (s *ServerState) notifySubscribers(ns, facility, eventType, confID, updateMsg string, days []uint8) {
+	now := s.now()
 	log.Printf("Notifying subscribers of facility '%s' update: %s", facility, updateMsg)
+	s.changes.record(qualify(ns, facility), eventType, confID, updateMsg)
+
+	event := eventBits[eventType]
+	var avail string
+	if fac, ok := s.facilityData[ns][facility]; ok && len(days) > 0 {
+		if avail = formatAvailability(fac, days); len(avail) > callbackAvailLimit {
+			log.Printf("Availability for '%s' on days %v is %d bytes; not embedding it in callbacks", facility, days, len(avail))
+			avail = ""
+		}
+	}
+
+	s.webhooks.Notify(WebhookEvent{
+		Namespace:      namespaceLabel(ns),
+		Facility:       facility,
+		EventType:      eventType,
+		ConfirmationID: confID,
+		Message:        updateMsg,
+		Timestamp:      now,
+	})
 
 	s.monitorLock.Lock()
 	defer s.monitorLock.Unlock()
 
 	newSubs := make([]MonitorRegistration, 0, len(s.monitorSubs))
 	for _, sub := range s.monitorSubs {
-		if sub.FacilityName == facility && now.Before(sub.ExpiresAt) {
-			// Build a callback reply
-			cb := common.ReplyMessage{
-				RequestID: 0,   // no direct request ID for callback
-				OpCode:    100, // or any "callback" code
-				Status:    0,
-				Data:      fmt.Sprintf("Facility=%s updated: %s", facility, updateMsg),
+		if sub.Namespace == ns && sub.FacilityName == facility && now.Before(sub.ExpiresAt) {
+			if !sub.wantsDays(days) || !sub.wantsEvent(event) {
+				newSubs = append(newSubs, sub)
+				continue
 			}
-			raw, err := common.MarshalReply(cb)
-			if err == nil {
-				s.conn.WriteToUDP(raw, sub.ClientAddr)
+			// Build a numbered callback reply
+			cb := s.nextCallback(&sub, event, fmt.Sprintf("Facility=%s updated: %s", facility, updateMsg), avail)
+			raw, err := s.encodeReply(cb)
+			if err == nil && s.sendCallback(&sub, raw) {
 				log.Printf("Sent callback to %s for facility '%s'", sub.ClientAddr, facility)
 			}
 			newSubs = append(newSubs, sub)
@@ -108,155 +527,306 @@ func (s *ServerState) notifySubscribers(facility, updateMsg string) {
 	s.monitorSubs = newSubs
 }
 
-// availableTimingsForDay computes available time intervals (as a string)
-// for a given day from the list of bookings.
-// It clips any booking that spans multiple days to the boundaries of the day.
-func availableTimingsForDay(day uint8, bookings []Booking) string {
-	dayStart := int32(day) * 1440
-	dayEnd := int32(day+1) * 1440
+// availableTimingsForDay lists the free times of a day between the
+// occupied intervals, as "08:00-09:30, 11:00-24:00".
+func availableTimingsForDay(day uint8, occupied []schedule.Interval) string {
+	free := schedule.FreeOnDay(day, occupied)
+	if len(free) == 0 {
+		return "Fully booked"
+	}
+	dayStart := schedule.Day(day).Start
+	parts := make([]string, len(free))
+	for i, iv := range free {
+		from, to := iv.Start-dayStart, iv.End-dayStart
+		parts[i] = fmt.Sprintf("%02d:%02d-%02d:%02d", from/60, from%60, to/60, to%60)
+	}
+	return strings.Join(parts, ", ")
+}
 
-	// Gather bookings that overlap with this day and clip them to day boundaries.
-	type interval struct {
-		start, end int32
+// handleQuery returns a formatted string showing the availability of a facility
+// for the specified days. The output is formatted as:
+//
+//	Day X:
+//	  Current bookings:
+//	    - <booking details>
+//	  Available timings: <free intervals>
+func (s *ServerState) handleQuery(ns, name string, days []uint8, t *opTiming) (string, common.Extensions) {
+	log.Printf("Handling Query for facility '%s' on days %v", name, days)
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+	fac, ok := s.facilityData[ns][name]
+	if !ok {
+		log.Printf("Facility '%s' not found during Query", name)
+		return "Error: " + s.facilityNotFound(ns, name), nil
 	}
-	var dayIntervals []interval
-	for _, bk := range bookings {
-		// Check if booking intersects the day
-		if bk.EndDay < day || bk.StartDay > day {
-			continue
+	result := formatAvailability(fac, days)
+	log.Printf("Query result for '%s': %s", name, result)
+	var ext common.Extensions
+	if raw, err := common.AppendOccupied(nil, occupiedOnDays(fac, days)); err != nil {
+		log.Printf("Query for '%s': not listing bookings: %v", name, err)
+	} else {
+		ext.Put(common.ExtOccupied, raw)
+	}
+	return result, ext
+}
+
+// occupiedOnDays lists the bookings and blackouts that the availability
+// text shows for the days, as intervals clients can check against without
+// parsing the text. A pool lists the stretches in which all its places are
+// booked instead of its bookings, without an ID, since a single booking
+// there is no conflict.
+func occupiedOnDays(fac *FacilityInfo, days []uint8) []common.Occupied {
+	var entries []common.Occupied
+	if fac.capacity() > 1 {
+		for _, iv := range fac.full() {
+			if iv.IntersectsDays(days) {
+				entries = append(entries, common.Occupied{Interval: iv})
+			}
 		}
-		// Convert booking start and end to absolute minutes.
-		bkStart := toAbsoluteMinutes(bk.StartDay, bk.StartHour, bk.StartMinute)
-		bkEnd := toAbsoluteMinutes(bk.EndDay, bk.EndHour, bk.EndMinute)
-		// Clip booking to day boundaries.
-		if bkStart < dayStart {
-			bkStart = dayStart
+	} else {
+		for _, bk := range fac.Bookings {
+			if iv := bk.interval(); iv.IntersectsDays(days) {
+				entries = append(entries, common.Occupied{ID: bk.ConfirmationID, Interval: iv})
+			}
 		}
-		if bkEnd > dayEnd {
-			bkEnd = dayEnd
+	}
+	for _, b := range fac.Blackouts {
+		if iv := b.asBooking().interval(); iv.IntersectsDays(days) {
+			entries = append(entries, common.Occupied{Interval: iv})
 		}
-		dayIntervals = append(dayIntervals, interval{bkStart, bkEnd})
 	}
+	return entries
+}
 
-	// Sort the intervals by start time.
-	for i := 1; i < len(dayIntervals); i++ {
-		key := dayIntervals[i]
-		j := i - 1
-		for j >= 0 && dayIntervals[j].start > key.start {
-			dayIntervals[j+1] = dayIntervals[j]
-			j--
-		}
-		dayIntervals[j+1] = key
+// handleQueryBitmap answers a bitmap-mode query: one free/busy bitmap per
+// requested day in ExtBusyBitmap, computed from the same busy intervals as
+// the interval text. An empty DaysList has been expanded to the week.
+func (s *ServerState) handleQueryBitmap(req common.RequestMessage, t *opTiming) (string, int32, common.Extensions) {
+	log.Printf("Handling bitmap Query for facility '%s' on days %v", req.FacilityName, req.DaysList)
+	if len(req.MoreFacilities) > 0 {
+		t.reject("MoreFacilities", strings.Join(req.MoreFacilities, ","))
+		return "Bitmap queries take a single facility", common.StatusInvalidArgument, nil
 	}
+	days := req.DaysList
 
-	// Now compute available intervals.
-	available := ""
-	current := dayStart
-	for _, iv := range dayIntervals {
-		if iv.start > current {
-			available += fmt.Sprintf("%02d:%02d-%02d:%02d, ", current/60, current%60, iv.start/60, iv.start%60)
-		}
-		if iv.end > current {
-			current = iv.end
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+	fac, ok := s.facilityData[req.Namespace][req.FacilityName]
+	if !ok {
+		t.reject("FacilityName", req.FacilityName)
+		return "Error: " + s.facilityNotFound(req.Namespace, req.FacilityName), -1, nil
+	}
+
+	busy := make([]common.DayBusy, 0, len(days))
+	occupied := fac.occupied()
+	for _, day := range days {
+		d := common.DayBusy{Day: day}
+		dayStart := schedule.Day(day).Start
+		for _, iv := range schedule.BusyOnDay(day, occupied) {
+			d.Slots.MarkBusy(int(iv.Start-dayStart), int(iv.End-dayStart))
 		}
+		busy = append(busy, d)
 	}
-	if current < dayEnd {
-		available += fmt.Sprintf("%02d:%02d-24:00", current/60, current%60)
+	raw, err := common.AppendBusyBitmaps(nil, busy)
+	if err != nil {
+		return err.Error(), common.StatusInvalidArgument, nil
 	}
-	available = strings.TrimSuffix(available, ", ")
-	if available == "" {
-		available = "Fully booked"
+	var ext common.Extensions
+	ext.Put(common.ExtBusyBitmap, raw)
+	return fmt.Sprintf("Facility=%s busy bitmap of days %v in %d-minute slots", fac.Name, days, common.SlotMinutes), 0, ext
+}
+
+// handleQueryFacilities answers a query for several facilities with one
+// availability section per facility, in the order asked. Unknown names get
+// a line of their own instead of failing the whole query.
+func (s *ServerState) handleQueryFacilities(ns string, names []string, days []uint8, t *opTiming) string {
+	log.Printf("Handling Query for facilities %v on days %v", names, days)
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+
+	var result strings.Builder
+	for _, name := range names {
+		fac, ok := s.facilityData[ns][name]
+		if !ok {
+			fmt.Fprintf(&result, "Error: %s\n\n", s.facilityNotFound(ns, name))
+			continue
+		}
+		result.WriteString(formatAvailability(fac, days))
 	}
-	return available
+	return result.String()
 }
 
-// handleQuery returns a formatted string showing the availability of a facility
-// for the specified days. The output is formatted as:
-//
-//	Day X:
-//	  Current bookings:
-//	    - <booking details>
-//	  Available timings: <free intervals>
-func (s *ServerState) handleQuery(name string, days []uint8) string {
-	log.Printf("Handling Query for facility '%s' on days %v", name, days)
-	s.dataLock.Lock()
-	fac, ok := s.facilityData[name]
-	s.dataLock.Unlock()
-	if !ok {
-		log.Printf("Facility '%s' not found during Query", name)
-		return fmt.Sprintf("Error: Facility '%s' not found", name)
+// formatAvailability renders the bookings and free times of a facility on
+// the given days, as returned by a query.
+func formatAvailability(fac *FacilityInfo, days []uint8) string {
+	result := fmt.Sprintf("Facility %s availability:\n", common.EscapeText(fac.Name))
+	if fac.capacity() > 1 {
+		result += fmt.Sprintf("Capacity: %d concurrent bookings\n", fac.capacity())
 	}
-	result := fmt.Sprintf("Facility %s availability:\n", name)
 	for _, day := range days {
-		result += fmt.Sprintf("Day %d:\n", day)
+		result += fmt.Sprintf("%s:\n", common.DayName(day))
 		bookingsStr := ""
 		for _, bk := range fac.Bookings {
 			// Check if the booking intersects the day.
-			if bk.StartDay <= day && bk.EndDay >= day {
-				bookingsStr += fmt.Sprintf("  - %s: %02d:%02d to %02d:%02d\n",
-					bk.ConfirmationID,
+			if bk.interval().IntersectsDays([]uint8{day}) {
+				label := bk.ConfirmationID
+				if bk.Pending {
+					label += pendingLabel(bk)
+				}
+				bookingsStr += fmt.Sprintf("  - %s: %02d:%02d to %s\n",
+					label,
 					bk.StartHour, bk.StartMinute,
-					bk.EndHour, bk.EndMinute,
+					endClock(day, bk),
 				)
 				if len(bk.Participants) > 0 {
-					bookingsStr += fmt.Sprintf("      Participants: %v\n", bk.Participants)
+					bookingsStr += fmt.Sprintf("      Participants: %v\n", escapeNames(bk.Participants))
 				}
 			}
 		}
+		for _, b := range fac.Blackouts {
+			if b.asBooking().interval().IntersectsDays([]uint8{day}) {
+				bookingsStr += fmt.Sprintf("  - %s: %02d:%02d to %s\n",
+					b.label(), b.StartHour, b.StartMinute, endClock(day, b.asBooking()))
+			}
+		}
 		if bookingsStr == "" {
 			bookingsStr = "  None\n"
 		}
 		result += "Current bookings:\n" + bookingsStr
-		avail := availableTimingsForDay(day, fac.Bookings)
+		avail := availableTimingsForDay(day, fac.occupied())
+		if fac.capacity() > 1 {
+			avail = remainingCapacityForDay(fac, day)
+		}
 		result += "Available timings: " + avail + "\n\n"
 	}
-	log.Printf("Query result for '%s': %s", name, result)
 	return result
 }
 
-// timesOverlap returns true if [start1, end1) intersects [start2, end2).
-func timesOverlap(start1, end1, start2, end2 int32) bool {
-	return (start1 < end2) && (start2 < end1)
+// endClock renders the end of a booking listed under day as HH:MM, or as
+// 24:00 when it ends at the midnight that closes the day.
+func endClock(day uint8, bk Booking) string {
+	if bk.interval().End == schedule.Day(day).End {
+		return "24:00"
+	}
+	return fmt.Sprintf("%02d:%02d", bk.EndHour, bk.EndMinute)
+}
+
+// escapeNames escapes each name for multi-line output. Names are checked
+// on the way in, but bookings stored before the check, or loaded from a
+// file, may still hold control characters.
+func escapeNames(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = common.EscapeText(n)
+	}
+	return out
+}
+
+// checkTimeFields validates a request's booking window with the checks
+// the client applies to its input, and notes the field at fault.
+func checkTimeFields(req common.RequestMessage, t *opTiming) (string, bool) {
+	err := validate.ValidateBookingTimes(req.StartDay, req.StartHour, req.StartMinute, req.EndDay, req.EndHour, req.EndMinute)
+	if err != nil {
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v.", err), false
+	}
+	return "", true
+}
+
+// rejectField notes the field named by a validation error.
+func rejectField(t *opTiming, err error) {
+	if fe, ok := err.(*validate.FieldError); ok {
+		t.reject(fe.Field, fe.Value)
+	}
 }
 
-// toAbsoluteMinutes converts (day, hour, minute) to an absolute minute count from Monday 0:00.
-func toAbsoluteMinutes(day, hour, minute uint8) int32 {
-	// Convert to absolute minutes from Monday 0:00
-	// Each day has 24*60 = 1440 minutes
-	return int32(day)*1440 + int32(hour)*60 + int32(minute)
+// echoRequest adds the failed request's salient fields, and the field a
+// handler rejected, to an error reply in ExtErrorEcho. Successful replies
+// and replies that already carry an echo are left alone.
+func echoRequest(rep *common.ReplyMessage, req common.RequestMessage, field, value string) {
+	if rep.Status == common.StatusOK {
+		return
+	}
+	if _, ok := rep.Extensions.Get(common.ExtErrorEcho); ok {
+		return
+	}
+	echo := common.ErrorEcho{
+		Op:             common.OpName(req.OpCode),
+		Facility:       common.EscapeText(req.FacilityName),
+		ConfirmationID: common.EscapeText(req.ConfirmationID),
+		Field:          field,
+		Value:          common.EscapeText(value),
+	}
+	if err := rep.Extensions.PutErrorEcho(echo); err != nil {
+		log.Printf("Cannot echo RequestID %d in its error reply: %v", req.RequestID, err)
+	}
 }
 
-// handleBookFacility creates a new booking if no overlap.
-func (s *ServerState) handleBookFacility(req common.RequestMessage) (string, int32) {
+// handleBookFacility creates a new booking if no overlap. A dry run stops
+// before the booking gets an ID and says whether it would have been made.
+func (s *ServerState) handleBookFacility(req common.RequestMessage, t *opTiming) (string, int32) {
 	facName := req.FacilityName
 	log.Printf("Handling BookFacility for facility '%s'", facName)
 
-	s.dataLock.Lock()
+	t.lock(&s.dataLock)
 	defer s.dataLock.Unlock()
 
-	fac, ok := s.facilityData[facName]
+	if msg, status, repeat := s.repeatedBooking(req); repeat {
+		log.Printf("BookFacility repeats idempotency key %q; not booking again", req.IdempotencyKey)
+		if status != common.StatusOK {
+			t.reject("IdempotencyKey", req.IdempotencyKey)
+		}
+		return msg, status
+	}
+
+	fac, ok := s.facilityData[req.Namespace][facName]
 	if !ok {
 		log.Printf("Facility '%s' not found in BookFacility", facName)
-		return fmt.Sprintf("Facility '%s' not found", facName), -1
+		t.reject("FacilityName", facName)
+		return s.facilityNotFound(req.Namespace, facName), -1
 	}
 
-	newStart := toAbsoluteMinutes(req.StartDay, req.StartHour, req.StartMinute)
-	newEnd := toAbsoluteMinutes(req.EndDay, req.EndHour, req.EndMinute)
-	if newEnd <= newStart {
-		log.Printf("Invalid booking times: end time is not after start time")
-		return "Error: End time must be after start time.", -1
+	if msg, ok := checkTimeFields(req, t); !ok {
+		log.Printf("Invalid booking times: %s", msg)
+		return msg, common.StatusInvalidArgument
+	}
+	newStart := schedule.ToMinutes(req.StartDay, req.StartHour, req.StartMinute)
+	newEnd := schedule.ToMinutes(req.EndDay, req.EndHour, req.EndMinute)
+	if !req.Force && s.endsInPast(newEnd) {
+		log.Printf("Refusing booking for facility '%s' that ends in the past", facName)
+		t.reject("End", formatWeekMinutes(newEnd))
+		return s.pastBookingReply(newEnd), common.StatusInvalidArgument
 	}
 
-	for _, bk := range fac.Bookings {
-		existingStart := toAbsoluteMinutes(bk.StartDay, bk.StartHour, bk.StartMinute)
-		existingEnd := toAbsoluteMinutes(bk.EndDay, bk.EndHour, bk.EndMinute)
-		if timesOverlap(newStart, newEnd, existingStart, existingEnd) {
-			log.Printf("Time conflict detected for facility '%s'", facName)
-			return "Time conflict with an existing booking.", 1
+	window := schedule.Interval{Start: newStart, End: newEnd}
+	if !fac.hasRoom(window) {
+		log.Printf("Time conflict detected for facility '%s'", facName)
+		if req.DryRun {
+			return s.dryRunConflict(fac.bookingConflict(), fac, window), 1
+		}
+		return fac.bookingConflict(), 1
+	}
+	if b, closed := fac.blackoutOverlapping(newStart, newEnd); closed {
+		log.Printf("Booking for facility '%s' falls into a blackout", facName)
+		if req.DryRun {
+			return s.dryRunConflict(blackoutConflict(b), fac, window), 1
+		}
+		return blackoutConflict(b), 1
+	}
+	if req.DryRun {
+		log.Printf("Dry run: booking facility '%s' would succeed", facName)
+		pending := ""
+		if fac.RequiresApproval {
+			pending = ", pending approval"
 		}
+		return fmt.Sprintf("Dry run: booking '%s' from %s to %s would succeed%s. Nothing was booked.",
+			facName, common.FormatLongWeekTime(newStart), common.FormatLongWeekTime(newEnd), pending), 0
 	}
 
-	newID := fmt.Sprintf("BKG-%d", time.Now().UnixNano())
+	newID := req.ConfirmationID
+	if newID == "" {
+		newID = s.newID()
+	}
 	newBooking := Booking{
 		ConfirmationID: newID,
 		StartDay:       req.StartDay,
@@ -267,37 +837,58 @@ func (s *ServerState) handleBookFacility(req common.RequestMessage) (string, int
 		EndMinute:      req.EndMinute,
 		Participants:   []string{}, // Initially empty
 	}
+	// A booking waiting for approval only reaches the store once approved
+	if fac.RequiresApproval {
+		s.holdForApproval(&newBooking, req)
+	} else if err := s.store.SaveBooking(qualify(req.Namespace, facName), newBooking); err != nil {
+		log.Printf("Failed to persist booking %s: %v", newID, err)
+		return "Error: could not save booking.", -1
+	}
 	fac.Bookings = append(fac.Bookings, newBooking)
 
-	s.notifySubscribers(facName, fmt.Sprintf("New booking created: %s", newID))
-	msg := fmt.Sprintf("Booked '%s' from Day %d (%02d:%02d) to Day %d (%02d:%02d). ID=%s",
-		facName,
-		req.StartDay, req.StartHour, req.StartMinute,
-		req.EndDay, req.EndHour, req.EndMinute,
-		newID,
-	)
+	created := fmt.Sprintf("New booking created: %s", newID)
+	pending := ""
+	if newBooking.Pending {
+		created = fmt.Sprintf("New booking created: %s by %s, pending approval", newID, requester(newBooking))
+		pending = pendingLabel(newBooking)
+	}
+	s.notifySubscribers(req.Namespace, facName, EventBookingCreated, newID, created, affectedDays(newBooking))
+	msg := fmt.Sprintf("Booked '%s' from %s to %s%s. ID=%s",
+		facName, common.FormatLongWeekTime(newStart), common.FormatLongWeekTime(newEnd), pending, newID)
+	s.idempotency.remember(idempotencyKey(req), keyedBooking{ConfirmationID: newID, Facility: qualify(req.Namespace, facName), Start: newStart, End: newEnd, Reply: msg}, s.now())
 	log.Printf("Booking successful: %s", msg)
 	return msg, 0
 }
 
-// fromAbsoluteMinutes converts an absolute minute value to day, hour, and minute.
-// For example, if a day has 1440 minutes (24 hours).
-func fromAbsoluteMinutes(total int) (uint8, uint8, uint8) {
-	day := total / 1440
-	rem := total % 1440
-	hour := rem / 60
-	minute := rem % 60
-	return uint8(day), uint8(hour), uint8(minute)
+// findBooking locates a booking of namespace ns by confirmation ID and
+// returns its facility's name, the facility and its index there. IDs are
+// unique across namespaces, so a booking of another namespace is simply not
+// found. The caller holds dataLock.
+func (s *ServerState) findBooking(ns, confID string) (string, *FacilityInfo, int, bool) {
+	for name, fac := range s.facilityData[ns] {
+		for i, bk := range fac.Bookings {
+			if bk.ConfirmationID == confID {
+				return name, fac, i, true
+			}
+		}
+	}
+	return "", nil, -1, false
 }
 
 // handleChangeBooking locates the booking by ConfirmationID and updates its time using OffsetMinutes.
-func (s *ServerState) handleChangeBooking(req common.RequestMessage) (string, int32) {
+// A dry run stops before the booking is touched; see dryRunChange.
+func (s *ServerState) handleChangeBooking(req common.RequestMessage, t *opTiming) (string, int32) {
 	offset := req.OffsetMinutes
 	confID := req.ConfirmationID
 	log.Printf("Handling ChangeBooking for ConfirmationID '%s'", confID)
 	log.Printf("Received offset (in minutes): %d", offset)
+	if req.WholeDays && offset%schedule.DayMinutes != 0 {
+		log.Printf("Rejecting ChangeBooking for '%s': offset %d is not whole days", confID, offset)
+		t.reject("OffsetMinutes", offset)
+		return fmt.Sprintf("Offset %d minutes is not a whole number of days", offset), common.StatusInvalidArgument
+	}
 
-	s.dataLock.Lock()
+	t.lock(&s.dataLock)
 	defer s.dataLock.Unlock()
 
 	// Locate the booking using ConfirmationID.
@@ -306,7 +897,7 @@ func (s *ServerState) handleChangeBooking(req common.RequestMessage) (string, in
 	var oldIndex int
 	var facName string
 
-	for fName, facility := range s.facilityData {
+	for fName, facility := range s.facilityData[req.Namespace] {
 		for i, bk := range facility.Bookings {
 			if bk.ConfirmationID == confID {
 				// Capture a pointer to the found booking.
@@ -323,43 +914,92 @@ func (s *ServerState) handleChangeBooking(req common.RequestMessage) (string, in
 	}
 	if oldBooking == nil {
 		log.Printf("Booking '%s' not found in ChangeBooking", confID)
+		t.reject("ConfirmationID", confID)
 		return fmt.Sprintf("Error: Booking %s not found", confID), -1
 	}
+	if oldBooking.Pending {
+		return refusePending(*oldBooking, t)
+	}
 
 	// Convert the current booking's start/end times to absolute minutes.
-	oldStart := toAbsoluteMinutes(oldBooking.StartDay, oldBooking.StartHour, oldBooking.StartMinute)
-	oldEnd := toAbsoluteMinutes(oldBooking.EndDay, oldBooking.EndHour, oldBooking.EndMinute)
+	oldStart := schedule.ToMinutes(oldBooking.StartDay, oldBooking.StartHour, oldBooking.StartMinute)
+	oldEnd := schedule.ToMinutes(oldBooking.EndDay, oldBooking.EndHour, oldBooking.EndMinute)
 	log.Printf("Old booking times (absolute minutes): start=%d, end=%d", oldStart, oldEnd)
 
-	// Apply the offset to the booking times.
+	// Apply the offset to the booking times; EndOnly keeps the start.
 	newStartAbs := oldStart + int32(offset)
+	if req.EndOnly {
+		newStartAbs = oldStart
+	}
 	newEndAbs := oldEnd + int32(offset)
 
+	// A booking that has started may only have its end moved, and not into
+	// the past; one that has ended stays as it is. Admins can force both.
+	if status, started := s.bookingStarted(*oldBooking); started && !req.Force {
+		switch {
+		case status == common.StatusBookingOver:
+			log.Printf("Refusing to change booking '%s': it has already ended", confID)
+			t.reject("ConfirmationID", confID)
+			return fmt.Sprintf("Booking %s has already ended (now %s)", confID, formatWeekMinutes(s.clock())), status
+		case !req.EndOnly:
+			log.Printf("Refusing to move booking '%s': it is in progress", confID)
+			t.reject("ConfirmationID", confID)
+			return fmt.Sprintf("Booking %s is in progress (now %s); only its end can be changed", confID, formatWeekMinutes(s.clock())), status
+		case newEndAbs <= s.clock():
+			log.Printf("Refusing to end booking '%s' in the past", confID)
+			t.reject("OffsetMinutes", offset)
+			return fmt.Sprintf("Booking %s is in progress (now %s); its new end must be later than now", confID, formatWeekMinutes(s.clock())), common.StatusInvalidArgument
+		}
+	}
+
 	// Validate: the new end time must be after the new start time.
 	if newEndAbs <= newStartAbs {
 		log.Printf("Invalid new times: new end time (%d) is not after new start time (%d)", newEndAbs, newStartAbs)
+		t.reject("OffsetMinutes", offset)
 		return "Error: End time must be after start time.", -1
 	}
+	// The booking must stay within the week, ending by Sunday 24:00;
+	// FromMinutes would wrap anything outside it into nonsense days
+	if newStartAbs < 0 || newEndAbs > schedule.WeekMinutes {
+		log.Printf("Refusing to move booking '%s' out of the week by offset %d", confID, offset)
+		t.reject("OffsetMinutes", offset)
+		return fmt.Sprintf("Offset %d minutes moves booking %s outside the week (Monday 00:00 to Sunday 24:00)", offset, confID),
+			common.StatusInvalidArgument
+	}
+	if !req.Force && s.endsInPast(newEndAbs) {
+		log.Printf("Refusing to move booking '%s' into the past", confID)
+		t.reject("OffsetMinutes", offset)
+		return s.pastBookingReply(newEndAbs), common.StatusInvalidArgument
+	}
 
 	// Convert the new times from absolute minutes back to day, hour, and minute.
-	newStartDay, newStartHour, newStartMinute := fromAbsoluteMinutes(int(newStartAbs))
-	newEndDay, newEndHour, newEndMinute := fromAbsoluteMinutes(int(newEndAbs))
+	newStartDay, newStartHour, newStartMinute := schedule.FromMinutes(newStartAbs)
+	newEndDay, newEndHour, newEndMinute := schedule.FromMinutes(newEndAbs)
+	if err := validate.ValidateBookingTimes(newStartDay, newStartHour, newStartMinute, newEndDay, newEndHour, newEndMinute); err != nil {
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v.", err), common.StatusInvalidArgument
+	}
 	log.Printf("New booking times: Start - Day=%d, %02d:%02d; End - Day=%d, %02d:%02d",
 		newStartDay, newStartHour, newStartMinute, newEndDay, newEndHour, newEndMinute)
 
+	if req.DryRun {
+		return s.dryRunChange(req, oldFac, oldIndex, schedule.Interval{Start: newStartAbs, End: newEndAbs})
+	}
+
 	// Remove the old booking from the facility's booking list.
 	oldFac.Bookings = append(oldFac.Bookings[:oldIndex], oldFac.Bookings[oldIndex+1:]...)
 
 	// Check for time collisions with existing bookings.
-	for _, bk := range oldFac.Bookings {
-		existingStart := toAbsoluteMinutes(bk.StartDay, bk.StartHour, bk.StartMinute)
-		existingEnd := toAbsoluteMinutes(bk.EndDay, bk.EndHour, bk.EndMinute)
-		if timesOverlap(newStartAbs, newEndAbs, existingStart, existingEnd) {
-			// Collision detected; revert removal.
-			oldFac.Bookings = append(oldFac.Bookings, *oldBooking)
-			log.Printf("Time conflict detected when changing booking '%s'", confID)
-			return "Time conflict with an existing booking.", 1
-		}
+	if !oldFac.hasRoom(schedule.Interval{Start: newStartAbs, End: newEndAbs}) {
+		// Collision detected; revert removal.
+		oldFac.Bookings = append(oldFac.Bookings, *oldBooking)
+		log.Printf("Time conflict detected when changing booking '%s'", confID)
+		return oldFac.bookingConflict(), 1
+	}
+	if b, closed := oldFac.blackoutOverlapping(newStartAbs, newEndAbs); closed {
+		oldFac.Bookings = append(oldFac.Bookings, *oldBooking)
+		log.Printf("Changing booking '%s' would move it into a blackout", confID)
+		return blackoutConflict(b), 1
 	}
 
 	// Create an updated booking with the new timings.
@@ -373,59 +1013,148 @@ func (s *ServerState) handleChangeBooking(req common.RequestMessage) (string, in
 		EndMinute:      newEndMinute,
 		Participants:   oldBooking.Participants,
 	}
+	if err := s.store.UpdateBooking(qualify(req.Namespace, facName), updated); err != nil {
+		oldFac.Bookings = append(oldFac.Bookings, *oldBooking)
+		log.Printf("Failed to persist change to booking '%s': %v", confID, err)
+		return "Error: could not save booking change.", -1
+	}
 	oldFac.Bookings = append(oldFac.Bookings, updated)
 
 	// Notify subscribers of the timing change.
-	s.notifySubscribers(facName,
-		fmt.Sprintf("Booking %s changed using offset %d min: Day %d (%02d:%02d) -> Day %d (%02d:%02d)",
-			confID, offset, newStartDay, newStartHour, newStartMinute, newEndDay, newEndHour, newEndMinute))
+	s.notifySubscribers(req.Namespace, facName, EventBookingChanged, confID,
+		fmt.Sprintf("Booking %s changed using offset %d min: %s -> %s",
+			confID, offset, common.FormatLongWeekTime(newStartAbs), common.FormatLongWeekTime(newEndAbs)),
+		affectedDays(*oldBooking, updated))
 	msg := fmt.Sprintf("Changed booking %s by offset %d minutes successfully.", confID, offset)
+	if req.EndOnly {
+		msg = fmt.Sprintf("Changed the end of booking %s by offset %d minutes successfully.", confID, offset)
+	}
 	log.Printf("ChangeBooking successful: %s", msg)
 	return msg, 0
 }
 
 // handleMonitorRegistration adds a subscription entry.
-func (s *ServerState) handleMonitorRegistration(clientAddr *net.UDPAddr, req common.RequestMessage) (string, int32) {
+func (s *ServerState) handleMonitorRegistration(clientAddr Peer, req common.RequestMessage, t *opTiming) (string, int32) {
 	facName := req.FacilityName
 	log.Printf("Handling MonitorAvailability for facility '%s' from %s", facName, clientAddr)
 
-	s.dataLock.Lock()
-	_, ok := s.facilityData[facName]
-	s.dataLock.Unlock()
+	t.rlock(&s.dataLock)
+	_, ok := s.facilityData[req.Namespace][facName]
+	s.dataLock.RUnlock()
 	if !ok {
 		log.Printf("Facility '%s' not found in MonitorAvailability", facName)
-		return fmt.Sprintf("Facility '%s' not found", facName), -1
+		t.reject("FacilityName", facName)
+		return s.facilityNotFound(req.Namespace, facName), -1
+	}
+
+	days, err := validate.NormalizeDaysList(req.DaysList)
+	if err != nil {
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v", err), common.StatusInvalidArgument
+	}
+	req.DaysList = days
+
+	// A zero period would register an already expired subscription; a huge
+	// one is capped below so it cannot hold a slot for good
+	if err := validate.ValidateMonitorPeriod(req.MonitorPeriod); err != nil {
+		log.Printf("Rejecting MonitorAvailability for '%s' from %s: %v", facName, clientAddr, err)
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v", err), common.StatusInvalidArgument
+	}
+	period := time.Duration(req.MonitorPeriod) * time.Second
+	capped := period > s.maxMonitorPeriod
+	if capped {
+		period = s.maxMonitorPeriod
+	}
+	token, err := newSessionToken()
+	if err != nil {
+		log.Printf("Failed to create monitor token: %v", err)
+		return "Error: could not register monitor.", -1
 	}
 
-	duration := req.MonitorPeriod
-	expiry := time.Now().Add(time.Duration(duration) * time.Second)
+	now := s.now()
+	expiry := now.Add(period)
 	sub := MonitorRegistration{
 		ClientAddr:   clientAddr,
+		Namespace:    req.Namespace,
 		FacilityName: facName,
 		ExpiresAt:    expiry,
+		Days:         append([]uint8(nil), req.DaysList...),
+		Events:       req.EventMask,
+		Token:        token,
+		User:         req.User,
 	}
-	s.monitorLock.Lock()
-	s.monitorSubs = append(s.monitorSubs, sub)
+	// A repeated registration from the same client, or the same session
+	// user, extends the live subscription in place: the later expiry wins,
+	// the new filters apply, and the sequence numbers, buffer and token are
+	// kept, so the client never gets two interleaved callback sequences
+	extended := false
+	t.lock(&s.monitorLock)
+	subs := s.monitorSubs[:0]
+	for _, old := range s.monitorSubs {
+		if !extended && old.sameSubscriber(req.Namespace, facName, clientAddr, req.User) && now.Before(old.ExpiresAt) {
+			if old.ExpiresAt.After(sub.ExpiresAt) {
+				sub.ExpiresAt = old.ExpiresAt
+			}
+			sub.Token, sub.Seq, sub.Recent = old.Token, old.Seq, old.Recent
+			if sub.User == "" {
+				sub.User = old.User
+			}
+			extended = true
+			continue
+		}
+		if !old.sameSubscriber(req.Namespace, facName, clientAddr, req.User) {
+			subs = append(subs, old)
+		}
+	}
+	s.monitorSubs = append(subs, sub)
 	s.monitorLock.Unlock()
 
-	msg := fmt.Sprintf("Monitoring %s for %d seconds.", facName, duration)
+	msg := "Monitoring " + facName
+	if extended {
+		msg = "Extended monitoring of " + facName
+	}
+	if len(sub.Days) > 0 {
+		msg += fmt.Sprintf(" on days %v", sub.Days)
+	}
+	msg += fmt.Sprintf(" for %d seconds", int64(sub.ExpiresAt.Sub(now).Round(time.Second)/time.Second))
+	if capped {
+		msg += fmt.Sprintf(" (%d requested; the server allows at most %d)", req.MonitorPeriod, int64(s.maxMonitorPeriod/time.Second))
+	}
+	msg += "."
+	if sub.Events != 0 && sub.Events != common.AllEvents {
+		msg += fmt.Sprintf(" Events: %s.", common.EventMaskString(sub.Events))
+	}
+	msg += " Expires=" + sub.ExpiresAt.UTC().Format(time.RFC3339) + " Token=" + sub.Token
 	log.Printf("MonitorRegistration successful: %s", msg)
 	return msg, 0
 }
 
 // handleCancelBooking removes a booking; idempotent operation.
-func (s *ServerState) handleCancelBooking(req common.RequestMessage) (string, int32) {
+func (s *ServerState) handleCancelBooking(req common.RequestMessage, t *opTiming) (string, int32) {
 	confID := req.ConfirmationID
 	log.Printf("Handling CancelBooking for ConfirmationID '%s'", confID)
 
-	s.dataLock.Lock()
+	t.lock(&s.dataLock)
 	defer s.dataLock.Unlock()
 
-	for facName, fac := range s.facilityData {
+	for facName, fac := range s.facilityData[req.Namespace] {
 		for i, bk := range fac.Bookings {
 			if bk.ConfirmationID == confID {
+				if status, started := s.bookingStarted(bk); started && !req.Force {
+					log.Printf("Refusing to cancel booking '%s': it has already started", confID)
+					if status == common.StatusBookingOver {
+						t.reject("ConfirmationID", confID)
+						return fmt.Sprintf("Booking %s has already ended (now %s)", confID, formatWeekMinutes(s.clock())), status
+					}
+					return fmt.Sprintf("Booking %s is in progress (now %s); only the admin can force its cancellation", confID, formatWeekMinutes(s.clock())), status
+				}
+				if err := s.store.DeleteBooking(confID); err != nil {
+					log.Printf("Failed to persist cancellation of '%s': %v", confID, err)
+					return "Error: could not cancel booking.", -1
+				}
 				fac.Bookings = append(fac.Bookings[:i], fac.Bookings[i+1:]...)
-				s.notifySubscribers(facName, fmt.Sprintf("Booking %s canceled", confID))
+				s.notifySubscribers(req.Namespace, facName, EventBookingCanceled, confID, fmt.Sprintf("Booking %s canceled", confID), affectedDays(bk))
 				msg := fmt.Sprintf("Canceled booking %s", confID)
 				log.Printf("CancelBooking successful: %s", msg)
 				return msg, 0
@@ -438,17 +1167,17 @@ func (s *ServerState) handleCancelBooking(req common.RequestMessage) (string, in
 }
 
 // handleAddParticipant appends a participant to a booking; non-idempotent.
-func (s *ServerState) handleAddParticipant(req common.RequestMessage) (string, int32) {
+func (s *ServerState) handleAddParticipant(req common.RequestMessage, t *opTiming) (string, int32) {
 	confID := req.ConfirmationID
 	participant := req.ParticipantName
 	log.Printf("Handling AddParticipant: adding '%s' to booking '%s'", participant, confID)
 
-	s.dataLock.Lock()
+	t.lock(&s.dataLock)
 	defer s.dataLock.Unlock()
 
 	var foundBooking *Booking
 	var facName string
-	for fn, fac := range s.facilityData {
+	for fn, fac := range s.facilityData[req.Namespace] {
 		for i := range fac.Bookings {
 			if fac.Bookings[i].ConfirmationID == confID {
 				foundBooking = &fac.Bookings[i]
@@ -462,38 +1191,97 @@ func (s *ServerState) handleAddParticipant(req common.RequestMessage) (string, i
 	}
 	if foundBooking == nil {
 		log.Printf("Booking '%s' not found in AddParticipant", confID)
+		t.reject("ConfirmationID", confID)
 		return fmt.Sprintf("Error: Booking %s not found", confID), -1
 	}
+	if foundBooking.Pending {
+		return refusePending(*foundBooking, t)
+	}
 
-	foundBooking.Participants = append(foundBooking.Participants, participant)
-	s.notifySubscribers(facName, fmt.Sprintf("Participant %s added to booking %s", participant, confID))
+	updated := *foundBooking
+	updated.Participants = append(append([]string{}, foundBooking.Participants...), participant)
+	if err := s.store.UpdateBooking(qualify(req.Namespace, facName), updated); err != nil {
+		log.Printf("Failed to persist participant for '%s': %v", confID, err)
+		return "Error: could not save participant.", -1
+	}
+	foundBooking.Participants = updated.Participants
+	s.notifySubscribers(req.Namespace, facName, EventParticipantAdded, confID, fmt.Sprintf("Participant %s added to booking %s", participant, confID), affectedDays(updated))
 	msg := fmt.Sprintf("Added participant=%s to booking=%s", participant, confID)
 	log.Printf("AddParticipant successful: %s", msg)
 	return msg, 0
 }
 
-// listAllBookings returns a summary of all bookings for a facility.
-func (s *ServerState) listAllBookings(fac *FacilityInfo) string {
+// maxListPage is the most bookings one ListBookings reply carries, so a
+// page stays well inside one datagram.
+const maxListPage = 50
+
+// handleListBookings returns one page of a facility's bookings, sorted by
+// start time and then ID so pages neither skip nor repeat a booking while
+// the schedule is unchanged. The reply ends with "Next=<offset>" when more
+// bookings follow.
+func (s *ServerState) handleListBookings(req common.RequestMessage, t *opTiming) (string, int32) {
+	log.Printf("Handling ListBookings for facility '%s' from %d", req.FacilityName, req.PageOffset)
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+
+	fac, ok := s.facilityData[req.Namespace][req.FacilityName]
+	if !ok {
+		t.reject("FacilityName", req.FacilityName)
+		return "Error: " + s.facilityNotFound(req.Namespace, req.FacilityName), -1
+	}
+	limit := int(req.PageLimit)
+	if limit == 0 || limit > maxListPage {
+		limit = maxListPage
+	}
+	return listBookings(fac, int(req.PageOffset), limit), 0
+}
+
+// listBookings returns a summary of up to limit bookings of a facility,
+// starting at offset in start order.
+func listBookings(fac *FacilityInfo, offset, limit int) string {
 	if len(fac.Bookings) == 0 {
 		return fmt.Sprintf("Facility=%s has no bookings.", fac.Name)
 	}
-	result := fmt.Sprintf("Facility=%s, existing bookings:\n", fac.Name)
-	for _, bk := range fac.Bookings {
-		result += fmt.Sprintf("  - %s: Day %d (%02d:%02d) to Day %d (%02d:%02d)\n",
-			bk.ConfirmationID,
-			bk.StartDay, bk.StartHour, bk.StartMinute,
-			bk.EndDay, bk.EndHour, bk.EndMinute,
-		)
+	sorted := append([]Booking(nil), fac.Bookings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a := schedule.ToMinutes(sorted[i].StartDay, sorted[i].StartHour, sorted[i].StartMinute)
+		b := schedule.ToMinutes(sorted[j].StartDay, sorted[j].StartHour, sorted[j].StartMinute)
+		if a != b {
+			return a < b
+		}
+		return sorted[i].ConfirmationID < sorted[j].ConfirmationID
+	})
+	if offset >= len(sorted) {
+		return fmt.Sprintf("Facility=%s, no bookings after %d of %d.", fac.Name, offset, len(sorted))
+	}
+	end := offset + limit
+	if end > len(sorted) {
+		end = len(sorted)
+	}
+	result := fmt.Sprintf("Facility=%s, bookings %d-%d of %d:\n", common.EscapeText(fac.Name), offset+1, end, len(sorted))
+	for _, bk := range sorted[offset:end] {
+		iv := bk.interval()
+		label := bk.ConfirmationID
+		if bk.Pending {
+			label += pendingLabel(bk)
+		}
+		result += fmt.Sprintf("  - %s: %s to %s\n",
+			label, common.FormatLongWeekTime(iv.Start), common.FormatLongWeekTime(iv.End))
 		if len(bk.Participants) > 0 {
-			result += fmt.Sprintf("      Participants: %v\n", bk.Participants)
+			result += fmt.Sprintf("      Participants: %v\n", escapeNames(bk.Participants))
 		}
 	}
+	if end < len(sorted) {
+		result += fmt.Sprintf("Next=%d\n", end)
+	}
 	return result
 }
 
 // processOperation dispatches to the correct handler based on OpCode.
-func (s *ServerState) processOperation(req common.RequestMessage, clientAddr *net.UDPAddr) common.ReplyMessage {
-	log.Printf("Processing operation with OpCode %d for RequestID %d", req.OpCode, req.RequestID)
+func (s *ServerState) processOperation(req common.RequestMessage, clientAddr Peer) common.ReplyMessage {
+	log.Printf("Processing %s for RequestID %d", common.OpName(req.OpCode), req.RequestID)
+	t := &opTiming{start: time.Now()}
+	defer s.finishTiming(req, t)
 	rep := common.ReplyMessage{
 		RequestID: req.RequestID,
 		OpCode:    req.OpCode,
@@ -501,34 +1289,157 @@ func (s *ServerState) processOperation(req common.RequestMessage, clientAddr *ne
 		Data:      "",
 	}
 
+	// Facility names are checked as the client checks its input; whether
+	// the facility exists is up to each handler
+	if req.FacilityName != "" {
+		if err := validate.ValidateFacilityName(req.FacilityName); err != nil {
+			rejectField(t, err)
+			rep.Status, rep.Data = common.StatusInvalidArgument, fmt.Sprintf("Error: %v", err)
+			echoRequest(&rep, req, t.badField, t.badValue)
+			return rep
+		}
+	}
+	// Every request works in one namespace, the default one unless it names
+	// another; a new namespace is named in TargetNamespace instead
+	req.Namespace = req.NamespaceOf()
+	if req.OpCode != common.OpRegisterUser && req.OpCode != common.OpCreateNamespace && !s.hasNamespace(req.Namespace, t) {
+		t.reject("Namespace", req.Namespace)
+		rep.Status, rep.Data = -1, namespaceNotFound(req.Namespace)
+		echoRequest(&rep, req, t.badField, t.badValue)
+		return rep
+	}
+	// Names are matched regardless of case
+	s.canonicalFacilities(&req, t)
+	// A facility's old name is answered with its new one for a while
+	if msg, renamed := s.renamedReply(req, t); renamed {
+		rep.Status, rep.Data = -1, msg
+		echoRequest(&rep, req, t.badField, t.badValue)
+		return rep
+	}
+
 	switch req.OpCode {
 	case common.OpQueryAvailability:
-		rep.Data = s.handleQuery(req.FacilityName, req.DaysList)
+		days, err := validate.NormalizeDaysList(req.DaysList)
+		if err != nil {
+			rejectField(t, err)
+			rep.Status, rep.Data = common.StatusInvalidArgument, fmt.Sprintf("Error: %v", err)
+			break
+		}
+		// An empty list is shorthand for the whole week
+		if len(days) == 0 {
+			days = validate.AllDays()
+		}
+		req.DaysList = days
+		// Read the number before the schedule, so a mutation in between is
+		// reported again by the next delta query rather than missed
+		seq := s.changes.current()
+		switch {
+		case req.Bitmap:
+			rep.Data, rep.Status, rep.Extensions = s.handleQueryBitmap(req, t)
+		case len(req.MoreFacilities) > 0:
+			rep.Data = s.handleQueryFacilities(req.Namespace, append([]string{req.FacilityName}, req.MoreFacilities...), req.DaysList, t)
+		default:
+			rep.Data, rep.Extensions = s.handleQuery(req.Namespace, req.FacilityName, req.DaysList, t)
+		}
+		if rep.Status == common.StatusOK && !strings.HasPrefix(rep.Data, "Error: ") {
+			rep.Data = strings.TrimRight(rep.Data, "\n") + fmt.Sprintf("\nSeq=%d", seq)
+		}
 	case common.OpBookFacility:
-		msg, status := s.handleBookFacility(req)
+		msg, status := s.handleBookFacility(req, t)
 		rep.Data = msg
 		rep.Status = status
 	case common.OpChangeBooking:
-		msg, status := s.handleChangeBooking(req)
+		msg, status := s.handleChangeBooking(req, t)
 		rep.Data = msg
 		rep.Status = status
 	case common.OpMonitorAvailability:
-		msg, status := s.handleMonitorRegistration(clientAddr, req)
+		msg, status := s.handleMonitorRegistration(clientAddr, req, t)
 		rep.Data = msg
 		rep.Status = status
 	case common.OpCancelBooking:
-		msg, status := s.handleCancelBooking(req)
+		msg, status := s.handleCancelBooking(req, t)
 		rep.Data = msg
 		rep.Status = status
 	case common.OpAddParticipant:
-		msg, status := s.handleAddParticipant(req)
+		msg, status := s.handleAddParticipant(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpRegisterUser:
+		msg, status := s.handleRegisterUser(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpResendCallbacks:
+		msg, status := s.handleResendCallbacks(clientAddr, req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpRebindMonitor:
+		msg, status := s.handleRebindMonitor(clientAddr, req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpListMonitors:
+		rep.Data = s.handleListMonitors(t)
+	case common.OpAddBlackout:
+		msg, status := s.handleAddBlackout(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpListBookings:
+		msg, status := s.handleListBookings(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpClearBookings:
+		msg, status := s.handleClearBookings(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpQueryChanges:
+		msg, status := s.handleQueryChanges(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpFindParticipant:
+		msg, status := s.handleFindParticipant(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpTransferBooking:
+		msg, status := s.handleTransferBooking(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpSplitBooking:
+		msg, status := s.handleSplitBooking(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpCopyBooking:
+		msg, status := s.handleCopyBooking(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpFreeBusy:
+		rep.Data, rep.Status, rep.Extensions = s.handleFreeBusy(req, t)
+	case common.OpHeatmap:
+		rep.Data, rep.Status, rep.Extensions = s.handleHeatmap(req, t)
+	case common.OpRenameFacility:
+		msg, status := s.handleRenameFacility(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpCreateNamespace:
+		msg, status := s.handleCreateNamespace(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpDeleteNamespace:
+		msg, status := s.handleDeleteNamespace(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpApproveBooking:
+		msg, status := s.handleApproveBooking(req, t)
+		rep.Data = msg
+		rep.Status = status
+	case common.OpRejectBooking:
+		msg, status := s.handleRejectBooking(req, t)
 		rep.Data = msg
 		rep.Status = status
 	default:
 		rep.Status = -1
-		rep.Data = fmt.Sprintf("Unknown OpCode %d", req.OpCode)
+		rep.Data = fmt.Sprintf("Unsupported operation %s", common.OpName(req.OpCode))
 	}
 
+	echoRequest(&rep, req, t.badField, t.badValue)
 	log.Printf("Processed RequestID %d with result: %s (Status=%d)", req.RequestID, rep.Data, rep.Status)
 	return rep
 }
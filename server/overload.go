@@ -0,0 +1,41 @@
+// server/overload.go
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// defaultBusyRetryAfter is the wait suggested in busy replies by default.
+const defaultBusyRetryAfter = time.Second
+
+// lockWaiters counts operations waiting in opTiming.lock. Without -workers
+// every packet gets its own goroutine, so under load the work queues up on
+// dataLock rather than in a channel, and this is the queue depth.
+var lockWaiters atomic.Int64
+
+// overloadLimits are the admission thresholds; 0 disables a limit.
+type overloadLimits struct {
+	maxInFlight  int64         // packets being handled (-maxInFlight)
+	maxLockQueue int64         // operations waiting for a lock (-maxLockQueue)
+	retryAfter   time.Duration // wait suggested in busy replies (-busyRetryAfter)
+}
+
+// admit counts a packet as in flight, or returns why the server is too
+// busy to take it. The caller releases an admitted packet with
+// s.inFlight.Add(-1).
+func (s *ServerState) admit() (reason string, ok bool) {
+	n := s.inFlight.Add(1)
+	switch {
+	case s.overload.maxInFlight > 0 && n > s.overload.maxInFlight:
+		reason = fmt.Sprintf("%d requests in flight", n-1)
+	case s.overload.maxLockQueue > 0 && lockWaiters.Load() >= s.overload.maxLockQueue:
+		reason = fmt.Sprintf("%d requests queued", lockWaiters.Load())
+	default:
+		return "", true
+	}
+	s.inFlight.Add(-1)
+	s.busyReplies.Add(1)
+	return reason, false
+}
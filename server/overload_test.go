@@ -0,0 +1,87 @@
+// server/overload_test.go
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestBusyInFlight holds one booking in the store with -maxInFlight=1:
+// everything else is refused at once with a retry-after, and a refused
+// request sent again later is handled as new.
+func TestBusyInFlight(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var saves atomic.Int32
+	srv := newHookServer(t, SemanticsAtMostOnce, slowSaves(entered, release, &saves))
+	srv.overload = overloadLimits{maxInFlight: 1, retryAfter: 1500 * time.Millisecond}
+
+	holder := newFakePeer("holder")
+	held := make(chan []common.ReplyMessage)
+	go func() { held <- deliver(srv, holder, holder.seal(t, bookReq(1, "RoomA", 3, 9, 10))) }()
+	<-entered
+
+	// The server stays responsive: a flood is answered without waiting
+	p := newFakePeer("client")
+	start := time.Now()
+	for i := uint64(1); i <= 50; i++ {
+		rep := send(t, srv, p, bookReq(i, "Lab1", 4, 9, 10))
+		if rep.Status != common.StatusBusy || !strings.HasSuffix(rep.Data, "retry-after=2") {
+			t.Fatalf("request %d: status %d: %s", i, rep.Status, rep.Data)
+		}
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("50 busy replies took %v", took)
+	}
+	if n := srv.busyReplies.Load(); n != 50 {
+		t.Errorf("%d busy replies counted, want 50", n)
+	}
+
+	close(release)
+	<-held
+	if n := srv.inFlight.Load(); n != 0 {
+		t.Errorf("%d packets still counted in flight", n)
+	}
+	// Busy replies were not cached: the same RequestID now books
+	if rep := send(t, srv, p, bookReq(1, "Lab1", 4, 9, 10)); rep.Status != common.StatusOK {
+		t.Errorf("resent request: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestBusyLockQueue: past -maxLockQueue operations waiting for the
+// schedule lock, new requests are refused.
+func TestBusyLockQueue(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var saves atomic.Int32
+	srv := newHookServer(t, SemanticsAtMostOnce, slowSaves(entered, release, &saves))
+	srv.overload = overloadLimits{maxLockQueue: 1, retryAfter: time.Second}
+
+	done := make(chan struct{})
+	for _, p := range []*fakePeer{newFakePeer("holder"), newFakePeer("waiter")} {
+		raw := p.seal(t, bookReq(1, "RoomA", 3, 9+uint8(len(p.name)), 10+uint8(len(p.name))))
+		go func(p *fakePeer) {
+			deliver(srv, p, raw)
+			done <- struct{}{}
+		}(p)
+		if p.name == "holder" {
+			<-entered
+		}
+	}
+	for deadline := time.Now().Add(time.Second); lockWaiters.Load() < 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("second booking never waited for the lock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rep := send(t, srv, newFakePeer("client"), bookReq(1, "Lab1", 4, 9, 10))
+	if rep.Status != common.StatusBusy || !strings.Contains(rep.Data, "1 requests queued") {
+		t.Errorf("status %d: %s", rep.Status, rep.Data)
+	}
+	close(release)
+	<-done
+	<-done
+}
@@ -0,0 +1,50 @@
+// server/panic_test.go
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestHandlerPanic runs a booking whose store save panics once. The client
+// gets StatusInternal, the panic is logged with the request and counted,
+// nothing is cached, and the server keeps serving.
+func TestHandlerPanic(t *testing.T) {
+	logs := captureLogs(t, LogFormatText)
+	var saves atomic.Int32
+	srv := newHookServer(t, SemanticsAtMostOnce, func(string, Booking) {
+		if saves.Add(1) == 1 {
+			panic("disk on fire")
+		}
+	})
+	p := newFakePeer("client")
+
+	rep := send(t, srv, p, bookReq(1, "Lab1", 4, 9, 10))
+	if rep.Status != common.StatusInternal {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	if n := srv.panics.Load(); n != 1 {
+		t.Errorf("%d panics counted, want 1", n)
+	}
+	for _, want := range []string{"Panic while handling BookFacility RequestID=1", `facility="Lab1"`, "disk on fire"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log lacks %q", want)
+		}
+	}
+
+	// The lock was released and other requests are served
+	query := common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 2, FacilityName: "RoomA"}
+	if rep := send(t, srv, p, query); rep.Status != common.StatusOK {
+		t.Errorf("query after the panic: status %d: %s", rep.Status, rep.Data)
+	}
+	// The crash left no reply in the history: a resend runs afresh
+	if rep := send(t, srv, p, bookReq(1, "Lab1", 4, 9, 10)); rep.Status != common.StatusOK {
+		t.Errorf("resend: status %d: %s", rep.Status, rep.Data)
+	}
+	if n := saves.Load(); n != 2 {
+		t.Errorf("%d saves, want the crashed one and the resend", n)
+	}
+}
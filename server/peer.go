@@ -0,0 +1,49 @@
+// server/peer.go
+package main
+
+import (
+	"net"
+	"sync"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Peer is the destination for replies and callbacks to one client,
+// independent of the transport the client used. String returns the address
+// used in dedup keys and logs.
+type Peer interface {
+	Send(data []byte) error
+	String() string
+}
+
+// udpPeer replies with datagrams on the server's listening socket.
+type udpPeer struct {
+	conn *net.UDPConn
+	addr *net.UDPAddr
+}
+
+func (p *udpPeer) Send(data []byte) error {
+	_, err := p.conn.WriteToUDP(common.PrefixLength(data), p.addr)
+	return err
+}
+
+func (p *udpPeer) String() string {
+	return p.addr.String()
+}
+
+// tcpPeer writes length-prefixed frames on a client's TCP connection.
+// Writes are serialised because replies and callbacks share the stream.
+type tcpPeer struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+func (p *tcpPeer) Send(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return common.WriteFrame(p.conn, data)
+}
+
+func (p *tcpPeer) String() string {
+	return "tcp:" + p.conn.RemoteAddr().String()
+}
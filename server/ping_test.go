@@ -0,0 +1,40 @@
+// server/ping_test.go
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestPing(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.maxSkew = time.Second // pings skip the timestamp window
+	srv.clockOffset = time.Hour
+	p := newFakePeer("client")
+
+	sent := time.Now().UnixNano()
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpPing, RequestID: 1, PingTime: sent})
+	if rep.Status != common.StatusOK || rep.OpCode != common.OpPing {
+		t.Fatalf("ping: op %d status %d: %s", rep.OpCode, rep.Status, rep.Data)
+	}
+	if echoed, err := strconv.ParseInt(rep.Data, 10, 64); err != nil || echoed != sent {
+		t.Errorf("ping reply Data = %q, want the echoed %d", rep.Data, sent)
+	}
+	clock := time.UnixMilli(rep.ServerClock)
+	if d := clock.Sub(time.Now().Add(time.Hour)); d < -time.Second || d > time.Second {
+		t.Errorf("server clock in the reply is %v off the shifted clock", d)
+	}
+
+	// Pings are not recorded in the at-most-once history: a repeated ID
+	// gets a fresh echo, not the cached one
+	again := send(t, srv, p, common.RequestMessage{OpCode: common.OpPing, RequestID: 1, PingTime: sent + 1})
+	if again.Data != strconv.FormatInt(sent+1, 10) {
+		t.Errorf("second ping with the same ID echoed %q", again.Data)
+	}
+	if n := srv.history.(*MemoryHistory).Len(); n != 0 {
+		t.Errorf("history holds %d entries after pings, want 0", n)
+	}
+}
@@ -0,0 +1,182 @@
+// server/query_test.go
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+// queryData sends a query of facilities on days and returns its reply
+// without the trailing Seq= line.
+func queryData(t *testing.T, srv *ServerState, id uint64, days []uint8, facilities ...string) string {
+	t.Helper()
+	rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: id,
+		FacilityName: facilities[0], MoreFacilities: facilities[1:], DaysList: days})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("query %v: status %d: %s", facilities, rep.Status, rep.Data)
+	}
+	if i := strings.LastIndex(rep.Data, "\nSeq="); i >= 0 {
+		return rep.Data[:i]
+	}
+	return rep.Data
+}
+
+// TestQueryFacilities asks for known and unknown facilities at once: each
+// known one gets the section a query of it alone would, in the order asked,
+// and each unknown one a line of its own.
+func TestQueryFacilities(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	days := []uint8{0, 2}
+	got := queryData(t, srv, 1, days, "Lab1", "Gym", "RoomA", "roomb")
+
+	var at []int
+	for i, want := range []string{
+		strings.TrimRight(queryData(t, srv, 2, days, "Lab1"), "\n"),
+		"Error: Facility 'Gym' not found",
+		strings.TrimRight(queryData(t, srv, 3, days, "RoomA"), "\n"),
+		"Error: Facility 'roomb' not found",
+	} {
+		j := strings.Index(got, want)
+		if j < 0 {
+			t.Fatalf("section %d missing: %q\nin\n%s", i+1, want, got)
+		}
+		at = append(at, j)
+	}
+	for i := 1; i < len(at); i++ {
+		if at[i] < at[i-1] {
+			t.Errorf("section %d comes before section %d:\n%s", i+1, i, got)
+		}
+	}
+}
+
+func TestQueryFacilitiesAllUnknown(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	got := queryData(t, srv, 1, nil, "Gym", "Pool")
+	if strings.Count(got, "not found") != 2 || strings.Contains(got, "availability:") {
+		t.Errorf("reply:\n%s", got)
+	}
+}
+
+// TestQueryOccupied: a single-facility query lists the bookings its text
+// shows in ExtOccupied, for clients to check conflicts against.
+func TestQueryOccupied(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	tests := []struct {
+		days []uint8
+		want []common.Occupied
+	}{
+		{[]uint8{0}, []common.Occupied{{ID: "BKG-10000", Interval: schedule.Span(0, 9, 0, 0, 10, 0)}}},
+		{[]uint8{1, 2}, []common.Occupied{{ID: "BKG-10001", Interval: schedule.Span(1, 14, 0, 1, 15, 30)}}},
+		{[]uint8{4}, nil},
+	}
+	for i, tt := range tests {
+		rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: uint64(i + 1),
+			FacilityName: "RoomA", DaysList: tt.days})
+		got, ok, err := common.OccupiedOf(rep)
+		if !ok || err != nil || len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("days %v: occupied %+v (%v, %v), want %+v", tt.days, got, ok, err, tt.want)
+		}
+	}
+}
+
+// TestOutputNamesDays: replies name days rather than giving their index.
+func TestOutputNamesDays(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	out := queryData(t, srv, 1, []uint8{0, 6}, "RoomA")
+	if !strings.Contains(out, "Monday:\n") || !strings.Contains(out, "Sunday:\n") || strings.Contains(out, "Day ") {
+		t.Errorf("query output:\n%s", out)
+	}
+	rep := send(t, srv, newFakePeer("client"), bookReq(2, "RoomA", 4, 9, 10))
+	if !strings.Contains(rep.Data, "from Friday 09:00 to Friday 10:00") {
+		t.Errorf("booking reply %q", rep.Data)
+	}
+}
+
+// TestQueryDaysNormalized: repeated days are answered once and days come
+// Monday first, whatever the order asked; lists the week cannot hold are
+// refused.
+func TestQueryDaysNormalized(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	if got, want := queryData(t, srv, 1, []uint8{3, 3, 3, 3}, "RoomA"), queryData(t, srv, 2, []uint8{3}, "RoomA"); got != want {
+		t.Errorf("repeated day answered as\n%s\nwant\n%s", got, want)
+	}
+	if got, want := queryData(t, srv, 3, []uint8{4, 1, 4}, "RoomA"), queryData(t, srv, 4, []uint8{1, 4}, "RoomA"); got != want {
+		t.Errorf("days out of order answered as\n%s\nwant\n%s", got, want)
+	}
+
+	p := newFakePeer("client")
+	for i, days := range [][]uint8{{7}, {2, 200}, {0, 1, 2, 3, 4, 5, 6, 0}} {
+		rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: uint64(10 + i),
+			FacilityName: "RoomA", DaysList: days})
+		if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, "DaysList") {
+			t.Errorf("days %v: status %d: %s", days, rep.Status, rep.Data)
+		}
+	}
+}
+
+// TestMonitorDaysNormalized: a monitor keeps the normalized days.
+func TestMonitorDaysNormalized(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	if rep := send(t, srv, newFakePeer("watcher"), monitorReq(1, []uint8{5, 2, 5}, 0)); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+	srv.monitorLock.Lock()
+	days := srv.monitorSubs[0].Days
+	srv.monitorLock.Unlock()
+	if !reflect.DeepEqual(days, []uint8{2, 5}) {
+		t.Errorf("monitor watches %v, want [2 5]", days)
+	}
+	if rep := send(t, srv, newFakePeer("watcher"), monitorReq(2, []uint8{9}, 0)); rep.Status != common.StatusInvalidArgument {
+		t.Errorf("monitor of day 9: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestQueryEmptyDaysList: an empty DaysList is answered exactly like the
+// seven days spelled out, for plain, bitmap and multi-facility queries,
+// and the history returns the same reply for both on a resend.
+func TestQueryEmptyDaysList(t *testing.T) {
+	week := []uint8{0, 1, 2, 3, 4, 5, 6}
+	tests := []struct {
+		name string
+		req  common.RequestMessage
+	}{
+		{"plain", common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "RoomA"}},
+		{"bitmap", common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "RoomA", Bitmap: true}},
+		{"facilities", common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "RoomA", MoreFacilities: []string{"Lab1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			p := newFakePeer("client")
+			short, long := tt.req, tt.req
+			short.RequestID, long.RequestID = 1, 2
+			long.DaysList = week
+
+			shortRep, longRep := send(t, srv, p, short), send(t, srv, p, long)
+			if shortRep.Status != common.StatusOK || shortRep.Data != longRep.Data ||
+				!reflect.DeepEqual(shortRep.Extensions, longRep.Extensions) {
+				t.Fatalf("empty list answered\n%+v\nexplicit list\n%+v", shortRep, longRep)
+			}
+			if !strings.Contains(shortRep.Data, "Sunday") && !tt.req.Bitmap {
+				t.Errorf("empty list does not reach Sunday:\n%s", shortRep.Data)
+			}
+
+			// A booking in between does not reach the cached replies
+			confirmationID(t, send(t, srv, p, bookReq(3, "RoomA", 4, 9, 10)))
+			for _, tc := range []struct {
+				req  common.RequestMessage
+				want common.ReplyMessage
+			}{{short, shortRep}, {long, longRep}} {
+				again := send(t, srv, p, tc.req)
+				if again.Data != tc.want.Data || !reflect.DeepEqual(again.Extensions, tc.want.Extensions) {
+					t.Errorf("resend of days %v got\n%s\nwant the cached\n%s", tc.req.DaysList, again.Data, tc.want.Data)
+				}
+			}
+		})
+	}
+}
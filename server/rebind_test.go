@@ -0,0 +1,81 @@
+// server/rebind_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// monitorToken registers p on RoomA and returns the token of the
+// registration.
+func monitorToken(t *testing.T, srv *ServerState, p *fakePeer, req common.RequestMessage) string {
+	t.Helper()
+	rep := send(t, srv, p, req)
+	_, token, ok := strings.Cut(rep.Data, "Token=")
+	if rep.Status != common.StatusOK || !ok || token == "" {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+	return token
+}
+
+func rebindReq(id uint64, token, session string) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpRebindMonitor, RequestID: id, MonitorToken: token, SessionToken: session}
+}
+
+func TestRebindMonitor(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	before, after := newFakePeer("old-port"), newFakePeer("new-port")
+	token := monitorToken(t, srv, before, monitorReq(1, nil, 0))
+	client := newFakePeer("client")
+	send(t, srv, client, addParticipant(2, "Ada"))
+
+	if rep := send(t, srv, after, rebindReq(3, token, "")); rep.Status != common.StatusOK {
+		t.Fatalf("rebind: status %d: %s", rep.Status, rep.Data)
+	}
+	send(t, srv, client, addParticipant(4, "Grace"))
+
+	if got := seqs(before); len(got) != 1 {
+		t.Errorf("old address got callbacks %v after the rebind, want only the first", got)
+	}
+	// The sequence carries on at the new address
+	if got := seqs(after); len(got) != 1 || got[0] != 2 {
+		t.Errorf("new address got callbacks %v, want 2", got)
+	}
+}
+
+func TestRebindMonitorRejected(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	owner, intruder := newFakePeer("owner"), newFakePeer("intruder")
+	alice := login(t, srv, owner, 1, "alice", "pw")
+	req := monitorReq(2, nil, 0)
+	req.SessionToken = alice
+	token := monitorToken(t, srv, owner, req)
+	mallory := login(t, srv, intruder, 3, "mallory", "pw")
+
+	tests := []struct {
+		name    string
+		token   string
+		session string
+	}{
+		{"empty token", "", ""},
+		{"unknown token", strings.Repeat("0", len(token)), ""},
+		{"truncated token", token[:len(token)-1], ""},
+		{"no session", token, ""},
+		{"another user", token, mallory},
+	}
+	for i, tt := range tests {
+		if rep := send(t, srv, intruder, rebindReq(uint64(10+i), tt.token, tt.session)); rep.Status == common.StatusOK {
+			t.Errorf("%s: rebind accepted: %s", tt.name, rep.Data)
+		}
+	}
+
+	send(t, srv, newFakePeer("client"), addParticipant(20, "Ada"))
+	if n := len(owner.callbacks()); n != 1 {
+		t.Errorf("owner got %d callbacks, want 1", n)
+	}
+	if n := len(intruder.callbacks()); n != 0 {
+		t.Errorf("intruder got %d callbacks", n)
+	}
+}
@@ -0,0 +1,146 @@
+// server/redis_history.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// RedisHistory shares the dedup cache between server instances through Redis.
+// Keys are "history:<clientAddr>:<requestID>" and values are marshaled replies.
+// Any Redis failure is logged and treated as a cache miss (Get) or a skipped
+// write (Put), so packet handling carries on without deduplication.
+type RedisHistory struct {
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisHistory returns a cache backed by the Redis server at addr.
+// The connection is established lazily and re-dialed after errors.
+func NewRedisHistory(addr string) *RedisHistory {
+	return &RedisHistory{addr: addr, timeout: 500 * time.Millisecond}
+}
+
+func redisHistoryKey(key RequestKey) string {
+	return fmt.Sprintf("history:%s:%d", key.Addr, key.RequestID)
+}
+
+func (r *RedisHistory) Get(key RequestKey) (common.ReplyMessage, bool) {
+	val, err := r.do("GET", redisHistoryKey(key))
+	if err != nil {
+		log.Printf("Redis GET failed, processing request without dedup: %v", err)
+		return common.ReplyMessage{}, false
+	}
+	raw, ok := val.([]byte)
+	if !ok {
+		return common.ReplyMessage{}, false
+	}
+	reply, err := common.UnmarshalReply(raw)
+	if err != nil {
+		log.Printf("Redis holds a corrupt history entry for %v: %v", key, err)
+		return common.ReplyMessage{}, false
+	}
+	return reply, true
+}
+
+func (r *RedisHistory) Put(key RequestKey, reply common.ReplyMessage, ttl time.Duration) {
+	raw, err := common.MarshalReply(reply)
+	if err != nil {
+		log.Printf("Cannot marshal reply for Redis history: %v", err)
+		return
+	}
+	args := []string{"SET", redisHistoryKey(key), string(raw)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := r.do(args...); err != nil {
+		log.Printf("Redis SET failed, reply not cached: %v", err)
+	}
+}
+
+// do sends one command and reads its reply. Bulk strings come back as
+// []byte, a nil bulk as nil, and simple strings/integers as string/int64.
+func (r *RedisHistory) do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		conn, err := net.DialTimeout("tcp", r.addr, r.timeout)
+		if err != nil {
+			return nil, err
+		}
+		r.conn = conn
+		r.rd = bufio.NewReader(conn)
+	}
+
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	val, err := r.roundTrip(args)
+	if err != nil {
+		// Drop the connection so the next command re-dials.
+		r.conn.Close()
+		r.conn = nil
+		return nil, err
+	}
+	return val, nil
+}
+
+func (r *RedisHistory) roundTrip(args []string) (interface{}, error) {
+	cmd := make([]byte, 0, 64)
+	cmd = append(cmd, fmt.Sprintf("*%d\r\n", len(args))...)
+	for _, a := range args {
+		cmd = append(cmd, fmt.Sprintf("$%d\r\n", len(a))...)
+		cmd = append(cmd, a...)
+		cmd = append(cmd, "\r\n"...)
+	}
+	if _, err := r.conn.Write(cmd); err != nil {
+		return nil, err
+	}
+	return readRESP(r.rd)
+}
+
+// readRESP parses a single (non-array) RESP value.
+func readRESP(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("short RESP line %q", line)
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, fmt.Errorf("redis error: %s", body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("unsupported RESP type %q", line[0])
+	}
+}
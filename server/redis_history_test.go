@@ -0,0 +1,109 @@
+// server/redis_history_test.go
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisHistory) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return mr, NewRedisHistory(mr.Addr())
+}
+
+func TestRedisHistoryHitAndMiss(t *testing.T) {
+	_, h := newTestRedis(t)
+	key := RequestKey{Addr: "10.0.0.1:5000", RequestID: 7}
+	want := common.ReplyMessage{RequestID: 7, OpCode: common.OpBookFacility, Data: "Booked. ID=BKG-1"}
+
+	if _, ok := h.Get(key); ok {
+		t.Fatal("Get before Put hit")
+	}
+	h.Put(key, want, 0)
+	got, ok := h.Get(key)
+	if !ok {
+		t.Fatal("Get after Put missed")
+	}
+	if got.RequestID != want.RequestID || got.OpCode != want.OpCode || got.Data != want.Data {
+		t.Errorf("Get = %+v, want %+v", got, want)
+	}
+	if _, ok := h.Get(RequestKey{Addr: key.Addr, RequestID: 8}); ok {
+		t.Error("Get of another RequestID hit")
+	}
+	if _, ok := h.Get(RequestKey{Addr: "10.0.0.2:5000", RequestID: 7}); ok {
+		t.Error("Get of the same RequestID from another client hit")
+	}
+}
+
+func TestRedisHistoryTTL(t *testing.T) {
+	mr, h := newTestRedis(t)
+	key := RequestKey{Addr: "c", RequestID: 1}
+	h.Put(key, common.ReplyMessage{RequestID: 1, Data: "x"}, 2*time.Second)
+
+	if ttl := mr.TTL(redisHistoryKey(key)); ttl != 2*time.Second {
+		t.Errorf("TTL in Redis = %v, want 2s", ttl)
+	}
+	mr.FastForward(time.Second)
+	if _, ok := h.Get(key); !ok {
+		t.Fatal("entry expired before its TTL")
+	}
+	mr.FastForward(2 * time.Second)
+	if _, ok := h.Get(key); ok {
+		t.Fatal("entry outlived its TTL")
+	}
+}
+
+func TestRedisHistoryDownFallsBackToMiss(t *testing.T) {
+	mr, h := newTestRedis(t)
+	key := RequestKey{Addr: "c", RequestID: 1}
+	h.Put(key, common.ReplyMessage{RequestID: 1, Data: "x"}, 0)
+
+	mr.Close()
+	if _, ok := h.Get(key); ok {
+		t.Fatal("Get hit while Redis is down")
+	}
+	h.Put(RequestKey{Addr: "c", RequestID: 2}, common.ReplyMessage{RequestID: 2}, 0) // must not block or panic
+
+	// The next command after Redis comes back re-dials
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("restarting miniredis: %v", err)
+	}
+	if _, ok := h.Get(key); !ok {
+		t.Fatal("Get missed after Redis came back")
+	}
+}
+
+// TestRedisHistorySharedBetweenServers retries an AddParticipant at a
+// second server: it is answered from the first server's reply, not run.
+func TestRedisHistorySharedBetweenServers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newServer := func() *ServerState {
+		srv, err := NewServerState(SemanticsAtMostOnce, NewMemoryStore(), NewRedisHistory(mr.Addr()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return srv
+	}
+	a, b := newServer(), newServer()
+	p := newFakePeer("10.0.0.1:5000")
+
+	add := common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 42, ConfirmationID: "BKG-10000", ParticipantName: "Ada"}
+	first := send(t, a, p, add)
+	if first.Status != common.StatusOK {
+		t.Fatalf("AddParticipant: status %d: %s", first.Status, first.Data)
+	}
+	retry := send(t, b, p, add)
+	if retry.Data != first.Data {
+		t.Errorf("retry at the second server = %q, want the cached %q", retry.Data, first.Data)
+	}
+	for _, bk := range b.facilityData[common.DefaultNamespace]["RoomA"].Bookings {
+		if bk.ConfirmationID == "BKG-10000" && len(bk.Participants) != 0 {
+			t.Errorf("second server ran the retry: participants %v", bk.Participants)
+		}
+	}
+}
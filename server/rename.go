@@ -0,0 +1,173 @@
+// server/rename.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// EventFacilityRenamed is reported to webhooks and subscribers when the
+// admin renames a facility.
+const EventFacilityRenamed = "facility_renamed"
+
+// defaultRenameGrace is how long requests using a facility's old name are
+// told its new one by default.
+const defaultRenameGrace = 24 * time.Hour
+
+// facilityRename is where an old facility name went, and when.
+type facilityRename struct {
+	NewName string
+	At      time.Time
+}
+
+// handleRenameFacility gives a facility a new name. The facility map, the
+// store, the change journal, the idempotency keys and the monitor
+// subscriptions all move to the new name under dataLock, so no request sees
+// the facility under both names or under neither. Bookings keep their
+// confirmation IDs, and subscribers keep their sequence numbers and get a
+// renamed callback.
+func (s *ServerState) handleRenameFacility(req common.RequestMessage, t *opTiming) (string, int32) {
+	oldName, newName := req.FacilityName, req.NewFacilityName
+	log.Printf("Handling RenameFacility of '%s' to '%s'", oldName, newName)
+	if err := validate.ValidateFacilityName(newName); err != nil {
+		t.reject("NewFacilityName", newName)
+		return fmt.Sprintf("Error: %v", err), common.StatusInvalidArgument
+	}
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	ns := req.Namespace
+	facilities := s.facilityData[ns]
+	fac, ok := facilities[oldName]
+	if !ok {
+		t.reject("FacilityName", oldName)
+		return s.facilityNotFound(ns, oldName), -1
+	}
+	if newName == oldName {
+		t.reject("NewFacilityName", newName)
+		return fmt.Sprintf("Facility '%s' already has that name", oldName), common.StatusInvalidArgument
+	}
+	// A change of case only is a rename; any other facility with the name
+	// in some case has it already
+	taken := facilities[newName]
+	if display, ok := s.facilityNames.resolve(ns, newName); ok && display != oldName {
+		taken = facilities[display]
+	}
+	if taken != nil {
+		t.reject("NewFacilityName", newName)
+		return fmt.Sprintf("A facility named '%s' already exists", newName), common.StatusConflict
+	}
+
+	if err := s.store.RenameFacility(qualify(ns, oldName), qualify(ns, newName)); err != nil {
+		log.Printf("Failed to persist rename of '%s': %v", oldName, err)
+		return "Error: could not save the new name.", -1
+	}
+	delete(facilities, oldName)
+	fac.Name = newName
+	facilities[newName] = fac
+	s.facilityNames.rename(ns, oldName, newName)
+	s.idempotency.renameFacility(qualify(ns, oldName), qualify(ns, newName))
+	s.changes.renameFacility(qualify(ns, oldName), qualify(ns, newName))
+
+	// Earlier names of the facility now point at the new one, and the new
+	// name is no longer a former name of anything
+	now := s.now()
+	for name, r := range s.renamed {
+		owner, _ := splitQualified(name)
+		switch {
+		case now.Sub(r.At) > s.renameGrace:
+			delete(s.renamed, name)
+		case owner == ns && r.NewName == oldName:
+			r.NewName = newName
+			s.renamed[name] = r
+		}
+	}
+	delete(s.renamed, qualify(ns, validate.FacilityKey(newName)))
+	if validate.FacilityKey(oldName) != validate.FacilityKey(newName) {
+		s.renamed[qualify(ns, validate.FacilityKey(oldName))] = facilityRename{NewName: newName, At: now}
+	}
+
+	msg := fmt.Sprintf("Facility %s renamed to %s", oldName, newName)
+	s.notifyRenamed(ns, oldName, newName, msg)
+	log.Printf("RenameFacility successful: %s", msg)
+	return fmt.Sprintf("Renamed '%s' to '%s'. Its %d bookings keep their IDs.", oldName, newName, len(fac.Bookings)), 0
+}
+
+// notifyRenamed moves the subscriptions of a renamed facility to its new
+// name and tells each subscriber, whatever days and events it watches: the
+// callback names the facility under which it will hear from it from now
+// on. Buffered callbacks are renamed too, so a resend after the rename
+// continues the same sequence. The rename is journaled and sent to
+// webhooks like other mutations. The caller holds dataLock.
+func (s *ServerState) notifyRenamed(ns, oldName, newName, msg string) {
+	s.changes.record(qualify(ns, newName), EventFacilityRenamed, "", msg)
+	s.webhooks.Notify(WebhookEvent{
+		Namespace: namespaceLabel(ns),
+		Facility:  newName,
+		EventType: EventFacilityRenamed,
+		Message:   msg,
+		Timestamp: s.now(),
+	})
+
+	s.monitorLock.Lock()
+	defer s.monitorLock.Unlock()
+	now := s.now()
+	for i := range s.monitorSubs {
+		sub := &s.monitorSubs[i]
+		if sub.Namespace != ns || sub.FacilityName != oldName {
+			continue
+		}
+		sub.FacilityName = newName
+		for j := range sub.Recent {
+			sub.Recent[j].Extensions.PutString(common.ExtCallbackFacility, newName)
+		}
+		if !now.Before(sub.ExpiresAt) {
+			continue
+		}
+		cb := s.nextCallback(sub, common.EventRenamed, fmt.Sprintf("Facility=%s updated: %s", newName, msg), "")
+		cb.Extensions.PutString(common.ExtRenamedFrom, oldName)
+		if n := len(sub.Recent); n > 0 {
+			sub.Recent[n-1] = cb // resend it with the old name as well
+		}
+		if raw, err := s.encodeReply(cb); err == nil && s.sendCallback(sub, raw) {
+			log.Printf("Sent rename callback to %s for facility '%s'", sub.ClientAddr, newName)
+		}
+	}
+}
+
+// renamedFacility returns what a facility name of namespace ns that no
+// longer exists, in any case, was renamed to within the grace period.
+func (s *ServerState) renamedFacility(ns, name string, t *opTiming) (string, bool) {
+	t.rlock(&s.dataLock)
+	defer s.dataLock.RUnlock()
+	if _, exists := s.facilityNames.resolve(ns, name); exists {
+		return "", false
+	}
+	r, ok := s.renamed[qualify(ns, validate.FacilityKey(name))]
+	if !ok || s.now().Sub(r.At) > s.renameGrace {
+		return "", false
+	}
+	return r.NewName, true
+}
+
+// renamedReply refuses a request that names a facility by a name it had
+// before a recent rename, and says the new one. ok is false if the request
+// uses no such name.
+func (s *ServerState) renamedReply(req common.RequestMessage, t *opTiming) (string, bool) {
+	names := append([]string{req.FacilityName}, req.MoreFacilities...)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if newName, ok := s.renamedFacility(req.Namespace, name, t); ok {
+			t.reject("FacilityName", name)
+			return fmt.Sprintf("Facility '%s' not found; it has been renamed to '%s'", name, newName), true
+		}
+	}
+	return "", false
+}
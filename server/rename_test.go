@@ -0,0 +1,184 @@
+// server/rename_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func renameReq(id uint64, from, to string) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpRenameFacility, RequestID: id, FacilityName: from, NewFacilityName: to}
+}
+
+// TestRenameFacility: after the rename the facility answers to its new
+// name only, its bookings keep their IDs, and the old name is refused
+// with the new one.
+func TestRenameFacility(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	p := newFakePeer("client")
+	before := queryData(t, srv, 1, []uint8{0, 1}, "RoomA")
+
+	const newName = "Meeting Room 3.01"
+	rep := admin(renameReq(2, "RoomA", newName))
+	if want := "Renamed 'RoomA' to 'Meeting Room 3.01'. Its 2 bookings keep their IDs."; rep.Status != common.StatusOK || rep.Data != want {
+		t.Fatalf("status %d: %q, want %q", rep.Status, rep.Data, want)
+	}
+	after := queryData(t, srv, 3, []uint8{0, 1}, newName)
+	if strings.Replace(before, "RoomA", newName, 1) != after {
+		t.Errorf("renamed facility answers\n%s\nbefore\n%s", after, before)
+	}
+	if fac := srv.facilityData[common.DefaultNamespace][newName]; fac == nil || fac.Name != newName {
+		t.Errorf("facility map holds %+v under the new name", fac)
+	}
+
+	for i, old := range []string{"RoomA", "rooma"} {
+		rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: uint64(4 + i), FacilityName: old})
+		want := "Facility '" + old + "' not found; it has been renamed to 'Meeting Room 3.01'"
+		if rep.Status != -1 || rep.Data != want {
+			t.Errorf("query of %s: status %d: %q, want %q", old, rep.Status, rep.Data, want)
+		}
+	}
+	if rep := send(t, srv, p, bookReq(6, "RoomA", 4, 9, 10)); !strings.Contains(rep.Data, "renamed to") {
+		t.Errorf("booking under the old name: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// Lookups by confirmation ID are unaffected
+	rep = send(t, srv, p, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 7, ConfirmationID: "BKG-10000", OffsetMinutes: 60})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("change after the rename: status %d: %s", rep.Status, rep.Data)
+	}
+	if got := facilityBookings(srv, newName); len(got) != 2 {
+		t.Errorf("new name holds %q", got)
+	}
+	confirmationID(t, send(t, srv, p, bookReq(8, "meeting room 3.01", 4, 9, 10)))
+}
+
+// TestRenameCallbacks: a subscriber hears of the rename in its sequence,
+// with the old name, and then of changes under the new name.
+func TestRenameCallbacks(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	watcher := newFakePeer("watcher")
+	if rep := send(t, srv, watcher, monitorReq(1, []uint8{4}, common.EventCreated)); rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+	p := newFakePeer("client")
+	confirmationID(t, send(t, srv, p, bookReq(2, "RoomA", 4, 9, 10)))
+	if rep := admin(renameReq(3, "RoomA", "Hall")); rep.Status != common.StatusOK {
+		t.Fatalf("rename: status %d: %s", rep.Status, rep.Data)
+	}
+	confirmationID(t, send(t, srv, p, bookReq(4, "Hall", 4, 11, 12)))
+
+	cbs := watcher.callbacks()
+	if got := events(t, watcher); len(got) != 3 || got[1] != common.EventRenamed {
+		t.Fatalf("events %v, want created, renamed, created", got)
+	}
+	for i, want := range []string{"RoomA", "Hall", "Hall"} {
+		seq, facility, ok := common.CallbackSeq(cbs[i])
+		if !ok || seq != uint64(i+1) || facility != want {
+			t.Errorf("callback %d: seq %d facility %q, want %d %q", i+1, seq, facility, i+1, want)
+		}
+	}
+	if from, _ := cbs[1].Extensions.String(common.ExtRenamedFrom); from != "RoomA" {
+		t.Errorf("rename callback names the old facility %q", from)
+	}
+	if !strings.Contains(cbs[1].Data, "Facility RoomA renamed to Hall") {
+		t.Errorf("rename callback %q", cbs[1].Data)
+	}
+}
+
+func TestRenameRefused(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	admin := adminSender(t, srv)
+	tests := []struct {
+		name     string
+		from, to string
+		status   int32
+	}{
+		{"unknown facility", "Gym", "Hall", -1},
+		{"same name", "RoomA", "RoomA", common.StatusInvalidArgument},
+		{"taken name", "RoomA", "Lab1", common.StatusConflict},
+		{"taken in another case", "RoomA", "LAB1", common.StatusConflict},
+		{"empty name", "RoomA", "", common.StatusInvalidArgument},
+	}
+	for i, tt := range tests {
+		if rep := admin(renameReq(uint64(10+i), tt.from, tt.to)); rep.Status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rep.Status, tt.status, rep.Data)
+		}
+	}
+	rep := send(t, srv, newFakePeer("client"), renameReq(20, "RoomA", "Hall"))
+	if rep.Status != common.StatusPermissionDenied {
+		t.Errorf("rename without an admin session: status %d: %s", rep.Status, rep.Data)
+	}
+	if got := facilityBookings(srv, "RoomA"); len(got) != 2 {
+		t.Errorf("refused renames left RoomA with %q", got)
+	}
+
+	// A change of case only is a rename
+	if rep := admin(renameReq(21, "RoomA", "ROOMA")); rep.Status != common.StatusOK {
+		t.Errorf("rename to ROOMA: status %d: %s", rep.Status, rep.Data)
+	}
+}
+
+// TestRenameGrace: the old name points at the new one for -renameGrace,
+// follows later renames, and is free to be taken again.
+func TestRenameGrace(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.renameGrace = time.Hour
+	admin := adminSender(t, srv)
+	p := newFakePeer("client")
+	queryOld := func(id uint64) string {
+		return send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: id, FacilityName: "RoomA"}).Data
+	}
+
+	admin(renameReq(1, "RoomA", "Hall"))
+	admin(renameReq(2, "Hall", "Atrium"))
+	if got := queryOld(3); !strings.Contains(got, "renamed to 'Atrium'") {
+		t.Errorf("old name after two renames: %q", got)
+	}
+
+	srv.clockOffset = 2 * time.Hour
+	if got := queryOld(4); got != "Error: Facility 'RoomA' not found" {
+		t.Errorf("old name after the grace period: %q", got)
+	}
+
+	srv.clockOffset = 0
+	if rep := admin(renameReq(5, "Lab1", "RoomA")); rep.Status != common.StatusOK {
+		t.Fatalf("taking the old name: status %d: %s", rep.Status, rep.Data)
+	}
+	if got := queryOld(6); !strings.Contains(got, "BKG-20000") {
+		t.Errorf("old name taken by Lab1 answers %q", got)
+	}
+}
+
+// TestRenameOnEachStore: the bookings follow the facility in the store,
+// and a persistent store reloads them under the new name.
+func TestRenameOnEachStore(t *testing.T) {
+	for _, b := range storeBackends {
+		t.Run(b.name, func(t *testing.T) {
+			dir := t.TempDir()
+			st := openStore(t, b, dir)
+			srv := newStoreServer(t, st)
+			if rep := adminSender(t, srv)(renameReq(1, "Lab1", "Lab 2")); rep.Status != common.StatusOK {
+				t.Fatalf("rename: status %d: %s", rep.Status, rep.Data)
+			}
+			id := confirmationID(t, send(t, srv, newFakePeer("client"), bookReq(2, "Lab 2", 4, 9, 10)))
+			if !b.persists {
+				return
+			}
+			st.Close()
+
+			srv = newStoreServer(t, openStore(t, b, dir))
+			if _, ok := srv.facilityData[common.DefaultNamespace]["Lab1"]; ok {
+				t.Error("old name came back after the restart")
+			}
+			if got := strings.Join(facilityBookings(srv, "Lab 2"), ","); !strings.Contains(got, "BKG-20000") || !strings.Contains(got, id) {
+				t.Errorf("Lab 2 reloaded with %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,596 @@
+// server/replication.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Server roles
+const (
+	RolePrimary = "primary"
+	RoleBackup  = "backup"
+)
+
+// Replication frame kinds. A frame has the header of a request packet,
+// Magic(2) + kind(1) + seq(8) + flags(1), so that -authKey and -encrypt
+// protect it exactly as they protect client traffic. The primary's
+// incarnation, epoch(8), follows, then the body. A restarted primary
+// numbers its frames from 1 again, and the epoch is how the backup tells
+// them from the ones it has already applied.
+const (
+	replApply       = 1 // primary -> backup: body = confID string + pendingUntil(8) + user string + marshaled request; strings are length(2) + bytes
+	replAck         = 2 // backup -> primary: seq = highest applied sequence
+	replSyncRequest = 3 // backup -> primary: ask for a full state transfer
+	replSyncChunk   = 4 // primary -> backup: seq = snapshot sequence, body = index(4) + count(4) + part of the JSON replSnapshot
+	replChunkAck    = 5 // backup -> primary: seq = snapshot sequence, body = index(4) of a chunk received
+)
+
+// replHeaderSize is the length of a frame header, epoch included.
+const replHeaderSize = common.MagicSize + 18
+
+const replResendInterval = 500 * time.Millisecond
+
+// replChunkSize is how much of a state transfer one frame carries, well
+// inside a datagram whatever the size of the state.
+const replChunkSize = 8 << 10
+
+// maxReplChunks bounds the chunk count a backup accepts for one transfer,
+// which caps the state at 512 MB.
+const maxReplChunks = 1 << 16
+
+// stateTransfer is a snapshot being sent to the backup in chunks, each
+// resent until the backup acknowledges it.
+type stateTransfer struct {
+	seq       uint64
+	frames    [][]byte
+	acked     []bool
+	remaining int
+}
+
+// replSnapshot is the state a backup receives in a state transfer: the
+// facilities, and the former names that still point at renamed ones.
+type replSnapshot struct {
+	Facilities map[string]map[string]*FacilityInfo
+	Renamed    map[string]facilityRename
+}
+
+// snapshotAssembly collects the chunks of a state transfer on the backup.
+type snapshotAssembly struct {
+	epoch uint64
+	seq   uint64
+	parts [][]byte
+	have  int
+}
+
+// Replicator keeps a backup's booking state in step with the primary.
+// The primary sends each successful mutation as a numbered frame and resends
+// until the backup acknowledges it; the backup applies frames strictly in
+// sequence order, so lost or reordered datagrams only delay convergence.
+type Replicator struct {
+	srv  *ServerState
+	conn *net.UDPConn // replication socket
+	peer *net.UDPAddr // backup address (on the primary) or primary address (on the backup)
+
+	// applyLock serialises mutations with sequence assignment and snapshots
+	// on the primary so that the backup replays them in the same order.
+	applyLock sync.Mutex
+
+	mu          sync.Mutex
+	epoch       uint64            // primary: this incarnation; backup: the incarnation its state came from
+	nextSeq     uint64            // primary: last assigned sequence
+	pending     map[uint64][]byte // primary: frames not yet acknowledged
+	transfer    *stateTransfer    // primary: state transfer in progress, if any
+	lastApplied uint64            // backup: highest sequence applied
+	synced      bool              // backup: initial state transfer done
+	incoming    *snapshotAssembly // backup: state transfer being received
+	lastChunk   time.Time         // backup: when the last chunk arrived
+
+	done chan struct{} // closed by Close
+}
+
+// NewReplicator binds the replication socket on listenAddr.
+func NewReplicator(srv *ServerState, listenAddr, peerAddr string) (*Replicator, error) {
+	laddr, err := net.ResolveUDPAddr("udp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("bad replication listen address %s: %w", listenAddr, err)
+	}
+	peer, err := net.ResolveUDPAddr("udp", peerAddr)
+	if err != nil {
+		return nil, fmt.Errorf("bad replication peer address %s: %w", peerAddr, err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for replication on %s: %w", listenAddr, err)
+	}
+	return &Replicator{
+		srv:     srv,
+		conn:    conn,
+		peer:    peer,
+		epoch:   newEpoch(),
+		pending: make(map[uint64][]byte),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// newEpoch picks the incarnation ID a primary stamps on its frames. It is
+// random so that a restarted primary never reuses one.
+func newEpoch() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("reading random bytes for a replication epoch: %v", err))
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// Close stops the replicator; RunPrimary or RunBackup returns.
+func (r *Replicator) Close() error {
+	close(r.done)
+	return r.conn.Close()
+}
+
+// RunPrimary serves acks and sync requests and resends unacknowledged
+// frames and state transfer chunks.
+func (r *Replicator) RunPrimary() {
+	go func() {
+		ticker := time.NewTicker(replResendInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.resendPending()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	r.readLoop(r.handlePrimaryFrame)
+}
+
+// RunBackup requests a state transfer until one arrives, then applies
+// frames. It asks again only when no chunk has arrived for a second, so a
+// large transfer in progress is not restarted, and asks anew whenever a
+// restarted primary makes the state stale.
+func (r *Replicator) RunBackup() {
+	go func() {
+		for {
+			r.mu.Lock()
+			request := !r.synced && time.Since(r.lastChunk) > time.Second
+			r.mu.Unlock()
+			if request {
+				log.Printf("Requesting state transfer from primary %s", r.peer)
+				r.send(r.peer, r.encodeFrame(replSyncRequest, 0, 0, nil))
+			}
+			select {
+			case <-time.After(time.Second):
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	r.readLoop(r.handleBackupFrame)
+}
+
+func (r *Replicator) readLoop(handle func(kind uint8, epoch, seq uint64, body []byte, from *net.UDPAddr)) {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("Replication read error: %v", err)
+			continue
+		}
+		// Only the configured peer may replicate; anyone else could read
+		// the state or forge bookings
+		if !sameUDPAddr(from, r.peer) {
+			log.Printf("Dropping replication frame from %s: not the peer %s", from, r.peer)
+			continue
+		}
+		kind, epoch, seq, body, err := r.decodeFrame(buf[:n])
+		if err != nil {
+			log.Printf("Dropping replication frame from %s: %v", from, err)
+			continue
+		}
+		handle(kind, epoch, seq, body, from)
+	}
+}
+
+// sameUDPAddr reports whether two UDP addresses name the same endpoint.
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// createsBookingFrom reports whether an operation makes a new booking out
+// of the one its ConfirmationID names, whose ID goes in NewID.
+func createsBookingFrom(op uint8) bool {
+	return op == common.OpSplitBooking || op == common.OpCopyBooking
+}
+
+// processAndReplicate runs a mutating request on the primary and, if it
+// succeeded, queues it for the backup.
+func (r *Replicator) processAndReplicate(req common.RequestMessage, clientAddr Peer) common.ReplyMessage {
+	r.applyLock.Lock()
+	defer r.applyLock.Unlock()
+
+	// Assign the booking ID up front so the backup can reuse it.
+	if req.OpCode == common.OpBookFacility && req.ConfirmationID == "" {
+		req.ConfirmationID = r.srv.newID()
+	}
+	if createsBookingFrom(req.OpCode) && req.NewID == "" {
+		req.NewID = r.srv.newID()
+	}
+	// Likewise fix when a hold for approval ends, so a backup that takes
+	// over expires the booking when the primary would have
+	if req.OpCode == common.OpBookFacility || req.OpCode == common.OpCopyBooking {
+		req.PendingUntil = r.srv.now().Add(r.srv.approvalTTL)
+	}
+
+	reply := r.srv.processOperation(req, clientAddr)
+	if reply.Status != common.StatusOK {
+		return reply
+	}
+
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		log.Printf("Cannot replicate RequestID %d: %v", req.RequestID, err)
+		return reply
+	}
+	// The assigned ID, the hold and the session user are not on the wire,
+	// so they travel ahead of the request
+	assigned := req.ConfirmationID
+	if createsBookingFrom(req.OpCode) {
+		assigned = req.NewID
+	}
+	var until int64
+	if !req.PendingUntil.IsZero() {
+		until = req.PendingUntil.UnixMilli()
+	}
+	body := make([]byte, 0, 2+len(assigned)+8+2+len(req.User)+len(raw))
+	body = appendReplString(body, assigned)
+	body = binary.BigEndian.AppendUint64(body, uint64(until))
+	body = appendReplString(body, req.User)
+	body = append(body, raw...)
+
+	r.mu.Lock()
+	r.nextSeq++
+	seq := r.nextSeq
+	frame := r.encodeFrame(replApply, r.epoch, seq, body)
+	r.pending[seq] = frame
+	r.mu.Unlock()
+
+	log.Printf("Replicating RequestID %d to backup as seq %d", req.RequestID, seq)
+	r.send(r.peer, frame)
+	return reply
+}
+
+func (r *Replicator) resendPending() {
+	r.mu.Lock()
+	seqs := make([]uint64, 0, len(r.pending))
+	for seq := range r.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	frames := make([][]byte, 0, len(seqs))
+	for _, seq := range seqs {
+		frames = append(frames, r.pending[seq])
+	}
+	if t := r.transfer; t != nil {
+		for i, f := range t.frames {
+			if !t.acked[i] {
+				frames = append(frames, f)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for _, f := range frames {
+		r.send(r.peer, f)
+	}
+}
+
+func (r *Replicator) handlePrimaryFrame(kind uint8, epoch, seq uint64, body []byte, from *net.UDPAddr) {
+	// An ack meant for an earlier incarnation names sequence numbers this
+	// one has reused
+	if (kind == replAck || kind == replChunkAck) && epoch != r.epoch {
+		return
+	}
+	switch kind {
+	case replAck:
+		r.mu.Lock()
+		for s := range r.pending {
+			if s <= seq {
+				delete(r.pending, s)
+			}
+		}
+		r.mu.Unlock()
+
+	case replSyncRequest:
+		// Take the snapshot between mutations so it matches its sequence number.
+		r.applyLock.Lock()
+		r.srv.dataLock.RLock()
+		snapshot, err := json.Marshal(replSnapshot{Facilities: r.srv.facilityData, Renamed: r.srv.renamed})
+		r.srv.dataLock.RUnlock()
+		r.mu.Lock()
+		snapSeq := r.nextSeq
+		r.mu.Unlock()
+		r.applyLock.Unlock()
+
+		if err != nil {
+			log.Printf("Cannot encode state for backup: %v", err)
+			return
+		}
+		t := r.newTransfer(snapSeq, snapshot)
+		log.Printf("Sending state transfer (seq %d, %d bytes in %d chunks) to %s", snapSeq, len(snapshot), len(t.frames), from)
+		r.mu.Lock()
+		r.transfer = t
+		r.mu.Unlock()
+		for _, f := range t.frames {
+			r.send(from, f)
+		}
+
+	case replChunkAck:
+		if len(body) < 4 {
+			return
+		}
+		index := int(binary.BigEndian.Uint32(body))
+		r.mu.Lock()
+		if t := r.transfer; t != nil && t.seq == seq && index < len(t.acked) && !t.acked[index] {
+			t.acked[index] = true
+			if t.remaining--; t.remaining == 0 {
+				log.Printf("State transfer at seq %d fully acknowledged", seq)
+				r.transfer = nil
+			}
+		}
+		r.mu.Unlock()
+
+	default:
+		log.Printf("Primary ignoring replication frame kind %d from %s", kind, from)
+	}
+}
+
+func (r *Replicator) handleBackupFrame(kind uint8, epoch, seq uint64, body []byte, from *net.UDPAddr) {
+	switch kind {
+	case replSyncChunk:
+		r.receiveChunk(epoch, seq, body, from)
+
+	case replApply:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.followEpoch(epoch)
+		if !r.synced {
+			return // the primary resends once we have a baseline
+		}
+		if seq == r.lastApplied+1 {
+			if err := r.applyFrame(body); err != nil {
+				log.Printf("Cannot apply replication seq %d: %v", seq, err)
+				return
+			}
+			r.lastApplied = seq
+		}
+		// Cumulative ack: also covers duplicates and tells the primary
+		// where we are after a gap.
+		r.send(from, r.encodeFrame(replAck, r.epoch, r.lastApplied, nil))
+
+	default:
+		log.Printf("Backup ignoring replication frame kind %d from %s", kind, from)
+	}
+}
+
+// followEpoch drops the backup's state if a frame comes from another
+// incarnation of the primary than the one the state came from. The
+// restarted primary numbers its frames from 1 again, so they would pass
+// for frames already applied; RunBackup requests a fresh state transfer
+// instead. The caller holds r.mu.
+func (r *Replicator) followEpoch(epoch uint64) {
+	if !r.synced || epoch == r.epoch {
+		return
+	}
+	log.Printf("Primary restarted (epoch %x, was %x); requesting its state", epoch, r.epoch)
+	r.synced = false
+	r.incoming = nil
+	r.lastChunk = time.Time{}
+}
+
+func (r *Replicator) applyFrame(body []byte) error {
+	confID, body, ok := cutReplString(body)
+	if !ok || len(body) < 8 {
+		return fmt.Errorf("apply frame truncated")
+	}
+	until := int64(binary.BigEndian.Uint64(body))
+	user, body, ok := cutReplString(body[8:])
+	if !ok {
+		return fmt.Errorf("apply frame truncated")
+	}
+	req, err := common.UnmarshalRequest(body)
+	if err != nil {
+		return err
+	}
+	if until != 0 {
+		req.PendingUntil = time.UnixMilli(until)
+	}
+	req.User = user
+	switch {
+	case req.OpCode == common.OpBookFacility:
+		req.ConfirmationID = confID
+	case createsBookingFrom(req.OpCode):
+		req.NewID = confID
+	}
+	// The primary already checked the request against its own clock
+	req.Force = true
+	reply := r.srv.processOperation(req, nil)
+	if reply.Status != common.StatusOK {
+		log.Printf("Replicated RequestID %d did not apply cleanly: %s", req.RequestID, reply.Data)
+	}
+	return nil
+}
+
+// appendReplString appends s to an apply frame body, length first.
+func appendReplString(body []byte, s string) []byte {
+	body = binary.BigEndian.AppendUint16(body, uint16(len(s)))
+	return append(body, s...)
+}
+
+// cutReplString takes a string written by appendReplString off the front
+// of body.
+func cutReplString(body []byte) (string, []byte, bool) {
+	if len(body) < 2 {
+		return "", nil, false
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if 2+n > len(body) {
+		return "", nil, false
+	}
+	return string(body[2 : 2+n]), body[2+n:], true
+}
+
+func (r *Replicator) send(to *net.UDPAddr, frame []byte) {
+	if frame == nil {
+		return
+	}
+	if _, err := r.conn.WriteToUDP(frame, to); err != nil {
+		log.Printf("Replication send to %s failed: %v", to, err)
+	}
+}
+
+// newTransfer splits a snapshot into numbered chunk frames.
+func (r *Replicator) newTransfer(seq uint64, snapshot []byte) *stateTransfer {
+	count := (len(snapshot) + replChunkSize - 1) / replChunkSize
+	if count == 0 {
+		count = 1
+	}
+	t := &stateTransfer{seq: seq, acked: make([]bool, count), remaining: count}
+	for i := 0; i < count; i++ {
+		part := snapshot[min(i*replChunkSize, len(snapshot)):min((i+1)*replChunkSize, len(snapshot))]
+		body := make([]byte, 8, 8+len(part))
+		binary.BigEndian.PutUint32(body, uint32(i))
+		binary.BigEndian.PutUint32(body[4:], uint32(count))
+		t.frames = append(t.frames, r.encodeFrame(replSyncChunk, r.epoch, seq, append(body, part...)))
+	}
+	return t
+}
+
+// receiveChunk acknowledges one chunk of a state transfer and, once all of
+// them are in, installs the state. Chunks of a newer transfer replace an
+// unfinished one; chunks arriving after the state is installed are only
+// acknowledged, so the primary stops resending them.
+func (r *Replicator) receiveChunk(epoch, seq uint64, body []byte, from *net.UDPAddr) {
+	if len(body) < 8 {
+		log.Printf("Dropping short state transfer chunk from %s", from)
+		return
+	}
+	index := binary.BigEndian.Uint32(body)
+	count := binary.BigEndian.Uint32(body[4:])
+	if count == 0 || count > maxReplChunks || index >= count {
+		log.Printf("Dropping state transfer chunk %d of %d from %s", index, count, from)
+		return
+	}
+	ack := make([]byte, 4)
+	binary.BigEndian.PutUint32(ack, index)
+
+	r.mu.Lock()
+	r.lastChunk = time.Now()
+	r.followEpoch(epoch)
+	if r.synced {
+		r.mu.Unlock()
+		r.send(from, r.encodeFrame(replChunkAck, epoch, seq, ack))
+		return
+	}
+	a := r.incoming
+	if a == nil || a.epoch != epoch || a.seq != seq || len(a.parts) != int(count) {
+		a = &snapshotAssembly{epoch: epoch, seq: seq, parts: make([][]byte, count)}
+		r.incoming = a
+	}
+	if a.parts[index] == nil {
+		a.parts[index] = append([]byte{}, body[8:]...)
+		a.have++
+	}
+	complete := a.have == len(a.parts)
+	r.mu.Unlock()
+	r.send(from, r.encodeFrame(replChunkAck, epoch, seq, ack))
+	if !complete {
+		return
+	}
+
+	var snapshot []byte
+	for _, part := range a.parts {
+		snapshot = append(snapshot, part...)
+	}
+	var state replSnapshot
+	if err := json.Unmarshal(snapshot, &state); err != nil {
+		log.Printf("Bad state transfer from %s: %v", from, err)
+		r.mu.Lock()
+		r.incoming = nil
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Lock()
+	if r.synced || r.incoming != a {
+		r.mu.Unlock()
+		return
+	}
+	if state.Renamed == nil {
+		state.Renamed = make(map[string]facilityRename)
+	}
+	// The name index and the former names describe the facilities, so they
+	// are replaced with them
+	r.srv.dataLock.Lock()
+	r.srv.facilityData = state.Facilities
+	r.srv.facilityNames.reset(state.Facilities)
+	r.srv.renamed = state.Renamed
+	r.srv.dataLock.Unlock()
+	r.epoch = epoch
+	r.lastApplied = seq
+	r.synced = true
+	r.incoming = nil
+	r.mu.Unlock()
+	log.Printf("State transfer complete at seq %d (%d namespaces, %d bytes)", seq, len(state.Facilities), len(snapshot))
+	r.send(from, r.encodeFrame(replAck, epoch, seq, nil))
+}
+
+// encodeFrame builds a frame of the primary incarnation epoch and seals it
+// with the server's -authKey and -encrypt settings. A frame that cannot be
+// sealed is logged and sent empty, which the peer drops.
+func (r *Replicator) encodeFrame(kind uint8, epoch, seq uint64, body []byte) []byte {
+	frame := make([]byte, replHeaderSize, replHeaderSize+len(body))
+	copy(frame, common.Magic[:])
+	frame[common.MagicSize] = kind
+	binary.BigEndian.PutUint64(frame[common.MagicSize+1:], seq)
+	binary.BigEndian.PutUint64(frame[common.MagicSize+10:], epoch)
+	frame = append(frame, body...)
+	sealed, err := r.srv.security.Seal(frame)
+	if err != nil {
+		log.Printf("Cannot seal replication frame kind %d: %v", kind, err)
+		return nil
+	}
+	return sealed
+}
+
+// decodeFrame verifies and opens a received frame.
+func (r *Replicator) decodeFrame(packet []byte) (kind uint8, epoch, seq uint64, body []byte, err error) {
+	if !common.HasMagic(packet) {
+		return 0, 0, 0, nil, common.ErrBadMagic
+	}
+	frame, err := r.srv.security.Open(packet)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	if len(frame) < replHeaderSize {
+		return 0, 0, 0, nil, fmt.Errorf("frame of %d bytes is too short", len(frame))
+	}
+	kind = frame[common.MagicSize]
+	seq = binary.BigEndian.Uint64(frame[common.MagicSize+1:])
+	epoch = binary.BigEndian.Uint64(frame[common.MagicSize+10:])
+	return kind, epoch, seq, frame[replHeaderSize:], nil
+}
@@ -0,0 +1,321 @@
+// server/replication_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// lossyLink relays replication datagrams between a primary and a backup,
+// dropping a share of them in each direction. Each replicator's peer is the
+// relay socket facing it, so frames still arrive from the expected peer.
+type lossyLink struct {
+	toPrimary *net.UDPConn // the primary's peer
+	toBackup  *net.UDPConn // the backup's peer
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	loss    float64
+	dropped int
+}
+
+func newLossyLink(t *testing.T, loss float64) *lossyLink {
+	t.Helper()
+	listen := func() *net.UDPConn {
+		c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	return &lossyLink{toPrimary: listen(), toBackup: listen(), rng: rand.New(rand.NewSource(1)), loss: loss}
+}
+
+// relay forwards what arrives on in to dst through out until in is closed.
+func (l *lossyLink) relay(in, out *net.UDPConn, dst *net.UDPAddr) {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := in.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		l.mu.Lock()
+		drop := l.rng.Float64() < l.loss
+		if drop {
+			l.dropped++
+		}
+		l.mu.Unlock()
+		if !drop {
+			out.WriteToUDP(buf[:n], dst)
+		}
+	}
+}
+
+// startReplicaPair connects a primary and a backup through a link losing
+// the given share of datagrams and starts both replicators. It returns the
+// link and the backup's replicator.
+func startReplicaPair(t *testing.T, primary, backup *ServerState, loss float64) (*lossyLink, *Replicator) {
+	t.Helper()
+	link := newLossyLink(t, loss)
+	rp, err := NewReplicator(primary, "127.0.0.1:0", link.toPrimary.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb, err := NewReplicator(backup, "127.0.0.1:0", link.toBackup.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rp.Close(); rb.Close() })
+	primary.replicator = rp
+	backup.role = RoleBackup
+
+	go link.relay(link.toPrimary, link.toBackup, rb.conn.LocalAddr().(*net.UDPAddr))
+	go link.relay(link.toBackup, link.toPrimary, rp.conn.LocalAddr().(*net.UDPAddr))
+	go rp.RunPrimary()
+	go rb.RunBackup()
+	return link, rb
+}
+
+// facilitiesJSON renders a server's bookings for comparison.
+func facilitiesJSON(t *testing.T, s *ServerState) []byte {
+	t.Helper()
+	s.dataLock.RLock()
+	defer s.dataLock.RUnlock()
+	raw, err := json.Marshal(s.facilityData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// waitConverged polls until the backup holds the primary's state.
+func waitConverged(t *testing.T, primary, backup *ServerState, within time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for {
+		want, got := facilitiesJSON(t, primary), facilitiesJSON(t, backup)
+		if bytes.Equal(want, got) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backup did not converge within %v:\nprimary %s\nbackup  %s", within, want, got)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// waitSynced polls until the backup has installed a state transfer.
+func waitSynced(t *testing.T, rb *Replicator, within time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for {
+		rb.mu.Lock()
+		synced := rb.synced
+		rb.mu.Unlock()
+		if synced {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backup did not sync within %v", within)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReplicationConvergesUnderLoss(t *testing.T) {
+	primary := newTestServer(t, SemanticsAtLeastOnce)
+	backup := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+
+	// Enough bookings before the backup syncs that the state transfer
+	// needs several chunks
+	var id uint64
+	for day := uint8(0); day < 5; day++ {
+		for hour := uint8(0); hour < 24; hour++ {
+			id++
+			send(t, primary, p, bookReq(id, "Lab1", day, hour, hour+1))
+		}
+	}
+	link, _ := startReplicaPair(t, primary, backup, 0.3)
+
+	// Mutations while frames are being lost
+	booked := confirmationID(t, send(t, primary, p, bookReq(1000, "RoomA", 4, 13, 14)))
+	send(t, primary, p, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 1001, ConfirmationID: booked, OffsetMinutes: 30})
+	send(t, primary, p, common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 1002, ConfirmationID: booked, ParticipantName: "Ada"})
+	send(t, primary, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 1003, ConfirmationID: "BKG-10001"})
+	split := confirmationID(t, send(t, primary, p, bookReq(1004, "Lab1", 5, 8, 12)))
+	send(t, primary, p, common.RequestMessage{OpCode: common.OpSplitBooking, RequestID: 1005, ConfirmationID: split,
+		StartDay: 5, StartHour: 9, EndDay: 5, EndHour: 10})
+
+	waitConverged(t, primary, backup, 20*time.Second)
+	link.mu.Lock()
+	dropped := link.dropped
+	link.mu.Unlock()
+	if dropped == 0 {
+		t.Error("the link dropped nothing, so loss was not exercised")
+	}
+}
+
+func TestBackupRefusesMutations(t *testing.T) {
+	primary := newTestServer(t, SemanticsAtLeastOnce)
+	backup := newTestServer(t, SemanticsAtLeastOnce)
+	startReplicaPair(t, primary, backup, 0)
+
+	rep := send(t, backup, newFakePeer("client"), bookReq(1, "RoomA", 4, 13, 14))
+	if rep.Status != common.StatusNotPrimary {
+		t.Errorf("booking at the backup: status %d, want %d", rep.Status, common.StatusNotPrimary)
+	}
+}
+
+func TestReplicationIgnoresStrangers(t *testing.T) {
+	primary := newTestServer(t, SemanticsAtLeastOnce)
+	backup := newTestServer(t, SemanticsAtLeastOnce)
+	link, rb := startReplicaPair(t, primary, backup, 0)
+	waitSynced(t, rb, 5*time.Second)
+
+	// A well-formed apply frame from a socket that is not the primary
+	req := bookReq(1, "RoomA", 4, 13, 14)
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := appendReplString(nil, "BKG-FORGED")
+	body = append(body, make([]byte, 8)...)
+	body = appendReplString(body, "")
+	body = append(body, raw...)
+	rb.mu.Lock()
+	frame := rb.encodeFrame(replApply, rb.epoch, 1, body)
+	rb.mu.Unlock()
+	stranger, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stranger.Close()
+	stranger.WriteToUDP(frame, rb.conn.LocalAddr().(*net.UDPAddr))
+
+	time.Sleep(200 * time.Millisecond)
+	backup.dataLock.RLock()
+	_, _, _, forged := backup.findBooking(common.DefaultNamespace, "BKG-FORGED")
+	backup.dataLock.RUnlock()
+	if forged {
+		t.Fatal("backup applied a frame from a stranger")
+	}
+
+	// The same frame from the primary's side of the link is applied
+	link.toBackup.WriteToUDP(frame, rb.conn.LocalAddr().(*net.UDPAddr))
+	deadline := time.Now().Add(2 * time.Second)
+	for !forged && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		backup.dataLock.RLock()
+		_, _, _, forged = backup.findBooking(common.DefaultNamespace, "BKG-FORGED")
+		backup.dataLock.RUnlock()
+	}
+	if !forged {
+		t.Fatal("backup did not apply the frame from its peer either; the test frame is broken")
+	}
+}
+
+// TestStateTransferNames renames a facility before the backup syncs. The
+// backup finds the facility under its new name in any case and tells
+// requests using the old name where it went.
+func TestStateTransferNames(t *testing.T) {
+	primary := newTestServer(t, SemanticsAtLeastOnce)
+	backup := newTestServer(t, SemanticsAtLeastOnce)
+	primary.renameGrace, backup.renameGrace = time.Hour, time.Hour
+	if rep := adminSender(t, primary)(renameReq(1, "RoomA", "Hall")); rep.Status != common.StatusOK {
+		t.Fatalf("rename: status %d: %s", rep.Status, rep.Data)
+	}
+	_, rb := startReplicaPair(t, primary, backup, 0)
+	waitSynced(t, rb, 5*time.Second)
+
+	p := newFakePeer("client")
+	if got := queryData(t, backup, 1, []uint8{0}, "hall"); !strings.Contains(got, "BKG-10000") {
+		t.Errorf("backup query of hall: %q", got)
+	}
+	rep := send(t, backup, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 2, FacilityName: "RoomA", DaysList: []uint8{0}})
+	if want := "Facility 'RoomA' not found; it has been renamed to 'Hall'"; rep.Data != want {
+		t.Errorf("backup query of the old name: %q, want %q", rep.Data, want)
+	}
+}
+
+// TestReplicationPrimaryRestart restarts the primary with other state on
+// the same replication address. Its frames are numbered from 1 again, below
+// what the backup has applied, so the backup must notice the new epoch and
+// fetch the state rather than ack them as duplicates.
+func TestReplicationPrimaryRestart(t *testing.T) {
+	primary := newTestServer(t, SemanticsAtLeastOnce)
+	backup := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+	link, rb := startReplicaPair(t, primary, backup, 0)
+	waitSynced(t, rb, 5*time.Second)
+	for id := uint64(1); id <= 3; id++ {
+		send(t, primary, p, bookReq(id, "RoomA", 1, uint8(8+id), uint8(9+id)))
+	}
+	waitConverged(t, primary, backup, 5*time.Second)
+
+	rp := primary.replicator
+	addr := rp.conn.LocalAddr().String()
+	rp.conn.Close() // the primary goes down; the test cleanup stops the rest
+	restarted := newTestServer(t, SemanticsAtLeastOnce)
+	rp2, err := NewReplicator(restarted, addr, link.toPrimary.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rp2.Close() })
+	restarted.replicator = rp2
+	go rp2.RunPrimary()
+
+	send(t, restarted, p, bookReq(1, "Lab1", 3, 10, 11))
+	waitConverged(t, restarted, backup, 5*time.Second)
+	rb.mu.Lock()
+	epoch := rb.epoch
+	rb.mu.Unlock()
+	if epoch != rp2.epoch {
+		t.Errorf("backup follows epoch %x, want the restarted primary's %x", epoch, rp2.epoch)
+	}
+}
+
+func TestReplicationUsesTheSharedKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		primary, bak common.PacketSecurity
+		wantSync     bool
+	}{
+		{"same key, encrypted", common.PacketSecurity{Key: []byte("k1"), Encrypt: true}, common.PacketSecurity{Key: []byte("k1"), Encrypt: true}, true},
+		{"different keys", common.PacketSecurity{Key: []byte("k1")}, common.PacketSecurity{Key: []byte("k2")}, false},
+		{"backup without key", common.PacketSecurity{Key: []byte("k1")}, common.PacketSecurity{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := newTestServer(t, SemanticsAtLeastOnce)
+			backup := newTestServer(t, SemanticsAtLeastOnce)
+			primary.security, backup.security = tt.primary, tt.bak
+			_, rb := startReplicaPair(t, primary, backup, 0)
+
+			deadline := time.Now().Add(1500 * time.Millisecond)
+			synced := false
+			for !synced && time.Now().Before(deadline) {
+				time.Sleep(20 * time.Millisecond)
+				rb.mu.Lock()
+				synced = rb.synced
+				rb.mu.Unlock()
+			}
+			if synced != tt.wantSync {
+				t.Errorf("backup synced = %v, want %v", synced, tt.wantSync)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+// server/reuseport_linux.go
+package main
+
+import "syscall"
+
+// soReusePort is SO_REUSEPORT on Linux; the syscall package does not export it.
+const soReusePort = 0xf
+
+const reusePortSupported = true
+
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+}
@@ -0,0 +1,132 @@
+// server/rollover.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Policies for -rollover: what happens to the bookings when the week clock
+// passes Sunday 23:59 and the schedule starts again.
+const (
+	RolloverKeep    = "keep"    // leave last week's bookings in place
+	RolloverDelete  = "delete"  // remove them
+	RolloverArchive = "archive" // append them to -archiveFile, then remove them
+)
+
+// rolloverCheckInterval is how often the week clock is read to notice the
+// rollover.
+const rolloverCheckInterval = 15 * time.Second
+
+// EventScheduleReset is reported to webhooks and subscribers when the
+// rollover clears a facility.
+const EventScheduleReset = "schedule_reset"
+
+// archivedBooking is one line of the -archiveFile.
+type archivedBooking struct {
+	ArchivedAt time.Time
+	Namespace  string `json:",omitempty"` // empty for the default namespace
+	Facility   string
+	Booking    Booking
+}
+
+// weekRollover carries out -rollover. lastMinute is the week clock at the
+// previous check; a smaller reading means the week started again.
+type weekRollover struct {
+	policy      string
+	archivePath string
+	lastMinute  int32
+	mu          sync.Mutex
+}
+
+// newWeekRollover checks the policy; any but keep needs -currentTime.
+func newWeekRollover(policy, archivePath string, clock WeekClock) (*weekRollover, error) {
+	switch policy {
+	case RolloverKeep:
+		return nil, nil
+	case RolloverDelete, RolloverArchive:
+	default:
+		return nil, fmt.Errorf("unknown policy %q (choose %q, %q or %q)", policy, RolloverKeep, RolloverDelete, RolloverArchive)
+	}
+	if clock == nil {
+		return nil, fmt.Errorf("-rollover=%s needs -currentTime", policy)
+	}
+	return &weekRollover{policy: policy, archivePath: archivePath, lastMinute: clock()}, nil
+}
+
+// runRollover watches the week clock until the process exits.
+func (s *ServerState) runRollover() {
+	ticker := time.NewTicker(rolloverCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.rolloverTick(s.clock())
+	}
+}
+
+// rolloverTick records the week clock reading now and, if the week started
+// again since the last one, clears the schedule. It reports whether a
+// rollover happened.
+func (s *ServerState) rolloverTick(now int32) bool {
+	r := s.rollover
+	r.mu.Lock()
+	wrapped := now < r.lastMinute
+	r.lastMinute = now
+	r.mu.Unlock()
+	if !wrapped {
+		return false
+	}
+	log.Printf("Week rolled over (now %s); applying -rollover=%s", formatWeekMinutes(now), r.policy)
+	s.clearSchedule()
+	return true
+}
+
+// clearSchedule removes every booking of every namespace, archiving it first under the archive
+// policy, and tells each facility's subscribers that its schedule was reset.
+// A facility whose bookings cannot be archived or deleted keeps them. The
+// idempotency keys of removed bookings are forgotten, so a retry of last
+// week's booking makes a new one.
+func (s *ServerState) clearSchedule() {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	allDays := []uint8{0, 1, 2, 3, 4, 5, 6}
+	for ns, facilities := range s.facilityData {
+		for name, fac := range facilities {
+			if len(fac.Bookings) == 0 {
+				continue
+			}
+			if s.rollover.policy == RolloverArchive {
+				if err := s.archiveBookings(ns, name, fac.Bookings); err != nil {
+					log.Printf("Keeping bookings of '%s': archiving failed: %v", name, err)
+					continue
+				}
+			}
+			removed := s.deleteBookings(fac, func(Booking) bool { return true })
+			s.idempotency.forget(removed)
+			s.notifySubscribers(ns, name, EventScheduleReset, "",
+				fmt.Sprintf("Schedule reset for the new week: %d bookings removed", len(removed)), allDays)
+		}
+	}
+}
+
+// archiveBookings appends the bookings of a facility of namespace ns to
+// -archiveFile, one JSON object per line.
+func (s *ServerState) archiveBookings(ns, facility string, bookings []Booking) error {
+	f, err := os.OpenFile(s.rollover.archivePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	now := time.Now()
+	for _, bk := range bookings {
+		if err := enc.Encode(archivedBooking{ArchivedAt: now, Namespace: namespaceLabel(ns), Facility: facility, Booking: bk}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
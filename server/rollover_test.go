@@ -0,0 +1,148 @@
+// server/rollover_test.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+func TestNewWeekRollover(t *testing.T) {
+	clock := fixedWeekClock(0)
+	if r, err := newWeekRollover(RolloverKeep, "", nil); r != nil || err != nil {
+		t.Errorf("keep: %v, %v; want nothing to run", r, err)
+	}
+	if _, err := newWeekRollover("purge", "", clock); err == nil {
+		t.Error("unknown policy accepted")
+	}
+	for _, policy := range []string{RolloverDelete, RolloverArchive} {
+		if _, err := newWeekRollover(policy, "", nil); err == nil {
+			t.Errorf("%s without -currentTime accepted", policy)
+		}
+	}
+}
+
+// rolloverServer returns a server under policy whose week clock reads
+// *now, starting on Sunday 23:50, and a subscriber of RoomA.
+func rolloverServer(t *testing.T, policy, archive string) (*ServerState, *int32, *fakePeer) {
+	t.Helper()
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	now := schedule.ToMinutes(6, 23, 50)
+	srv.clock = func() int32 { return now }
+	r, err := newWeekRollover(policy, archive, srv.clock)
+	if err != nil {
+		t.Fatalf("newWeekRollover: %v", err)
+	}
+	srv.rollover = r
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	return srv, &now, watcher
+}
+
+// bookingCount returns how many bookings the default namespace holds.
+func bookingCount(srv *ServerState) int {
+	srv.dataLock.RLock()
+	defer srv.dataLock.RUnlock()
+	n := 0
+	for _, fac := range srv.facilityData[common.DefaultNamespace] {
+		n += len(fac.Bookings)
+	}
+	return n
+}
+
+func TestRolloverDelete(t *testing.T) {
+	srv, now, watcher := rolloverServer(t, RolloverDelete, "")
+	seeded := bookingCount(srv)
+
+	*now = schedule.ToMinutes(6, 23, 59)
+	if srv.rolloverTick(*now) || bookingCount(srv) != seeded {
+		t.Fatal("rollover before the week ended")
+	}
+	*now = 0
+	if !srv.rolloverTick(*now) {
+		t.Fatal("no rollover at Monday 00:00")
+	}
+	if n := bookingCount(srv); n != 0 {
+		t.Errorf("%d bookings left after the rollover", n)
+	}
+	if got := events(t, watcher); len(got) != 1 || got[0] != common.EventReset {
+		t.Errorf("subscriber got events %v, want one reset", got)
+	}
+
+	// The new week fills up again and stays until the next rollover
+	confirmationID(t, send(t, srv, newFakePeer("client"), bookReq(2, "RoomA", 0, 9, 10)))
+	*now = schedule.ToMinutes(3, 12, 0)
+	if srv.rolloverTick(*now) || bookingCount(srv) != 1 {
+		t.Error("a second tick in the same week cleared the schedule")
+	}
+}
+
+func TestRolloverArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	srv, now, _ := rolloverServer(t, RolloverArchive, path)
+	seeded := bookingCount(srv)
+	*now = 5
+	if !srv.rolloverTick(*now) {
+		t.Fatal("no rollover")
+	}
+	if n := bookingCount(srv); n != 0 {
+		t.Errorf("%d bookings left after archiving", n)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ids := make(map[string]string)
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var rec archivedBooking
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("archive line %q: %v", sc.Text(), err)
+		}
+		if rec.ArchivedAt.IsZero() || rec.Namespace != "" {
+			t.Errorf("archive line %q", sc.Text())
+		}
+		ids[rec.Booking.ConfirmationID] = rec.Facility
+	}
+	if len(ids) != seeded || ids["BKG-10000"] != "RoomA" {
+		t.Errorf("archived %v, want all %d seeded bookings", ids, seeded)
+	}
+}
+
+// TestRolloverArchiveFails: bookings that cannot be archived are kept.
+func TestRolloverArchiveFails(t *testing.T) {
+	srv, now, watcher := rolloverServer(t, RolloverArchive, filepath.Join(t.TempDir(), "missing", "archive.jsonl"))
+	seeded := bookingCount(srv)
+	*now = 0
+	srv.rolloverTick(*now)
+	if n := bookingCount(srv); n != seeded {
+		t.Errorf("%d bookings left, want all %d", n, seeded)
+	}
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Errorf("%d reset callbacks for a schedule that was kept", n)
+	}
+}
+
+// TestRolloverForgetsIdempotencyKeys: a retry of a booking the rollover
+// removed books again instead of confirming the removed booking.
+func TestRolloverForgetsIdempotencyKeys(t *testing.T) {
+	srv, now, _ := rolloverServer(t, RolloverDelete, "")
+	p := newFakePeer("client")
+	req := bookReq(2, "Lab1", 6, 23, 23)
+	req.EndMinute = 59 // not yet over at Sunday 23:50
+	req.IdempotencyKey = "key-1"
+	removed := confirmationID(t, send(t, srv, p, req))
+
+	*now = 0
+	srv.rolloverTick(*now)
+	req.RequestID = 3
+	if got := confirmationID(t, send(t, srv, p, req)); got == removed {
+		t.Errorf("retry after the rollover confirmed the removed booking %s", got)
+	}
+}
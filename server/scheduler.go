@@ -0,0 +1,125 @@
+// server/scheduler.go
+package main
+
+import "github.com/Iyzyman/distributed-go/common"
+
+// Request classes for -workers. Each has its own queue, so a flood of one
+// cannot fill the queue the other waits in.
+const (
+	classRead = iota
+	classWrite
+	numClasses
+)
+
+var classNames = [numClasses]string{"read", "write"}
+
+// defaultQueueSize is how many packets each class may have waiting for a
+// worker by default.
+const defaultQueueSize = 1024
+
+// packetClass classifies a request payload (without its length prefix) by
+// OpCode. Mutating operations are writes, and so are batches, which may hold
+// them; everything else, including packets without a readable header, is a
+// read.
+func packetClass(payload []byte) int {
+	op, _, ok := common.PeekHeader(payload)
+	if ok && (common.IsMutating(op) || op == common.OpBatch) {
+		return classWrite
+	}
+	return classRead
+}
+
+// packetScheduler runs packets on a fixed pool of workers. A dispatcher
+// takes them from the class queues in weighted round-robin: each round up
+// to weights[c] packets of class c, so while both classes are backlogged
+// they complete in proportion to their weights, and a class with nothing
+// queued leaves its share to the other.
+type packetScheduler struct {
+	queues  [numClasses]chan func()
+	weights [numClasses]int
+	work    chan func()
+}
+
+// newPacketScheduler starts the dispatcher and the workers. Weights must
+// be at least 1, so neither class can be starved.
+func newPacketScheduler(workers, queueSize int, weights [numClasses]int) *packetScheduler {
+	p := &packetScheduler{weights: weights, work: make(chan func())}
+	for c := range p.queues {
+		p.queues[c] = make(chan func(), queueSize)
+	}
+	go p.dispatch()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for run := range p.work {
+				run()
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues run in its class's queue, or reports false if it is full.
+func (p *packetScheduler) submit(class int, run func()) bool {
+	select {
+	case p.queues[class] <- run:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch hands queued packets to the workers until the process exits.
+func (p *packetScheduler) dispatch() {
+	for {
+		dispatched := false
+		for c, q := range p.queues {
+		class:
+			for i := 0; i < p.weights[c]; i++ {
+				select {
+				case run := <-q:
+					p.work <- run
+					dispatched = true
+				default:
+					break class
+				}
+			}
+		}
+		if !dispatched {
+			// Both queues are empty: wait for the next packet of either class
+			select {
+			case run := <-p.queues[classRead]:
+				p.work <- run
+			case run := <-p.queues[classWrite]:
+				p.work <- run
+			}
+		}
+	}
+}
+
+// depths returns the number of packets waiting in each class's queue.
+func (p *packetScheduler) depths() map[string]int {
+	m := make(map[string]int, numClasses)
+	for c, q := range p.queues {
+		m[classNames[c]] = len(q)
+	}
+	return m
+}
+
+// schedule runs a received packet: on a goroutine of its own without
+// -workers, otherwise through the scheduler. A packet whose class queue is
+// full gets a busy reply; one from a blocked source is dropped unread.
+func (s *ServerState) schedule(payload []byte, peer Peer, run func()) {
+	if s.fromBlockedSource(peer) {
+		return
+	}
+	if s.scheduler == nil {
+		go run()
+		return
+	}
+	class := packetClass(payload)
+	if !s.scheduler.submit(class, run) {
+		s.busyReplies.Add(1)
+		s.replyToHeader(payload, peer, common.StatusBusy,
+			common.BusyData(s.overload.retryAfter, classNames[class]+" queue full"))
+	}
+}
@@ -0,0 +1,128 @@
+// server/scheduler_test.go
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestPacketClass sorts requests into the read and write queues by OpCode.
+func TestPacketClass(t *testing.T) {
+	p := newFakePeer("client")
+	tests := []struct {
+		op   uint8
+		want int
+	}{
+		{common.OpQueryAvailability, classRead},
+		{common.OpListBookings, classRead},
+		{common.OpBookFacility, classWrite},
+		{common.OpCancelBooking, classWrite},
+		{common.OpBatch, classWrite},
+	}
+	for _, tt := range tests {
+		if got := packetClass(p.seal(t, common.RequestMessage{OpCode: tt.op, RequestID: 1})); got != tt.want {
+			t.Errorf("%s is %s, want %s", common.OpName(tt.op), classNames[got], classNames[tt.want])
+		}
+	}
+	if got := packetClass([]byte{1, 2}); got != classRead {
+		t.Errorf("unreadable packet is %s", classNames[got])
+	}
+}
+
+// blockWorker occupies the only worker of p until the returned function is
+// called.
+func blockWorker(t *testing.T, p *packetScheduler) (release func()) {
+	t.Helper()
+	entered, done := make(chan struct{}), make(chan struct{})
+	p.submit(classRead, func() {
+		close(entered)
+		<-done
+	})
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("worker never started")
+	}
+	return func() { close(done) }
+}
+
+// TestWeightedShare floods both queues of a one-worker pool with reads
+// weighted 3:1 over writes: while both are backlogged, every fourth packet
+// run is a write, so the flood of reads cannot starve the writes, nor the
+// writes the reads.
+func TestWeightedShare(t *testing.T) {
+	p := newPacketScheduler(1, 100, [numClasses]int{3, 1})
+	release := blockWorker(t, p)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for _, class := range []int{classRead, classWrite} {
+		for i := 0; i < 40; i++ {
+			class := class
+			wg.Add(1)
+			if !p.submit(class, func() {
+				mu.Lock()
+				order = append(order, class)
+				mu.Unlock()
+				wg.Done()
+			}) {
+				t.Fatal("queue full")
+			}
+		}
+	}
+	release()
+	wg.Wait()
+
+	// The dispatcher may hold one read before the writes arrive; either
+	// way the first 41 packets are ten rounds and that read
+	writes := 0
+	for _, c := range order[:41] {
+		if c == classWrite {
+			writes++
+		}
+	}
+	if writes != 10 {
+		t.Errorf("%d writes among 41 packets run with both queues backlogged, want 10", writes)
+	}
+}
+
+// TestQueueFullBusy: a packet whose class queue is full gets a busy reply
+// naming the queue, while the other class is still queued.
+func TestQueueFullBusy(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.scheduler = newPacketScheduler(1, 1, [numClasses]int{1, 1})
+	release := blockWorker(t, srv.scheduler)
+	defer release()
+
+	p := newFakePeer("client")
+	ran := make(chan struct{}, 4)
+	for i := uint64(1); i <= 3; i++ {
+		srv.schedule(p.seal(t, bookReq(i, "Lab1", 4, 9, 10)), p, func() { ran <- struct{}{} })
+		// The dispatcher takes the first write off the queue and waits
+		// with it for the worker
+		for deadline := time.Now().Add(time.Second); i == 1 && srv.scheduler.depths()["write"] != 0; {
+			if time.Now().After(deadline) {
+				t.Fatal("dispatcher never took the first write")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// One write waits in the dispatcher, one in the queue, the third is refused
+	got := p.received()
+	if len(got) != 1 || got[0].RequestID != 3 || got[0].Status != common.StatusBusy || !strings.Contains(got[0].Data, "write queue full") {
+		t.Fatalf("replies %+v, want a busy reply to the third write", got)
+	}
+	srv.schedule(p.seal(t, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 4, FacilityName: "Lab1"}), p,
+		func() { ran <- struct{}{} })
+	if n := len(p.received()); n != 1 {
+		t.Errorf("a read was refused while only the write queue was full")
+	}
+	if depths := srv.scheduler.depths(); depths["read"] != 1 || depths["write"] != 1 {
+		t.Errorf("queue depths %v", depths)
+	}
+}
@@ -0,0 +1,75 @@
+// server/semantics_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestSemanticsOverride replays one AddParticipant under each combination
+// of server semantics and request hint and counts how often it ran.
+func TestSemanticsOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		allowed  []string
+		hint     uint8
+		wantRuns int // 0 when the hint is refused
+	}{
+		{"at-most-once default", SemanticsAtMostOnce, nil, common.HintServerDefault, 1},
+		{"at-least-once default", SemanticsAtLeastOnce, nil, common.HintServerDefault, 2},
+		{"hint matching the server", SemanticsAtMostOnce, nil, common.HintAtMostOnce, 1},
+		{"at-most-once hint allowed", SemanticsAtLeastOnce, []string{SemanticsAtMostOnce}, common.HintAtMostOnce, 1},
+		{"at-least-once hint allowed", SemanticsAtMostOnce, []string{SemanticsAtLeastOnce}, common.HintAtLeastOnce, 2},
+		{"at-most-once hint refused", SemanticsAtLeastOnce, nil, common.HintAtMostOnce, 0},
+		{"at-least-once hint refused", SemanticsAtMostOnce, nil, common.HintAtLeastOnce, 0},
+		{"unknown hint", SemanticsAtMostOnce, []string{SemanticsAtLeastOnce}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tt.server)
+			srv.allowedSemantics = make(map[string]bool)
+			for _, sem := range tt.allowed {
+				srv.allowedSemantics[sem] = true
+			}
+			p := newFakePeer("client")
+
+			req := addParticipant(1, "Ada")
+			req.Semantics = tt.hint
+			for i := 0; i < 2; i++ {
+				rep := send(t, srv, p, req)
+				if tt.wantRuns == 0 {
+					if rep.Status != common.StatusError || !strings.Contains(rep.Data, "does not allow") {
+						t.Fatalf("attempt %d: status %d %q, want the hint refused", i+1, rep.Status, rep.Data)
+					}
+				} else if rep.Status != common.StatusOK {
+					t.Fatalf("attempt %d: status %d: %s", i+1, rep.Status, rep.Data)
+				}
+			}
+			if runs := strings.Count(participants(srv), "Ada"); runs != tt.wantRuns {
+				t.Errorf("AddParticipant ran %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+// TestSemanticsPerRequest mixes hints on one server: each request gets the
+// semantics it asked for.
+func TestSemanticsPerRequest(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.allowedSemantics = map[string]bool{SemanticsAtLeastOnce: true}
+	p := newFakePeer("client")
+
+	once := addParticipant(1, "Once")
+	twice := addParticipant(2, "Twice")
+	twice.Semantics = common.HintAtLeastOnce
+	for i := 0; i < 2; i++ {
+		send(t, srv, p, once)
+		send(t, srv, p, twice)
+	}
+	if got := participants(srv); got != "Once,Twice,Twice" {
+		t.Errorf("participants = %q, want Once,Twice,Twice", got)
+	}
+}
@@ -0,0 +1,27 @@
+// server/servertime_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestServerTimeReported: a reply carries the time spent on its request,
+// and a duplicate answered from the history reports only its own lookup.
+func TestServerTimeReported(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	srv := newHookServer(t, SemanticsAtMostOnce, func(string, Booking) { time.Sleep(delay) })
+	p := newFakePeer("client")
+
+	rep := send(t, srv, p, bookReq(1, "Lab1", 3, 9, 10))
+	if took := time.Duration(rep.ServerMicros) * time.Microsecond; took < delay || took > 10*delay {
+		t.Errorf("booking reported %v of server time, want about %v", took, delay)
+	}
+	dup := send(t, srv, p, bookReq(1, "Lab1", 3, 9, 10))
+	if dup.Data != rep.Data {
+		t.Fatalf("duplicate answered %q, want the cached %q", dup.Data, rep.Data)
+	}
+	if took := time.Duration(dup.ServerMicros) * time.Microsecond; took >= delay {
+		t.Errorf("duplicate reported %v, want its lookup only", took)
+	}
+}
@@ -0,0 +1,193 @@
+// server/session.go
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// Session ties an opaque token to a registered user.
+type Session struct {
+	User     string
+	Instance string // the client's ID for its run, if it sent one
+	LastSeen time.Time
+	Addr     Peer // where the last request of the session came from
+}
+
+// UserAccount is a registered user. Accounts registered without a password
+// can be claimed by anyone who knows the name.
+type UserAccount struct {
+	Salt         []byte
+	PasswordHash []byte // nil when registered without a password
+}
+
+// registerAdmin creates the admin account from -adminUser/-adminKey. The
+// account always has a password, so the name cannot be claimed by anyone
+// who does not know the key.
+func (s *ServerState) registerAdmin(name, key string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+	s.users[name] = UserAccount{Salt: salt, PasswordHash: hashPassword(salt, key)}
+	s.adminUser = name
+	return nil
+}
+
+// isAdmin reports whether a resolved session user is the admin.
+func (s *ServerState) isAdmin(user string) bool {
+	return user != "" && user == s.adminUser
+}
+
+// newSessionToken returns a random 128-bit token in hex.
+func newSessionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashPassword(salt []byte, password string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(password))
+	return h.Sum(nil)
+}
+
+// handleRegisterUser creates the account on first use (or checks the
+// password of an existing one) and returns a new session token as Data.
+func (s *ServerState) handleRegisterUser(req common.RequestMessage, t *opTiming) (string, int32) {
+	name := req.Username
+	log.Printf("Handling RegisterUser for '%s'", name)
+	if name == "" {
+		return "Username must not be empty.", -1
+	}
+
+	t.lock(&s.sessionLock)
+	defer s.sessionLock.Unlock()
+
+	acct, exists := s.users[name]
+	if !exists {
+		acct = UserAccount{}
+		if req.Password != "" {
+			acct.Salt = make([]byte, 16)
+			if _, err := rand.Read(acct.Salt); err != nil {
+				return "Could not register user.", -1
+			}
+			acct.PasswordHash = hashPassword(acct.Salt, req.Password)
+		}
+		s.users[name] = acct
+		log.Printf("Registered new user '%s'", name)
+	} else if acct.PasswordHash != nil &&
+		subtle.ConstantTimeCompare(acct.PasswordHash, hashPassword(acct.Salt, req.Password)) != 1 {
+		log.Printf("Wrong password for user '%s'", name)
+		return fmt.Sprintf("Wrong password for user %s.", name), -1
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		return "Could not create session.", -1
+	}
+	s.sessions[token] = &Session{User: name, Instance: req.ClientInstance, LastSeen: time.Now()}
+	return token, 0
+}
+
+// historyClient names the client whose at-most-once history a request
+// belongs to. A session from a client that sent its instance ID is keyed by
+// user and instance, so the client finds its replies again after logging
+// in anew, say across a server restart, while other clients of the same
+// user keep windows of their own. Other sessions are keyed by token, and
+// anonymous requests by address.
+func (s *ServerState) historyClient(req common.RequestMessage, addr Peer) string {
+	if req.SessionToken == "" {
+		return addr.String()
+	}
+	s.sessionLock.Lock()
+	sess, ok := s.sessions[req.SessionToken]
+	var instance string
+	if ok {
+		instance = sess.Instance
+	}
+	s.sessionLock.Unlock()
+	if instance != "" {
+		return "user:" + req.User + "/" + instance
+	}
+	return "session:" + req.SessionToken
+}
+
+// resolveSession returns the user behind a token, refreshes its idle timer
+// and remembers addr as where the session is reached. Expired tokens are
+// removed on the spot.
+func (s *ServerState) resolveSession(token string, addr Peer) (string, bool) {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	sess, ok := s.sessions[token]
+	if !ok {
+		return "", false
+	}
+	now := time.Now()
+	if s.sessionIdle > 0 && now.Sub(sess.LastSeen) > s.sessionIdle {
+		delete(s.sessions, token)
+		return "", false
+	}
+	sess.LastSeen = now
+	if addr != nil {
+		sess.Addr = addr
+	}
+	return sess.User, true
+}
+
+// userAddrs returns the addresses of the live sessions of user, each once.
+func (s *ServerState) userAddrs(user string) []Peer {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	seen := make(map[string]bool)
+	var addrs []Peer
+	for _, sess := range s.sessions {
+		if sess.User != user || sess.Addr == nil || seen[sess.Addr.String()] {
+			continue
+		}
+		seen[sess.Addr.String()] = true
+		addrs = append(addrs, sess.Addr)
+	}
+	return addrs
+}
+
+// sweepSessions periodically drops sessions idle for longer than
+// -sessionIdle so abandoned tokens do not accumulate.
+func (s *ServerState) sweepSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.expireSessions(now)
+	}
+}
+
+// expireSessions drops the sessions idle for longer than -sessionIdle at
+// now and returns how many it dropped.
+func (s *ServerState) expireSessions(now time.Time) int {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	removed := 0
+	for token, sess := range s.sessions {
+		if now.Sub(sess.LastSeen) > s.sessionIdle {
+			delete(s.sessions, token)
+			log.Printf("Session for user '%s' expired", sess.User)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,120 @@
+// server/session_test.go
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func login(t *testing.T, srv *ServerState, p *fakePeer, id uint64, user, password string) string {
+	t.Helper()
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpRegisterUser, RequestID: id, Username: user, Password: password})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("login %s: status %d: %s", user, rep.Status, rep.Data)
+	}
+	return rep.Data
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+
+	first := login(t, srv, p, 1, "alice", "pw")
+	second := login(t, srv, p, 2, "alice", "pw")
+	if first == second || len(first) != 32 {
+		t.Errorf("tokens %q and %q, want two different 128-bit hex tokens", first, second)
+	}
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpRegisterUser, RequestID: 3, Username: "alice", Password: "guess"})
+	if rep.Status == common.StatusOK {
+		t.Error("login with the wrong password succeeded")
+	}
+	rep = send(t, srv, p, common.RequestMessage{OpCode: common.OpRegisterUser, RequestID: 4})
+	if rep.Status == common.StatusOK {
+		t.Error("login without a username succeeded")
+	}
+
+	// An account registered without a password can be claimed by name
+	login(t, srv, p, 5, "bob", "")
+	login(t, srv, p, 6, "bob", "anything")
+
+	// The token identifies the user on later requests
+	rep = send(t, srv, p, common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 7, FacilityName: "RoomA", MonitorPeriod: 60, SessionToken: first})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+	if user := srv.monitorSubs[0].User; user != "alice" {
+		t.Errorf("subscription belongs to %q, want alice", user)
+	}
+}
+
+func TestInvalidAndExpiredTokens(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.sessionIdle = time.Minute
+	p := newFakePeer("client")
+	token := login(t, srv, p, 1, "alice", "pw")
+
+	tests := []struct {
+		name  string
+		token string
+		idle  time.Duration
+	}{
+		{"unknown token", "0123456789abcdef0123456789abcdef", 0},
+		{"expired token", token, 2 * time.Minute},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.idle > 0 {
+				srv.sessions[tt.token].LastSeen = time.Now().Add(-tt.idle)
+			}
+			req := bookReq(uint64(10+i), "RoomA", 3, 9, 10)
+			req.SessionToken = tt.token
+			rep := send(t, srv, p, req)
+			if rep.Status != common.StatusBadSession {
+				t.Fatalf("status %d, want %d: %s", rep.Status, common.StatusBadSession, rep.Data)
+			}
+			if _, ok := srv.sessions[tt.token]; ok {
+				t.Error("the rejected token is still a session")
+			}
+			// The request was not executed
+			if n := len(srv.facilityData[common.DefaultNamespace]["RoomA"].Bookings); n != 2 {
+				t.Errorf("RoomA has %d bookings, want the 2 seeded", n)
+			}
+		})
+	}
+}
+
+func TestUseKeepsSessionAlive(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.sessionIdle = time.Minute
+	p := newFakePeer("client")
+	token := login(t, srv, p, 1, "alice", "pw")
+
+	srv.sessions[token].LastSeen = time.Now().Add(-50 * time.Second)
+	req := bookReq(2, "RoomA", 3, 9, 10)
+	req.SessionToken = token
+	confirmationID(t, send(t, srv, p, req))
+	if n := srv.expireSessions(time.Now().Add(30 * time.Second)); n != 0 {
+		t.Errorf("sweep 30s after use removed %d sessions", n)
+	}
+}
+
+func TestExpireSessions(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.sessionIdle = time.Minute
+	p := newFakePeer("client")
+	idle := login(t, srv, p, 1, "alice", "pw")
+	fresh := login(t, srv, p, 2, "bob", "pw")
+	srv.sessions[idle].LastSeen = time.Now().Add(-2 * time.Minute)
+
+	if n := srv.expireSessions(time.Now()); n != 1 {
+		t.Errorf("expireSessions removed %d sessions, want 1", n)
+	}
+	if _, ok := srv.sessions[idle]; ok {
+		t.Error("idle session survived the sweep")
+	}
+	if _, ok := srv.sessions[fresh]; !ok {
+		t.Error("fresh session was swept")
+	}
+}
@@ -0,0 +1,27 @@
+// server/shutdown.go
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// closeOnShutdown closes c when the server is interrupted or terminated and
+// then exits. main never returns, so this is where state that must be
+// flushed, like the history journal, gets closed.
+func closeOnShutdown(c io.Closer) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		log.Printf("Received %v, shutting down", sig)
+		if err := c.Close(); err != nil {
+			log.Printf("Shutdown: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,85 @@
+// server/size_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// paddedBooking returns a marshaled booking of exactly size bytes, padded
+// with its idempotency key.
+func paddedBooking(t *testing.T, id uint64, day uint8, size int) []byte {
+	t.Helper()
+	for pad := 0; pad < size; pad++ {
+		req := bookReq(id, "RoomA", day, 9, 10)
+		req.IdempotencyKey = strings.Repeat("k", pad)
+		raw, err := common.MarshalRequest(req)
+		if err != nil {
+			t.Fatalf("MarshalRequest: %v", err)
+		}
+		if len(raw) == size {
+			return raw
+		}
+	}
+	t.Fatalf("cannot pad a booking to %d bytes", size)
+	return nil
+}
+
+// TestMaxRequestSize sends requests just under, at and over the limit the
+// way the UDP listener sees them: its buffer holds the length prefix and
+// the limit, so a larger datagram arrives cut off.
+func TestMaxRequestSize(t *testing.T) {
+	const limit = 300
+	tests := []struct {
+		name string
+		size int
+		want int32
+	}{
+		{"just under", limit - 1, common.StatusOK},
+		{"at the limit", limit, common.StatusOK},
+		{"just over", limit + 1, common.StatusTooLarge},
+		{"far over", 4 * limit, common.StatusTooLarge},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtLeastOnce)
+			srv.maxRequestSize = limit
+			p := newFakePeer("client")
+
+			datagram := common.PrefixLength(paddedBooking(t, uint64(i+1), 3, tt.size))
+			if max := common.LengthPrefixSize + limit; len(datagram) > max {
+				datagram = datagram[:max]
+			}
+			before := len(p.received())
+			srv.handleDatagram(datagram, p)
+			got := p.received()[before:]
+			if len(got) != 1 {
+				t.Fatalf("got %d replies, want 1", len(got))
+			}
+			if got[0].Status != tt.want {
+				t.Fatalf("status %d, want %d: %s", got[0].Status, tt.want, got[0].Data)
+			}
+			if got[0].RequestID != uint64(i+1) {
+				t.Errorf("reply to RequestID %d, want %d", got[0].RequestID, i+1)
+			}
+			if tt.want == common.StatusTooLarge && !strings.Contains(got[0].Data, "limit of 300 bytes") {
+				t.Errorf("reply does not name the limit: %q", got[0].Data)
+			}
+		})
+	}
+}
+
+// TestTruncatedInTransit: a datagram shorter than its length prefix says,
+// but within the limit, was cut off on the way and is reported as such.
+func TestTruncatedInTransit(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	p := newFakePeer("client")
+	datagram := common.PrefixLength(paddedBooking(t, 1, 3, 200))
+	srv.handleDatagram(datagram[:150], p)
+	got := p.received()
+	if len(got) != 1 || got[0].Status != common.StatusError || !strings.Contains(got[0].Data, "truncated") {
+		t.Fatalf("got %+v, want one truncation error", got)
+	}
+}
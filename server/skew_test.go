@@ -0,0 +1,119 @@
+// server/skew_test.go
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+)
+
+var clockOffsets = []time.Duration{2 * time.Minute, -2 * time.Minute}
+
+// near reports whether got is within a second of want.
+func near(got, want time.Time) bool {
+	d := got.Sub(want)
+	return d > -time.Second && d < time.Second
+}
+
+// TestClockOffsetTimestampWindow: with the server clock shifted, a request
+// stamped with the local clock is stale and one stamped with the shifted
+// clock is accepted, and the refusal reports the shifted time.
+func TestClockOffsetTimestampWindow(t *testing.T) {
+	for _, offset := range clockOffsets {
+		t.Run(offset.String(), func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			srv.maxSkew = 30 * time.Second
+			srv.clockOffset = offset
+			p := newFakePeer("client")
+
+			req := bookReq(1, "RoomA", 3, 9, 10)
+			req.Timestamp = time.Now().UnixMilli()
+			rep := send(t, srv, p, req)
+			if rep.Status != common.StatusStaleRequest {
+				t.Fatalf("local timestamp: status %d, want stale: %s", rep.Status, rep.Data)
+			}
+			if serverNow, ok := common.ParseServerTime(rep.Data); !ok || !near(serverNow, time.Now().Add(offset)) {
+				t.Errorf("refusal reports %v, want the local time shifted by %v", serverNow, offset)
+			}
+
+			req.Timestamp = time.Now().Add(offset).UnixMilli()
+			confirmationID(t, send(t, srv, p, req))
+		})
+	}
+}
+
+// TestClockOffsetMonitorExpiry: a monitor expires a period after
+// registration by the shifted clock, whichever way it is shifted.
+func TestClockOffsetMonitorExpiry(t *testing.T) {
+	for _, offset := range clockOffsets {
+		t.Run(offset.String(), func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			srv.clockOffset = offset
+			watcher := newFakePeer("watcher")
+			if rep := send(t, srv, watcher, monitorReq(1, nil, 0)); rep.Status != common.StatusOK {
+				t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+			}
+			srv.monitorLock.Lock()
+			expires := srv.monitorSubs[0].ExpiresAt
+			srv.monitorLock.Unlock()
+			if want := time.Now().Add(offset + 60*time.Second); !near(expires, want) {
+				t.Errorf("monitor expires at %v, want %v", expires, want)
+			}
+
+			// Ten seconds before the expiry by the shifted clock the monitor is
+			// notified; ten seconds after it, it is not
+			p := newFakePeer("client")
+			srv.clockOffset = offset + 50*time.Second
+			confirmationID(t, send(t, srv, p, bookReq(2, "RoomA", 3, 9, 10)))
+			if got := len(watcher.callbacks()); got != 1 {
+				t.Errorf("%d callbacks before the expiry, want 1", got)
+			}
+			srv.clockOffset = offset + 70*time.Second
+			confirmationID(t, send(t, srv, p, bookReq(3, "RoomA", 3, 11, 12)))
+			if got := len(watcher.callbacks()); got != 1 {
+				t.Errorf("%d callbacks after the expiry, want still 1", got)
+			}
+		})
+	}
+}
+
+func TestClockOffsetHello(t *testing.T) {
+	for _, offset := range clockOffsets {
+		srv := newTestServer(t, SemanticsAtMostOnce)
+		srv.clockOffset = offset
+		rep := send(t, srv, newFakePeer("client"), common.RequestMessage{OpCode: common.OpHello, RequestID: 1, HelloVersion: common.ProtocolVersion})
+		if rep.Status != common.StatusOK || !near(time.UnixMilli(rep.ServerClock), time.Now().Add(offset)) {
+			t.Errorf("offset %v: hello reports %v", offset, time.UnixMilli(rep.ServerClock))
+		}
+	}
+}
+
+// TestRealWeekClockOffset: the week clock for -currentTime=real moves with
+// the offset, wrapping around the end of the week.
+func TestRealWeekClockOffset(t *testing.T) {
+	for _, offset := range []time.Duration{90 * time.Minute, -90 * time.Minute, 6 * 24 * time.Hour} {
+		t.Run(fmt.Sprint(offset), func(t *testing.T) {
+			clock, err := parseCurrentTime("real", offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			local := realWeekClock(0)
+			// Read again if a minute ticked over between the two readings
+			for i := 0; i < 3; i++ {
+				before, shifted, after := local(), clock(), local()
+				if before != after {
+					continue
+				}
+				want := (before + int32(offset/time.Minute) + schedule.WeekMinutes) % schedule.WeekMinutes
+				if shifted != want {
+					t.Errorf("shifted clock reads %d, want %d", shifted, want)
+				}
+				return
+			}
+			t.Skip("the minute kept changing")
+		})
+	}
+}
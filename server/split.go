@@ -0,0 +1,131 @@
+// server/split.go
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Iyzyman/distributed-go/common"
+	"github.com/Iyzyman/distributed-go/common/schedule"
+	"github.com/Iyzyman/distributed-go/common/validate"
+)
+
+// bookingAt returns a copy of bk covering iv instead, with the given ID.
+func bookingAt(bk Booking, id string, iv schedule.Interval) Booking {
+	bk.ConfirmationID = id
+	bk.StartDay, bk.StartHour, bk.StartMinute = schedule.FromMinutes(iv.Start)
+	bk.EndDay, bk.EndHour, bk.EndMinute = schedule.FromMinutes(iv.End)
+	bk.Participants = append([]string(nil), bk.Participants...)
+	return bk
+}
+
+// handleSplitBooking gives up part of a booking. The cut must lie within
+// the booking; the time before it keeps the original ID and the time after
+// it gets a new one, with the participants copied to both. A cut that
+// touches the start or the end leaves one piece, which keeps the ID, so the
+// booking just shrinks. A cut of zero length splits the booking into two
+// adjoining ones.
+func (s *ServerState) handleSplitBooking(req common.RequestMessage, t *opTiming) (string, int32) {
+	confID := req.ConfirmationID
+	log.Printf("Handling SplitBooking for ConfirmationID '%s'", confID)
+	if err := validate.ValidateTimeFields(req.StartDay, req.StartHour, req.StartMinute, req.EndDay, req.EndHour, req.EndMinute); err != nil {
+		rejectField(t, err)
+		return fmt.Sprintf("Error: %v.", err), common.StatusInvalidArgument
+	}
+	cut := schedule.Span(req.StartDay, req.StartHour, req.StartMinute, req.EndDay, req.EndHour, req.EndMinute)
+	if cut.End < cut.Start {
+		t.reject("End", formatWeekMinutes(cut.End))
+		return fmt.Sprintf("Error: the cut ends at %s, before it starts at %s.",
+			formatWeekMinutes(cut.End), formatWeekMinutes(cut.Start)), common.StatusInvalidArgument
+	}
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	facName, fac, index, ok := s.findBooking(req.Namespace, confID)
+	if !ok {
+		log.Printf("Booking '%s' not found in SplitBooking", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Error: Booking %s not found", confID), -1
+	}
+	bk := fac.Bookings[index]
+	if bk.Pending {
+		return refusePending(bk, t)
+	}
+	whole := bk.interval()
+	span := formatWeekMinutes(whole.Start) + " to " + formatWeekMinutes(whole.End)
+
+	if cut.Start < whole.Start || cut.End > whole.End {
+		t.reject("Start", formatWeekMinutes(cut.Start))
+		return fmt.Sprintf("The cut %s to %s is not within booking %s (%s)",
+			formatWeekMinutes(cut.Start), formatWeekMinutes(cut.End), confID, span), common.StatusInvalidArgument
+	}
+	before := schedule.Interval{Start: whole.Start, End: cut.Start}
+	after := schedule.Interval{Start: cut.End, End: whole.End}
+	switch {
+	case before.Empty() && after.Empty():
+		t.reject("Start", formatWeekMinutes(cut.Start))
+		return fmt.Sprintf("The cut covers all of booking %s (%s); cancel it instead", confID, span), common.StatusInvalidArgument
+	case before == whole || after == whole:
+		t.reject("Start", formatWeekMinutes(cut.Start))
+		return fmt.Sprintf("Splitting booking %s (%s) at %s would leave it unchanged",
+			confID, span, formatWeekMinutes(cut.Start)), common.StatusInvalidArgument
+	}
+	if status, started := s.bookingStarted(bk); started && !req.Force {
+		log.Printf("Refusing to split booking '%s': it has already started", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Booking %s has already started (now %s) and cannot be split", confID, formatWeekMinutes(s.clock())), status
+	}
+
+	// The first remaining piece keeps the ID; the second is new
+	var pieces []Booking
+	for _, iv := range []schedule.Interval{before, after} {
+		if iv.Empty() {
+			continue
+		}
+		id := confID
+		if len(pieces) > 0 {
+			if id = req.NewID; id == "" {
+				id = s.newID()
+			}
+		}
+		pieces = append(pieces, bookingAt(bk, id, iv))
+	}
+
+	if err := s.store.UpdateBooking(qualify(req.Namespace, facName), pieces[0]); err != nil {
+		log.Printf("Failed to persist split of booking '%s': %v", confID, err)
+		return "Error: could not save booking split.", -1
+	}
+	if len(pieces) == 2 {
+		if err := s.store.SaveBooking(qualify(req.Namespace, facName), pieces[1]); err != nil {
+			log.Printf("Failed to persist second piece of booking '%s': %v", confID, err)
+			if rerr := s.store.UpdateBooking(qualify(req.Namespace, facName), bk); rerr != nil {
+				log.Printf("Failed to restore booking '%s' in the store: %v", confID, rerr)
+			}
+			return "Error: could not save booking split.", -1
+		}
+	}
+	fac.Bookings[index] = pieces[0]
+	fac.Bookings = append(fac.Bookings, pieces[1:]...)
+
+	var msg string
+	if len(pieces) == 1 {
+		p := pieces[0].interval()
+		msg = fmt.Sprintf("Booking %s shortened to %s to %s (was %s)", confID,
+			formatWeekMinutes(p.Start), formatWeekMinutes(p.End), span)
+	} else {
+		msg = fmt.Sprintf("Booking %s split: %s to %s freed, %s kept until %s and %s from %s",
+			confID, formatWeekMinutes(cut.Start), formatWeekMinutes(cut.End),
+			confID, formatWeekMinutes(before.End), pieces[1].ConfirmationID, formatWeekMinutes(after.Start))
+		if cut.Empty() {
+			msg = fmt.Sprintf("Booking %s split at %s: %s until then and %s from then",
+				confID, formatWeekMinutes(cut.Start), confID, pieces[1].ConfirmationID)
+		}
+	}
+	s.notifySubscribers(req.Namespace, facName, EventBookingChanged, confID, msg, affectedDays(bk))
+	log.Printf("SplitBooking successful: %s", msg)
+	if len(pieces) == 2 {
+		return msg + ". ID=" + pieces[1].ConfirmationID, 0
+	}
+	return msg + ".", 0
+}
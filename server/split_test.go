@@ -0,0 +1,129 @@
+// server/split_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// splitReq cuts from..to, minutes of Friday, out of booking confID.
+func splitReq(id uint64, confID string, from, to int) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpSplitBooking, RequestID: id, ConfirmationID: confID,
+		StartDay: 4, StartHour: uint8(from / 60), StartMinute: uint8(from % 60),
+		EndDay: 4, EndHour: uint8(to / 60), EndMinute: uint8(to % 60)}
+}
+
+// TestSplitBooking cuts a Friday 09:00-12:00 booking with Ada in it. The
+// cut lies inside it, touches its start or its end, or is a point.
+func TestSplitBooking(t *testing.T) {
+	const friday = 4 * 1440
+	tests := []struct {
+		name     string
+		from, to int
+		pieces   [][2]int32 // minutes of Friday; the first keeps the ID
+		callback string
+	}{
+		{"middle", 10 * 60, 11 * 60, [][2]int32{{540, 600}, {660, 720}},
+			"split: Fri 10:00 to Fri 11:00 freed"},
+		{"at start", 9 * 60, 10 * 60, [][2]int32{{600, 720}},
+			"shortened to Fri 10:00 to Fri 12:00"},
+		{"at end", 11 * 60, 12 * 60, [][2]int32{{540, 660}},
+			"shortened to Fri 09:00 to Fri 11:00"},
+		{"point", 10*60 + 30, 10*60 + 30, [][2]int32{{540, 630}, {630, 720}},
+			"split at Fri 10:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			p, watcher := newFakePeer("client"), newFakePeer("watcher")
+			id := confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 4, 9, 12)))
+			send(t, srv, p, common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 2, ConfirmationID: id, ParticipantName: "Ada"})
+			send(t, srv, watcher, monitorReq(3, []uint8{4}, 0))
+
+			rep := send(t, srv, p, splitReq(4, id, tt.from, tt.to))
+			if rep.Status != common.StatusOK {
+				t.Fatalf("status %d: %s", rep.Status, rep.Data)
+			}
+			ids := []string{id}
+			if len(tt.pieces) == 2 {
+				ids = append(ids, confirmationID(t, rep))
+				if ids[1] == id {
+					t.Fatalf("second piece kept the ID %s", id)
+				}
+			} else if strings.Contains(rep.Data, "ID=") {
+				t.Errorf("shrink reported a new ID: %s", rep.Data)
+			}
+			for i, want := range tt.pieces {
+				start, end := bookingInterval(t, srv, ids[i])
+				if start-friday != want[0] || end-friday != want[1] {
+					t.Errorf("piece %s at %d-%d, want %d-%d", ids[i], start-friday, end-friday, want[0], want[1])
+				}
+				srv.dataLock.RLock()
+				_, fac, j, _ := srv.findBooking(common.DefaultNamespace, ids[i])
+				got := strings.Join(fac.Bookings[j].Participants, ",")
+				srv.dataLock.RUnlock()
+				if got != "Ada" {
+					t.Errorf("piece %s has participants %q", ids[i], got)
+				}
+			}
+			if n := len(facilityBookings(srv, "RoomA")); n != 2+len(tt.pieces) {
+				t.Errorf("RoomA holds %d bookings, want the seeds and %d pieces", n, len(tt.pieces))
+			}
+
+			cbs := watcher.callbacks()
+			if len(cbs) != 1 {
+				t.Fatalf("%d callbacks, want 1", len(cbs))
+			}
+			if !strings.Contains(cbs[0].Data, tt.callback) {
+				t.Errorf("callback %q, want %q", cbs[0].Data, tt.callback)
+			}
+		})
+	}
+}
+
+// TestSplitFreesTheCut: the time given up can be booked by someone else,
+// and the pieces still conflict.
+func TestSplitFreesTheCut(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	id := confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 4, 9, 12)))
+	send(t, srv, p, splitReq(2, id, 10*60, 11*60))
+	confirmationID(t, send(t, srv, p, bookReq(3, "RoomA", 4, 10, 11)))
+	for i, hour := range []uint8{9, 11} {
+		if rep := send(t, srv, p, bookReq(uint64(4+i), "RoomA", 4, hour, hour+1)); rep.Status == common.StatusOK {
+			t.Errorf("%02d:00 still free after the split", hour)
+		}
+	}
+}
+
+func TestSplitRefused(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		reply    string
+	}{
+		{"whole", 9 * 60, 12 * 60, "covers all of booking"},
+		{"before start", 8 * 60, 10 * 60, "is not within booking"},
+		{"past end", 11 * 60, 13 * 60, "is not within booking"},
+		{"point at start", 9 * 60, 9 * 60, "would leave it unchanged"},
+		{"point at end", 12 * 60, 12 * 60, "would leave it unchanged"},
+		{"backwards", 11 * 60, 10 * 60, "before it starts"},
+	}
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	id := confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 4, 9, 12)))
+	for i, tt := range tests {
+		rep := send(t, srv, p, splitReq(uint64(10+i), id, tt.from, tt.to))
+		if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, tt.reply) {
+			t.Errorf("%s: status %d: %s; want %q", tt.name, rep.Status, rep.Data, tt.reply)
+		}
+	}
+	if start, end := bookingInterval(t, srv, id); end-start != 180 {
+		t.Errorf("refused splits left the booking %d minutes long", end-start)
+	}
+	if rep := send(t, srv, p, splitReq(20, "BKG-99999", 10*60, 11*60)); rep.Status != -1 {
+		t.Errorf("unknown booking: status %d: %s", rep.Status, rep.Data)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+// server/sqlite_driver.go
+package main
+
+// Registers the pure-Go "sqlite" database/sql driver used by SQLiteStore.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,246 @@
+// server/sqlite_store.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// sqliteDriverName is the database/sql driver used by SQLiteStore. The driver
+// itself is linked in by sqlite_driver.go when building with -tags sqlite.
+const sqliteDriverName = "sqlite"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS facilities (
+	name TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS bookings (
+	confirmation_id TEXT PRIMARY KEY,
+	facility        TEXT NOT NULL REFERENCES facilities(name),
+	start_day       INTEGER NOT NULL,
+	start_hour      INTEGER NOT NULL,
+	start_minute    INTEGER NOT NULL,
+	end_day         INTEGER NOT NULL,
+	end_hour        INTEGER NOT NULL,
+	end_minute      INTEGER NOT NULL,
+	participants    TEXT NOT NULL DEFAULT '[]'
+);`
+
+// SQLiteStore persists facilities and bookings in a SQLite database.
+// Each mutation runs in its own transaction.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the database at dbPath. An empty database
+// is seeded with the demo facilities.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if !sqliteAvailable() {
+		return nil, fmt.Errorf("this server was built without SQLite support; rebuild with -tags sqlite")
+	}
+	if dbPath == "" {
+		return nil, fmt.Errorf("-dbPath is required for the sqlite store")
+	}
+	db, err := sql.Open(sqliteDriverName, dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", dbPath, err)
+	}
+	// SQLite allows a single writer; serialise access through one connection.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+
+	st := &SQLiteStore{db: db}
+	names, err := st.LoadFacilities()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if len(names) == 0 {
+		if err := st.seed(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("seeding database: %w", err)
+		}
+	}
+	return st, nil
+}
+
+func sqliteAvailable() bool {
+	for _, d := range sql.Drivers() {
+		if d == sqliteDriverName {
+			return true
+		}
+	}
+	return false
+}
+
+// seed writes the demo facilities into an empty database.
+func (st *SQLiteStore) seed() error {
+	for name, fac := range seedFacilities() {
+		if err := st.SaveFacility(name); err != nil {
+			return err
+		}
+		for _, bk := range fac.Bookings {
+			if err := st.SaveBooking(name, bk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (st *SQLiteStore) LoadFacilities() ([]string, error) {
+	rows, err := st.db.Query(`SELECT name FROM facilities ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("loading facilities: %w", err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (st *SQLiteStore) LoadAll() (map[string]*FacilityInfo, error) {
+	names, err := st.LoadFacilities()
+	if err != nil {
+		return nil, err
+	}
+	facilities := make(map[string]*FacilityInfo, len(names))
+	for _, name := range names {
+		facilities[name] = &FacilityInfo{Name: name}
+	}
+
+	rows, err := st.db.Query(`SELECT confirmation_id, facility, start_day, start_hour, start_minute,
+		end_day, end_hour, end_minute, participants FROM bookings ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("loading bookings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bk Booking
+		var facName, participants string
+		if err := rows.Scan(&bk.ConfirmationID, &facName,
+			&bk.StartDay, &bk.StartHour, &bk.StartMinute,
+			&bk.EndDay, &bk.EndHour, &bk.EndMinute, &participants); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(participants), &bk.Participants); err != nil {
+			return nil, fmt.Errorf("booking %s: bad participants: %w", bk.ConfirmationID, err)
+		}
+		fac, ok := facilities[facName]
+		if !ok {
+			return nil, fmt.Errorf("booking %s references unknown facility %s", bk.ConfirmationID, facName)
+		}
+		fac.Bookings = append(fac.Bookings, bk)
+	}
+	return facilities, rows.Err()
+}
+
+func (st *SQLiteStore) SaveFacility(name string) error {
+	return st.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO facilities(name) VALUES (?)`, name)
+		return err
+	})
+}
+
+func (st *SQLiteStore) SaveBooking(facility string, bk Booking) error {
+	participants, err := json.Marshal(participantsOrEmpty(bk.Participants))
+	if err != nil {
+		return err
+	}
+	return st.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO bookings(confirmation_id, facility, start_day, start_hour, start_minute,
+			end_day, end_hour, end_minute, participants) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			bk.ConfirmationID, facility,
+			bk.StartDay, bk.StartHour, bk.StartMinute,
+			bk.EndDay, bk.EndHour, bk.EndMinute, string(participants))
+		return err
+	})
+}
+
+func (st *SQLiteStore) UpdateBooking(facility string, bk Booking) error {
+	participants, err := json.Marshal(participantsOrEmpty(bk.Participants))
+	if err != nil {
+		return err
+	}
+	return st.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE bookings SET facility = ?, start_day = ?, start_hour = ?, start_minute = ?,
+			end_day = ?, end_hour = ?, end_minute = ?, participants = ? WHERE confirmation_id = ?`,
+			facility,
+			bk.StartDay, bk.StartHour, bk.StartMinute,
+			bk.EndDay, bk.EndHour, bk.EndMinute, string(participants),
+			bk.ConfirmationID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("booking %s not found in store", bk.ConfirmationID)
+		}
+		return nil
+	})
+}
+
+func (st *SQLiteStore) DeleteBooking(confID string) error {
+	return st.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM bookings WHERE confirmation_id = ?`, confID)
+		return err
+	})
+}
+
+func (st *SQLiteStore) RenameFacility(oldName, newName string) error {
+	return st.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`INSERT INTO facilities(name) VALUES (?)`, newName); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE bookings SET facility = ? WHERE facility = ?`, newName, oldName); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM facilities WHERE name = ?`, oldName)
+		return err
+	})
+}
+
+func (st *SQLiteStore) DeleteFacility(name string) error {
+	return st.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM bookings WHERE facility = ?`, name); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM facilities WHERE name = ?`, name)
+		return err
+	})
+}
+
+func (st *SQLiteStore) Close() error {
+	return st.db.Close()
+}
+
+// inTx runs fn inside a transaction, committing on success.
+func (st *SQLiteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func participantsOrEmpty(p []string) []string {
+	if p == nil {
+		return []string{}
+	}
+	return p
+}
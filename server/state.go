@@ -5,6 +5,7 @@ import (
     "math/rand"
     "net"
     "sync"
+    "sync/atomic"
     "time"
 
     "github.com/Iyzyman/distributed-go/common"
@@ -16,7 +17,11 @@ const (
     SemanticsAtMostOnce  = "at-most-once"
 )
 
-// RequestKey identifies a (clientAddr, requestID) pair for deduplication
+// RequestKey identifies a (clientAddr, requestID) pair for deduplication.
+// Requests that carry a session token are keyed by user and client instance
+// instead, or by the token if the client sent no instance ID (see
+// historyClient), so a changed client address does not defeat at-most-once,
+// and neither does a new session of the same client run.
 type RequestKey struct {
     Addr      string
     RequestID uint64
@@ -36,52 +41,236 @@ type Booking struct {
     EndHour   uint8 // 0..23
     EndMinute uint8 // 0..59
     Participants []string
+
+    // Set while a booking of a facility that requires approval waits for
+    // the admin. It holds its time until PendingUntil and is not written to
+    // the store until approved.
+    Pending      bool
+    PendingUntil time.Time
+    RequestedBy  string // session user that booked, if any
 }
 
 // FacilityInfo stores everything about one facility
 type FacilityInfo struct {
-    Name     string
-    Bookings []Booking
+    Name      string
+    Bookings  []Booking
+    Blackouts []Blackout // closed periods; not kept by the store
+    ConcurrentCapacity int // bookings allowed to overlap (0 means 1); from the config, not the store
+    RequiresApproval bool  // new bookings wait for the admin; from the config, not the store
 }
 // MonitorRegistration holds callback info for a monitoring client
 type MonitorRegistration struct {
-    ClientAddr   *net.UDPAddr
+    ClientAddr   Peer
+    Namespace    string
     FacilityName string
     ExpiresAt    time.Time
+    Seq          uint64                // sequence number of the last callback sent
+    Recent       []common.ReplyMessage // last -callbackBuffer callbacks, for resends
+    Days         []uint8               // days watched; empty means all days
+    Events       uint8                 // common.Event* bits wanted; 0 means all
+    Token        string                // lets OpRebindMonitor move the subscription
+    User         string                // session user that registered, if any
+    Failures     int                   // callbacks the socket refused to send
+}
+
+// sameSubscriber reports whether a registration for facility of namespace
+// ns from addr, in a session of user if set, concerns this subscription.
+func (m *MonitorRegistration) sameSubscriber(ns, facility string, addr Peer, user string) bool {
+    if m.Namespace != ns || m.FacilityName != facility {
+        return false
+    }
+    return m.ClientAddr.String() == addr.String() || (user != "" && m.User == user)
+}
+
+// wantsEvent reports whether the subscription receives an event type.
+// Events the server cannot classify reach every subscription.
+func (m *MonitorRegistration) wantsEvent(event uint8) bool {
+    return m.Events == 0 || event == 0 || m.Events&event != 0
+}
+
+// wantsDays reports whether a mutation touching days concerns the
+// subscription. A mutation with no known days reaches every subscription.
+func (m *MonitorRegistration) wantsDays(days []uint8) bool {
+    if len(m.Days) == 0 || len(days) == 0 {
+        return true
+    }
+    for _, d := range days {
+        for _, w := range m.Days {
+            if d == w {
+                return true
+            }
+        }
+    }
+    return false
 }
 
 // ServerState holds all the data the server needs to operate
 type ServerState struct {
     semantics string              // "at-least-once" or "at-most-once"
-    conn      *net.UDPConn        // For sending replies/callbacks
+    started   time.Time           // when the server started, for OpGetServerInfo
+    // Semantics a request may select with its header hint (besides semantics)
+    allowedSemantics map[string]bool
+    conn      *net.UDPConn        // UDP listening socket
 
     // Deduplication history for at-most-once
-    history     map[RequestKey]common.ReplyMessage
-    historyLock sync.Mutex
+    history    HistoryCache
+    historyTTL time.Duration
+
+    // At-most-once requests currently executing, so concurrent duplicates
+    // do not run twice; inflightPolicy is "wait" or "drop"
+    inflight       map[RequestKey]*inflightCall
+    inflightLock   sync.Mutex
+    inflightPolicy string
+
+    // Recently seen requests, to count re-executions under at-least-once
+    recent *recentRequests
 
-    // Facility data (in-memory store)
-    facilityData map[string]*FacilityInfo
-    dataLock     sync.Mutex
+    // Facility data (in-memory store), by namespace and then by name.
+    // Operations that only read it take dataLock.RLock, so queries run in
+    // parallel; every mutation, including the search half of a change,
+    // holds the write lock throughout.
+    facilityData map[string]map[string]*FacilityInfo
+    dataLock     sync.RWMutex
+    // The facility names by canonical case, for lookups and suggestions
+    facilityNames *facilityIndex
+    // Current time within the week for the in-progress checks (nil = off)
+    clock WeekClock
+    // How long ago a new or moved booking may have ended
+    pastGrace time.Duration
+    // What happens to the bookings when the week starts again (nil = keep)
+    rollover *weekRollover
+    // Numbered recent mutations, for delta queries
+    changes *changeJournal
+    // Confirmation IDs for new bookings (-idFormat)
+    newID IDGenerator
+    // Bookings by client idempotency key, guarded by dataLock
+    idempotency *idempotencyKeys
+    // Old facility names, qualified by namespace in canonical case, and what
+    // they were renamed to, guarded by dataLock; requests using one are told
+    // the new name for renameGrace
+    renamed     map[string]facilityRename
+    renameGrace time.Duration
+    // How long a booking pending approval holds its time
+    approvalTTL time.Duration
+
+    // Persistence backend; every mutation is written through
+    store Store
 
     // Monitoring subscriptions
     monitorSubs []MonitorRegistration
+    // Callbacks kept per subscription for OpResendCallbacks
+    callbackBuffer int
+    // Longest monitor period granted; longer requests are capped
+    maxMonitorPeriod time.Duration
+    // Fraction of callbacks sent twice, for testing client deduplication
+    dupCallbackRate float64
     monitorLock sync.Mutex
+
+    // Outbound webhooks (nil when none are configured)
+    webhooks *WebhookNotifier
+
+    // Operations slower than this are logged with a lock-wait breakdown
+    slowOpThreshold time.Duration
+
+    // Largest accepted request payload in bytes (-maxRequestSize)
+    maxRequestSize int
+
+    // Reply Data at least this long is gzip-compressed for clients that
+    // advertise support (-compressThreshold; 0 = never)
+    compressThreshold int
+
+    // Log a hex dump of every packet received and reply sent (-debug)
+    debugPackets bool
+
+    // Accepted clock difference for request timestamps (0 = not checked)
+    maxSkew time.Duration
+
+    // Added to the local clock wherever the server reads the time
+    // (-clockOffset), to demonstrate clock skew
+    clockOffset time.Duration
+
+    // Optional HMAC authentication / AES-GCM encryption of packets
+    security        common.PacketSecurity
+    authFailures    atomic.Uint64
+    decryptFailures atomic.Uint64
+
+    // Datagrams/frames without the protocol magic, dropped unanswered
+    badMagic atomic.Uint64
+    // Packets whose handler panicked, answered with StatusInternal
+    panics atomic.Uint64
+    // Sources blocked for sending malformed packets (nil = -abuseThreshold off)
+    abuse *abuseTracker
+    // Keepalive callbacks sent to monitoring clients
+    keepalivesSent atomic.Uint64
+
+    // Admission control: packets being handled, the thresholds past which
+    // new ones get a busy reply, and how many did
+    inFlight    atomic.Int64
+    overload    overloadLimits
+    busyReplies atomic.Uint64
+    // Worker pool with per-class queues (-workers; nil = a goroutine per packet)
+    scheduler *packetScheduler
+
+    // Registered users and their session tokens (token -> session)
+    users       map[string]UserAccount
+    sessions    map[string]*Session
+    sessionIdle time.Duration // idle time before a token expires (0 = never)
+    adminUser   string        // user allowed to call privileged ops ("" = nobody)
+    sessionLock sync.Mutex
+
+    // Replication: role is "primary" or "backup"; replicator is nil when
+    // running standalone
+    role       string
+    replicator *Replicator
 }
 
-// NewServerState initializes everything
-func NewServerState(semantics string) *ServerState {
+// NewServerState initializes everything and loads facility data from the store
+func NewServerState(semantics string, store Store, history HistoryCache) (*ServerState, error) {
+    loaded, err := store.LoadAll()
+    if err != nil {
+        return nil, err
+    }
+    facilities := partitionFacilities(loaded)
+
     srv := &ServerState{
-        semantics:    semantics,
-        history:      make(map[RequestKey]common.ReplyMessage),
-        facilityData: make(map[string]*FacilityInfo),
-        monitorSubs:  make([]MonitorRegistration, 0),
+        semantics:      semantics,
+        started:        time.Now(),
+        role:           RolePrimary,
+        history:        history,
+        inflight:       make(map[RequestKey]*inflightCall),
+        inflightPolicy: InflightWait,
+        recent:         newRecentRequests(1024),
+        facilityData:   facilities,
+        facilityNames:  newFacilityIndex(facilities),
+        store:          store,
+        monitorSubs:    make([]MonitorRegistration, 0),
+        callbackBuffer: defaultCallbackBuffer,
+        maxMonitorPeriod: defaultMaxMonitorPeriod,
+        pastGrace:      defaultPastGrace,
+        overload:       overloadLimits{retryAfter: defaultBusyRetryAfter},
+        changes:        newChangeJournal(defaultChangeJournal),
+        newID:          legacyID,
+        idempotency:    newIdempotencyKeys(defaultIdempotencyWindow),
+        renamed:        make(map[string]facilityRename),
+        renameGrace:    defaultRenameGrace,
+        approvalTTL:    defaultApprovalTTL,
+        maxRequestSize: common.DefaultMaxRequestSize,
+        compressThreshold: common.DefaultCompressThreshold,
+        users:          make(map[string]UserAccount),
+        sessions:       make(map[string]*Session),
     }
 
     // Seed random for demonstration (e.g. for generating booking IDs)
     rand.Seed(time.Now().UnixNano())
 
-    // Seed some example facilities & bookings
-    srv.facilityData["RoomA"] = &FacilityInfo{
+    return srv, nil
+}
+
+// seedFacilities returns some example facilities & bookings
+func seedFacilities() map[string]*FacilityInfo {
+    facilities := make(map[string]*FacilityInfo)
+
+    facilities["RoomA"] = &FacilityInfo{
         Name: "RoomA",
         Bookings: []Booking{
             {
@@ -105,7 +294,7 @@ func NewServerState(semantics string) *ServerState {
         },
     }
 
-    srv.facilityData["Lab1"] = &FacilityInfo{
+    facilities["Lab1"] = &FacilityInfo{
         Name: "Lab1",
         Bookings: []Booking{
             {
@@ -120,5 +309,5 @@ func NewServerState(semantics string) *ServerState {
         },
     }
 
-    return srv
+    return facilities
 }
@@ -0,0 +1,77 @@
+// server/store.go
+package main
+
+import "fmt"
+
+// Store persists facility and booking data. The in-memory facilityData map on
+// ServerState remains the read path; every successful mutation is written
+// through to the store so that a restart can reload it with LoadAll.
+// Facilities outside the default namespace are stored under their qualified
+// name (see qualify).
+type Store interface {
+	// LoadFacilities returns the names of all known facilities.
+	LoadFacilities() ([]string, error)
+	// LoadAll returns every facility together with its bookings.
+	LoadAll() (map[string]*FacilityInfo, error)
+	// SaveFacility records a facility (without bookings).
+	SaveFacility(name string) error
+	// SaveBooking inserts a new booking into a facility.
+	SaveBooking(facility string, bk Booking) error
+	// UpdateBooking replaces the stored booking with the same ConfirmationID.
+	UpdateBooking(facility string, bk Booking) error
+	// DeleteBooking removes the booking with the given ConfirmationID.
+	DeleteBooking(confID string) error
+	// RenameFacility gives a facility and all its bookings a new name.
+	RenameFacility(oldName, newName string) error
+	// DeleteFacility removes a facility together with its bookings.
+	DeleteFacility(name string) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Store backends selectable with -store
+const (
+	StoreMemory = "memory"
+	StoreSQLite = "sqlite"
+)
+
+// OpenStore creates the backend named by kind.
+func OpenStore(kind, dbPath string) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreSQLite:
+		return NewSQLiteStore(dbPath)
+	default:
+		return nil, fmt.Errorf("unknown store %q (choose %q or %q)", kind, StoreMemory, StoreSQLite)
+	}
+}
+
+// MemoryStore keeps nothing beyond the process lifetime. LoadAll hands back
+// the demo seed data so a fresh server starts with the usual facilities.
+type MemoryStore struct{}
+
+// NewMemoryStore returns the default, non-persistent store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) LoadFacilities() ([]string, error) {
+	names := make([]string, 0)
+	for name := range seedFacilities() {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m *MemoryStore) LoadAll() (map[string]*FacilityInfo, error) {
+	return seedFacilities(), nil
+}
+
+func (m *MemoryStore) SaveFacility(name string) error                  { return nil }
+func (m *MemoryStore) SaveBooking(facility string, bk Booking) error   { return nil }
+func (m *MemoryStore) UpdateBooking(facility string, bk Booking) error { return nil }
+func (m *MemoryStore) DeleteBooking(confID string) error               { return nil }
+func (m *MemoryStore) RenameFacility(oldName, newName string) error    { return nil }
+func (m *MemoryStore) DeleteFacility(name string) error                { return nil }
+func (m *MemoryStore) Close() error                                    { return nil }
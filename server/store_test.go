@@ -0,0 +1,147 @@
+// server/store_test.go
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// storeBackend opens one kind of store in dir. Opening the same dir again
+// must see what the first store persisted, if the backend persists at all.
+type storeBackend struct {
+	name     string
+	persists bool
+	open     func(dir string) (Store, error)
+}
+
+var storeBackends = []storeBackend{
+	{StoreMemory, false, func(string) (Store, error) { return NewMemoryStore(), nil }},
+	{StoreSQLite, true, func(dir string) (Store, error) { return NewSQLiteStore(filepath.Join(dir, "bookings.db")) }},
+}
+
+// openStore opens a backend, skipping the test if this binary was built
+// without it (SQLite needs -tags sqlite).
+func openStore(t *testing.T, b storeBackend, dir string) Store {
+	t.Helper()
+	if b.name == StoreSQLite && !sqliteAvailable() {
+		t.Skip("built without SQLite; run with -tags sqlite")
+	}
+	st, err := b.open(dir)
+	if err != nil {
+		t.Fatalf("opening %s store: %v", b.name, err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func newStoreServer(t *testing.T, st Store) *ServerState {
+	t.Helper()
+	srv, err := NewServerState(SemanticsAtLeastOnce, st, NewMemoryHistory(0))
+	if err != nil {
+		t.Fatalf("NewServerState: %v", err)
+	}
+	return srv
+}
+
+func query(t *testing.T, srv *ServerState, p *fakePeer, id uint64, facility string, days ...uint8) string {
+	t.Helper()
+	rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: id, FacilityName: facility, DaysList: days})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("query %s: status %d: %s", facility, rep.Status, rep.Data)
+	}
+	return rep.Data
+}
+
+// TestHandlersOnEachStore runs the booking handlers against every store.
+func TestHandlersOnEachStore(t *testing.T) {
+	for _, b := range storeBackends {
+		t.Run(b.name, func(t *testing.T) {
+			srv := newStoreServer(t, openStore(t, b, t.TempDir()))
+			p := newFakePeer("client")
+
+			id := confirmationID(t, send(t, srv, p, bookReq(1, "RoomA", 3, 14, 15)))
+			if q := query(t, srv, p, 2, "RoomA", 3); !strings.Contains(q, id) {
+				t.Fatalf("query after booking does not list %s:\n%s", id, q)
+			}
+
+			if rep := send(t, srv, p, bookReq(3, "RoomA", 3, 14, 16)); rep.Status != common.StatusConflict {
+				t.Errorf("overlapping booking: status %d, want %d (%s)", rep.Status, common.StatusConflict, rep.Data)
+			}
+
+			rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 4, ConfirmationID: id, OffsetMinutes: 60})
+			if rep.Status != common.StatusOK {
+				t.Fatalf("change: status %d: %s", rep.Status, rep.Data)
+			}
+			rep = send(t, srv, p, common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 5, ConfirmationID: id, ParticipantName: "Ada"})
+			if rep.Status != common.StatusOK {
+				t.Fatalf("add participant: status %d: %s", rep.Status, rep.Data)
+			}
+			if q := query(t, srv, p, 6, "RoomA", 3); !strings.Contains(q, "15:00") || !strings.Contains(q, "Ada") {
+				t.Errorf("query after change does not show 15:00 with Ada:\n%s", q)
+			}
+
+			rep = send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 7, ConfirmationID: id})
+			if rep.Status != common.StatusOK {
+				t.Fatalf("cancel: status %d: %s", rep.Status, rep.Data)
+			}
+			if q := query(t, srv, p, 8, "RoomA", 3); strings.Contains(q, id) {
+				t.Errorf("query after cancel still lists %s:\n%s", id, q)
+			}
+			// Cancel is idempotent: a repeat finds nothing and says so
+			if rep := send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 9, ConfirmationID: id}); !strings.Contains(rep.Data, "not found") {
+				t.Errorf("second cancel of %s: %q, want not found", id, rep.Data)
+			}
+		})
+	}
+}
+
+// TestStoreSurvivesRestart checks that a persistent store hands a new
+// server what the old one wrote, seed data included.
+func TestStoreSurvivesRestart(t *testing.T) {
+	for _, b := range storeBackends {
+		if !b.persists {
+			continue
+		}
+		t.Run(b.name, func(t *testing.T) {
+			dir := t.TempDir()
+			st := openStore(t, b, dir)
+			srv := newStoreServer(t, st)
+			p := newFakePeer("client")
+
+			kept := confirmationID(t, send(t, srv, p, bookReq(1, "Lab1", 4, 8, 9)))
+			gone := confirmationID(t, send(t, srv, p, bookReq(2, "Lab1", 5, 8, 9)))
+			send(t, srv, p, common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 3, ConfirmationID: kept, OffsetMinutes: 30})
+			send(t, srv, p, common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 4, ConfirmationID: kept, ParticipantName: "Grace"})
+			send(t, srv, p, common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 5, ConfirmationID: gone})
+			st.Close()
+
+			srv = newStoreServer(t, openStore(t, b, dir))
+			fac := srv.facilityData[common.DefaultNamespace]["Lab1"]
+			var got *Booking
+			for i := range fac.Bookings {
+				switch fac.Bookings[i].ConfirmationID {
+				case kept:
+					got = &fac.Bookings[i]
+				case gone:
+					t.Errorf("canceled booking %s came back after the restart", gone)
+				}
+			}
+			if got == nil {
+				t.Fatalf("booking %s lost in the restart", kept)
+			}
+			if got.StartHour != 8 || got.StartMinute != 30 || got.EndHour != 9 || got.EndMinute != 30 {
+				t.Errorf("booking %s reloaded at %02d:%02d-%02d:%02d, want 08:30-09:30",
+					kept, got.StartHour, got.StartMinute, got.EndHour, got.EndMinute)
+			}
+			if len(got.Participants) != 1 || got.Participants[0] != "Grace" {
+				t.Errorf("booking %s reloaded with participants %v, want [Grace]", kept, got.Participants)
+			}
+			if _, ok := srv.facilityData[common.DefaultNamespace]["RoomA"]; !ok {
+				t.Error("seed facility RoomA missing after the restart")
+			}
+		})
+	}
+}
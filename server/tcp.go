@@ -0,0 +1,50 @@
+// server/tcp.go
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// serveTCP accepts clients on ln. Each connection carries length-prefixed
+// request frames; replies and monitor callbacks go back on the same stream.
+// It returns when ln is closed.
+func (s *ServerState) serveTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("TCP accept error: %v", err)
+			continue
+		}
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *ServerState) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+	peer := &tcpPeer{conn: conn}
+	log.Printf("TCP client connected: %s", peer)
+
+	for {
+		frame, err := common.ReadFrame(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("TCP read error from %s: %v", peer, err)
+			}
+			log.Printf("TCP client disconnected: %s", peer)
+			return
+		}
+		if len(frame) > s.maxRequestSize {
+			s.rejectTooLarge(frame, len(frame), peer)
+			continue
+		}
+		s.schedule(frame, peer, func() { s.handlePacket(frame, peer) })
+	}
+}
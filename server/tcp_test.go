@@ -0,0 +1,155 @@
+// server/tcp_test.go
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// tcpClient speaks the framed protocol on one TCP connection and keeps the
+// callbacks that arrive between replies.
+type tcpClient struct {
+	t         *testing.T
+	conn      net.Conn
+	callbacks []common.ReplyMessage
+}
+
+// startTCPServer serves srv on a loopback TCP listener until the test ends.
+func startTCPServer(t *testing.T, srv *ServerState) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go srv.serveTCP(ln)
+	return ln.Addr().String()
+}
+
+func dialTCP(t *testing.T, addr string) *tcpClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &tcpClient{t: t, conn: conn}
+}
+
+// next reads one frame.
+func (c *tcpClient) next() common.ReplyMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frame, err := common.ReadFrame(c.conn)
+	if err != nil {
+		c.t.Fatalf("reading frame: %v", err)
+	}
+	rep, err := common.UnmarshalReply(frame)
+	if err != nil {
+		c.t.Fatalf("UnmarshalReply: %v", err)
+	}
+	return rep
+}
+
+// do sends req and returns its reply.
+func (c *tcpClient) do(req common.RequestMessage) common.ReplyMessage {
+	c.t.Helper()
+	raw, err := common.MarshalRequest(req)
+	if err != nil {
+		c.t.Fatalf("MarshalRequest: %v", err)
+	}
+	if err := common.WriteFrame(c.conn, raw); err != nil {
+		c.t.Fatalf("WriteFrame: %v", err)
+	}
+	for {
+		rep := c.next()
+		if rep.OpCode == common.OpCallback {
+			c.callbacks = append(c.callbacks, rep)
+			continue
+		}
+		if rep.RequestID != req.RequestID {
+			c.t.Fatalf("reply to RequestID %d while waiting for %d", rep.RequestID, req.RequestID)
+		}
+		return rep
+	}
+}
+
+// TestHandlersOverTCP runs the booking handlers end to end over TCP, with a
+// monitor on a second connection receiving its callbacks on that stream.
+func TestHandlersOverTCP(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	addr := startTCPServer(t, srv)
+	c := dialTCP(t, addr)
+	watcher := dialTCP(t, addr)
+
+	rep := watcher.do(common.RequestMessage{OpCode: common.OpMonitorAvailability, RequestID: 1, FacilityName: "RoomA", MonitorPeriod: 60})
+	if rep.Status != common.StatusOK {
+		t.Fatalf("monitor: status %d: %s", rep.Status, rep.Data)
+	}
+
+	rep = c.do(bookReq(1, "RoomA", 3, 14, 15))
+	id := confirmationID(t, rep)
+	if rep := c.do(bookReq(2, "RoomA", 3, 14, 16)); rep.Status != common.StatusConflict {
+		t.Errorf("overlapping booking: status %d, want %d", rep.Status, common.StatusConflict)
+	}
+	rep = c.do(common.RequestMessage{OpCode: common.OpQueryAvailability, RequestID: 3, FacilityName: "RoomA", DaysList: []uint8{3}})
+	if rep.Status != common.StatusOK || !strings.Contains(rep.Data, id) {
+		t.Errorf("query does not list %s: status %d:\n%s", id, rep.Status, rep.Data)
+	}
+	rep = c.do(common.RequestMessage{OpCode: common.OpChangeBooking, RequestID: 4, ConfirmationID: id, OffsetMinutes: 60})
+	if rep.Status != common.StatusOK {
+		t.Errorf("change: status %d: %s", rep.Status, rep.Data)
+	}
+	rep = c.do(common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 5, ConfirmationID: id, ParticipantName: "Ada"})
+	if rep.Status != common.StatusOK {
+		t.Errorf("add participant: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// A retransmission on the same stream is deduplicated under
+	// at-most-once: the participant is not added twice
+	again := c.do(common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 5, ConfirmationID: id, ParticipantName: "Ada"})
+	if again.Data != rep.Data {
+		t.Errorf("duplicate AddParticipant got %q, want the cached %q", again.Data, rep.Data)
+	}
+
+	rep = c.do(common.RequestMessage{OpCode: common.OpCancelBooking, RequestID: 6, ConfirmationID: id})
+	if rep.Status != common.StatusOK {
+		t.Errorf("cancel: status %d: %s", rep.Status, rep.Data)
+	}
+
+	// book, change, add participant and cancel each reach the watcher
+	for len(watcher.callbacks) < 4 {
+		if cb := watcher.next(); cb.OpCode == common.OpCallback {
+			watcher.callbacks = append(watcher.callbacks, cb)
+		}
+	}
+	for i, cb := range watcher.callbacks {
+		if !strings.Contains(cb.Data, id) {
+			t.Errorf("callback %d does not name %s: %q", i, id, cb.Data)
+		}
+	}
+	if len(c.callbacks) != 0 {
+		t.Errorf("the booking client, which monitors nothing, got %d callbacks", len(c.callbacks))
+	}
+}
+
+// TestTCPRejectsOversizedFrame checks that a frame over the request limit
+// is answered with an error and the connection keeps working.
+func TestTCPRejectsOversizedFrame(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.maxRequestSize = 256
+	c := dialTCP(t, startTCPServer(t, srv))
+
+	big := bookReq(1, "RoomA", 3, 14, 15)
+	big.IdempotencyKey = strings.Repeat("x", 512)
+	if rep := c.do(big); rep.Status != common.StatusTooLarge {
+		t.Fatalf("oversized request: status %d, want %d: %s", rep.Status, common.StatusTooLarge, rep.Data)
+	}
+	if rep := c.do(bookReq(2, "RoomA", 3, 14, 15)); rep.Status != common.StatusOK {
+		t.Errorf("request after the oversized one: status %d: %s", rep.Status, rep.Data)
+	}
+}
@@ -0,0 +1,84 @@
+// server/text_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// TestControlCharactersRejected sends escape sequences, newlines and
+// invalid UTF-8 in the string fields of different operations. Each is
+// refused as an invalid argument, with the field named, and none of the
+// payload reaches the log unescaped.
+func TestControlCharactersRejected(t *testing.T) {
+	payloads := []string{"A\x1b[2J\x1b[31m", "A\n2026/01/01 00:00:00 forged", "A\xff"}
+	fields := []struct {
+		field string
+		req   func(bad string) common.RequestMessage
+	}{
+		{"FacilityName", func(bad string) common.RequestMessage {
+			return common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: bad}
+		}},
+		{"ParticipantName", func(bad string) common.RequestMessage { return addParticipant(0, bad) }},
+		{"ConfirmationID", func(bad string) common.RequestMessage {
+			return common.RequestMessage{OpCode: common.OpCancelBooking, ConfirmationID: bad}
+		}},
+		{"IdempotencyKey", func(bad string) common.RequestMessage {
+			req := bookReq(0, "Lab1", 4, 9, 10)
+			req.IdempotencyKey = bad
+			return req
+		}},
+		{"Username", func(bad string) common.RequestMessage {
+			return common.RequestMessage{OpCode: common.OpRegisterUser, Username: bad, Password: "pw"}
+		}},
+		{"MoreFacilities[0]", func(bad string) common.RequestMessage {
+			return common.RequestMessage{OpCode: common.OpQueryAvailability, FacilityName: "RoomA", MoreFacilities: []string{bad}}
+		}},
+	}
+	logs := captureLogs(t, LogFormatText)
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	id := uint64(0)
+	for _, f := range fields {
+		for _, bad := range payloads {
+			id++
+			req := f.req(bad)
+			req.RequestID = id
+			rep := send(t, srv, p, req)
+			if rep.Status != common.StatusInvalidArgument || !strings.Contains(rep.Data, f.field+" ") {
+				t.Errorf("%q in %s: status %d: %s", bad, f.field, rep.Status, rep.Data)
+			}
+			if !common.IsPlainText(rep.Data) {
+				t.Errorf("%q in %s: reply %q repeats it", bad, f.field, rep.Data)
+			}
+		}
+	}
+	for _, bad := range payloads {
+		if strings.Contains(logs.String(), bad) {
+			t.Errorf("log holds %q unescaped", bad)
+		}
+	}
+	if participants(srv) != "" {
+		t.Errorf("participant added: %s", participants(srv))
+	}
+}
+
+// TestStoredNamesEscaped: names that predate the check are escaped where a
+// query interpolates them.
+func TestStoredNamesEscaped(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.dataLock.Lock()
+	fac := srv.facilityData[common.DefaultNamespace]["RoomA"]
+	fac.Bookings[0].Participants = []string{"Ada\nDay 6:\n  BKG-FAKE", "\x1b[2JBob"}
+	srv.dataLock.Unlock()
+
+	got := queryData(t, srv, 1, []uint8{0}, "RoomA")
+	if !common.IsPlainText(strings.ReplaceAll(got, "\n", "")) || strings.Contains(got, "\nDay 6") {
+		t.Errorf("query output carries the raw names:\n%q", got)
+	}
+	if !strings.Contains(got, `Ada\nDay 6:\n  BKG-FAKE`) || !strings.Contains(got, `\x1b[2JBob`) {
+		t.Errorf("escaped names missing:\n%s", got)
+	}
+}
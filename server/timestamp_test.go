@@ -0,0 +1,95 @@
+// server/timestamp_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func TestTimestampWindow(t *testing.T) {
+	const maxSkew = 30 * time.Second
+	tests := []struct {
+		name    string
+		maxSkew time.Duration
+		skew    time.Duration // client clock minus server clock; 0 with noTS
+		noTS    bool
+		want    int32
+	}{
+		{"in step", maxSkew, 0, false, common.StatusOK},
+		{"behind within window", maxSkew, -29 * time.Second, false, common.StatusOK},
+		{"ahead within window", maxSkew, 29 * time.Second, false, common.StatusOK},
+		{"behind past window", maxSkew, -31 * time.Second, false, common.StatusStaleRequest},
+		{"ahead past window", maxSkew, 31 * time.Second, false, common.StatusStaleRequest},
+		{"no timestamp", maxSkew, 0, true, common.StatusStaleRequest},
+		{"window disabled", 0, -time.Hour, false, common.StatusOK},
+		{"window disabled, no timestamp", 0, 0, true, common.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			srv.maxSkew = tt.maxSkew
+			req := bookReq(1, "RoomA", 3, 9, 10)
+			if !tt.noTS {
+				req.Timestamp = srv.now().Add(tt.skew).UnixMilli()
+			}
+			rep := send(t, srv, newFakePeer("client"), req)
+			if rep.Status != tt.want {
+				t.Fatalf("status %d, want %d: %s", rep.Status, tt.want, rep.Data)
+			}
+			if rep.Status != common.StatusStaleRequest {
+				return
+			}
+			// The rejection tells the client the server's time
+			serverNow, ok := common.ParseServerTime(rep.Data)
+			if !ok {
+				t.Fatalf("no server time in %q", rep.Data)
+			}
+			if d := srv.now().Sub(serverNow); d < 0 || d > time.Second {
+				t.Errorf("reported server time is %v off", d)
+			}
+		})
+	}
+}
+
+// TestRetransmissionKeepsTimestamp follows a request whose reply is lost:
+// the client resends the same bytes, timestamp included. Within the window
+// the resend is answered from the history; after it, the resend is refused
+// as stale and not cached, so a fresh timestamp still gets the original
+// result instead of executing again.
+func TestRetransmissionKeepsTimestamp(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.maxSkew = 30 * time.Second
+	p := newFakePeer("client")
+
+	req := common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: 1, ConfirmationID: "BKG-10000", ParticipantName: "Ada"}
+	req.Timestamp = srv.now().UnixMilli()
+	first := send(t, srv, p, req)
+	if first.Status != common.StatusOK {
+		t.Fatalf("first attempt: status %d: %s", first.Status, first.Data)
+	}
+
+	if rep := send(t, srv, p, req); rep.Data != first.Data {
+		t.Errorf("resend within the window got %q, want the cached %q", rep.Data, first.Data)
+	}
+
+	srv.clockOffset = time.Minute // the resend arrives late
+	if rep := send(t, srv, p, req); rep.Status != common.StatusStaleRequest {
+		t.Fatalf("late resend: status %d, want stale: %s", rep.Status, rep.Data)
+	}
+
+	req.Timestamp = srv.now().UnixMilli()
+	if rep := send(t, srv, p, req); rep.Data != first.Data {
+		t.Errorf("resend with a fresh timestamp got %q, want the cached %q", rep.Data, first.Data)
+	}
+
+	srv.dataLock.RLock()
+	_, fac, i, _ := srv.findBooking(common.DefaultNamespace, "BKG-10000")
+	participants := fac.Bookings[i].Participants
+	srv.dataLock.RUnlock()
+	if n := strings.Count(strings.Join(participants, ","), "Ada"); n != 1 {
+		t.Errorf("Ada added %d times, want once", n)
+	}
+}
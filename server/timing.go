@@ -0,0 +1,61 @@
+// server/timing.go
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// opTiming measures one processOperation call. Handlers acquire their
+// locks through lock so the time spent waiting can be told apart from the
+// time spent working. It also carries the request field a handler
+// rejected, for the error echo.
+type opTiming struct {
+	start    time.Time
+	lockWait time.Duration
+	badField string
+	badValue string
+}
+
+// reject notes the request field that made the operation fail, so the
+// error reply can echo it.
+func (t *opTiming) reject(field string, value any) {
+	t.badField = field
+	t.badValue = fmt.Sprint(value)
+}
+
+// lock acquires mu and adds the wait to the request's lock-wait total.
+func (t *opTiming) lock(mu sync.Locker) {
+	waitStart := time.Now()
+	lockWaiters.Add(1)
+	mu.Lock()
+	lockWaiters.Add(-1)
+	t.lockWait += time.Since(waitStart)
+}
+
+// rlock read-locks mu, for operations that only look at the data, and adds
+// the wait to the request's lock-wait total.
+func (t *opTiming) rlock(mu *sync.RWMutex) {
+	t.lock(mu.RLocker())
+}
+
+// finishTiming records the duration of an operation in the latency
+// histogram and logs a warning if it exceeded -slowOpThreshold.
+func (s *ServerState) finishTiming(req common.RequestMessage, t *opTiming) {
+	total := time.Since(t.start)
+	observeLatency(total)
+	if s.slowOpThreshold <= 0 || total < s.slowOpThreshold {
+		return
+	}
+	slog.Warn("Slow operation",
+		"opcode", common.OpName(req.OpCode),
+		"facility", req.FacilityName,
+		"requestID", req.RequestID,
+		"duration", total,
+		"lockWait", t.lockWait,
+		"processing", total-t.lockWait)
+}
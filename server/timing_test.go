@@ -0,0 +1,122 @@
+// server/timing_test.go
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// slowOps returns the "Slow operation" events in JSON log output.
+func slowOps(t *testing.T, logs string) []map[string]any {
+	t.Helper()
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if entry["msg"] == "Slow operation" {
+			events = append(events, entry)
+		}
+	}
+	return events
+}
+
+// duration reads a duration field of a JSON log event.
+func duration(event map[string]any, field string) time.Duration {
+	ns, _ := event[field].(float64)
+	return time.Duration(ns)
+}
+
+func TestSlowOperationLogged(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		slowSave  bool
+		wantLog   bool
+	}{
+		{"slow handler", 20 * time.Millisecond, true, true},
+		{"fast handler", 20 * time.Millisecond, false, false},
+		{"threshold disabled", 0, true, false},
+		{"under the threshold", time.Second, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t, LogFormatJSON)
+			srv := newHookServer(t, SemanticsAtMostOnce, func(string, Booking) {
+				if tt.slowSave {
+					time.Sleep(delay)
+				}
+			})
+			srv.slowOpThreshold = tt.threshold
+
+			if rep := send(t, srv, newFakePeer("client"), bookReq(5, "RoomA", 3, 9, 10)); rep.Status != common.StatusOK {
+				t.Fatalf("booking: status %d: %s", rep.Status, rep.Data)
+			}
+			events := slowOps(t, logs.String())
+			if !tt.wantLog {
+				if len(events) != 0 {
+					t.Errorf("logged %v", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("%d slow operation events, want 1", len(events))
+			}
+			ev := events[0]
+			if ev["level"] != "WARN" || ev["opcode"] != "BookFacility" || ev["facility"] != "RoomA" || ev["requestID"] != 5.0 {
+				t.Errorf("event = %v", ev)
+			}
+			if p := duration(ev, "processing"); p < delay {
+				t.Errorf("processing = %v, want the %v spent in the store", p, delay)
+			}
+			if w := duration(ev, "lockWait"); w >= delay {
+				t.Errorf("lockWait = %v with no contention", w)
+			}
+		})
+	}
+}
+
+// TestSlowOperationLockWait holds the data lock while a booking arrives:
+// the time shows up as lock wait, not processing.
+func TestSlowOperationLockWait(t *testing.T) {
+	const hold = 30 * time.Millisecond
+	logs := captureLogs(t, LogFormatJSON)
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	srv.slowOpThreshold = 20 * time.Millisecond
+
+	srv.dataLock.Lock()
+	go func() {
+		time.Sleep(hold)
+		srv.dataLock.Unlock()
+	}()
+	send(t, srv, newFakePeer("client"), bookReq(1, "RoomA", 3, 9, 10))
+
+	events := slowOps(t, logs.String())
+	if len(events) != 1 {
+		t.Fatalf("%d slow operation events, want 1", len(events))
+	}
+	if w := duration(events[0], "lockWait"); w < hold {
+		t.Errorf("lockWait = %v, want at least %v", w, hold)
+	}
+	if p := duration(events[0], "processing"); p >= hold {
+		t.Errorf("processing = %v, want the lock wait left out", p)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	count := func() int64 { return metricLatencyUs.Get("count").(*expvar.Int).Value() }
+	send(t, srv, newFakePeer("client"), bookReq(1, "RoomA", 3, 9, 10))
+	before := count()
+	send(t, srv, newFakePeer("client"), bookReq(2, "RoomA", 3, 10, 11))
+	if got := count() - before; got != 1 {
+		t.Errorf("histogram count grew by %d, want 1", got)
+	}
+}
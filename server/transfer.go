@@ -0,0 +1,79 @@
+// server/transfer.go
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// handleTransferBooking moves a booking to another facility, keeping its
+// confirmation ID, time and participants. The target is checked and the
+// booking moved under one write lock, so nobody can take the time in the
+// target, or the freed time in the source, half way through. A conflict
+// leaves both facilities as they were.
+func (s *ServerState) handleTransferBooking(req common.RequestMessage, t *opTiming) (string, int32) {
+	confID, target := req.ConfirmationID, req.FacilityName
+	log.Printf("Handling TransferBooking of '%s' to facility '%s'", confID, target)
+
+	t.lock(&s.dataLock)
+	defer s.dataLock.Unlock()
+
+	srcName, src, index, ok := s.findBooking(req.Namespace, confID)
+	if !ok {
+		log.Printf("Booking '%s' not found in TransferBooking", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Error: Booking %s not found", confID), -1
+	}
+	bk := src.Bookings[index]
+	if bk.Pending {
+		return refusePending(bk, t)
+	}
+
+	dst, ok := s.facilityData[req.Namespace][target]
+	if !ok {
+		log.Printf("Facility '%s' not found in TransferBooking", target)
+		t.reject("FacilityName", target)
+		return "Error: " + s.facilityNotFound(req.Namespace, target), -1
+	}
+	if dst == src {
+		t.reject("FacilityName", target)
+		return fmt.Sprintf("Booking %s is already in '%s'", confID, target), common.StatusInvalidArgument
+	}
+	if dst.RequiresApproval && !src.RequiresApproval {
+		t.reject("FacilityName", target)
+		return fmt.Sprintf("Facility '%s' requires approval; book it instead of moving a booking there", target), common.StatusInvalidArgument
+	}
+	if status, started := s.bookingStarted(bk); started {
+		log.Printf("Refusing to transfer booking '%s': it has already started", confID)
+		t.reject("ConfirmationID", confID)
+		return fmt.Sprintf("Booking %s has already started (now %s) and cannot be moved", confID, formatWeekMinutes(s.clock())), status
+	}
+
+	window := bk.interval()
+	if !dst.hasRoom(window) {
+		log.Printf("Time conflict in '%s' when transferring booking '%s'", target, confID)
+		return dst.bookingConflict(), 1
+	}
+	if b, closed := dst.blackoutOverlapping(window.Start, window.End); closed {
+		log.Printf("Transferring booking '%s' would move it into a blackout of '%s'", confID, target)
+		return blackoutConflict(b), 1
+	}
+
+	// The store moves the row in one statement, so it never holds the
+	// booking in both facilities or in neither
+	if err := s.store.UpdateBooking(qualify(req.Namespace, target), bk); err != nil {
+		log.Printf("Failed to persist transfer of booking '%s': %v", confID, err)
+		return "Error: could not save booking transfer.", -1
+	}
+	src.Bookings = append(src.Bookings[:index], src.Bookings[index+1:]...)
+	dst.Bookings = append(dst.Bookings, bk)
+
+	msg := fmt.Sprintf("Booking %s moved from %s to %s", confID, srcName, target)
+	days := affectedDays(bk)
+	s.notifySubscribers(req.Namespace, srcName, EventBookingChanged, confID, msg, days)
+	s.notifySubscribers(req.Namespace, target, EventBookingChanged, confID, msg, days)
+	log.Printf("TransferBooking successful: %s", msg)
+	return fmt.Sprintf("Moved booking %s from '%s' to '%s'.", confID, srcName, target), 0
+}
@@ -0,0 +1,146 @@
+// server/transfer_test.go
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// failingUpdates is a memory store whose booking updates fail.
+type failingUpdates struct {
+	Store
+}
+
+func (failingUpdates) UpdateBooking(string, Booking) error { return errors.New("disk full") }
+
+func transferReq(id uint64, confID, target string) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpTransferBooking, RequestID: id, ConfirmationID: confID, FacilityName: target}
+}
+
+// bookingsIn returns the confirmation IDs of a facility's bookings.
+func bookingsIn(srv *ServerState, facility string) string {
+	srv.dataLock.RLock()
+	defer srv.dataLock.RUnlock()
+	var ids []string
+	for _, bk := range srv.facilityData[common.DefaultNamespace][facility].Bookings {
+		ids = append(ids, bk.ConfirmationID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestTransferBooking(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	p := newFakePeer("client")
+	send(t, srv, p, addParticipant(1, "Ada"))
+	start, end := bookingInterval(t, srv, "BKG-10000")
+
+	rep := send(t, srv, p, transferReq(2, "BKG-10000", "Lab1"))
+	if rep.Status != common.StatusOK || rep.Data != "Moved booking BKG-10000 from 'RoomA' to 'Lab1'." {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	if got := bookingsIn(srv, "RoomA"); got != "BKG-10001" {
+		t.Errorf("RoomA holds %s after the transfer", got)
+	}
+	if got := bookingsIn(srv, "Lab1"); got != "BKG-20000,BKG-10000" {
+		t.Errorf("Lab1 holds %s after the transfer", got)
+	}
+	if s, e := bookingInterval(t, srv, "BKG-10000"); s != start || e != end {
+		t.Errorf("transfer moved the time to %d-%d", s, e)
+	}
+	if got := participants(srv); got != "Ada" {
+		t.Errorf("participants after the transfer: %q", got)
+	}
+
+	// The freed time in RoomA can be booked again
+	confirmationID(t, send(t, srv, p, bookReq(3, "RoomA", 0, 9, 10)))
+}
+
+// TestTransferConflict: a target that is taken or closed, or a refused
+// request, leaves both facilities as they were.
+func TestTransferConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, srv *ServerState, p *fakePeer)
+		req    common.RequestMessage
+		status int32
+		reply  string
+	}{
+		{"taken", func(t *testing.T, srv *ServerState, p *fakePeer) {
+			confirmationID(t, send(t, srv, p, bookReq(1, "Lab1", 0, 8, 10)))
+		}, transferReq(2, "BKG-10000", "Lab1"), 1, "Time conflict"},
+		{"unknown booking", nil, transferReq(2, "BKG-99999", "Lab1"), -1, "not found"},
+		{"unknown facility", nil, transferReq(2, "BKG-10000", "Gym"), -1, "Gym"},
+		{"same facility", nil, transferReq(2, "BKG-10000", "RoomA"), common.StatusInvalidArgument, "already in 'RoomA'"},
+		{"started", func(t *testing.T, srv *ServerState, p *fakePeer) {
+			srv.clock = fixedWeekClock(9*60 + 30)
+		}, transferReq(2, "BKG-10000", "Lab1"), common.StatusInProgress, "already started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, SemanticsAtMostOnce)
+			p := newFakePeer("client")
+			if tt.setup != nil {
+				tt.setup(t, srv, p)
+			}
+			roomA, lab1 := bookingsIn(srv, "RoomA"), bookingsIn(srv, "Lab1")
+			rep := send(t, srv, p, tt.req)
+			if rep.Status != tt.status || !strings.Contains(rep.Data, tt.reply) {
+				t.Errorf("status %d: %s; want %d and %q", rep.Status, rep.Data, tt.status, tt.reply)
+			}
+			if bookingsIn(srv, "RoomA") != roomA || bookingsIn(srv, "Lab1") != lab1 {
+				t.Errorf("refused transfer changed the facilities: RoomA %s, Lab1 %s", bookingsIn(srv, "RoomA"), bookingsIn(srv, "Lab1"))
+			}
+		})
+	}
+}
+
+// TestTransferRollback: when the store cannot save the move, the booking
+// stays where it was and nobody is told it moved.
+func TestTransferRollback(t *testing.T) {
+	srv, err := NewServerState(SemanticsAtMostOnce, failingUpdates{NewMemoryStore()}, NewMemoryHistory(0))
+	if err != nil {
+		t.Fatalf("NewServerState: %v", err)
+	}
+	watcher := newFakePeer("watcher")
+	send(t, srv, watcher, monitorReq(1, nil, 0))
+	rep := send(t, srv, newFakePeer("client"), transferReq(2, "BKG-10000", "Lab1"))
+	if rep.Status == common.StatusOK || !strings.Contains(rep.Data, "could not save") {
+		t.Fatalf("status %d: %s", rep.Status, rep.Data)
+	}
+	if bookingsIn(srv, "RoomA") != "BKG-10000,BKG-10001" || bookingsIn(srv, "Lab1") != "BKG-20000" {
+		t.Errorf("failed transfer changed the facilities: RoomA %s, Lab1 %s", bookingsIn(srv, "RoomA"), bookingsIn(srv, "Lab1"))
+	}
+	if n := len(watcher.callbacks()); n != 0 {
+		t.Errorf("%d callbacks for a transfer that did not happen", n)
+	}
+}
+
+// TestTransferNotifiesBoth: monitors of the source and of the target
+// each hear about the move once.
+func TestTransferNotifiesBoth(t *testing.T) {
+	srv := newTestServer(t, SemanticsAtMostOnce)
+	roomA, lab1, other := newFakePeer("roomA"), newFakePeer("lab1"), newFakePeer("other")
+	send(t, srv, roomA, monitorReq(1, nil, 0))
+	lab := monitorReq(1, nil, 0)
+	lab.FacilityName = "Lab1"
+	send(t, srv, lab1, lab)
+	send(t, srv, other, monitorReq(1, []uint8{4}, 0))
+
+	send(t, srv, newFakePeer("client"), transferReq(2, "BKG-10000", "Lab1"))
+	for _, w := range []*fakePeer{roomA, lab1} {
+		got := events(t, w)
+		if len(got) != 1 || got[0] != common.EventChanged {
+			t.Errorf("%s heard events %v, want one change", w.name, got)
+			continue
+		}
+		if cb := w.callbacks()[0]; !strings.Contains(cb.Data, "BKG-10000 moved from RoomA to Lab1") {
+			t.Errorf("%s callback: %s", w.name, cb.Data)
+		}
+	}
+	if n := len(other.callbacks()); n != 0 {
+		t.Errorf("monitor of Friday only heard %d callbacks", n)
+	}
+}
@@ -0,0 +1,177 @@
+// server/webhook.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Event types reported to webhooks (and to monitor subscribers).
+const (
+	EventBookingCreated   = "booking_created"
+	EventBookingChanged   = "booking_changed"
+	EventBookingCanceled  = "booking_canceled"
+	EventParticipantAdded = "participant_added"
+)
+
+// WebhookConfig is one outbound webhook from the config file.
+// An empty Facilities list matches every facility of every namespace;
+// otherwise a bare name is a facility of the default namespace and
+// "ns/name" one of namespace ns, as in approvalRequired.
+type WebhookConfig struct {
+	URL        string   `json:"url"`
+	Facilities []string `json:"facilities"`
+
+	// targets is Facilities split into namespace and name by
+	// resolveWebhooks
+	targets []facilityTarget
+}
+
+// facilityTarget is a facility named in the config file.
+type facilityTarget struct {
+	ns, name string
+}
+
+// resolveWebhooks splits the facility filters of hooks into namespace and
+// name. It runs once the store is loaded, since "ns/name" only names a
+// namespace that exists.
+func (s *ServerState) resolveWebhooks(hooks []WebhookConfig) {
+	s.dataLock.RLock()
+	defer s.dataLock.RUnlock()
+
+	for i := range hooks {
+		hooks[i].targets = nil
+		for _, key := range hooks[i].Facilities {
+			ns, name := s.configFacility(key)
+			hooks[i].targets = append(hooks[i].targets, facilityTarget{ns: ns, name: name})
+		}
+	}
+}
+
+// matches reports whether the webhook wants events for facility of
+// namespace ns, as written in WebhookEvent.
+func (w WebhookConfig) matches(ns, facility string) bool {
+	if len(w.Facilities) == 0 {
+		return true
+	}
+	for _, t := range w.targets {
+		if namespaceLabel(t.ns) == ns && t.name == facility {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the JSON payload POSTed to each matching webhook.
+type WebhookEvent struct {
+	Namespace      string    `json:"namespace,omitempty"` // empty for the default namespace
+	Facility       string    `json:"facility"`
+	EventType      string    `json:"eventType"`
+	ConfirmationID string    `json:"confirmationId"`
+	Message        string    `json:"message"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+type webhookDelivery struct {
+	url  string
+	body []byte
+}
+
+// WebhookNotifier delivers events asynchronously through a small worker pool
+// so that packet handling never waits on HTTP.
+type WebhookNotifier struct {
+	hooks       []WebhookConfig
+	client      *http.Client
+	queue       chan webhookDelivery
+	maxAttempts int
+	backoff     time.Duration
+
+	failures atomic.Uint64 // deliveries that exhausted their retries or were dropped
+}
+
+// NewWebhookNotifier starts the delivery workers for the given hooks.
+func NewWebhookNotifier(hooks []WebhookConfig) *WebhookNotifier {
+	w := &WebhookNotifier{
+		hooks:       hooks,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		queue:       make(chan webhookDelivery, 256),
+		maxAttempts: 3,
+		backoff:     500 * time.Millisecond,
+	}
+	for i := 0; i < 4; i++ {
+		go w.worker()
+	}
+	return w
+}
+
+// Failures returns how many deliveries have been given up on.
+func (w *WebhookNotifier) Failures() uint64 {
+	if w == nil {
+		return 0
+	}
+	return w.failures.Load()
+}
+
+// Notify queues the event for every webhook whose filter matches.
+// It never blocks: if the queue is full the delivery is dropped and counted.
+func (w *WebhookNotifier) Notify(ev WebhookEvent) {
+	if w == nil {
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("Webhook: failed to encode event: %v", err)
+		return
+	}
+	for _, hook := range w.hooks {
+		if !hook.matches(ev.Namespace, ev.Facility) {
+			continue
+		}
+		select {
+		case w.queue <- webhookDelivery{url: hook.URL, body: body}:
+		default:
+			w.failures.Add(1)
+			log.Printf("Webhook: queue full, dropping event for %s", hook.URL)
+		}
+	}
+}
+
+func (w *WebhookNotifier) worker() {
+	for d := range w.queue {
+		w.deliver(d)
+	}
+}
+
+// deliver POSTs one payload, retrying with exponential backoff.
+func (w *WebhookNotifier) deliver(d webhookDelivery) {
+	delay := w.backoff
+	for attempt := 1; attempt <= w.maxAttempts; attempt++ {
+		err := w.post(d)
+		if err == nil {
+			return
+		}
+		log.Printf("Webhook: attempt %d/%d to %s failed: %v", attempt, w.maxAttempts, d.url, err)
+		if attempt < w.maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	w.failures.Add(1)
+}
+
+func (w *WebhookNotifier) post(d webhookDelivery) error {
+	resp, err := w.client.Post(d.url, "application/json", bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
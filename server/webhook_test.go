@@ -0,0 +1,160 @@
+// server/webhook_test.go
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookRecorder is a webhook endpoint that fails its first failFirst
+// requests with 500 and records the payloads of the rest.
+type hookRecorder struct {
+	mu        sync.Mutex
+	failFirst int
+	attempts  int
+	events    []WebhookEvent
+}
+
+func (h *hookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attempts++
+	if h.attempts <= h.failFirst {
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return
+	}
+	var ev WebhookEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.events = append(h.events, ev)
+}
+
+// waitEvents polls until n events arrived or a second has passed.
+func (h *hookRecorder) waitEvents(t *testing.T, n int) []WebhookEvent {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		h.mu.Lock()
+		got := append([]WebhookEvent(nil), h.events...)
+		h.mu.Unlock()
+		if len(got) >= n || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestNotifier(hooks ...WebhookConfig) *WebhookNotifier {
+	w := NewWebhookNotifier(hooks)
+	w.backoff = time.Millisecond
+	return w
+}
+
+func TestWebhookReceivesBookingEvents(t *testing.T) {
+	rec := &hookRecorder{}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+
+	srv := newTestServer(t, SemanticsAtLeastOnce)
+	srv.webhooks = newTestNotifier(WebhookConfig{URL: ts.URL})
+	peer := newFakePeer("client")
+	id := confirmationID(t, send(t, srv, peer, bookReq(1, "RoomA", 2, 14, 15)))
+
+	events := rec.waitEvents(t, 1)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Facility != "RoomA" || ev.EventType != EventBookingCreated || ev.ConfirmationID != id {
+		t.Errorf("event = %+v, want %s of %s in RoomA", ev, EventBookingCreated, id)
+	}
+	if ev.Namespace != "" {
+		t.Errorf("default namespace event has namespace %q", ev.Namespace)
+	}
+	if ev.Timestamp.IsZero() {
+		t.Error("event has no timestamp")
+	}
+}
+
+func TestWebhookRetriesFailingEndpoint(t *testing.T) {
+	rec := &hookRecorder{failFirst: 2}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+
+	w := newTestNotifier(WebhookConfig{URL: ts.URL})
+	w.Notify(WebhookEvent{Facility: "RoomA", EventType: EventBookingCanceled, ConfirmationID: "BKG-1"})
+
+	events := rec.waitEvents(t, 1)
+	if len(events) != 1 || events[0].ConfirmationID != "BKG-1" {
+		t.Fatalf("events = %+v, want the one delivered on the third attempt", events)
+	}
+	rec.mu.Lock()
+	attempts := rec.attempts
+	rec.mu.Unlock()
+	if attempts != 3 {
+		t.Errorf("endpoint saw %d attempts, want 3", attempts)
+	}
+	if n := w.Failures(); n != 0 {
+		t.Errorf("Failures() = %d after a delivery that succeeded on retry", n)
+	}
+}
+
+func TestWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+	rec := &hookRecorder{failFirst: 100}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+
+	w := newTestNotifier(WebhookConfig{URL: ts.URL})
+	w.Notify(WebhookEvent{Facility: "RoomA", EventType: EventBookingChanged})
+
+	deadline := time.Now().Add(time.Second)
+	for w.Failures() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := w.Failures(); n != 1 {
+		t.Fatalf("Failures() = %d, want 1", n)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.attempts != w.maxAttempts {
+		t.Errorf("endpoint saw %d attempts, want %d", rec.attempts, w.maxAttempts)
+	}
+}
+
+// TestWebhookFacilityFilter: a bare name is a facility of the default
+// namespace and "ns/name" one of ns, unless ns is no namespace.
+func TestWebhookFacilityFilter(t *testing.T) {
+	srv := physicsServer(t)
+	hooks := []WebhookConfig{{URL: "http://unused", Facilities: []string{"Lab1", "physics/Cryo", "chem/Lab9"}}}
+	srv.resolveWebhooks(hooks)
+	hook := hooks[0]
+	tests := []struct {
+		ns, facility string
+		want         bool
+	}{
+		{"", "Lab1", true},
+		{"", "RoomA", false},
+		{"physics", "Lab1", false},
+		{"physics", "Cryo", true},
+		{"", "Cryo", false},
+		{"", "physics/Cryo", false},
+		{"", "chem/Lab9", true},
+		{"chem", "Lab9", false},
+	}
+	for _, tt := range tests {
+		if got := hook.matches(tt.ns, tt.facility); got != tt.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", tt.ns, tt.facility, got, tt.want)
+		}
+	}
+	if !(WebhookConfig{}).matches("physics", "Lab1") {
+		t.Error("a webhook without facilities should match every facility")
+	}
+}
@@ -0,0 +1,139 @@
+// server/window_history.go
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+// HistoryWindow keeps only the most recent replies per client (-history=window).
+const HistoryWindow = "window"
+
+// windowedHistory is implemented by histories that forget old requests by
+// RequestID order. BelowWindow reports a request that is older than every
+// reply still kept for its client: it was either executed and forgotten or
+// overtaken by too many newer requests, so it must not run again.
+type windowedHistory interface {
+	HistoryCache
+	BelowWindow(key RequestKey) bool
+}
+
+// clientWindow holds one client's recent replies. floor is the highest ID
+// evicted so far; every ID at or below it counts as done.
+type clientWindow struct {
+	floor    uint64
+	ids      []uint64 // kept IDs, ascending
+	replies  map[uint64]historyEntry
+	lastUsed time.Time // last Put
+}
+
+// WindowHistory bounds memory to size replies per client. It relies on
+// clients issuing increasing RequestIDs; reordering within the window is
+// harmless because any ID above the floor is looked up individually.
+// Sweep forgets clients that have sent nothing for idle, so clients that
+// come and go don't keep their windows forever.
+type WindowHistory struct {
+	mu      sync.Mutex
+	size    int
+	idle    time.Duration
+	clients map[string]*clientWindow
+}
+
+// NewWindowHistory returns a history keeping size replies per client and
+// forgetting a client idle for longer than idle (0 = never).
+func NewWindowHistory(size int, idle time.Duration) *WindowHistory {
+	return &WindowHistory{size: size, idle: idle, clients: make(map[string]*clientWindow)}
+}
+
+func (h *WindowHistory) Get(key RequestKey) (common.ReplyMessage, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.clients[key.Addr]
+	if !ok {
+		return common.ReplyMessage{}, false
+	}
+	e, ok := w.replies[key.RequestID]
+	if !ok {
+		return common.ReplyMessage{}, false
+	}
+	if !e.expiresAt.IsZero() && time.Now().After(e.expiresAt) {
+		return common.ReplyMessage{}, false
+	}
+	return e.reply, true
+}
+
+func (h *WindowHistory) Put(key RequestKey, reply common.ReplyMessage, ttl time.Duration) {
+	e := historyEntry{reply: reply}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.clients[key.Addr]
+	if !ok {
+		w = &clientWindow{replies: make(map[uint64]historyEntry)}
+		h.clients[key.Addr] = w
+	}
+	w.lastUsed = time.Now()
+	if _, exists := w.replies[key.RequestID]; !exists {
+		i := sort.Search(len(w.ids), func(i int) bool { return w.ids[i] >= key.RequestID })
+		w.ids = append(w.ids, 0)
+		copy(w.ids[i+1:], w.ids[i:])
+		w.ids[i] = key.RequestID
+	}
+	w.replies[key.RequestID] = e
+
+	for len(w.ids) > h.size {
+		oldest := w.ids[0]
+		w.ids = w.ids[1:]
+		delete(w.replies, oldest)
+		if oldest > w.floor {
+			w.floor = oldest
+		}
+	}
+}
+
+func (h *WindowHistory) BelowWindow(key RequestKey) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.clients[key.Addr]
+	if !ok || len(w.ids) < h.size {
+		return false // nothing evicted yet
+	}
+	_, kept := w.replies[key.RequestID]
+	return !kept && key.RequestID <= w.floor
+}
+
+// Sweep drops the windows of clients idle for longer than h.idle and
+// returns how many replies went with them. A retransmission from such a
+// client arriving later is no longer recognised, so idle should be well
+// above any client's retry period.
+func (h *WindowHistory) Sweep(now time.Time) int {
+	if h.idle <= 0 {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	removed := 0
+	for addr, w := range h.clients {
+		if now.Sub(w.lastUsed) > h.idle {
+			removed += len(w.ids)
+			delete(h.clients, addr)
+		}
+	}
+	return removed
+}
+
+// Len returns the number of cached replies over all clients.
+func (h *WindowHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, w := range h.clients {
+		n += len(w.ids)
+	}
+	return n
+}
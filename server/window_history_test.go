@@ -0,0 +1,166 @@
+// server/window_history_test.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iyzyman/distributed-go/common"
+)
+
+func putIDs(h *WindowHistory, addr string, ids ...uint64) {
+	for _, id := range ids {
+		h.Put(RequestKey{addr, id}, common.ReplyMessage{RequestID: id, Data: fmt.Sprint(id)}, 0)
+	}
+}
+
+func TestWindowHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		puts  []uint64
+		kept  []uint64
+		below []uint64 // evicted: refused as already done
+		above []uint64 // never seen and not below the floor
+	}{
+		{"in order", []uint64{1, 2, 3, 4, 5}, []uint64{3, 4, 5}, []uint64{1, 2}, []uint64{6}},
+		{"reordered within the window", []uint64{1, 3, 2, 5, 4}, []uint64{3, 4, 5}, []uint64{1, 2}, []uint64{6}},
+		{"late arrival after eviction", []uint64{1, 2, 3, 5, 4}, []uint64{3, 4, 5}, []uint64{1, 2}, nil},
+		{"gap", []uint64{10, 20, 30, 40}, []uint64{20, 30, 40}, []uint64{5, 10}, []uint64{15, 25, 35}},
+		{"not full", []uint64{7, 9}, []uint64{7, 9}, nil, []uint64{1, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWindowHistory(3, 0)
+			putIDs(h, "client", tt.puts...)
+			for _, id := range tt.kept {
+				rep, ok := h.Get(RequestKey{"client", id})
+				if !ok || rep.Data != fmt.Sprint(id) {
+					t.Errorf("Get(%d) = %q, %v; want it kept", id, rep.Data, ok)
+				}
+				if h.BelowWindow(RequestKey{"client", id}) {
+					t.Errorf("kept ID %d reported below the window", id)
+				}
+			}
+			for _, id := range tt.below {
+				if _, ok := h.Get(RequestKey{"client", id}); ok {
+					t.Errorf("Get(%d) hit, want it evicted", id)
+				}
+				if !h.BelowWindow(RequestKey{"client", id}) {
+					t.Errorf("ID %d not reported below the window", id)
+				}
+			}
+			for _, id := range tt.above {
+				if h.BelowWindow(RequestKey{"client", id}) {
+					t.Errorf("new ID %d reported below the window", id)
+				}
+			}
+			if n := h.Len(); n != len(tt.kept) {
+				t.Errorf("Len() = %d, want %d", n, len(tt.kept))
+			}
+		})
+	}
+}
+
+func TestWindowHistoryPerClient(t *testing.T) {
+	h := NewWindowHistory(2, 0)
+	putIDs(h, "a", 100, 101, 102)
+	putIDs(h, "b", 1)
+	if h.BelowWindow(RequestKey{"b", 50}) {
+		t.Error("client a's window affects client b")
+	}
+	if _, ok := h.Get(RequestKey{"b", 101}); ok {
+		t.Error("client b sees client a's reply")
+	}
+}
+
+func TestWindowHistorySweep(t *testing.T) {
+	h := NewWindowHistory(3, time.Minute)
+	putIDs(h, "idle", 1, 2)
+	h.clients["idle"].lastUsed = time.Now().Add(-2 * time.Minute)
+	putIDs(h, "active", 1)
+
+	if n := h.Sweep(time.Now()); n != 2 {
+		t.Errorf("Sweep removed %d replies, want 2", n)
+	}
+	if _, ok := h.clients["idle"]; ok {
+		t.Error("idle client kept")
+	}
+	if _, ok := h.Get(RequestKey{"active", 1}); !ok {
+		t.Error("active client's reply swept")
+	}
+	if n := NewWindowHistory(3, 0).Sweep(time.Now().Add(time.Hour)); n != 0 {
+		t.Errorf("Sweep without an idle limit removed %d", n)
+	}
+}
+
+// addParticipant is an AddParticipant of name to BKG-10000.
+func addParticipant(id uint64, name string) common.RequestMessage {
+	return common.RequestMessage{OpCode: common.OpAddParticipant, RequestID: id, ConfirmationID: "BKG-10000", ParticipantName: name}
+}
+
+// participants returns the participants of BKG-10000.
+func participants(srv *ServerState) string {
+	srv.dataLock.RLock()
+	defer srv.dataLock.RUnlock()
+	_, fac, i, _ := srv.findBooking(common.DefaultNamespace, "BKG-10000")
+	return strings.Join(fac.Bookings[i].Participants, ",")
+}
+
+func newWindowServer(t *testing.T, size int) *ServerState {
+	t.Helper()
+	srv, err := NewServerState(SemanticsAtMostOnce, NewMemoryStore(), NewWindowHistory(size, 0))
+	if err != nil {
+		t.Fatalf("NewServerState: %v", err)
+	}
+	return srv
+}
+
+// TestWindowReordering delivers requests and their retransmissions out of
+// order; each request runs exactly once.
+func TestWindowReordering(t *testing.T) {
+	srv := newWindowServer(t, 4)
+	p := newFakePeer("client")
+	base := uint64(1) << 40
+
+	for _, n := range []uint64{0, 2, 1, 0, 3, 2, 1, 3} {
+		rep := send(t, srv, p, addParticipant(base+n, fmt.Sprintf("p%d", n)))
+		if rep.Status != common.StatusOK {
+			t.Fatalf("request %d: status %d: %s", n, rep.Status, rep.Data)
+		}
+	}
+	if got := participants(srv); got != "p0,p2,p1,p3" {
+		t.Errorf("participants = %q, want each added once in arrival order", got)
+	}
+}
+
+// TestWindowClientRestart: a restarted client starts from a higher
+// InitialRequestID, so its requests run although the server still has the
+// old run's window; a straggler of the old run that has fallen below the
+// window is refused instead of running again.
+func TestWindowClientRestart(t *testing.T) {
+	srv := newWindowServer(t, 2)
+	p := newFakePeer("client")
+
+	oldRun := uint64(time.Now().Add(-time.Minute).UnixMilli()) << 20
+	for n := uint64(0); n < 3; n++ {
+		send(t, srv, p, addParticipant(oldRun+n, fmt.Sprintf("old%d", n)))
+	}
+
+	newRun := uint64(time.Now().UnixMilli()) << 20
+	for n := uint64(0); n < 3; n++ {
+		rep := send(t, srv, p, addParticipant(newRun+n, fmt.Sprintf("new%d", n)))
+		if rep.Status != common.StatusOK {
+			t.Fatalf("new run request %d: status %d: %s", n, rep.Status, rep.Data)
+		}
+	}
+
+	rep := send(t, srv, p, addParticipant(oldRun+2, "old2"))
+	if rep.Status != common.StatusOutsideWindow {
+		t.Errorf("old run's straggler: status %d, want %d: %s", rep.Status, common.StatusOutsideWindow, rep.Data)
+	}
+	if got := participants(srv); got != "old0,old1,old2,new0,new1,new2" {
+		t.Errorf("participants = %q", got)
+	}
+}